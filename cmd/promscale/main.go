@@ -15,6 +15,7 @@ import (
 
 func main() {
 	args := os.Args[1:]
+	isPreflight, args, jsonOutput := runner.ParsePreflightArgs(args)
 	if shouldProceed := runner.ParseArgs(args); !shouldProceed {
 		os.Exit(0)
 	}
@@ -31,6 +32,18 @@ func main() {
 		fmt.Println("Fatal error: cannot start logger: ", err)
 		os.Exit(1)
 	}
+	if isPreflight {
+		report := runner.Preflight(cfg)
+		if jsonOutput {
+			err = report.WriteJSON(os.Stdout)
+		} else {
+			err = report.WriteText(os.Stdout)
+		}
+		if err != nil || !report.Passed {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	err = runner.Run(cfg)
 	if err != nil {
 		os.Exit(1)
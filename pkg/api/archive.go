@@ -0,0 +1,35 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/query"
+)
+
+var errArchivedQuery = fmt.Errorf("the query read archived samples, which is slower and subject to the promql-archived-* limits")
+
+// archivedQuery returns the engine and the context to evaluate the query
+// with, and whether it reads the archived samples, which it does when the
+// include_archived parameter is set and samples are archived.
+func archivedQuery(ctx context.Context, r *http.Request, queryEngine, archivedEngine *promql.Engine) (*promql.Engine, context.Context, bool, error) {
+	param := r.FormValue("include_archived")
+	if param == "" {
+		return queryEngine, ctx, false, nil
+	}
+	include, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("invalid include_archived parameter: %w", err)
+	}
+	if !include || archivedEngine == nil {
+		return queryEngine, ctx, false, nil
+	}
+	return archivedEngine, query.WithArchived(ctx), true, nil
+}
@@ -0,0 +1,112 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/blang/semver/v4"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/version"
+)
+
+const buildInfoDBVersionsSQL = `SELECT
+	(SELECT version FROM public.prom_schema_migrations LIMIT 1),
+	(SELECT extversion FROM pg_catalog.pg_extension WHERE extname = 'timescaledb'),
+	(SELECT extversion FROM pg_catalog.pg_extension WHERE extname = 'promscale')`
+
+// supportedRemoteProtocolVersions lists the remote write and read protocol
+// versions accepted by the write and read endpoints.
+var supportedRemoteProtocolVersions = []string{"0.1.0"}
+
+type compatibilityMatrix struct {
+	Postgres                  string `json:"postgres"`
+	TimescaleDB               string `json:"timescaledb"`
+	TimescaleDBWithWarnings   string `json:"timescaledbWithWarnings"`
+	PromscaleExtension        string `json:"promscaleExtension"`
+	EarliestUpgradableVersion string `json:"earliestUpgradableVersion"`
+}
+
+// buildInfo extends the Prometheus build information with the Promscale
+// specific versions. Version is the Prometheus version the API is compatible
+// with, since that is what clients probing the endpoint expect.
+type buildInfo struct {
+	Version                   string              `json:"version"`
+	Revision                  string              `json:"revision"`
+	Branch                    string              `json:"branch"`
+	BuildUser                 string              `json:"buildUser"`
+	BuildDate                 string              `json:"buildDate"`
+	GoVersion                 string              `json:"goVersion"`
+	PromscaleVersion          string              `json:"promscaleVersion"`
+	RemoteWriteVersions       []string            `json:"remoteWriteVersions"`
+	RemoteReadVersions        []string            `json:"remoteReadVersions"`
+	SchemaVersion             string              `json:"schemaVersion"`
+	TimescaleDBVersion        string              `json:"timescaledbVersion"`
+	PromscaleExtensionVersion string              `json:"promscaleExtensionVersion"`
+	MigrationPending          bool                `json:"migrationPending"`
+	Compatibility             compatibilityMatrix `json:"compatibility"`
+}
+
+// BuildInfo returns an http.Handler reporting the connector version along with
+// the versions detected in the database and the supported version ranges.
+func BuildInfo(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, buildInfoHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func buildInfoHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := buildInfo{
+			Version:             version.PrometheusCompatible,
+			Revision:            version.CommitHash,
+			GoVersion:           runtime.Version(),
+			PromscaleVersion:    version.Promscale,
+			RemoteWriteVersions: supportedRemoteProtocolVersions,
+			RemoteReadVersions:  supportedRemoteProtocolVersions,
+			Compatibility: compatibilityMatrix{
+				Postgres:                  version.PgVersionNumRange,
+				TimescaleDB:               version.TimescaleVersionRangeString.Safe,
+				TimescaleDBWithWarnings:   version.TimescaleVersionRangeString.Warn,
+				PromscaleExtension:        version.ExtVersionRangeString,
+				EarliestUpgradableVersion: version.EarliestUpgradeTestVersion,
+			},
+		}
+
+		var schemaVersion, tsdbVersion, extVersion *string
+		err := conn.QueryRow(context.Background(), buildInfoDBVersionsSQL).Scan(&schemaVersion, &tsdbVersion, &extVersion)
+		if err != nil {
+			log.Error("msg", "error fetching versions from the database", "err", err)
+			respondError(w, http.StatusInternalServerError, fmt.Errorf("fetching versions from the database: %w", err), "internal")
+			return
+		}
+		if tsdbVersion != nil {
+			info.TimescaleDBVersion = *tsdbVersion
+		}
+		if extVersion != nil {
+			info.PromscaleExtensionVersion = *extVersion
+		}
+		info.MigrationPending = true
+		if schemaVersion != nil {
+			info.SchemaVersion = *schemaVersion
+			info.MigrationPending = isMigrationPending(*schemaVersion)
+		}
+		respondStatus(w, info)
+	}
+}
+
+// isMigrationPending reports whether the schema is older than the one
+// expected by this connector.
+func isMigrationPending(schemaVersion string) bool {
+	dbVersion, err := semver.Parse(schemaVersion)
+	if err != nil {
+		return true
+	}
+	return dbVersion.LT(semver.MustParse(version.Promscale))
+}
@@ -0,0 +1,26 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/version"
+)
+
+func TestIsMigrationPending(t *testing.T) {
+	current := semver.MustParse(version.Promscale)
+	older := current
+	older.Major = 0
+	older.Minor = 0
+	older.Patch = 1
+	older.Pre = nil
+
+	require.False(t, isMigrationPending(version.Promscale))
+	require.True(t, isMigrationPending(older.String()))
+	require.True(t, isMigrationPending("not a version"))
+}
@@ -0,0 +1,92 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/timescale/promscale/pkg/chaos"
+)
+
+type faultsResponse struct {
+	Latency            string  `json:"latency"`
+	LatencyProbability float64 `json:"latency_probability"`
+	DropProbability    float64 `json:"drop_probability"`
+	ErrorProbability   float64 `json:"error_probability"`
+}
+
+// Chaos returns an http.Handler to inspect and configure fault injection.
+// Faults can only be configured in binaries built with the `chaos` build tag.
+func Chaos(conf *Config) http.Handler {
+	return corsWrapper(conf, chaosHandler(conf))
+}
+
+func chaosHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, fmt.Errorf("fault injection requires admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+			return
+		}
+		if !chaos.Enabled() {
+			respondError(w, http.StatusNotFound, chaos.ErrNotEnabled, "unavailable")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodDelete:
+			chaos.Reset()
+		default:
+			if err := r.ParseForm(); err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			faults, err := parseFaults(r)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			if err := chaos.Set(chaos.Point(r.FormValue("point")), faults); err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+		}
+
+		res := make(map[chaos.Point]faultsResponse)
+		for p, f := range chaos.Get() {
+			res[p] = faultsResponse{
+				Latency:            f.Latency.String(),
+				LatencyProbability: f.LatencyProbability,
+				DropProbability:    f.DropProbability,
+				ErrorProbability:   f.ErrorProbability,
+			}
+		}
+		respond(w, http.StatusOK, res)
+	}
+}
+
+func parseFaults(r *http.Request) (f chaos.Faults, err error) {
+	if s := r.FormValue("latency"); s != "" {
+		if f.Latency, err = parseDuration(s); err != nil {
+			return f, err
+		}
+	}
+	probabilities := map[string]*float64{
+		"latency_probability": &f.LatencyProbability,
+		"drop_probability":    &f.DropProbability,
+		"error_probability":   &f.ErrorProbability,
+	}
+	for name, p := range probabilities {
+		s := r.FormValue(name)
+		if s == "" {
+			continue
+		}
+		if *p, err = strconv.ParseFloat(s, 64); err != nil {
+			return f, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return f, nil
+}
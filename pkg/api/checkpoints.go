@@ -0,0 +1,38 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/checkpoint"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// Checkpoints returns an http.Handler listing the offsets of the replayable
+// sources up to which the samples were committed, for their consumers to
+// resume from after a restart. The source parameter selects a single source.
+func Checkpoints(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, checkpointsHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func checkpointsHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		data, err := checkpoint.Query(conn, r.FormValue("source"))
+		if err != nil {
+			log.Error("msg", "error fetching the checkpoints", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "fetching checkpoints")
+			return
+		}
+		respond(w, http.StatusOK, data)
+	}
+}
@@ -0,0 +1,57 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// chunkedWriter writes the frames of streamed remote read responses, each
+// prefixed with its size as a uvarint and its CRC-32 checksum with the
+// Castagnoli polynomial as a big-endian uint32, and flushes them. It is the
+// framing of the Prometheus remote storage package, which cannot be imported
+// since it registers the same protobuf types as pkg/prompb.
+type chunkedWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+	crc32   hash.Hash32
+}
+
+func newChunkedWriter(w io.Writer, f http.Flusher) *chunkedWriter {
+	return &chunkedWriter{writer: w, flusher: f, crc32: crc32.New(castagnoliTable)}
+}
+
+// Write writes b as a frame and flushes it. It returns the number of bytes
+// of b written, without the size and checksum.
+func (w *chunkedWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var buf [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(buf[:], uint64(len(b)))
+	w.crc32.Reset()
+	if _, err := w.crc32.Write(b); err != nil {
+		return 0, err
+	}
+	binary.BigEndian.PutUint32(buf[n:], w.crc32.Sum32())
+	if _, err := w.writer.Write(buf[:n+4]); err != nil {
+		return 0, err
+	}
+
+	n, err := w.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	w.flusher.Flush()
+	return n, nil
+}
@@ -21,8 +21,14 @@ import (
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/util/httputil"
+	"github.com/timescale/promscale/pkg/encryption"
+	"github.com/timescale/promscale/pkg/naming"
+	"github.com/timescale/promscale/pkg/pause"
+	deletePkg "github.com/timescale/promscale/pkg/pgmodel/delete"
 	pgmodel "github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/slo"
 	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/query"
 	"github.com/timescale/promscale/pkg/tenancy"
 )
 
@@ -86,10 +92,41 @@ type Config struct {
 	ReadOnly         bool
 	HighAvailability bool
 	AdminAPIEnabled  bool
+	Tracing          bool
 	TelemetryPath    string
 
 	Auth         *Auth
+	InternalAuth *Auth
 	MultiTenancy tenancy.Authorizer
+	// Tenants is the store of the tenants managed through the tenant admin
+	// API, nil unless the valid tenants are read from the catalog.
+	Tenants *tenancy.Store
+	// Purger runs the purges of series requested through the purge admin
+	// API.
+	Purger *deletePkg.Purger
+	// SLOs manages the service level objectives defined through the SLO
+	// API.
+	SLOs *slo.Manager
+	// SLOEvaluationInterval is the interval at which the series of the SLOs
+	// are computed, 0 if they are not.
+	SLOEvaluationInterval time.Duration
+	// LabelEncryptor encrypts the values of the encrypted labels, nil if no
+	// label is encrypted.
+	LabelEncryptor *encryption.LabelEncryptor
+	// NamingPolicy enforces the naming conventions on the written metrics,
+	// nil if there are none.
+	NamingPolicy *naming.Policy
+	// IngestPauses pauses the ingestion of tenants or metrics, nil on
+	// read-only connectors, and IngestPauseMode is the default mode of the
+	// pauses.
+	IngestPauses    *pause.Pauses
+	IngestPauseMode string
+
+	// WriteSigningKeys maps tenant names to the keys used to verify
+	// the HMAC signature of write requests.
+	WriteSigningKeysFile  string
+	WriteSigningKeys      map[string][]byte
+	WriteSignatureMaxSkew time.Duration
 
 	// PromQL configuration.
 	EnableFeatures       string
@@ -99,6 +136,24 @@ type Config struct {
 	LookBackDelta        time.Duration
 	MaxSamples           int64
 	MaxPointsPerTs       int64
+
+	// Samples older than ArchiveAge are only read by the queries that opt
+	// in, which have their own limits.
+	ArchiveAge              time.Duration
+	ArchivedMaxQueryTimeout time.Duration
+	ArchivedMaxSamples      int64
+
+	// ColdQueryCfg configures how the queries reading old samples are run.
+	ColdQueryCfg query.ColdQueryConfig
+
+	// ResultsCacheCfg configures the cache of the range query results, and
+	// ResultsCache is the cache, nil if it is disabled.
+	ResultsCacheCfg query.ResultsCacheConfig
+	ResultsCache    *query.ResultsCache
+
+	// Flags holds the values of all the connector's flags, reported by the
+	// flags status endpoint.
+	Flags map[string]string
 }
 
 func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
@@ -107,6 +162,8 @@ func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
 	fs.BoolVar(&cfg.ReadOnly, "read-only", false, "Read-only mode for the connector. Operations related to writing or updating the database are disallowed. It is used when pointing the connector to a TimescaleDB read replica.")
 	fs.BoolVar(&cfg.HighAvailability, "high-availability", false, "Enable external_labels based HA.")
 	fs.BoolVar(&cfg.AdminAPIEnabled, "web-enable-admin-api", false, "Allow operations via API that are for advanced users. Currently, these operations are limited to deletion of series.")
+	fs.BoolVar(&cfg.Tracing, "web-tracing", false, "Trace the requests to the web endpoints with Jaeger, configured with the JAEGER_* environment variables, "+
+		"and return the ID of the trace of a request in its X-Trace-Id response header, and in the warnings of the query results.")
 	fs.StringVar(&cfg.TelemetryPath, "web-telemetry-path", "/metrics", "Web endpoint for exposing Promscale's Prometheus metrics.")
 
 	fs.StringVar(&cfg.Auth.BasicAuthUsername, "auth-username", "", "Authentication username used for web endpoint authentication. Disabled by default.")
@@ -115,11 +172,24 @@ func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
 	fs.StringVar(&cfg.Auth.BearerToken, "bearer-token", "", "Bearer token (JWT) used for web endpoint authentication. Disabled by default. Mutually exclusive with bearer-token-file and basic auth methods.")
 	fs.StringVar(&cfg.Auth.BearerTokenFile, "bearer-token-file", "", "Path of the file containing the bearer token (JWT) used for web endpoint authentication. Disabled by default. Mutually exclusive with bearer-token and basic auth methods.")
 
+	cfg.InternalAuth = &Auth{}
+	fs.StringVar(&cfg.InternalAuth.BasicAuthUsername, "internal-auth-username", "", "Authentication username used for the endpoints served on web-internal-listen-address. Disabled by default.")
+	fs.StringVar(&cfg.InternalAuth.BasicAuthPassword, "internal-auth-password", "", "Authentication password used for the endpoints served on web-internal-listen-address. This flag should be set together with internal-auth-username.")
+	fs.StringVar(&cfg.InternalAuth.BasicAuthPasswordFile, "internal-auth-password-file", "", "Path for auth password file used for the endpoints served on web-internal-listen-address. This flag should be set together with internal-auth-username.")
+	fs.StringVar(&cfg.InternalAuth.BearerToken, "internal-bearer-token", "", "Bearer token (JWT) used for the endpoints served on web-internal-listen-address. Disabled by default.")
+	fs.StringVar(&cfg.InternalAuth.BearerTokenFile, "internal-bearer-token-file", "", "Path of the file containing the bearer token (JWT) used for the endpoints served on web-internal-listen-address. Disabled by default.")
+	fs.StringVar(&cfg.WriteSigningKeysFile, "write-signing-keys-file", "", "Path of a file with the keys used to verify the HMAC-SHA256 signature of write requests, one '<tenant>:<key>' per line. "+
+		"The key of tenant '*' is used for requests without a tenant header or for tenants not listed. If set, write requests without a valid "+
+		"'"+signatureHeader+"' header are rejected. Disabled by default.")
+	fs.DurationVar(&cfg.WriteSignatureMaxSkew, "write-signature-max-skew", 0, "Enables replay protection for signed write requests. Requests must then carry the '"+
+		signatureTimestampHeader+"' (unix seconds) and '"+signatureNonceHeader+"' headers, which are covered by the signature. Requests with a timestamp "+
+		"further than this duration from the current time, or with a nonce already seen, are rejected. Requires write-signing-keys-file. Disabled by default.")
+
 	// PromQL configuration flags.
 	fs.StringVar(&cfg.EnableFeatures, "promql-enable-feature", "", "[EXPERIMENTAL] Enable optional PromQL features, separated by commas. These are disabled by default in Promscale's PromQL engine. "+
 		"Currently, this includes 'promql-at-modifier' and 'promql-negative-offset'. For more information, see https://github.com/prometheus/prometheus/blob/master/docs/disabled_features.md")
 	fs.DurationVar(&cfg.MaxQueryTimeout, "promql-query-timeout", 2*time.Minute, "Maximum time a query may take before being aborted. This option sets both the default and maximum value of the 'timeout' parameter in "+
-		"'/api/v1/query.*' endpoints.")
+		"'/api/v1/query.*' endpoints. The SQL queries of an aborted query are cancelled in the database.")
 	fs.DurationVar(&cfg.SubQueryStepInterval, "promql-default-subquery-step-interval", 1*time.Minute, "Default step interval to be used for PromQL subquery evaluation. "+
 		"This value is used if the subquery does not specify the step value explicitly. Example: <metric_name>[30m:]. Note: in Prometheus this setting is set by the evaluation_interval option.")
 	fs.DurationVar(&cfg.LookBackDelta, "promql-lookback-delta", time.Minute*5, "Maximum lookback duration for retrieving metrics during expression evaluations and federation.")
@@ -128,6 +198,27 @@ func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
 		"so this also limits the number of samples a query can return.")
 	fs.Int64Var(&cfg.MaxPointsPerTs, "promql-max-points-per-ts", 11000, "Maximum number of points per time-series in a query-range request. "+
 		"This calculation is an estimation, that happens as (start - end)/step where start and end are the 'start' and 'end' timestamps of the query_range.")
+	fs.DurationVar(&cfg.ArchiveAge, "promql-archive-age", 0, "Age after which samples are considered archived, e.g. once they are moved to slower tiered storage. "+
+		"Queries only read archived samples when they set the 'include_archived=true' parameter, and otherwise have a warning if their results exclude some. Disabled by default.")
+	fs.DurationVar(&cfg.ArchivedMaxQueryTimeout, "promql-archived-query-timeout", 10*time.Minute, "Maximum time a query reading archived samples may take before being aborted.")
+	fs.Int64Var(&cfg.ArchivedMaxSamples, "promql-archived-max-samples", 50000000, "Maximum number of samples a single query reading archived samples can load into memory.")
+	fs.DurationVar(&cfg.ColdQueryCfg.Age, "promql-cold-query-age", 0, "Age of the samples above which a query reading them is cold, e.g. the compression delay of the chunks. "+
+		"Cold queries are run with their own concurrency limit and timeout, and their SQL statements in the 'cold' query class, so that a flood of historical "+
+		"queries cannot block real-time dashboards. Disabled by default.")
+	fs.DurationVar(&cfg.ColdQueryCfg.Timeout, "promql-cold-query-timeout", 0, "Time after which the SQL statements of a cold query are cancelled. "+
+		"0 means the cold queries only have the promql-query-timeout of all the queries.")
+	fs.IntVar(&cfg.ColdQueryCfg.MaxConcurrent, "promql-cold-max-concurrent", 4, "Maximum number of cold queries run at once, the others waiting for one to finish. 0 means no limit.")
+	fs.Int64Var(&cfg.ResultsCacheCfg.MaxBytes, "query-results-cache-size", 0, "Estimated size in bytes of the in-memory cache of the results of range queries, "+
+		"which splits their range at query-results-cache-split-interval so that the repeated refreshes of dashboards reuse the splits they have in common. Disabled by default.")
+	fs.DurationVar(&cfg.ResultsCacheCfg.SplitInterval, "query-results-cache-split-interval", time.Hour, "Interval the ranges of the range queries are split on, each split being cached separately.")
+	fs.DurationVar(&cfg.ResultsCacheCfg.Freshness, "query-results-cache-freshness", 10*time.Minute, "Only cache the results of the splits ending this long before the latest sample ingested by the connector, "+
+		"or before the current time, so that late samples are ingested first. Samples ingested by the connector older than cached splits invalidate them.")
+	fs.DurationVar(&cfg.ResultsCacheCfg.MaxAge, "query-results-cache-max-age", time.Hour, "How long the results of the splits are cached, so that the samples deleted by the retention jobs, "+
+		"or written and deleted through other connectors, are eventually taken into account.")
+	fs.StringVar(&cfg.IngestPauseMode, "ingest-pause-mode", string(pause.ModeReject), "Default mode of the pauses of the ingestion of tenants or metrics set with the "+
+		"/api/v1/admin/ingest/pauses endpoint. 'reject' rejects the write requests with paused samples with a 503 status, which Prometheus retries, "+
+		"and 'drop' acknowledges the paused samples without writing them.")
+	fs.DurationVar(&cfg.SLOEvaluationInterval, "slo-evaluation-interval", time.Minute, "Interval at which the burn rates and error budgets of the SLOs are computed and ingested as series. 0 disables the evaluation.")
 	return cfg
 }
 
@@ -137,7 +228,44 @@ func Validate(cfg *Config) error {
 	} else {
 		cfg.EnabledFeaturesList = []string{}
 	}
-	return cfg.Auth.Validate()
+	if err := cfg.Auth.Validate(); err != nil {
+		return err
+	}
+	if cfg.InternalAuth != nil {
+		if err := cfg.InternalAuth.Validate(); err != nil {
+			return fmt.Errorf("internal auth: %w", err)
+		}
+	}
+	if cfg.WriteSigningKeysFile != "" {
+		keys, err := readSigningKeys(cfg.WriteSigningKeysFile)
+		if err != nil {
+			return fmt.Errorf("error reading write signing keys: %w", err)
+		}
+		cfg.WriteSigningKeys = keys
+	}
+	if cfg.ArchiveAge < 0 {
+		return fmt.Errorf("promql-archive-age must not be negative")
+	}
+	if cfg.ColdQueryCfg.Age < 0 || cfg.ColdQueryCfg.Timeout < 0 || cfg.ColdQueryCfg.MaxConcurrent < 0 {
+		return fmt.Errorf("promql-cold-query-age, promql-cold-query-timeout and promql-cold-max-concurrent must not be negative")
+	}
+	if cfg.ResultsCacheCfg.MaxBytes != 0 {
+		if err := cfg.ResultsCacheCfg.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.IngestPauseMode != "" {
+		if _, err := pause.ParseMode(cfg.IngestPauseMode); err != nil {
+			return fmt.Errorf("invalid ingest-pause-mode: %w", err)
+		}
+	}
+	if cfg.SLOEvaluationInterval < 0 {
+		return fmt.Errorf("slo-evaluation-interval must not be negative")
+	}
+	if cfg.WriteSignatureMaxSkew > 0 && cfg.WriteSigningKeysFile == "" {
+		return fmt.Errorf("write-signature-max-skew requires write-signing-keys-file to be set")
+	}
+	return nil
 }
 
 func readFromFile(path string, defaultValue string) (string, error) {
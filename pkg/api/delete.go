@@ -12,11 +12,14 @@ import (
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgclient"
-	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	deletePkg "github.com/timescale/promscale/pkg/pgmodel/delete"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 )
 
+// Delete returns an http.Handler deleting the samples between the start and
+// end parameters of the series matching the match[] selectors, and the
+// series left without samples. Without a time range, the series are deleted
+// along with all their samples.
 func Delete(conf *Config, client *pgclient.Client) http.Handler {
 	hf := corsWrapper(conf, deleteHandler(conf, client))
 	return gziphandler.GzipHandler(hf)
@@ -57,9 +60,10 @@ func deleteHandler(config *Config, client *pgclient.Client) http.HandlerFunc {
 			respondError(w, http.StatusBadRequest, err, "bad_data")
 			return
 		}
-		if start != model.MinTime || end != model.MaxTime {
-			log.Warn("msg", "Time based series deletion is unsupported.")
-			respondError(w, http.StatusBadRequest, errors.ErrTimeBasedDeletion, "bad_data")
+		if end.Before(start) {
+			err := fmt.Errorf("end timestamp must not be before start time")
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
 			return
 		}
 		for _, s := range r.Form["match[]"] {
@@ -68,6 +72,12 @@ func deleteHandler(config *Config, client *pgclient.Client) http.HandlerFunc {
 				respondError(w, http.StatusBadRequest, err, "bad_data")
 				return
 			}
+			if config.LabelEncryptor != nil {
+				if matchers, err = config.LabelEncryptor.EncryptMatchers(matchers); err != nil {
+					respondError(w, http.StatusBadRequest, err, "bad_data")
+					return
+				}
+			}
 			if client == nil {
 				continue
 			}
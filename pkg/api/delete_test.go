@@ -43,27 +43,30 @@ func TestDelete(t *testing.T) {
 		{
 			name:         "normal_with_start",
 			matchers:     []string{`{__name__=~".*"}`},
-			start:        "1604311719000",
-			expectedCode: http.StatusBadRequest,
-			fails:        true,
-			message:      "time based series deletion is unsupported",
+			start:        "1604311719",
+			expectedCode: http.StatusOK,
 		},
 		{
 			name:         "normal_with_end",
 			matchers:     []string{`{__name__=~".*"}`},
-			end:          "1604311719000",
-			expectedCode: http.StatusBadRequest,
-			fails:        true,
-			message:      "time based series deletion is unsupported",
+			end:          "1604311719",
+			expectedCode: http.StatusOK,
 		},
 		{
 			name:         "normal_with_start_end",
 			matchers:     []string{`{__name__=~".*"}`},
-			start:        "1604311711000",
-			end:          "1604311719000",
+			start:        "1604311711",
+			end:          "1604311719",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "end_before_start",
+			matchers:     []string{`{__name__=~".*"}`},
+			start:        "1604311719",
+			end:          "1604311711",
 			expectedCode: http.StatusBadRequest,
 			fails:        true,
-			message:      "time based series deletion is unsupported",
+			message:      "end timestamp must not be before start time",
 		},
 		{
 			name:         "normal_with_start_end_without_matchers",
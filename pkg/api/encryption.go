@@ -0,0 +1,125 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/encryption"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+// decryptor returns the encryptor if the request is authorized to see the
+// decrypted values of the encrypted labels, nil otherwise.
+func decryptor(conf *Config, r *http.Request) *encryption.LabelEncryptor {
+	if conf.LabelEncryptor == nil || !conf.LabelEncryptor.Authorized(r) {
+		return nil
+	}
+	return conf.LabelEncryptor
+}
+
+func decryptQueryResult(conf *Config, r *http.Request, res *promql.Result) {
+	e := decryptor(conf, r)
+	if e == nil {
+		return
+	}
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		for i := range v {
+			v[i].Metric = e.DecryptLabels(v[i].Metric)
+		}
+	case promql.Matrix:
+		for i := range v {
+			v[i].Metric = e.DecryptLabels(v[i].Metric)
+		}
+	}
+}
+
+func decryptSeries(conf *Config, r *http.Request, series []labels.Labels) {
+	e := decryptor(conf, r)
+	if e == nil {
+		return
+	}
+	for i := range series {
+		series[i] = e.DecryptLabels(series[i])
+	}
+}
+
+// decryptLabelValues decrypts the values of an encrypted label, which are
+// then sorted again since they were sorted encrypted.
+func decryptLabelValues(conf *Config, r *http.Request, name string, values []string) {
+	e := decryptor(conf, r)
+	if e == nil || !e.IsEncrypted(name) {
+		return
+	}
+	for i := range values {
+		if value, err := e.Decrypt(name, values[i]); err == nil {
+			values[i] = value
+		}
+	}
+	sort.Strings(values)
+}
+
+func decryptReadResponse(conf *Config, r *http.Request, resp *prompb.ReadResponse) {
+	e := decryptor(conf, r)
+	if e == nil {
+		return
+	}
+	for _, res := range resp.Results {
+		for _, ts := range res.Timeseries {
+			decryptPromLabels(e, ts.Labels)
+		}
+	}
+}
+
+func decryptChunkedSeries(conf *Config, r *http.Request, series []*prompb.ChunkedSeries) {
+	e := decryptor(conf, r)
+	if e == nil {
+		return
+	}
+	for _, s := range series {
+		decryptPromLabels(e, s.Labels)
+	}
+}
+
+func decryptPromLabels(e *encryption.LabelEncryptor, lbls []prompb.Label) {
+	for i := range lbls {
+		if !e.IsEncrypted(lbls[i].Name) {
+			continue
+		}
+		if value, err := e.Decrypt(lbls[i].Name, lbls[i].Value); err == nil {
+			lbls[i].Value = value
+		}
+	}
+}
+
+// encryptSelector returns the selector with the values matched against the
+// encrypted labels encrypted, so that the series are matched the way they are
+// stored, and the plain text values are not recorded with purges.
+func encryptSelector(conf *Config, selector string, matchers []*labels.Matcher) (string, error) {
+	if conf.LabelEncryptor == nil {
+		return selector, nil
+	}
+	hasEncrypted := false
+	for _, m := range matchers {
+		hasEncrypted = hasEncrypted || conf.LabelEncryptor.IsEncrypted(m.Name)
+	}
+	if !hasEncrypted {
+		return selector, nil
+	}
+	encrypted, err := conf.LabelEncryptor.EncryptMatchers(matchers)
+	if err != nil {
+		return "", err
+	}
+	strs := make([]string, len(encrypted))
+	for i, m := range encrypted {
+		strs[i] = m.String()
+	}
+	return "{" + strings.Join(strs, ",") + "}", nil
+}
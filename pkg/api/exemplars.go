@@ -0,0 +1,136 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/prometheus/pkg/exemplar"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+// QueryExemplars returns an http.Handler serving the exemplars of the series
+// selected by the selectors of a PromQL query, like the Prometheus
+// /api/v1/query_exemplars endpoint.
+func QueryExemplars(conf *Config, queryable storage.ExemplarQueryable) http.Handler {
+	hf := corsWrapper(conf, queryExemplars(conf, queryable))
+	return gziphandler.GzipHandler(hf)
+}
+
+func queryExemplars(conf *Config, queryable storage.ExemplarQueryable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, err := parseTimeParam(r, "start", model.MinTime)
+		if err != nil {
+			log.Info("msg", "Exemplar query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		end, err := parseTimeParam(r, "end", model.MaxTime)
+		if err != nil {
+			log.Info("msg", "Exemplar query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if end.Before(start) {
+			err := fmt.Errorf("end timestamp must not be before start timestamp")
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		expr, err := parser.ParseExpr(r.FormValue("query"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		matcherSets, err := exemplarMatchers(conf, parser.ExtractSelectors(expr))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if len(matcherSets) == 0 {
+			respondExemplars(w, nil)
+			return
+		}
+
+		q, err := queryable.ExemplarQuerier(r.Context())
+		if err != nil {
+			respondError(w, http.StatusUnprocessableEntity, err, "execution")
+			return
+		}
+		res, err := q.Select(timestamp.FromTime(start), timestamp.FromTime(end), matcherSets...)
+		if err != nil {
+			log.Error("msg", "error querying exemplars", "err", err)
+			respondError(w, http.StatusUnprocessableEntity, err, "execution")
+			return
+		}
+		if e := decryptor(conf, r); e != nil {
+			for i := range res {
+				res[i].SeriesLabels = e.DecryptLabels(res[i].SeriesLabels)
+			}
+		}
+		respondExemplars(w, res)
+	}
+}
+
+// exemplarMatchers restricts the selectors to the series of the tenants the
+// request may read, and encrypts the values matched against encrypted labels
+// since the series are matched as they are stored.
+func exemplarMatchers(conf *Config, selectors [][]*labels.Matcher) ([][]*labels.Matcher, error) {
+	for i, matchers := range selectors {
+		if conf.MultiTenancy != nil {
+			if rAuth := conf.MultiTenancy.ReadAuthorizer(); rAuth != nil {
+				matchers = rAuth.AppendTenantMatcher(matchers)
+			}
+		}
+		if conf.LabelEncryptor != nil {
+			var err error
+			if matchers, err = conf.LabelEncryptor.EncryptMatchers(matchers); err != nil {
+				return nil, err
+			}
+		}
+		selectors[i] = matchers
+	}
+	return selectors, nil
+}
+
+// exemplarsResult is the JSON form of the exemplars of a series, the same as
+// the one of Prometheus: values are strings and timestamps are in seconds.
+type exemplarsResult struct {
+	SeriesLabels labels.Labels  `json:"seriesLabels"`
+	Exemplars    []exemplarJSON `json:"exemplars"`
+}
+
+type exemplarJSON struct {
+	Labels    labels.Labels `json:"labels"`
+	Value     string        `json:"value"`
+	Timestamp json.Number   `json:"timestamp"`
+}
+
+func respondExemplars(w http.ResponseWriter, res []exemplar.QueryResult) {
+	data := make([]exemplarsResult, len(res))
+	for i, r := range res {
+		data[i] = exemplarsResult{SeriesLabels: r.SeriesLabels, Exemplars: make([]exemplarJSON, len(r.Exemplars))}
+		for j, e := range r.Exemplars {
+			data[i].Exemplars[j] = exemplarJSON{
+				Labels:    e.Labels,
+				Value:     strconv.FormatFloat(e.Value, 'f', -1, 64),
+				Timestamp: json.Number(strconv.FormatFloat(float64(e.Ts)/1000, 'f', -1, 64)),
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&response{
+		Status: "success",
+		Data:   data,
+	})
+}
@@ -0,0 +1,68 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/exemplar"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type mockExemplarQueryable struct {
+	start, end  int64
+	matcherSets [][]*labels.Matcher
+	results     []exemplar.QueryResult
+}
+
+func (m *mockExemplarQueryable) ExemplarQuerier(context.Context) (storage.ExemplarQuerier, error) {
+	return m, nil
+}
+
+func (m *mockExemplarQueryable) Select(start, end int64, matcherSets ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	m.start, m.end, m.matcherSets = start, end, matcherSets
+	return m.results, nil
+}
+
+func TestQueryExemplars(t *testing.T) {
+	queryable := &mockExemplarQueryable{results: []exemplar.QueryResult{
+		{
+			SeriesLabels: labels.FromStrings("__name__", "latency_bucket", "le", "0.5"),
+			Exemplars: []exemplar.Exemplar{
+				{Labels: labels.FromStrings("trace_id", "a"), Value: 0.25, Ts: 1600096945479, HasTs: true},
+			},
+		},
+	}}
+	form := url.Values{"query": {`histogram_quantile(0.9, rate(latency_bucket[5m])) / rate(requests_total{job="api"}[5m])`}, "start": {"1600096900"}, "end": {"1600097000"}}
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query_exemplars?"+form.Encode(), nil)
+	w := httptest.NewRecorder()
+	queryExemplars(&Config{}, queryable).ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":[{"seriesLabels":{"__name__":"latency_bucket","le":"0.5"},`+
+		`"exemplars":[{"labels":{"trace_id":"a"},"value":"0.25","timestamp":1600096945.479}]}]}`, w.Body.String())
+	require.Equal(t, int64(1600096900000), queryable.start)
+	require.Equal(t, int64(1600097000000), queryable.end)
+	require.Len(t, queryable.matcherSets, 2, "each selector of the query is matched")
+
+	for name, form := range map[string]url.Values{
+		"no query":         {},
+		"invalid query":    {"query": {"rate(up"}},
+		"end before start": {"query": {"up"}, "start": {"10"}, "end": {"5"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/query_exemplars?"+form.Encode(), nil)
+			w := httptest.NewRecorder()
+			queryExemplars(&Config{}, queryable).ServeHTTP(w, r)
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+// explainQueryableFunc returns a queryable whose selects run their SQL
+// queries on connections wrapped by the recorder and record their pushdowns.
+type explainQueryableFunc func(*pgxconn.QueryRecorder) (promql.Queryable, *querier.ExplainingQuerier)
+
+type explainResponse struct {
+	Queries   []explainedQuery    `json:"queries"`
+	Pushdowns []explainedPushdown `json:"pushdowns"`
+}
+
+type explainedQuery struct {
+	SQL  string   `json:"sql"`
+	Args []string `json:"args"`
+	Plan string   `json:"plan,omitempty"`
+}
+
+type explainedPushdown struct {
+	Selector string `json:"selector"`
+	Node     string `json:"node"`
+}
+
+// Explain returns an http.Handler evaluating a PromQL query, instant or
+// over a range if start is set, and returning the SQL queries it ran and
+// the nodes pushed down into them instead of its results. With
+// analyze=true, the queries are run again with EXPLAIN (ANALYZE, BUFFERS)
+// and their plans are returned too.
+func Explain(conf *Config, queryEngine *promql.Engine, newQueryable explainQueryableFunc) http.Handler {
+	hf := corsWrapper(conf, explainHandler(conf, queryEngine, newQueryable))
+	return gziphandler.GzipHandler(hf)
+}
+
+func explainHandler(conf *Config, queryEngine *promql.Engine, newQueryable explainQueryableFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, fmt.Errorf("explaining queries requires admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+			return
+		}
+		analyze := false
+		if v := r.FormValue("analyze"); v != "" {
+			var err error
+			if analyze, err = strconv.ParseBool(v); err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Errorf("invalid analyze %q: %w", v, err), "bad_data")
+				return
+			}
+		}
+
+		recorder := pgxconn.NewQueryRecorder()
+		queryable, explaining := newQueryable(recorder)
+		qry, err := newExplainedQuery(r, queryEngine, queryable)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		defer qry.Close()
+
+		if res := qry.Exec(r.Context()); res.Err != nil {
+			log.Error("msg", res.Err, "endpoint", "explain")
+			respondError(w, http.StatusUnprocessableEntity, res.Err, "execution")
+			return
+		}
+
+		queries := recorder.Queries()
+		if analyze {
+			if queries, err = recorder.Explain(r.Context()); err != nil {
+				log.Error("msg", "error explaining the queries", "err", err)
+				respondError(w, http.StatusInternalServerError, err, "internal")
+				return
+			}
+		}
+
+		resp := explainResponse{Queries: []explainedQuery{}, Pushdowns: []explainedPushdown{}}
+		for _, q := range queries {
+			args := make([]string, len(q.Args))
+			for i, arg := range q.Args {
+				args[i] = fmt.Sprintf("%v", arg)
+			}
+			resp.Queries = append(resp.Queries, explainedQuery{SQL: q.SQL, Args: args, Plan: q.Plan})
+		}
+		for _, p := range explaining.Pushdowns() {
+			resp.Pushdowns = append(resp.Pushdowns, explainedPushdown{Selector: p.Selector, Node: p.Node})
+		}
+		respond(w, http.StatusOK, resp)
+	}
+}
+
+// newExplainedQuery returns the range query of the request if it has a
+// start, its instant query otherwise.
+func newExplainedQuery(r *http.Request, queryEngine *promql.Engine, queryable promql.Queryable) (promql.Query, error) {
+	qs := r.FormValue("query")
+	if r.FormValue("start") == "" {
+		ts, err := parseTimeParam(r, "time", time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return queryEngine.NewInstantQuery(queryable, qs, ts)
+	}
+
+	start, err := parseTime(r.FormValue("start"))
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeParam(r, "end", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end timestamp must not be before start time")
+	}
+	step, err := parseDuration(r.FormValue("step"))
+	if err != nil {
+		return nil, fmt.Errorf("param step: %w", err)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("zero or negative query resolution step widths are not accepted. Try a positive integer")
+	}
+	return queryEngine.NewRangeQuery(queryable, qs, start, end, step)
+}
@@ -0,0 +1,106 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/query"
+)
+
+// pushdownQuerier pushes down the parent of every selector.
+type pushdownQuerier struct {
+	mockQuerier
+}
+
+func (m pushdownQuerier) Select(_ context.Context, _ int64, _ int64, _ bool, _ *storage.SelectHints, _ *querier.QueryHints, path []parser.Node, _ ...*labels.Matcher) (querier.SeriesSet, parser.Node) {
+	if len(path) == 0 {
+		return &mockSeriesSet{}, nil
+	}
+	return &mockSeriesSet{}, path[len(path)-1]
+}
+
+func TestExplain(t *testing.T) {
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:     log.GetLogger(),
+		Reg:        prometheus.NewRegistry(),
+		MaxSamples: math.MaxInt32,
+		Timeout:    time.Minute,
+	})
+	newQueryable := func(recorder *pgxconn.QueryRecorder) (promql.Queryable, *querier.ExplainingQuerier) {
+		q := querier.NewExplainingQuerier(pushdownQuerier{}, recorder)
+		return query.NewQueryable(q, mockLabelsReader{}), q
+	}
+	testCases := []struct {
+		name       string
+		admin      bool
+		url        string
+		expectCode int
+		pushdowns  []explainedPushdown
+	}{
+		{
+			name:       "admin API disabled",
+			url:        "http://localhost:9090/explain?query=up",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "invalid query",
+			admin:      true,
+			url:        "http://localhost:9090/explain?query=up(",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid analyze",
+			admin:      true,
+			url:        "http://localhost:9090/explain?query=up&analyze=maybe",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "instant query",
+			admin:      true,
+			url:        "http://localhost:9090/explain?query=sum(up)&time=100",
+			expectCode: http.StatusOK,
+			pushdowns:  []explainedPushdown{{Selector: `{__name__="up"}`, Node: "sum(up)"}},
+		},
+		{
+			name:       "range query",
+			admin:      true,
+			url:        "http://localhost:9090/explain?query=rate(up[5m])&start=100&end=200&step=10",
+			expectCode: http.StatusOK,
+			pushdowns:  []explainedPushdown{{Selector: `{__name__="up"}`, Node: "up[5m]"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := explainHandler(&Config{AdminAPIEnabled: tc.admin}, engine, newQueryable)
+			w := doQuery(t, handler, tc.url, false)
+			require.Equal(t, tc.expectCode, w.Code, w.Body.String())
+			if tc.expectCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data explainResponse `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			require.Equal(t, []explainedQuery{}, resp.Data.Queries)
+			require.Equal(t, tc.pushdowns, resp.Data.Pushdowns)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgmodel/forecast"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+// Forecast returns an http.Handler extrapolating the series of a selector
+// past the end of their history. Each series is returned as three synthetic
+// series of the <metric>_forecast metric, with a band label of mean, lower
+// and upper.
+func Forecast(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, forecastHandler(conf, conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func forecastHandler(conf *Config, conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseForecastRequest(conf, r)
+		if err != nil {
+			log.Info("msg", "Forecast bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+
+		res, err := forecast.Query(conn, req)
+		switch err {
+		case nil:
+		case forecast.ErrNoMetricName:
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		case errors.ErrMissingTableName:
+			res = nil
+		default:
+			log.Error("msg", "error forecasting", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "internal")
+			return
+		}
+
+		result := &promql.Result{Value: forecastMatrix(res, req.Method)}
+		decryptQueryResult(conf, r, result)
+		respondQuery(w, result, nil)
+	}
+}
+
+func parseForecastRequest(conf *Config, r *http.Request) (forecast.Request, error) {
+	req := forecast.Request{Method: forecast.Linear, Confidence: 0.95, SmoothingFactor: 0.5, TrendFactor: 0.1}
+	if err := r.ParseForm(); err != nil {
+		return req, err
+	}
+	var err error
+	if req.Matchers, err = parseTailMatchers(conf, r); err != nil {
+		return req, err
+	}
+	if req.Start, err = parseTime(r.FormValue("start")); err != nil {
+		return req, fmt.Errorf("param start: %w", err)
+	}
+	if req.End, err = parseTimeParam(r, "end", time.Now()); err != nil {
+		return req, err
+	}
+	if !req.Start.Before(req.End) {
+		return req, fmt.Errorf("start timestamp must be before the end timestamp")
+	}
+	if req.Step, err = parseDuration(r.FormValue("step")); err != nil {
+		return req, fmt.Errorf("param step: %w", err)
+	}
+	if req.Horizon, err = parseDuration(r.FormValue("horizon")); err != nil {
+		return req, fmt.Errorf("param horizon: %w", err)
+	}
+	if req.Step <= 0 || req.Horizon <= 0 {
+		return req, fmt.Errorf("step and horizon must be positive")
+	}
+	if int64(req.Horizon/req.Step) > conf.MaxPointsPerTs {
+		return req, fmt.Errorf("exceeded maximum resolution of %d points per timeseries. Try increasing the step or "+
+			"the 'promql-max-points-per-ts' limit", conf.MaxPointsPerTs)
+	}
+	if m := r.FormValue("method"); m != "" {
+		if req.Method, err = forecast.ParseMethod(m); err != nil {
+			return req, err
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *float64
+	}{
+		{"confidence", &req.Confidence},
+		{"smoothing_factor", &req.SmoothingFactor},
+		{"trend_factor", &req.TrendFactor},
+	} {
+		s := r.FormValue(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 || v >= 1 {
+			return req, fmt.Errorf("param %s must be a number between 0 and 1, exclusive", p.name)
+		}
+		*p.value = v
+	}
+	return req, nil
+}
+
+// forecastMatrix returns the mean, lower and upper bands of each forecast
+// as series of the <metric>_forecast metric.
+func forecastMatrix(res []forecast.Series, method forecast.Method) promql.Matrix {
+	matrix := make(promql.Matrix, 0, 3*len(res))
+	for _, s := range res {
+		for _, band := range []struct {
+			name   string
+			values []float64
+		}{
+			{"mean", s.Means},
+			{"lower", s.Lowers},
+			{"upper", s.Uppers},
+		} {
+			b := labels.NewBuilder(s.Labels)
+			b.Set(labels.MetricName, s.Labels.Get(labels.MetricName)+"_forecast")
+			b.Set("band", band.name)
+			b.Set("method", string(method))
+			points := make([]promql.Point, len(s.Times))
+			for i := range s.Times {
+				points[i] = promql.Point{T: s.Times[i], V: band.values[i]}
+			}
+			matrix = append(matrix, promql.Series{Metric: b.Labels(), Points: points})
+		}
+	}
+	return matrix
+}
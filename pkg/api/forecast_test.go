@@ -0,0 +1,50 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecastHandlerBadRequests(t *testing.T) {
+	valid := func() url.Values {
+		return url.Values{"match[]": {`cpu{job="node"}`}, "start": {"0"}, "end": {"3600"}, "step": {"60"}, "horizon": {"3600"}}
+	}
+	testCases := []struct {
+		name  string
+		param string
+		value string
+	}{
+		{name: "no selector", param: "match[]"},
+		{name: "no start", param: "start"},
+		{name: "end before start", param: "end", value: "-60"},
+		{name: "no step", param: "step"},
+		{name: "negative horizon", param: "horizon", value: "-1h"},
+		{name: "too many points", param: "step", value: "0.001"},
+		{name: "unknown method", param: "method", value: "arima"},
+		{name: "confidence of 1", param: "confidence", value: "1"},
+		{name: "invalid smoothing factor", param: "smoothing_factor", value: "high"},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			form := valid()
+			if c.value == "" {
+				form.Del(c.param)
+			} else {
+				form.Set(c.param, c.value)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/forecast?"+form.Encode(), nil)
+			w := httptest.NewRecorder()
+			forecastHandler(&Config{MaxPointsPerTs: 11000}, nil).ServeHTTP(w, r)
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
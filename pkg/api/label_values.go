@@ -13,15 +13,21 @@ import (
 	"github.com/NYTimes/gziphandler"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
 	"github.com/timescale/promscale/pkg/promql"
 )
 
-func LabelValues(conf *Config, queryable promql.Queryable) http.Handler {
-	hf := corsWrapper(conf, labelValues(queryable))
+// LabelValues returns an http.Handler returning the values of a label. The
+// values are those of the series matching the match[] parameters in the time
+// range of the start and end parameters if they are set, looked up by
+// labelQuerier if it is set and selected from queryable otherwise.
+func LabelValues(conf *Config, queryable promql.Queryable, labelQuerier querier.LabelQuerier) http.Handler {
+	hf := corsWrapper(conf, labelValues(conf, queryable, labelQuerier))
 	return gziphandler.GzipHandler(hf)
 }
 
-func labelValues(queryable promql.Queryable) http.HandlerFunc {
+func labelValues(conf *Config, queryable promql.Queryable, labelQuerier querier.LabelQuerier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		name := route.Param(ctx, "name")
@@ -29,6 +35,28 @@ func labelValues(queryable promql.Queryable) http.HandlerFunc {
 			respondError(w, http.StatusBadRequest, fmt.Errorf("invalid label name: %s", name), "bad_data")
 			return
 		}
+		matcherSets, mint, maxt, err := labelsScope(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if len(matcherSets) > 0 {
+			var values labelsValue
+			var warnings storage.Warnings
+			if labelQuerier != nil {
+				values, err = labelQuerier.LabelValues(ctx, mint, maxt, name, matcherSets...)
+			} else {
+				values, warnings, err = selectLabels(ctx, queryable, mint, maxt, name, matcherSets)
+			}
+			if err != nil {
+				respondError(w, http.StatusUnprocessableEntity, err, "execution")
+				return
+			}
+			values = nonNilLabels(values)
+			decryptLabelValues(conf, r, name, values)
+			respondLabels(w, &promql.Result{Value: values}, warnings)
+			return
+		}
 		querier, err := queryable.Querier(context.Background(), math.MinInt64, math.MaxInt64)
 		if err != nil {
 			respondError(w, http.StatusInternalServerError, err, "internal")
@@ -40,6 +68,7 @@ func labelValues(queryable promql.Queryable) http.HandlerFunc {
 			respondError(w, http.StatusInternalServerError, err, "internal")
 			return
 		}
+		decryptLabelValues(conf, r, name, values)
 
 		respondLabels(w, &promql.Result{
 			Value: values,
@@ -7,13 +7,19 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"math"
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
 	"github.com/timescale/promscale/pkg/promql"
 )
 
@@ -27,13 +33,38 @@ func (l labelsValue) String() string {
 	return strings.Join(l, "\n")
 }
 
-func Labels(conf *Config, queryable promql.Queryable) http.Handler {
-	hf := corsWrapper(conf, labelsHandler(queryable))
+// Labels returns an http.Handler returning the label names. The names are
+// those of the series matching the match[] parameters in the time range of
+// the start and end parameters if they are set, looked up by labelQuerier if
+// it is set and selected from queryable otherwise.
+func Labels(conf *Config, queryable promql.Queryable, labelQuerier querier.LabelQuerier) http.Handler {
+	hf := corsWrapper(conf, labelsHandler(queryable, labelQuerier))
 	return gziphandler.GzipHandler(hf)
 }
 
-func labelsHandler(queryable promql.Queryable) http.HandlerFunc {
+func labelsHandler(queryable promql.Queryable, labelQuerier querier.LabelQuerier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		matcherSets, mint, maxt, err := labelsScope(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if len(matcherSets) > 0 {
+			var names labelsValue
+			var warnings storage.Warnings
+			if labelQuerier != nil {
+				names, err = labelQuerier.LabelNames(r.Context(), mint, maxt, matcherSets...)
+			} else {
+				names, warnings, err = selectLabels(r.Context(), queryable, mint, maxt, "", matcherSets)
+			}
+			if err != nil {
+				respondError(w, http.StatusUnprocessableEntity, err, "execution")
+				return
+			}
+			respondLabels(w, &promql.Result{Value: nonNilLabels(names)}, warnings)
+			return
+		}
+
 		querier, err := queryable.Querier(context.Background(), math.MinInt64, math.MaxInt64)
 		if err != nil {
 			respondError(w, http.StatusInternalServerError, err, "internal")
@@ -51,6 +82,78 @@ func labelsHandler(queryable promql.Queryable) http.HandlerFunc {
 	}
 }
 
+// labelsScope returns the matcher sets of the match[] parameters of a label
+// request, and the time range of its start and end parameters.
+func labelsScope(r *http.Request) ([][]*labels.Matcher, int64, int64, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, 0, 0, fmt.Errorf("error parsing form values: %w", err)
+	}
+	start, err := parseTimeParam(r, "start", model.MinTime)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	end, err := parseTimeParam(r, "end", model.MaxTime)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if end.Before(start) {
+		return nil, 0, 0, fmt.Errorf("end timestamp must not be before start time")
+	}
+	var matcherSets [][]*labels.Matcher
+	for _, s := range r.Form["match[]"] {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+	return matcherSets, timestamp.FromTime(start), timestamp.FromTime(end), nil
+}
+
+// selectLabels returns the sorted label names of the series of queryable
+// matching any of the matcher sets if name is empty, and the values of the
+// label name otherwise.
+func selectLabels(ctx context.Context, queryable promql.Queryable, mint, maxt int64, name string, matcherSets [][]*labels.Matcher) ([]string, storage.Warnings, error) {
+	q, err := queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer q.Close()
+	distinct := make(map[string]struct{})
+	var warnings storage.Warnings
+	for _, matchers := range matcherSets {
+		set, _ := q.Select(false, &storage.SelectHints{Start: mint, End: maxt, Func: "series"}, nil, nil, matchers...)
+		for set.Next() {
+			for _, l := range set.At().Labels() {
+				if name == "" {
+					distinct[l.Name] = struct{}{}
+				} else if l.Name == name {
+					distinct[l.Value] = struct{}{}
+				}
+			}
+		}
+		warnings = append(warnings, set.Warnings()...)
+		if set.Err() != nil {
+			return nil, warnings, set.Err()
+		}
+	}
+	res := make([]string, 0, len(distinct))
+	for s := range distinct {
+		res = append(res, s)
+	}
+	sort.Strings(res)
+	return res, warnings, nil
+}
+
+// nonNilLabels returns the labels, empty rather than nil so that they are
+// encoded as an empty list.
+func nonNilLabels(l labelsValue) labelsValue {
+	if l == nil {
+		return labelsValue{}
+	}
+	return l
+}
+
 func respondLabels(w http.ResponseWriter, res *promql.Result, warnings storage.Warnings) {
 	setResponseHeaders(w, res, warnings)
 	resp := &response{
@@ -11,9 +11,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/query"
 )
@@ -44,7 +48,7 @@ func TestLabels(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := labelsHandler(query.NewQueryable(nil, tc.labelsReader))
+			handler := labelsHandler(query.NewQueryable(nil, tc.labelsReader), nil)
 			w := doLabels(t, handler)
 
 			if w.Code != tc.expectCode {
@@ -91,3 +95,61 @@ func doLabels(t *testing.T, queryHandler http.Handler) *httptest.ResponseRecorde
 	queryHandler.ServeHTTP(w, req)
 	return w
 }
+
+type mockLabelQuerier struct {
+	mint, maxt  int64
+	name        string
+	matcherSets [][]*labels.Matcher
+	result      []string
+}
+
+func (m *mockLabelQuerier) LabelNames(_ context.Context, mint, maxt int64, matcherSets ...[]*labels.Matcher) ([]string, error) {
+	m.mint, m.maxt, m.matcherSets = mint, maxt, matcherSets
+	return m.result, nil
+}
+
+func (m *mockLabelQuerier) LabelValues(_ context.Context, mint, maxt int64, name string, matcherSets ...[]*labels.Matcher) ([]string, error) {
+	m.mint, m.maxt, m.name, m.matcherSets = mint, maxt, name, matcherSets
+	return m.result, nil
+}
+
+func TestLabelsMatch(t *testing.T) {
+	lq := &mockLabelQuerier{result: []string{"job"}}
+	// The label names of all the series are not read.
+	queryable := query.NewQueryable(&mockQuerier{}, &mockLabelsReader{labelNamesErr: fmt.Errorf("unexpected label names")})
+	form := url.Values{"match[]": {"up", `cpu{job="api"}`}, "start": {"1"}, "end": {"2"}}
+
+	w := httptest.NewRecorder()
+	labelsHandler(queryable, lq).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/labels?"+form.Encode(), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":["job"]}`, w.Body.String())
+	require.Equal(t, int64(1000), lq.mint)
+	require.Equal(t, int64(2000), lq.maxt)
+	require.Len(t, lq.matcherSets, 2)
+
+	r := httptest.NewRequest("GET", "/api/v1/label/job/values?"+form.Encode(), nil)
+	r = r.WithContext(route.WithParam(r.Context(), "name", "job"))
+	lq.result = nil
+	w = httptest.NewRecorder()
+	labelValues(&Config{}, queryable, lq).ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":[]}`, w.Body.String())
+	require.Equal(t, "job", lq.name)
+
+	// Without a label querier, the series are selected.
+	w = httptest.NewRecorder()
+	labelsHandler(queryable, nil).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/labels?"+form.Encode(), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":[]}`, w.Body.String())
+
+	for name, form := range map[string]url.Values{
+		"invalid matcher":  {"match[]": {"up{"}},
+		"end before start": {"match[]": {"up"}, "start": {"10"}, "end": {"5"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			labelsHandler(queryable, lq).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/labels?"+form.Encode(), nil))
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
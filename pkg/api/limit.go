@@ -0,0 +1,69 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+var errResultsTruncated = fmt.Errorf("results truncated due to limit")
+
+// limitQuery returns the context to evaluate the query with, the maximum
+// number of series of its result, 0 if unlimited, and whether the limit is
+// pushed down into the selects, which it is when the result series of the
+// query are the series of its selector. The selects fetch one series more
+// than the limit, for the truncation of the result to be noticed.
+func limitQuery(ctx context.Context, r *http.Request) (context.Context, int, bool, error) {
+	limit, err := parseLimitParam(r, "limit")
+	if err != nil || limit == 0 {
+		return ctx, 0, false, err
+	}
+	// A query that does not parse is reported by the engine.
+	expr, err := parser.ParseExpr(r.FormValue("query"))
+	if err != nil {
+		return ctx, limit, false, nil
+	}
+	for {
+		p, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.Expr
+	}
+	switch expr.(type) {
+	case *parser.VectorSelector, *parser.MatrixSelector:
+		return querier.WithSeriesLimit(ctx, limit+1), limit, true, nil
+	}
+	return ctx, limit, false, nil
+}
+
+// truncateResult truncates the series of the result to the limit, adding a
+// warning if any is dropped.
+func truncateResult(res *promql.Result, limit int) {
+	if limit == 0 {
+		return
+	}
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		if len(v) <= limit {
+			return
+		}
+		res.Value = v[:limit]
+	case promql.Matrix:
+		if len(v) <= limit {
+			return
+		}
+		res.Value = v[:limit]
+	default:
+		return
+	}
+	res.Warnings = append(res.Warnings, errResultsTruncated)
+}
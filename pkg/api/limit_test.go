@@ -0,0 +1,72 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+func TestLimitQuery(t *testing.T) {
+	testCases := []struct {
+		query, limit string
+		expected     int
+		pushedDown   bool
+		err          bool
+	}{
+		{query: "up", limit: "", expected: 0},
+		{query: "up", limit: "2", expected: 2, pushedDown: true},
+		{query: "(up[5m])", limit: "2", expected: 2, pushedDown: true},
+		{query: "sum(up)", limit: "2", expected: 2},
+		{query: "rate(up[5m])", limit: "2", expected: 2},
+		{query: "up{", limit: "2", expected: 2},
+		{query: "up", limit: "-1", err: true},
+		{query: "up", limit: "x", err: true},
+	}
+	for _, c := range testCases {
+		r := httptest.NewRequest("GET", "/api/v1/query?"+url.Values{"query": {c.query}, "limit": {c.limit}}.Encode(), nil)
+		_, limit, pushedDown, err := limitQuery(context.Background(), r)
+		if c.err {
+			require.Error(t, err, c.query)
+			continue
+		}
+		require.NoError(t, err, c.query)
+		require.Equal(t, c.expected, limit, c.query)
+		require.Equal(t, c.pushedDown, pushedDown, c.query)
+	}
+}
+
+func TestTruncateResult(t *testing.T) {
+	vector := promql.Vector{
+		{Metric: labels.FromStrings("job", "a")},
+		{Metric: labels.FromStrings("job", "b")},
+	}
+	res := &promql.Result{Value: vector}
+	truncateResult(res, 0)
+	require.Equal(t, vector, res.Value)
+
+	truncateResult(res, 2)
+	require.Equal(t, vector, res.Value)
+	require.Empty(t, res.Warnings)
+
+	truncateResult(res, 1)
+	require.Equal(t, vector[:1], res.Value)
+	require.Equal(t, []error{errResultsTruncated}, []error(res.Warnings))
+
+	res = &promql.Result{Value: promql.Matrix{{Metric: labels.FromStrings("job", "a")}, {Metric: labels.FromStrings("job", "b")}}}
+	truncateResult(res, 1)
+	require.Len(t, res.Value, 1)
+	require.Len(t, res.Warnings, 1)
+
+	res = &promql.Result{Value: promql.Scalar{V: 1}}
+	truncateResult(res, 1)
+	require.Equal(t, promql.Scalar{V: 1}, res.Value)
+}
@@ -186,7 +186,7 @@ func (self *errorWrapper) writeJsonFloat(f float64) int {
 	return len(b)
 }
 
-var hex = "0123456789abcdef"
+var hexDigits = "0123456789abcdef"
 
 func (self *errorWrapper) WriteEscapedString(s string, escapeHTML bool) {
 	if self.err != nil {
@@ -222,7 +222,7 @@ func (self *errorWrapper) WriteEscapedString(s string, escapeHTML bool) {
 				// user-controlled strings are rendered into JSON
 				// and served to some browsers.
 				self.WriteStrings(`\u00`)
-				self.WriteBytes(hex[b>>4], hex[b&0xF])
+				self.WriteBytes(hexDigits[b>>4], hexDigits[b&0xF])
 			}
 			i++
 			start = i
@@ -250,7 +250,7 @@ func (self *errorWrapper) WriteEscapedString(s string, escapeHTML bool) {
 				self.WriteStrings(s[start:i])
 			}
 			self.WriteStrings(`\u202`)
-			self.WriteBytes(hex[c&0xF])
+			self.WriteBytes(hexDigits[c&0xF])
 			i += size
 			start = i
 			continue
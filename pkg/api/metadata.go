@@ -5,44 +5,139 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/NYTimes/gziphandler"
-	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/timescale/promscale/pkg/pgmodel/metadata"
+	"github.com/timescale/promscale/pkg/pgxconn"
 )
 
-func MetricMetadata(conf *Config, client *pgclient.Client) http.Handler {
-	hf := corsWrapper(conf, metricMetadataHandler(client))
+// MetricMetadata returns an http.Handler returning the metadata of the
+// metric families sent with the written samples, in the format of the
+// Prometheus metadata endpoint.
+func MetricMetadata(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, metricMetadataHandler(conn))
 	return gziphandler.GzipHandler(hf)
 }
 
-func metricMetadataHandler(client *pgclient.Client) http.HandlerFunc {
+func metricMetadataHandler(conn pgxconn.PgxConn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
 			respondError(w, http.StatusBadRequest, err, "bad_data")
 			return
 		}
-		var (
-			limit int64
-			err   error
+		limit, err := parseLimitParam(r, "limit")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		limitPerMetric, err := parseLimitParam(r, "limit_per_metric")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		data, err := metadata.MetricQuery(conn, r.FormValue("metric"), limit)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "fetching metric metadata")
+			return
+		}
+		if limitPerMetric > 0 {
+			for family, entries := range data {
+				if len(entries) > limitPerMetric {
+					data[family] = entries[:limitPerMetric]
+				}
+			}
+		}
+		respondMetadata(w, data)
+	}
+}
+
+type targetMetadata struct {
+	Target labels.Labels `json:"target"`
+	Metric string        `json:"metric"`
+	Type   string        `json:"type"`
+	Help   string        `json:"help"`
+	Unit   string        `json:"unit"`
+}
+
+// TargetMetadata returns an http.Handler returning the metadata of the metric
+// families in the format of the Prometheus targets metadata endpoint, so that
+// the clients of that endpoint display the types and descriptions of the
+// metrics. The metadata sent with remote write does not identify the targets
+// exposing the metrics, so each family is returned once, with the most recent
+// metadata and an empty target, which the match_target selector is matched
+// against.
+func TargetMetadata(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, targetMetadataHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
 
-			metric   = r.FormValue("metric")
-			limitStr = r.FormValue("limit")
-		)
-		if limitStr != "" {
-			limit, err = strconv.ParseInt(limitStr, 10, 32)
+func targetMetadataHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		limit, err := parseLimitParam(r, "limit")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		res := []targetMetadata{}
+		if s := r.FormValue("match_target"); s != "" {
+			matchers, err := parser.ParseMetricSelector(s)
 			if err != nil {
-				respondError(w, http.StatusBadRequest, err, "converting string to integer")
+				respondError(w, http.StatusBadRequest, err, "bad_data")
 				return
 			}
+			for _, m := range matchers {
+				if !m.Matches("") {
+					respondMetadata(w, res)
+					return
+				}
+			}
 		}
-		data, err := metadata.MetricQuery(client.Connection, metric, int(limit))
+		data, err := metadata.MetricQuery(conn, r.FormValue("metric"), limit)
 		if err != nil {
 			respondError(w, http.StatusInternalServerError, err, "fetching metric metadata")
 			return
 		}
-		respond(w, http.StatusOK, data)
+		for family, entries := range data {
+			m := entries[0]
+			res = append(res, targetMetadata{Target: labels.Labels{}, Metric: family, Type: m.Type, Help: m.Help, Unit: m.Unit})
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return res[i].Metric < res[j].Metric
+		})
+		respondMetadata(w, res)
 	}
 }
+
+// parseLimitParam returns the non-negative limit of the parameter, 0 if it is
+// not set.
+func parseLimitParam(r *http.Request, name string) (int, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid %s %q, must be a non-negative integer", name, s)
+	}
+	return int(limit), nil
+}
+
+func respondMetadata(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(&response{
+		Status: "success",
+		Data:   data,
+	})
+}
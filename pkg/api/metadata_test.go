@@ -0,0 +1,65 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+const allMetadataSQL = "SELECT metric_family, type, unit, help from " + schema.Catalog + ".metadata ORDER BY metric_family, last_seen DESC"
+
+var metadataRows = model.RowResults{
+	{"http_request_duration_seconds", "histogram", "seconds", "Duration of the requests."},
+	{"up", "gauge", "", "Whether the target is up."},
+	{"up", "gauge", "", "1 if the target is up."},
+}
+
+func TestMetricMetadata(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: allMetadataSQL, Results: metadataRows},
+		{Sql: "SELECT * from " + schema.Prom + ".get_metric_metadata($1)", Args: []interface{}{"up"}, Results: metadataRows[1:]},
+	}, t)
+
+	w := httptest.NewRecorder()
+	metricMetadataHandler(mock).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/metadata", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":{`+
+		`"http_request_duration_seconds":[{"type":"histogram","unit":"seconds","help":"Duration of the requests."}],`+
+		`"up":[{"type":"gauge","unit":"","help":"Whether the target is up."},{"type":"gauge","unit":"","help":"1 if the target is up."}]}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	metricMetadataHandler(mock).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/metadata?metric=up&limit_per_metric=1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":{"up":[{"type":"gauge","unit":"","help":"Whether the target is up."}]}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	metricMetadataHandler(mock).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/metadata?limit=-1", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTargetMetadata(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: allMetadataSQL, Results: metadataRows},
+	}, t)
+
+	w := httptest.NewRecorder()
+	targetMetadataHandler(mock).ServeHTTP(w, httptest.NewRequest("GET", `/api/v1/targets/metadata?match_target={job=~".*"}`, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":[`+
+		`{"target":{},"metric":"http_request_duration_seconds","type":"histogram","help":"Duration of the requests.","unit":"seconds"},`+
+		`{"target":{},"metric":"up","type":"gauge","help":"Whether the target is up.","unit":""}]}`, w.Body.String())
+
+	// No target has a job, and the metadata is not queried.
+	w = httptest.NewRecorder()
+	targetMetadataHandler(mock).ServeHTTP(w, httptest.NewRequest("GET", `/api/v1/targets/metadata?match_target={job="api"}`, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":[]}`, w.Body.String())
+}
@@ -0,0 +1,34 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/metadata"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// MetricStorage returns an http.Handler listing the metrics along with how
+// they are stored: their table, retention, compression, chunk interval and
+// series count, and the functions usually used to aggregate them.
+func MetricStorage(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, metricStorageHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func metricStorageHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := metadata.MetricStorageQuery(conn)
+		if err != nil {
+			log.Error("msg", "error fetching the metric storage", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "fetching metric storage")
+			return
+		}
+		respond(w, http.StatusOK, data)
+	}
+}
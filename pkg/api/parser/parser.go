@@ -62,11 +62,15 @@ func (d DefaultParser) ParseRequest(r *http.Request, req *prompb.WriteRequest) e
 		return fmt.Errorf("parser error: %w", err)
 	}
 
+	return d.Preprocess(r, req)
+}
+
+// Preprocess runs the preprocessors on the payload of the request.
+func (d DefaultParser) Preprocess(r *http.Request, req *prompb.WriteRequest) error {
 	if len(req.Timeseries) == 0 {
 		return nil
 	}
 
-	// run preprocessors
 	for _, p := range d.preprocessors {
 		err := p.Process(r, req)
 
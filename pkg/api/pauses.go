@@ -0,0 +1,98 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/timescale/promscale/pkg/pause"
+)
+
+type pauseResponse struct {
+	Tenant string     `json:"tenant,omitempty"`
+	Metric string     `json:"metric,omitempty"`
+	Mode   pause.Mode `json:"mode"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// IngestPauses returns an http.Handler listing the pauses of the ingestion
+// on GET, pausing the ingestion of the tenant or metric of the tenant or
+// metric parameter on POST, for the duration of the duration parameter if
+// set, and resuming it on DELETE.
+func IngestPauses(conf *Config) http.Handler {
+	return corsWrapper(conf, ingestPausesHandler(conf))
+}
+
+func ingestPausesHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, fmt.Errorf("pausing the ingestion requires admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+			return
+		}
+		if conf.IngestPauses == nil {
+			respondError(w, http.StatusNotFound, fmt.Errorf("the ingestion cannot be paused on a read-only connector"), "unavailable")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodDelete:
+			if err := r.ParseForm(); err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			if !conf.IngestPauses.Resume(r.FormValue("tenant"), r.FormValue("metric")) {
+				respondError(w, http.StatusNotFound, fmt.Errorf("the ingestion is not paused"), "not_found")
+				return
+			}
+		default:
+			if err := r.ParseForm(); err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			p, err := parsePause(r)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			if err = conf.IngestPauses.Pause(p); err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+		}
+
+		pauses := conf.IngestPauses.List()
+		res := make([]pauseResponse, len(pauses))
+		for i, p := range pauses {
+			res[i] = pauseResponse{Tenant: p.Tenant, Metric: p.Metric, Mode: p.Mode}
+			if !p.Until.IsZero() {
+				until := p.Until.UTC()
+				res[i].Until = &until
+			}
+		}
+		respond(w, http.StatusOK, res)
+	}
+}
+
+func parsePause(r *http.Request) (p pause.Pause, err error) {
+	p.Tenant, p.Metric = r.FormValue("tenant"), r.FormValue("metric")
+	if s := r.FormValue("mode"); s != "" {
+		if p.Mode, err = pause.ParseMode(s); err != nil {
+			return p, err
+		}
+	}
+	if s := r.FormValue("duration"); s != "" {
+		d, err := parseDuration(s)
+		if err != nil {
+			return p, fmt.Errorf("invalid duration: %w", err)
+		}
+		if d <= 0 {
+			return p, fmt.Errorf("invalid duration %s, must be positive", s)
+		}
+		p.Until = time.Now().Add(d)
+	}
+	return p, nil
+}
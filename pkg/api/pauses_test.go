@@ -0,0 +1,67 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pause"
+)
+
+func TestIngestPauses(t *testing.T) {
+	conf := &Config{AdminAPIEnabled: true, IngestPauses: pause.New(pause.ModeReject)}
+	do := func(method string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/admin/ingest/pauses?"+form.Encode(), nil)
+		w := httptest.NewRecorder()
+		ingestPausesHandler(conf).ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, url.Values{"tenant": {"a"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodPost, url.Values{"metric": {"up"}, "mode": {"drop"}, "duration": {"1h"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `{"tenant":"a","mode":"reject"}`)
+	require.Contains(t, w.Body.String(), `{"metric":"up","mode":"drop","until":"`)
+
+	w = do(http.MethodDelete, url.Values{"tenant": {"a"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), `"tenant":"a"`)
+	require.Equal(t, http.StatusNotFound, do(http.MethodDelete, url.Values{"tenant": {"a"}}).Code)
+	require.Len(t, conf.IngestPauses.List(), 1)
+
+	for name, form := range map[string]url.Values{
+		"tenant and metric": {"tenant": {"a"}, "metric": {"up"}},
+		"none":              {},
+		"invalid mode":      {"tenant": {"a"}, "mode": {"slow"}},
+		"invalid duration":  {"tenant": {"a"}, "duration": {"-1h"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, http.StatusBadRequest, do(http.MethodPost, form).Code)
+		})
+	}
+
+	conf.AdminAPIEnabled = false
+	require.Equal(t, http.StatusForbidden, do(http.MethodGet, nil).Code)
+}
+
+func TestParseErrorPaused(t *testing.T) {
+	metrics = &Metrics{InvalidWriteReqs: prometheus.NewCounter(prometheus.CounterOpts{Name: "invalid"})}
+	w := httptest.NewRecorder()
+	parseError(w, fmt.Errorf("%w for tenant a", pause.ErrPaused), metrics)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.True(t, strings.HasPrefix(w.Body.String(), "ingestion paused for tenant a"))
+
+	w = httptest.NewRecorder()
+	parseError(w, fmt.Errorf("invalid"), metrics)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,186 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/timescale/promscale/pkg/log"
+	deletePkg "github.com/timescale/promscale/pkg/pgmodel/delete"
+)
+
+type purgeResponse struct {
+	ID            int64                  `json:"id"`
+	Selectors     []string               `json:"selectors"`
+	Reason        string                 `json:"reason"`
+	RequestedBy   string                 `json:"requestedBy"`
+	Status        string                 `json:"status"`
+	RequestedAt   time.Time              `json:"requestedAt"`
+	StartedAt     *time.Time             `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time             `json:"finishedAt,omitempty"`
+	SeriesDeleted int64                  `json:"seriesDeleted"`
+	RowsDeleted   int64                  `json:"rowsDeleted"`
+	Error         string                 `json:"error,omitempty"`
+	Metrics       []purgedMetricResponse `json:"metrics,omitempty"`
+}
+
+type purgedMetricResponse struct {
+	Name          string    `json:"name"`
+	SeriesDeleted int64     `json:"seriesDeleted"`
+	RowsDeleted   int64     `json:"rowsDeleted"`
+	PurgedAt      time.Time `json:"purgedAt"`
+}
+
+func newPurgeResponse(p deletePkg.Purge) purgeResponse {
+	res := purgeResponse{
+		ID:            p.ID,
+		Selectors:     p.Selectors,
+		Reason:        p.Reason,
+		RequestedBy:   p.RequestedBy,
+		Status:        p.Status,
+		RequestedAt:   p.RequestedAt,
+		StartedAt:     p.StartedAt,
+		FinishedAt:    p.FinishedAt,
+		SeriesDeleted: p.SeriesDeleted,
+		RowsDeleted:   p.RowsDeleted,
+		Error:         p.Error,
+	}
+	for _, m := range p.Metrics {
+		res.Metrics = append(res.Metrics, purgedMetricResponse(m))
+	}
+	return res
+}
+
+// Purges returns an http.Handler listing the purges of series and requesting
+// new ones.
+func Purges(conf *Config) http.Handler {
+	hf := corsWrapper(conf, purgesHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func purgesHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkPurgeAdmin(w, r, conf) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			purges, err := conf.Purger.List()
+			if err != nil {
+				respondPurgeError(w, err)
+				return
+			}
+			res := make([]purgeResponse, 0, len(purges))
+			for _, p := range purges {
+				res = append(res, newPurgeResponse(p))
+			}
+			respond(w, http.StatusOK, res)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if len(r.Form["match[]"]) == 0 {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("no match[] parameter provided"), "bad_data")
+			return
+		}
+		selectors := make([]string, 0, len(r.Form["match[]"]))
+		for _, s := range r.Form["match[]"] {
+			matchers, err := parser.ParseMetricSelector(s)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			if s, err = encryptSelector(conf, s, matchers); err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			selectors = append(selectors, s)
+		}
+		reason := r.FormValue("reason")
+		if reason == "" {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("no reason parameter provided, it is required for the audit trail"), "bad_data")
+			return
+		}
+
+		purge, err := conf.Purger.Request(selectors, reason, requestedBy(r))
+		if err != nil {
+			respondPurgeError(w, err)
+			return
+		}
+		log.Info("msg", "purge requested", "purge-id", purge.ID, "selectors", fmt.Sprintf("%v", selectors), "requested-by", purge.RequestedBy)
+		respond(w, http.StatusAccepted, newPurgeResponse(purge))
+	}
+}
+
+// PurgeStatus returns an http.Handler reporting a purge of series along with
+// what it deleted from every metric.
+func PurgeStatus(conf *Config) http.Handler {
+	hf := corsWrapper(conf, purgeStatusHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func purgeStatusHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkPurgeAdmin(w, r, conf) {
+			return
+		}
+		id, err := strconv.ParseInt(route.Param(r.Context(), "id"), 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("invalid purge id: %w", err), "bad_data")
+			return
+		}
+		purge, err := conf.Purger.Get(id)
+		if err != nil {
+			respondPurgeError(w, err)
+			return
+		}
+		respond(w, http.StatusOK, newPurgeResponse(purge))
+	}
+}
+
+// checkPurgeAdmin responds with an error if the purges cannot be managed.
+// Reporting the purges is allowed in read-only mode.
+func checkPurgeAdmin(w http.ResponseWriter, r *http.Request, conf *Config) bool {
+	if !conf.AdminAPIEnabled {
+		respondError(w, http.StatusForbidden, fmt.Errorf("purging series requires admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+		return false
+	}
+	if conf.ReadOnly && r.Method != http.MethodGet {
+		respondError(w, http.StatusForbidden, fmt.Errorf("read-only connector cannot purge series"), "operation_not_permitted")
+		return false
+	}
+	if conf.Purger == nil {
+		respondError(w, http.StatusServiceUnavailable, fmt.Errorf("purges are not available"), "unavailable")
+		return false
+	}
+	return true
+}
+
+// requestedBy identifies who requested a purge in the audit trail: the basic
+// auth user if there is one, the address of the client otherwise.
+func requestedBy(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return r.RemoteAddr
+}
+
+func respondPurgeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, deletePkg.ErrPurgeNotFound) {
+		respondError(w, http.StatusNotFound, err, "not_found")
+		return
+	}
+	log.Error("msg", "error managing purges", "err", err)
+	respondError(w, http.StatusInternalServerError, err, "internal")
+}
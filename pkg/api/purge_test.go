@@ -0,0 +1,86 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	deletePkg "github.com/timescale/promscale/pkg/pgmodel/delete"
+)
+
+func TestPurgesHandlerBadRequests(t *testing.T) {
+	testCases := []struct {
+		name   string
+		conf   *Config
+		method string
+		form   url.Values
+		code   int
+	}{
+		{
+			name:   "admin API disabled",
+			conf:   &Config{Purger: deletePkg.NewPurger(nil)},
+			method: http.MethodGet,
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "read-only",
+			conf:   &Config{Purger: deletePkg.NewPurger(nil), AdminAPIEnabled: true, ReadOnly: true},
+			method: http.MethodPost,
+			form:   url.Values{"match[]": {`{user_id="123"}`}, "reason": {"erasure request"}},
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "no purger",
+			conf:   &Config{AdminAPIEnabled: true},
+			method: http.MethodGet,
+			code:   http.StatusServiceUnavailable,
+		},
+		{
+			name:   "no selector",
+			conf:   &Config{Purger: deletePkg.NewPurger(nil), AdminAPIEnabled: true},
+			method: http.MethodPost,
+			form:   url.Values{"reason": {"erasure request"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "invalid selector",
+			conf:   &Config{Purger: deletePkg.NewPurger(nil), AdminAPIEnabled: true},
+			method: http.MethodPost,
+			form:   url.Values{"match[]": {`{user_id=}`}, "reason": {"erasure request"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "no reason",
+			conf:   &Config{Purger: deletePkg.NewPurger(nil), AdminAPIEnabled: true},
+			method: http.MethodPost,
+			form:   url.Values{"match[]": {`{user_id="123"}`}},
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(c.method, "/api/v1/admin/purges", strings.NewReader(c.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			purgesHandler(c.conf).ServeHTTP(w, r)
+			require.Equal(t, c.code, w.Code)
+		})
+	}
+}
+
+func TestRequestedBy(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/purges", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	require.Equal(t, "10.0.0.1:1234", requestedBy(r))
+
+	r.SetBasicAuth("admin", "secret")
+	require.Equal(t, "admin", requestedBy(r))
+}
@@ -0,0 +1,267 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/api/parser"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgmodel/pushgroup"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+const (
+	// pushLabelsParam is the route parameter holding the grouping labels of
+	// a push, "job/<job>{/<label>/<value>}".
+	pushLabelsParam = "labels"
+
+	// base64Suffix marks the label values of the push path that are encoded
+	// with URL-safe base64, for values containing slashes, as the
+	// Pushgateway does.
+	base64Suffix = "@base64"
+
+	openMetricsContentType = "application/openmetrics-text"
+)
+
+// pushTimeMetric is the metric recording the time of the last push of each
+// group, as the Pushgateway does.
+const pushTimeMetric = "push_time_seconds"
+
+// pushNow returns the time of a push.
+var pushNow = time.Now
+
+// Push returns an http.Handler implementing the push API of the Pushgateway
+// on /metrics/job/<job>{/<label>/<value>}, so that batch jobs can push their
+// metrics in the Prometheus or OpenMetrics text format straight to the
+// database. The labels of the path are the grouping labels of the pushed
+// metrics, and are added to every pushed series. The pushed samples are
+// ingested, those without a timestamp at the time of the push, and the
+// latest value of each series is kept as the current value of the group:
+// PUT replaces all the values of the group, POST those of the pushed metrics
+// and DELETE deletes the group.
+func Push(inserter ingestor.DBInserter, conn pgxconn.PgxConn, dataParser *parser.DefaultParser, signingKeys map[string][]byte, maxSkew time.Duration) http.Handler {
+	wh := writeHandler{}
+	wh.addStages(
+		validatePushHeaders,
+		verifySignature(signingKeys, newReplayGuard(maxSkew)),
+		decodeSnappy,
+		pushToGroup(inserter, conn, dataParser),
+	)
+	return wh.handler()
+}
+
+// validatePushHeaders accepts the same requests as the Pushgateway: anything
+// that is not OpenMetrics is parsed as the Prometheus text format, since
+// tools like curl set a form content type by default.
+func validatePushHeaders(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		validateError(w, fmt.Sprintf("HTTP Method %s instead of POST, PUT or DELETE", r.Method), metrics)
+		return false
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && !strings.Contains(encoding, "snappy") {
+		validateError(w, fmt.Sprintf("unsupported Content-Encoding %s", r.Header.Get("Content-Encoding")), metrics)
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case err == nil && mediaType == openMetricsContentType:
+	case err == nil && strings.HasPrefix(mediaType, "application/vnd.google.protobuf"):
+		validateError(w, "unsupported protobuf data format, push the text format instead", metrics)
+		return false
+	default:
+		r.Header.Set("Content-Type", "text/plain")
+	}
+	return true
+}
+
+func pushToGroup(inserter ingestor.DBInserter, conn pgxconn.PgxConn, dataParser *parser.DefaultParser) writeStage {
+	formatParser := parser.NewParser()
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		groupingLabels, err := parsePushPath(route.Param(r.Context(), pushLabelsParam))
+		if err != nil {
+			invalidRequestError(w, "push path error", err.Error(), metrics)
+			return false
+		}
+
+		req := ingestor.NewWriteRequest()
+		if r.Method != http.MethodDelete {
+			if err = formatParser.ParseRequest(r, req); err != nil {
+				ingestor.FinishWriteRequest(req)
+				invalidRequestError(w, "parser error", err.Error(), metrics)
+				return false
+			}
+		}
+		if err = addGroupingLabels(req, groupingLabels, pushNow()); err != nil {
+			ingestor.FinishWriteRequest(req)
+			invalidRequestError(w, "parser error", err.Error(), metrics)
+			return false
+		}
+		// The preprocessors run once the grouping labels are set, so that
+		// the group is identified by the labels of its stored series, e.g.
+		// with the tenant they are stored under.
+		if err = dataParser.Preprocess(r, req); err != nil {
+			ingestor.FinishWriteRequest(req)
+			parseError(w, err, metrics)
+			return false
+		}
+		group := pushGroupLabels(req)
+		if group == nil {
+			// The preprocessors dropped the push.
+			ingestor.FinishWriteRequest(req)
+			return true
+		}
+
+		if r.Method == http.MethodDelete {
+			ingestor.FinishWriteRequest(req)
+			if _, err = pushgroup.Delete(conn, group); err != nil {
+				log.Warn("msg", "Error deleting push group", "err", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return false
+			}
+			return true
+		}
+
+		// The request is recycled once it is ingested.
+		latest := latestPushedValues(req)
+		if !insertRequest(w, r, inserter, req) {
+			return false
+		}
+		if err = pushgroup.Replace(conn, group, r.Method == http.MethodPut, latest); err != nil {
+			log.Warn("msg", "Error recording the latest values of push group", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		return true
+	}
+}
+
+// addGroupingLabels sets the grouping labels on the pushed series, and adds
+// the series recording the time of the push to the group.
+func addGroupingLabels(req *prompb.WriteRequest, groupingLabels []prompb.Label, now time.Time) error {
+	for i := range req.Timeseries {
+		for _, l := range req.Timeseries[i].Labels {
+			if l.Name == model.MetricNameLabel && l.Value == pushTimeMetric {
+				return fmt.Errorf("pushed metrics must not contain %s, it is set on push", pushTimeMetric)
+			}
+		}
+		req.Timeseries[i].Labels = setLabels(req.Timeseries[i].Labels, groupingLabels)
+	}
+
+	pushTime := prompb.TimeSeries{
+		Labels:  setLabels([]prompb.Label{{Name: model.MetricNameLabel, Value: pushTimeMetric}}, groupingLabels),
+		Samples: []prompb.Sample{{Timestamp: timestamp.FromTime(now), Value: float64(now.UnixNano()) / 1e9}},
+	}
+	req.Timeseries = append(req.Timeseries, pushTime)
+	return nil
+}
+
+// pushGroupLabels returns the labels identifying the group of the pushed
+// series, those of the series recording the time of the push besides its
+// name, or nil if the series was dropped.
+func pushGroupLabels(req *prompb.WriteRequest) map[string]string {
+	for _, ts := range req.Timeseries {
+		var (
+			group  = make(map[string]string, len(ts.Labels))
+			isPush bool
+		)
+		for _, l := range ts.Labels {
+			if l.Name == model.MetricNameLabel {
+				isPush = l.Value == pushTimeMetric
+				continue
+			}
+			group[l.Name] = l.Value
+		}
+		if isPush {
+			return group
+		}
+	}
+	return nil
+}
+
+// latestPushedValues returns the latest value of each of the pushed series.
+func latestPushedValues(req *prompb.WriteRequest) []pushgroup.Metric {
+	series := make([]pushgroup.Metric, 0, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		if len(ts.Samples) == 0 {
+			continue
+		}
+		lbls := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			lbls[l.Name] = l.Value
+		}
+		last := ts.Samples[len(ts.Samples)-1]
+		series = append(series, pushgroup.Metric{Labels: lbls, Timestamp: last.Timestamp, Value: last.Value})
+	}
+	return pushgroup.Latest(series)
+}
+
+// parsePushPath returns the grouping labels of the path of a push,
+// "job/<job>{/<label>/<value>}".
+func parsePushPath(path string) ([]prompb.Label, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts)%2 != 0 || strings.TrimSuffix(parts[0], base64Suffix) != model.JobLabel {
+		return nil, fmt.Errorf("push path must be /metrics/job/<job>{/<label>/<value>}")
+	}
+
+	groupingLabels := make([]prompb.Label, 0, len(parts)/2)
+	for i := 0; i < len(parts); i += 2 {
+		name, value := parts[i], parts[i+1]
+		if strings.HasSuffix(name, base64Suffix) {
+			name = strings.TrimSuffix(name, base64Suffix)
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value of label %s: %w", name, err)
+			}
+			value = string(decoded)
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid label name %q in push path", name)
+		}
+		if name == model.JobLabel && value == "" {
+			return nil, fmt.Errorf("job name must not be empty")
+		}
+		groupingLabels = append(groupingLabels, prompb.Label{Name: name, Value: value})
+	}
+	return groupingLabels, nil
+}
+
+// setLabels sets the labels on the series, replacing the values of the
+// labels it already has. Labels set to an empty value are removed, since an
+// empty label is the same as a missing one.
+func setLabels(lbls []prompb.Label, set []prompb.Label) []prompb.Label {
+	for _, s := range set {
+		found := false
+		for i := range lbls {
+			if lbls[i].Name != s.Name {
+				continue
+			}
+			found = true
+			if s.Value == "" {
+				lbls = append(lbls[:i], lbls[i+1:]...)
+			} else {
+				lbls[i].Value = s.Value
+			}
+			break
+		}
+		if !found && s.Value != "" {
+			lbls = append(lbls, s)
+		}
+	}
+	return lbls
+}
@@ -0,0 +1,34 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/pushgroup"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// PushGroups returns an http.Handler listing the groups of metrics pushed by
+// batch jobs with the latest values of their series, like the metrics API of
+// the Pushgateway.
+func PushGroups(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, pushGroupsHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func pushGroupsHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := pushgroup.Query(conn)
+		if err != nil {
+			log.Error("msg", "error fetching the push groups", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "fetching push groups")
+			return
+		}
+		respond(w, http.StatusOK, data)
+	}
+}
@@ -0,0 +1,220 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/api/parser"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestParsePushPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		expected []prompb.Label
+		err      bool
+	}{
+		{
+			name:     "job only",
+			path:     "/job/backup",
+			expected: []prompb.Label{{Name: "job", Value: "backup"}},
+		},
+		{
+			name:     "grouping labels",
+			path:     "/job/backup/instance/db1/",
+			expected: []prompb.Label{{Name: "job", Value: "backup"}, {Name: "instance", Value: "db1"}},
+		},
+		{
+			name:     "base64 values",
+			path:     "/job@base64/YmFja3VwL2RhaWx5/path@base64/L3Zhci90bXA=/empty@base64/=",
+			expected: []prompb.Label{{Name: "job", Value: "backup/daily"}, {Name: "path", Value: "/var/tmp"}, {Name: "empty", Value: ""}},
+		},
+		{name: "missing job", path: "/instance/db1", err: true},
+		{name: "label without value", path: "/job/backup/instance", err: true},
+		{name: "empty job", path: "/job@base64/=", err: true},
+		{name: "invalid label name", path: "/job/backup/1nstance/db1", err: true},
+		{name: "reserved label name", path: "/job/backup/__name__/up", err: true},
+		{name: "invalid base64", path: "/job/backup/instance@base64/!", err: true},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			lbls, err := parsePushPath(c.path)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, lbls)
+		})
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	lbls := []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "other"}, {Name: "env", Value: "dev"}}
+	lbls = setLabels(lbls, []prompb.Label{{Name: "job", Value: "backup"}, {Name: "instance", Value: "db1"}, {Name: "env", Value: ""}, {Name: "zone", Value: ""}})
+	require.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "backup"}, {Name: "instance", Value: "db1"}}, lbls)
+}
+
+func TestPush(t *testing.T) {
+	metrics = &Metrics{
+		ReceivedSamples:   &mockMetric{},
+		ReceivedMetadata:  &mockMetric{},
+		FailedSamples:     &mockMetric{},
+		FailedMetadata:    &mockMetric{},
+		SentSamples:       &mockMetric{},
+		SentMetadata:      &mockMetric{},
+		SentBatchDuration: &mockMetric{},
+		InvalidWriteReqs:  &mockMetric{},
+	}
+	now := time.Unix(1395066400, 0)
+	pushNow = func() time.Time { return now }
+	defer func() { pushNow = time.Now }()
+	pushTime := func(groupingLabels ...prompb.Label) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  append([]prompb.Label{{Name: "__name__", Value: "push_time_seconds"}}, groupingLabels...),
+			Samples: []prompb.Sample{{Timestamp: 1395066400000, Value: 1395066400}},
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		contentType  string
+		body         string
+		responseCode int
+		expected     []prompb.TimeSeries
+		sqlQueries   []model.SqlQuery
+	}{
+		{
+			name:         "text format without content type",
+			method:       http.MethodPost,
+			path:         "/metrics/job/backup/instance/db1",
+			body:         "# TYPE backup_size_bytes gauge\nbackup_size_bytes{job=\"x\"} 1024 1395066363000\nbackup_size_bytes{job=\"x\"} 2048 1395066364000\n",
+			responseCode: http.StatusOK,
+			expected: []prompb.TimeSeries{
+				{
+					Labels:  []prompb.Label{{Name: "__name__", Value: "backup_size_bytes"}, {Name: "job", Value: "backup"}, {Name: "instance", Value: "db1"}},
+					Samples: []prompb.Sample{{Timestamp: 1395066363000, Value: 1024}},
+				},
+				{
+					Labels:  []prompb.Label{{Name: "__name__", Value: "backup_size_bytes"}, {Name: "job", Value: "backup"}, {Name: "instance", Value: "db1"}},
+					Samples: []prompb.Sample{{Timestamp: 1395066364000, Value: 2048}},
+				},
+				pushTime(prompb.Label{Name: "job", Value: "backup"}, prompb.Label{Name: "instance", Value: "db1"}),
+			},
+			sqlQueries: []model.SqlQuery{{
+				Sql: "SELECT _prom_catalog.replace_push_group($1::jsonb, $2, $3::text[], $4::text[]::jsonb[], $5::timestamptz[], $6::float8[])",
+				Args: []interface{}{
+					`{"instance":"db1","job":"backup"}`,
+					false,
+					[]string{"backup_size_bytes", "push_time_seconds"},
+					[]string{`{"instance":"db1","job":"backup"}`, `{"instance":"db1","job":"backup"}`},
+					[]time.Time{timestamp.Time(1395066364000), timestamp.Time(1395066400000)},
+					[]float64{2048, 1395066400},
+				},
+			}},
+		},
+		{
+			name:         "openmetrics",
+			method:       http.MethodPut,
+			path:         "/metrics/job/backup",
+			contentType:  "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			body:         "# TYPE backup_duration_seconds gauge\nbackup_duration_seconds 12.5 1395066363.5\n# EOF\n",
+			responseCode: http.StatusOK,
+			expected: []prompb.TimeSeries{
+				{
+					Labels:  []prompb.Label{{Name: "__name__", Value: "backup_duration_seconds"}, {Name: "job", Value: "backup"}},
+					Samples: []prompb.Sample{{Timestamp: 1395066363500, Value: 12.5}},
+				},
+				pushTime(prompb.Label{Name: "job", Value: "backup"}),
+			},
+			sqlQueries: []model.SqlQuery{{
+				Sql: "SELECT _prom_catalog.replace_push_group($1::jsonb, $2, $3::text[], $4::text[]::jsonb[], $5::timestamptz[], $6::float8[])",
+				Args: []interface{}{
+					`{"job":"backup"}`,
+					true,
+					[]string{"backup_duration_seconds", "push_time_seconds"},
+					[]string{`{"job":"backup"}`, `{"job":"backup"}`},
+					[]time.Time{timestamp.Time(1395066363500), timestamp.Time(1395066400000)},
+					[]float64{12.5, 1395066400},
+				},
+			}},
+		},
+		{
+			name:         "delete",
+			method:       http.MethodDelete,
+			path:         "/metrics/job/backup",
+			responseCode: http.StatusOK,
+			sqlQueries: []model.SqlQuery{{
+				Sql:     "SELECT _prom_catalog.delete_push_group($1::jsonb)",
+				Args:    []interface{}{`{"job":"backup"}`},
+				Results: model.RowResults{{true}},
+			}},
+		},
+		{
+			name:         "protobuf format",
+			method:       http.MethodPost,
+			path:         "/metrics/job/backup",
+			contentType:  "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited",
+			body:         "x",
+			responseCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid path",
+			method:       http.MethodPost,
+			path:         "/metrics/instance/db1",
+			body:         "up 1\n",
+			responseCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid text",
+			method:       http.MethodPost,
+			path:         "/metrics/job/backup",
+			body:         "up{ 1\n",
+			responseCode: http.StatusBadRequest,
+		},
+		{
+			name:         "push time pushed",
+			method:       http.MethodPost,
+			path:         "/metrics/job/backup",
+			body:         "push_time_seconds 1\n",
+			responseCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			inserter := &mockInserter{result: int64(len(c.expected))}
+			conn := model.NewSqlRecorder(c.sqlQueries, t)
+			handler := Push(inserter, conn, parser.NewParser(), nil, 0).ServeHTTP
+			router := route.New()
+			router.Post("/metrics/*"+pushLabelsParam, handler)
+			router.Put("/metrics/*"+pushLabelsParam, handler)
+			router.Del("/metrics/*"+pushLabelsParam, handler)
+
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, c.responseCode, w.Code, w.Body.String())
+			require.Equal(t, c.expected, inserter.ts)
+		})
+	}
+}
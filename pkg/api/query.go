@@ -14,12 +14,12 @@ import (
 	"github.com/timescale/promscale/pkg/promql"
 )
 
-func Query(conf *Config, queryEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.Handler {
-	hf := corsWrapper(conf, queryHandler(queryEngine, queryable, metrics))
+func Query(conf *Config, queryEngine, archivedEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.Handler {
+	hf := corsWrapper(conf, queryHandler(conf, queryEngine, archivedEngine, queryable, metrics))
 	return gziphandler.GzipHandler(hf)
 }
 
-func queryHandler(queryEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.HandlerFunc {
+func queryHandler(conf *Config, queryEngine, archivedEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ts time.Time
 		var err error
@@ -45,10 +45,31 @@ func queryHandler(queryEngine *promql.Engine, queryable promql.Queryable, metric
 			ctx, cancel = context.WithTimeout(ctx, timeout)
 			defer cancel()
 		}
+		engine, ctx, archived, err := archivedQuery(ctx, r, queryEngine, archivedEngine)
+		if err != nil {
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			metrics.InvalidQueryReqs.Add(1)
+			return
+		}
+		ctx, _, err = unitQuery(ctx, r)
+		if err != nil {
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			metrics.InvalidQueryReqs.Add(1)
+			return
+		}
+		ctx, limit, _, err := limitQuery(ctx, r)
+		if err != nil {
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			metrics.InvalidQueryReqs.Add(1)
+			return
+		}
 
 		metrics.ReceivedQueries.Add(1)
 		begin := time.Now()
-		qry, err := queryEngine.NewInstantQuery(queryable, r.FormValue("query"), ts)
+		qry, err := engine.NewInstantQuery(queryable, r.FormValue("query"), ts)
 		if err != nil {
 			log.Error("msg", "Query error", "err", err.Error())
 			respondError(w, http.StatusBadRequest, err, "bad_data")
@@ -77,6 +98,12 @@ func queryHandler(queryEngine *promql.Engine, queryable promql.Queryable, metric
 			return
 		}
 
+		truncateResult(res, limit)
+		decryptQueryResult(conf, r, res)
+		if archived {
+			res.Warnings = append(res.Warnings, errArchivedQuery)
+		}
+		res.Warnings = withTraceWarning(ctx, res.Warnings)
 		respondQuery(w, res, res.Warnings)
 	}
 }
@@ -0,0 +1,34 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// queryClassHeader sets the priority class of the queries of a request, e.g.
+// 'rule' for the requests of rule evaluators, so that they run on the
+// connection pool of their class.
+const queryClassHeader = "X-Promscale-Query-Class"
+
+// queryClassHandler runs the handler with the query class of the request in
+// its context, rejecting the requests with an unknown class.
+func queryClassHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(queryClassHeader)
+		if name == "" {
+			h(w, r)
+			return
+		}
+		class, err := pgxconn.ParseQueryClass(name)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		h(w, r.WithContext(pgxconn.WithQueryClass(r.Context(), class)))
+	}
+}
@@ -0,0 +1,43 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+func TestQueryClassHandler(t *testing.T) {
+	testCases := []struct {
+		name       string
+		header     string
+		expectCode int
+		expect     pgxconn.QueryClass
+	}{
+		{name: "default", expectCode: http.StatusOK, expect: pgxconn.ClassInteractive},
+		{name: "rule", header: "rule", expectCode: http.StatusOK, expect: pgxconn.ClassRule},
+		{name: "unknown", header: "urgent", expectCode: http.StatusBadRequest},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			var class pgxconn.QueryClass
+			h := queryClassHandler(func(w http.ResponseWriter, r *http.Request) {
+				class = pgxconn.QueryClassFrom(r.Context())
+			})
+			r := httptest.NewRequest("GET", "/api/v1/query", nil)
+			if c.header != "" {
+				r.Header.Set(queryClassHeader, c.header)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			require.Equal(t, c.expectCode, w.Code)
+			require.Equal(t, c.expect, class)
+		})
+	}
+}
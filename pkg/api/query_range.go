@@ -16,12 +16,12 @@ import (
 	"github.com/timescale/promscale/pkg/promql"
 )
 
-func QueryRange(conf *Config, queryEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.Handler {
-	hf := corsWrapper(conf, queryRange(conf, queryEngine, queryable, metrics))
+func QueryRange(conf *Config, queryEngine, archivedEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.Handler {
+	hf := corsWrapper(conf, queryRange(conf, queryEngine, archivedEngine, queryable, metrics))
 	return gziphandler.GzipHandler(hf)
 }
 
-func queryRange(conf *Config, queryEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.HandlerFunc {
+func queryRange(conf *Config, queryEngine, archivedEngine *promql.Engine, queryable promql.Queryable, metrics *Metrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start, err := parseTime(r.FormValue("start"))
 		if err != nil {
@@ -86,24 +86,45 @@ func queryRange(conf *Config, queryEngine *promql.Engine, queryable promql.Query
 			ctx, cancel = context.WithTimeout(ctx, timeout)
 			defer cancel()
 		}
+		engine, ctx, archived, err := archivedQuery(ctx, r, queryEngine, archivedEngine)
+		if err != nil {
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			metrics.InvalidQueryReqs.Add(1)
+			return
+		}
+		ctx, converted, err := unitQuery(ctx, r)
+		if err != nil {
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			metrics.InvalidQueryReqs.Add(1)
+			return
+		}
+		ctx, limit, limited, err := limitQuery(ctx, r)
+		if err != nil {
+			log.Info("msg", "Query bad request:"+err.Error())
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			metrics.InvalidQueryReqs.Add(1)
+			return
+		}
 
 		metrics.ReceivedQueries.Add(1)
 		begin := time.Now()
-		qry, err := queryEngine.NewRangeQuery(
-			queryable,
-			r.FormValue("query"),
-			start,
-			end,
-			step,
-		)
+		var res *promql.Result
+		if conf.ResultsCache != nil && !archived && !converted && !limited {
+			res, err = conf.ResultsCache.Exec(ctx, engine, queryable, r.FormValue("query"), start, end, step)
+		} else {
+			var qry promql.Query
+			if qry, err = engine.NewRangeQuery(queryable, r.FormValue("query"), start, end, step); err == nil {
+				res = qry.Exec(ctx)
+			}
+		}
 		if err != nil {
 			log.Info("msg", "Query parse error: "+err.Error())
 			respondError(w, http.StatusBadRequest, err, "bad_data")
 			metrics.FailedQueries.Add(1)
 			return
 		}
-
-		res := qry.Exec(ctx)
 		metrics.QueryDuration.Observe(time.Since(begin).Seconds())
 
 		if res.Err != nil {
@@ -124,6 +145,12 @@ func queryRange(conf *Config, queryEngine *promql.Engine, queryable promql.Query
 			return
 		}
 
+		truncateResult(res, limit)
+		decryptQueryResult(conf, r, res)
+		if archived {
+			res.Warnings = append(res.Warnings, errArchivedQuery)
+		}
+		res.Warnings = withTraceWarning(ctx, res.Warnings)
 		respondQuery(w, res, res.Warnings)
 	}
 }
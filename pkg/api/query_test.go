@@ -59,7 +59,7 @@ func (m mockQuerier) Query(*prompb.Query) ([]*prompb.TimeSeries, error) {
 	panic("implement me")
 }
 
-func (m mockQuerier) Select(int64, int64, bool, *storage.SelectHints, *querier.QueryHints, []parser.Node, ...*labels.Matcher) (querier.SeriesSet, parser.Node) {
+func (m mockQuerier) Select(context.Context, int64, int64, bool, *storage.SelectHints, *querier.QueryHints, []parser.Node, ...*labels.Matcher) (querier.SeriesSet, parser.Node) {
 	time.Sleep(m.timeToSleepOnSelect)
 	return &mockSeriesSet{err: m.selectErr}, nil
 }
@@ -185,6 +185,13 @@ func TestQuery(t *testing.T) {
 			metric:      "m",
 			querier:     &mockQuerier{selectErr: fmt.Errorf("some error")},
 			timeout:     "30s",
+		}, {
+			name:        "Query limit exceeded",
+			expectCode:  http.StatusUnprocessableEntity,
+			expectError: "execution",
+			metric:      "m",
+			querier:     &mockQuerier{selectErr: querier.ErrQueryLimit{}},
+			timeout:     "30s",
 		}, {
 			name:       "All good",
 			expectCode: http.StatusOK,
@@ -214,7 +221,7 @@ func TestQuery(t *testing.T) {
 				InvalidQueryReqs: invalidQueryReqs,
 				QueryDuration:    queryDuration,
 			}
-			handler := queryHandler(engine, query.NewQueryable(tc.querier, tc.labelsReader), metrics)
+			handler := queryHandler(&Config{}, engine, nil, query.NewQueryable(tc.querier, tc.labelsReader), metrics)
 			queryURL := constructQuery(tc.metric, tc.time, tc.timeout)
 			w := doQuery(t, handler, queryURL, tc.canceled)
 
@@ -6,6 +6,7 @@ package api
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -19,6 +20,15 @@ import (
 	"github.com/timescale/promscale/pkg/prompb"
 )
 
+const (
+	streamedReadContentType = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+
+	// maxBytesInFrame is the size above which the chunks of a series are
+	// split in several frames of streamed read responses, the default of
+	// Prometheus.
+	maxBytesInFrame = 1024 * 1024
+)
+
 func Read(config *Config, reader querier.Reader, metrics *Metrics) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !validateReadHeaders(w, r) {
@@ -64,6 +74,13 @@ func Read(config *Config, reader querier.Reader, metrics *Metrics) http.Handler
 			}
 		}
 
+		if cq, ok := reader.(querier.ChunkQuerier); ok && negotiateResponseType(req.AcceptedResponseTypes) == prompb.ReadRequest_STREAMED_XOR_CHUNKS {
+			if f, ok := w.(http.Flusher); ok {
+				streamChunkedRead(config, w, f, r, cq, &req, metrics, begin)
+				return
+			}
+		}
+
 		var resp *prompb.ReadResponse
 		resp, err = reader.Read(&req)
 		if err != nil {
@@ -75,6 +92,7 @@ func Read(config *Config, reader querier.Reader, metrics *Metrics) http.Handler
 
 		duration := time.Since(begin).Seconds()
 		metrics.QueryBatchDuration.Observe(duration)
+		decryptReadResponse(config, r, resp)
 
 		data, err := proto.Marshal(resp)
 		if err != nil {
@@ -95,6 +113,90 @@ func Read(config *Config, reader querier.Reader, metrics *Metrics) http.Handler
 	})
 }
 
+// negotiateResponseType returns the first response type accepted by the
+// client that is supported, in the client's order of preference. Clients not
+// listing any accept samples.
+func negotiateResponseType(accepted []prompb.ReadRequest_ResponseType) prompb.ReadRequest_ResponseType {
+	for _, t := range accepted {
+		switch t {
+		case prompb.ReadRequest_SAMPLES, prompb.ReadRequest_STREAMED_XOR_CHUNKS:
+			return t
+		}
+	}
+	return prompb.ReadRequest_SAMPLES
+}
+
+// streamChunkedRead writes the results of the queries as a stream of
+// ChunkedReadResponse frames, each holding the chunks of one series or part
+// of them, flushed as the series are encoded. Errors can only be reported
+// with the status code until the first frame is written, after which the
+// stream is cut short.
+func streamChunkedRead(config *Config, w http.ResponseWriter, f http.Flusher, r *http.Request, cq querier.ChunkQuerier, req *prompb.ReadRequest, metrics *Metrics, begin time.Time) {
+	queryCount := float64(len(req.Queries))
+	w.Header().Set("Content-Type", streamedReadContentType)
+	stream := newChunkedWriter(w, f)
+	written := false
+
+	for i, q := range req.Queries {
+		var writeErr error
+		err := cq.QueryChunks(q, func(s *prompb.ChunkedSeries) error {
+			decryptChunkedSeries(config, r, []*prompb.ChunkedSeries{s})
+			if writeErr = writeChunkedSeries(stream, int64(i), s); writeErr != nil {
+				return writeErr
+			}
+			written = true
+			return nil
+		})
+		if writeErr != nil {
+			log.Warn("msg", "Error writing streamed read response", "err", writeErr)
+			metrics.FailedQueries.Add(queryCount)
+			return
+		}
+		if err != nil {
+			log.Warn("msg", "Error executing query", "query", q, "storage", "PostgreSQL", "err", err)
+			if !written {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			metrics.FailedQueries.Add(queryCount)
+			return
+		}
+	}
+
+	metrics.QueryBatchDuration.Observe(time.Since(begin).Seconds())
+}
+
+// writeChunkedSeries writes the chunks of a series in frames of about
+// maxBytesInFrame, each frame repeating the labels of the series.
+func writeChunkedSeries(stream io.Writer, queryIndex int64, s *prompb.ChunkedSeries) error {
+	labelBytes := 0
+	for _, l := range s.Labels {
+		labelBytes += l.Size()
+	}
+
+	chunks := s.Chunks
+	for len(chunks) > 0 {
+		frameBytesLeft := maxBytesInFrame - labelBytes
+		n := 0
+		for n < len(chunks) && (n == 0 || frameBytesLeft > 0) {
+			frameBytesLeft -= chunks[n].Size()
+			n++
+		}
+
+		b, err := proto.Marshal(&prompb.ChunkedReadResponse{
+			ChunkedSeries: []*prompb.ChunkedSeries{{Labels: s.Labels, Chunks: chunks[:n]}},
+			QueryIndex:    queryIndex,
+		})
+		if err != nil {
+			return fmt.Errorf("marshal chunked read response: %w", err)
+		}
+		if _, err = stream.Write(b); err != nil {
+			return fmt.Errorf("write chunked read response: %w", err)
+		}
+		chunks = chunks[n:]
+	}
+	return nil
+}
+
 func validateReadHeaders(w http.ResponseWriter, r *http.Request) bool {
 	// validate headers from https://github.com/prometheus/prometheus/blob/2bd077ed9724548b6a631b6ddba48928704b5c34/storage/remote/client.go
 	if r.Method != "POST" {
@@ -5,7 +5,10 @@
 package api
 
 import (
+	"bufio"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +16,7 @@ import (
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/prompb"
 )
 
@@ -127,6 +131,97 @@ func (m *mockReader) Read(r *prompb.ReadRequest) (*prompb.ReadResponse, error) {
 	return m.response, m.err
 }
 
+type mockChunkReader struct {
+	mockReader
+	series []*prompb.ChunkedSeries
+}
+
+func (m *mockChunkReader) QueryChunks(_ *prompb.Query, fn func(*prompb.ChunkedSeries) error) error {
+	if m.err != nil {
+		return m.err
+	}
+	for _, s := range m.series {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStreamedRead(t *testing.T) {
+	series := []*prompb.ChunkedSeries{
+		{
+			Labels: []prompb.Label{{Name: "__name__", Value: "cpu"}},
+			Chunks: []prompb.Chunk{{MinTimeMs: 1, MaxTimeMs: 2, Type: prompb.Chunk_XOR, Data: []byte{1, 2, 3}}},
+		},
+		{
+			Labels: []prompb.Label{{Name: "__name__", Value: "mem"}},
+			Chunks: []prompb.Chunk{
+				{MinTimeMs: 1, MaxTimeMs: 2, Type: prompb.Chunk_XOR, Data: make([]byte, maxBytesInFrame)},
+				{MinTimeMs: 3, MaxTimeMs: 4, Type: prompb.Chunk_XOR, Data: []byte{4}},
+			},
+		},
+	}
+	metrics := &Metrics{
+		QueryBatchDuration: &mockMetric{},
+		FailedQueries:      &mockMetric{},
+		ReceivedQueries:    &mockMetric{},
+		InvalidReadReqs:    &mockMetric{},
+	}
+	reader := &mockChunkReader{series: series}
+	handler := Read(&Config{}, reader, metrics)
+	test := GenerateReadHandleTester(t, handler, false)
+
+	w := test("POST", getReader(readRequestToString(&prompb.ReadRequest{
+		Queries:               []*prompb.Query{{}},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	})))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, streamedReadContentType, w.Header().Get("Content-Type"))
+
+	// The chunks of the second series are split in two frames.
+	var frames []prompb.ChunkedReadResponse
+	body := bufio.NewReader(w.Body)
+	for {
+		size, err := binary.ReadUvarint(body)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		var checksum uint32
+		require.NoError(t, binary.Read(body, binary.BigEndian, &checksum))
+		data := make([]byte, size)
+		_, err = io.ReadFull(body, data)
+		require.NoError(t, err)
+		require.Equal(t, crc32.Checksum(data, castagnoliTable), checksum)
+
+		var frame prompb.ChunkedReadResponse
+		require.NoError(t, proto.Unmarshal(data, &frame))
+		frames = append(frames, frame)
+	}
+	require.Len(t, frames, 3)
+	require.Equal(t, series[0], frames[0].ChunkedSeries[0])
+	require.Equal(t, series[1].Labels, frames[1].ChunkedSeries[0].Labels)
+	require.Equal(t, series[1].Chunks[:1], frames[1].ChunkedSeries[0].Chunks)
+	require.Equal(t, series[1].Chunks[1:], frames[2].ChunkedSeries[0].Chunks)
+
+	// Clients preferring samples get samples.
+	reader.response = &prompb.ReadResponse{}
+	w = test("POST", getReader(readRequestToString(&prompb.ReadRequest{
+		Queries:               []*prompb.Query{{}},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_SAMPLES, prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	})))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/x-protobuf", w.Header().Get("Content-Type"))
+
+	reader.err = fmt.Errorf("some error")
+	w = test("POST", getReader(readRequestToString(&prompb.ReadRequest{
+		Queries:               []*prompb.Query{{}},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	})))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
 func GenerateReadHandleTester(t *testing.T, handleFunc http.Handler, badHeader bool) HandleTester {
 	return func(method string, body io.Reader) *httptest.ResponseRecorder {
 		req, err := http.NewRequest(method, "", body)
@@ -0,0 +1,74 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type relabelPreviewResponse struct {
+	Series   labels.Labels      `json:"series"`
+	Result   labels.Labels      `json:"result"`
+	Matches  []relabelRuleMatch `json:"matchedRules"`
+	Rejected bool               `json:"rejected"`
+	Error    string             `json:"error,omitempty"`
+}
+
+type relabelRuleMatch struct {
+	Position int    `json:"position"`
+	Rule     string `json:"rule"`
+	Action   string `json:"action"`
+	Applied  bool   `json:"applied"`
+}
+
+// RelabelPreview returns an http.Handler applying the ingest naming policy to
+// the series of the series parameters, e.g. series=latency_ms{job="api"},
+// without writing them, and returning the labels they would be stored with
+// and the rules matching them.
+func RelabelPreview(conf *Config) http.Handler {
+	hf := corsWrapper(conf, relabelPreviewHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func relabelPreviewHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if len(r.Form["series"]) == 0 {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("no series parameter provided"), "bad_data")
+			return
+		}
+		res := make([]relabelPreviewResponse, 0, len(r.Form["series"]))
+		for _, s := range r.Form["series"] {
+			lbls, err := parser.ParseMetric(s)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Errorf("series %q: %w", s, err), "bad_data")
+				return
+			}
+			preview := conf.NamingPolicy.Preview(lbls)
+			p := relabelPreviewResponse{
+				Series:   lbls,
+				Result:   preview.Labels,
+				Matches:  make([]relabelRuleMatch, len(preview.Matches)),
+				Rejected: preview.Rejected,
+			}
+			if preview.Err != nil {
+				p.Error = preview.Err.Error()
+			}
+			for i, m := range preview.Matches {
+				p.Matches[i] = relabelRuleMatch{Position: m.Position, Rule: m.Rule.String(), Action: string(m.Rule.Action), Applied: m.Applied}
+			}
+			res = append(res, p)
+		}
+		respond(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,47 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/naming"
+)
+
+func TestRelabelPreview(t *testing.T) {
+	policy := naming.NewPolicy(&naming.Config{Rules: []naming.Rule{
+		{Action: naming.ActionRewrite, Metric: regexp.MustCompile("^(?:(.+)_ms)$"), Replacement: "${1}_seconds", Scale: 0.001},
+		{Action: naming.ActionReject, Metric: regexp.MustCompile("^(?:.+_ms)$")},
+	}})
+	form := url.Values{"series": {`latency_ms{job="api",le="500"}`, `up`}}
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/relabel/preview?"+form.Encode(), nil)
+	w := httptest.NewRecorder()
+	relabelPreviewHandler(&Config{NamingPolicy: policy}).ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"OK","data":[
+		{"series":{"__name__":"latency_ms","job":"api","le":"500"},"result":{"__name__":"latency_seconds","job":"api","le":"0.5"},"rejected":false,
+		 "matchedRules":[{"position":1,"rule":"rewrite (.+)_ms ${1}_seconds 0.001","action":"rewrite","applied":true},
+		                 {"position":2,"rule":"reject .+_ms","action":"reject","applied":false}]},
+		{"series":{"__name__":"up"},"result":{"__name__":"up"},"rejected":false,"matchedRules":[]}
+	]}`, w.Body.String())
+
+	// Without a naming policy the series are stored as they are.
+	w = httptest.NewRecorder()
+	relabelPreviewHandler(&Config{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/relabel/preview?series=up", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"result":{"__name__":"up"}`)
+
+	for _, query := range []string{"", "series=up{"} {
+		w = httptest.NewRecorder()
+		relabelPreviewHandler(&Config{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/relabel/preview?"+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -0,0 +1,100 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	signatureTimestampHeader = "X-Promscale-Timestamp"
+	signatureNonceHeader     = "X-Promscale-Nonce"
+	maxNonceLength           = 128
+)
+
+// replayGuard rejects signed requests whose timestamp is outside of the
+// allowed skew window, or whose nonce was already seen within that window.
+type replayGuard struct {
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mux       sync.Mutex
+	seen      map[string]time.Time
+	lastPurge time.Time
+}
+
+func newReplayGuard(maxSkew time.Duration) *replayGuard {
+	if maxSkew <= 0 {
+		return nil
+	}
+	return &replayGuard{
+		maxSkew: maxSkew,
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+	}
+}
+
+// check validates the timestamp and records the nonce of a request whose
+// signature was already verified.
+func (g *replayGuard) check(tenant, timestamp, nonce string) error {
+	if timestamp == "" || nonce == "" {
+		return fmt.Errorf("%s and %s headers are required", signatureTimestampHeader, signatureNonceHeader)
+	}
+	if len(nonce) > maxNonceLength {
+		return fmt.Errorf("nonce longer than %d characters", maxNonceLength)
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", signatureTimestampHeader, err)
+	}
+	now := g.now()
+	ts := time.Unix(sec, 0)
+	if skew := now.Sub(ts); skew > g.maxSkew || skew < -g.maxSkew {
+		return fmt.Errorf("request timestamp is outside of the allowed skew of %v", g.maxSkew)
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.purge(now)
+	// A nonce only has to be remembered while its timestamp is accepted.
+	key := tenant + "\x00" + nonce
+	if _, ok := g.seen[key]; ok {
+		return fmt.Errorf("replayed request")
+	}
+	g.seen[key] = ts.Add(g.maxSkew)
+	return nil
+}
+
+// purge removes the nonces that can no longer be replayed. It runs at most
+// once per skew window to keep the cost per request low.
+func (g *replayGuard) purge(now time.Time) {
+	if now.Sub(g.lastPurge) < g.maxSkew {
+		return
+	}
+	for key, expiry := range g.seen {
+		if now.After(expiry) {
+			delete(g.seen, key)
+		}
+	}
+	g.lastPurge = now
+}
+
+// signedPayload returns the data covered by the signature. With replay
+// protection enabled, the timestamp and nonce are signed along the body so
+// they cannot be changed by an attacker.
+func signedPayload(timestamp, nonce string, body []byte) []byte {
+	if timestamp == "" && nonce == "" {
+		return body
+	}
+	payload := make([]byte, 0, len(timestamp)+len(nonce)+2+len(body))
+	payload = append(payload, timestamp...)
+	payload = append(payload, '\n')
+	payload = append(payload, nonce...)
+	payload = append(payload, '\n')
+	return append(payload, body...)
+}
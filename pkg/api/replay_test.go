@@ -0,0 +1,42 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayGuard(t *testing.T) {
+	require.Nil(t, newReplayGuard(0))
+
+	now := time.Unix(1600000000, 0)
+	g := newReplayGuard(time.Minute)
+	g.now = func() time.Time { return now }
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	require.NoError(t, g.check("a", ts, "nonce-1"))
+	require.Error(t, g.check("a", ts, "nonce-1"), "replayed nonce")
+	require.NoError(t, g.check("b", ts, "nonce-1"), "nonces are scoped per tenant")
+
+	require.Error(t, g.check("a", "", "nonce-2"))
+	require.Error(t, g.check("a", ts, ""))
+	require.Error(t, g.check("a", "not-a-number", "nonce-2"))
+	require.Error(t, g.check("a", strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10), "nonce-2"))
+	require.Error(t, g.check("a", strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10), "nonce-2"))
+
+	// Once the timestamp is out of the window, the nonce is forgotten.
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, g.check("c", strconv.FormatInt(now.Unix(), 10), "nonce-3"))
+	require.Len(t, g.seen, 1)
+}
+
+func TestSignedPayload(t *testing.T) {
+	require.Equal(t, "body", string(signedPayload("", "", []byte("body"))))
+	require.Equal(t, "1600000000\nabc\nbody", string(signedPayload("1600000000", "abc", []byte("body"))))
+}
@@ -0,0 +1,145 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/common/model"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/usage"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+type retentionRecommendationsResponse struct {
+	ObservedSince   *time.Time                        `json:"observedSince"`
+	Applied         bool                              `json:"applied"`
+	Recommendations []retentionRecommendationResponse `json:"recommendations"`
+}
+
+type retentionRecommendationResponse struct {
+	Metric        string     `json:"metric"`
+	Retention     string     `json:"retention"`
+	Recommended   string     `json:"recommended"`
+	MaxLookback   string     `json:"maxLookback,omitempty"`
+	Queries       int64      `json:"queries"`
+	LastQueriedAt *time.Time `json:"lastQueriedAt,omitempty"`
+	Reason        string     `json:"reason"`
+}
+
+// RetentionRecommendations returns an http.Handler recommending shorter
+// retentions for the metrics that are not queried as far back as they are
+// retained, and applying them on POST requests with apply=true.
+func RetentionRecommendations(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, retentionRecommendationsHandler(conf, conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func retentionRecommendationsHandler(conf *Config, conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkRetentionAdmin(w, r, conf) {
+			return
+		}
+		opts, apply, err := parseRetentionOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if apply && r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, fmt.Errorf("recommendations are only applied by POST requests"), "bad_data")
+			return
+		}
+
+		report, err := usage.Recommend(conn, opts, time.Now())
+		if err != nil {
+			log.Error("msg", "error recommending retentions", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "internal")
+			return
+		}
+		if apply {
+			applied, err := usage.Apply(conn, report.Recommendations)
+			for _, rec := range report.Recommendations[:applied] {
+				log.Info("msg", "retention recommendation applied", "metric", rec.Metric, "retention", model.Duration(rec.Recommended), "previous-retention", model.Duration(rec.Retention), "requested-by", requestedBy(r))
+			}
+			if err != nil {
+				log.Error("msg", "error applying retention recommendations", "err", err)
+				respondError(w, http.StatusInternalServerError, err, "internal")
+				return
+			}
+		}
+
+		res := retentionRecommendationsResponse{
+			ObservedSince:   report.ObservedSince,
+			Applied:         apply,
+			Recommendations: make([]retentionRecommendationResponse, 0, len(report.Recommendations)),
+		}
+		for _, rec := range report.Recommendations {
+			resRec := retentionRecommendationResponse{
+				Metric:        rec.Metric,
+				Retention:     model.Duration(rec.Retention).String(),
+				Recommended:   model.Duration(rec.Recommended).String(),
+				Queries:       rec.Queries,
+				LastQueriedAt: rec.LastQueriedAt,
+				Reason:        rec.Reason,
+			}
+			if rec.MaxLookback != nil {
+				resRec.MaxLookback = model.Duration(rec.MaxLookback.Round(time.Second)).String()
+			}
+			res.Recommendations = append(res.Recommendations, resRec)
+		}
+		respond(w, http.StatusOK, res)
+	}
+}
+
+func parseRetentionOptions(r *http.Request) (usage.Options, bool, error) {
+	opts := usage.Options{SafetyMargin: 1.5, MinRetention: 7 * 24 * time.Hour, MinObservation: 7 * 24 * time.Hour}
+	if err := r.ParseForm(); err != nil {
+		return opts, false, err
+	}
+	var err error
+	if s := r.FormValue("safety_margin"); s != "" {
+		if opts.SafetyMargin, err = strconv.ParseFloat(s, 64); err != nil {
+			return opts, false, fmt.Errorf("param safety_margin: %w", err)
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"min_retention", &opts.MinRetention},
+		{"min_observation", &opts.MinObservation},
+	} {
+		if s := r.FormValue(p.name); s != "" {
+			if *p.value, err = parseDuration(s); err != nil {
+				return opts, false, fmt.Errorf("param %s: %w", p.name, err)
+			}
+		}
+	}
+	apply := false
+	if s := r.FormValue("apply"); s != "" {
+		if apply, err = strconv.ParseBool(s); err != nil {
+			return opts, false, fmt.Errorf("param apply: %w", err)
+		}
+	}
+	return opts, apply, opts.Validate()
+}
+
+// checkRetentionAdmin responds with an error if the retention
+// recommendations cannot be managed. They can be reported in read-only mode.
+func checkRetentionAdmin(w http.ResponseWriter, r *http.Request, conf *Config) bool {
+	if !conf.AdminAPIEnabled {
+		respondError(w, http.StatusForbidden, fmt.Errorf("retention recommendations require admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+		return false
+	}
+	if conf.ReadOnly && r.Method != http.MethodGet {
+		respondError(w, http.StatusForbidden, fmt.Errorf("read-only connector cannot apply retention recommendations"), "operation_not_permitted")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionRecommendationsBadRequests(t *testing.T) {
+	testCases := []struct {
+		name   string
+		conf   *Config
+		method string
+		form   url.Values
+		code   int
+	}{
+		{
+			name:   "admin API disabled",
+			conf:   &Config{},
+			method: http.MethodGet,
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "read-only",
+			conf:   &Config{AdminAPIEnabled: true, ReadOnly: true},
+			method: http.MethodPost,
+			form:   url.Values{"apply": {"true"}},
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "apply on GET",
+			conf:   &Config{AdminAPIEnabled: true},
+			method: http.MethodGet,
+			form:   url.Values{"apply": {"true"}},
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "safety margin below 1",
+			conf:   &Config{AdminAPIEnabled: true},
+			method: http.MethodGet,
+			form:   url.Values{"safety_margin": {"0.5"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "minimum retention below a day",
+			conf:   &Config{AdminAPIEnabled: true},
+			method: http.MethodGet,
+			form:   url.Values{"min_retention": {"1h"}},
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(c.method, "/api/v1/admin/retention/recommendations?"+c.form.Encode(), strings.NewReader(c.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			retentionRecommendationsHandler(c.conf, nil).ServeHTTP(w, r)
+			require.Equal(t, c.code, w.Code)
+		})
+	}
+}
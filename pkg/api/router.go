@@ -5,6 +5,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
@@ -20,106 +21,282 @@ import (
 	haClient "github.com/timescale/promscale/pkg/ha/client"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/timescale/promscale/pkg/pgmodel/exemplar"
+	"github.com/timescale/promscale/pkg/pgmodel/metadata"
+	"github.com/timescale/promscale/pkg/promql"
 	"github.com/timescale/promscale/pkg/query"
+	"github.com/timescale/promscale/pkg/tail"
 	"github.com/timescale/promscale/pkg/util"
 )
 
+// GenerateRouter returns a handler serving all the endpoints of the connector.
 func GenerateRouter(apiConf *Config, client *pgclient.Client, elector *util.Elector) (http.Handler, error) {
-	var writePreprocessors []parser.Preprocessor
+	router := newRouter(apiConf.Auth, apiConf.Tracing)
+	if err := registerRoutes(apiConf, client, elector, router, router); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// GenerateSplitRouters returns two handlers: a public one serving the write,
+// read, query, build information and runtime information endpoints, and an
+// internal one serving the admin, flags, telemetry and debug endpoints. The internal handler uses the internal
+// auth configuration. Both serve the health check.
+func GenerateSplitRouters(apiConf *Config, client *pgclient.Client, elector *util.Elector) (public, internal http.Handler, err error) {
+	publicRouter := newRouter(apiConf.Auth, apiConf.Tracing)
+	internalRouter := newRouter(apiConf.InternalAuth, apiConf.Tracing)
+	if err := registerRoutes(apiConf, client, elector, publicRouter, internalRouter); err != nil {
+		return nil, nil, err
+	}
+	return publicRouter, internalRouter, nil
+}
+
+func newRouter(auth *Auth, tracing bool) *route.Router {
+	authWrapper := func(name string, h http.HandlerFunc) http.HandlerFunc {
+		if tracing {
+			return traceHandler(name, authHandler(auth, queryClassHandler(h)))
+		}
+		return authHandler(auth, queryClassHandler(h))
+	}
+	return route.New().WithInstrumentation(authWrapper)
+}
+
+func registerRoutes(apiConf *Config, client *pgclient.Client, elector *util.Elector, router, internalRouter *route.Router) error {
+	var writePreprocessors, pushPreprocessors []parser.Preprocessor
 	if apiConf.HighAvailability {
 		service := ha.NewService(haClient.NewLeaseClient(client.Connection))
 		writePreprocessors = append(writePreprocessors, ha.NewFilter(service))
 	}
 	if apiConf.MultiTenancy != nil {
-		writePreprocessors = append(writePreprocessors, apiConf.MultiTenancy.WriteAuthorizer())
+		writeAuthorizer := apiConf.MultiTenancy.WriteAuthorizer()
+		writePreprocessors = append(writePreprocessors, writeAuthorizer)
+		pushPreprocessors = append(pushPreprocessors, writeAuthorizer)
+	}
+	if apiConf.NamingPolicy != nil {
+		writePreprocessors = append(writePreprocessors, apiConf.NamingPolicy)
+		pushPreprocessors = append(pushPreprocessors, apiConf.NamingPolicy)
+	}
+	if apiConf.IngestPauses != nil {
+		writePreprocessors = append(writePreprocessors, apiConf.IngestPauses)
+		pushPreprocessors = append(pushPreprocessors, apiConf.IngestPauses)
+	}
+	if apiConf.LabelEncryptor != nil {
+		writePreprocessors = append(writePreprocessors, apiConf.LabelEncryptor)
+		pushPreprocessors = append(pushPreprocessors, apiConf.LabelEncryptor)
 	}
 
 	dataParser := parser.NewParser()
 	for _, preproc := range writePreprocessors {
 		dataParser.AddPreprocessor(preproc)
 	}
+	// Batch jobs are not run by HA Prometheus pairs, so their pushes are not
+	// deduplicated.
+	pushParser := parser.NewParser()
+	for _, preproc := range pushPreprocessors {
+		pushParser.AddPreprocessor(preproc)
+	}
 
-	writeHandler := timeHandler(metrics.HTTPRequestDuration, "write", Write(client, dataParser, elector))
+	writeHandler := timeHandler(metrics.HTTPRequestDuration, "write", Write(client, dataParser, elector, apiConf.WriteSigningKeys, apiConf.WriteSignatureMaxSkew))
 
 	// If we are running in read-only mode, log and send NotFound status.
 	if apiConf.ReadOnly {
 		writeHandler = withWarnLog("trying to send metrics to write API while connector is in read-only mode", http.NotFoundHandler())
 	}
 
-	authWrapper := func(name string, h http.HandlerFunc) http.HandlerFunc {
-		return authHandler(apiConf, h)
-	}
+	router.Post("/write", writeHandler)
 
-	router := route.New().WithInstrumentation(authWrapper)
+	pushHandler := timeHandler(metrics.HTTPRequestDuration, "push", Push(client, client.Connection, pushParser, apiConf.WriteSigningKeys, apiConf.WriteSignatureMaxSkew))
+	if apiConf.ReadOnly {
+		pushHandler = withWarnLog("trying to push metrics while connector is in read-only mode", http.NotFoundHandler())
+	}
+	router.Post("/metrics/*"+pushLabelsParam, pushHandler)
+	router.Put("/metrics/*"+pushLabelsParam, pushHandler)
+	router.Del("/metrics/*"+pushLabelsParam, pushHandler)
+	internalRouter.Get("/api/v1/push_groups", timeHandler(metrics.HTTPRequestDuration, "push_groups", PushGroups(apiConf, client.Connection)))
+	// The checkpoints of all the sources are listed, whatever the tenants
+	// they write, so they are only served to operators.
+	internalRouter.Get("/api/v1/checkpoints", timeHandler(metrics.HTTPRequestDuration, "checkpoints", Checkpoints(apiConf, client.Connection)))
 
-	router.Post("/write", writeHandler)
+	// The prepared transactions are resolved by the transaction managers
+	// of the operators, for the tenant they name.
+	internalRouter.Get("/api/v1/transactions", timeHandler(metrics.HTTPRequestDuration, "transactions", Transactions(apiConf, client.Connection)))
+	commitHandler := timeHandler(metrics.HTTPRequestDuration, "transactions/commit", CommitTransaction(apiConf, client.Connection))
+	rollbackHandler := timeHandler(metrics.HTTPRequestDuration, "transactions/rollback", RollbackTransaction(apiConf, client.Connection))
+	if apiConf.ReadOnly {
+		commitHandler = withWarnLog("trying to commit a transaction while connector is in read-only mode", http.NotFoundHandler())
+		rollbackHandler = withWarnLog("trying to roll back a transaction while connector is in read-only mode", http.NotFoundHandler())
+	}
+	internalRouter.Post("/api/v1/transactions/:id/commit", commitHandler)
+	internalRouter.Post("/api/v1/transactions/:id/rollback", rollbackHandler)
 
 	readHandler := timeHandler(metrics.HTTPRequestDuration, "read", Read(apiConf, client, metrics))
 	router.Get("/read", readHandler)
 	router.Post("/read", readHandler)
 
 	deleteHandler := timeHandler(metrics.HTTPRequestDuration, "delete_series", Delete(apiConf, client))
-	router.Put("/delete_series", deleteHandler)
-	router.Post("/delete_series", deleteHandler)
+	internalRouter.Put("/api/v1/admin/tsdb/delete_series", deleteHandler)
+	internalRouter.Post("/api/v1/admin/tsdb/delete_series", deleteHandler)
+	internalRouter.Put("/delete_series", deleteHandler)
+	internalRouter.Post("/delete_series", deleteHandler)
 
 	queryable := client.Queryable()
 	queryEngine, err := query.NewEngine(log.GetLogger(), apiConf.MaxQueryTimeout, apiConf.LookBackDelta, apiConf.SubQueryStepInterval, apiConf.MaxSamples, apiConf.EnabledFeaturesList)
 	if err != nil {
-		return nil, fmt.Errorf("creating query-engine: %w", err)
+		return fmt.Errorf("creating query-engine: %w", err)
 	}
-	queryHandler := timeHandler(metrics.HTTPRequestDuration, "query", Query(apiConf, queryEngine, queryable, metrics))
+	promqlQueryable := queryable
+	if apiConf.ColdQueryCfg.Age > 0 {
+		promqlQueryable = query.NewTemperatureQueryable(promqlQueryable, apiConf.ColdQueryCfg)
+	}
+	var archivedEngine *promql.Engine
+	if apiConf.ArchiveAge > 0 {
+		promqlQueryable = query.NewArchiveQueryable(promqlQueryable, apiConf.ArchiveAge)
+		archivedEngine, err = query.NewEngine(log.GetLogger(), apiConf.ArchivedMaxQueryTimeout, apiConf.LookBackDelta, apiConf.SubQueryStepInterval, apiConf.ArchivedMaxSamples, apiConf.EnabledFeaturesList)
+		if err != nil {
+			return fmt.Errorf("creating archived query-engine: %w", err)
+		}
+	}
+	promqlQueryable = query.NewUnitQueryable(promqlQueryable, func(ctx context.Context, metric string) (string, error) {
+		return metadata.Unit(ctx, client.Connection, metric)
+	})
+	queryHandler := timeHandler(metrics.HTTPRequestDuration, "query", Query(apiConf, queryEngine, archivedEngine, promqlQueryable, metrics))
 	router.Get("/api/v1/query", queryHandler)
 	router.Post("/api/v1/query", queryHandler)
 
-	queryRangeHandler := timeHandler(metrics.HTTPRequestDuration, "query_range", QueryRange(apiConf, queryEngine, queryable, metrics))
+	queryRangeHandler := timeHandler(metrics.HTTPRequestDuration, "query_range", QueryRange(apiConf, queryEngine, archivedEngine, promqlQueryable, metrics))
 	router.Get("/api/v1/query_range", queryRangeHandler)
 	router.Post("/api/v1/query_range", queryRangeHandler)
 
-	seriesHandler := timeHandler(metrics.HTTPRequestDuration, "series", Series(apiConf, queryable))
+	explainHandler := timeHandler(metrics.HTTPRequestDuration, "admin/query/explain", Explain(apiConf, queryEngine, client.ExplainQueryable))
+	internalRouter.Get("/api/v1/admin/query/explain", explainHandler)
+	internalRouter.Post("/api/v1/admin/query/explain", explainHandler)
+
+	seriesHandler := timeHandler(metrics.HTTPRequestDuration, "series", Series(apiConf, queryable, client.SeriesQuerier()))
 	router.Get("/api/v1/series", seriesHandler)
 	router.Post("/api/v1/series", seriesHandler)
 
-	labelsHandler := timeHandler(metrics.HTTPRequestDuration, "labels", Labels(apiConf, queryable))
+	labelsHandler := timeHandler(metrics.HTTPRequestDuration, "labels", Labels(apiConf, queryable, client.LabelQuerier()))
 	router.Get("/api/v1/labels", labelsHandler)
 	router.Post("/api/v1/labels", labelsHandler)
 
-	metadataHandler := timeHandler(metrics.HTTPRequestDuration, "metadata", MetricMetadata(apiConf, client))
+	metadataHandler := timeHandler(metrics.HTTPRequestDuration, "metadata", MetricMetadata(apiConf, client.Connection))
 	router.Get("/api/v1/metadata", metadataHandler)
 	router.Post("/api/v1/metadata", metadataHandler)
+	targetMetadataHandler := timeHandler(metrics.HTTPRequestDuration, "targets/metadata", TargetMetadata(apiConf, client.Connection))
+	router.Get("/api/v1/targets/metadata", targetMetadataHandler)
+
+	// The storage layout lists the metrics of all the tenants, so it is only
+	// served to operators.
+	metricStorageHandler := timeHandler(metrics.HTTPRequestDuration, "metrics", MetricStorage(apiConf, client.Connection))
+	internalRouter.Get("/api/v1/metrics", metricStorageHandler)
+
+	forecastHandler := timeHandler(metrics.HTTPRequestDuration, "forecast", Forecast(apiConf, client.Connection))
+	router.Get("/api/v1/forecast", forecastHandler)
+	router.Post("/api/v1/forecast", forecastHandler)
 
-	labelValuesHandler := timeHandler(metrics.HTTPRequestDuration, "label/:name/values", LabelValues(apiConf, queryable))
+	exemplarsHandler := timeHandler(metrics.HTTPRequestDuration, "query_exemplars", QueryExemplars(apiConf, exemplar.NewQueryable(client.Connection)))
+	router.Get("/api/v1/query_exemplars", exemplarsHandler)
+	router.Post("/api/v1/query_exemplars", exemplarsHandler)
+
+	labelValuesHandler := timeHandler(metrics.HTTPRequestDuration, "label/:name/values", LabelValues(apiConf, queryable, client.LabelQuerier()))
 	router.Get("/api/v1/label/:name/values", labelValuesHandler)
 
+	// Tail requests are long-lived streams, so they are not included in the
+	// request duration histogram.
+	var tailBroker *tail.Broker
+	if ing := client.Ingestor(); ing != nil {
+		tailBroker = ing.Tail()
+	}
+	router.Get("/api/v1/tail", Tail(apiConf, tailBroker).ServeHTTP)
+
+	chaosHandler := timeHandler(metrics.HTTPRequestDuration, "admin/chaos", Chaos(apiConf))
+	internalRouter.Get("/api/v1/admin/chaos", chaosHandler)
+	internalRouter.Post("/api/v1/admin/chaos", chaosHandler)
+	internalRouter.Del("/api/v1/admin/chaos", chaosHandler)
+
+	purgesHandler := timeHandler(metrics.HTTPRequestDuration, "admin/purges", Purges(apiConf))
+	internalRouter.Get("/api/v1/admin/purges", purgesHandler)
+	internalRouter.Post("/api/v1/admin/purges", purgesHandler)
+	internalRouter.Get("/api/v1/admin/purges/:id", timeHandler(metrics.HTTPRequestDuration, "admin/purges/:id", PurgeStatus(apiConf)))
+
+	pausesHandler := timeHandler(metrics.HTTPRequestDuration, "admin/ingest/pauses", IngestPauses(apiConf))
+	internalRouter.Get("/api/v1/admin/ingest/pauses", pausesHandler)
+	internalRouter.Post("/api/v1/admin/ingest/pauses", pausesHandler)
+	internalRouter.Del("/api/v1/admin/ingest/pauses", pausesHandler)
+
+	relabelPreviewHandler := timeHandler(metrics.HTTPRequestDuration, "admin/relabel/preview", RelabelPreview(apiConf))
+	internalRouter.Get("/api/v1/admin/relabel/preview", relabelPreviewHandler)
+	internalRouter.Post("/api/v1/admin/relabel/preview", relabelPreviewHandler)
+
+	retentionHandler := timeHandler(metrics.HTTPRequestDuration, "admin/retention/recommendations", RetentionRecommendations(apiConf, client.Connection))
+	internalRouter.Get("/api/v1/admin/retention/recommendations", retentionHandler)
+	internalRouter.Post("/api/v1/admin/retention/recommendations", retentionHandler)
+
+	internalRouter.Get("/api/v1/slos", timeHandler(metrics.HTTPRequestDuration, "slos", SLOs(apiConf)))
+	sloHandler := timeHandler(metrics.HTTPRequestDuration, "slos/:name", SLO(apiConf))
+	internalRouter.Get("/api/v1/slos/:name", sloHandler)
+	internalRouter.Put("/api/v1/slos/:name", sloHandler)
+	internalRouter.Post("/api/v1/slos/:name", sloHandler)
+	internalRouter.Del("/api/v1/slos/:name", sloHandler)
+	internalRouter.Get("/api/v1/slos/:name/status", timeHandler(metrics.HTTPRequestDuration, "slos/:name/status", SLOStatus(apiConf)))
+
+	tenantsHandler := timeHandler(metrics.HTTPRequestDuration, "admin/tenants", Tenants(apiConf))
+	internalRouter.Get("/api/v1/admin/tenants", tenantsHandler)
+	internalRouter.Post("/api/v1/admin/tenants", tenantsHandler)
+	internalRouter.Put("/api/v1/admin/tenants/:name", timeHandler(metrics.HTTPRequestDuration, "admin/tenants/:name", Tenant(apiConf)))
+	internalRouter.Del("/api/v1/admin/tenants/:name", timeHandler(metrics.HTTPRequestDuration, "admin/tenants/:name", DeleteTenant(apiConf)))
+	internalRouter.Get("/api/v1/admin/tenants/:name/purge", timeHandler(metrics.HTTPRequestDuration, "admin/tenants/:name/purge", TenantPurge(apiConf)))
+	internalRouter.Post("/api/v1/admin/tenants/:name/rotate_token", timeHandler(metrics.HTTPRequestDuration, "admin/tenants/:name/rotate_token", RotateTenantToken(apiConf)))
+
+	// Grafana and other tooling probe the build and runtime information on the
+	// address of the data source, so these are served with the query endpoints.
+	buildInfoHandler := timeHandler(metrics.HTTPRequestDuration, "status/buildinfo", BuildInfo(apiConf, client.Connection))
+	router.Get("/api/v1/status/buildinfo", buildInfoHandler)
+
+	runtimeInfoHandler := timeHandler(metrics.HTTPRequestDuration, "status/runtimeinfo", RuntimeInfo(apiConf, client.Connection))
+	router.Get("/api/v1/status/runtimeinfo", runtimeInfoHandler)
+
+	flagsHandler := timeHandler(metrics.HTTPRequestDuration, "status/flags", Flags(apiConf))
+	internalRouter.Get("/api/v1/status/flags", flagsHandler)
+
+	// The cardinality statistics span all the tenants and are costly to
+	// compute, so they are only served to operators.
+	tsdbStatusHandler := timeHandler(metrics.HTTPRequestDuration, "status/tsdb", TSDBStatus(apiConf, client.Connection))
+	internalRouter.Get("/api/v1/status/tsdb", tsdbStatusHandler)
+
 	healthChecker := func() error { return client.HealthCheck() }
 	router.Get("/healthz", Health(healthChecker))
+	if internalRouter != router {
+		internalRouter.Get("/healthz", Health(healthChecker))
+	}
 
-	router.Get(apiConf.TelemetryPath, promhttp.Handler().ServeHTTP)
-	router.Get("/debug/pprof/", pprof.Index)
-	router.Get("/debug/pprof/cmdline", pprof.Cmdline)
-	router.Get("/debug/pprof/profile", pprof.Profile)
-	router.Get("/debug/pprof/symbol", pprof.Symbol)
-	router.Get("/debug/pprof/trace", pprof.Trace)
-	router.Get("/debug/pprof/heap", pprof.Handler("heap").ServeHTTP)
-	router.Get("/debug/pprof/goroutine", pprof.Handler("goroutine").ServeHTTP)
-	router.Get("/debug/pprof/threadcreate", pprof.Handler("threadcreate").ServeHTTP)
-	router.Get("/debug/pprof/block", pprof.Handler("block").ServeHTTP)
-	router.Get("/debug/pprof/allocs", pprof.Handler("allocs").ServeHTTP)
-	router.Get("/debug/pprof/mutex", pprof.Handler("mutex").ServeHTTP)
-
-	router.Get("/debug/fgprof", fgprof.Handler().ServeHTTP)
+	internalRouter.Get(apiConf.TelemetryPath, promhttp.Handler().ServeHTTP)
+	internalRouter.Get("/debug/pprof/", pprof.Index)
+	internalRouter.Get("/debug/pprof/cmdline", pprof.Cmdline)
+	internalRouter.Get("/debug/pprof/profile", pprof.Profile)
+	internalRouter.Get("/debug/pprof/symbol", pprof.Symbol)
+	internalRouter.Get("/debug/pprof/trace", pprof.Trace)
+	internalRouter.Get("/debug/pprof/heap", pprof.Handler("heap").ServeHTTP)
+	internalRouter.Get("/debug/pprof/goroutine", pprof.Handler("goroutine").ServeHTTP)
+	internalRouter.Get("/debug/pprof/threadcreate", pprof.Handler("threadcreate").ServeHTTP)
+	internalRouter.Get("/debug/pprof/block", pprof.Handler("block").ServeHTTP)
+	internalRouter.Get("/debug/pprof/allocs", pprof.Handler("allocs").ServeHTTP)
+	internalRouter.Get("/debug/pprof/mutex", pprof.Handler("mutex").ServeHTTP)
 
-	return router, nil
+	internalRouter.Get("/debug/fgprof", fgprof.Handler().ServeHTTP)
+
+	return nil
 }
 
-func authHandler(cfg *Config, handler http.HandlerFunc) http.HandlerFunc {
-	if cfg.Auth == nil {
+func authHandler(auth *Auth, handler http.HandlerFunc) http.HandlerFunc {
+	if auth == nil {
 		return handler
 	}
 
-	if cfg.Auth.BasicAuthUsername != "" {
+	if auth.BasicAuthUsername != "" {
 		return func(w http.ResponseWriter, r *http.Request) {
 			user, pass, ok := r.BasicAuth()
-			if !ok || cfg.Auth.BasicAuthUsername != user || cfg.Auth.BasicAuthPassword != pass {
+			if !ok || auth.BasicAuthUsername != user || auth.BasicAuthPassword != pass {
 				log.Error("msg", "Unauthorized access to endpoint, invalid username or password")
 				http.Error(w, "Unauthorized access to endpoint, invalid username or password.", http.StatusUnauthorized)
 				return
@@ -128,10 +305,10 @@ func authHandler(cfg *Config, handler http.HandlerFunc) http.HandlerFunc {
 		}
 	}
 
-	if cfg.Auth.BearerToken != "" {
+	if auth.BearerToken != "" {
 		return func(w http.ResponseWriter, r *http.Request) {
 			splitToken := strings.Split(r.Header.Get("Authorization"), "Bearer ")
-			if len(splitToken) < 2 || cfg.Auth.BearerToken != splitToken[1] {
+			if len(splitToken) < 2 || auth.BearerToken != splitToken[1] {
 				log.Error("msg", "Unauthorized access to endpoint, invalid bearer token")
 				http.Error(w, "Unauthorized access to endpoint, invalid bearer token", http.StatusUnauthorized)
 				return
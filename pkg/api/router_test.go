@@ -199,7 +199,7 @@ func TestAuthHandler(t *testing.T) {
 				req.Header.Set(name, value)
 			}
 
-			h := authHandler(c.cfg, handler)
+			h := authHandler(c.cfg.Auth, handler)
 			h.ServeHTTP(w, req)
 
 			if c.authorized && w.Code != http.StatusOK {
@@ -18,15 +18,19 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
 	"github.com/timescale/promscale/pkg/promql"
 )
 
-func Series(conf *Config, queryable promql.Queryable) http.Handler {
-	seriesHandler := corsWrapper(conf, series(queryable))
+// Series returns an http.Handler returning the series matching selectors.
+// The series are looked up by seriesQuerier if it is set, without fetching
+// their samples, and selected from queryable otherwise.
+func Series(conf *Config, queryable promql.Queryable, seriesQuerier querier.SeriesQuerier) http.Handler {
+	seriesHandler := corsWrapper(conf, series(conf, queryable, seriesQuerier))
 	return gziphandler.GzipHandler(seriesHandler)
 }
 
-func series(queryable promql.Queryable) http.HandlerFunc {
+func series(conf *Config, queryable promql.Queryable, seriesQuerier querier.SeriesQuerier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
 			respondError(w, http.StatusBadRequest, errors.Wrap(err, "error parsing form values"), "bad_data")
@@ -68,6 +72,24 @@ func series(queryable promql.Queryable) http.HandlerFunc {
 		}
 		ctx := r.Context()
 
+		if seriesQuerier != nil {
+			metrics, err := seriesQuerier.SelectSeries(ctx, timestamp.FromTime(start), timestamp.FromTime(end), matcherSets...)
+			if err != nil {
+				respondError(w, http.StatusUnprocessableEntity, err, "execution")
+				return
+			}
+			res := seriesType(metrics)
+			if res == nil {
+				res = seriesType{}
+			}
+			decryptSeries(conf, r, res)
+			sort.Slice(res, func(i, j int) bool {
+				return labels.Compare(res[i], res[j]) < 0
+			})
+			respondSeries(w, &promql.Result{Value: res}, nil)
+			return
+		}
+
 		q, err := queryable.Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 		if err != nil {
 			respondError(w, http.StatusUnprocessableEntity, err, "execution")
@@ -76,7 +98,8 @@ func series(queryable promql.Queryable) http.HandlerFunc {
 		var sets []storage.SeriesSet
 		var warnings storage.Warnings
 		for _, mset := range matcherSets {
-			s, _ := q.Select(false, nil, nil, nil, mset...)
+			// The series sets must be sorted to be merged (deduplicated) below.
+			s, _ := q.Select(true, nil, nil, nil, mset...)
 			warnings = append(warnings, s.Warnings()...)
 			if s.Err() != nil {
 				respondError(w, http.StatusUnprocessableEntity, s.Err(), "execution")
@@ -92,6 +115,7 @@ func series(queryable promql.Queryable) http.HandlerFunc {
 		if set.Err() != nil {
 			respondError(w, http.StatusUnprocessableEntity, set.Err(), "execution")
 		}
+		decryptSeries(conf, r, metrics)
 
 		sort.Slice(metrics, func(i, j int) bool {
 			return labels.Compare(metrics[i], metrics[j]) < 0
@@ -14,6 +14,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/query"
 )
@@ -90,7 +92,7 @@ func TestSeries(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := series(query.NewQueryable(tc.querier, nil))
+			handler := series(&Config{}, query.NewQueryable(tc.querier, nil), nil)
 			queryUrl := constructSeriesRequest(tc.start, tc.end, tc.matchers)
 			w := doSeriesRequest(t, handler, queryUrl)
 
@@ -136,3 +138,31 @@ func doSeriesRequest(t *testing.T, queryHandler http.Handler, url string) *httpt
 	queryHandler.ServeHTTP(w, req)
 	return w
 }
+
+type mockSeriesQuerier struct {
+	mint, maxt  int64
+	matcherSets [][]*labels.Matcher
+	series      []labels.Labels
+}
+
+func (m *mockSeriesQuerier) SelectSeries(_ context.Context, mint, maxt int64, matcherSets ...[]*labels.Matcher) ([]labels.Labels, error) {
+	m.mint, m.maxt, m.matcherSets = mint, maxt, matcherSets
+	return m.series, nil
+}
+
+func TestSeriesPushdown(t *testing.T) {
+	sq := &mockSeriesQuerier{series: []labels.Labels{labels.FromStrings("__name__", "m", "a", "1")}}
+	// The samples are not selected.
+	handler := series(&Config{}, query.NewQueryable(&mockQuerier{selectErr: fmt.Errorf("unexpected select")}, nil), sq)
+	w := doSeriesRequest(t, handler, constructSeriesRequest("1", "2", []string{"m", `m{a="1"}`}))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"success","data":[{"__name__":"m","a":"1"}]}`, w.Body.String())
+	require.Equal(t, int64(1000), sq.mint)
+	require.Equal(t, int64(2000), sq.maxt)
+	require.Len(t, sq.matcherSets, 2)
+
+	sq.series = nil
+	w = doSeriesRequest(t, handler, constructSeriesRequest("1", "2", []string{"m"}))
+	require.JSONEq(t, `{"status":"success","data":[]}`, w.Body.String())
+}
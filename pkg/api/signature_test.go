@@ -0,0 +1,93 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func sign(key, body string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(body))
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	metrics = &Metrics{InvalidWriteReqs: prometheus.NewCounter(prometheus.CounterOpts{Name: "invalid"})}
+	require.Nil(t, verifySignature(nil, nil))
+
+	stage := verifySignature(map[string][]byte{
+		"tenant-a":         []byte("key-a"),
+		defaultSigningKeys: []byte("default-key"),
+	}, nil)
+	body := "payload"
+
+	testCases := []struct {
+		name      string
+		tenant    string
+		signature string
+		valid     bool
+	}{
+		{name: "tenant key", tenant: "tenant-a", signature: sign("key-a", body), valid: true},
+		{name: "default key", signature: sign("default-key", body), valid: true},
+		{name: "default key for unlisted tenant", tenant: "tenant-b", signature: sign("default-key", body), valid: true},
+		{name: "key of another tenant", tenant: "tenant-a", signature: sign("default-key", body)},
+		{name: "missing signature", tenant: "tenant-a"},
+		{name: "malformed signature", tenant: "tenant-a", signature: "sha256=zz"},
+		{name: "missing prefix", tenant: "tenant-a", signature: strings.TrimPrefix(sign("key-a", body), signaturePrefix)},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/write", strings.NewReader(body))
+			if c.tenant != "" {
+				r.Header.Set(tenantHeader, c.tenant)
+			}
+			if c.signature != "" {
+				r.Header.Set(signatureHeader, c.signature)
+			}
+			w := httptest.NewRecorder()
+			require.Equal(t, c.valid, stage(w, r))
+			if !c.valid {
+				require.Equal(t, http.StatusUnauthorized, w.Code)
+				return
+			}
+			// The body must still be readable by the next stages.
+			read, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.Equal(t, body, string(read))
+		})
+	}
+}
+
+func TestReadSigningKeys(t *testing.T) {
+	f, err := ioutil.TempFile("", "signing-keys")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# comment\ntenant-a: key-a\n\n*:default:with:colons\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	keys, err := readSigningKeys(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"tenant-a": []byte("key-a"),
+		"*":        []byte("default:with:colons"),
+	}, keys)
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte("tenant-a\n"), 0600))
+	_, err = readSigningKeys(f.Name())
+	require.Error(t, err)
+}
@@ -0,0 +1,222 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/slo"
+)
+
+type sloResponse struct {
+	Name      string    `json:"name"`
+	Objective float64   `json:"objective"`
+	Window    string    `json:"window"`
+	Good      string    `json:"good"`
+	Total     string    `json:"total"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type sloStatusResponse struct {
+	sloResponse
+	Time                 time.Time          `json:"time"`
+	ErrorRatio           *float64           `json:"errorRatio"`
+	ErrorBudgetRemaining *float64           `json:"errorBudgetRemaining"`
+	BurnRates            map[string]float64 `json:"burnRates"`
+	Firing               []string           `json:"firing"`
+}
+
+func newSLOResponse(s slo.SLO) sloResponse {
+	return sloResponse{
+		Name:      s.Name,
+		Objective: s.Objective,
+		Window:    model.Duration(s.Window).String(),
+		Good:      s.Good,
+		Total:     s.Total,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// SLOs returns an http.Handler listing the service level objectives.
+func SLOs(conf *Config) http.Handler {
+	hf := corsWrapper(conf, slosHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func slosHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkSLOAdmin(w, r, conf) {
+			return
+		}
+		slos, err := conf.SLOs.List()
+		if err != nil {
+			respondSLOError(w, err)
+			return
+		}
+		res := make([]sloResponse, 0, len(slos))
+		for _, s := range slos {
+			res = append(res, newSLOResponse(s))
+		}
+		respond(w, http.StatusOK, res)
+	}
+}
+
+// SLO returns an http.Handler getting, defining and deleting a service level
+// objective.
+func SLO(conf *Config) http.Handler {
+	hf := corsWrapper(conf, sloHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func sloHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkSLOAdmin(w, r, conf) {
+			return
+		}
+		name := route.Param(r.Context(), "name")
+		switch r.Method {
+		case http.MethodGet:
+			s, err := conf.SLOs.Get(name)
+			if err != nil {
+				respondSLOError(w, err)
+				return
+			}
+			respond(w, http.StatusOK, newSLOResponse(s))
+		case http.MethodDelete:
+			if err := conf.SLOs.Delete(name); err != nil {
+				respondSLOError(w, err)
+				return
+			}
+			log.Info("msg", "SLO deleted", "slo", name, "requested-by", requestedBy(r))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			s, err := parseSLO(conf, r, name)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			if s, err = conf.SLOs.Put(s); err != nil {
+				respondSLOError(w, err)
+				return
+			}
+			log.Info("msg", "SLO defined", "slo", s.Name, "requested-by", requestedBy(r))
+			respond(w, http.StatusOK, newSLOResponse(s))
+		}
+	}
+}
+
+func parseSLO(conf *Config, r *http.Request, name string) (slo.SLO, error) {
+	s := slo.SLO{Name: name}
+	if err := r.ParseForm(); err != nil {
+		return s, err
+	}
+	var err error
+	if s.Objective, err = strconv.ParseFloat(r.FormValue("objective"), 64); err != nil {
+		return s, fmt.Errorf("param objective: %w", err)
+	}
+	if s.Window, err = parseDuration(r.FormValue("window")); err != nil {
+		return s, fmt.Errorf("param window: %w", err)
+	}
+	for _, p := range []struct {
+		name     string
+		selector *string
+	}{
+		{"good", &s.Good},
+		{"total", &s.Total},
+	} {
+		selector := r.FormValue(p.name)
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return s, fmt.Errorf("param %s: %w", p.name, err)
+		}
+		if *p.selector, err = encryptSelector(conf, selector, matchers); err != nil {
+			return s, fmt.Errorf("param %s: %w", p.name, err)
+		}
+	}
+	return s, slo.Validate(s)
+}
+
+// SLOStatus returns an http.Handler reporting the error budget, burn rates
+// and firing alerts of a service level objective.
+func SLOStatus(conf *Config) http.Handler {
+	hf := corsWrapper(conf, sloStatusHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func sloStatusHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkSLOAdmin(w, r, conf) {
+			return
+		}
+		t, err := parseTimeParam(r, "time", time.Now())
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		s, err := conf.SLOs.Get(route.Param(r.Context(), "name"))
+		if err != nil {
+			respondSLOError(w, err)
+			return
+		}
+		st, err := conf.SLOs.Status(s, t)
+		if err != nil {
+			respondSLOError(w, err)
+			return
+		}
+		res := sloStatusResponse{
+			sloResponse:          newSLOResponse(s),
+			Time:                 st.Time,
+			ErrorRatio:           st.ErrorRatio,
+			ErrorBudgetRemaining: st.ErrorBudgetRemaining,
+			BurnRates:            make(map[string]float64, len(st.BurnRates)),
+			Firing:               st.Firing,
+		}
+		for window, rate := range st.BurnRates {
+			res.BurnRates[model.Duration(window).String()] = rate
+		}
+		if res.Firing == nil {
+			res.Firing = []string{}
+		}
+		respond(w, http.StatusOK, res)
+	}
+}
+
+// checkSLOAdmin responds with an error if the SLOs cannot be managed. They
+// can be reported in read-only mode.
+func checkSLOAdmin(w http.ResponseWriter, r *http.Request, conf *Config) bool {
+	if !conf.AdminAPIEnabled {
+		respondError(w, http.StatusForbidden, fmt.Errorf("managing SLOs requires admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+		return false
+	}
+	if conf.ReadOnly && r.Method != http.MethodGet {
+		respondError(w, http.StatusForbidden, fmt.Errorf("read-only connector cannot manage SLOs"), "operation_not_permitted")
+		return false
+	}
+	if conf.SLOs == nil {
+		respondError(w, http.StatusServiceUnavailable, fmt.Errorf("SLOs are not available"), "unavailable")
+		return false
+	}
+	return true
+}
+
+func respondSLOError(w http.ResponseWriter, err error) {
+	if errors.Is(err, slo.ErrSLONotFound) {
+		respondError(w, http.StatusNotFound, err, "not_found")
+		return
+	}
+	log.Error("msg", "error managing SLOs", "err", err)
+	respondError(w, http.StatusInternalServerError, err, "internal")
+}
@@ -0,0 +1,87 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/slo"
+)
+
+func TestSLOHandlerBadRequests(t *testing.T) {
+	valid := url.Values{"objective": {"0.999"}, "window": {"30d"}, "good": {`http_requests_total{code!~"5.."}`}, "total": {"http_requests_total"}}
+	with := func(key, value string) url.Values {
+		form := url.Values{}
+		for k, v := range valid {
+			form[k] = v
+		}
+		form.Set(key, value)
+		return form
+	}
+	testCases := []struct {
+		name   string
+		conf   *Config
+		method string
+		form   url.Values
+		code   int
+	}{
+		{
+			name:   "admin API disabled",
+			conf:   &Config{SLOs: slo.NewManager(nil, nil, nil)},
+			method: http.MethodPut,
+			form:   valid,
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "read-only",
+			conf:   &Config{SLOs: slo.NewManager(nil, nil, nil), AdminAPIEnabled: true, ReadOnly: true},
+			method: http.MethodPut,
+			form:   valid,
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "no manager",
+			conf:   &Config{AdminAPIEnabled: true},
+			method: http.MethodGet,
+			code:   http.StatusServiceUnavailable,
+		},
+		{
+			name:   "invalid objective",
+			conf:   &Config{SLOs: slo.NewManager(nil, nil, nil), AdminAPIEnabled: true},
+			method: http.MethodPut,
+			form:   with("objective", "99.9"),
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "invalid window",
+			conf:   &Config{SLOs: slo.NewManager(nil, nil, nil), AdminAPIEnabled: true},
+			method: http.MethodPut,
+			form:   with("window", "a month"),
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "invalid selector",
+			conf:   &Config{SLOs: slo.NewManager(nil, nil, nil), AdminAPIEnabled: true},
+			method: http.MethodPost,
+			form:   with("good", `{code=}`),
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(c.method, "/api/v1/slos/availability", strings.NewReader(c.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			sloHandler(c.conf).ServeHTTP(w, r)
+			require.Equal(t, c.code, w.Code)
+		})
+	}
+}
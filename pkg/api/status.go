@@ -0,0 +1,137 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/metadata"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const defaultRetentionSQL = "SELECT " + schema.Catalog + ".get_default_retention_period()::text"
+
+// defaultTSDBStatusLimit is the number of items of each list of the TSDB
+// status, as in Prometheus.
+const defaultTSDBStatusLimit = 10
+
+// startTime is reported as the start time of the connector.
+var startTime = time.Now()
+
+// runtimeInfo mirrors the runtime information reported by Prometheus. The
+// fields about configuration reloads and TSDB corruptions do not apply to
+// Promscale and keep their zero values, except for the configuration time
+// which is the start time since the configuration cannot be reloaded.
+type runtimeInfo struct {
+	StartTime           time.Time `json:"startTime"`
+	CWD                 string    `json:"CWD"`
+	ReloadConfigSuccess bool      `json:"reloadConfigSuccess"`
+	LastConfigTime      time.Time `json:"lastConfigTime"`
+	CorruptionCount     int64     `json:"corruptionCount"`
+	GoroutineCount      int       `json:"goroutineCount"`
+	GOMAXPROCS          int       `json:"GOMAXPROCS"`
+	GOGC                string    `json:"GOGC"`
+	GODEBUG             string    `json:"GODEBUG"`
+	StorageRetention    string    `json:"storageRetention"`
+}
+
+// Flags returns an http.Handler reporting the values of the connector's
+// flags, with the secrets redacted.
+func Flags(conf *Config) http.Handler {
+	hf := corsWrapper(conf, flagsHandler(conf.Flags))
+	return gziphandler.GzipHandler(hf)
+}
+
+func flagsHandler(flags map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if flags == nil {
+			flags = map[string]string{}
+		}
+		respondStatus(w, flags)
+	}
+}
+
+// RuntimeInfo returns an http.Handler reporting runtime information about
+// the connector and the default retention period of the database.
+func RuntimeInfo(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, runtimeInfoHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func runtimeInfoHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := runtimeInfo{
+			StartTime:           startTime,
+			ReloadConfigSuccess: true,
+			LastConfigTime:      startTime,
+			GoroutineCount:      runtime.NumGoroutine(),
+			GOMAXPROCS:          runtime.GOMAXPROCS(0),
+			GOGC:                os.Getenv("GOGC"),
+			GODEBUG:             os.Getenv("GODEBUG"),
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			cwd = "<error retrieving current working directory>"
+		}
+		info.CWD = cwd
+
+		err = conn.QueryRow(context.Background(), defaultRetentionSQL).Scan(&info.StorageRetention)
+		if err != nil {
+			log.Error("msg", "error fetching the default retention period", "err", err)
+			respondError(w, http.StatusInternalServerError, fmt.Errorf("fetching the default retention period: %w", err), "internal")
+			return
+		}
+		respondStatus(w, info)
+	}
+}
+
+// TSDBStatus returns an http.Handler reporting the cardinality statistics of
+// the database: the total number of series, and the metrics, label names and
+// label pairs with the most series or values.
+func TSDBStatus(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, tsdbStatusHandler(conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func tsdbStatusHandler(conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := parseLimitParam(r, "limit")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if limit == 0 {
+			limit = defaultTSDBStatusLimit
+		}
+		status, err := metadata.TSDBStatusQuery(r.Context(), conn, limit)
+		if err != nil {
+			log.Error("msg", "error fetching the TSDB status", "err", err)
+			respondError(w, http.StatusInternalServerError, fmt.Errorf("fetching the TSDB status: %w", err), "internal")
+			return
+		}
+		respondStatus(w, status)
+	}
+}
+
+// respondStatus responds with the data of a status endpoint in the format
+// used by Prometheus, which clients probing these endpoints check.
+func respondStatus(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(&response{
+		Status: "success",
+		Data:   data,
+	})
+}
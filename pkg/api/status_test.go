@@ -0,0 +1,35 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagsHandler(t *testing.T) {
+	flags := map[string]string{"web-listen-address": ":9201", "db-password": "<secret>"}
+	w := httptest.NewRecorder()
+	flagsHandler(flags).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/status/flags", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Status string            `json:"status"`
+		Data   map[string]string `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	require.Equal(t, "success", res.Status)
+	require.Equal(t, flags, res.Data)
+}
+
+func TestTSDBStatusHandlerBadLimit(t *testing.T) {
+	w := httptest.NewRecorder()
+	tsdbStatusHandler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/status/tsdb?limit=-1", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,142 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/timescale/promscale/pkg/encryption"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/tail"
+)
+
+// tailKeepAliveInterval is the interval at which an SSE comment is sent to
+// keep idle connections (and intermediate proxies) from timing out.
+const tailKeepAliveInterval = 15 * time.Second
+
+// Tail returns an http.Handler that streams newly ingested samples matching
+// a selector as server-sent events.
+func Tail(conf *Config, broker *tail.Broker) http.Handler {
+	return corsWrapper(conf, tailHandler(conf, broker))
+}
+
+func tailHandler(conf *Config, broker *tail.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if broker == nil {
+			respondError(w, http.StatusNotFound, fmt.Errorf("tailing is not available in read-only mode"), "unavailable")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		matchers, err := parseTailMatchers(conf, r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported by the connection"), "internal")
+			return
+		}
+
+		dec := decryptor(conf, r)
+		sub := broker.Subscribe(matchers, tail.DefaultBufferSize)
+		defer broker.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(tailKeepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprintf(w, ": keep-alive dropped=%d\n\n", sub.Dropped()); err != nil {
+					return
+				}
+				flusher.Flush()
+			case sample, ok := <-sub.C():
+				if !ok {
+					return
+				}
+				if err := writeTailedSample(w, dec, sample); err != nil {
+					return
+				}
+				// Drain whatever is already buffered before flushing, to avoid
+				// a flush per sample under load.
+				for i := len(sub.C()); i > 0; i-- {
+					if err := writeTailedSample(w, dec, <-sub.C()); err != nil {
+						return
+					}
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// tailedSample is the payload of a sample event. The value is a string, as in
+// the query results, since JSON numbers cannot hold NaN (e.g. the stale
+// markers) or infinities.
+type tailedSample struct {
+	Labels    labels.Labels `json:"labels"`
+	Timestamp int64         `json:"timestamp"`
+	Value     string        `json:"value"`
+}
+
+// writeTailedSample writes the sample as an event. A sample that cannot be
+// marshaled is logged and skipped; only the errors writing the event are
+// returned.
+func writeTailedSample(w io.Writer, dec *encryption.LabelEncryptor, sample tail.Sample) error {
+	if dec != nil {
+		sample.Labels = dec.DecryptLabels(sample.Labels)
+	}
+	data, err := json.Marshal(tailedSample{
+		Labels:    sample.Labels,
+		Timestamp: sample.Timestamp,
+		Value:     strconv.FormatFloat(sample.Value, 'f', -1, 64),
+	})
+	if err != nil {
+		log.Error("msg", "error marshaling tailed sample", "err", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "event: sample\ndata: %s\n\n", data)
+	return err
+}
+
+func parseTailMatchers(conf *Config, r *http.Request) ([]*labels.Matcher, error) {
+	selectors := r.Form["match[]"]
+	if len(selectors) != 1 {
+		return nil, fmt.Errorf("exactly one match[] parameter must be provided")
+	}
+	matchers, err := parser.ParseMetricSelector(selectors[0])
+	if err != nil {
+		return nil, err
+	}
+	if conf.MultiTenancy != nil {
+		if rAuth := conf.MultiTenancy.ReadAuthorizer(); rAuth != nil {
+			matchers = rAuth.AppendTenantMatcher(matchers)
+		}
+	}
+	if conf.LabelEncryptor != nil {
+		// The tailed series are matched as they are ingested, encrypted.
+		return conf.LabelEncryptor.EncryptMatchers(matchers)
+	}
+	return matchers, nil
+}
@@ -0,0 +1,71 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tail"
+)
+
+func TestTailEncodesValuesAsStrings(t *testing.T) {
+	broker := tail.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	form := url.Values{"match[]": {`up{job="api"}`}}
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/tail?"+form.Encode(), nil).WithContext(ctx)
+	w := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tailHandler(&Config{}, broker).ServeHTTP(w, r)
+	}()
+	require.Eventually(t, broker.HasSubscribers, time.Second, time.Millisecond)
+
+	lbls := []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}
+	broker.Publish(lbls, []prompb.Sample{
+		{Timestamp: 1000, Value: 1},
+		{Timestamp: 2000, Value: math.Float64frombits(value.StaleNaN)},
+		{Timestamp: 3000, Value: math.Inf(1)},
+	})
+
+	expected := "event: sample\n" + `data: {"labels":{"__name__":"up","job":"api"},"timestamp":1000,"value":"1"}` + "\n\n" +
+		"event: sample\n" + `data: {"labels":{"__name__":"up","job":"api"},"timestamp":2000,"value":"NaN"}` + "\n\n" +
+		"event: sample\n" + `data: {"labels":{"__name__":"up","job":"api"},"timestamp":3000,"value":"+Inf"}` + "\n\n"
+	require.Eventually(t, func() bool { return w.String() == expected }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+// lockedRecorder is a response recorder whose body can be read while the
+// handler is writing it.
+type lockedRecorder struct {
+	*httptest.ResponseRecorder
+	mux sync.Mutex
+}
+
+func (r *lockedRecorder) Write(b []byte) (int, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.ResponseRecorder.Write(b)
+}
+
+func (r *lockedRecorder) String() string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.Body.String()
+}
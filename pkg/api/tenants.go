@@ -0,0 +1,293 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/route"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type tenantResponse struct {
+	Name               string    `json:"name"`
+	Disabled           bool      `json:"disabled"`
+	MaxSamplesPerWrite int64     `json:"maxSamplesPerWrite,omitempty"`
+	RetentionPeriod    string    `json:"retentionPeriod,omitempty"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+	// Token is only set when the token is created, since only its hash is
+	// stored.
+	Token string `json:"token,omitempty"`
+}
+
+func newTenantResponse(t tenancy.Tenant) tenantResponse {
+	res := tenantResponse{
+		Name:               t.Name,
+		Disabled:           t.Disabled,
+		MaxSamplesPerWrite: t.MaxSamplesPerWrite,
+		CreatedAt:          t.CreatedAt,
+		UpdatedAt:          t.UpdatedAt,
+	}
+	if t.RetentionPeriod > 0 {
+		res.RetentionPeriod = model.Duration(t.RetentionPeriod).String()
+	}
+	return res
+}
+
+// Tenants returns an http.Handler listing and creating the tenants managed
+// in the catalog.
+func Tenants(conf *Config) http.Handler {
+	hf := corsWrapper(conf, tenantsHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func tenantsHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTenantAdmin(w, r, conf) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			tenants := conf.Tenants.List()
+			res := make([]tenantResponse, 0, len(tenants))
+			for _, t := range tenants {
+				res = append(res, newTenantResponse(t))
+			}
+			respond(w, http.StatusOK, res)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		name := r.FormValue("name")
+		if name == "" {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("no name parameter provided"), "bad_data")
+			return
+		}
+		settings, err := parseTenantSettings(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		token, err := conf.Tenants.Create(name, settings)
+		if err != nil {
+			respondTenantError(w, err)
+			return
+		}
+		log.Info("msg", "tenant created", "tenant", name)
+		respondTenant(w, conf.Tenants, name, token)
+	}
+}
+
+// Tenant returns an http.Handler updating the settings of a tenant managed
+// in the catalog.
+func Tenant(conf *Config) http.Handler {
+	hf := corsWrapper(conf, tenantHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func tenantHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTenantAdmin(w, r, conf) {
+			return
+		}
+		name := route.Param(r.Context(), "name")
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		settings, err := parseTenantSettings(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if err = conf.Tenants.Update(name, settings); err != nil {
+			respondTenantError(w, err)
+			return
+		}
+		log.Info("msg", "tenant updated", "tenant", name)
+		respondTenant(w, conf.Tenants, name, "")
+	}
+}
+
+// RotateTenantToken returns an http.Handler replacing the token of a tenant
+// managed in the catalog.
+func RotateTenantToken(conf *Config) http.Handler {
+	hf := corsWrapper(conf, rotateTenantTokenHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func rotateTenantTokenHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTenantAdmin(w, r, conf) {
+			return
+		}
+		name := route.Param(r.Context(), "name")
+		token, err := conf.Tenants.RotateToken(name)
+		if err != nil {
+			respondTenantError(w, err)
+			return
+		}
+		log.Info("msg", "tenant token rotated", "tenant", name)
+		respondTenant(w, conf.Tenants, name, token)
+	}
+}
+
+type tenantPurgeResponse struct {
+	Tenant        string     `json:"tenant"`
+	Status        string     `json:"status"`
+	RequestedAt   time.Time  `json:"requestedAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	MetricsTotal  int        `json:"metricsTotal"`
+	MetricsDone   int        `json:"metricsDone"`
+	SeriesDeleted int64      `json:"seriesDeleted"`
+	RowsDeleted   int64      `json:"rowsDeleted"`
+	// Verification is only set once all the metrics were processed.
+	Verification *tenantPurgeVerification `json:"verification,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+}
+
+type tenantPurgeVerification struct {
+	LiveSeries    int64 `json:"liveSeries"`
+	RemainingRows int64 `json:"remainingRows"`
+}
+
+func newTenantPurgeResponse(p tenancy.Purge) tenantPurgeResponse {
+	res := tenantPurgeResponse{
+		Tenant:        p.Tenant,
+		Status:        p.Status,
+		RequestedAt:   p.RequestedAt,
+		FinishedAt:    p.FinishedAt,
+		MetricsTotal:  p.MetricsTotal,
+		MetricsDone:   p.MetricsDone,
+		SeriesDeleted: p.SeriesDeleted,
+		RowsDeleted:   p.RowsDeleted,
+		Error:         p.Error,
+	}
+	if p.LiveSeries != nil && p.RemainingRows != nil {
+		res.Verification = &tenantPurgeVerification{LiveSeries: *p.LiveSeries, RemainingRows: *p.RemainingRows}
+	}
+	return res
+}
+
+// DeleteTenant returns an http.Handler disabling a tenant managed in the
+// catalog and starting the purge of all its data. The tenant is deleted once
+// the purge completed.
+func DeleteTenant(conf *Config) http.Handler {
+	hf := corsWrapper(conf, deleteTenantHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func deleteTenantHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTenantAdmin(w, r, conf) {
+			return
+		}
+		name := route.Param(r.Context(), "name")
+		purge, err := conf.Tenants.Delete(name)
+		if err != nil {
+			respondTenantError(w, err)
+			return
+		}
+		log.Info("msg", "tenant purge requested", "tenant", name)
+		respond(w, http.StatusAccepted, newTenantPurgeResponse(purge))
+	}
+}
+
+// TenantPurge returns an http.Handler reporting the progress of the purge of
+// a tenant.
+func TenantPurge(conf *Config) http.Handler {
+	hf := corsWrapper(conf, tenantPurgeHandler(conf))
+	return gziphandler.GzipHandler(hf)
+}
+
+func tenantPurgeHandler(conf *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkTenantAdmin(w, r, conf) {
+			return
+		}
+		purge, err := conf.Tenants.GetPurge(route.Param(r.Context(), "name"))
+		if err != nil {
+			respondTenantError(w, err)
+			return
+		}
+		respond(w, http.StatusOK, newTenantPurgeResponse(purge))
+	}
+}
+
+// checkTenantAdmin responds with an error if the tenants cannot be managed.
+// Listing the tenants is allowed in read-only mode.
+func checkTenantAdmin(w http.ResponseWriter, r *http.Request, conf *Config) bool {
+	if conf.Tenants == nil {
+		respondError(w, http.StatusForbidden, fmt.Errorf("tenant management requires -multi-tenancy-valid-tenants=%s", tenancy.CatalogTenants), "operation_not_permitted")
+		return false
+	}
+	if !conf.AdminAPIEnabled {
+		respondError(w, http.StatusForbidden, fmt.Errorf("tenant management requires admin permissions. Use -web-enable-admin-api flag to allow it"), "operation_not_permitted")
+		return false
+	}
+	if conf.ReadOnly && r.Method != http.MethodGet {
+		respondError(w, http.StatusForbidden, fmt.Errorf("read-only connector cannot modify tenants"), "operation_not_permitted")
+		return false
+	}
+	return true
+}
+
+func parseTenantSettings(r *http.Request) (settings tenancy.TenantSettings, err error) {
+	if s := r.FormValue("disabled"); s != "" {
+		disabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return settings, fmt.Errorf("invalid disabled: %w", err)
+		}
+		settings.Disabled = &disabled
+	}
+	if s := r.FormValue("max_samples_per_write"); s != "" {
+		maxSamples, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || maxSamples < 0 {
+			return settings, fmt.Errorf("invalid max_samples_per_write %q, must be a positive number or 0 for no limit", s)
+		}
+		settings.MaxSamplesPerWrite = &maxSamples
+	}
+	if s := r.FormValue("retention_period"); s != "" {
+		retention, err := parseDuration(s)
+		if err != nil || retention < 0 {
+			return settings, fmt.Errorf("invalid retention_period %q, must be a positive duration or 0 for the metric retention", s)
+		}
+		settings.RetentionPeriod = &retention
+	}
+	return settings, nil
+}
+
+func respondTenant(w http.ResponseWriter, store *tenancy.Store, name, token string) {
+	t, ok := store.Get(name)
+	if !ok {
+		respondTenantError(w, tenancy.ErrTenantNotFound)
+		return
+	}
+	res := newTenantResponse(t)
+	res.Token = token
+	respond(w, http.StatusOK, res)
+}
+
+func respondTenantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tenancy.ErrTenantNotFound):
+		respondError(w, http.StatusNotFound, err, "not_found")
+	case errors.Is(err, tenancy.ErrTenantExists):
+		respondError(w, http.StatusConflict, err, "conflict")
+	default:
+		log.Error("msg", "error managing tenants", "err", err)
+		respondError(w, http.StatusInternalServerError, err, "internal")
+	}
+}
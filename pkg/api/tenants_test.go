@@ -0,0 +1,49 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+func TestCheckTenantAdmin(t *testing.T) {
+	testCases := []struct {
+		name   string
+		conf   *Config
+		method string
+		ok     bool
+	}{
+		{name: "no catalog tenants", conf: &Config{AdminAPIEnabled: true}, method: http.MethodGet},
+		{name: "admin API disabled", conf: &Config{Tenants: tenancy.NewStore()}, method: http.MethodGet},
+		{name: "read-only delete", conf: &Config{Tenants: tenancy.NewStore(), AdminAPIEnabled: true, ReadOnly: true}, method: http.MethodDelete},
+		{name: "read-only purge progress", conf: &Config{Tenants: tenancy.NewStore(), AdminAPIEnabled: true, ReadOnly: true}, method: http.MethodGet, ok: true},
+		{name: "delete", conf: &Config{Tenants: tenancy.NewStore(), AdminAPIEnabled: true}, method: http.MethodDelete, ok: true},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ok := checkTenantAdmin(w, httptest.NewRequest(c.method, "/api/v1/admin/tenants/tenant-a", nil), c.conf)
+			require.Equal(t, c.ok, ok)
+			if !ok {
+				require.Equal(t, http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
+
+func TestNewTenantPurgeResponse(t *testing.T) {
+	res := newTenantPurgeResponse(tenancy.Purge{Tenant: "tenant-a", Status: "running", MetricsTotal: 3, MetricsDone: 1})
+	require.Nil(t, res.Verification, "verification must only be reported once it was done")
+
+	var liveSeries, remainingRows int64 = 0, 0
+	res = newTenantPurgeResponse(tenancy.Purge{Tenant: "tenant-a", Status: "completed", LiveSeries: &liveSeries, RemainingRows: &remainingRows})
+	require.Equal(t, &tenantPurgeVerification{}, res.Verification)
+}
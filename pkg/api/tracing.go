@@ -0,0 +1,57 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/opentracing-contrib/go-stdlib/nethttp"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/uber/jaeger-client-go"
+)
+
+// traceIDHeader is the header of the responses of the traced requests that
+// holds the ID of their trace.
+const traceIDHeader = "X-Trace-Id"
+
+// traceHandler traces the requests of the handler with the global tracer,
+// as the operation name, and returns the ID of their trace in the
+// traceIDHeader header.
+func traceHandler(name string, h http.HandlerFunc) http.HandlerFunc {
+	withHeader := func(w http.ResponseWriter, r *http.Request) {
+		if id := traceID(r.Context()); id != "" {
+			w.Header().Set(traceIDHeader, id)
+		}
+		h(w, r)
+	}
+	return nethttp.MiddlewareFunc(opentracing.GlobalTracer(), withHeader, nethttp.OperationNameFunc(func(*http.Request) string {
+		return name
+	}))
+}
+
+// traceID returns the ID of the trace of the request of the context, "" if
+// it is not traced or its trace is not sampled.
+func traceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	if spanCtx, ok := span.Context().(jaeger.SpanContext); ok && spanCtx.IsSampled() {
+		return spanCtx.TraceID().String()
+	}
+	return ""
+}
+
+// withTraceWarning adds the ID of the trace of the query to its warnings,
+// so that the trace of a slow panel of a dashboard can be looked up from it.
+func withTraceWarning(ctx context.Context, warnings storage.Warnings) storage.Warnings {
+	if id := traceID(ctx); id != "" {
+		return append(warnings, fmt.Errorf("trace ID: %s", id))
+	}
+	return warnings
+}
@@ -0,0 +1,55 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestTraceHandler(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sampled bool
+	}{
+		{name: "sampled", sampled: true},
+		{name: "not sampled"},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			reporter := jaeger.NewInMemoryReporter()
+			tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(c.sampled), reporter)
+			defer closer.Close()
+			opentracing.SetGlobalTracer(tracer)
+			defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+			var warnings storage.Warnings
+			h := traceHandler("query", func(w http.ResponseWriter, r *http.Request) {
+				warnings = withTraceWarning(r.Context(), nil)
+			})
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("GET", "/api/v1/query", nil))
+
+			id := w.Header().Get(traceIDHeader)
+			if !c.sampled {
+				require.Empty(t, id)
+				require.Empty(t, warnings)
+				return
+			}
+			require.NotEmpty(t, id)
+			require.Len(t, warnings, 1)
+			require.EqualError(t, warnings[0], "trace ID: "+id)
+			spans := reporter.GetSpans()
+			require.Len(t, spans, 1)
+			require.Equal(t, "query", spans[0].(*jaeger.Span).OperationName())
+		})
+	}
+}
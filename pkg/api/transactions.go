@@ -0,0 +1,89 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/common/route"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/twophase"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+var errTransactionsNotPermitted = fmt.Errorf("resolving prepared transactions requires admin permissions. Use -web-enable-admin-api flag to allow it")
+
+// Transactions returns an http.Handler listing the transactions of the
+// tenant of the tenant parameter prepared by the connectors that are not
+// committed nor rolled back yet, for transaction managers to resolve them
+// after a failure. Without the parameter, the transactions of the series
+// without tenant are listed.
+func Transactions(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, transactionsHandler(conf, conn))
+	return gziphandler.GzipHandler(hf)
+}
+
+func transactionsHandler(conf *Config, conn pgxconn.PgxConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, errTransactionsNotPermitted, "operation_not_permitted")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		data, err := twophase.List(conn, r.FormValue("tenant"))
+		if err != nil {
+			log.Error("msg", "error fetching the prepared transactions", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "fetching transactions")
+			return
+		}
+		respond(w, http.StatusOK, data)
+	}
+}
+
+// CommitTransaction returns an http.Handler committing the transaction of
+// the tenant of the tenant parameter prepared under the id parameter.
+func CommitTransaction(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, finishTransactionHandler(conf, conn, twophase.Commit))
+	return gziphandler.GzipHandler(hf)
+}
+
+// RollbackTransaction returns an http.Handler rolling back the transaction
+// of the tenant of the tenant parameter prepared under the id parameter.
+func RollbackTransaction(conf *Config, conn pgxconn.PgxConn) http.Handler {
+	hf := corsWrapper(conf, finishTransactionHandler(conf, conn, twophase.Rollback))
+	return gziphandler.GzipHandler(hf)
+}
+
+func finishTransactionHandler(conf *Config, conn pgxconn.PgxConn, finish func(pgxconn.PgxConn, string, string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, errTransactionsNotPermitted, "operation_not_permitted")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		id := route.Param(r.Context(), "id")
+		err := finish(conn, r.FormValue("tenant"), id)
+		switch {
+		case err == nil:
+			respond(w, http.StatusOK, nil)
+		case errors.Is(err, twophase.ErrInvalidID):
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+		case errors.Is(err, twophase.ErrNotFound):
+			respondError(w, http.StatusNotFound, err, "not_found")
+		default:
+			log.Error("msg", "error finishing the prepared transaction", "id", id, "err", err)
+			respondError(w, http.StatusInternalServerError, err, "finishing transaction")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/route"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/twophase"
+)
+
+func TestTransactionsAdmin(t *testing.T) {
+	conf := &Config{}
+	mock := model.NewSqlRecorder(nil, t)
+	do := func(h http.HandlerFunc, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/"+id+"/commit?tenant=team-a", nil)
+		r = r.WithContext(route.WithParam(r.Context(), "id", id))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusForbidden, do(transactionsHandler(conf, mock), "").Code)
+	require.Equal(t, http.StatusForbidden, do(finishTransactionHandler(conf, mock, twophase.Commit), "tx").Code)
+
+	conf.AdminAPIEnabled = true
+	require.Equal(t, http.StatusBadRequest, do(finishTransactionHandler(conf, mock, twophase.Rollback), "it's").Code)
+}
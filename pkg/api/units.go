@@ -0,0 +1,28 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/timescale/promscale/pkg/query"
+	"github.com/timescale/promscale/pkg/units"
+)
+
+// unitQuery returns the context to evaluate the query with, and whether it
+// converts the values of the metrics, which it does when the unit parameter
+// is set.
+func unitQuery(ctx context.Context, r *http.Request) (context.Context, bool, error) {
+	unit := r.FormValue("unit")
+	if unit == "" {
+		return ctx, false, nil
+	}
+	if !units.Known(unit) {
+		return nil, false, fmt.Errorf("invalid unit parameter: unknown unit %q", unit)
+	}
+	return query.WithUnit(ctx, unit), true, nil
+}
@@ -6,11 +6,13 @@ package api
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -18,10 +20,32 @@ import (
 	"github.com/golang/snappy"
 	"github.com/timescale/promscale/pkg/api/parser"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pause"
 	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgmodel/twophase"
+	"github.com/timescale/promscale/pkg/prompb"
 	"github.com/timescale/promscale/pkg/util"
 )
 
+// sortedLabelsHeader is set to true by senders guaranteeing that the labels
+// of each series are sorted by name and free of duplicate names, as
+// Prometheus does, so that they are not sorted and validated again.
+const sortedLabelsHeader = "X-Promscale-Sorted-Labels"
+
+// Consumers of replayable sources, e.g. Kafka topic partitions or disk WALs,
+// send the partition and the offset of the last record in the request in
+// these headers to have the offset checkpointed once the samples are
+// committed.
+const (
+	checkpointSourceHeader = "X-Promscale-Source"
+	checkpointOffsetHeader = "X-Promscale-Source-Offset"
+)
+
+// transactionIDHeader has the request ingested in a transaction prepared
+// under its value, for an external transaction manager to commit or roll
+// back through the transactions endpoints.
+const transactionIDHeader = "X-Promscale-Transaction-Id"
+
 type writeStage func(http.ResponseWriter, *http.Request) bool
 
 type writeHandler struct {
@@ -47,12 +71,15 @@ func (wh *writeHandler) handler() http.Handler {
 	})
 }
 
-// Write returns an http.Handler that is responsible for data ingest.
-func Write(inserter ingestor.DBInserter, dataParser *parser.DefaultParser, elector *util.Elector) http.Handler {
+// Write returns an http.Handler that is responsible for data ingest. If signingKeys
+// is not empty, requests must be signed with the key of their tenant, and if
+// maxSkew is positive, signed requests are protected against replays.
+func Write(inserter ingestor.DBInserter, dataParser *parser.DefaultParser, elector *util.Elector, signingKeys map[string][]byte, maxSkew time.Duration) http.Handler {
 	wh := writeHandler{}
 	wh.addStages(
 		validateWriteHeaders,
 		checkLegacyHA(elector),
+		verifySignature(signingKeys, newReplayGuard(maxSkew)),
 		decodeSnappy,
 		ingest(inserter, dataParser),
 	)
@@ -90,7 +117,7 @@ func validateWriteHeaders(w http.ResponseWriter, r *http.Request) bool {
 		}
 	case "application/json":
 		// Don't need any other header checks for JSON content type.
-	case "text/plain", "application/openmetrics":
+	case "text/plain", openMetricsContentType:
 		// Don't need any other header checks for text content type.
 	default:
 		validateError(w, "unsupported data format (not protobuf, JSON, or text format)", metrics)
@@ -190,42 +217,123 @@ func ingest(inserter ingestor.DBInserter, dataParser *parser.DefaultParser) func
 		err := dataParser.ParseRequest(r, req)
 		if err != nil {
 			ingestor.FinishWriteRequest(req)
-			invalidRequestError(w, "parser error", err.Error(), metrics)
+			parseError(w, err, metrics)
 			return false
 		}
+		return insertRequest(w, r, inserter, req)
+	}
+}
 
-		// if samples in write request are empty the we do not need to
-		// proceed further
-		if len(req.Timeseries) == 0 && len(req.Metadata) == 0 {
+// insertRequest ingests the parsed write request, which it takes ownership
+// of, and checkpoints the offset of its source once it is committed.
+func insertRequest(w http.ResponseWriter, r *http.Request, inserter ingestor.DBInserter, req *prompb.WriteRequest) bool {
+	source, offset, err := checkpointHeaders(r)
+	if err != nil {
+		ingestor.FinishWriteRequest(req)
+		invalidRequestError(w, "checkpoint headers", err.Error(), metrics)
+		return false
+	}
+	if txID := r.Header.Get(transactionIDHeader); txID != "" {
+		if source != "" {
 			ingestor.FinishWriteRequest(req)
+			invalidRequestError(w, "transaction headers", fmt.Sprintf("%s cannot be set with %s", transactionIDHeader, checkpointSourceHeader), metrics)
 			return false
 		}
+		return prepareRequest(w, inserter, txID, req)
+	}
+	committer, isCommitter := inserter.(ingestor.CheckpointCommitter)
+	if source != "" && isCommitter && !committer.CommitsDurably(req) {
+		// The checkpoint would be stored before the samples are durable,
+		// and a crash would then skip past them.
+		ingestor.FinishWriteRequest(req)
+		invalidRequestError(w, "checkpoint headers", fmt.Sprintf("%s cannot be set when the samples are acknowledged or committed asynchronously", checkpointSourceHeader), metrics)
+		return false
+	}
+
+	// if samples in write request are empty the we do not need to
+	// proceed further
+	if len(req.Timeseries) == 0 && len(req.Metadata) == 0 {
+		ingestor.FinishWriteRequest(req)
+		return false
+	}
 
-		var receivedSamplesCount, receivedMetadataCount int64
+	var receivedSamplesCount, receivedMetadataCount int64
 
-		for _, ts := range req.Timeseries {
-			receivedSamplesCount += int64(len(ts.Samples))
-		}
-		receivedMetadataCount += int64(len(req.Metadata))
+	for _, ts := range req.Timeseries {
+		receivedSamplesCount += int64(len(ts.Samples))
+	}
+	receivedMetadataCount += int64(len(req.Metadata))
 
-		metrics.ReceivedSamples.Add(float64(receivedSamplesCount))
-		begin := time.Now()
+	metrics.ReceivedSamples.Add(float64(receivedSamplesCount))
+	begin := time.Now()
 
-		numSamples, numMetadata, err := inserter.Ingest(req)
-		if err != nil {
-			log.Warn("msg", "Error sending samples to remote storage", "err", err, "num_samples", numSamples)
+	insert := inserter.Ingest
+	if sorted, ok := inserter.(ingestor.SortedLabelsInserter); ok && hasSortedLabels(r) {
+		insert = sorted.IngestSorted
+	}
+	numSamples, numMetadata, err := insert(req)
+	if err != nil {
+		log.Warn("msg", "Error sending samples to remote storage", "err", err, "num_samples", numSamples)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		metrics.FailedSamples.Add(float64(uint64(receivedSamplesCount) - numSamples))
+		metrics.FailedMetadata.Add(float64(uint64(receivedMetadataCount) - numMetadata))
+		return false
+	}
+
+	duration := time.Since(begin).Seconds()
+	metrics.SentSamples.Add(float64(numSamples))
+	metrics.SentMetadata.Add(float64(numMetadata))
+	metrics.SentBatchDuration.Observe(duration)
+
+	if isCommitter && source != "" {
+		// The samples are in, but the consumer must not move past them
+		// until the checkpoint is, replaying them at worst.
+		if err = committer.CommitCheckpoint(source, offset); err != nil {
+			log.Warn("msg", "Error committing the checkpoint of the source", "source", source, "offset", offset, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			metrics.FailedSamples.Add(float64(uint64(receivedSamplesCount) - numSamples))
-			metrics.FailedMetadata.Add(float64(uint64(receivedMetadataCount) - numMetadata))
 			return false
 		}
+	}
+	return true
+}
 
-		duration := time.Since(begin).Seconds()
-		metrics.SentSamples.Add(float64(numSamples))
-		metrics.SentMetadata.Add(float64(numMetadata))
-		metrics.SentBatchDuration.Observe(duration)
-		return true
+// prepareRequest ingests the samples of the request in a transaction
+// prepared under id.
+func prepareRequest(w http.ResponseWriter, inserter ingestor.DBInserter, id string, req *prompb.WriteRequest) bool {
+	preparer, ok := inserter.(ingestor.TransactionPreparer)
+	if !ok {
+		ingestor.FinishWriteRequest(req)
+		invalidRequestError(w, "transaction headers", "prepared transactions are not supported", metrics)
+		return false
+	}
+
+	var receivedSamplesCount int64
+	for _, ts := range req.Timeseries {
+		receivedSamplesCount += int64(len(ts.Samples))
 	}
+	metrics.ReceivedSamples.Add(float64(receivedSamplesCount))
+	begin := time.Now()
+
+	numSamples, err := preparer.PrepareTransaction(id, req)
+	switch {
+	case err == nil:
+	case errors.Is(err, twophase.ErrInvalidID), errors.Is(err, twophase.ErrMixedTenants), errors.Is(err, ingestor.ErrTwoPhaseCommitDisabled):
+		invalidRequestError(w, "transaction headers", err.Error(), metrics)
+		return false
+	default:
+		log.Warn("msg", "Error preparing the transaction of the samples", "id", id, "err", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, twophase.ErrExists) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		metrics.FailedSamples.Add(float64(receivedSamplesCount))
+		return false
+	}
+
+	metrics.SentSamples.Add(float64(numSamples))
+	metrics.SentBatchDuration.Observe(time.Since(begin).Seconds())
+	return true
 }
 
 func invalidRequestError(w http.ResponseWriter, msg, err string, m *Metrics) {
@@ -234,6 +342,18 @@ func invalidRequestError(w http.ResponseWriter, msg, err string, m *Metrics) {
 	m.InvalidWriteReqs.Inc()
 }
 
+// parseError responds to a write request that could not be parsed or
+// preprocessed, with a 503 status when its ingestion is paused so that it is
+// retried once resumed.
+func parseError(w http.ResponseWriter, err error, m *Metrics) {
+	if errors.Is(err, pause.ErrPaused) {
+		log.WarnRateLimited("msg", "Write request rejected", "err", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	invalidRequestError(w, "parser error", err.Error(), m)
+}
+
 func validateError(w http.ResponseWriter, err string, metrics *Metrics) {
 	invalidRequestError(w, "Write header validation error", err, metrics)
 }
@@ -252,3 +372,26 @@ func detectSnappyStreamFormat(input []byte) bool {
 
 	return true
 }
+
+func hasSortedLabels(r *http.Request) bool {
+	sorted, err := strconv.ParseBool(r.Header.Get(sortedLabelsHeader))
+	return err == nil && sorted
+}
+
+// checkpointHeaders returns the source and offset to checkpoint after the
+// request is committed, an empty source if there is none.
+func checkpointHeaders(r *http.Request) (string, int64, error) {
+	source := r.Header.Get(checkpointSourceHeader)
+	offsetStr := r.Header.Get(checkpointOffsetHeader)
+	if source == "" && offsetStr == "" {
+		return "", 0, nil
+	}
+	if source == "" || offsetStr == "" {
+		return "", 0, fmt.Errorf("%s and %s must be set together", checkpointSourceHeader, checkpointOffsetHeader)
+	}
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid %s: %w", checkpointOffsetHeader, err)
+	}
+	return source, offset, nil
+}
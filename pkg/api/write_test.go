@@ -231,6 +231,16 @@ func TestWrite(t *testing.T) {
 				"Content-Encoding": "snappy",
 			},
 		},
+		{
+			name:             "happy path OpenMetrics",
+			isLeader:         true,
+			responseCode:     http.StatusOK,
+			inserterResponse: 1,
+			requestBody:      "test_metric 1 1395066363.5\n# EOF\n",
+			customHeaders: map[string]string{
+				"Content-Type": "application/openmetrics-text; version=1.0.0",
+			},
+		},
 	}
 
 	for _, c := range testCases {
@@ -267,7 +277,7 @@ func TestWrite(t *testing.T) {
 				InvalidWriteReqs:  invalidWriteReqs,
 			}
 
-			handler := Write(mock, dataParser, elector)
+			handler := Write(mock, dataParser, elector, nil, 0)
 
 			headers := protobufHeaders
 			if len(c.customHeaders) != 0 {
@@ -430,3 +440,124 @@ func (m *mockMetric) Sub(f float64) {
 func (m *mockMetric) SetToCurrentTime() {
 	panic("implement me")
 }
+
+func TestCheckpointHeaders(t *testing.T) {
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		source  string
+		offset  int64
+		invalid bool
+	}{
+		{name: "no checkpoint"},
+		{
+			name:    "checkpoint",
+			headers: map[string]string{checkpointSourceHeader: "metrics/3", checkpointOffsetHeader: "1024"},
+			source:  "metrics/3",
+			offset:  1024,
+		},
+		{
+			name:    "source without offset",
+			headers: map[string]string{checkpointSourceHeader: "metrics/3"},
+			invalid: true,
+		},
+		{
+			name:    "offset without source",
+			headers: map[string]string{checkpointOffsetHeader: "1024"},
+			invalid: true,
+		},
+		{
+			name:    "invalid offset",
+			headers: map[string]string{checkpointSourceHeader: "metrics/3", checkpointOffsetHeader: "latest"},
+			invalid: true,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, "/write", nil)
+			require.NoError(t, err)
+			for k, v := range c.headers {
+				r.Header.Set(k, v)
+			}
+			source, offset, err := checkpointHeaders(r)
+			if c.invalid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.source, source)
+			require.Equal(t, c.offset, offset)
+		})
+	}
+}
+
+type mockCheckpointCommitter struct {
+	mockInserter
+	durable    bool
+	checkpoint string
+}
+
+func (m *mockCheckpointCommitter) CommitsDurably(*prompb.WriteRequest) bool {
+	return m.durable
+}
+
+func (m *mockCheckpointCommitter) CommitCheckpoint(source string, offset int64) error {
+	m.checkpoint = fmt.Sprintf("%s@%d", source, offset)
+	return nil
+}
+
+func TestWriteCheckpoint(t *testing.T) {
+	require.NoError(t, log.Init(log.Config{
+		Level: "debug",
+	}))
+	metrics = &Metrics{
+		LeaderGauge:       &mockMetric{},
+		ReceivedSamples:   &mockMetric{},
+		ReceivedMetadata:  &mockMetric{},
+		FailedSamples:     &mockMetric{},
+		FailedMetadata:    &mockMetric{},
+		SentSamples:       &mockMetric{},
+		SentMetadata:      &mockMetric{},
+		SentBatchDuration: &mockMetric{},
+		InvalidWriteReqs:  &mockMetric{},
+	}
+	body := writeRequestToString(&prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{Samples: []prompb.Sample{{}}}},
+	})
+
+	testCases := []struct {
+		name         string
+		durable      bool
+		responseCode int
+		checkpoint   string
+	}{
+		{
+			name:         "durable commit",
+			durable:      true,
+			responseCode: http.StatusOK,
+			checkpoint:   "metrics/3@1024",
+		},
+		{
+			name:         "asynchronous commit",
+			responseCode: http.StatusBadRequest,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := &mockCheckpointCommitter{mockInserter: mockInserter{result: 1}, durable: c.durable}
+			elector := util.NewElector(&mockElection{isLeader: true})
+			handler := Write(mock, parser.NewParser(), elector, nil, 0)
+			test := GenerateWriteHandleTester(t, handler, map[string]string{
+				"Content-Encoding":                  "snappy",
+				"Content-Type":                      "application/x-protobuf",
+				"X-Prometheus-Remote-Write-Version": "0.1.0",
+				checkpointSourceHeader:              "metrics/3",
+				checkpointOffsetHeader:              "1024",
+			})
+
+			w := test("POST", getReader(body))
+			require.Equal(t, c.responseCode, w.Code)
+			require.Equal(t, c.checkpoint, mock.checkpoint)
+		})
+	}
+}
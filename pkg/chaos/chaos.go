@@ -0,0 +1,69 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package chaos provides fault injection hooks for the ingest and query paths.
+// Faults can only be injected in binaries built with the `chaos` build tag;
+// in regular builds all hooks are no-ops.
+package chaos
+
+import (
+	"fmt"
+	"time"
+)
+
+// Point identifies a location in the code where faults can be injected.
+type Point string
+
+const (
+	// Ingest is hit once per batch of samples sent to the database.
+	Ingest Point = "ingest"
+	// Query is hit once per data query sent to the database.
+	Query Point = "query"
+)
+
+var (
+	// ErrDropped is returned by Inject when the operation should be silently
+	// skipped, e.g. a batch dropped without reporting an error.
+	ErrDropped = fmt.Errorf("chaos: dropped")
+	// ErrInjected is returned by Inject when the operation should fail as
+	// if the SQL statement had failed.
+	ErrInjected = fmt.Errorf("chaos: injected SQL failure")
+	// ErrNotEnabled is returned when configuring faults in a binary built
+	// without the chaos build tag.
+	ErrNotEnabled = fmt.Errorf("fault injection is not available, rebuild with the 'chaos' build tag")
+)
+
+// Faults describes the faults injected at a single point. Probabilities
+// are in the [0, 1] range.
+type Faults struct {
+	Latency            time.Duration `json:"latency"`
+	LatencyProbability float64       `json:"latency_probability"`
+	DropProbability    float64       `json:"drop_probability"`
+	ErrorProbability   float64       `json:"error_probability"`
+}
+
+// Validate checks that the probabilities are in range.
+func (f Faults) Validate() error {
+	for name, p := range map[string]float64{
+		"latency_probability": f.LatencyProbability,
+		"drop_probability":    f.DropProbability,
+		"error_probability":   f.ErrorProbability,
+	} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("invalid %s %v, must be between 0 and 1", name, p)
+		}
+	}
+	if f.Latency < 0 {
+		return fmt.Errorf("invalid latency %v, must be positive", f.Latency)
+	}
+	return nil
+}
+
+func validPoint(p Point) error {
+	switch p {
+	case Ingest, Query:
+		return nil
+	}
+	return fmt.Errorf("unknown fault injection point %q", p)
+}
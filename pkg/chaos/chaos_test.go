@@ -0,0 +1,40 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultsValidate(t *testing.T) {
+	require.NoError(t, Faults{Latency: time.Second, LatencyProbability: 1, DropProbability: 0.5}.Validate())
+	require.Error(t, Faults{DropProbability: 1.5}.Validate())
+	require.Error(t, Faults{ErrorProbability: -1}.Validate())
+	require.Error(t, Faults{Latency: -time.Second}.Validate())
+}
+
+func TestInject(t *testing.T) {
+	defer Reset()
+	require.NoError(t, Inject(Ingest))
+
+	err := Set(Ingest, Faults{ErrorProbability: 1})
+	if !Enabled() {
+		require.Equal(t, ErrNotEnabled, err)
+		require.NoError(t, Inject(Ingest))
+		return
+	}
+	require.NoError(t, err)
+	require.Equal(t, ErrInjected, Inject(Ingest))
+	require.NoError(t, Inject(Query))
+
+	require.NoError(t, Set(Query, Faults{DropProbability: 1}))
+	require.Equal(t, ErrDropped, Inject(Query))
+	require.Len(t, Get(), 2)
+
+	require.Error(t, Set(Point("unknown"), Faults{}))
+}
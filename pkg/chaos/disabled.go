@@ -0,0 +1,30 @@
+// +build !chaos
+
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package chaos
+
+// Enabled reports whether the binary was built with fault injection support.
+func Enabled() bool {
+	return false
+}
+
+// Inject is a no-op without the chaos build tag.
+func Inject(Point) error {
+	return nil
+}
+
+// Set always fails without the chaos build tag.
+func Set(Point, Faults) error {
+	return ErrNotEnabled
+}
+
+// Reset is a no-op without the chaos build tag.
+func Reset() {}
+
+// Get returns no faults without the chaos build tag.
+func Get() map[Point]Faults {
+	return map[Point]Faults{}
+}
@@ -0,0 +1,83 @@
+// +build chaos
+
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package chaos
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/timescale/promscale/pkg/log"
+)
+
+var (
+	mux    sync.RWMutex
+	faults = map[Point]Faults{}
+)
+
+func init() {
+	log.Warn("msg", "Binary built with fault injection support, do not use in production")
+}
+
+// Enabled reports whether the binary was built with fault injection support.
+func Enabled() bool {
+	return true
+}
+
+// Inject applies the faults configured for the point. It may sleep, and
+// returns ErrDropped or ErrInjected if the operation should not proceed.
+func Inject(p Point) error {
+	mux.RLock()
+	f, ok := faults[p]
+	mux.RUnlock()
+	if !ok {
+		return nil
+	}
+	if f.Latency > 0 && rand.Float64() < f.LatencyProbability {
+		time.Sleep(f.Latency)
+	}
+	if rand.Float64() < f.DropProbability {
+		return ErrDropped
+	}
+	if rand.Float64() < f.ErrorProbability {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Set replaces the faults injected at the point.
+func Set(p Point, f Faults) error {
+	if err := validPoint(p); err != nil {
+		return err
+	}
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	faults[p] = f
+	log.Warn("msg", "Fault injection configured", "point", p, "faults", f)
+	return nil
+}
+
+// Reset removes all configured faults.
+func Reset() {
+	mux.Lock()
+	defer mux.Unlock()
+	faults = map[Point]Faults{}
+}
+
+// Get returns the currently configured faults.
+func Get() map[Point]Faults {
+	mux.RLock()
+	defer mux.RUnlock()
+	res := make(map[Point]Faults, len(faults))
+	for p, f := range faults {
+		res[p] = f
+	}
+	return res
+}
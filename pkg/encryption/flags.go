@@ -0,0 +1,81 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package encryption
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Config is the configuration of the encryption of label values.
+type Config struct {
+	EncryptedLabelsStr string
+	KeyFile            string
+	DecryptTokenFile   string
+
+	// The fields below are set by Validate.
+	EncryptedLabels []string
+	Key             []byte
+	DecryptToken    string
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.EncryptedLabelsStr, "encrypted-labels", "", "Comma separated label names whose values are stored encrypted with AES-256-GCM. "+
+		"Queries can only match these labels with '=' and '!=', and their values are only decrypted in the responses to requests carrying "+
+		"the token of label-decryption-token-file in the '"+decryptTokenHeader+"' header. Requires label-encryption-key-file. Disabled by default.")
+	fs.StringVar(&cfg.KeyFile, "label-encryption-key-file", "", "Path of the file containing the hex-encoded 32-byte key used to encrypt the values of encrypted-labels. "+
+		"All the connectors writing to the same database must use the same key.")
+	fs.StringVar(&cfg.DecryptTokenFile, "label-decryption-token-file", "", "Path of the file containing the token authorizing requests to see the decrypted values of encrypted-labels. "+
+		"If not set, the values are never decrypted in responses.")
+}
+
+func Validate(cfg *Config) error {
+	for _, name := range strings.Split(cfg.EncryptedLabelsStr, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		// The metric name, the tenant and the other reserved labels are
+		// needed in plain text to store and find the series.
+		if strings.HasPrefix(name, "__") {
+			return fmt.Errorf("encrypted-labels: reserved label %s cannot be encrypted", name)
+		}
+		cfg.EncryptedLabels = append(cfg.EncryptedLabels, name)
+	}
+	if len(cfg.EncryptedLabels) == 0 {
+		if cfg.KeyFile != "" || cfg.DecryptTokenFile != "" {
+			return fmt.Errorf("label-encryption-key-file and label-decryption-token-file require encrypted-labels to be set")
+		}
+		return nil
+	}
+
+	if cfg.KeyFile == "" {
+		return fmt.Errorf("encrypted-labels requires label-encryption-key-file to be set")
+	}
+	bs, err := ioutil.ReadFile(cfg.KeyFile) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("reading label encryption key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(bs)))
+	if err != nil || len(key) != keySize {
+		return fmt.Errorf("label encryption key must be %d hex-encoded bytes", keySize)
+	}
+	cfg.Key = key
+
+	if cfg.DecryptTokenFile != "" {
+		bs, err = ioutil.ReadFile(cfg.DecryptTokenFile) // #nosec G304
+		if err != nil {
+			return fmt.Errorf("reading label decryption token: %w", err)
+		}
+		cfg.DecryptToken = strings.TrimSpace(string(bs))
+		if cfg.DecryptToken == "" {
+			return fmt.Errorf("label decryption token cannot be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package encryption stores the values of sensitive labels encrypted, and
+// decrypts them in the responses to authorized requests.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+const (
+	keySize = 32
+	// encryptedPrefix marks the stored values that are encrypted, to tell
+	// them apart from the values written before the label was encrypted.
+	encryptedPrefix = "enc:"
+	// decryptTokenHeader carries the token authorizing a request to see the
+	// decrypted values.
+	decryptTokenHeader = "X-Promscale-Decrypt-Token"
+)
+
+// ErrRegexpOnEncryptedLabel is returned for regex matchers on encrypted labels,
+// which cannot be evaluated on the encrypted values.
+var ErrRegexpOnEncryptedLabel = fmt.Errorf("regex matchers are not supported on encrypted labels")
+
+// LabelEncryptor encrypts the values of the configured labels. The encryption
+// is deterministic, so that a value is always stored the same way, which
+// keeps the series identity and allows matching on equality: the nonce of
+// AES-GCM is derived from the label and the value with HMAC-SHA256, using a
+// key separate from the encryption key.
+type LabelEncryptor struct {
+	names        map[string]struct{}
+	aead         cipher.AEAD
+	nonceKey     []byte
+	decryptToken []byte
+}
+
+// NewLabelEncryptor returns the encryptor of the configuration, nil if no
+// label is encrypted.
+func NewLabelEncryptor(cfg *Config) (*LabelEncryptor, error) {
+	if len(cfg.EncryptedLabels) == 0 {
+		return nil, nil
+	}
+	if len(cfg.Key) != keySize {
+		return nil, fmt.Errorf("label encryption key must be %d bytes", keySize)
+	}
+	block, err := aes.NewCipher(deriveKey(cfg.Key, "promscale label encryption"))
+	if err != nil {
+		return nil, fmt.Errorf("creating label encryption cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating label encryption cipher: %w", err)
+	}
+	e := &LabelEncryptor{
+		names:    make(map[string]struct{}, len(cfg.EncryptedLabels)),
+		aead:     aead,
+		nonceKey: deriveKey(cfg.Key, "promscale label nonce"),
+	}
+	for _, name := range cfg.EncryptedLabels {
+		e.names[name] = struct{}{}
+	}
+	if cfg.DecryptToken != "" {
+		e.decryptToken = []byte(cfg.DecryptToken)
+	}
+	return e, nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// IsEncrypted returns true if the values of the label are encrypted.
+func (e *LabelEncryptor) IsEncrypted(name string) bool {
+	_, ok := e.names[name]
+	return ok
+}
+
+// Encrypt returns the encrypted value of a label. Empty values are kept
+// empty, since they stand for the absence of the label.
+func (e *LabelEncryptor) Encrypt(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, e.nonceKey)
+	_, _ = mac.Write([]byte(name))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:e.aead.NonceSize()]
+
+	// The label name is authenticated, so that a value cannot be moved to
+	// another label.
+	sealed := e.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return encryptedPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// Decrypt returns the plain text value of a label. Values that were not
+// encrypted are returned as they are.
+func (e *LabelEncryptor) Decrypt(name, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(value[len(encryptedPrefix):])
+	if err != nil || len(sealed) < e.aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value of label %s", name)
+	}
+	nonceSize := e.aead.NonceSize()
+	plain, err := e.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("decrypting value of label %s: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+// Process implements the Preprocessor interface, encrypting the values of
+// the encrypted labels of the written series.
+func (e *LabelEncryptor) Process(_ *http.Request, wr *prompb.WriteRequest) error {
+	for i := range wr.Timeseries {
+		lbls := wr.Timeseries[i].Labels
+		for j := range lbls {
+			if e.IsEncrypted(lbls[j].Name) {
+				lbls[j].Value = e.Encrypt(lbls[j].Name, lbls[j].Value)
+			}
+		}
+	}
+	return nil
+}
+
+// EncryptMatchers returns the matchers with the values matched against the
+// encrypted labels encrypted.
+func (e *LabelEncryptor) EncryptMatchers(ms []*labels.Matcher) ([]*labels.Matcher, error) {
+	var encrypted []*labels.Matcher
+	for i, m := range ms {
+		if !e.IsEncrypted(m.Name) {
+			continue
+		}
+		if m.Type == labels.MatchRegexp || m.Type == labels.MatchNotRegexp {
+			return nil, fmt.Errorf("label %s: %w", m.Name, ErrRegexpOnEncryptedLabel)
+		}
+		if encrypted == nil {
+			// The matchers of the caller are left untouched.
+			encrypted = make([]*labels.Matcher, len(ms))
+			copy(encrypted, ms)
+		}
+		encrypted[i] = &labels.Matcher{Type: m.Type, Name: m.Name, Value: e.Encrypt(m.Name, m.Value)}
+	}
+	if encrypted == nil {
+		return ms, nil
+	}
+	return encrypted, nil
+}
+
+// Authorized returns true if the request carries the decryption token.
+func (e *LabelEncryptor) Authorized(r *http.Request) bool {
+	if len(e.decryptToken) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(decryptTokenHeader)), e.decryptToken) == 1
+}
+
+// DecryptLabels returns the labels with the values of the encrypted labels
+// decrypted. Values that cannot be decrypted are kept encrypted.
+func (e *LabelEncryptor) DecryptLabels(lbls labels.Labels) labels.Labels {
+	var decrypted labels.Labels
+	for i, l := range lbls {
+		if !e.IsEncrypted(l.Name) {
+			continue
+		}
+		value, err := e.Decrypt(l.Name, l.Value)
+		if err != nil {
+			continue
+		}
+		if decrypted == nil {
+			decrypted = make(labels.Labels, len(lbls))
+			copy(decrypted, lbls)
+		}
+		decrypted[i].Value = value
+	}
+	if decrypted == nil {
+		return lbls
+	}
+	return decrypted
+}
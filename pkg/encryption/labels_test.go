@@ -0,0 +1,104 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func newTestEncryptor(t *testing.T, token string) *LabelEncryptor {
+	e, err := NewLabelEncryptor(&Config{
+		EncryptedLabels: []string{"user_id"},
+		Key:             bytes.Repeat([]byte{1}, keySize),
+		DecryptToken:    token,
+	})
+	require.NoError(t, err)
+	return e
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	e := newTestEncryptor(t, "")
+
+	encrypted := e.Encrypt("user_id", "123")
+	require.NotContains(t, encrypted, "123")
+	require.Equal(t, encrypted, e.Encrypt("user_id", "123"), "the encryption must be deterministic to keep the series identity")
+	require.NotEqual(t, encrypted, e.Encrypt("user_id", "124"))
+	require.NotEqual(t, encrypted, e.Encrypt("account_id", "123"), "the same value of another label must be encrypted differently")
+	require.Equal(t, "", e.Encrypt("user_id", ""))
+
+	decrypted, err := e.Decrypt("user_id", encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "123", decrypted)
+
+	_, err = e.Decrypt("account_id", encrypted)
+	require.Error(t, err, "a value must not be decrypted as the value of another label")
+
+	decrypted, err = e.Decrypt("user_id", "written before encryption")
+	require.NoError(t, err)
+	require.Equal(t, "written before encryption", decrypted)
+
+	other, err := NewLabelEncryptor(&Config{EncryptedLabels: []string{"user_id"}, Key: bytes.Repeat([]byte{2}, keySize)})
+	require.NoError(t, err)
+	_, err = other.Decrypt("user_id", encrypted)
+	require.Error(t, err)
+}
+
+func TestProcess(t *testing.T) {
+	e := newTestEncryptor(t, "")
+	wr := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: labels.MetricName, Value: "logins"}, {Name: "user_id", Value: "123"}},
+	}}}
+	require.NoError(t, e.Process(nil, wr))
+	require.Equal(t, "logins", wr.Timeseries[0].Labels[0].Value)
+	require.Equal(t, e.Encrypt("user_id", "123"), wr.Timeseries[0].Labels[1].Value)
+}
+
+func TestEncryptMatchers(t *testing.T) {
+	e := newTestEncryptor(t, "")
+	ms := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "logins"),
+		labels.MustNewMatcher(labels.MatchNotEqual, "user_id", "123"),
+	}
+	encrypted, err := e.EncryptMatchers(ms)
+	require.NoError(t, err)
+	require.Equal(t, ms[0], encrypted[0])
+	require.Equal(t, labels.MatchNotEqual, encrypted[1].Type)
+	require.Equal(t, e.Encrypt("user_id", "123"), encrypted[1].Value)
+	require.Equal(t, "123", ms[1].Value, "the matchers of the caller must not be modified")
+
+	_, err = e.EncryptMatchers([]*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "user_id", "12.*")})
+	require.True(t, errors.Is(err, ErrRegexpOnEncryptedLabel))
+}
+
+func TestDecryptLabels(t *testing.T) {
+	e := newTestEncryptor(t, "secret")
+	lbls := labels.Labels{{Name: labels.MetricName, Value: "logins"}, {Name: "user_id", Value: e.Encrypt("user_id", "123")}}
+	require.Equal(t, labels.Labels{{Name: labels.MetricName, Value: "logins"}, {Name: "user_id", Value: "123"}}, e.DecryptLabels(lbls))
+	require.NotEqual(t, "123", lbls[1].Value, "the labels of the caller must not be modified")
+
+	r, err := http.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	require.NoError(t, err)
+	require.False(t, e.Authorized(r))
+	r.Header.Set(decryptTokenHeader, "wrong")
+	require.False(t, e.Authorized(r))
+	r.Header.Set(decryptTokenHeader, "secret")
+	require.True(t, e.Authorized(r))
+
+	require.False(t, newTestEncryptor(t, "").Authorized(r), "no request is authorized without a token")
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(&Config{}))
+	require.Error(t, Validate(&Config{EncryptedLabelsStr: "user_id"}), "a key file is required")
+	require.Error(t, Validate(&Config{EncryptedLabelsStr: "__name__", KeyFile: "key"}))
+	require.Error(t, Validate(&Config{KeyFile: "key"}), "a key file without encrypted labels is a misconfiguration")
+}
@@ -0,0 +1,58 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package forward
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const (
+	// defaultMetrics matches the names of the recording rules that follow
+	// the level:metric:operations naming convention.
+	defaultMetrics = ".+:.+"
+	defaultTimeout = 30 * time.Second
+)
+
+// Config is the configuration of the forwarding of derived metrics to an
+// upstream remote-write endpoint.
+type Config struct {
+	URL        string
+	MetricsStr string
+	Timeout    time.Duration
+
+	// Metrics is set by Validate.
+	Metrics *regexp.Regexp
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.URL, "forward-remote-write-url", "", "URL of an upstream Prometheus remote-write endpoint, e.g. of Prometheus, Mimir or Cortex, "+
+		"to which the ingested series of forward-metrics are asynchronously forwarded, so that aggregates are exported centrally while the raw data stays in Promscale. "+
+		"Forwarding is best-effort and never blocks writes to the database. Basic auth credentials can be set in the URL. Disabled by default.")
+	fs.StringVar(&cfg.MetricsStr, "forward-metrics", defaultMetrics, "Regex of the names of the metrics forwarded to forward-remote-write-url. It is fully anchored. "+
+		"Defaults to the names of recording rules following the 'level:metric:operations' convention.")
+	fs.DurationVar(&cfg.Timeout, "forward-remote-write-timeout", defaultTimeout, "Timeout of the requests to forward-remote-write-url.")
+}
+
+func Validate(cfg *Config) error {
+	if cfg.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid forward-remote-write-url, must be an http or https URL")
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("invalid forward-remote-write-timeout %v, must be positive", cfg.Timeout)
+	}
+	cfg.Metrics, err = regexp.Compile("^(?:" + cfg.MetricsStr + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid forward-metrics: %w", err)
+	}
+	return nil
+}
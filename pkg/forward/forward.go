@@ -0,0 +1,257 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package forward remote-writes selected ingested metrics, e.g. the outputs
+// of recording rules or span metrics, to an upstream Prometheus compatible
+// endpoint, so that the raw data stays local while aggregates are exported
+// centrally.
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/util"
+	"github.com/timescale/promscale/pkg/version"
+)
+
+const (
+	// queueSize is the number of write requests with forwarded series that
+	// can wait to be sent before new ones are dropped.
+	queueSize = 128
+	// maxBatchSamples is the number of samples above which a batch is sent
+	// without waiting for the flush interval.
+	maxBatchSamples = 2000
+	flushInterval   = 5 * time.Second
+	maxRetries      = 3
+	minBackoff      = 500 * time.Millisecond
+	maxErrMsgLen    = 256
+)
+
+var forwardedSamples = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "forward_samples_total",
+		Help:      "Total number of samples considered for forwarding to the upstream remote-write endpoint, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(forwardedSamples)
+}
+
+// recoverableError is an error after which sending the batch is retried.
+type recoverableError struct {
+	error
+}
+
+// Forwarder asynchronously forwards the series of the selected metrics to
+// the upstream endpoint, in batches. Forwarding is best-effort: it never
+// blocks nor fails writes to the database, and batches are dropped after a
+// few failed attempts.
+type Forwarder struct {
+	url           string
+	metrics       func(string) bool
+	client        *http.Client
+	queue         chan []prompb.TimeSeries
+	flushInterval time.Duration
+	minBackoff    time.Duration
+	wg            sync.WaitGroup
+}
+
+// New returns a forwarder for the configuration, which must be validated.
+func New(cfg Config) *Forwarder {
+	log.Info("msg", "Forwarding metrics to upstream remote-write endpoint", "metrics", cfg.MetricsStr, "url", redactURL(cfg.URL))
+	return newForwarder(cfg, flushInterval, minBackoff)
+}
+
+func newForwarder(cfg Config, flushInterval, minBackoff time.Duration) *Forwarder {
+	f := &Forwarder{
+		url:           cfg.URL,
+		metrics:       cfg.Metrics.MatchString,
+		client:        &http.Client{Timeout: cfg.Timeout},
+		queue:         make(chan []prompb.TimeSeries, queueSize),
+		flushInterval: flushInterval,
+		minBackoff:    minBackoff,
+	}
+	f.wg.Add(1)
+	go f.run()
+	return f
+}
+
+// Send enqueues a copy of the series of the write request that are
+// forwarded. It must be called before the request is handed to the
+// ingestor, since the ingestor recycles the request once it is done with it.
+func (f *Forwarder) Send(r *prompb.WriteRequest) {
+	var (
+		series     []prompb.TimeSeries
+		numSamples int
+	)
+	for i := range r.Timeseries {
+		ts := &r.Timeseries[i]
+		if len(ts.Samples) == 0 || !f.metrics(metricName(ts.Labels)) {
+			continue
+		}
+		series = append(series, copySeries(ts))
+		numSamples += len(ts.Samples)
+	}
+	if len(series) == 0 {
+		return
+	}
+	select {
+	case f.queue <- series:
+	default:
+		forwardedSamples.WithLabelValues("dropped").Add(float64(numSamples))
+	}
+}
+
+// Close stops accepting new series, sends the queued ones and waits for
+// them to be forwarded.
+func (f *Forwarder) Close() {
+	close(f.queue)
+	f.wg.Wait()
+}
+
+func (f *Forwarder) run() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	var (
+		batch      []prompb.TimeSeries
+		numSamples int
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		result := "sent"
+		if err := f.sendWithRetries(batch); err != nil {
+			log.Warn("msg", "error forwarding metrics to upstream remote-write endpoint", "err", err)
+			result = "failed"
+		}
+		forwardedSamples.WithLabelValues(result).Add(float64(numSamples))
+		batch, numSamples = nil, 0
+	}
+	for {
+		select {
+		case series, ok := <-f.queue:
+			if !ok {
+				flush()
+				return
+			}
+			for _, ts := range series {
+				batch = append(batch, ts)
+				numSamples += len(ts.Samples)
+			}
+			if numSamples >= maxBatchSamples {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (f *Forwarder) sendWithRetries(batch []prompb.TimeSeries) error {
+	data, err := (&prompb.WriteRequest{Timeseries: batch}).Marshal()
+	if err != nil {
+		return err
+	}
+	compressed := snappy.Encode(nil, data)
+
+	backoff := f.minBackoff
+	for try := 0; ; try++ {
+		err = f.send(compressed)
+		if _, ok := err.(recoverableError); !ok || try == maxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send sends a snappy-compressed write request to the upstream endpoint.
+// Network errors, rate limiting and server errors are recoverable.
+func (f *Forwarder) send(compressed []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, f.url, bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "promscale/"+version.Promscale)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxErrMsgLen))
+	line := ""
+	if scanner.Scan() {
+		line = scanner.Text()
+	}
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+func metricName(lbls []prompb.Label) string {
+	for _, l := range lbls {
+		if l.Name == model.MetricNameLabel {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// copySeries returns a copy of the series that does not reference the
+// buffer the request was decoded from.
+func copySeries(ts *prompb.TimeSeries) prompb.TimeSeries {
+	lbls := make([]prompb.Label, len(ts.Labels))
+	for i, l := range ts.Labels {
+		lbls[i] = prompb.Label{Name: copyString(l.Name), Value: copyString(l.Value)}
+	}
+	samples := make([]prompb.Sample, len(ts.Samples))
+	copy(samples, ts.Samples)
+	return prompb.TimeSeries{Labels: lbls, Samples: samples}
+}
+
+func copyString(s string) string {
+	return string(append([]byte(nil), s...))
+}
+
+// redactURL hides the password of the URL in the logs.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
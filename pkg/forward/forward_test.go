@@ -0,0 +1,123 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package forward
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+// upstream records the series remote-written to it, answering with the
+// given status codes in turn and then with 200.
+type upstream struct {
+	mux      sync.Mutex
+	statuses []int
+	requests int
+	series   []prompb.TimeSeries
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	u.requests++
+	if len(u.statuses) > 0 {
+		status := u.statuses[0]
+		u.statuses = u.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+
+	compressed, _ := ioutil.ReadAll(r.Body)
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil || r.Header.Get("Content-Encoding") != "snappy" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var req prompb.WriteRequest
+	if err = req.Unmarshal(data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	u.series = append(u.series, req.Timeseries...)
+}
+
+func newTestForwarder(t *testing.T, u *upstream) *Forwarder {
+	server := httptest.NewServer(u)
+	t.Cleanup(server.Close)
+	cfg := Config{URL: server.URL, MetricsStr: defaultMetrics, Timeout: time.Second}
+	require.NoError(t, Validate(&cfg))
+	return newForwarder(cfg, time.Hour, time.Millisecond)
+}
+
+func series(name string, value float64) prompb.TimeSeries {
+	return prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: name}, {Name: "job", Value: "api"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: value}},
+	}
+}
+
+func TestForward(t *testing.T) {
+	u := &upstream{}
+	f := newTestForwarder(t, u)
+
+	f.Send(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		series("http_requests_total", 1),
+		series("job:http_requests:rate5m", 2),
+	}})
+	f.Send(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("http_requests_total", 3)}})
+	f.Send(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("job:http_requests:rate1m", 4)}})
+	f.Close()
+
+	require.Equal(t, 1, u.requests, "the series are sent in a single batch")
+	require.Equal(t, []prompb.TimeSeries{
+		series("job:http_requests:rate5m", 2),
+		series("job:http_requests:rate1m", 4),
+	}, u.series)
+}
+
+func TestForwardRetries(t *testing.T) {
+	u := &upstream{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	f := newTestForwarder(t, u)
+	f.Send(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("job:up:sum", 1)}})
+	f.Close()
+
+	require.Equal(t, 3, u.requests)
+	require.Equal(t, []prompb.TimeSeries{series("job:up:sum", 1)}, u.series)
+}
+
+func TestForwardDropsRejectedBatches(t *testing.T) {
+	u := &upstream{statuses: []int{http.StatusBadRequest}}
+	f := newTestForwarder(t, u)
+	f.Send(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("job:up:sum", 1)}})
+	f.Close()
+
+	require.Equal(t, 1, u.requests, "client errors are not retried")
+	require.Empty(t, u.series)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{MetricsStr: "("}
+	require.NoError(t, Validate(&cfg), "the configuration is not checked when forwarding is disabled")
+
+	cfg = Config{URL: "localhost:9090", MetricsStr: defaultMetrics, Timeout: time.Second}
+	require.Error(t, Validate(&cfg))
+	cfg = Config{URL: "http://localhost:9090/api/v1/push", MetricsStr: defaultMetrics}
+	require.Error(t, Validate(&cfg))
+	cfg = Config{URL: "http://localhost:9090/api/v1/push", MetricsStr: "(", Timeout: time.Second}
+	require.Error(t, Validate(&cfg))
+
+	cfg = Config{URL: "http://localhost:9090/api/v1/push", MetricsStr: "traces_spanmetrics_.*", Timeout: time.Second}
+	require.NoError(t, Validate(&cfg))
+	require.True(t, cfg.Metrics.MatchString("traces_spanmetrics_calls_total"))
+	require.False(t, cfg.Metrics.MatchString("app_traces_spanmetrics_calls_total"), "the regex is anchored")
+}
@@ -0,0 +1,3 @@
+-- reverts versions/dev/0.5.2-dev/10-ingest_checkpoints.sql. The sources
+-- resume from their own offsets once the checkpoints are dropped.
+DROP TABLE IF EXISTS SCHEMA_CATALOG.ingest_checkpoint;
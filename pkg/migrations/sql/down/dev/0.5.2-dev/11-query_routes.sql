@@ -0,0 +1,5 @@
+-- reverts versions/dev/0.5.2-dev/11-query_routes.sql. The queries of every
+-- metric go back to the automatic routing.
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.set_metric_query_route(text, text, boolean);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.reset_metric_query_route(text, boolean);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.query_route;
@@ -0,0 +1,6 @@
+-- reverts versions/dev/0.5.2-dev/12-push_groups.sql. The samples pushed to
+-- the groups stay in the metric tables.
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.replace_push_group(jsonb, boolean, text[], jsonb[], timestamptz[], double precision[]);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.delete_push_group(jsonb);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.push_group_metric;
+DROP TABLE IF EXISTS SCHEMA_CATALOG.push_group;
@@ -0,0 +1,2 @@
+-- reverts versions/dev/0.5.2-dev/13-sample_checksums.sql.
+DROP TABLE IF EXISTS SCHEMA_CATALOG.sample_checksum;
@@ -0,0 +1,2 @@
+-- reverts versions/dev/0.5.2-dev/14-slos.sql.
+DROP TABLE IF EXISTS SCHEMA_CATALOG.slo;
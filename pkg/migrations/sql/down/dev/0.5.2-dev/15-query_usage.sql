@@ -0,0 +1,2 @@
+-- reverts versions/dev/0.5.2-dev/15-query_usage.sql.
+DROP TABLE IF EXISTS SCHEMA_CATALOG.metric_query_usage;
@@ -0,0 +1,9 @@
+-- reverts versions/dev/0.5.2-dev/16-label_postings.sql.
+DROP TRIGGER IF EXISTS label_posting_insert ON SCHEMA_CATALOG.series;
+DROP TRIGGER IF EXISTS label_posting_delete ON SCHEMA_CATALOG.series;
+DROP FUNCTION IF EXISTS SCHEMA_PROM.enable_label_postings();
+DROP FUNCTION IF EXISTS SCHEMA_PROM.disable_label_postings();
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.label_postings_enabled();
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.label_posting_insert();
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.label_posting_delete();
+DROP TABLE IF EXISTS SCHEMA_CATALOG.label_posting;
@@ -0,0 +1,2 @@
+-- reverts versions/dev/0.5.2-dev/17-label_value_pattern_index.sql.
+DROP INDEX IF EXISTS SCHEMA_CATALOG.label_key_value_pattern_idx;
@@ -0,0 +1,39 @@
+-- reverts versions/dev/0.5.2-dev/18-write_shards.sql. The samples of the
+-- write shards are moved back into the metric tables first, so that the
+-- previous versions, which only read the metric tables, still see them.
+DO $$
+DECLARE
+    m SCHEMA_CATALOG.metric;
+    shard_table NAME;
+BEGIN
+    FOR m IN
+        SELECT * FROM SCHEMA_CATALOG.metric
+        WHERE id IN (SELECT metric_id FROM SCHEMA_CATALOG.metric_write_shard)
+    LOOP
+        --the metric views read the sharded view and are recreated below.
+        EXECUTE format('DROP VIEW IF EXISTS SCHEMA_DATA_SHARDED.%I CASCADE', m.table_name);
+        FOR shard_table IN
+            SELECT table_name FROM SCHEMA_CATALOG.metric_write_shard WHERE metric_id = m.id ORDER BY shard
+        LOOP
+            EXECUTE format('INSERT INTO SCHEMA_DATA.%I (time, value, series_id) SELECT time, value, series_id FROM SCHEMA_DATA.%I ON CONFLICT DO NOTHING',
+                m.table_name, shard_table);
+            EXECUTE format('DROP TABLE SCHEMA_DATA.%I', shard_table);
+        END LOOP;
+        DELETE FROM SCHEMA_CATALOG.metric_write_shard WHERE metric_id = m.id;
+
+        IF EXISTS (SELECT 1 FROM SCHEMA_CATALOG.label_key_position WHERE metric_name = m.metric_name) THEN
+            PERFORM SCHEMA_CATALOG.create_metric_view(m.metric_name);
+            PERFORM SCHEMA_CATALOG.create_metric_labeled_view(m.metric_name);
+        END IF;
+    END LOOP;
+END
+$$;
+
+DROP FUNCTION IF EXISTS SCHEMA_PROM.set_metric_write_shards(TEXT, INT);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.set_write_shards_on_metric_table(NAME, INT);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_metric_read_schema(NAME, NAME);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_metric_write_shards(NAME);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.metric_write_shard;
+ALTER TABLE SCHEMA_CATALOG.metric DROP COLUMN IF EXISTS write_shards;
+DROP SCHEMA IF EXISTS SCHEMA_DATA_SHARDED CASCADE;
+DELETE FROM public.prom_installation_info WHERE key = 'sharded metric data schema';
@@ -0,0 +1,3 @@
+-- reverts versions/dev/0.5.2-dev/19-exemplars.sql.
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.delete_expired_exemplars(TEXT, TIMESTAMPTZ);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.exemplar;
@@ -0,0 +1,4 @@
+-- reverts versions/dev/0.5.2-dev/2-query_views.sql
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.register_query_view(text, name, name, interval, name);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.unregister_query_view(text, name, name, boolean);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.query_view;
@@ -0,0 +1,12 @@
+-- reverts versions/dev/0.5.2-dev/20-exemplar_hypertable.sql. The exemplars
+-- are moved back into a plain table.
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.drop_exemplar_chunks();
+CREATE TABLE SCHEMA_CATALOG.exemplar_plain (LIKE SCHEMA_CATALOG.exemplar INCLUDING DEFAULTS);
+INSERT INTO SCHEMA_CATALOG.exemplar_plain SELECT * FROM SCHEMA_CATALOG.exemplar;
+DROP TABLE SCHEMA_CATALOG.exemplar;
+ALTER TABLE SCHEMA_CATALOG.exemplar_plain RENAME TO exemplar;
+ALTER TABLE SCHEMA_CATALOG.exemplar ADD PRIMARY KEY (series_id, time);
+CREATE INDEX exemplar_metric_time_idx ON SCHEMA_CATALOG.exemplar (metric_name, time);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.exemplar TO prom_reader;
+GRANT SELECT, INSERT ON TABLE SCHEMA_CATALOG.exemplar TO prom_writer;
+GRANT DELETE ON TABLE SCHEMA_CATALOG.exemplar TO prom_maintenance;
@@ -0,0 +1,5 @@
+-- reverts versions/dev/0.5.2-dev/3-tenants.sql
+DROP PROCEDURE IF EXISTS SCHEMA_CATALOG.execute_tenant_retention_policy(boolean);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.delete_expired_tenant_data(name, text, timestamptz);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_tenant_series_ids(name, text);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.tenant;
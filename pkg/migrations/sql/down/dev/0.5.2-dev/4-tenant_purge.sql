@@ -0,0 +1,4 @@
+-- reverts versions/dev/0.5.2-dev/4-tenant_purge.sql
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.delete_tenant_series_from_metric(text, text);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.verify_tenant_purge(text);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.tenant_purge;
@@ -0,0 +1,4 @@
+-- reverts versions/dev/0.5.2-dev/5-label_purge.sql, dropping the audit trail
+-- of the purges.
+DROP TABLE IF EXISTS SCHEMA_CATALOG.label_purge_metric;
+DROP TABLE IF EXISTS SCHEMA_CATALOG.label_purge;
@@ -0,0 +1,5 @@
+-- reverts versions/dev/0.5.2-dev/6-external_metrics.sql. The external tables
+-- themselves are not owned by Promscale and are left untouched.
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.register_external_metric(text, name, name, name, name, name[]);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.unregister_external_metric(text, boolean);
+DROP TABLE IF EXISTS SCHEMA_CATALOG.external_metric;
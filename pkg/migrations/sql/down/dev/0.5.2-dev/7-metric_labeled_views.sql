@@ -0,0 +1,5 @@
+-- reverts versions/dev/0.5.2-dev/7-metric_labeled_views.sql, dropping the
+-- labeled metric views along with their schema.
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.create_metric_labeled_view(text);
+DROP SCHEMA IF EXISTS SCHEMA_METRIC_LABELED CASCADE;
+DELETE FROM public.prom_installation_info WHERE key = 'labeled metric schema';
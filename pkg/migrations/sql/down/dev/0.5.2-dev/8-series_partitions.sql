@@ -0,0 +1,9 @@
+-- reverts versions/dev/0.5.2-dev/8-series_partitions.sql. The tables already
+-- partitioned by series hash keep their partitions, which the previous
+-- versions query as any other hypertable.
+DROP FUNCTION IF EXISTS SCHEMA_PROM.set_default_series_partitions(INT);
+DROP FUNCTION IF EXISTS SCHEMA_PROM.set_metric_series_partitions(TEXT, INT);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.set_series_partitions_on_metric_table(NAME, INT);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_metric_series_partitions(NAME);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_default_series_partitions();
+DELETE FROM SCHEMA_CATALOG.default WHERE key = 'series_partitions';
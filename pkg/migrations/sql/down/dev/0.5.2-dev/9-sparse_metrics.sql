@@ -0,0 +1,30 @@
+-- reverts versions/dev/0.5.2-dev/9-sparse_metrics.sql. The sparse metrics
+-- are switched back to the regular mode first, so that their tables get the
+-- default chunk interval and lose the index of the sparse mode.
+DO $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN
+        SELECT table_name FROM SCHEMA_CATALOG.metric WHERE sparse AND table_schema = 'SCHEMA_DATA'
+    LOOP
+        PERFORM SCHEMA_CATALOG.set_sparse_on_metric_table(r.table_name, false);
+    END LOOP;
+END
+$$;
+
+DROP PROCEDURE IF EXISTS SCHEMA_CATALOG.execute_sparse_metric_detection(boolean);
+DROP FUNCTION IF EXISTS SCHEMA_PROM.set_metric_sparse(TEXT, BOOLEAN);
+DROP FUNCTION IF EXISTS SCHEMA_PROM.reset_metric_sparse(TEXT);
+DROP FUNCTION IF EXISTS SCHEMA_PROM.set_sparse_sample_rate(DOUBLE PRECISION);
+DROP FUNCTION IF EXISTS SCHEMA_PROM.set_sparse_chunk_interval(INTERVAL);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.set_sparse_on_metric_table(NAME, BOOLEAN);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_metric_sample_rate(NAME);
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_sparse_sample_rate();
+DROP FUNCTION IF EXISTS SCHEMA_CATALOG.get_sparse_chunk_interval();
+
+ALTER TABLE SCHEMA_CATALOG.metric
+    DROP COLUMN IF EXISTS sparse,
+    DROP COLUMN IF EXISTS sparse_automatic;
+
+DELETE FROM SCHEMA_CATALOG.default WHERE key IN ('sparse_sample_rate', 'sparse_chunk_interval');
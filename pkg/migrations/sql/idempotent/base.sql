@@ -10,6 +10,30 @@ $func$
 LANGUAGE SQL STABLE PARALLEL SAFE;
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_default_chunk_interval() TO prom_reader;
 
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_default_series_partitions()
+    RETURNS INT
+AS $func$
+    SELECT COALESCE((SELECT value::INT FROM SCHEMA_CATALOG.default WHERE key='series_partitions'), 0);
+$func$
+LANGUAGE SQL STABLE PARALLEL SAFE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_default_series_partitions() TO prom_reader;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_sparse_sample_rate()
+    RETURNS DOUBLE PRECISION
+AS $func$
+    SELECT COALESCE((SELECT value::DOUBLE PRECISION FROM SCHEMA_CATALOG.default WHERE key='sparse_sample_rate'), 0.01);
+$func$
+LANGUAGE SQL STABLE PARALLEL SAFE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_sparse_sample_rate() TO prom_reader;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_sparse_chunk_interval()
+    RETURNS INTERVAL
+AS $func$
+    SELECT COALESCE((SELECT value::INTERVAL FROM SCHEMA_CATALOG.default WHERE key='sparse_chunk_interval'), INTERVAL '30 days');
+$func$
+LANGUAGE SQL STABLE PARALLEL SAFE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_sparse_chunk_interval() TO prom_reader;
+
 CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_timescale_major_version()
     RETURNS INT
 AS $func$
@@ -273,6 +297,11 @@ BEGIN
             PERFORM SCHEMA_TIMESCALE.create_hypertable(format('%I.%I', NEW.table_schema, NEW.table_name), 'time',
             chunk_time_interval=>SCHEMA_CATALOG.get_staggered_chunk_interval(SCHEMA_CATALOG.get_default_chunk_interval()),
                              create_default_indexes=>false);
+            --a dimension can only be added while the table is empty
+            IF SCHEMA_CATALOG.get_default_series_partitions() > 0 THEN
+                PERFORM SCHEMA_TIMESCALE.add_dimension(format('%I.%I', NEW.table_schema, NEW.table_name), 'series_id',
+                    number_partitions=>SCHEMA_CATALOG.get_default_series_partitions());
+            END IF;
         END IF;
     END IF;
 
@@ -558,6 +587,7 @@ BEGIN
         --must be run once across a collection of keys
         PERFORM SCHEMA_CATALOG.create_series_view(metric_name);
         PERFORM SCHEMA_CATALOG.create_metric_view(metric_name);
+        PERFORM SCHEMA_CATALOG.create_metric_labeled_view(metric_name);
     END IF;
 
     RETURN position_array;
@@ -780,6 +810,7 @@ $$
     DECLARE
         hypertable_name TEXT;
         deletable_metric_id INTEGER;
+        shard_table NAME;
     BEGIN
         IF (SELECT NOT pg_try_advisory_xact_lock(SCHEMA_LOCK_ID)) THEN
             RAISE NOTICE 'drop_metric can run only when no Promscale connectors are running. Please shutdown the Promscale connectors';
@@ -789,9 +820,15 @@ $$
         RAISE NOTICE 'deleting "%" metric with metric_id as "%" and table_name as "%"', metric_name_to_be_dropped, deletable_metric_id, hypertable_name;
         EXECUTE FORMAT('DROP VIEW SCHEMA_SERIES.%1$I;', hypertable_name);
         EXECUTE FORMAT('DROP VIEW SCHEMA_METRIC.%1$I;', hypertable_name);
+        EXECUTE FORMAT('DROP VIEW IF EXISTS SCHEMA_METRIC_LABELED.%1$I;', hypertable_name);
+        EXECUTE FORMAT('DROP VIEW IF EXISTS SCHEMA_DATA_SHARDED.%1$I;', hypertable_name);
+        FOR shard_table IN SELECT * FROM SCHEMA_CATALOG.get_metric_write_shards(hypertable_name) LOOP
+            EXECUTE FORMAT('DROP TABLE SCHEMA_DATA.%1$I;', shard_table);
+        END LOOP;
         EXECUTE FORMAT('DROP TABLE SCHEMA_DATA_SERIES.%1$I;', hypertable_name);
         EXECUTE FORMAT('DROP TABLE SCHEMA_DATA.%1$I;', hypertable_name);
         DELETE FROM SCHEMA_CATALOG.metric WHERE id=deletable_metric_id;
+        DELETE FROM SCHEMA_CATALOG.exemplar WHERE metric_name=metric_name_to_be_dropped;
         -- clean up unreferenced labels, label_keys and its position.
         DELETE FROM SCHEMA_CATALOG.label_key_position WHERE metric_name=metric_name_to_be_dropped;
         DELETE FROM SCHEMA_CATALOG.label_key WHERE key NOT IN (select key from SCHEMA_CATALOG.label_key_position);
@@ -1175,6 +1212,44 @@ $func$
 LANGUAGE PLPGSQL VOLATILE;
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_or_create_series_id_for_label_array(TEXT, SCHEMA_PROM.label_array) TO prom_writer;
 
+-- create_series_id_for_label_array creates a series the connector knows to be
+-- new, inserting it without looking it up first. It falls back to
+-- get_or_create_series_id_for_label_array if the series exists, e.g. if it was
+-- created concurrently or is marked for deletion.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.create_series_id_for_label_array(metric_name TEXT, larray SCHEMA_PROM.label_array, OUT table_name NAME, OUT series_id BIGINT)
+AS $func$
+DECLARE
+  metric_id int;
+BEGIN
+   SELECT mtn.id, mtn.table_name FROM SCHEMA_CATALOG.get_or_create_metric_table_name(metric_name) mtn
+   INTO metric_id, table_name;
+
+   -- same lock ordering as get_or_create_series_id_for_label_array
+   EXECUTE format($query$
+        LOCK TABLE ONLY SCHEMA_DATA.%1$I IN ACCESS SHARE MODE
+    $query$, table_name);
+
+   EXECUTE format($query$
+        INSERT INTO SCHEMA_DATA_SERIES.%1$I(id, metric_id, labels)
+        SELECT nextval('SCHEMA_CATALOG.series_id'), $1, $2
+        ON CONFLICT DO NOTHING
+        RETURNING id
+    $query$, table_name)
+   USING metric_id, larray
+   INTO series_id;
+
+   IF series_id IS NULL THEN
+       SELECT s.series_id
+       FROM SCHEMA_CATALOG.get_or_create_series_id_for_label_array(metric_name, larray) s
+       INTO series_id;
+   END IF;
+
+   RETURN;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.create_series_id_for_label_array(TEXT, SCHEMA_PROM.label_array) TO prom_writer;
+
 --
 -- Parameter manipulation functions
 --
@@ -1182,15 +1257,25 @@ GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_or_create_series_id_for_label_array
 CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.set_chunk_interval_on_metric_table(metric_name TEXT, new_interval INTERVAL)
 RETURNS void
 AS $func$
+DECLARE
+    metric_table NAME;
+    shard_table NAME;
 BEGIN
     IF NOT SCHEMA_CATALOG.is_timescaledb_installed() THEN
         RAISE EXCEPTION 'cannot set chunk time interval without timescaledb installed';
     END IF;
+    SELECT table_name INTO STRICT metric_table
+    FROM SCHEMA_CATALOG.get_or_create_metric_table_name(metric_name);
     --set interval while adding 1% of randomness to the interval so that chunks are not aligned so that
     --chunks are staggered for compression jobs.
     EXECUTE SCHEMA_TIMESCALE.set_chunk_time_interval(
-        format('SCHEMA_DATA.%I',(SELECT table_name FROM SCHEMA_CATALOG.get_or_create_metric_table_name(metric_name)))::regclass,
+        format('SCHEMA_DATA.%I', metric_table)::regclass,
          SCHEMA_CATALOG.get_staggered_chunk_interval(new_interval));
+    FOR shard_table IN SELECT * FROM SCHEMA_CATALOG.get_metric_write_shards(metric_table) LOOP
+        PERFORM SCHEMA_TIMESCALE.set_chunk_time_interval(
+            format('SCHEMA_DATA.%I', shard_table)::regclass,
+             SCHEMA_CATALOG.get_staggered_chunk_interval(new_interval));
+    END LOOP;
 END
 $func$
 LANGUAGE PLPGSQL VOLATILE
@@ -1209,7 +1294,7 @@ AS $$
 
     SELECT SCHEMA_CATALOG.set_chunk_interval_on_metric_table(metric_name, chunk_interval)
     FROM SCHEMA_CATALOG.metric
-    WHERE default_chunk_interval;
+    WHERE default_chunk_interval AND NOT sparse;
 
     SELECT true;
 $$
@@ -1244,7 +1329,9 @@ AS $func$
     WHERE id = (SELECT id FROM SCHEMA_CATALOG.get_metric_table_name_if_exists('SCHEMA_DATA', metric_name));
 
     SELECT SCHEMA_CATALOG.set_chunk_interval_on_metric_table(metric_name,
-        SCHEMA_CATALOG.get_default_chunk_interval());
+        CASE WHEN sparse THEN SCHEMA_CATALOG.get_sparse_chunk_interval() ELSE SCHEMA_CATALOG.get_default_chunk_interval() END)
+    FROM SCHEMA_CATALOG.metric
+    WHERE id = (SELECT id FROM SCHEMA_CATALOG.get_metric_table_name_if_exists('SCHEMA_DATA', reset_metric_chunk_interval.metric_name));
 
     SELECT true;
 $func$
@@ -1253,6 +1340,548 @@ COMMENT ON FUNCTION SCHEMA_PROM.reset_metric_chunk_interval(TEXT)
 IS 'resets the chunk interval for a specific metric to using the default';
 GRANT EXECUTE ON FUNCTION SCHEMA_PROM.reset_metric_chunk_interval(TEXT) TO prom_admin;
 
+--returns the number of hash partitions on series_id of a metric table, 0 if
+--it is only partitioned by time.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_metric_series_partitions(metric_table NAME)
+RETURNS INT
+AS $func$
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() THEN
+        RETURN 0;
+    END IF;
+    RETURN COALESCE((
+        SELECT d.num_slices
+        FROM _timescaledb_catalog.dimension d
+        INNER JOIN _timescaledb_catalog.hypertable h ON (h.id = d.hypertable_id)
+        WHERE h.schema_name = 'SCHEMA_DATA'
+        AND h.table_name = metric_table
+        AND d.column_name = 'series_id'
+    ), 0);
+END
+$func$
+LANGUAGE PLPGSQL STABLE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_metric_series_partitions(NAME) TO prom_reader;
+
+--partitions a metric table by the hash of series_id in addition to time. Only
+--empty tables can be converted, tables that are already partitioned get the
+--new number of partitions for their new chunks.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.set_series_partitions_on_metric_table(metric_table NAME, number_partitions INT)
+RETURNS void
+AS $func$
+DECLARE
+    compressed BOOLEAN;
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() OR SCHEMA_CATALOG.is_multinode() THEN
+        RAISE EXCEPTION 'partitioning metrics by series requires single-node TimescaleDB';
+    END IF;
+    IF number_partitions < 1 THEN
+        RAISE EXCEPTION 'invalid number of series partitions %, must be at least 1', number_partitions;
+    END IF;
+
+    IF SCHEMA_CATALOG.get_metric_series_partitions(metric_table) > 0 THEN
+        PERFORM SCHEMA_TIMESCALE.set_number_partitions(format('SCHEMA_DATA.%I', metric_table)::regclass, number_partitions::smallint, 'series_id');
+        RETURN;
+    END IF;
+
+    PERFORM SCHEMA_TIMESCALE.show_chunks(format('SCHEMA_DATA.%I', metric_table)::regclass) LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION 'metric table % has data and cannot be partitioned by series in place', metric_table
+        USING HINT = 'Only metrics without chunks can be partitioned by series, e.g. before any data is ingested or after the retention dropped all their chunks.';
+    END IF;
+
+    --dimensions cannot be added to tables with compression enabled, which is
+    --cheap to turn off and on while the table is empty.
+    SELECT h.compressed_hypertable_id IS NOT NULL INTO compressed
+    FROM _timescaledb_catalog.hypertable h
+    WHERE h.schema_name = 'SCHEMA_DATA' AND h.table_name = metric_table;
+
+    IF compressed THEN
+        PERFORM SCHEMA_PROM.set_compression_on_metric_table(metric_table, false);
+    END IF;
+    PERFORM SCHEMA_TIMESCALE.add_dimension(format('SCHEMA_DATA.%I', metric_table)::regclass, 'series_id', number_partitions=>number_partitions);
+    IF compressed THEN
+        PERFORM SCHEMA_PROM.set_compression_on_metric_table(metric_table, true);
+    END IF;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.set_series_partitions_on_metric_table(NAME, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.set_series_partitions_on_metric_table(NAME, INT) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_default_series_partitions(number_partitions INT)
+RETURNS BOOLEAN
+AS $func$
+DECLARE
+    r SCHEMA_CATALOG.metric;
+BEGIN
+    IF number_partitions < 0 THEN
+        RAISE EXCEPTION 'invalid number of series partitions %, must be at least 0', number_partitions;
+    END IF;
+
+    INSERT INTO SCHEMA_CATALOG.default(key, value) VALUES('series_partitions', number_partitions::text)
+    ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
+
+    IF number_partitions = 0 OR NOT SCHEMA_CATALOG.is_timescaledb_installed() OR SCHEMA_CATALOG.is_multinode() THEN
+        RETURN true;
+    END IF;
+
+    --convert the existing metrics that are still empty
+    FOR r IN
+        SELECT *
+        FROM SCHEMA_CATALOG.metric m
+        WHERE m.table_schema = 'SCHEMA_DATA'
+        AND m.is_view = false
+        AND SCHEMA_CATALOG.get_metric_series_partitions(m.table_name) = 0
+        AND NOT EXISTS (SELECT 1 FROM SCHEMA_TIMESCALE.show_chunks(format('SCHEMA_DATA.%I', m.table_name)::regclass))
+    LOOP
+        PERFORM SCHEMA_CATALOG.set_series_partitions_on_metric_table(r.table_name, number_partitions);
+    END LOOP;
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.set_default_series_partitions(INT)
+IS 'set the number of hash partitions on series_id of new metrics and existing metrics without data, 0 to only partition them by time';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.set_default_series_partitions(INT) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_metric_series_partitions(metric_name TEXT, number_partitions INT)
+RETURNS BOOLEAN
+AS $func$
+    --use get_or_create_metric_table_name because we want to be able to set /before/ any data is ingested
+    SELECT SCHEMA_CATALOG.set_series_partitions_on_metric_table(
+        (SELECT table_name FROM SCHEMA_CATALOG.get_or_create_metric_table_name(set_metric_series_partitions.metric_name)),
+        number_partitions);
+
+    SELECT true;
+$func$
+LANGUAGE SQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.set_metric_series_partitions(TEXT, INT)
+IS 'partition a specific metric by the hash of series_id, which requires the metric to have no data yet';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.set_metric_series_partitions(TEXT, INT) TO prom_admin;
+
+--returns the write shards of a metric table, the tables its samples are
+--spread across besides the metric table itself, in the order of the shards.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_metric_write_shards(metric_table NAME)
+RETURNS SETOF NAME
+AS $func$
+    SELECT s.table_name
+    FROM SCHEMA_CATALOG.metric_write_shard s
+    INNER JOIN SCHEMA_CATALOG.metric m ON (m.id = s.metric_id)
+    WHERE m.table_schema = 'SCHEMA_DATA'
+    AND m.table_name = metric_table
+    ORDER BY s.shard
+$func$
+LANGUAGE SQL STABLE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_metric_write_shards(NAME) TO prom_reader;
+
+--returns the schema of the relation holding all the samples of a metric: the
+--schema of the views of the sharded metrics for the metric tables with write
+--shards, the schema of the metric table otherwise.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_metric_read_schema(metric_schema NAME, metric_table NAME)
+RETURNS NAME
+AS $func$
+    SELECT CASE
+        WHEN metric_schema = 'SCHEMA_DATA' AND EXISTS (SELECT 1 FROM SCHEMA_CATALOG.get_metric_write_shards(metric_table))
+        THEN 'SCHEMA_DATA_SHARDED'::NAME
+        ELSE metric_schema
+    END
+$func$
+LANGUAGE SQL STABLE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_metric_read_schema(NAME, NAME) TO prom_reader;
+
+--spreads the inserts into a metric table across number_shards tables by
+--series, so that the inserts into a very hot metric contend on the locks and
+--indexes of several tables rather than one. The metric table is the shard 0,
+--the other shards are created in SCHEMA_DATA with the same chunk interval,
+--series partitions and compression, and the view of the metric in
+--SCHEMA_DATA_SHARDED is the union of all of them. Shards are never dropped
+--while the metric exists, since they hold samples: lowering the number of
+--shards only stops the inserts into the shards above it.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.set_write_shards_on_metric_table(metric_table NAME, number_shards INT)
+RETURNS void
+AS $func$
+DECLARE
+    m SCHEMA_CATALOG.metric;
+    shard_num INT;
+    shard_table NAME;
+    chunk_interval BIGINT;
+    compressed BOOLEAN;
+    series_partitions INT;
+    shard_selects TEXT;
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed()
+            OR SCHEMA_CATALOG.get_timescale_major_version() < 2
+            OR SCHEMA_CATALOG.is_multinode() THEN
+        RAISE EXCEPTION 'sharding metrics requires single-node TimescaleDB 2';
+    END IF;
+    IF number_shards < 1 THEN
+        RAISE EXCEPTION 'invalid number of write shards %, must be at least 1', number_shards;
+    END IF;
+
+    SELECT * INTO STRICT m
+    FROM SCHEMA_CATALOG.metric
+    WHERE table_schema = 'SCHEMA_DATA'
+    AND table_name = metric_table
+    AND NOT is_view;
+
+    SELECT d.interval_length, h.compressed_hypertable_id IS NOT NULL
+    INTO STRICT chunk_interval, compressed
+    FROM _timescaledb_catalog.dimension d
+    INNER JOIN _timescaledb_catalog.hypertable h ON (h.id = d.hypertable_id)
+    WHERE h.schema_name = 'SCHEMA_DATA'
+    AND h.table_name = metric_table
+    AND d.column_name = 'time';
+    series_partitions := SCHEMA_CATALOG.get_metric_series_partitions(metric_table);
+
+    FOR shard_num IN 1..number_shards-1 LOOP
+        CONTINUE WHEN EXISTS (
+            SELECT 1 FROM SCHEMA_CATALOG.metric_write_shard s
+            WHERE s.metric_id = m.id AND s.shard = shard_num
+        );
+
+        shard_table := SCHEMA_CATALOG.pg_name_with_suffix(metric_table, format('shard_%s_%s', m.id, shard_num));
+        EXECUTE format('CREATE TABLE SCHEMA_DATA.%I(time TIMESTAMPTZ NOT NULL, value DOUBLE PRECISION NOT NULL, series_id BIGINT NOT NULL) WITH (autovacuum_vacuum_threshold = 50000, autovacuum_analyze_threshold = 50000)',
+                        shard_table);
+        EXECUTE format('GRANT SELECT ON TABLE SCHEMA_DATA.%I TO prom_reader', shard_table);
+        EXECUTE format('GRANT SELECT, INSERT ON TABLE SCHEMA_DATA.%I TO prom_writer', shard_table);
+        EXECUTE format('GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_DATA.%I TO prom_modifier', shard_table);
+        EXECUTE format('CREATE UNIQUE INDEX data_series_id_time_%s_%s ON SCHEMA_DATA.%I (series_id, time) INCLUDE (value)',
+                        m.id, shard_num, shard_table);
+
+        PERFORM SCHEMA_TIMESCALE.create_hypertable(format('SCHEMA_DATA.%I', shard_table), 'time',
+            chunk_time_interval=>chunk_interval,
+            create_default_indexes=>false);
+        --a dimension can only be added while the table is empty
+        IF series_partitions > 0 THEN
+            PERFORM SCHEMA_TIMESCALE.add_dimension(format('SCHEMA_DATA.%I', shard_table), 'series_id',
+                number_partitions=>series_partitions);
+        END IF;
+        IF compressed THEN
+            PERFORM SCHEMA_PROM.set_compression_on_metric_table(shard_table, true);
+        END IF;
+
+        INSERT INTO SCHEMA_CATALOG.metric_write_shard(metric_id, shard, table_name)
+        VALUES (m.id, shard_num, shard_table);
+    END LOOP;
+
+    UPDATE SCHEMA_CATALOG.metric SET write_shards = number_shards
+    WHERE id = m.id;
+
+    IF NOT EXISTS (SELECT 1 FROM SCHEMA_CATALOG.get_metric_write_shards(metric_table)) THEN
+        RETURN;
+    END IF;
+
+    SELECT string_agg(format('SELECT time, value, series_id FROM SCHEMA_DATA.%I', t), ' UNION ALL ')
+    INTO STRICT shard_selects
+    FROM (
+        SELECT metric_table
+        UNION ALL
+        SELECT SCHEMA_CATALOG.get_metric_write_shards(metric_table)
+    ) AS shard_tables(t);
+    EXECUTE format('CREATE OR REPLACE VIEW SCHEMA_DATA_SHARDED.%I AS %s', metric_table, shard_selects);
+    EXECUTE format('GRANT SELECT ON SCHEMA_DATA_SHARDED.%I TO prom_reader', metric_table);
+
+    --the views of the metric read all its shards from now on.
+    IF EXISTS (SELECT 1 FROM SCHEMA_CATALOG.label_key_position lkp WHERE lkp.metric_name = m.metric_name) THEN
+        PERFORM SCHEMA_CATALOG.create_metric_view(m.metric_name);
+        PERFORM SCHEMA_CATALOG.create_metric_labeled_view(m.metric_name);
+    END IF;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.set_write_shards_on_metric_table(NAME, INT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.set_write_shards_on_metric_table(NAME, INT) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_metric_write_shards(metric_name TEXT, number_shards INT)
+RETURNS BOOLEAN
+AS $func$
+    --use get_or_create_metric_table_name because we want to be able to set /before/ any data is ingested
+    SELECT SCHEMA_CATALOG.set_write_shards_on_metric_table(
+        (SELECT table_name FROM SCHEMA_CATALOG.get_or_create_metric_table_name(set_metric_write_shards.metric_name)),
+        number_shards);
+
+    SELECT true;
+$func$
+LANGUAGE SQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.set_metric_write_shards(TEXT, INT)
+IS 'spread the inserts into a specific metric across a number of tables by series, to reduce the contention of very hot metrics';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.set_metric_write_shards(TEXT, INT) TO prom_admin;
+
+--estimates the samples per second of a metric from its approximate row count
+--and the time range covered by its chunks. Returns NULL if the chunks cover
+--less than a day, since the rate of a new metric is not known yet.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_metric_sample_rate(metric_table NAME)
+RETURNS DOUBLE PRECISION
+AS $func$
+DECLARE
+    covered INTERVAL;
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() OR SCHEMA_CATALOG.get_timescale_major_version() < 2 THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT least(max(c.range_end), now()) - min(c.range_start) INTO covered
+    FROM timescaledb_information.chunks c
+    WHERE c.hypertable_schema = 'SCHEMA_DATA'
+    AND c.hypertable_name = metric_table;
+
+    IF covered IS NULL OR covered < INTERVAL '1 day' THEN
+        RETURN NULL;
+    END IF;
+    RETURN SCHEMA_CATALOG.safe_approximate_row_count(format('SCHEMA_DATA.%I', metric_table)::regclass) / extract(epoch FROM covered);
+END
+$func$
+LANGUAGE PLPGSQL STABLE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_metric_sample_rate(NAME) TO prom_reader;
+
+--loads the chunks of a metric table overlapping the time range, and their
+--indexes, into the shared buffers with pg_prewarm, so that the next query
+--reading them, e.g. the next refresh of a dashboard, does not wait on the
+--disk. The compressed data is loaded for compressed chunks. Returns the
+--number of blocks loaded, or NULL if pg_prewarm is not installed.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.prewarm_metric_chunks(metric_schema NAME, metric_table NAME, start_time TIMESTAMPTZ, end_time TIMESTAMPTZ)
+RETURNS BIGINT
+AS $func$
+DECLARE
+    prewarm_schema NAME;
+    rel REGCLASS;
+    blocks BIGINT := 0;
+    rel_blocks BIGINT;
+BEGIN
+    SELECT n.nspname INTO prewarm_schema
+    FROM pg_catalog.pg_extension e
+    INNER JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace
+    WHERE e.extname = 'pg_prewarm';
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() OR SCHEMA_CATALOG.get_timescale_major_version() < 2 THEN
+        RETURN 0;
+    END IF;
+
+    FOR rel IN
+        WITH chunk AS (
+            SELECT format('%I.%I', coalesce(chc.schema_name, ch.schema_name), coalesce(chc.table_name, ch.table_name))::regclass AS rel
+            FROM timescaledb_information.chunks c
+            INNER JOIN _timescaledb_catalog.chunk ch ON (ch.schema_name, ch.table_name) = (c.chunk_schema, c.chunk_name)
+            LEFT JOIN _timescaledb_catalog.chunk chc ON ch.compressed_chunk_id = chc.id
+            WHERE c.hypertable_schema = metric_schema
+            AND c.hypertable_name = metric_table
+            AND c.data_nodes IS NULL
+            AND c.range_start < end_time
+            AND c.range_end > start_time
+        )
+        SELECT chunk.rel FROM chunk
+        UNION ALL
+        SELECT i.indexrelid::regclass FROM chunk INNER JOIN pg_catalog.pg_index i ON i.indrelid = chunk.rel
+    LOOP
+        EXECUTE format('SELECT %I.pg_prewarm($1)', prewarm_schema) INTO rel_blocks USING rel;
+        blocks := blocks + rel_blocks;
+    END LOOP;
+    RETURN blocks;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.prewarm_metric_chunks(NAME, NAME, TIMESTAMPTZ, TIMESTAMPTZ) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.prewarm_metric_chunks(NAME, NAME, TIMESTAMPTZ, TIMESTAMPTZ) TO prom_reader;
+
+--evaluates rate, increase or delta over the samples of a series ordered by
+--time, without the staleness markers, at every step from lowest_time +
+--range_ms to greatest_time, extrapolating the change of the samples of each
+--range to its bounds as Prometheus does. The steps whose range has less than
+--two samples with distinct times are NULL. This is used to push the
+--functions down when the Promscale extension is not installed.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.extrapolated_delta(
+        lowest_time TIMESTAMPTZ, greatest_time TIMESTAMPTZ, step_ms BIGINT, range_ms BIGINT,
+        times TIMESTAMPTZ[], vals DOUBLE PRECISION[], is_counter BOOLEAN, is_rate BOOLEAN)
+    RETURNS DOUBLE PRECISION[]
+AS $func$
+DECLARE
+    n INT := coalesce(cardinality(times), 0);
+    ms BIGINT[];
+    --resets[i] is the sum of the values before the counter resets up to i
+    resets DOUBLE PRECISION[];
+    result DOUBLE PRECISION[] := '{}';
+    eval_ms BIGINT := round(extract(epoch FROM lowest_time) * 1000) + range_ms;
+    last_ms BIGINT := round(extract(epoch FROM greatest_time) * 1000);
+    first_i INT := 1;
+    last_i INT := 0;
+    delta DOUBLE PRECISION;
+    sampled DOUBLE PRECISION;
+    average DOUBLE PRECISION;
+    to_start DOUBLE PRECISION;
+    to_end DOUBLE PRECISION;
+BEGIN
+    FOR i IN 1..n LOOP
+        ms[i] := round(extract(epoch FROM times[i]) * 1000);
+        resets[i] := CASE
+            WHEN i = 1 THEN 0
+            WHEN vals[i] < vals[i - 1] AND vals[i - 1] <> 'NaN' THEN resets[i - 1] + vals[i - 1]
+            ELSE resets[i - 1]
+        END;
+    END LOOP;
+
+    WHILE eval_ms <= last_ms LOOP
+        WHILE first_i <= n AND ms[first_i] < eval_ms - range_ms LOOP
+            first_i := first_i + 1;
+        END LOOP;
+        WHILE last_i < n AND ms[last_i + 1] <= eval_ms LOOP
+            last_i := last_i + 1;
+        END LOOP;
+
+        IF last_i - first_i < 1 OR ms[last_i] = ms[first_i] THEN
+            result := array_append(result, NULL);
+        ELSE
+            delta := vals[last_i] - vals[first_i];
+            IF is_counter THEN
+                delta := delta + resets[last_i] - resets[first_i];
+            END IF;
+            sampled := (ms[last_i] - ms[first_i]) / 1000.0;
+            average := sampled / (last_i - first_i);
+            to_start := (ms[first_i] - (eval_ms - range_ms)) / 1000.0;
+            to_end := (eval_ms - ms[last_i]) / 1000.0;
+            --counters cannot be negative, so the range is not extrapolated
+            --past the time the counter would have been zero
+            IF is_counter AND delta > 0 AND delta <> 'NaN' AND vals[first_i] >= 0 AND vals[first_i] <> 'NaN' THEN
+                to_start := least(to_start, sampled * (vals[first_i] / delta));
+            END IF;
+            delta := delta * (sampled
+                + CASE WHEN to_start < average * 1.1 THEN to_start ELSE average / 2 END
+                + CASE WHEN to_end < average * 1.1 THEN to_end ELSE average / 2 END) / sampled;
+            IF is_rate THEN
+                delta := delta / (range_ms / 1000.0);
+            END IF;
+            result := array_append(result, delta);
+        END IF;
+        eval_ms := eval_ms + step_ms;
+    END LOOP;
+    RETURN result;
+END
+$func$
+LANGUAGE PLPGSQL IMMUTABLE PARALLEL SAFE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.extrapolated_delta(TIMESTAMPTZ, TIMESTAMPTZ, BIGINT, BIGINT, TIMESTAMPTZ[], DOUBLE PRECISION[], BOOLEAN, BOOLEAN) TO prom_reader;
+
+--switches a metric table between the dense and the sparse storage mode.
+--Sparse metrics, e.g. events or job runs, get long chunks so that each chunk,
+--and each compressed segment of a series, holds more than a handful of
+--samples, and an index covering queries by time across all the series, which
+--the long chunks do not narrow down much. Explicitly set chunk intervals are
+--kept.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.set_sparse_on_metric_table(metric_table NAME, is_sparse BOOLEAN)
+RETURNS void
+AS $func$
+DECLARE
+    m SCHEMA_CATALOG.metric;
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() THEN
+        RAISE EXCEPTION 'cannot set the storage mode of a metric without timescaledb installed';
+    END IF;
+
+    SELECT * INTO STRICT m
+    FROM SCHEMA_CATALOG.metric
+    WHERE table_schema = 'SCHEMA_DATA'
+    AND table_name = metric_table;
+
+    UPDATE SCHEMA_CATALOG.metric SET sparse = is_sparse
+    WHERE id = m.id;
+
+    IF m.default_chunk_interval THEN
+        PERFORM SCHEMA_CATALOG.set_chunk_interval_on_metric_table(m.metric_name,
+            CASE WHEN is_sparse THEN SCHEMA_CATALOG.get_sparse_chunk_interval() ELSE SCHEMA_CATALOG.get_default_chunk_interval() END);
+    END IF;
+
+    IF is_sparse THEN
+        EXECUTE format('CREATE INDEX IF NOT EXISTS data_time_series_id_%s ON SCHEMA_DATA.%I (time, series_id) INCLUDE (value)',
+            m.id, m.table_name);
+    ELSE
+        EXECUTE format('DROP INDEX IF EXISTS SCHEMA_DATA.data_time_series_id_%s', m.id);
+    END IF;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.set_sparse_on_metric_table(NAME, BOOLEAN) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.set_sparse_on_metric_table(NAME, BOOLEAN) TO prom_admin;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.set_sparse_on_metric_table(NAME, BOOLEAN) TO prom_maintenance;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_metric_sparse(metric_name TEXT, is_sparse BOOLEAN)
+RETURNS BOOLEAN
+AS $func$
+    --use get_or_create_metric_table_name because we want to be able to set /before/ any data is ingested
+    --needs to run before update so row exists before update.
+    SELECT SCHEMA_CATALOG.get_or_create_metric_table_name(set_metric_sparse.metric_name);
+
+    UPDATE SCHEMA_CATALOG.metric SET sparse_automatic = false
+    WHERE id IN (SELECT id FROM SCHEMA_CATALOG.get_metric_table_name_if_exists('SCHEMA_DATA', set_metric_sparse.metric_name));
+
+    SELECT SCHEMA_CATALOG.set_sparse_on_metric_table(
+        (SELECT table_name FROM SCHEMA_CATALOG.get_or_create_metric_table_name(set_metric_sparse.metric_name)),
+        is_sparse);
+
+    SELECT true;
+$func$
+LANGUAGE SQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.set_metric_sparse(TEXT, BOOLEAN)
+IS 'store a specific metric in the sparse or the dense storage mode instead of selecting it from the sample rate';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.set_metric_sparse(TEXT, BOOLEAN) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.reset_metric_sparse(metric_name TEXT)
+RETURNS BOOLEAN
+AS $func$
+    UPDATE SCHEMA_CATALOG.metric SET sparse_automatic = true
+    WHERE id = (SELECT id FROM SCHEMA_CATALOG.get_metric_table_name_if_exists('SCHEMA_DATA', metric_name));
+
+    SELECT true;
+$func$
+LANGUAGE SQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.reset_metric_sparse(TEXT)
+IS 'resets the storage mode of a specific metric to being selected from the sample rate by the maintenance jobs';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.reset_metric_sparse(TEXT) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_sparse_sample_rate(samples_per_second DOUBLE PRECISION)
+RETURNS BOOLEAN
+AS $func$
+    INSERT INTO SCHEMA_CATALOG.default(key, value) VALUES('sparse_sample_rate', samples_per_second::text)
+    ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
+
+    SELECT true;
+$func$
+LANGUAGE SQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.set_sparse_sample_rate(DOUBLE PRECISION)
+IS 'set the number of samples per second below which metrics are stored in the sparse storage mode';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.set_sparse_sample_rate(DOUBLE PRECISION) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_sparse_chunk_interval(chunk_interval INTERVAL)
+RETURNS BOOLEAN
+AS $func$
+    INSERT INTO SCHEMA_CATALOG.default(key, value) VALUES('sparse_chunk_interval', chunk_interval::text)
+    ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
+
+    SELECT SCHEMA_CATALOG.set_chunk_interval_on_metric_table(metric_name, chunk_interval)
+    FROM SCHEMA_CATALOG.metric
+    WHERE default_chunk_interval AND sparse;
+
+    SELECT true;
+$func$
+LANGUAGE SQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.set_sparse_chunk_interval(INTERVAL)
+IS 'set the chunk interval of the metrics stored in the sparse storage mode without an explicit chunk interval';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.set_sparse_chunk_interval(INTERVAL) TO prom_admin;
+
 CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_metric_retention_period(schema_name TEXT, metric_name TEXT)
 RETURNS INTERVAL
 AS $$
@@ -1453,6 +2082,7 @@ CREATE OR REPLACE FUNCTION SCHEMA_PROM.set_compression_on_metric_table(metric_ta
 RETURNS void
 AS $func$
 DECLARE
+    shard_table NAME;
 BEGIN
     IF SCHEMA_CATALOG.is_timescaledb_oss() THEN
         RAISE NOTICE 'Compression not available in TimescaleDB-OSS. Cannot set compression on "%" metric table name', metric_table_name;
@@ -1496,6 +2126,10 @@ BEGIN
                 timescaledb.compress = false
             ); $$, metric_table_name);
     END IF;
+
+    FOR shard_table IN SELECT * FROM SCHEMA_CATALOG.get_metric_write_shards(metric_table_name::name) LOOP
+        PERFORM SCHEMA_PROM.set_compression_on_metric_table(shard_table, compression_setting);
+    END LOOP;
 END
 $func$
 LANGUAGE PLPGSQL VOLATILE
@@ -1582,7 +2216,7 @@ BEGIN
             LIMIT 1
         ) as lateral_exists(indicator) ON (true)
         WHERE lateral_exists.indicator IS NULL
-    $query$, r.table_schema, r.table_name, check_time_condition)
+    $query$, SCHEMA_CATALOG.get_metric_read_schema(r.table_schema, r.table_name), r.table_name, check_time_condition)
 		USING potential_series_ids
     INTO potential_series_ids;
 
@@ -1742,6 +2376,7 @@ CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.drop_metric_chunk_data(
 DECLARE
     metric_schema NAME;
     metric_table NAME;
+    shard_table NAME;
 BEGIN
     SELECT table_schema, table_name
     INTO STRICT metric_schema, metric_table
@@ -1753,6 +2388,15 @@ BEGIN
                 relation=>format('%I.%I', metric_schema, metric_table),
                 older_than=>older_than
             );
+            --metrics can only be sharded with TimescaleDB 2
+            IF metric_schema = 'SCHEMA_DATA' THEN
+                FOR shard_table IN SELECT * FROM SCHEMA_CATALOG.get_metric_write_shards(metric_table) LOOP
+                    PERFORM SCHEMA_TIMESCALE.drop_chunks(
+                        relation=>format('SCHEMA_DATA.%I', shard_table),
+                        older_than=>older_than
+                    );
+                END LOOP;
+            END IF;
         ELSE
             PERFORM SCHEMA_TIMESCALE.drop_chunks(
                 table_name=>metric_table,
@@ -1776,9 +2420,56 @@ REVOKE ALL ON FUNCTION SCHEMA_CATALOG.drop_metric_chunk_data(text, text, timesta
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.drop_metric_chunk_data(text, text, timestamptz) TO prom_maintenance;
 
 --drop chunks from metrics tables and delete the appropriate series.
-CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.drop_metric_chunks(
-    schema_name TEXT, metric_name TEXT, older_than TIMESTAMPTZ, ran_at TIMESTAMPTZ = now(), log_verbose BOOLEAN = FALSE
-) AS $func$
+--exemplars are expired with the samples of their metric
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.delete_expired_exemplars(metric TEXT, older_than TIMESTAMPTZ)
+RETURNS VOID
+AS $$
+    DELETE FROM SCHEMA_CATALOG.exemplar e WHERE e.metric_name = metric AND e.time < older_than
+$$
+LANGUAGE SQL VOLATILE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.delete_expired_exemplars(TEXT, TIMESTAMPTZ) TO prom_maintenance;
+
+--the chunks of the exemplars are dropped whole once they are older than the
+--retention period of every metric
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.drop_exemplar_chunks()
+RETURNS VOID AS $func$
+DECLARE
+    older_than TIMESTAMPTZ;
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() OR NOT EXISTS (
+        SELECT FROM _timescaledb_catalog.hypertable h
+        WHERE h.schema_name = 'SCHEMA_CATALOG' AND h.table_name = 'exemplar'
+    ) THEN
+        RETURN;
+    END IF;
+
+    SELECT now() - greatest(SCHEMA_CATALOG.get_default_retention_period(), max(m.retention_period))
+    INTO older_than
+    FROM SCHEMA_CATALOG.metric m;
+
+    IF SCHEMA_CATALOG.get_timescale_major_version() >= 2 THEN
+        PERFORM SCHEMA_TIMESCALE.drop_chunks(relation=>'SCHEMA_CATALOG.exemplar', older_than=>older_than);
+    ELSE
+        PERFORM SCHEMA_TIMESCALE.drop_chunks(
+            table_name=>'exemplar',
+            schema_name=>'SCHEMA_CATALOG',
+            older_than=>older_than,
+            cascade_to_materializations=>FALSE
+        );
+    END IF;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.drop_exemplar_chunks() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.drop_exemplar_chunks() TO prom_maintenance;
+
+CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.drop_metric_chunks(
+    schema_name TEXT, metric_name TEXT, older_than TIMESTAMPTZ, ran_at TIMESTAMPTZ = now(), log_verbose BOOLEAN = FALSE
+) AS $func$
 DECLARE
     metric_id int;
     metric_schema NAME;
@@ -1860,6 +2551,7 @@ BEGIN
         lastT := clock_timestamp();
         PERFORM set_config('application_name', format('promscale maintenance: data retention: metric %s: drop chunks', metric_name), false);
         PERFORM SCHEMA_CATALOG.drop_metric_chunk_data(metric_schema, metric_name, older_than);
+        PERFORM SCHEMA_CATALOG.delete_expired_exemplars(metric_name, older_than);
         IF log_verbose THEN
             RAISE LOG 'promscale maintenance: data retention: metric %: done dropping chunks in %', metric_name, clock_timestamp()-lastT;
         END IF;
@@ -2002,12 +2694,332 @@ BEGIN
 
         COMMIT;
     END LOOP;
+
+    PERFORM set_config('application_name', 'promscale maintenance: data retention: drop exemplar chunks', false);
+    PERFORM SCHEMA_CATALOG.drop_exemplar_chunks();
+    COMMIT;
 END;
 $$ LANGUAGE PLPGSQL;
 COMMENT ON PROCEDURE SCHEMA_CATALOG.execute_data_retention_policy(boolean)
 IS 'drops old data according to the data retention policy. This procedure should be run regularly in a cron job';
 GRANT EXECUTE ON PROCEDURE SCHEMA_CATALOG.execute_data_retention_policy(boolean) TO prom_maintenance;
 
+--get the ids of the series of a tenant in a metric of the data schema.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.get_tenant_series_ids(metric_table name, tenant_name text)
+RETURNS bigint[]
+AS $$
+    SELECT array_agg(s.id)
+    FROM SCHEMA_CATALOG.series s
+    INNER JOIN SCHEMA_CATALOG.metric m ON (m.id = s.metric_id)
+    WHERE m.table_name = metric_table
+    AND m.table_schema = 'SCHEMA_DATA'
+    AND s.labels && ARRAY(
+        SELECT l.id FROM SCHEMA_CATALOG.label l
+        WHERE l.key = '__tenant__' AND l.value = tenant_name
+    )::int[]
+$$
+LANGUAGE SQL STABLE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.get_tenant_series_ids(name, text) TO prom_reader;
+
+--delete the samples of a tenant older than the given time from a metric. Only
+--whole chunks older than the time are processed, like with drop_chunks, so
+--that the rows of compressed chunks can be deleted by series.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.delete_expired_tenant_data(metric_table name, tenant_name text, older_than TIMESTAMPTZ)
+RETURNS BIGINT
+AS
+$$
+DECLARE
+    series_ids bigint[];
+    delete_stmt text;
+    rows_affected bigint;
+    num_rows_deleted bigint := 0;
+BEGIN
+    series_ids := SCHEMA_CATALOG.get_tenant_series_ids(metric_table, tenant_name);
+    IF series_ids IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    IF SCHEMA_CATALOG.is_timescaledb_installed() THEN
+        FOR delete_stmt IN
+            SELECT FORMAT('DELETE FROM %1$I.%2$I WHERE series_id = ANY($1)', schema_name, table_name)
+            FROM (
+                SELECT (COALESCE(chc, ch)).* FROM pg_class c
+                    INNER JOIN pg_namespace n ON c.relnamespace = n.oid
+                    INNER JOIN _timescaledb_catalog.chunk ch ON (ch.schema_name, ch.table_name) = (n.nspname, c.relname)
+                    LEFT JOIN _timescaledb_catalog.chunk chc ON ch.compressed_chunk_id = chc.id
+                --the chunks of the metric table and of its write shards
+                WHERE c.oid IN (
+                    SELECT SCHEMA_TIMESCALE.show_chunks(format('%I.%I','SCHEMA_DATA', t), older_than=>older_than)::oid
+                    FROM (SELECT metric_table UNION ALL SELECT SCHEMA_CATALOG.get_metric_write_shards(metric_table)) AS shard_tables(t)
+                )
+                ) a
+        LOOP
+            EXECUTE delete_stmt USING series_ids;
+            GET DIAGNOSTICS rows_affected = ROW_COUNT;
+            num_rows_deleted = num_rows_deleted + rows_affected;
+        END LOOP;
+    ELSE
+        EXECUTE FORMAT('DELETE FROM SCHEMA_DATA.%1$I WHERE series_id = ANY($1) AND time < $2', metric_table) USING series_ids, older_than;
+        GET DIAGNOSTICS rows_affected = ROW_COUNT;
+        num_rows_deleted = num_rows_deleted + rows_affected;
+    END IF;
+    RETURN num_rows_deleted;
+END;
+$$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.delete_expired_tenant_data(name, text, timestamptz) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.delete_expired_tenant_data(name, text, timestamptz) TO prom_maintenance;
+
+CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.execute_tenant_retention_policy(log_verbose boolean)
+AS $$
+DECLARE
+    t SCHEMA_CATALOG.tenant;
+    r SCHEMA_CATALOG.metric;
+    rows_deleted bigint;
+BEGIN
+    FOR t IN
+        SELECT *
+        FROM SCHEMA_CATALOG.tenant
+        WHERE retention_period IS NOT NULL
+    LOOP
+        FOR r IN
+            SELECT *
+            FROM SCHEMA_CATALOG.metric m
+            WHERE m.is_view = FALSE
+            AND m.table_schema = 'SCHEMA_DATA'
+        LOOP
+            PERFORM set_config('application_name', format('promscale maintenance: tenant retention: tenant %s: metric %s', t.name, r.metric_name), false);
+            PERFORM SCHEMA_CATALOG.lock_metric_for_maintenance(r.id);
+            rows_deleted := SCHEMA_CATALOG.delete_expired_tenant_data(r.table_name, t.name, NOW() - t.retention_period);
+            PERFORM SCHEMA_CATALOG.unlock_metric_for_maintenance(r.id);
+
+            IF log_verbose AND rows_deleted > 0 THEN
+                RAISE LOG 'promscale maintenance: tenant retention: tenant %: metric %: deleted % rows', t.name, r.metric_name, rows_deleted;
+            END IF;
+
+            COMMIT;
+        END LOOP;
+    END LOOP;
+END;
+$$ LANGUAGE PLPGSQL;
+COMMENT ON PROCEDURE SCHEMA_CATALOG.execute_tenant_retention_policy(boolean)
+IS 'deletes the data of tenants older than their retention period';
+GRANT EXECUTE ON PROCEDURE SCHEMA_CATALOG.execute_tenant_retention_policy(boolean) TO prom_maintenance;
+
+--delete all the series of a tenant from a metric, returning the number of
+--series that were not already deleted and the number of deleted samples.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.delete_tenant_series_from_metric(metric_name text, tenant_name text)
+RETURNS TABLE (series_deleted bigint, rows_deleted bigint)
+AS
+$$
+DECLARE
+    metric_table name;
+    series_ids bigint[];
+BEGIN
+    SELECT m.table_name INTO metric_table
+    FROM SCHEMA_CATALOG.metric m
+    WHERE m.metric_name = delete_tenant_series_from_metric.metric_name
+    AND m.table_schema = 'SCHEMA_DATA'
+    AND m.is_view = false;
+
+    series_ids := SCHEMA_CATALOG.get_tenant_series_ids(metric_table, tenant_name);
+    IF series_ids IS NULL THEN
+        RETURN QUERY SELECT 0::bigint, 0::bigint;
+        RETURN;
+    END IF;
+
+    SELECT count(*) INTO series_deleted
+    FROM SCHEMA_CATALOG.series s
+    WHERE s.id = ANY(series_ids) AND s.delete_epoch IS NULL;
+
+    rows_deleted := SCHEMA_CATALOG.delete_series_from_metric(delete_tenant_series_from_metric.metric_name, series_ids);
+    RETURN NEXT;
+END;
+$$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.delete_tenant_series_from_metric(text, text) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.delete_tenant_series_from_metric(text, text) TO prom_modifier;
+
+--count what is left of a tenant after its data was purged: the series that
+--are not marked for deletion and the samples of all its series.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.verify_tenant_purge(tenant_name text)
+RETURNS TABLE (live_series bigint, remaining_rows bigint)
+AS
+$$
+DECLARE
+    r SCHEMA_CATALOG.metric;
+    series_ids bigint[];
+    metric_rows bigint;
+BEGIN
+    live_series := 0;
+    remaining_rows := 0;
+    FOR r IN
+        SELECT *
+        FROM SCHEMA_CATALOG.metric m
+        WHERE m.is_view = FALSE
+        AND m.table_schema = 'SCHEMA_DATA'
+    LOOP
+        series_ids := SCHEMA_CATALOG.get_tenant_series_ids(r.table_name, tenant_name);
+        CONTINUE WHEN series_ids IS NULL;
+
+        live_series := live_series + (
+            SELECT count(*) FROM SCHEMA_CATALOG.series s
+            WHERE s.id = ANY(series_ids) AND s.delete_epoch IS NULL
+        );
+        EXECUTE FORMAT('SELECT count(*) FROM %I.%I WHERE series_id = ANY($1)',
+            SCHEMA_CATALOG.get_metric_read_schema(r.table_schema, r.table_name), r.table_name)
+        INTO metric_rows USING series_ids;
+        remaining_rows := remaining_rows + metric_rows;
+    END LOOP;
+    RETURN NEXT;
+END;
+$$
+LANGUAGE PLPGSQL STABLE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.verify_tenant_purge(text) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.verify_tenant_purge(text) TO prom_modifier;
+
+--keep the planner statistics of a catalog table fresh: large tables get a
+--smaller autovacuum analyze scale factor, since their statistics go stale long
+--before the default one triggers, and the table is analyzed right away when
+--it changed a lot since it was last analyzed, e.g. after many new series.
+--returns true if the table was analyzed.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.maintain_table_stats(schema_name name, table_name name)
+RETURNS BOOLEAN
+AS $$
+DECLARE
+    live_rows bigint;
+    modified_rows bigint;
+    scale_factor text;
+BEGIN
+    SELECT s.n_live_tup, s.n_mod_since_analyze INTO live_rows, modified_rows
+    FROM pg_stat_user_tables s
+    WHERE s.schemaname = maintain_table_stats.schema_name
+    AND s.relname = maintain_table_stats.table_name;
+
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+
+    --do not hold up the writers, e.g. a new label key locks the series table
+    BEGIN
+        EXECUTE FORMAT('LOCK TABLE %I.%I IN SHARE UPDATE EXCLUSIVE MODE NOWAIT', schema_name, table_name);
+    EXCEPTION WHEN lock_not_available THEN
+        RETURN false;
+    END;
+
+    scale_factor := CASE
+        WHEN live_rows > 10000000 THEN '0.005'
+        WHEN live_rows > 1000000 THEN '0.02'
+        ELSE '0.1'
+    END;
+
+    PERFORM *
+    FROM pg_class c
+    INNER JOIN pg_namespace n ON (n.oid = c.relnamespace)
+    WHERE n.nspname = maintain_table_stats.schema_name
+    AND c.relname = maintain_table_stats.table_name
+    AND 'autovacuum_analyze_scale_factor=' || scale_factor = ANY(c.reloptions);
+
+    IF NOT FOUND THEN
+        EXECUTE FORMAT('ALTER TABLE %I.%I SET (autovacuum_analyze_scale_factor = %s)', schema_name, table_name, scale_factor);
+    END IF;
+
+    IF modified_rows > greatest(1000, live_rows * scale_factor::float8) THEN
+        EXECUTE FORMAT('ANALYZE %I.%I', schema_name, table_name);
+        RETURN true;
+    END IF;
+    RETURN false;
+END;
+$$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.maintain_table_stats(name, name) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.maintain_table_stats(name, name) TO prom_maintenance;
+
+CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.execute_stats_maintenance(log_verbose boolean)
+AS $$
+DECLARE
+    r RECORD;
+BEGIN
+    FOR r IN
+        SELECT 'SCHEMA_CATALOG'::name AS schema_name, t.table_name::name AS table_name
+        FROM unnest(ARRAY['label', 'label_key', 'label_key_position']) AS t(table_name)
+        UNION ALL
+        SELECT 'SCHEMA_DATA_SERIES'::name, m.table_name
+        FROM SCHEMA_CATALOG.metric m
+        WHERE m.table_schema = 'SCHEMA_DATA'
+        AND m.is_view = FALSE
+    LOOP
+        PERFORM set_config('application_name', format('promscale maintenance: stats: table %s.%s', r.schema_name, r.table_name), false);
+        IF SCHEMA_CATALOG.maintain_table_stats(r.schema_name, r.table_name) AND log_verbose THEN
+            RAISE LOG 'promscale maintenance: stats: analyzed %.% after it changed', r.schema_name, r.table_name;
+        END IF;
+
+        COMMIT;
+    END LOOP;
+END;
+$$ LANGUAGE PLPGSQL;
+COMMENT ON PROCEDURE SCHEMA_CATALOG.execute_stats_maintenance(boolean)
+IS 'tunes the autovacuum analyze settings of the series and label tables and analyzes the ones that changed a lot';
+GRANT EXECUTE ON PROCEDURE SCHEMA_CATALOG.execute_stats_maintenance(boolean) TO prom_maintenance;
+
+--selects the storage mode of the metrics without an explicit one from their
+--sample rate. Metrics only switch back to the dense mode well above the
+--threshold, so that metrics close to it do not keep switching.
+CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.execute_sparse_metric_detection(log_verbose boolean)
+AS $$
+DECLARE
+    r RECORD;
+    rate DOUBLE PRECISION;
+    threshold DOUBLE PRECISION;
+BEGIN
+    IF NOT SCHEMA_CATALOG.is_timescaledb_installed() OR SCHEMA_CATALOG.get_timescale_major_version() < 2 THEN
+        RETURN;
+    END IF;
+    threshold := SCHEMA_CATALOG.get_sparse_sample_rate();
+
+    FOR r IN
+        SELECT m.table_name, m.sparse
+        FROM SCHEMA_CATALOG.metric m
+        WHERE m.table_schema = 'SCHEMA_DATA'
+        AND m.is_view = FALSE
+        AND m.creation_completed
+        AND m.sparse_automatic
+    LOOP
+        rate := SCHEMA_CATALOG.get_metric_sample_rate(r.table_name);
+        CONTINUE WHEN rate IS NULL;
+
+        IF (NOT r.sparse AND rate < threshold) OR (r.sparse AND rate > 2 * threshold) THEN
+            PERFORM set_config('application_name', format('promscale maintenance: sparse metrics: table %s', r.table_name), false);
+            PERFORM SCHEMA_CATALOG.set_sparse_on_metric_table(r.table_name, NOT r.sparse);
+            IF log_verbose THEN
+                RAISE LOG 'promscale maintenance: sparse metrics: table % switched to sparse=% at % samples per second', r.table_name, NOT r.sparse, rate;
+            END IF;
+        END IF;
+
+        COMMIT;
+    END LOOP;
+END;
+$$ LANGUAGE PLPGSQL;
+COMMENT ON PROCEDURE SCHEMA_CATALOG.execute_sparse_metric_detection(boolean)
+IS 'stores the metrics with a sample rate below sparse_sample_rate in the sparse storage mode';
+GRANT EXECUTE ON PROCEDURE SCHEMA_CATALOG.execute_sparse_metric_detection(boolean) TO prom_maintenance;
+
 --public procedure to be called by cron
 --right now just does data retention but name is generic so that
 --we can add stuff later without needing people to change their cron scripts
@@ -2026,6 +3038,13 @@ BEGIN
     PERFORM set_config('application_name', format('promscale maintenance: data retention'), false);
     CALL SCHEMA_CATALOG.execute_data_retention_policy(log_verbose=>log_verbose);
 
+    IF log_verbose THEN
+        RAISE LOG 'promscale maintenance: tenant retention: starting';
+    END IF;
+
+    PERFORM set_config('application_name', format('promscale maintenance: tenant retention'), false);
+    CALL SCHEMA_CATALOG.execute_tenant_retention_policy(log_verbose=>log_verbose);
+
     IF NOT SCHEMA_CATALOG.is_timescaledb_oss() AND SCHEMA_CATALOG.get_timescale_major_version() >= 2 THEN
         IF log_verbose THEN
             RAISE LOG 'promscale maintenance: compression: starting';
@@ -2035,6 +3054,20 @@ BEGIN
         CALL SCHEMA_CATALOG.execute_compression_policy(log_verbose=>log_verbose);
     END IF;
 
+    IF log_verbose THEN
+        RAISE LOG 'promscale maintenance: stats: starting';
+    END IF;
+
+    PERFORM set_config('application_name', format('promscale maintenance: stats'), false);
+    CALL SCHEMA_CATALOG.execute_stats_maintenance(log_verbose=>log_verbose);
+
+    IF log_verbose THEN
+        RAISE LOG 'promscale maintenance: sparse metrics: starting';
+    END IF;
+
+    PERFORM set_config('application_name', format('promscale maintenance: sparse metrics'), false);
+    CALL SCHEMA_CATALOG.execute_sparse_metric_detection(log_verbose=>log_verbose);
+
     IF log_verbose THEN
         RAISE LOG 'promscale maintenance: finished in %', clock_timestamp()-startT;
     END IF;
@@ -2279,9 +3312,9 @@ BEGIN
             series.labels
             %2$s
         FROM
-            SCHEMA_DATA.%1$I AS data
+            %3$I.%1$I AS data
             LEFT JOIN SCHEMA_DATA_SERIES.%1$I AS series ON (series.id = data.series_id)
-    $$, table_name, label_value_cols);
+    $$, table_name, label_value_cols, SCHEMA_CATALOG.get_metric_read_schema('SCHEMA_DATA', table_name));
 
     IF NOT view_exists THEN
         EXECUTE FORMAT('GRANT SELECT ON SCHEMA_METRIC.%1$I TO prom_reader', table_name);
@@ -2298,6 +3331,79 @@ SET search_path = pg_temp;
 REVOKE ALL ON FUNCTION SCHEMA_CATALOG.create_metric_view(text) FROM PUBLIC;
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.create_metric_view(text) TO prom_writer;
 
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.create_metric_labeled_view(
+        metric_name text)
+    RETURNS BOOLEAN
+AS $func$
+DECLARE
+   label_value_cols text;
+   table_name text;
+   view_exists boolean;
+BEGIN
+    SELECT
+        ',' || string_agg(
+            format ('SCHEMA_PROM.val(series.labels[%s]) AS %I',pos::int, SCHEMA_CATALOG.get_label_key_column_name_for_view(key, false))
+        , ', ' ORDER BY pos)
+    INTO STRICT label_value_cols
+    FROM SCHEMA_CATALOG.label_key_position lkp
+    WHERE lkp.metric_name = create_metric_labeled_view.metric_name and key != '__name__';
+
+    SELECT m.table_name
+    INTO STRICT table_name
+    FROM SCHEMA_CATALOG.metric m
+    WHERE m.metric_name = create_metric_labeled_view.metric_name
+    AND m.table_schema = 'SCHEMA_DATA';
+
+    SELECT COUNT(*) > 0 into view_exists
+    FROM pg_class
+    WHERE
+      relname = table_name AND
+      relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = 'SCHEMA_METRIC_LABELED');
+
+    EXECUTE FORMAT($$
+        CREATE OR REPLACE VIEW SCHEMA_METRIC_LABELED.%1$I AS
+        SELECT
+            data.time as time,
+            data.value as value,
+            data.series_id AS series_id,
+            series.labels
+            %2$s
+        FROM
+            %3$I.%1$I AS data
+            LEFT JOIN SCHEMA_DATA_SERIES.%1$I AS series ON (series.id = data.series_id)
+    $$, table_name, label_value_cols, SCHEMA_CATALOG.get_metric_read_schema('SCHEMA_DATA', table_name));
+
+    IF NOT view_exists THEN
+        EXECUTE FORMAT('GRANT SELECT ON SCHEMA_METRIC_LABELED.%1$I TO prom_reader', table_name);
+    END IF;
+
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.create_metric_labeled_view(text) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.create_metric_labeled_view(text) TO prom_writer;
+
+-- create the labeled views of the metrics that existed before they were
+-- introduced, new label keys recreate the views from then on.
+DO $$
+BEGIN
+    PERFORM SCHEMA_CATALOG.create_metric_labeled_view(m.metric_name)
+    FROM SCHEMA_CATALOG.metric m
+    WHERE m.table_schema = 'SCHEMA_DATA'
+    AND EXISTS (SELECT 1 FROM SCHEMA_CATALOG.label_key_position lkp WHERE lkp.metric_name = m.metric_name)
+    AND NOT EXISTS (
+        SELECT 1 FROM pg_class c
+        WHERE c.relname = m.table_name
+        AND c.relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = 'SCHEMA_METRIC_LABELED')
+    );
+END
+$$;
+
 CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.register_metric_view(schema_name name, view_name name, if_not_exists BOOLEAN = false)
     RETURNS BOOLEAN
 AS $func$
@@ -2400,6 +3506,277 @@ SET search_path = pg_temp;
 REVOKE ALL ON FUNCTION SCHEMA_CATALOG.unregister_metric_view(name, name, boolean) FROM PUBLIC;
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.unregister_metric_view(name, name, boolean) TO prom_admin;
 
+--Registers a view (usually a user-created continuous aggregate) as a coarser
+--resolution version of a metric. Queries of the metric whose step is at least
+--the resolution read the view instead of the raw metric table.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.register_query_view(metric_name text, schema_name name, view_name name, resolution INTERVAL, value_column name = 'value')
+    RETURNS BOOLEAN
+AS $func$
+DECLARE
+   column_count int;
+BEGIN
+    PERFORM * FROM SCHEMA_CATALOG.metric m
+    WHERE m.metric_name = register_query_view.metric_name
+    AND m.table_schema = 'SCHEMA_DATA';
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'cannot register query view for non-existant metric %', register_query_view.metric_name;
+    END IF;
+
+    -- check if the view contains necessary columns with the correct types
+    SELECT count(*) FROM information_schema.columns
+    INTO column_count
+    WHERE table_schema = register_query_view.schema_name
+    AND table_name   = register_query_view.view_name
+    AND ((column_name = 'time' AND data_type = 'timestamp with time zone')
+    OR (column_name = 'series_id' AND data_type = 'bigint')
+    OR (column_name = register_query_view.value_column AND data_type = 'double precision'));
+
+    IF column_count < 3 THEN
+        RAISE EXCEPTION 'query view must exist and contain time (data type: timestamp with time zone), series_id (data type: bigint), and % (data type: double precision) columns', register_query_view.value_column;
+    END IF;
+
+    INSERT INTO SCHEMA_CATALOG.query_view (metric_name, view_schema, view_name, resolution, value_column)
+    VALUES (register_query_view.metric_name, register_query_view.schema_name, register_query_view.view_name,
+            register_query_view.resolution, register_query_view.value_column)
+    ON CONFLICT (metric_name, view_schema, view_name)
+    DO UPDATE SET resolution = EXCLUDED.resolution, value_column = EXCLUDED.value_column;
+
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.register_query_view(text, name, name, interval, name) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.register_query_view(text, name, name, interval, name) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.unregister_query_view(metric_name text, schema_name name, view_name name, if_exists BOOLEAN = false)
+    RETURNS BOOLEAN
+AS $func$
+BEGIN
+    DELETE FROM SCHEMA_CATALOG.query_view q
+    WHERE q.metric_name = unregister_query_view.metric_name
+    AND q.view_schema = unregister_query_view.schema_name
+    AND q.view_name = unregister_query_view.view_name;
+
+    IF NOT FOUND THEN
+        IF unregister_query_view.if_exists THEN
+            RAISE NOTICE 'query view with specified name and schema does not exist';
+            RETURN FALSE;
+        ELSE
+            RAISE EXCEPTION 'query view with specified name and schema does not exist, could not unregister';
+        END IF;
+    END IF;
+
+    RETURN TRUE;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.unregister_query_view(text, name, name, boolean) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.unregister_query_view(text, name, name, boolean) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.register_external_metric(metric_name text, schema_name name, table_name name,
+    time_column name, value_column name, tag_columns name[] = '{}')
+    RETURNS BOOLEAN
+AS $func$
+DECLARE
+   column_count int;
+   tag name;
+BEGIN
+    PERFORM * FROM SCHEMA_CATALOG.metric m
+    WHERE m.metric_name = register_external_metric.metric_name;
+
+    IF FOUND THEN
+        RAISE EXCEPTION 'cannot register external metric %, a metric with the same name exists', register_external_metric.metric_name;
+    END IF;
+
+    -- check that the table contains the time and value columns with supported types
+    SELECT count(*) FROM information_schema.columns c
+    INTO column_count
+    WHERE c.table_schema = register_external_metric.schema_name
+    AND c.table_name = register_external_metric.table_name
+    AND ((c.column_name = register_external_metric.time_column
+          AND c.data_type IN ('timestamp with time zone', 'timestamp without time zone'))
+    OR (c.column_name = register_external_metric.value_column
+          AND c.data_type IN ('double precision', 'real', 'numeric', 'bigint', 'integer', 'smallint')));
+
+    IF column_count < 2 THEN
+        RAISE EXCEPTION 'external table must exist and contain % (data type: timestamp) and % (data type: numeric) columns',
+            register_external_metric.time_column, register_external_metric.value_column;
+    END IF;
+
+    FOREACH tag IN ARRAY register_external_metric.tag_columns LOOP
+        IF tag !~ '^[a-zA-Z_][a-zA-Z0-9_]*$' OR tag LIKE '\_\_%' THEN
+            RAISE EXCEPTION 'tag column % is not a valid label name', tag;
+        END IF;
+
+        PERFORM * FROM information_schema.columns c
+        WHERE c.table_schema = register_external_metric.schema_name
+        AND c.table_name = register_external_metric.table_name
+        AND c.column_name = tag;
+
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'tag column % does not exist in external table', tag;
+        END IF;
+    END LOOP;
+
+    INSERT INTO SCHEMA_CATALOG.external_metric (metric_name, table_schema, table_name, time_column, value_column, tag_columns)
+    VALUES (register_external_metric.metric_name, register_external_metric.schema_name, register_external_metric.table_name,
+            register_external_metric.time_column, register_external_metric.value_column, register_external_metric.tag_columns)
+    ON CONFLICT (metric_name)
+    DO UPDATE SET table_schema = EXCLUDED.table_schema, table_name = EXCLUDED.table_name, time_column = EXCLUDED.time_column,
+        value_column = EXCLUDED.value_column, tag_columns = EXCLUDED.tag_columns;
+
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.register_external_metric(text, name, name, name, name, name[]) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.register_external_metric(text, name, name, name, name, name[]) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.unregister_external_metric(metric_name text, if_exists BOOLEAN = false)
+    RETURNS BOOLEAN
+AS $func$
+BEGIN
+    DELETE FROM SCHEMA_CATALOG.external_metric e
+    WHERE e.metric_name = unregister_external_metric.metric_name;
+
+    IF NOT FOUND THEN
+        IF unregister_external_metric.if_exists THEN
+            RAISE NOTICE 'external metric % does not exist', unregister_external_metric.metric_name;
+            RETURN FALSE;
+        ELSE
+            RAISE EXCEPTION 'external metric % does not exist, could not unregister', unregister_external_metric.metric_name;
+        END IF;
+    END IF;
+
+    RETURN TRUE;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.unregister_external_metric(text, boolean) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.unregister_external_metric(text, boolean) TO prom_admin;
+
+--Overrides how the queries of a metric are routed: endpoint pins them to the
+--'primary' database or its 'replica' (NULL for the automatic choice), and
+--raw_only makes them read the raw data instead of the registered query views.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.set_metric_query_route(metric_name text, endpoint text = NULL, raw_only BOOLEAN = false)
+    RETURNS BOOLEAN
+AS $func$
+BEGIN
+    IF set_metric_query_route.endpoint IS NOT NULL AND set_metric_query_route.endpoint NOT IN ('primary', 'replica') THEN
+        RAISE EXCEPTION 'invalid query endpoint %, must be primary or replica', set_metric_query_route.endpoint;
+    END IF;
+
+    INSERT INTO SCHEMA_CATALOG.query_route (metric_name, endpoint, raw_only)
+    VALUES (set_metric_query_route.metric_name, set_metric_query_route.endpoint, set_metric_query_route.raw_only)
+    ON CONFLICT (metric_name)
+    DO UPDATE SET endpoint = EXCLUDED.endpoint, raw_only = EXCLUDED.raw_only;
+
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.set_metric_query_route(text, text, boolean) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.set_metric_query_route(text, text, boolean) TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.reset_metric_query_route(metric_name text, if_exists BOOLEAN = false)
+    RETURNS BOOLEAN
+AS $func$
+BEGIN
+    DELETE FROM SCHEMA_CATALOG.query_route r
+    WHERE r.metric_name = reset_metric_query_route.metric_name;
+
+    IF NOT FOUND THEN
+        IF reset_metric_query_route.if_exists THEN
+            RAISE NOTICE 'query route of metric % does not exist', reset_metric_query_route.metric_name;
+            RETURN FALSE;
+        ELSE
+            RAISE EXCEPTION 'query route of metric % does not exist, could not reset', reset_metric_query_route.metric_name;
+        END IF;
+    END IF;
+
+    RETURN TRUE;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.reset_metric_query_route(text, boolean) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.reset_metric_query_route(text, boolean) TO prom_admin;
+
+--Records the latest values of a group of metrics pushed by a batch job. The
+--values of the group are all replaced if replace_all is set, otherwise only
+--those of the metrics that are pushed again.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.replace_push_group(group_labels jsonb, replace_all BOOLEAN,
+    metric_names text[], labels jsonb[], times timestamptz[], vals double precision[])
+    RETURNS VOID
+AS $func$
+BEGIN
+    -- the group row is locked until the end of the transaction, so that
+    -- concurrent pushes to the same group are applied one after the other.
+    INSERT INTO SCHEMA_CATALOG.push_group (group_labels, last_push)
+    VALUES (replace_push_group.group_labels, now())
+    ON CONFLICT (group_labels) DO UPDATE SET last_push = EXCLUDED.last_push;
+
+    DELETE FROM SCHEMA_CATALOG.push_group_metric m
+    WHERE m.group_labels = replace_push_group.group_labels
+    AND (replace_push_group.replace_all OR m.metric_name = ANY(replace_push_group.metric_names));
+
+    INSERT INTO SCHEMA_CATALOG.push_group_metric (group_labels, metric_name, labels, time, value)
+    SELECT replace_push_group.group_labels, u.metric_name, u.labels, u.time, u.value
+    FROM unnest(replace_push_group.metric_names, replace_push_group.labels, replace_push_group.times, replace_push_group.vals)
+        AS u(metric_name, labels, time, value)
+    ON CONFLICT (group_labels, metric_name, labels)
+    DO UPDATE SET time = EXCLUDED.time, value = EXCLUDED.value;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.replace_push_group(jsonb, boolean, text[], jsonb[], timestamptz[], double precision[]) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.replace_push_group(jsonb, boolean, text[], jsonb[], timestamptz[], double precision[]) TO prom_writer;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.delete_push_group(group_labels jsonb)
+    RETURNS BOOLEAN
+AS $func$
+BEGIN
+    DELETE FROM SCHEMA_CATALOG.push_group g
+    WHERE g.group_labels = delete_push_group.group_labels;
+    RETURN FOUND;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.delete_push_group(jsonb) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.delete_push_group(jsonb) TO prom_writer;
+
 CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.delete_series_from_metric(name text, series_ids bigint[])
 RETURNS BIGINT
 AS
@@ -2420,7 +3797,11 @@ BEGIN
                     INNER JOIN pg_namespace n ON c.relnamespace = n.oid
                     INNER JOIN _timescaledb_catalog.chunk ch ON (ch.schema_name, ch.table_name) = (n.nspname, c.relname)
                     LEFT JOIN _timescaledb_catalog.chunk chc ON ch.compressed_chunk_id = chc.id
-                WHERE c.oid IN (SELECT SCHEMA_TIMESCALE.show_chunks(format('%I.%I','SCHEMA_DATA', metric_table))::oid)
+                --the chunks of the metric table and of its write shards
+                WHERE c.oid IN (
+                    SELECT SCHEMA_TIMESCALE.show_chunks(format('%I.%I','SCHEMA_DATA', t))::oid
+                    FROM (SELECT metric_table UNION ALL SELECT SCHEMA_CATALOG.get_metric_write_shards(metric_table)) AS shard_tables(t)
+                )
                 ) a
         LOOP
             EXECUTE delete_stmt USING series_ids;
@@ -2432,6 +3813,7 @@ BEGIN
         GET DIAGNOSTICS rows_affected = ROW_COUNT;
         num_rows_deleted = num_rows_deleted + rows_affected;
     END IF;
+    DELETE FROM SCHEMA_CATALOG.exemplar e WHERE e.series_id = ANY(series_ids);
     PERFORM SCHEMA_CATALOG.delete_series_catalog_row(metric_table, series_ids);
     RETURN num_rows_deleted;
 END;
@@ -2444,6 +3826,47 @@ SET search_path = pg_temp;
 REVOKE ALL ON FUNCTION SCHEMA_CATALOG.delete_series_from_metric(text, bigint[])FROM PUBLIC;
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.delete_series_from_metric(text, bigint[]) to prom_modifier;
 
+--deletes the samples of the series between start_time and end_time, which are
+--looked up through the hypertables for their chunks to be excluded, so the
+--samples of compressed chunks overlapping the time range cannot be deleted.
+--The series left without samples are marked for deletion like by
+--delete_series_from_metric(name, series_ids).
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.delete_series_from_metric(name text, series_ids bigint[], start_time timestamptz, end_time timestamptz)
+RETURNS BIGINT
+AS
+$$
+DECLARE
+    metric_table name;
+    shard_table name;
+    rows_affected bigint;
+    num_rows_deleted bigint := 0;
+    empty_series_ids bigint[] := series_ids;
+BEGIN
+    SELECT table_name INTO metric_table FROM SCHEMA_CATALOG.metric m WHERE m.metric_name=name AND m.is_view = false;
+    FOR shard_table IN
+        SELECT metric_table UNION ALL SELECT SCHEMA_CATALOG.get_metric_write_shards(metric_table)
+    LOOP
+        EXECUTE FORMAT('DELETE FROM SCHEMA_DATA.%1$I WHERE series_id = ANY($1) AND time >= $2 AND time <= $3', shard_table)
+            USING series_ids, start_time, end_time;
+        GET DIAGNOSTICS rows_affected = ROW_COUNT;
+        num_rows_deleted = num_rows_deleted + rows_affected;
+        EXECUTE FORMAT('SELECT COALESCE(array_agg(s.id), array[]::bigint[]) FROM unnest($1) s(id)
+                        WHERE NOT EXISTS (SELECT 1 FROM SCHEMA_DATA.%1$I d WHERE d.series_id = s.id)', shard_table)
+            USING empty_series_ids INTO empty_series_ids;
+    END LOOP;
+    DELETE FROM SCHEMA_CATALOG.exemplar e WHERE e.series_id = ANY(series_ids) AND e.time >= start_time AND e.time <= end_time;
+    PERFORM SCHEMA_CATALOG.delete_series_catalog_row(metric_table, empty_series_ids);
+    RETURN num_rows_deleted;
+END;
+$$
+LANGUAGE PLPGSQL VOLATILE
+SECURITY DEFINER
+--search path must be set for security definer
+SET search_path = pg_temp;
+--redundant given schema settings but extra caution for security definers
+REVOKE ALL ON FUNCTION SCHEMA_CATALOG.delete_series_from_metric(text, bigint[], timestamptz, timestamptz) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.delete_series_from_metric(text, bigint[], timestamptz, timestamptz) to prom_modifier;
+
 -- the following functions require timescaledb >= 2.0.0
 DO $block$
 BEGIN
@@ -2999,6 +4422,8 @@ $ee$);
 
 CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.decompress_chunks_after(metric_table NAME, min_time TIMESTAMPTZ, transactional BOOLEAN = false)
 AS $proc$
+DECLARE
+    shard_table NAME;
 BEGIN
     -- In early versions of timescale multinode the access node catalog does not
     -- store whether chunks were compressed, so we need to run the actual search
@@ -3013,6 +4438,10 @@ BEGIN
             transactional => false);
     ELSE
         CALL SCHEMA_CATALOG.do_decompress_chunks_after(metric_table, min_time, transactional);
+        --do_decompress_chunks_after may commit, so the shards are not read by a cursor.
+        FOREACH shard_table IN ARRAY ARRAY(SELECT SCHEMA_CATALOG.get_metric_write_shards(metric_table)) LOOP
+            CALL SCHEMA_CATALOG.do_decompress_chunks_after(shard_table, min_time, transactional);
+        END LOOP;
     END IF;
 END
 $proc$ LANGUAGE PLPGSQL;
@@ -3082,6 +4511,7 @@ CREATE OR REPLACE PROCEDURE SCHEMA_CATALOG.compress_metric_chunks(metric_name TE
 AS $$
 DECLARE
   metric_table NAME;
+  shard_table NAME;
 BEGIN
     SELECT table_name
     INTO STRICT metric_table
@@ -3096,6 +4526,10 @@ BEGIN
         $dist$, metric_table), transactional => false);
     ELSE
         CALL SCHEMA_CATALOG.compress_old_chunks(metric_table, now() - INTERVAL '1 hour');
+        --compress_old_chunks commits, so the shards are not read by a cursor.
+        FOREACH shard_table IN ARRAY ARRAY(SELECT SCHEMA_CATALOG.get_metric_write_shards(metric_table)) LOOP
+            CALL SCHEMA_CATALOG.compress_old_chunks(shard_table, now() - INTERVAL '1 hour');
+        END LOOP;
     END IF;
 END
 $$ LANGUAGE PLPGSQL;
@@ -3216,15 +4650,136 @@ CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.insert_metric_row(
 $$
 DECLARE
   num_rows BIGINT;
+  shards INT;
+  shard_num INT;
+  shard_table NAME;
+  shard_rows BIGINT;
 BEGIN
-    EXECUTE FORMAT(
-     'INSERT INTO  SCHEMA_DATA.%1$I (time, value, series_id)
-          SELECT * FROM unnest($1, $2, $3) a(t,v,s) ORDER BY s,t ON CONFLICT DO NOTHING',
-        metric_table
-    ) USING time_array, value_array, series_id_array;
-    GET DIAGNOSTICS num_rows = ROW_COUNT;
+    SELECT m.write_shards INTO shards
+    FROM SCHEMA_CATALOG.metric m
+    WHERE m.table_schema = 'SCHEMA_DATA' AND m.table_name = metric_table;
+
+    IF shards IS NULL OR shards <= 1 THEN
+        EXECUTE FORMAT(
+         'INSERT INTO  SCHEMA_DATA.%1$I (time, value, series_id)
+              SELECT * FROM unnest($1, $2, $3) a(t,v,s) ORDER BY s,t ON CONFLICT DO NOTHING',
+            metric_table
+        ) USING time_array, value_array, series_id_array;
+        GET DIAGNOSTICS num_rows = ROW_COUNT;
+        RETURN num_rows;
+    END IF;
+
+    --the series of a sharded metric are spread across its write shards by
+    --id, the shard 0 being the metric table.
+    num_rows := 0;
+    FOR shard_num, shard_table IN
+        SELECT 0, metric_table
+        UNION ALL
+        SELECT s.shard, s.table_name
+        FROM SCHEMA_CATALOG.metric_write_shard s
+        INNER JOIN SCHEMA_CATALOG.metric m ON (m.id = s.metric_id)
+        WHERE m.table_schema = 'SCHEMA_DATA' AND m.table_name = metric_table
+        AND s.shard < shards
+    LOOP
+        EXECUTE FORMAT(
+         'INSERT INTO  SCHEMA_DATA.%1$I (time, value, series_id)
+              SELECT * FROM unnest($1, $2, $3) a(t,v,s) WHERE s %% $4 = $5 ORDER BY s,t ON CONFLICT DO NOTHING',
+            shard_table
+        ) USING time_array, value_array, series_id_array, shards, shard_num;
+        GET DIAGNOSTICS shard_rows = ROW_COUNT;
+        num_rows := num_rows + shard_rows;
+    END LOOP;
     RETURN num_rows;
 END;
 $$
 LANGUAGE PLPGSQL;
 GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.insert_metric_row(NAME, TIMESTAMPTZ[], DOUBLE PRECISION[], BIGINT[]) TO prom_writer;
+
+-- label_posting_insert adds the new series to the posting lists of their
+-- labels.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.label_posting_insert()
+RETURNS TRIGGER
+AS $func$
+BEGIN
+    INSERT INTO SCHEMA_CATALOG.label_posting (label_id, series_id)
+    SELECT DISTINCT label_id, NEW.id
+    FROM unnest(NEW.labels) label_id
+    WHERE label_id IS NOT NULL
+    ON CONFLICT DO NOTHING;
+    RETURN NULL;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.label_posting_insert() TO prom_writer;
+
+-- label_posting_delete removes the deleted series from the posting lists of
+-- their labels.
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.label_posting_delete()
+RETURNS TRIGGER
+AS $func$
+BEGIN
+    DELETE FROM SCHEMA_CATALOG.label_posting
+    WHERE label_id = ANY(OLD.labels) AND series_id = OLD.id;
+    RETURN NULL;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.label_posting_delete() TO prom_writer;
+
+CREATE OR REPLACE FUNCTION SCHEMA_CATALOG.label_postings_enabled()
+RETURNS BOOLEAN
+AS $func$
+    SELECT EXISTS (
+        SELECT 1 FROM pg_catalog.pg_trigger
+        WHERE tgrelid = 'SCHEMA_CATALOG.series'::regclass AND tgname = 'label_posting_insert'
+    )
+$func$
+LANGUAGE SQL STABLE;
+GRANT EXECUTE ON FUNCTION SCHEMA_CATALOG.label_postings_enabled() TO prom_reader;
+
+-- enable_label_postings maintains the posting lists of the labels from now
+-- on, and builds them for the existing series. Running it again rebuilds
+-- them, e.g. to drop the series of the dropped metrics.
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.enable_label_postings()
+RETURNS BOOLEAN
+AS $func$
+BEGIN
+    DROP TRIGGER IF EXISTS label_posting_insert ON SCHEMA_CATALOG.series;
+    DROP TRIGGER IF EXISTS label_posting_delete ON SCHEMA_CATALOG.series;
+    TRUNCATE SCHEMA_CATALOG.label_posting;
+    CREATE TRIGGER label_posting_insert
+        AFTER INSERT ON SCHEMA_CATALOG.series
+        FOR EACH ROW
+        EXECUTE PROCEDURE SCHEMA_CATALOG.label_posting_insert();
+    CREATE TRIGGER label_posting_delete
+        AFTER DELETE ON SCHEMA_CATALOG.series
+        FOR EACH ROW
+        EXECUTE PROCEDURE SCHEMA_CATALOG.label_posting_delete();
+    INSERT INTO SCHEMA_CATALOG.label_posting (label_id, series_id)
+    SELECT DISTINCT l.label_id, s.id
+    FROM SCHEMA_CATALOG.series s, unnest(s.labels) l(label_id)
+    WHERE l.label_id IS NOT NULL
+    ON CONFLICT DO NOTHING;
+    ANALYZE SCHEMA_CATALOG.label_posting;
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.enable_label_postings()
+IS 'maintain the inverted index of the labels, used by the queries matching labels with many values';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.enable_label_postings() TO prom_admin;
+
+CREATE OR REPLACE FUNCTION SCHEMA_PROM.disable_label_postings()
+RETURNS BOOLEAN
+AS $func$
+BEGIN
+    DROP TRIGGER IF EXISTS label_posting_insert ON SCHEMA_CATALOG.series;
+    DROP TRIGGER IF EXISTS label_posting_delete ON SCHEMA_CATALOG.series;
+    TRUNCATE SCHEMA_CATALOG.label_posting;
+    RETURN true;
+END
+$func$
+LANGUAGE PLPGSQL VOLATILE;
+COMMENT ON FUNCTION SCHEMA_PROM.disable_label_postings()
+IS 'stop maintaining the inverted index of the labels and drop it';
+GRANT EXECUTE ON FUNCTION SCHEMA_PROM.disable_label_postings() TO prom_admin;
@@ -0,0 +1,14 @@
+-- tenant stores the tenants managed through the tenant admin API when
+-- multi-tenancy is configured to read its valid tenants from the catalog.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.tenant
+(
+    name TEXT PRIMARY KEY CHECK (name <> ''),
+    disabled BOOLEAN NOT NULL DEFAULT false,
+    token_hash BYTEA NOT NULL,
+    max_samples_per_write BIGINT DEFAULT NULL CHECK (max_samples_per_write > 0),
+    retention_period INTERVAL DEFAULT NULL CHECK (retention_period > '0'::INTERVAL),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.tenant TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_CATALOG.tenant TO prom_modifier;
@@ -0,0 +1,21 @@
+-- tenant_purge tracks the jobs deleting all the data of tenants. The jobs
+-- commit their progress after every metric, so that they are resumed where
+-- they stopped if the connector running them fails.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.tenant_purge
+(
+    tenant_name TEXT PRIMARY KEY,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    heartbeat_at TIMESTAMPTZ DEFAULT NULL,
+    finished_at TIMESTAMPTZ DEFAULT NULL,
+    metrics_total INT NOT NULL DEFAULT 0,
+    metrics_done INT NOT NULL DEFAULT 0,
+    last_metric_id INT NOT NULL DEFAULT 0,
+    series_deleted BIGINT NOT NULL DEFAULT 0,
+    rows_deleted BIGINT NOT NULL DEFAULT 0,
+    live_series BIGINT DEFAULT NULL,
+    remaining_rows BIGINT DEFAULT NULL,
+    error TEXT DEFAULT NULL
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.tenant_purge TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_CATALOG.tenant_purge TO prom_modifier;
@@ -0,0 +1,13 @@
+-- sparse marks the metrics stored in the mode tuned for very sparse series,
+-- sparse_automatic whether the mode is selected from the sample rate rather
+-- than set explicitly.
+ALTER TABLE SCHEMA_CATALOG.metric
+    ADD COLUMN IF NOT EXISTS sparse BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS sparse_automatic BOOLEAN NOT NULL DEFAULT true;
+
+-- metrics with fewer samples per second than sparse_sample_rate are stored
+-- as sparse metrics, with chunks of sparse_chunk_interval.
+INSERT INTO SCHEMA_CATALOG.default(key, value) VALUES
+    ('sparse_sample_rate', '0.01'),
+    ('sparse_chunk_interval', (INTERVAL '30 days')::text)
+ON CONFLICT (key) DO NOTHING;
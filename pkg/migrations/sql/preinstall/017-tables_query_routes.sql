@@ -0,0 +1,11 @@
+-- query_route holds the manual overrides of how the queries of a metric are
+-- routed, for the cases where the automatic routing picks wrong: the read
+-- endpoint the queries are pinned to, and whether query views are bypassed
+-- in favor of the raw data.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.query_route
+(
+    metric_name TEXT PRIMARY KEY,
+    endpoint TEXT CHECK (endpoint IN ('primary', 'replica')),
+    raw_only BOOLEAN NOT NULL DEFAULT false
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.query_route TO prom_reader;
@@ -0,0 +1,21 @@
+-- push_group holds the groups of metrics pushed by batch jobs to the
+-- Pushgateway-compatible API, identified by their grouping labels, and
+-- push_group_metric the latest value of each of their series, which stays
+-- current until the group is pushed again or deleted.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.push_group
+(
+    group_labels JSONB PRIMARY KEY,
+    last_push TIMESTAMPTZ NOT NULL
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.push_group TO prom_reader;
+
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.push_group_metric
+(
+    group_labels JSONB NOT NULL REFERENCES SCHEMA_CATALOG.push_group (group_labels) ON DELETE CASCADE,
+    metric_name TEXT NOT NULL,
+    labels JSONB NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (group_labels, metric_name, labels)
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.push_group_metric TO prom_reader;
@@ -0,0 +1,12 @@
+-- label_posting is the optional inverted index of the labels: the ids of
+-- the series with each label, as the posting lists of the label ids. It is
+-- only maintained once enabled with prom_api.enable_label_postings(), and
+-- the queries only use it for the matchers of the labels with many values.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.label_posting
+(
+    label_id INT NOT NULL,
+    series_id BIGINT NOT NULL,
+    PRIMARY KEY (label_id, series_id)
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.label_posting TO prom_reader;
+GRANT SELECT, INSERT, DELETE ON TABLE SCHEMA_CATALOG.label_posting TO prom_writer;
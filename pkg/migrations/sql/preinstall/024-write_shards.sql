@@ -0,0 +1,22 @@
+-- write_shards is the number of tables the inserts into a metric are spread
+-- across by series, the metric table being the first one. metric_write_shard
+-- lists the other tables, which the view of the metric in
+-- SCHEMA_DATA_SHARDED unions with the metric table for the queries.
+ALTER TABLE SCHEMA_CATALOG.metric
+    ADD COLUMN IF NOT EXISTS write_shards INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.metric_write_shard
+(
+    metric_id INT NOT NULL REFERENCES SCHEMA_CATALOG.metric(id) ON DELETE CASCADE,
+    shard INT NOT NULL,
+    table_name NAME NOT NULL UNIQUE,
+    PRIMARY KEY (metric_id, shard)
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.metric_write_shard TO prom_reader;
+
+CREATE SCHEMA IF NOT EXISTS SCHEMA_DATA_SHARDED;
+GRANT USAGE ON SCHEMA SCHEMA_DATA_SHARDED TO prom_reader;
+
+INSERT INTO public.prom_installation_info(key, value) VALUES
+    ('sharded metric data schema', 'SCHEMA_DATA_SHARDED')
+ON CONFLICT (key) DO NOTHING;
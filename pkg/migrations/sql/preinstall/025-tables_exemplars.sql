@@ -0,0 +1,28 @@
+-- exemplar holds the exemplars of the ingested series, samples of single
+-- events labeled e.g. with the ID of their trace. They are few compared to
+-- the samples, so the exemplars of all the metrics share this table, and are
+-- expired with the samples of their metric.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.exemplar
+(
+    metric_name TEXT NOT NULL,
+    series_id BIGINT NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (series_id, time)
+);
+CREATE INDEX IF NOT EXISTS exemplar_metric_time_idx ON SCHEMA_CATALOG.exemplar (metric_name, time);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.exemplar TO prom_reader;
+GRANT SELECT, INSERT ON TABLE SCHEMA_CATALOG.exemplar TO prom_writer;
+GRANT DELETE ON TABLE SCHEMA_CATALOG.exemplar TO prom_maintenance;
+-- With TimescaleDB, the exemplars are stored in a hypertable, whose chunks
+-- are dropped once they are older than the retention period of every metric.
+DO $$
+BEGIN
+    IF SCHEMA_CATALOG.is_timescaledb_installed() THEN
+        PERFORM SCHEMA_TIMESCALE.create_hypertable('SCHEMA_CATALOG.exemplar', 'time',
+            chunk_time_interval=>(SELECT value::INTERVAL FROM SCHEMA_CATALOG.default WHERE key='chunk_interval'),
+            create_default_indexes=>false, if_not_exists=>true, migrate_data=>true);
+    END IF;
+END
+$$;
@@ -0,0 +1,11 @@
+-- ingest_checkpoint stores, for each partition of a replayable source such as
+-- a Kafka topic partition or a disk WAL, the offset up to which its samples
+-- were committed, so that a consumer restarting resumes from there.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.ingest_checkpoint
+(
+    source TEXT PRIMARY KEY,
+    source_offset BIGINT NOT NULL,
+    committed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.ingest_checkpoint TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_CATALOG.ingest_checkpoint TO prom_writer;
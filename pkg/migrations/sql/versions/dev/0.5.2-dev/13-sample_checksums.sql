@@ -0,0 +1,20 @@
+-- sample_checksum holds, in the checksum verification debug mode, a checksum
+-- of the samples of each series of the ingested write requests, and the
+-- result of comparing it with the samples read back from the metric table.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.sample_checksum
+(
+    id BIGSERIAL PRIMARY KEY,
+    metric_name TEXT NOT NULL,
+    series_id BIGINT NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    samples INT NOT NULL,
+    checksum BIGINT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    verified_at TIMESTAMPTZ,
+    result TEXT
+);
+CREATE INDEX IF NOT EXISTS sample_checksum_pending_idx ON SCHEMA_CATALOG.sample_checksum (id) WHERE verified_at IS NULL;
+GRANT SELECT ON TABLE SCHEMA_CATALOG.sample_checksum TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_CATALOG.sample_checksum TO prom_writer;
+GRANT USAGE ON SEQUENCE SCHEMA_CATALOG.sample_checksum_id_seq TO prom_writer;
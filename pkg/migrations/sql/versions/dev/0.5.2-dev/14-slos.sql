@@ -0,0 +1,15 @@
+-- slo holds the service level objectives defined through the SLO API, whose
+-- burn rates and error budgets are computed by the connectors. The good and
+-- total selectors select the counters of the good and of all the events.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.slo
+(
+    name TEXT NOT NULL PRIMARY KEY,
+    objective DOUBLE PRECISION NOT NULL CHECK (objective > 0 AND objective < 1),
+    slo_window INTERVAL NOT NULL CHECK (slo_window > INTERVAL '0'),
+    good_selector TEXT NOT NULL,
+    total_selector TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.slo TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_CATALOG.slo TO prom_writer;
@@ -0,0 +1,13 @@
+-- metric_query_usage records how far back the queries of each metric read,
+-- to recommend retention periods matching the usage. The connectors flush
+-- the furthest lookback they saw periodically, relative to the query time.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.metric_query_usage
+(
+    metric_name TEXT NOT NULL PRIMARY KEY,
+    max_lookback INTERVAL NOT NULL,
+    queries BIGINT NOT NULL,
+    first_queried_at TIMESTAMPTZ NOT NULL,
+    last_queried_at TIMESTAMPTZ NOT NULL
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.metric_query_usage TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE SCHEMA_CATALOG.metric_query_usage TO prom_writer;
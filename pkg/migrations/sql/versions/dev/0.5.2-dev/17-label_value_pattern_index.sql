@@ -0,0 +1,5 @@
+-- The prefix matchers of the queries are translated to LIKE predicates on
+-- the label values, which can only use an index with the pattern operators
+-- when the database collation is not C.
+CREATE INDEX IF NOT EXISTS label_key_value_pattern_idx
+    ON SCHEMA_CATALOG.label (key, value text_pattern_ops);
@@ -0,0 +1,13 @@
+-- query_view stores the continuous aggregates (or any other views) that users
+-- registered as coarser resolution versions of a metric. The querier reads
+-- them instead of the raw metric table when the query step allows it.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.query_view
+(
+    metric_name TEXT NOT NULL,
+    view_schema NAME NOT NULL,
+    view_name NAME NOT NULL,
+    resolution INTERVAL NOT NULL CHECK (resolution > '0'::INTERVAL),
+    value_column NAME NOT NULL DEFAULT 'value',
+    PRIMARY KEY (metric_name, view_schema, view_name)
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.query_view TO prom_reader;
@@ -0,0 +1,11 @@
+-- With TimescaleDB, the exemplars are stored in a hypertable, whose chunks
+-- are dropped once they are older than the retention period of every metric.
+DO $$
+BEGIN
+    IF SCHEMA_CATALOG.is_timescaledb_installed() THEN
+        PERFORM SCHEMA_TIMESCALE.create_hypertable('SCHEMA_CATALOG.exemplar', 'time',
+            chunk_time_interval=>(SELECT value::INTERVAL FROM SCHEMA_CATALOG.default WHERE key='chunk_interval'),
+            create_default_indexes=>false, if_not_exists=>true, migrate_data=>true);
+    END IF;
+END
+$$;
@@ -0,0 +1,34 @@
+-- label_purge tracks the jobs deleting all the series matching label
+-- selectors, such as the ones of a user for compliance requests. The jobs are
+-- kept once finished, as an audit trail of what was purged, when and why.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.label_purge
+(
+    id BIGSERIAL PRIMARY KEY,
+    selectors TEXT[] NOT NULL,
+    reason TEXT NOT NULL,
+    requested_by TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ DEFAULT NULL,
+    heartbeat_at TIMESTAMPTZ DEFAULT NULL,
+    finished_at TIMESTAMPTZ DEFAULT NULL,
+    series_deleted BIGINT NOT NULL DEFAULT 0,
+    rows_deleted BIGINT NOT NULL DEFAULT 0,
+    error TEXT DEFAULT NULL
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.label_purge TO prom_reader;
+GRANT SELECT, INSERT, UPDATE ON TABLE SCHEMA_CATALOG.label_purge TO prom_modifier;
+GRANT USAGE ON SEQUENCE SCHEMA_CATALOG.label_purge_id_seq TO prom_modifier;
+
+-- label_purge_metric records what each purge deleted from every metric.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.label_purge_metric
+(
+    purge_id BIGINT NOT NULL REFERENCES SCHEMA_CATALOG.label_purge(id),
+    metric_name TEXT NOT NULL,
+    series_deleted BIGINT NOT NULL DEFAULT 0,
+    rows_deleted BIGINT NOT NULL DEFAULT 0,
+    purged_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (purge_id, metric_name)
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.label_purge_metric TO prom_reader;
+GRANT SELECT, INSERT, UPDATE ON TABLE SCHEMA_CATALOG.label_purge_metric TO prom_modifier;
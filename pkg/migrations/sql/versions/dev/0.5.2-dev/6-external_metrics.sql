@@ -0,0 +1,13 @@
+-- external_metric maps tables that were not created by Promscale, with a time
+-- column, a value column and tag columns, to metrics that can be queried with
+-- PromQL. The tag columns become the labels of the series.
+CREATE TABLE IF NOT EXISTS SCHEMA_CATALOG.external_metric
+(
+    metric_name TEXT PRIMARY KEY,
+    table_schema NAME NOT NULL,
+    table_name NAME NOT NULL,
+    time_column NAME NOT NULL,
+    value_column NAME NOT NULL,
+    tag_columns NAME[] NOT NULL DEFAULT '{}'
+);
+GRANT SELECT ON TABLE SCHEMA_CATALOG.external_metric TO prom_reader;
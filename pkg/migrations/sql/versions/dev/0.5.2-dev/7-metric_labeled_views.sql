@@ -0,0 +1,8 @@
+-- labeled metric views join the samples of a metric with the values of its
+-- labels, with a column per label key, for analysts querying with plain SQL.
+CREATE SCHEMA IF NOT EXISTS SCHEMA_METRIC_LABELED;
+GRANT USAGE ON SCHEMA SCHEMA_METRIC_LABELED TO prom_reader;
+
+INSERT INTO public.prom_installation_info(key, value) VALUES
+    ('labeled metric schema', 'SCHEMA_METRIC_LABELED')
+ON CONFLICT (key) DO NOTHING;
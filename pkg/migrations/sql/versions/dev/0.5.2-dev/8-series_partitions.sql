@@ -0,0 +1,5 @@
+-- series_partitions is the number of hash partitions on series_id of the
+-- tables of new metrics, 0 if they are only partitioned by time.
+INSERT INTO SCHEMA_CATALOG.default(key, value) VALUES
+    ('series_partitions', '0')
+ON CONFLICT (key) DO NOTHING;
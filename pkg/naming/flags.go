@@ -0,0 +1,46 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package naming
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Config is the configuration of the naming policy of the ingested metrics.
+type Config struct {
+	PolicyFile string
+
+	// Rules is set by Validate.
+	Rules []Rule
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.PolicyFile, "naming-policy-file", "", "Path of a file with the naming conventions enforced on the metrics of write and push requests, one "+
+		"'<warn|rewrite|reject> <metric name regex> [<replacement> [<scale>]]' rule per line. The first rule matching the whole name of a metric applies: "+
+		"'warn' logs and counts the series, 'reject' fails the request, and 'rewrite' renames the metric to the replacement, which can refer to the groups "+
+		"of the regex as ${1}, and multiplies its sample values and 'le' bucket bounds by the scale, e.g. to normalize milliseconds to seconds. Disabled by default.")
+}
+
+func Validate(cfg *Config) error {
+	if cfg.PolicyFile == "" {
+		return nil
+	}
+	f, err := os.Open(cfg.PolicyFile) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("reading naming policy: %w", err)
+	}
+	defer f.Close()
+	rules, err := parseRules(f)
+	if err != nil {
+		return fmt.Errorf("naming policy %s: %w", cfg.PolicyFile, err)
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("no rules found in naming policy %s", cfg.PolicyFile)
+	}
+	cfg.Rules = rules
+	return nil
+}
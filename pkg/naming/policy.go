@@ -0,0 +1,229 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package naming enforces naming conventions on the metrics of the write
+// requests, warning about, rewriting or rejecting the metrics whose names
+// break them.
+package naming
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// Action is what is done with the series of the metrics matching a rule.
+type Action string
+
+const (
+	ActionWarn    Action = "warn"
+	ActionRewrite Action = "rewrite"
+	ActionReject  Action = "reject"
+)
+
+// bucketLabel is the label holding the upper bound of histogram buckets,
+// which is in the unit of the metric.
+const bucketLabel = "le"
+
+// ErrRejectedName is returned for the write requests with a metric rejected
+// by the naming policy.
+var ErrRejectedName = fmt.Errorf("metric name rejected by the naming policy")
+
+var policySeries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "ingest_naming_policy_series_total",
+		Help:      "Total number of series of write requests whose metric name matched a rule of the naming policy, by action.",
+	},
+	[]string{"action"},
+)
+
+func init() {
+	prometheus.MustRegister(policySeries)
+}
+
+// Rule is a naming convention, applied to the metrics whose whole name
+// matches Metric.
+type Rule struct {
+	Action Action
+	Metric *regexp.Regexp
+	// Replacement is the name of the rewritten metrics, which can refer to
+	// the groups of Metric, and Scale the factor their values are
+	// multiplied by.
+	Replacement string
+	Scale       float64
+}
+
+// parseRules reads the rules of a naming policy, one
+// '<action> <regex> [<replacement> [<scale>]]' per line.
+func parseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected '<action> <metric name regex> [<replacement> [<scale>]]'", lineNum)
+		}
+		re, err := regexp.Compile("^(?:" + fields[1] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid regex: %w", lineNum, err)
+		}
+		rule := Rule{Action: Action(fields[0]), Metric: re, Scale: 1}
+		switch rule.Action {
+		case ActionWarn, ActionReject:
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: %s rules take no replacement", lineNum, rule.Action)
+			}
+		case ActionRewrite:
+			if len(fields) < 3 || len(fields) > 4 {
+				return nil, fmt.Errorf("line %d: expected 'rewrite <metric name regex> <replacement> [<scale>]'", lineNum)
+			}
+			rule.Replacement = fields[2]
+			if len(fields) == 4 {
+				rule.Scale, err = strconv.ParseFloat(fields[3], 64)
+				if err != nil || rule.Scale == 0 || math.IsInf(rule.Scale, 0) || math.IsNaN(rule.Scale) {
+					return nil, fmt.Errorf("line %d: invalid scale %q", lineNum, fields[3])
+				}
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown action %q, expected warn, rewrite or reject", lineNum, fields[0])
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Policy applies the rules of a naming policy to the written series.
+type Policy struct {
+	rules []Rule
+}
+
+// NewPolicy returns the policy of the configuration, nil if it has no rules.
+func NewPolicy(cfg *Config) *Policy {
+	if len(cfg.Rules) == 0 {
+		return nil
+	}
+	return &Policy{rules: cfg.Rules}
+}
+
+// match returns the first rule matching the metric, nil if none does.
+func (p *Policy) match(metric string) *Rule {
+	for i := range p.rules {
+		if p.rules[i].Metric.MatchString(metric) {
+			return &p.rules[i]
+		}
+	}
+	return nil
+}
+
+// rewrite returns the rewritten name of the metric matching the rule.
+func (r *Rule) rewrite(metric string) (string, error) {
+	name := r.Metric.ReplaceAllString(metric, r.Replacement)
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		return "", fmt.Errorf("metric %s rewritten to invalid name %q by the naming policy", metric, name)
+	}
+	return name, nil
+}
+
+// Process implements the Preprocessor interface, applying the first rule
+// matching the metric of each written series.
+func (p *Policy) Process(_ *http.Request, wr *prompb.WriteRequest) error {
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		metric, rule, err := p.apply(ts)
+		if rule == nil {
+			continue
+		}
+		policySeries.WithLabelValues(string(rule.Action)).Inc()
+		if rule.Action == ActionWarn {
+			log.WarnRateLimited("msg", "metric name breaks the naming policy", "metric", metric, "rule", rule.Metric.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// The metadata of the rewritten metrics is stored under their new name.
+	for i := range wr.Metadata {
+		family := wr.Metadata[i].MetricFamilyName
+		if rule := p.match(family); rule != nil && rule.Action == ActionRewrite {
+			if name, err := rule.rewrite(family); err == nil {
+				wr.Metadata[i].MetricFamilyName = name
+			}
+		}
+	}
+	return nil
+}
+
+// apply applies the first rule matching the metric of the series to it,
+// returning the metric and the rule, nil if none matches.
+func (p *Policy) apply(ts *prompb.TimeSeries) (string, *Rule, error) {
+	nameIdx := -1
+	for j := range ts.Labels {
+		if ts.Labels[j].Name == model.MetricNameLabel {
+			nameIdx = j
+			break
+		}
+	}
+	if nameIdx < 0 {
+		return "", nil, nil
+	}
+	metric := ts.Labels[nameIdx].Value
+	rule := p.match(metric)
+	if rule == nil {
+		return metric, nil, nil
+	}
+	switch rule.Action {
+	case ActionReject:
+		return metric, rule, fmt.Errorf("metric %s: %w", metric, ErrRejectedName)
+	case ActionRewrite:
+		name, err := rule.rewrite(metric)
+		if err != nil {
+			return metric, rule, err
+		}
+		ts.Labels[nameIdx].Value = name
+		if rule.Scale != 1 {
+			scaleSeries(ts, rule.Scale)
+		}
+	}
+	return metric, rule, nil
+}
+
+// scaleSeries multiplies the values of the samples of the series, and the
+// bound of its bucket if it is one of a histogram, by scale.
+func scaleSeries(ts *prompb.TimeSeries, scale float64) {
+	for i := range ts.Samples {
+		// NaNs are kept as they are, staleness markers included.
+		if !math.IsNaN(ts.Samples[i].Value) {
+			ts.Samples[i].Value *= scale
+		}
+	}
+	for i := range ts.Labels {
+		if ts.Labels[i].Name != bucketLabel {
+			continue
+		}
+		bound, err := strconv.ParseFloat(ts.Labels[i].Value, 64)
+		if err == nil && !math.IsInf(bound, 0) {
+			ts.Labels[i].Value = strconv.FormatFloat(bound*scale, 'g', -1, 64)
+		}
+		break
+	}
+}
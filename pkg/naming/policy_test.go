@@ -0,0 +1,160 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package naming
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+const testPolicy = `
+# Durations are stored in seconds.
+rewrite (.+)_milliseconds(_bucket|_sum|_count)?  ${1}_seconds${2}  0.001
+rewrite (.+)_count_total                          ${1}_total
+reject  .+_total_total
+warn    [A-Z].*
+`
+
+func newTestPolicy(t *testing.T) *Policy {
+	rules, err := parseRules(strings.NewReader(testPolicy))
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+	return NewPolicy(&Config{Rules: rules})
+}
+
+func series(name string, values ...float64) prompb.TimeSeries {
+	ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}, {Name: "job", Value: "api"}}}
+	for i, v := range values {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i), Value: v})
+	}
+	return ts
+}
+
+func TestParseRules(t *testing.T) {
+	invalid := []string{
+		"warn",
+		"drop up",
+		"warn up up2",
+		"rewrite up",
+		"rewrite up up2 0",
+		"rewrite up up2 x",
+		"rewrite up up2 1 2",
+		"reject (",
+	}
+	for _, policy := range invalid {
+		_, err := parseRules(strings.NewReader(policy))
+		require.Error(t, err, policy)
+	}
+
+	rules, err := parseRules(strings.NewReader("rewrite up up2"))
+	require.NoError(t, err)
+	require.Equal(t, 1.0, rules[0].Scale)
+	require.False(t, rules[0].Metric.MatchString("upstream"), "the regex must match the whole name")
+
+	require.Nil(t, NewPolicy(&Config{}))
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "naming")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{}
+	require.NoError(t, Validate(cfg))
+	require.Nil(t, cfg.Rules)
+
+	cfg.PolicyFile = filepath.Join(dir, "policy")
+	require.Error(t, Validate(cfg), "missing file")
+	require.NoError(t, ioutil.WriteFile(cfg.PolicyFile, []byte("# no rules\n"), 0600))
+	require.Error(t, Validate(cfg), "empty policy")
+	require.NoError(t, ioutil.WriteFile(cfg.PolicyFile, []byte(testPolicy), 0600))
+	require.NoError(t, Validate(cfg))
+	require.Len(t, cfg.Rules, 4)
+}
+
+func TestProcess(t *testing.T) {
+	p := newTestPolicy(t)
+
+	bucket := series("latency_milliseconds_bucket", 3)
+	bucket.Labels = append(bucket.Labels, prompb.Label{Name: "le", Value: "250"})
+	inf := series("latency_milliseconds_bucket", 4)
+	inf.Labels = append(inf.Labels, prompb.Label{Name: "le", Value: "+Inf"})
+	wr := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			series("up", 1),
+			series("gc_milliseconds", 1500, math.Float64frombits(value.StaleNaN)),
+			bucket,
+			inf,
+			series("requests_count_total", 10),
+			series("Requests", 1),
+		},
+		Metadata: []prompb.MetricMetadata{
+			{MetricFamilyName: "gc_milliseconds"},
+			{MetricFamilyName: "up"},
+		},
+	}
+	require.NoError(t, p.Process(nil, wr))
+
+	require.Equal(t, series("up", 1), wr.Timeseries[0])
+	require.Equal(t, "gc_seconds", wr.Timeseries[1].Labels[0].Value)
+	require.Equal(t, 1.5, wr.Timeseries[1].Samples[0].Value)
+	require.True(t, value.IsStaleNaN(wr.Timeseries[1].Samples[1].Value), "staleness markers must be kept")
+	require.Equal(t, "latency_seconds_bucket", wr.Timeseries[2].Labels[0].Value)
+	require.Equal(t, "0.25", wr.Timeseries[2].Labels[2].Value, "bucket bounds are in the unit of the metric")
+	require.Equal(t, 0.003, wr.Timeseries[2].Samples[0].Value)
+	require.Equal(t, "+Inf", wr.Timeseries[3].Labels[2].Value)
+	require.Equal(t, "requests_total", wr.Timeseries[4].Labels[0].Value)
+	require.Equal(t, 10.0, wr.Timeseries[4].Samples[0].Value)
+	require.Equal(t, series("Requests", 1), wr.Timeseries[5], "warnings leave the series as they are")
+	require.Equal(t, "gc_seconds", wr.Metadata[0].MetricFamilyName)
+	require.Equal(t, "up", wr.Metadata[1].MetricFamilyName)
+
+	wr = &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("up", 1), series("requests_total_total", 1)}}
+	err := p.Process(nil, wr)
+	require.True(t, errors.Is(err, ErrRejectedName))
+	require.Contains(t, err.Error(), "requests_total_total")
+
+	p = NewPolicy(&Config{Rules: []Rule{{Action: ActionRewrite, Metric: newTestPolicy(t).rules[0].Metric, Replacement: "${3}", Scale: 1}}})
+	require.Error(t, p.Process(nil, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("gc_milliseconds", 1)}}), "rewrites to invalid names fail")
+}
+
+func TestPreview(t *testing.T) {
+	p := newTestPolicy(t)
+
+	res := p.Preview(labels.FromStrings("__name__", "latency_milliseconds_bucket", "le", "250"))
+	require.NoError(t, res.Err)
+	require.Equal(t, labels.FromStrings("__name__", "latency_seconds_bucket", "le", "0.25"), res.Labels)
+	require.Len(t, res.Matches, 1)
+	require.Equal(t, 1, res.Matches[0].Position)
+	require.True(t, res.Matches[0].Applied)
+	require.Equal(t, `rewrite (.+)_milliseconds(_bucket|_sum|_count)? ${1}_seconds${2} 0.001`, res.Matches[0].Rule.String())
+
+	// Only the first of the matching rules is applied.
+	res = p.Preview(labels.FromStrings("__name__", "Requests_count_total"))
+	require.Equal(t, labels.FromStrings("__name__", "Requests_total"), res.Labels)
+	require.Len(t, res.Matches, 2)
+	require.Equal(t, []int{2, 4}, []int{res.Matches[0].Position, res.Matches[1].Position})
+	require.False(t, res.Matches[1].Applied)
+
+	res = p.Preview(labels.FromStrings("__name__", "requests_total_total"))
+	require.True(t, res.Rejected)
+	require.Error(t, res.Err)
+	require.Nil(t, res.Labels)
+
+	up := labels.FromStrings("__name__", "up")
+	require.Equal(t, Preview{Labels: up}, p.Preview(up))
+	var none *Policy
+	require.Equal(t, Preview{Labels: up}, none.Preview(up))
+}
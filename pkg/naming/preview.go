@@ -0,0 +1,78 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package naming
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+// RuleMatch is a rule of the policy matching the metric of a series.
+type RuleMatch struct {
+	// Position is the position of the rule in the policy, from 1.
+	Position int
+	Rule     *Rule
+	// Applied is set for the first matching rule, the only one applied.
+	Applied bool
+}
+
+// Preview is the outcome of the policy for a series, as if it were written.
+type Preview struct {
+	// Labels are the labels the series is stored with, nil if it is
+	// rejected or its metric is rewritten to an invalid name.
+	Labels   labels.Labels
+	Matches  []RuleMatch
+	Rejected bool
+	Err      error
+}
+
+// Preview applies the policy to the labels of a series without writing it,
+// nor counting or logging it, to debug the rules. A nil policy leaves all the
+// series as they are.
+func (p *Policy) Preview(lbls labels.Labels) Preview {
+	if p == nil {
+		return Preview{Labels: lbls}
+	}
+	var res Preview
+	metric := lbls.Get(labels.MetricName)
+	for i := range p.rules {
+		if metric != "" && p.rules[i].Metric.MatchString(metric) {
+			res.Matches = append(res.Matches, RuleMatch{Position: i + 1, Rule: &p.rules[i], Applied: len(res.Matches) == 0})
+		}
+	}
+
+	ts := prompb.TimeSeries{Labels: make([]prompb.Label, len(lbls))}
+	for i, l := range lbls {
+		ts.Labels[i] = prompb.Label{Name: l.Name, Value: l.Value}
+	}
+	if _, _, err := p.apply(&ts); err != nil {
+		res.Rejected = errors.Is(err, ErrRejectedName)
+		res.Err = err
+		return res
+	}
+	b := labels.NewBuilder(nil)
+	for _, l := range ts.Labels {
+		b.Set(l.Name, l.Value)
+	}
+	res.Labels = b.Labels()
+	return res
+}
+
+// String returns the rule the way it is written in the policy file.
+func (r *Rule) String() string {
+	re := strings.TrimSuffix(strings.TrimPrefix(r.Metric.String(), "^(?:"), ")$")
+	fields := []string{string(r.Action), re}
+	if r.Action == ActionRewrite {
+		fields = append(fields, r.Replacement)
+		if r.Scale != 1 {
+			fields = append(fields, strconv.FormatFloat(r.Scale, 'g', -1, 64))
+		}
+	}
+	return strings.Join(fields, " ")
+}
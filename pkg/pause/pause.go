@@ -0,0 +1,216 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package pause pauses the ingestion of the samples of tenants or metrics,
+// e.g. while mitigating an incident caused by a source flooding the database.
+package pause
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// Mode is what happens to the writes of paused samples.
+type Mode string
+
+const (
+	// ModeReject rejects the write requests with paused samples, which
+	// Prometheus retries until the ingestion is resumed.
+	ModeReject Mode = "reject"
+	// ModeDrop acknowledges the paused samples without writing them.
+	ModeDrop Mode = "drop"
+)
+
+// ErrPaused is returned for the write requests rejected because they have
+// samples whose ingestion is paused.
+var ErrPaused = fmt.Errorf("ingestion paused")
+
+var pausedSamples = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "ingest_paused_samples_total",
+		Help:      "Total number of samples whose ingestion was paused, by mode: reject or drop.",
+	},
+	[]string{"mode"},
+)
+
+func init() {
+	prometheus.MustRegister(pausedSamples)
+}
+
+// ParseMode returns the mode of the name.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case ModeReject, ModeDrop:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown pause mode %q, expected %s or %s", name, ModeReject, ModeDrop)
+}
+
+// Pause is the pause of the ingestion of a tenant or metric.
+type Pause struct {
+	// Tenant or Metric is the paused tenant or metric.
+	Tenant string
+	Metric string
+	Mode   Mode
+	// Until is the time the ingestion resumes at, zero if it is paused
+	// until resumed.
+	Until time.Time
+}
+
+func (p Pause) expired(now time.Time) bool {
+	return !p.Until.IsZero() && !now.Before(p.Until)
+}
+
+type key struct {
+	tenant, metric string
+}
+
+// Pauses are the current pauses of the ingestion, applied to the write
+// requests as a preprocessor.
+type Pauses struct {
+	defaultMode Mode
+	now         func() time.Time
+
+	mux    sync.RWMutex
+	pauses map[key]Pause
+}
+
+// New returns the pauses of the ingestion, whose mode is defaultMode unless
+// set otherwise, ModeReject if it is empty.
+func New(defaultMode Mode) *Pauses {
+	if defaultMode == "" {
+		defaultMode = ModeReject
+	}
+	return &Pauses{defaultMode: defaultMode, now: time.Now, pauses: make(map[key]Pause)}
+}
+
+// Pause pauses the ingestion of the tenant or metric of p, replacing the
+// pause it has, if any.
+func (ps *Pauses) Pause(p Pause) error {
+	if (p.Tenant == "") == (p.Metric == "") {
+		return fmt.Errorf("a pause is either of a tenant or of a metric")
+	}
+	if p.Mode == "" {
+		p.Mode = ps.defaultMode
+	}
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	ps.pauses[key{p.Tenant, p.Metric}] = p
+	log.Info("msg", "Ingestion paused", "tenant", p.Tenant, "metric", p.Metric, "mode", p.Mode, "until", p.Until)
+	return nil
+}
+
+// Resume resumes the ingestion of the tenant or metric, returning whether it
+// was paused.
+func (ps *Pauses) Resume(tenant, metric string) bool {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+	k := key{tenant, metric}
+	p, ok := ps.pauses[k]
+	if !ok || p.expired(ps.now()) {
+		delete(ps.pauses, k)
+		return false
+	}
+	delete(ps.pauses, k)
+	log.Info("msg", "Ingestion resumed", "tenant", tenant, "metric", metric)
+	return true
+}
+
+// List returns the current pauses, sorted by tenant and metric.
+func (ps *Pauses) List() []Pause {
+	now := ps.now()
+	ps.mux.RLock()
+	defer ps.mux.RUnlock()
+	res := make([]Pause, 0, len(ps.pauses))
+	for _, p := range ps.pauses {
+		if !p.expired(now) {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Tenant != res[j].Tenant {
+			return res[i].Tenant < res[j].Tenant
+		}
+		return res[i].Metric < res[j].Metric
+	})
+	return res
+}
+
+// lookup returns the pause of the series, the pause of its tenant taking
+// precedence over the one of its metric.
+func (ps *Pauses) lookup(ts *prompb.TimeSeries, now time.Time) (Pause, bool) {
+	var tenant, metric string
+	for _, l := range ts.Labels {
+		switch l.Name {
+		case tenancy.TenantLabelKey:
+			tenant = l.Value
+		case labels.MetricName:
+			metric = l.Value
+		}
+	}
+	if tenant != "" {
+		if p, ok := ps.pauses[key{tenant: tenant}]; ok && !p.expired(now) {
+			return p, true
+		}
+	}
+	p, ok := ps.pauses[key{metric: metric}]
+	return p, ok && !p.expired(now)
+}
+
+// Process implements the parser.Preprocessor interface. The write requests
+// with samples paused in reject mode are rejected with ErrPaused, and the
+// series paused in drop mode are removed from the others.
+func (ps *Pauses) Process(_ *http.Request, wr *prompb.WriteRequest) error {
+	now := ps.now()
+	ps.mux.RLock()
+	defer ps.mux.RUnlock()
+	if len(ps.pauses) == 0 {
+		return nil
+	}
+	paused := make([]bool, len(wr.Timeseries))
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		p, ok := ps.lookup(ts, now)
+		if !ok {
+			continue
+		}
+		if p.Mode == ModeReject {
+			pausedSamples.WithLabelValues(string(ModeReject)).Add(float64(len(ts.Samples)))
+			if p.Tenant != "" {
+				return fmt.Errorf("%w for tenant %s", ErrPaused, p.Tenant)
+			}
+			return fmt.Errorf("%w for metric %s", ErrPaused, p.Metric)
+		}
+		paused[i] = true
+	}
+
+	numKept, dropped := 0, 0
+	for i := range wr.Timeseries {
+		if paused[i] {
+			dropped += len(wr.Timeseries[i].Samples)
+			continue
+		}
+		wr.Timeseries[numKept] = wr.Timeseries[i]
+		numKept++
+	}
+	for j := numKept; j < len(wr.Timeseries); j++ {
+		wr.Timeseries[j] = prompb.TimeSeries{}
+	}
+	wr.Timeseries = wr.Timeseries[:numKept]
+	if dropped > 0 {
+		pausedSamples.WithLabelValues(string(ModeDrop)).Add(float64(dropped))
+	}
+	return nil
+}
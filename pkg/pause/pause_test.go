@@ -0,0 +1,57 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pause
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func series(tenant, metric string) prompb.TimeSeries {
+	ts := prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: metric}},
+		Samples: []prompb.Sample{{Timestamp: 1, Value: 1}},
+	}
+	if tenant != "" {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: "__tenant__", Value: tenant})
+	}
+	return ts
+}
+
+func TestProcess(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ps := New(ModeReject)
+	ps.now = func() time.Time { return now }
+
+	wr := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("a", "up"), series("", "cpu")}}
+	require.NoError(t, ps.Process(nil, wr))
+	require.Len(t, wr.Timeseries, 2, "nothing is paused")
+
+	require.Error(t, ps.Pause(Pause{}))
+	require.Error(t, ps.Pause(Pause{Tenant: "a", Metric: "up"}))
+	require.NoError(t, ps.Pause(Pause{Metric: "cpu", Mode: ModeDrop}))
+	require.NoError(t, ps.Pause(Pause{Tenant: "b"}))
+	require.NoError(t, ps.Pause(Pause{Metric: "mem", Until: now.Add(-time.Second)}))
+	require.Equal(t, []Pause{{Metric: "cpu", Mode: ModeDrop}, {Tenant: "b", Mode: ModeReject}}, ps.List(), "the expired pauses are not listed")
+
+	wr = &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("a", "cpu"), series("a", "up"), series("", "mem"), series("", "cpu")}}
+	require.NoError(t, ps.Process(nil, wr))
+	require.Equal(t, []prompb.TimeSeries{series("a", "up"), series("", "mem")}, wr.Timeseries)
+
+	wr = &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("a", "up"), series("b", "cpu")}}
+	err := ps.Process(nil, wr)
+	require.True(t, errors.Is(err, ErrPaused))
+	require.EqualError(t, err, "ingestion paused for tenant b", "the pause of the tenant takes precedence")
+
+	require.True(t, ps.Resume("b", ""))
+	require.False(t, ps.Resume("b", ""))
+	require.False(t, ps.Resume("", "mem"), "expired pauses are not resumed")
+	require.NoError(t, ps.Process(nil, wr))
+	require.Equal(t, []prompb.TimeSeries{series("a", "up")}, wr.Timeseries)
+}
@@ -8,16 +8,26 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/timescale/promscale/pkg/encryption"
+	"github.com/timescale/promscale/pkg/forward"
 	"github.com/timescale/promscale/pkg/ha"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/naming"
+	"github.com/timescale/promscale/pkg/pgmodel/anomaly"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgmodel/catalog"
+	"github.com/timescale/promscale/pkg/pgmodel/checkpoint"
+	"github.com/timescale/promscale/pkg/pgmodel/checksum"
 	"github.com/timescale/promscale/pkg/pgmodel/health"
 	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"github.com/timescale/promscale/pkg/pgmodel/lreader"
 	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgmodel/twophase"
+	"github.com/timescale/promscale/pkg/pgmodel/usage"
 	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/prompb"
 	"github.com/timescale/promscale/pkg/promql"
@@ -39,6 +49,20 @@ type Client struct {
 	closePool     bool
 	sigClose      chan struct{}
 	haService     *ha.Service
+	mirror        *mirror
+	forwarder     *forward.Forwarder
+	replicaPool   *pgxpool.Pool
+	classPools    map[pgxconn.QueryClass]*pgxpool.Pool
+	encryptor     *encryption.LabelEncryptor
+	namingPolicy  *naming.Policy
+	// seriesQuerier resolves the series of the series endpoint without
+	// fetching their samples, nil if they are fetched.
+	seriesQuerier querier.SeriesQuerier
+	twoPhase      bool
+	catalog       *catalog.Client
+	labelsReader  lreader.LabelsReader
+	// labelQuerier looks up the labels of the series matching selectors.
+	labelQuerier querier.LabelQuerier
 }
 
 // Post connect validation function, useful for things such as acquiring locks
@@ -59,14 +83,92 @@ func NewClient(cfg *Config, mt tenancy.Authorizer, schemaLocker LockFunc, readOn
 		return nil, err
 	}
 
-	client, err := NewClientWithPool(cfg, numCopiers, connectionPool, mt, readOnly)
+	var replicaPool *pgxpool.Pool
+	if cfg.HedgeReplicaDbUri != "" {
+		replicaPool, err = newReplicaPool(cfg)
+		if err != nil {
+			connectionPool.Close()
+			return nil, err
+		}
+	}
+
+	classPools, err := newQueryClassPools(cfg, pgConfig)
 	if err != nil {
+		connectionPool.Close()
+		if replicaPool != nil {
+			replicaPool.Close()
+		}
+		return nil, err
+	}
+
+	client, err := newClientWithPools(cfg, numCopiers, connectionPool, replicaPool, classPools, mt, readOnly)
+	if err != nil {
+		if replicaPool != nil {
+			replicaPool.Close()
+		}
+		closeQueryClassPools(classPools)
 		return client, err
 	}
 	client.closePool = true
+
+	if cfg.MirrorDbUri != "" && !readOnly {
+		client.mirror, err = newMirror(cfg)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if cfg.Forward.URL != "" && !readOnly {
+		client.forwarder = forward.New(cfg.Forward)
+	}
 	return client, err
 }
 
+// newReplicaPool connects to the read replica to which slow read queries
+// are hedged.
+func newReplicaPool(cfg *Config) (*pgxpool.Pool, error) {
+	replicaCfg := *cfg
+	replicaCfg.DbUri = cfg.HedgeReplicaDbUri
+	replicaCfg.HedgeReplicaDbUri = ""
+	pgConfig, _, err := getPgConfig(&replicaCfg)
+	if err != nil {
+		return nil, err
+	}
+	// The replica follows the schema of the primary database, so we do not
+	// take the schema-version lease on its connections.
+	pool, err := pgxpool.ConnectConfig(context.Background(), pgConfig)
+	if err != nil {
+		return nil, fmt.Errorf("creating read replica connection pool: %w", err)
+	}
+	log.Info("msg", "Hedging slow read queries to read replica", "delay", cfg.QueryHedgeDelay, "db", getRedactedConnStr(cfg.HedgeReplicaDbUri))
+	return pool, nil
+}
+
+// newQueryClassPools connects the pools of the query classes with
+// connections of their own, configured as the main pool.
+func newQueryClassPools(cfg *Config, pgConfig *pgxpool.Config) (map[pgxconn.QueryClass]*pgxpool.Pool, error) {
+	pools := make(map[pgxconn.QueryClass]*pgxpool.Pool, len(cfg.QueryClassConns))
+	for class, conns := range cfg.QueryClassConns {
+		classConfig := pgConfig.Copy()
+		classConfig.MinConns = 0
+		classConfig.MaxConns = int32(conns)
+		pool, err := pgxpool.ConnectConfig(context.Background(), classConfig)
+		if err != nil {
+			closeQueryClassPools(pools)
+			return nil, fmt.Errorf("creating connection pool of query class %s: %w", class, err)
+		}
+		log.Info("msg", "Running the queries of a query class on their own connection pool", "class", class, "pool_max_conns", conns)
+		pools[class] = pool
+	}
+	return pools, nil
+}
+
+func closeQueryClassPools(pools map[pgxconn.QueryClass]*pgxpool.Pool) {
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
 func getPgConfig(cfg *Config) (*pgxpool.Config, int, error) {
 	minConnections, maxConnections, numCopiers, err := cfg.GetNumConnections()
 	if err != nil {
@@ -84,8 +186,20 @@ func getPgConfig(cfg *Config) (*pgxpool.Config, int, error) {
 	pgConfig.MinConns = int32(minConnections)
 	pgConfig.MaxConns = int32(maxConnections)
 
+	// Settings given in the connection string or URI take precedence.
+	for name, value := range cfg.sessionParams() {
+		if _, ok := pgConfig.ConnConfig.RuntimeParams[name]; !ok {
+			pgConfig.ConnConfig.RuntimeParams[name] = value
+		}
+	}
+
+	if cfg.PoolerMode {
+		log.Info("msg", "Pooler mode enabled, the statements cache and the session settings of the query-* flags are disabled. "+
+			"Set the settings on the database role of the connector instead if needed.")
+	}
+
 	var statementCacheLog string
-	if cfg.EnableStatementsCache {
+	if cfg.EnableStatementsCache && !cfg.PoolerMode {
 		// Using the PGX default of 512 for statement cache capacity.
 		statementCacheCapacity := 512
 		pgConfig.AfterRelease = observeStatementCacheState
@@ -125,8 +239,28 @@ func getRedactedConnStr(s string) string {
 	return connURL.String()
 }
 
+// auditedConn returns conn auditing its slow read queries, if enabled. The
+// plans are captured on the database that ran the query.
+func (cfg *Config) auditedConn(conn pgxconn.PgxConn) pgxconn.PgxConn {
+	if cfg.QueryAuditThreshold <= 0 {
+		return conn
+	}
+	return pgxconn.NewAuditingPgxConn(conn, cfg.QueryAuditThreshold, cfg.QueryAuditSampleRate)
+}
+
 // NewClientWithPool creates a new PostgreSQL client with an existing connection pool.
 func NewClientWithPool(cfg *Config, numCopiers int, connPool *pgxpool.Pool, mt tenancy.Authorizer, readOnly bool) (*Client, error) {
+	return newClientWithPools(cfg, numCopiers, connPool, nil, nil, mt, readOnly)
+}
+
+// newClientWithPools creates a new PostgreSQL client whose read queries are
+// hedged to replicaPool, if it is not nil, and whose read queries of the
+// classes of classPools run on their pool.
+func newClientWithPools(cfg *Config, numCopiers int, connPool, replicaPool *pgxpool.Pool, classPools map[pgxconn.QueryClass]*pgxpool.Pool, mt tenancy.Authorizer, readOnly bool) (*Client, error) {
+	encryptor, err := encryption.NewLabelEncryptor(&cfg.LabelEncryption)
+	if err != nil {
+		return nil, err
+	}
 	dbConn := pgxconn.NewPgxConn(connPool)
 	sigClose := make(chan struct{})
 	metricsCache := cache.NewMetricCache(cfg.CacheConfig)
@@ -135,35 +269,116 @@ func NewClientWithPool(cfg *Config, numCopiers int, connPool *pgxpool.Pool, mt t
 	c := ingestor.Cfg{
 		NumCopiers:             numCopiers,
 		IgnoreCompressedChunks: cfg.IgnoreCompressedChunks,
+		SortedLabels:           cfg.SortedLabels,
+		AsyncCommit:            cfg.AsyncCommit,
+		VerifyChecksums:        cfg.VerifyChecksums,
+		SeriesBloomRefresh:     cfg.SeriesBloomRefresh,
+		PoolerMode:             cfg.PoolerMode,
+	}
+	if cfg.AsyncCommitTenants != "" {
+		c.AsyncCommitTenants = strings.Split(cfg.AsyncCommitTenants, ",")
 	}
 
-	var dbIngestor *ingestor.DBIngestor
+	var (
+		dbIngestor    *ingestor.DBIngestor
+		catalogClient *catalog.Client
+	)
+	if !readOnly && cfg.CatalogAddresses != "" {
+		catalogClient, err = catalog.NewClient(strings.Split(cfg.CatalogAddresses, ","), &cfg.Catalog)
+		if err != nil {
+			return nil, err
+		}
+		c.Catalog = catalogClient
+	}
 	if !readOnly {
-		var err error
 		dbIngestor, err = ingestor.NewPgxIngestor(dbConn, metricsCache, seriesCache, &c)
 		if err != nil {
+			if catalogClient != nil {
+				catalogClient.Close()
+			}
 			log.Error("msg", "err starting ingestor", "err", err)
 			return nil, err
 		}
 	}
 
+	if !readOnly && cfg.VerifyChecksums {
+		checksum.NewVerifier(dbConn, sigClose)
+	}
+	if !readOnly && len(cfg.Anomaly.Metrics) > 0 {
+		anomaly.NewRunner(dbConn, dbIngestor, &cfg.Anomaly, sigClose)
+	}
+
 	labelsReader := lreader.NewLabelsReader(dbConn, labelsCache)
 
-	dbQuerierConn := pgxconn.NewQueryLoggingPgxConn(connPool)
-	dbQuerier := querier.NewQuerier(dbQuerierConn, metricsCache, labelsReader, mt.ReadAuthorizer())
+	if cfg.VerifySeriesOrder {
+		querier.VerifySeriesSets = true
+	}
+	dbQuerierConn := cfg.auditedConn(pgxconn.NewQueryLoggingPgxConn(connPool))
+	readEndpoints := map[string]pgxconn.PgxConn{querier.PrimaryEndpoint: dbQuerierConn}
+	if replicaPool != nil {
+		replicaConn := cfg.auditedConn(pgxconn.NewQueryLoggingPgxConn(replicaPool))
+		readEndpoints[querier.ReplicaEndpoint] = replicaConn
+		dbQuerierConn = pgxconn.NewHedgedPgxConn(dbQuerierConn, replicaConn, cfg.QueryHedgeDelay)
+	}
+	classConns := make(map[pgxconn.QueryClass]pgxconn.PgxConn, len(classPools))
+	for class, pool := range classPools {
+		classConns[class] = cfg.auditedConn(pgxconn.NewQueryLoggingPgxConn(pool))
+	}
+	dbQuerierConn = pgxconn.NewClassedPgxConn(dbQuerierConn, classConns)
+	var prewarmer *querier.Prewarmer
+	if cfg.QueryPrewarmLead > 0 {
+		prewarmer = querier.NewPrewarmer(dbConn, cfg.QueryPrewarmLead, sigClose)
+	}
+	var usageRecorder *usage.Recorder
+	if !readOnly && cfg.QueryUsageFlush > 0 {
+		usageRecorder = usage.NewRecorder(dbConn, cfg.QueryUsageFlush, sigClose)
+	}
+	dbQuerier := querier.NewQuerier(dbQuerierConn, metricsCache, labelsReader, mt.ReadAuthorizer(), &querier.Cfg{
+		Duplicates:             cfg.DuplicatePolicy,
+		StrictNulls:            cfg.StrictNulls,
+		LabelEncryptor:         encryptor,
+		ReadEndpoints:          readEndpoints,
+		Prewarmer:              prewarmer,
+		Usage:                  usageRecorder,
+		StreamFetchSize:        cfg.QueryStreamFetchSize,
+		LazyLabels:             cfg.QueryLazyLabels,
+		StepReductionMinStep:   cfg.QueryStepReduction,
+		RatePushdown:           cfg.QueryRatePushdown,
+		AggregatePushdown:      cfg.QueryAggregatePushdown,
+		LabelPostingsMinValues: cfg.QueryLabelPostings,
+		RemoteReadConcurrency:  cfg.QueryReadConcurrency,
+		MetricFetchConcurrency: cfg.QueryMetricConcurrency,
+		QuantileWarnings:       cfg.QueryQuantileWarnings,
+		PartialResponse:        cfg.QueryPartialResponse,
+		MaxSamples:             cfg.QueryMaxSamples,
+		MaxBytes:               cfg.QueryMaxBytes,
+	})
 	queryable := query.NewQueryable(dbQuerier, labelsReader)
 
 	healthChecker := health.NewHealthChecker(dbConn)
 	client := &Client{
-		Connection:  dbConn,
-		ingestor:    dbIngestor,
-		querier:     dbQuerier,
-		healthCheck: healthChecker,
-		queryable:   queryable,
-		metricCache: metricsCache,
-		labelsCache: labelsCache,
-		seriesCache: seriesCache,
-		sigClose:    sigClose,
+		Connection:   dbConn,
+		ingestor:     dbIngestor,
+		querier:      dbQuerier,
+		healthCheck:  healthChecker,
+		queryable:    queryable,
+		metricCache:  metricsCache,
+		labelsCache:  labelsCache,
+		seriesCache:  seriesCache,
+		sigClose:     sigClose,
+		encryptor:    encryptor,
+		namingPolicy: naming.NewPolicy(&cfg.NamingPolicy),
+		replicaPool:  replicaPool,
+		classPools:   classPools,
+		twoPhase:     cfg.TwoPhaseCommit,
+		catalog:      catalogClient,
+		labelsReader: labelsReader,
+	}
+	if sq, ok := dbQuerier.(querier.SeriesQuerier); ok && cfg.QuerySeriesPushdown {
+		client.seriesQuerier = sq
+	}
+	if lq, ok := dbQuerier.(querier.LabelQuerier); ok {
+		client.labelQuerier = lq
 	}
 
 	InitClientMetrics(client)
@@ -183,17 +398,104 @@ func (c *Client) Close() {
 	if c.haService != nil {
 		c.haService.Close()
 	}
+	if c.mirror != nil {
+		c.mirror.close()
+	}
+	if c.forwarder != nil {
+		c.forwarder.Close()
+	}
+	if c.replicaPool != nil {
+		c.replicaPool.Close()
+	}
+	closeQueryClassPools(c.classPools)
+	if c.catalog != nil {
+		c.catalog.Close()
+	}
 }
 
 func (c *Client) Ingestor() *ingestor.DBIngestor {
 	return c.ingestor
 }
 
+// LabelEncryptor returns the encryptor of the encrypted labels, nil if no
+// label is encrypted.
+func (c *Client) LabelEncryptor() *encryption.LabelEncryptor {
+	return c.encryptor
+}
+
+// NamingPolicy returns the naming policy of the ingested metrics, nil if no
+// policy is enforced.
+func (c *Client) NamingPolicy() *naming.Policy {
+	return c.namingPolicy
+}
+
+// SeriesQuerier returns the querier of the label sets of the series matching
+// selectors without fetching their samples, nil if series are not pushed
+// down.
+func (c *Client) SeriesQuerier() querier.SeriesQuerier {
+	return c.seriesQuerier
+}
+
+// LabelQuerier returns the querier of the label names and values of the
+// series matching selectors, nil if the querier cannot look them up.
+func (c *Client) LabelQuerier() querier.LabelQuerier {
+	return c.labelQuerier
+}
+
 // Ingest writes the timeseries object into the DB
 func (c *Client) Ingest(r *prompb.WriteRequest) (uint64, uint64, error) {
+	if c.mirror != nil {
+		c.mirror.send(r)
+	}
+	if c.forwarder != nil {
+		c.forwarder.Send(r)
+	}
 	return c.ingestor.Ingest(r)
 }
 
+// IngestSorted writes the timeseries object into the DB without sorting and
+// validating the labels of the series, which the sender guarantees.
+func (c *Client) IngestSorted(r *prompb.WriteRequest) (uint64, uint64, error) {
+	if c.mirror != nil {
+		c.mirror.send(r)
+	}
+	if c.forwarder != nil {
+		c.forwarder.Send(r)
+	}
+	return c.ingestor.IngestSorted(r)
+}
+
+// CommitsDurably returns whether the samples of the request are durably
+// committed by the time Ingest returns.
+func (c *Client) CommitsDurably(r *prompb.WriteRequest) bool {
+	return c.ingestor != nil && c.ingestor.CommitsDurably(r)
+}
+
+// CommitCheckpoint records that the samples of source up to offset were
+// committed to the database.
+func (c *Client) CommitCheckpoint(source string, offset int64) error {
+	return checkpoint.Commit(c.Connection, source, offset)
+}
+
+// PrepareTransaction ingests the write request in a transaction prepared
+// under id, which is committed or rolled back later. The samples are not
+// mirrored nor forwarded, since they may never be committed.
+func (c *Client) PrepareTransaction(id string, r *prompb.WriteRequest) (uint64, error) {
+	defer ingestor.FinishWriteRequest(r)
+	if !c.twoPhase {
+		return 0, ingestor.ErrTwoPhaseCommitDisabled
+	}
+	return twophase.Prepare(c.Connection, id, r)
+}
+
+// ExplainQueryable returns a queryable whose selects run their SQL queries
+// on connections wrapped by recorder and record the nodes they push down
+// into the database, for a PromQL query to be explained.
+func (c *Client) ExplainQueryable(recorder *pgxconn.QueryRecorder) (promql.Queryable, *querier.ExplainingQuerier) {
+	q := querier.NewExplainingQuerier(c.querier, recorder)
+	return query.NewQueryable(q, c.labelsReader), q
+}
+
 // Read returns the promQL query results
 func (c *Client) Read(req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
 	if req == nil {
@@ -204,6 +506,19 @@ func (c *Client) Read(req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
 		Results: make([]*prompb.QueryResult, len(req.Queries)),
 	}
 
+	if bq, ok := c.querier.(querier.BatchQuerier); ok && len(req.Queries) > 1 {
+		results, err := bq.QueryBatch(req.Queries)
+		if err != nil {
+			return nil, err
+		}
+		for i, tts := range results {
+			resp.Results[i] = &prompb.QueryResult{
+				Timeseries: tts,
+			}
+		}
+		return &resp, nil
+	}
+
 	for i, q := range req.Queries {
 		tts, err := c.querier.Query(q)
 		if err != nil {
@@ -217,6 +532,16 @@ func (c *Client) Read(req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
 	return &resp, nil
 }
 
+// QueryChunks calls fn with the results of a remote-storage query with their
+// samples encoded in XOR chunks, for streamed remote read.
+func (c *Client) QueryChunks(q *prompb.Query, fn func(*prompb.ChunkedSeries) error) error {
+	cq, ok := c.querier.(querier.ChunkQuerier)
+	if !ok {
+		return fmt.Errorf("querier does not support chunked results")
+	}
+	return cq.QueryChunks(q, fn)
+}
+
 func (c *Client) NumCachedMetricNames() int {
 	return c.metricCache.Len()
 }
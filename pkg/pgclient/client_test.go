@@ -5,6 +5,7 @@
 package pgclient
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -25,7 +26,7 @@ type mockQuerier struct {
 
 var _ querier.Querier = (*mockQuerier)(nil)
 
-func (q *mockQuerier) Select(mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, qh *querier.QueryHints, path []parser.Node, ms ...*labels.Matcher) (querier.SeriesSet, parser.Node) {
+func (q *mockQuerier) Select(_ context.Context, mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, qh *querier.QueryHints, path []parser.Node, ms ...*labels.Matcher) (querier.SeriesSet, parser.Node) {
 	return nil, nil
 }
 
@@ -0,0 +1,140 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgclient
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// mirrorQueueSize is the number of write requests that can wait to be
+// mirrored before new ones are dropped.
+const mirrorQueueSize = 128
+
+var mirroredBatches = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "mirror_batches_total",
+		Help:      "Total number of write requests considered for mirroring to the secondary database, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(mirroredBatches)
+}
+
+// mirror asynchronously copies a share of the ingested write requests
+// to a secondary database. Mirroring is best-effort: it never blocks
+// nor fails writes to the primary database.
+type mirror struct {
+	client  *Client
+	percent float64
+	queue   chan *prompb.WriteRequest
+	wg      sync.WaitGroup
+}
+
+func newMirror(cfg *Config) (*mirror, error) {
+	// Only the settings of the connections and of the ingestion apply to the
+	// mirror: the other features of the connector (forwarding, hedging,
+	// query settings, ...) and the credentials of the primary database are
+	// not carried over.
+	mirrorCfg := Config{
+		CacheConfig:             cfg.CacheConfig,
+		AppName:                 cfg.AppName,
+		DbUri:                   cfg.MirrorDbUri,
+		DbConnectionTimeout:     cfg.DbConnectionTimeout,
+		WriteConnectionsPerProc: cfg.WriteConnectionsPerProc,
+		MaxConnections:          cfg.MaxConnections,
+		EnableStatementsCache:   cfg.EnableStatementsCache,
+		PoolerMode:              cfg.PoolerMode,
+		IgnoreCompressedChunks:  cfg.IgnoreCompressedChunks,
+		SortedLabels:            cfg.SortedLabels,
+		QueryParallelWorkers:    defaultQueryParallelWorkers,
+	}
+	// The mirror database is expected to be migrated by the operator,
+	// so we do not take the schema-version lease on its connections.
+	client, err := NewClient(&mirrorCfg, tenancy.NewNoopAuthorizer(), nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("creating mirror client: %w", err)
+	}
+	m := &mirror{
+		client:  client,
+		percent: cfg.MirrorPercent,
+		queue:   make(chan *prompb.WriteRequest, mirrorQueueSize),
+	}
+	m.wg.Add(1)
+	go m.run()
+	log.Info("msg", "Mirroring writes to secondary database", "percent", cfg.MirrorPercent, "db", getRedactedConnStr(cfg.MirrorDbUri))
+	return m, nil
+}
+
+// send enqueues a copy of the write request for mirroring, if it is sampled.
+// It must be called before the request is handed to the primary ingestor,
+// since the ingestor recycles the request once it is done with it.
+func (m *mirror) send(r *prompb.WriteRequest) {
+	if m.percent < 100 && rand.Float64()*100 >= m.percent {
+		return
+	}
+	select {
+	case m.queue <- copyWriteRequest(r):
+	default:
+		mirroredBatches.WithLabelValues("dropped").Inc()
+	}
+}
+
+// copyWriteRequest copies the slices of the request, which the primary
+// ingestor reuses for later requests. The strings cannot change, so they
+// are shared rather than copied.
+func copyWriteRequest(r *prompb.WriteRequest) *prompb.WriteRequest {
+	c := &prompb.WriteRequest{
+		Timeseries: make([]prompb.TimeSeries, len(r.Timeseries)),
+		Metadata:   append([]prompb.MetricMetadata(nil), r.Metadata...),
+	}
+	for i := range r.Timeseries {
+		ts := &r.Timeseries[i]
+		copied := &c.Timeseries[i]
+		copied.Labels = append([]prompb.Label(nil), ts.Labels...)
+		copied.Samples = append([]prompb.Sample(nil), ts.Samples...)
+		if len(ts.Exemplars) > 0 {
+			copied.Exemplars = make([]prompb.Exemplar, len(ts.Exemplars))
+			for j, e := range ts.Exemplars {
+				copied.Exemplars[j] = prompb.Exemplar{
+					Labels:    append([]prompb.Label(nil), e.Labels...),
+					Value:     e.Value,
+					Timestamp: e.Timestamp,
+				}
+			}
+		}
+	}
+	return c
+}
+
+func (m *mirror) run() {
+	defer m.wg.Done()
+	for req := range m.queue {
+		if _, _, err := m.client.Ingest(req); err != nil {
+			log.Warn("msg", "error mirroring write request", "err", err)
+			mirroredBatches.WithLabelValues("failed").Inc()
+			continue
+		}
+		mirroredBatches.WithLabelValues("sent").Inc()
+	}
+}
+
+// close stops accepting new requests, waits for the queued ones to be
+// mirrored and closes the secondary client.
+func (m *mirror) close() {
+	close(m.queue)
+	m.wg.Wait()
+	m.client.Close()
+}
@@ -0,0 +1,40 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestMirrorSend(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{{Timestamp: 1, Value: 1}},
+		}},
+	}
+
+	m := &mirror{percent: 0, queue: make(chan *prompb.WriteRequest, 1)}
+	m.send(req)
+	require.Len(t, m.queue, 0, "nothing should be mirrored at 0%")
+
+	m.percent = 100
+	m.send(req)
+	require.Len(t, m.queue, 1)
+	// The queue is full: the request is dropped instead of blocking.
+	m.send(req)
+	require.Len(t, m.queue, 1)
+
+	// The queued copy must not be affected by the recycling of the original
+	// request.
+	ingestor.FinishWriteRequest(req)
+	copied := <-m.queue
+	require.Equal(t, "up", copied.Timeseries[0].Labels[0].Value)
+	require.Equal(t, []prompb.Sample{{Timestamp: 1, Value: 1}}, copied.Timeseries[0].Samples)
+}
@@ -0,0 +1,203 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package anomaly runs background jobs scoring how anomalous the last sample
+// of the series of the configured metrics is, with statistical detectors
+// evaluated in SQL over the stored samples. The scores are ingested back as
+// series, so that they can be queried and alerted on with PromQL.
+package anomaly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	tableSQL  = "SELECT " + schema.Catalog + ".get_metric_read_schema(table_schema, table_name), table_name FROM " + schema.Catalog + ".metric WHERE metric_name = $1 AND table_schema = '" + schema.Data + "'"
+	scoresSQL = `SELECT d.series_id, d.time, d.score, l.keys, l.vals
+FROM (%s) d, ` + schema.Prom + `.key_value_array(` + schema.Prom + `.labels(d.series_id)) l
+WHERE d.score IS NOT NULL AND d.score <> 'NaN'`
+
+	// ScoreSuffix is appended to the name of a metric to get the name of
+	// the series of its scores.
+	ScoreSuffix = "_anomaly_score"
+	// DetectorLabel is the label of the score series set to the name of the
+	// detector.
+	DetectorLabel = "detector"
+)
+
+var scores = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "anomaly_scores_total",
+		Help:      "Total number of anomaly scores ingested, by detector.",
+	},
+	[]string{"detector"},
+)
+
+func init() {
+	prometheus.MustRegister(scores)
+}
+
+// Detector scores the last sample of each series of a metric.
+type Detector interface {
+	// Name is the value of the detector label of the scores.
+	Name() string
+	// Query returns the SQL selecting the series_id, time and score of the
+	// last sample of each series of the metric table up to the time $1,
+	// along with the values of its other parameters, from $2 on. Series
+	// that cannot be scored have a NULL score.
+	Query(table string) (string, []interface{})
+}
+
+var detectors = map[string]func(cfg *Config) Detector{}
+
+// RegisterDetector makes a detector available by name to the
+// anomaly-detection-detectors flag.
+func RegisterDetector(name string, newDetector func(cfg *Config) Detector) {
+	detectors[name] = newDetector
+}
+
+// NewDetector returns the registered detector with the name.
+func NewDetector(name string, cfg *Config) (Detector, error) {
+	newDetector, ok := detectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown detector %q", name)
+	}
+	return newDetector(cfg), nil
+}
+
+// Runner scores the series of the configured metrics every interval, and
+// ingests the scores.
+type Runner struct {
+	conn     pgxconn.PgxConn
+	inserter ingestor.DBInserter
+	cfg      *Config
+	// last is the time of the previous run, up to which the samples are
+	// already scored.
+	last time.Time
+}
+
+// NewRunner returns a runner running until sigClose is closed.
+func NewRunner(conn pgxconn.PgxConn, inserter ingestor.DBInserter, cfg *Config, sigClose <-chan struct{}) *Runner {
+	r := &Runner{conn: conn, inserter: inserter, cfg: cfg}
+	go r.run(sigClose)
+	log.Info("msg", "Running anomaly detection", "metrics", len(cfg.Metrics), "detectors", len(cfg.Detectors), "interval", cfg.Interval)
+	return r
+}
+
+func (r *Runner) run(sigClose <-chan struct{}) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.detect(now)
+		case <-sigClose:
+			return
+		}
+	}
+}
+
+// detect scores the series of every metric up to now truncated to the
+// interval, so that the connectors running the same jobs score the same
+// samples and their scores are deduplicated.
+func (r *Runner) detect(now time.Time) {
+	end := now.Truncate(r.cfg.Interval)
+	for _, metric := range r.cfg.Metrics {
+		if err := r.detectMetric(metric, end); err != nil {
+			log.Warn("msg", "error detecting anomalies", "metric", metric, "err", err)
+		}
+	}
+	r.last = end
+}
+
+func (r *Runner) detectMetric(metric string, end time.Time) error {
+	var readSchema, table string
+	err := r.conn.QueryRow(context.Background(), tableSQL, metric).Scan(&readSchema, &table)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Debug("msg", "no anomaly detection on a metric without samples", "metric", metric)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	req := ingestor.NewWriteRequest()
+	for _, d := range r.cfg.Detectors {
+		n := len(req.Timeseries)
+		if req.Timeseries, err = r.score(req.Timeseries, metric, pgx.Identifier{readSchema, table}.Sanitize(), d, end); err != nil {
+			ingestor.FinishWriteRequest(req)
+			return fmt.Errorf("detector %s: %w", d.Name(), err)
+		}
+		scores.WithLabelValues(d.Name()).Add(float64(len(req.Timeseries) - n))
+	}
+	if _, _, err = r.inserter.Ingest(req); err != nil {
+		return fmt.Errorf("ingest anomaly scores: %w", err)
+	}
+	return nil
+}
+
+// score appends the series of the scores of the detector to ts, computed
+// from the samples of the relation.
+func (r *Runner) score(ts []prompb.TimeSeries, metric, relation string, d Detector, end time.Time) ([]prompb.TimeSeries, error) {
+	query, params := d.Query(relation)
+	rows, err := r.conn.Query(context.Background(), fmt.Sprintf(scoresSQL, query), append([]interface{}{end}, params...)...)
+	if err != nil {
+		return ts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			seriesID   int64
+			t          time.Time
+			score      float64
+			keys, vals []string
+		)
+		if err = rows.Scan(&seriesID, &t, &score, &keys, &vals); err != nil {
+			return ts, err
+		}
+		if !t.After(r.last) {
+			continue
+		}
+		ts = append(ts, prompb.TimeSeries{
+			Labels:  scoreLabels(metric, d.Name(), keys, vals),
+			Samples: []prompb.Sample{{Timestamp: timestamp.FromTime(t), Value: score}},
+		})
+	}
+	return ts, rows.Err()
+}
+
+// scoreLabels returns the labels of the score series of a series, which are
+// its labels with the name of the score metric and the detector label.
+func scoreLabels(metric, detector string, keys, vals []string) []prompb.Label {
+	lbls := make([]prompb.Label, 0, len(keys)+1)
+	lbls = append(lbls,
+		prompb.Label{Name: labels.MetricName, Value: metric + ScoreSuffix},
+		prompb.Label{Name: DetectorLabel, Value: detector},
+	)
+	for i, key := range keys {
+		if key == labels.MetricName || key == DetectorLabel {
+			continue
+		}
+		lbls = append(lbls, prompb.Label{Name: key, Value: vals[i]})
+	}
+	sort.Slice(lbls, func(i, j int) bool { return lbls[i].Name < lbls[j].Name })
+	return lbls
+}
@@ -0,0 +1,90 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package anomaly
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+type fakeInserter struct {
+	reqs []prompb.WriteRequest
+}
+
+func (f *fakeInserter) Ingest(r *prompb.WriteRequest) (uint64, uint64, error) {
+	f.reqs = append(f.reqs, *r)
+	return uint64(len(r.Timeseries)), 0, nil
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{DetectorsStr: "zscore", Interval: time.Minute, Window: time.Hour, Season: 24 * time.Hour, Seasons: 3}
+	require.NoError(t, Validate(&cfg))
+	require.Nil(t, cfg.Metrics)
+
+	cfg.MetricsStr = "cpu, mem"
+	cfg.DetectorsStr = "zscore,seasonal"
+	require.NoError(t, Validate(&cfg))
+	require.Equal(t, []string{"cpu", "mem"}, cfg.Metrics)
+	require.Equal(t, []Detector{zScore{window: time.Hour}, seasonal{window: time.Hour, season: 24 * time.Hour, seasons: 3}}, cfg.Detectors)
+
+	cfg.DetectorsStr = "prophet"
+	require.Error(t, Validate(&cfg))
+
+	cfg.DetectorsStr = "zscore"
+	cfg.Seasons = 0
+	require.Error(t, Validate(&cfg))
+}
+
+func TestDetect(t *testing.T) {
+	end := time.Unix(600, 0)
+	sampleTime := time.Unix(590, 0)
+	query := fmt.Sprintf(scoresSQL, fmt.Sprintf(zScoreSQL, `"prom_data"."cpu"`))
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: tableSQL, Args: []interface{}{"cpu"}, Results: model.RowResults{{"prom_data", "cpu"}}},
+		{
+			Sql:  query,
+			Args: []interface{}{end, time.Hour},
+			Results: model.RowResults{
+				{int64(1), sampleTime, 3.5, []string{"__name__", "detector", "job"}, []string{"cpu", "spoofed", "node"}},
+			},
+		},
+		{Sql: tableSQL, Args: []interface{}{"cpu"}, Results: model.RowResults{{"prom_data", "cpu"}}},
+		{
+			Sql:  query,
+			Args: []interface{}{end, time.Hour},
+			Results: model.RowResults{
+				{int64(1), sampleTime, 3.5, []string{"__name__", "job"}, []string{"cpu", "node"}},
+			},
+		},
+	}, t)
+	inserter := &fakeInserter{}
+	r := &Runner{conn: mock, inserter: inserter, cfg: &Config{
+		Metrics:   []string{"cpu"},
+		Detectors: []Detector{zScore{window: time.Hour}},
+		Interval:  time.Minute,
+	}}
+
+	r.detect(end.Add(30 * time.Second))
+	require.Len(t, inserter.reqs, 1)
+	require.Equal(t, []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "cpu_anomaly_score"},
+			{Name: "detector", Value: "zscore"},
+			{Name: "job", Value: "node"},
+		},
+		Samples: []prompb.Sample{{Timestamp: 590000, Value: 3.5}},
+	}}, inserter.reqs[0].Timeseries)
+	require.Equal(t, end, r.last)
+
+	// The samples scored by the previous run are not scored again.
+	r.detect(end)
+	require.Len(t, inserter.reqs, 2)
+	require.Empty(t, inserter.reqs[1].Timeseries)
+}
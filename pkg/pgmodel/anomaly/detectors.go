@@ -0,0 +1,82 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package anomaly
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// validValue excludes the staleness markers, NaNs and infinities from
+	// the statistics.
+	validValue = "value <> 'NaN' AND abs(value) <> 'Infinity'"
+
+	// zScoreSQL scores the last sample of a series by the number of standard
+	// deviations it is from the mean of the samples of the window.
+	zScoreSQL = `SELECT series_id, time, score FROM (
+	SELECT series_id, time,
+		(value - avg(value) OVER w) / nullif(stddev_samp(value) OVER w, 0) AS score,
+		row_number() OVER (PARTITION BY series_id ORDER BY time DESC) AS last
+	FROM %s
+	WHERE time > $1::TIMESTAMPTZ - $2::INTERVAL AND time <= $1 AND ` + validValue + `
+	WINDOW w AS (PARTITION BY series_id)
+) s WHERE last = 1`
+
+	// seasonalSQL decomposes the series into a trend, the mean of the
+	// window, a seasonal component, the mean of the deviations from their
+	// trend of the last samples of the windows ending at the same time of
+	// the previous seasons, and a residual. The last sample is scored by its
+	// residual in standard deviations of the detrended samples of the
+	// previous seasons.
+	seasonalSQL = `SELECT cur.series_id, cur.time,
+	(cur.detrended - avg(past.detrended) FILTER (WHERE past.last = 1)) / nullif(stddev_samp(past.detrended), 0) AS score
+FROM (
+	SELECT series_id, time,
+		value - avg(value) OVER (PARTITION BY series_id) AS detrended,
+		row_number() OVER (PARTITION BY series_id ORDER BY time DESC) AS last
+	FROM %[1]s
+	WHERE time > $1::TIMESTAMPTZ - $2::INTERVAL AND time <= $1 AND ` + validValue + `
+) cur
+INNER JOIN (
+	SELECT m.series_id, s.season,
+		m.value - avg(m.value) OVER (PARTITION BY m.series_id, s.season) AS detrended,
+		row_number() OVER (PARTITION BY m.series_id, s.season ORDER BY m.time DESC) AS last
+	FROM generate_series(1, $4::INT) s(season)
+	INNER JOIN %[1]s m ON (m.time > $1::TIMESTAMPTZ - s.season * $3::INTERVAL - $2::INTERVAL AND m.time <= $1::TIMESTAMPTZ - s.season * $3::INTERVAL)
+	WHERE m.time > $1::TIMESTAMPTZ - $4::INT * $3::INTERVAL - $2::INTERVAL AND ` + validValue + `
+) past ON (past.series_id = cur.series_id)
+WHERE cur.last = 1
+GROUP BY cur.series_id, cur.time, cur.detrended`
+)
+
+func init() {
+	RegisterDetector("zscore", func(cfg *Config) Detector { return zScore{window: cfg.Window} })
+	RegisterDetector("seasonal", func(cfg *Config) Detector {
+		return seasonal{window: cfg.Window, season: cfg.Season, seasons: cfg.Seasons}
+	})
+}
+
+type zScore struct {
+	window time.Duration
+}
+
+func (zScore) Name() string { return "zscore" }
+
+func (d zScore) Query(table string) (string, []interface{}) {
+	return fmt.Sprintf(zScoreSQL, table), []interface{}{d.window}
+}
+
+type seasonal struct {
+	window  time.Duration
+	season  time.Duration
+	seasons int
+}
+
+func (seasonal) Name() string { return "seasonal" }
+
+func (d seasonal) Query(table string) (string, []interface{}) {
+	return fmt.Sprintf(seasonalSQL, table), []interface{}{d.window, d.season, d.seasons}
+}
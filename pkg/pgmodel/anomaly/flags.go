@@ -0,0 +1,78 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package anomaly
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDetectors = "zscore"
+	defaultInterval  = time.Minute
+	defaultWindow    = time.Hour
+	defaultSeason    = 24 * time.Hour
+	defaultSeasons   = 3
+)
+
+// Config is the configuration of the anomaly detection jobs.
+type Config struct {
+	MetricsStr   string
+	DetectorsStr string
+	Interval     time.Duration
+	Window       time.Duration
+	Season       time.Duration
+	Seasons      int
+
+	// Metrics and Detectors are set by Validate.
+	Metrics   []string
+	Detectors []Detector
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.MetricsStr, "anomaly-detection-metrics", "", "Comma-separated names of the metrics whose series are scored by the anomaly-detection-detectors "+
+		"every anomaly-detection-interval. The scores are ingested as the '<metric>_anomaly_score' series with the labels of the scored series and a 'detector' label. "+
+		"Disabled by default.")
+	fs.StringVar(&cfg.DetectorsStr, "anomaly-detection-detectors", defaultDetectors, "Comma-separated detectors scoring the series of anomaly-detection-metrics: "+
+		"'zscore' (deviation from the mean of anomaly-detection-window) or 'seasonal' (deviation from the same time of the previous anomaly-detection-seasons seasons, after removing the trend).")
+	fs.DurationVar(&cfg.Interval, "anomaly-detection-interval", defaultInterval, "Interval at which the series of anomaly-detection-metrics are scored.")
+	fs.DurationVar(&cfg.Window, "anomaly-detection-window", defaultWindow, "Window of the samples the score of the last sample of a series is computed from.")
+	fs.DurationVar(&cfg.Season, "anomaly-detection-season", defaultSeason, "Length of the season of the 'seasonal' detector, e.g. a day for daily patterns.")
+	fs.IntVar(&cfg.Seasons, "anomaly-detection-seasons", defaultSeasons, "Number of previous seasons the 'seasonal' detector compares the series with.")
+}
+
+func Validate(cfg *Config) error {
+	cfg.Metrics, cfg.Detectors = nil, nil
+	if cfg.MetricsStr == "" {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("invalid anomaly-detection-interval %v, must be positive", cfg.Interval)
+	}
+	if cfg.Window <= 0 {
+		return fmt.Errorf("invalid anomaly-detection-window %v, must be positive", cfg.Window)
+	}
+	if cfg.Season <= 0 {
+		return fmt.Errorf("invalid anomaly-detection-season %v, must be positive", cfg.Season)
+	}
+	if cfg.Seasons < 1 {
+		return fmt.Errorf("invalid anomaly-detection-seasons %d, must be at least 1", cfg.Seasons)
+	}
+	for _, metric := range strings.Split(cfg.MetricsStr, ",") {
+		if metric = strings.TrimSpace(metric); metric != "" {
+			cfg.Metrics = append(cfg.Metrics, metric)
+		}
+	}
+	for _, name := range strings.Split(cfg.DetectorsStr, ",") {
+		d, err := NewDetector(strings.TrimSpace(name), cfg)
+		if err != nil {
+			return fmt.Errorf("invalid anomaly-detection-detectors: %w", err)
+		}
+		cfg.Detectors = append(cfg.Detectors, d)
+	}
+	return nil
+}
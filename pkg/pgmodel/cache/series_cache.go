@@ -15,6 +15,7 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/timescale/promscale/pkg/clockcache"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/prompb"
 )
@@ -29,6 +30,7 @@ const GrowFactor = float64(2.0)       // multiply cache size by this factor when
 type SeriesCache interface {
 	Reset()
 	GetSeriesFromProtos(labelPairs []prompb.Label) (series *model.Series, metricName string, err error)
+	GetSeriesFromSortedProtos(labelPairs []prompb.Label) (series *model.Series, metricName string, err error)
 	Len() int
 	Cap() int
 	Evictions() uint64
@@ -141,17 +143,26 @@ func (t *SeriesCacheImpl) setSeries(str string, lset *model.Series) *model.Serie
 // Get a string representation for hashing and comparison
 // This representation is guaranteed to uniquely represent the underlying label
 // set, though need not human-readable, or indeed, valid utf-8
-func generateKey(labels []prompb.Label) (key string, metricName string, error error) {
+// Unless sorted is true, the labels are sorted by name and duplicate names are
+// rejected. If it is true the caller guarantees both, which saves the checks.
+func generateKey(labels []prompb.Label, sorted bool) (key string, metricName string, error error) {
 	if len(labels) == 0 {
 		return "", "", nil
 	}
 
-	comparator := func(i, j int) bool {
-		return labels[i].Name < labels[j].Name
-	}
+	if !sorted {
+		comparator := func(i, j int) bool {
+			return labels[i].Name < labels[j].Name
+		}
 
-	if !sort.SliceIsSorted(labels, comparator) {
-		sort.Slice(labels, comparator)
+		if !sort.SliceIsSorted(labels, comparator) {
+			sort.Slice(labels, comparator)
+		}
+		for i := 1; i < len(labels); i++ {
+			if labels[i].Name == labels[i-1].Name {
+				return "", "", fmt.Errorf("%w: %s", errors.ErrDuplicateLabelName, labels[i].Name)
+			}
+		}
 	}
 
 	expectedStrLen := len(labels) * 4 // 2 for the length of each key, and 2 for the length of each value
@@ -216,7 +227,18 @@ func (t *SeriesCacheImpl) GetSeriesFromLabels(ls labels.Labels) (*model.Series,
 
 // GetSeriesFromProtos converts a prompb.Label to a canonical Labels object
 func (t *SeriesCacheImpl) GetSeriesFromProtos(labelPairs []prompb.Label) (*model.Series, string, error) {
-	key, metricName, err := generateKey(labelPairs)
+	return t.getSeries(labelPairs, false)
+}
+
+// GetSeriesFromSortedProtos is GetSeriesFromProtos for labels the sender
+// guarantees to be sorted by name and free of duplicate names, which are not
+// checked.
+func (t *SeriesCacheImpl) GetSeriesFromSortedProtos(labelPairs []prompb.Label) (*model.Series, string, error) {
+	return t.getSeries(labelPairs, true)
+}
+
+func (t *SeriesCacheImpl) getSeries(labelPairs []prompb.Label, sorted bool) (*model.Series, string, error) {
+	key, metricName, err := generateKey(labelPairs, sorted)
 	if err != nil {
 		return nil, "", err
 	}
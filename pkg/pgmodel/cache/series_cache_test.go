@@ -1,11 +1,15 @@
 package cache
 
 import (
+	"errors"
 	"math"
 	"strings"
 	"testing"
 
 	promLabels "github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	pgmodelErrs "github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/prompb"
 )
 
 func TestBigLables(t *testing.T) {
@@ -30,3 +34,21 @@ func TestBigLables(t *testing.T) {
 		t.Errorf("expected error")
 	}
 }
+
+func TestGetSeriesFromProtos(t *testing.T) {
+	cache := NewSeriesCache(DefaultConfig, nil)
+	unsorted := []prompb.Label{{Name: "job", Value: "api"}, {Name: "__name__", Value: "up"}}
+	series, metricName, err := cache.GetSeriesFromProtos(unsorted)
+	require.NoError(t, err)
+	require.Equal(t, "up", metricName)
+	require.Equal(t, "__name__", unsorted[0].Name, "the labels must be sorted")
+
+	sorted := []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}
+	sortedSeries, metricName, err := cache.GetSeriesFromSortedProtos(sorted)
+	require.NoError(t, err)
+	require.Equal(t, "up", metricName)
+	require.True(t, series == sortedSeries, "sorted labels must map to the canonical series")
+
+	_, _, err = cache.GetSeriesFromProtos([]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}, {Name: "job", Value: "db"}})
+	require.True(t, errors.Is(err, pgmodelErrs.ErrDuplicateLabelName))
+}
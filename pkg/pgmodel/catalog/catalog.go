@@ -0,0 +1,213 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package catalog implements the catalog service, through which the
+// connectors of a deployment have the series they ingest created by a single
+// elected connector. Creating all the series in one place serializes the
+// creation of new labels and series, which otherwise conflict and are
+// retried across connectors when many series are created at once, e.g.
+// during deploys.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	serviceName        = "promscale.Catalog"
+	getSeriesIDsMethod = "/" + serviceName + "/GetSeriesIDs"
+	// codecName is the content subtype of the messages of the service, which
+	// are encoded in JSON since they are only made of strings and integers.
+	codecName = "promscale-json"
+
+	callTimeout = 30 * time.Second
+)
+
+// SeriesLabels are the sorted label names and values of a series.
+type SeriesLabels struct {
+	Metric string   `json:"metric"`
+	Names  []string `json:"names"`
+	Values []string `json:"values"`
+}
+
+// SeriesRequest asks for the ids of series, which are created if needed.
+type SeriesRequest struct {
+	Series []SeriesLabels `json:"series"`
+}
+
+// SeriesResponse has the ids of the requested series, in the same order,
+// along with the epoch of the ids.
+type SeriesResponse struct {
+	Epoch int64   `json:"epoch"`
+	IDs   []int64 `json:"ids"`
+}
+
+// Resolver creates the series in the database.
+type Resolver interface {
+	GetSeriesIDs(series []SeriesLabels) (epoch int64, ids []int64, err error)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return codecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type catalogServer interface {
+	GetSeriesIDs(context.Context, *SeriesRequest) (*SeriesResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*catalogServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "GetSeriesIDs",
+		Handler:    getSeriesIDsHandler,
+	}},
+	Metadata: "catalog",
+}
+
+func getSeriesIDsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SeriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(catalogServer).GetSeriesIDs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: getSeriesIDsMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(catalogServer).GetSeriesIDs(ctx, req.(*SeriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Server serves the catalog service while its connector is the elected
+// one, creating the requested series one request at a time.
+type Server struct {
+	resolver Resolver
+	isLeader func() bool
+	mux      sync.Mutex
+}
+
+// NewServer returns a server creating the series with the resolver while
+// isLeader returns true. isLeader is called for each request, while no other
+// request is served.
+func NewServer(resolver Resolver, isLeader func() bool) *Server {
+	return &Server{resolver: resolver, isLeader: isLeader}
+}
+
+// Register registers the catalog service on the gRPC server.
+func (s *Server) Register(grpcServer *grpc.Server) {
+	grpcServer.RegisterService(&serviceDesc, s)
+}
+
+// GetSeriesIDs returns the ids of the requested series. It fails with
+// Unavailable if the connector is not the elected one, for the clients to
+// try the next connector.
+func (s *Server) GetSeriesIDs(_ context.Context, req *SeriesRequest) (*SeriesResponse, error) {
+	for _, series := range req.Series {
+		if len(series.Names) != len(series.Values) {
+			return nil, status.Error(codes.InvalidArgument, "label names and values of different lengths")
+		}
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.isLeader() {
+		return nil, status.Error(codes.Unavailable, "not the elected catalog connector")
+	}
+	epoch, ids, err := s.resolver.GetSeriesIDs(req.Series)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &SeriesResponse{Epoch: epoch, IDs: ids}, nil
+}
+
+// Client calls the catalog service of the elected connector among the
+// connectors serving it.
+type Client struct {
+	conns   []*grpc.ClientConn
+	mux     sync.Mutex
+	current int
+}
+
+// NewClient returns a client of the catalog service served at the
+// addresses, secured as configured. The connections are established lazily.
+func NewClient(addresses []string, cfg *Config) (*Client, error) {
+	opts, err := cfg.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)))
+	c := &Client{}
+	for _, addr := range addresses {
+		conn, err := grpc.Dial(addr, opts...)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("catalog service %s: %w", addr, err)
+		}
+		c.conns = append(c.conns, conn)
+	}
+	return c, nil
+}
+
+// GetSeriesIDs returns the epoch and the ids of the series, in the same
+// order, from the elected connector. It tries each connector in turn,
+// starting with the last one that answered.
+func (c *Client) GetSeriesIDs(series []SeriesLabels) (int64, []int64, error) {
+	c.mux.Lock()
+	start := c.current
+	c.mux.Unlock()
+
+	var err error
+	for i := 0; i < len(c.conns); i++ {
+		idx := (start + i) % len(c.conns)
+		var resp *SeriesResponse
+		resp, err = c.call(c.conns[idx], series)
+		if status.Code(err) == codes.Unavailable {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(resp.IDs) != len(series) {
+			return 0, nil, fmt.Errorf("catalog service returned %d series ids for %d series", len(resp.IDs), len(series))
+		}
+		c.mux.Lock()
+		c.current = idx
+		c.mux.Unlock()
+		return resp.Epoch, resp.IDs, nil
+	}
+	return 0, nil, fmt.Errorf("no elected connector serving the catalog service: %w", err)
+}
+
+func (c *Client) call(conn *grpc.ClientConn, series []SeriesLabels) (*SeriesResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	resp := new(SeriesResponse)
+	if err := conn.Invoke(ctx, getSeriesIDsMethod, &SeriesRequest{Series: series}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Close closes the connections to the connectors.
+func (c *Client) Close() {
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,211 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package catalog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeResolver struct {
+	calls int32
+	err   error
+}
+
+func (r *fakeResolver) GetSeriesIDs(series []SeriesLabels) (int64, []int64, error) {
+	atomic.AddInt32(&r.calls, 1)
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+	ids := make([]int64, len(series))
+	for i, s := range series {
+		ids[i] = int64(len(s.Metric)*100 + len(s.Names))
+	}
+	return 7, ids, nil
+}
+
+func serve(t *testing.T, resolver Resolver, leader *int32, opts ...grpc.ServerOption) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := grpc.NewServer(opts...)
+	NewServer(resolver, func() bool { return atomic.LoadInt32(leader) == 1 }).Register(grpcServer)
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+	return listener.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	var (
+		follower, leader = &fakeResolver{}, &fakeResolver{}
+		notElected       int32
+		elected          int32 = 1
+	)
+	client, err := NewClient([]string{serve(t, follower, &notElected), serve(t, leader, &elected)}, &Config{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	series := []SeriesLabels{
+		{Metric: "cpu", Names: []string{"__name__", "job"}, Values: []string{"cpu", "node"}},
+		{Metric: "mem", Names: []string{"__name__"}, Values: []string{"mem"}},
+	}
+	epoch, ids, err := client.GetSeriesIDs(series)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), epoch)
+	require.Equal(t, []int64{302, 301}, ids)
+	require.Equal(t, int32(0), atomic.LoadInt32(&follower.calls))
+	require.Equal(t, int32(1), atomic.LoadInt32(&leader.calls))
+
+	// The client sticks to the connector that answered.
+	require.Equal(t, 1, client.current)
+
+	// The election moves to the other connector.
+	atomic.StoreInt32(&elected, 0)
+	atomic.StoreInt32(&notElected, 1)
+	_, _, err = client.GetSeriesIDs(series)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&follower.calls))
+	require.Equal(t, 0, client.current)
+
+	// No connector is elected.
+	atomic.StoreInt32(&notElected, 0)
+	_, _, err = client.GetSeriesIDs(series)
+	require.Error(t, err)
+}
+
+func TestServerErrors(t *testing.T) {
+	var elected int32 = 1
+	resolver := &fakeResolver{err: fmt.Errorf("database unavailable")}
+	client, err := NewClient([]string{serve(t, resolver, &elected)}, &Config{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, _, err = client.GetSeriesIDs([]SeriesLabels{{Metric: "cpu", Names: []string{"__name__"}, Values: []string{"cpu"}}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "database unavailable")
+
+	_, _, err = client.GetSeriesIDs([]SeriesLabels{{Metric: "cpu", Names: []string{"__name__", "job"}, Values: []string{"cpu"}}})
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&resolver.calls))
+}
+
+var testSeries = []SeriesLabels{{Metric: "cpu", Names: []string{"__name__"}, Values: []string{"cpu"}}}
+
+func TestToken(t *testing.T) {
+	var elected int32 = 1
+	resolver := &fakeResolver{}
+	opts, err := ServerOptions(&Config{Token: "secret"})
+	require.NoError(t, err)
+	addr := serve(t, resolver, &elected, opts...)
+
+	for _, token := range []string{"", "wrong"} {
+		client, err := NewClient([]string{addr}, &Config{Token: token})
+		require.NoError(t, err)
+		_, _, err = client.GetSeriesIDs(testSeries)
+		require.Equal(t, codes.Unauthenticated, status.Code(err), token)
+		client.Close()
+	}
+	require.Equal(t, int32(0), atomic.LoadInt32(&resolver.calls))
+
+	client, err := NewClient([]string{addr}, &Config{Token: "secret"})
+	require.NoError(t, err)
+	defer client.Close()
+	_, _, err = client.GetSeriesIDs(testSeries)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&resolver.calls))
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "promscale-catalog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caFile, caCert, caKey := writeCert(t, dir, "ca", nil, nil)
+	certFile, _, _ := writeCert(t, dir, "connector", caCert, caKey)
+	otherCAFile, otherCACert, otherCAKey := writeCert(t, dir, "other-ca", nil, nil)
+	otherCertFile, _, _ := writeCert(t, dir, "other", otherCACert, otherCAKey)
+
+	cfg := &Config{CertFile: certFile, KeyFile: keyFile(certFile), CAFile: caFile}
+	require.NoError(t, Validate(cfg))
+	var elected int32 = 1
+	opts, err := ServerOptions(cfg)
+	require.NoError(t, err)
+	addr := serve(t, &fakeResolver{}, &elected, opts...)
+
+	client, err := NewClient([]string{addr}, cfg)
+	require.NoError(t, err)
+	defer client.Close()
+	_, _, err = client.GetSeriesIDs(testSeries)
+	require.NoError(t, err)
+
+	// The server requires a client certificate signed by its CA.
+	other, err := NewClient([]string{addr}, &Config{CertFile: otherCertFile, KeyFile: keyFile(otherCertFile), CAFile: caFile})
+	require.NoError(t, err)
+	defer other.Close()
+	_, _, err = other.GetSeriesIDs(testSeries)
+	require.Error(t, err)
+
+	// The client requires a server certificate signed by its CA.
+	untrusting, err := NewClient([]string{addr}, &Config{CertFile: certFile, KeyFile: keyFile(certFile), CAFile: otherCAFile})
+	require.NoError(t, err)
+	defer untrusting.Close()
+	_, _, err = untrusting.GetSeriesIDs(testSeries)
+	require.Error(t, err)
+
+	require.Error(t, Validate(&Config{CertFile: certFile}))
+	require.Error(t, Validate(&Config{CAFile: caFile}))
+}
+
+func keyFile(certFile string) string {
+	return certFile[:len(certFile)-len(".crt")] + ".key"
+}
+
+// writeCert writes a certificate for 127.0.0.1 and its key, signed by the
+// parent or self-signed as a CA if the parent is nil.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (string, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile(certFile), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, cert, key
+}
@@ -0,0 +1,143 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package catalog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	// lockID is the advisory lock held by the elected catalog connector.
+	lockID = 0x3C5A90D1E4B7F26A // Chosen randomly.
+	// electionInterval is the interval at which the connectors try to
+	// acquire the lock, and the elected one checks that it still holds it.
+	electionInterval = 5 * time.Second
+
+	// heldLockSQL returns whether the session holds the lock. A bigint
+	// advisory lock is listed with its high and low halves as classid and
+	// objid.
+	heldLockSQL = `SELECT EXISTS (
+	SELECT 1 FROM pg_catalog.pg_locks
+	WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted
+	AND classid = ($1::bigint >> 32)::oid AND objid = ($1::bigint & 4294967295)::oid AND objsubid = 1)`
+)
+
+// Election elects the connector serving the catalog service among the
+// connectors listening for it, as the one holding an advisory lock.
+type Election struct {
+	lock   *util.PgAdvisoryLock
+	leader int32
+	done   chan struct{}
+	// mux serializes the uses of the connection holding the lock.
+	mux sync.Mutex
+}
+
+// NewElection starts trying to acquire the lock, and checks that it is
+// still held on the connection holding it.
+func NewElection(connStr string) (*Election, error) {
+	lock, err := util.NewPgAdvisoryLock(lockID, connStr)
+	if err != nil {
+		return nil, err
+	}
+	e := &Election{lock: lock, done: make(chan struct{})}
+	e.elect()
+	go e.run(electionInterval)
+	return e, nil
+}
+
+// IsLeader returns whether the connector was the elected one at the last
+// check.
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// CheckLeader returns whether the connector is the elected one, checking
+// that the lock is still held. The server calls it for each request, so that
+// a connector that lost the lock stops serving at once instead of at the
+// next election, while another one may already be elected.
+func (e *Election) CheckLeader() bool {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if !e.IsLeader() {
+		return false
+	}
+	e.setLeader(e.checkLock())
+	return e.IsLeader()
+}
+
+func (e *Election) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.elect()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *Election) elect() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.IsLeader() {
+		e.setLeader(e.checkLock())
+		return
+	}
+	e.setLeader(e.lock.GetAdvisoryLock())
+}
+
+func (e *Election) setLeader(leader bool, err error) {
+	if err != nil {
+		log.Warn("msg", "catalog service election failed", "err", err)
+		// The lock is released with the connection, which is reopened
+		// on the next attempt.
+		e.lock.Close()
+		leader = false
+	}
+	was := atomic.SwapInt32(&e.leader, boolToInt32(leader)) == 1
+	if leader && !was {
+		log.Info("msg", "Elected to serve the catalog service")
+	} else if !leader && was {
+		log.Info("msg", "No longer serving the catalog service")
+	}
+}
+
+// checkLock returns whether the lock is still held by the connection that
+// acquired it.
+func (e *Election) checkLock() (bool, error) {
+	conn, err := e.lock.Conn()
+	if err != nil {
+		return false, err
+	}
+	var held bool
+	if err = conn.QueryRow(context.Background(), heldLockSQL, int64(lockID)).Scan(&held); err != nil {
+		return false, err
+	}
+	return held, nil
+}
+
+// Close stops the election and releases the lock.
+func (e *Election) Close() {
+	close(e.done)
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.lock.Close()
+	atomic.StoreInt32(&e.leader, 0)
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
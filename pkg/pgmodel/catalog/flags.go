@@ -0,0 +1,148 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package catalog
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationKey = "authorization"
+	bearerPrefix     = "Bearer "
+)
+
+// Config secures the catalog service. The connectors serving it and those
+// calling it share the same settings.
+type Config struct {
+	Token    string
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Token, "catalog-service-token", "", "Shared secret that the connectors calling the catalog service send, "+
+		"and that the connectors serving it require.")
+	fs.StringVar(&cfg.CertFile, "catalog-service-tls-cert-file", "", "TLS certificate file of the connectors, presented when serving and when calling the catalog service. "+
+		"If set, the catalog service is served and called over TLS.")
+	fs.StringVar(&cfg.KeyFile, "catalog-service-tls-key-file", "", "TLS key file of catalog-service-tls-cert-file.")
+	fs.StringVar(&cfg.CAFile, "catalog-service-tls-ca-file", "", "CA certificate file verifying the certificates of the connectors serving the catalog service, "+
+		"instead of the CAs of the system. If set, the connectors serving it also require the connectors calling it to present a certificate it verifies (mutual TLS).")
+}
+
+func Validate(cfg *Config) error {
+	if (cfg.CertFile != "") != (cfg.KeyFile != "") {
+		return fmt.Errorf("both catalog-service-tls-cert-file and catalog-service-tls-key-file need to be provided for a valid TLS configuration")
+	}
+	if cfg.CAFile != "" && cfg.CertFile == "" {
+		return fmt.Errorf("catalog-service-tls-ca-file requires catalog-service-tls-cert-file to be set")
+	}
+	return nil
+}
+
+// Secured returns whether the calls to the catalog service are
+// authenticated, with the token or with TLS.
+func (cfg *Config) Secured() bool {
+	return cfg.Token != "" || cfg.CertFile != ""
+}
+
+// ServerOptions returns the options of the gRPC server serving the catalog
+// service.
+func ServerOptions(cfg *Config) ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+	if cfg.CertFile != "" {
+		tlsConfig, err := cfg.tlsConfig(true)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if cfg.Token != "" {
+		opts = append(opts, grpc.UnaryInterceptor(tokenInterceptor(cfg.Token)))
+	}
+	return opts, nil
+}
+
+func (cfg *Config) dialOptions() ([]grpc.DialOption, error) {
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if cfg.CertFile != "" {
+		tlsConfig, err := cfg.tlsConfig(false)
+		if err != nil {
+			return nil, err
+		}
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	}
+	if cfg.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: cfg.Token, tls: cfg.CertFile != ""}))
+	}
+	return opts, nil
+}
+
+// tlsConfig returns the TLS configuration of the server or of the client.
+func (cfg *Config) tlsConfig(server bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading the catalog service TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := ioutil.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading the catalog service CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in the catalog service CA file %s", cfg.CAFile)
+	}
+	if server {
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// tokenCredentials sends the token with every call.
+type tokenCredentials struct {
+	token string
+	tls   bool
+}
+
+func (c tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{authorizationKey: bearerPrefix + c.token}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return c.tls
+}
+
+// tokenInterceptor fails the calls that do not carry the token with
+// Unauthenticated.
+func tokenInterceptor(token string) grpc.UnaryServerInterceptor {
+	expected := []byte(bearerPrefix + token)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(authorizationKey)
+		if len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), expected) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid catalog service token")
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,65 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	// commitSQL only moves a checkpoint forward, so that a late request
+	// replayed by the source cannot move it back.
+	commitSQL = `INSERT INTO ` + schema.Catalog + `.ingest_checkpoint AS c (source, source_offset, committed_at)
+VALUES ($1, $2, now())
+ON CONFLICT (source) DO UPDATE SET source_offset = EXCLUDED.source_offset, committed_at = EXCLUDED.committed_at
+WHERE c.source_offset < EXCLUDED.source_offset`
+	querySQL = "SELECT source, source_offset, committed_at FROM " + schema.Catalog + ".ingest_checkpoint WHERE $1 = '' OR source = $1 ORDER BY source"
+)
+
+// Checkpoint is the offset of a partition of a replayable source up to which
+// the samples were committed to the database.
+type Checkpoint struct {
+	Source      string    `json:"source"`
+	Offset      int64     `json:"offset"`
+	CommittedAt time.Time `json:"committedAt"`
+}
+
+// Commit records that the samples of source up to offset were committed. It
+// must only be called once they are, and the requests of a source must be
+// committed in order for the checkpoint not to skip over uncommitted ones.
+func Commit(conn pgxconn.PgxConn, source string, offset int64) error {
+	if _, err := conn.Exec(context.Background(), commitSQL, source, offset); err != nil {
+		return fmt.Errorf("commit checkpoint of source %s: %w", source, err)
+	}
+	return nil
+}
+
+// Query returns the checkpoint of source, or all the checkpoints if source is
+// empty, ordered by source.
+func Query(conn pgxconn.PgxConn, source string) ([]Checkpoint, error) {
+	rows, err := conn.Query(context.Background(), querySQL, source)
+	if err != nil {
+		return nil, fmt.Errorf("query checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]Checkpoint, 0)
+	for rows.Next() {
+		var c Checkpoint
+		if err := rows.Scan(&c.Source, &c.Offset, &c.CommittedAt); err != nil {
+			return nil, fmt.Errorf("query result: %w", err)
+		}
+		result = append(result, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query result: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,253 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package checksum records a checksum of the samples of every series of the
+// ingested write requests, and verifies in the background that the samples
+// read back from the database match them, to catch silent corruption
+// between the connector and the storage during qualification testing.
+package checksum
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	recordSQL = `INSERT INTO ` + schema.Catalog + `.sample_checksum (metric_name, series_id, start_time, end_time, samples, checksum)
+SELECT * FROM unnest($1::TEXT[], $2::BIGINT[], $3::TIMESTAMPTZ[], $4::TIMESTAMPTZ[], $5::INT[], $6::BIGINT[])`
+	pendingSQL = `SELECT c.id, c.series_id, c.start_time, c.end_time, c.samples, c.checksum, coalesce(m.table_name::TEXT, ''),
+    coalesce(` + schema.Catalog + `.get_metric_read_schema(m.table_schema, m.table_name)::TEXT, '')
+FROM ` + schema.Catalog + `.sample_checksum c
+LEFT JOIN ` + schema.Catalog + `.metric m ON (m.metric_name = c.metric_name AND m.table_schema = '` + schema.Data + `')
+WHERE c.verified_at IS NULL AND c.recorded_at < now() - $1::INTERVAL
+ORDER BY c.id
+LIMIT $2`
+	samplesSQL = "SELECT time, value FROM %s WHERE series_id = $1 AND time >= $2 AND time <= $3 ORDER BY time"
+	resultSQL  = "UPDATE " + schema.Catalog + ".sample_checksum SET verified_at = now(), result = $2 WHERE id = $1"
+
+	// Samples are verified verifyDelay after they are recorded, so that the
+	// transactions inserting them are committed, including with async acks.
+	verifyDelay    = time.Minute
+	verifyInterval = 10 * time.Second
+	verifyBatch    = 1000
+
+	resultMatch    = "match"
+	resultMismatch = "mismatch"
+	// resultInconclusive is the result of the series whose stored samples
+	// in the range of the request differ in number from the request, e.g.
+	// as other requests inserted samples in the same range, or the samples
+	// were deleted.
+	resultInconclusive = "inconclusive"
+	resultFailed       = "failed"
+)
+
+var verifications = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "ingest_checksum_verifications_total",
+		Help:      "Total number of series of write requests whose stored samples were verified against the checksum of the request, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(verifications)
+}
+
+// Entry is the checksum of the samples of a series in a write request.
+type Entry struct {
+	Metric     string
+	SeriesID   int64
+	Start, End int64
+	Samples    int
+	Checksum   int64
+}
+
+// NewEntry returns the checksum of the samples of a series, which are
+// deduplicated by timestamp as they are when they are stored.
+func NewEntry(metric string, samples []prompb.Sample) Entry {
+	sorted := make([]prompb.Sample, len(samples))
+	copy(sorted, samples)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+	dedup := sorted[:0]
+	for i, s := range sorted {
+		if i > 0 && s.Timestamp == sorted[i-1].Timestamp {
+			continue
+		}
+		dedup = append(dedup, s)
+	}
+	e := Entry{Metric: metric, Samples: len(dedup), Checksum: sum(dedup)}
+	if len(dedup) > 0 {
+		e.Start, e.End = dedup[0].Timestamp, dedup[len(dedup)-1].Timestamp
+	}
+	return e
+}
+
+// sum hashes the timestamps and values of the samples, sorted by timestamp.
+// All NaNs hash the same, since their payload, e.g. of staleness markers,
+// is not preserved by the database.
+func sum(samples []prompb.Sample) int64 {
+	h := fnv.New64a()
+	var buf [16]byte
+	for _, s := range samples {
+		bits := math.Float64bits(s.Value)
+		if math.IsNaN(s.Value) {
+			bits = math.Float64bits(math.NaN())
+		}
+		binary.BigEndian.PutUint64(buf[:8], uint64(s.Timestamp))
+		binary.BigEndian.PutUint64(buf[8:], bits)
+		_, _ = h.Write(buf[:])
+	}
+	return int64(h.Sum64())
+}
+
+// Record stores the checksums of the series of an ingested write request.
+func Record(conn pgxconn.PgxConn, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var (
+		metrics   = make([]string, len(entries))
+		seriesIDs = make([]int64, len(entries))
+		starts    = make([]time.Time, len(entries))
+		ends      = make([]time.Time, len(entries))
+		counts    = make([]int32, len(entries))
+		checksums = make([]int64, len(entries))
+	)
+	for i, e := range entries {
+		metrics[i], seriesIDs[i] = e.Metric, e.SeriesID
+		starts[i], ends[i] = timestamp.Time(e.Start), timestamp.Time(e.End)
+		counts[i], checksums[i] = int32(e.Samples), e.Checksum
+	}
+	if _, err := conn.Exec(context.Background(), recordSQL, metrics, seriesIDs, starts, ends, counts, checksums); err != nil {
+		return fmt.Errorf("record sample checksums: %w", err)
+	}
+	return nil
+}
+
+// Verifier reads back the samples of the recorded checksums once they are
+// committed, and compares them with the checksums.
+type Verifier struct {
+	conn pgxconn.PgxConn
+}
+
+// NewVerifier returns a verifier running until sigClose is closed.
+func NewVerifier(conn pgxconn.PgxConn, sigClose <-chan struct{}) *Verifier {
+	v := &Verifier{conn: conn}
+	go v.run(sigClose)
+	return v
+}
+
+func (v *Verifier) run(sigClose <-chan struct{}) {
+	ticker := time.NewTicker(verifyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := v.verifyPending(); err != nil {
+				log.Warn("msg", "error verifying sample checksums", "err", err)
+			}
+		case <-sigClose:
+			return
+		}
+	}
+}
+
+type pending struct {
+	id         int64
+	seriesID   int64
+	start, end time.Time
+	samples    int32
+	checksum   int64
+	table      string
+	// readSchema is the schema of the relation holding all the samples of
+	// the table, see get_metric_read_schema.
+	readSchema string
+}
+
+// verifyPending verifies a batch of the recorded checksums.
+func (v *Verifier) verifyPending() error {
+	rows, err := v.conn.Query(context.Background(), pendingSQL, verifyDelay, verifyBatch)
+	if err != nil {
+		return err
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err = rows.Scan(&p.id, &p.seriesID, &p.start, &p.end, &p.samples, &p.checksum, &p.table, &p.readSchema); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range batch {
+		result, err := v.verify(p)
+		if err != nil {
+			log.Warn("msg", "error reading back the samples of a series", "series_id", p.seriesID, "err", err)
+			result = resultFailed
+		}
+		verifications.WithLabelValues(result).Inc()
+		if result == resultMismatch {
+			log.Error("msg", "stored samples do not match the checksum of the write request", "series_id", p.seriesID, "table", p.table, "start", p.start, "end", p.end)
+		}
+		if _, err = v.conn.Exec(context.Background(), resultSQL, p.id, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) verify(p pending) (string, error) {
+	if p.table == "" {
+		// The metric was dropped.
+		return resultInconclusive, nil
+	}
+	table := pgx.Identifier{p.readSchema, p.table}.Sanitize()
+	rows, err := v.conn.Query(context.Background(), fmt.Sprintf(samplesSQL, table), p.seriesID, p.start, p.end)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	samples := make([]prompb.Sample, 0, p.samples)
+	for rows.Next() {
+		var (
+			t     time.Time
+			value float64
+		)
+		if err = rows.Scan(&t, &value); err != nil {
+			return "", err
+		}
+		samples = append(samples, prompb.Sample{Timestamp: timestamp.FromTime(t), Value: value})
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	switch {
+	case len(samples) != int(p.samples):
+		return resultInconclusive, nil
+	case sum(samples) != p.checksum:
+		return resultMismatch, nil
+	}
+	return resultMatch, nil
+}
@@ -0,0 +1,89 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package checksum
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestNewEntry(t *testing.T) {
+	samples := []prompb.Sample{{Timestamp: 3, Value: 3}, {Timestamp: 1, Value: 1}, {Timestamp: 3, Value: 4}, {Timestamp: 2, Value: 2}}
+	e := NewEntry("cpu", samples)
+	require.Equal(t, "cpu", e.Metric)
+	require.Equal(t, int64(1), e.Start)
+	require.Equal(t, int64(3), e.End)
+	require.Equal(t, 3, e.Samples)
+	// The first of the samples with the same timestamp is kept.
+	require.Equal(t, sum([]prompb.Sample{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}, {Timestamp: 3, Value: 3}}), e.Checksum)
+	// The request is not modified.
+	require.Equal(t, int64(3), samples[0].Timestamp)
+
+	require.NotEqual(t, e.Checksum, NewEntry("cpu", []prompb.Sample{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}, {Timestamp: 3, Value: 3.5}}).Checksum)
+	// Staleness markers hash as any NaN.
+	require.Equal(t,
+		NewEntry("cpu", []prompb.Sample{{Timestamp: 1, Value: math.Float64frombits(value.StaleNaN)}}).Checksum,
+		NewEntry("cpu", []prompb.Sample{{Timestamp: 1, Value: math.NaN()}}).Checksum)
+}
+
+func TestRecord(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql: recordSQL,
+			Args: []interface{}{
+				[]string{"cpu", "mem"},
+				[]int64{4, 5},
+				[]time.Time{timestamp.Time(1), timestamp.Time(10)},
+				[]time.Time{timestamp.Time(2), timestamp.Time(10)},
+				[]int32{2, 1},
+				[]int64{7, 8},
+			},
+		},
+	}, t)
+	require.NoError(t, Record(mock, nil))
+	require.NoError(t, Record(mock, []Entry{
+		{Metric: "cpu", SeriesID: 4, Start: 1, End: 2, Samples: 2, Checksum: 7},
+		{Metric: "mem", SeriesID: 5, Start: 10, End: 10, Samples: 1, Checksum: 8},
+	}))
+}
+
+func TestVerifyPending(t *testing.T) {
+	stored := []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}
+	start, end := timestamp.Time(1000), timestamp.Time(2000)
+	samplesQuery := `SELECT time, value FROM "prom_data"."cpu" WHERE series_id = $1 AND time >= $2 AND time <= $3 ORDER BY time`
+	storedRows := model.RowResults{{start, float64(1)}, {end, float64(2)}}
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql:  pendingSQL,
+			Args: []interface{}{verifyDelay, verifyBatch},
+			Results: model.RowResults{
+				{int64(1), int64(4), start, end, int32(2), sum(stored), "cpu", "prom_data"},
+				{int64(2), int64(4), start, end, int32(2), sum(stored) + 1, "cpu", "prom_data"},
+				{int64(3), int64(4), start, end, int32(3), sum(stored), "cpu", "prom_data"},
+				{int64(4), int64(5), start, end, int32(1), int64(0), "", ""},
+				{int64(5), int64(6), start, end, int32(2), sum(stored), "hot", "prom_data_sharded"},
+			},
+		},
+		{Sql: samplesQuery, Args: []interface{}{int64(4), start, end}, Results: storedRows},
+		{Sql: resultSQL, Args: []interface{}{int64(1), resultMatch}},
+		{Sql: samplesQuery, Args: []interface{}{int64(4), start, end}, Results: storedRows},
+		{Sql: resultSQL, Args: []interface{}{int64(2), resultMismatch}},
+		{Sql: samplesQuery, Args: []interface{}{int64(4), start, end}, Results: storedRows},
+		{Sql: resultSQL, Args: []interface{}{int64(3), resultInconclusive}},
+		{Sql: resultSQL, Args: []interface{}{int64(4), resultInconclusive}},
+		// The samples of sharded metrics are read from the union of their shards.
+		{Sql: `SELECT time, value FROM "prom_data_sharded"."hot" WHERE series_id = $1 AND time >= $2 AND time <= $3 ORDER BY time`, Args: []interface{}{int64(6), start, end}, Results: storedRows},
+		{Sql: resultSQL, Args: []interface{}{int64(5), resultMatch}},
+	}, t)
+	require.NoError(t, (&Verifier{conn: mock}).verifyPending())
+}
@@ -68,7 +68,7 @@ func InstallUpgradePromscaleExtensions(db *pgx.Conn, extOptions ExtensionMigrate
 
 // CheckVersions is responsible for verifying the version compatibility of installed Postgresql database and extensions.
 func CheckVersions(conn *pgx.Conn, migrationFailedDueToLockError bool, extOptions ExtensionMigrateOptions) error {
-	if err := checkPgVersion(conn); err != nil {
+	if err := CheckPgVersion(conn); err != nil {
 		return fmt.Errorf("problem checking PostgreSQL version: %w", err)
 	}
 	if err := CheckExtensionsVersion(conn, migrationFailedDueToLockError, extOptions); err != nil {
@@ -77,7 +77,8 @@ func CheckVersions(conn *pgx.Conn, migrationFailedDueToLockError bool, extOption
 	return nil
 }
 
-func checkPgVersion(conn *pgx.Conn) error {
+// CheckPgVersion verifies that the PostgreSQL server version is supported.
+func CheckPgVersion(conn *pgx.Conn) error {
 	var versionString string
 	if err := conn.QueryRow(context.Background(), "SHOW server_version_num;").Scan(&versionString); err != nil {
 		return fmt.Errorf("error fetching postgresql version: %w", err)
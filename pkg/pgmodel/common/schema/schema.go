@@ -16,5 +16,11 @@ const (
 
 	SeriesView = "prom_series"
 	MetricView = "prom_metric"
-	DataSeries = "prom_data_series"
+	// MetricLabeledView holds the views of the samples of each metric with
+	// a column per label value.
+	MetricLabeledView = "prom_metric_labeled"
+	DataSeries        = "prom_data_series"
+	// DataSharded holds the views of the samples of the metrics whose
+	// inserts are spread across write shards.
+	DataSharded = "prom_data_sharded"
 )
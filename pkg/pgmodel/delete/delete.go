@@ -7,53 +7,144 @@ package delete
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgtype"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgmodel/querier"
 	"github.com/timescale/promscale/pkg/pgxconn"
 )
 
-const queryDeleteSeries = "SELECT _prom_catalog.delete_series_from_metric($1, $2)"
+const (
+	queryDeleteSeries = "SELECT _prom_catalog.delete_series_from_metric($1, $2)"
+	// queryDeleteSeriesInRange deletes the samples in a time range, only
+	// marking the series left without samples for deletion.
+	queryDeleteSeriesInRange = "SELECT _prom_catalog.delete_series_from_metric($1, $2, $3, $4)"
+	// The series marked by a range delete are told apart by looking up the
+	// series not marked yet before it, and those marked after it, in its
+	// transaction.
+	queryUnmarkedSeries = "SELECT COALESCE(array_agg(id), array[]::bigint[]) FROM _prom_catalog.series WHERE id = ANY($1) AND delete_epoch IS NULL"
+	queryMarkedSeries   = "SELECT COALESCE(array_agg(id), array[]::bigint[]) FROM _prom_catalog.series WHERE id = ANY($1) AND delete_epoch IS NOT NULL"
+)
+
+var deletedListeners struct {
+	sync.RWMutex
+	fs []func(mint, maxt int64)
+}
+
+// OnDeleted registers f to be called with the range of the timestamps, in
+// milliseconds, of the samples deleted by the connector, e.g. to invalidate
+// cached query results. Purges call it with the whole time range.
+func OnDeleted(f func(mint, maxt int64)) {
+	deletedListeners.Lock()
+	defer deletedListeners.Unlock()
+	deletedListeners.fs = append(deletedListeners.fs, f)
+}
+
+func notifyDeleted(mint, maxt int64) {
+	deletedListeners.RLock()
+	defer deletedListeners.RUnlock()
+	for _, f := range deletedListeners.fs {
+		f(mint, maxt)
+	}
+}
 
 // PgDelete deletes the series based on matchers.
 type PgDelete struct {
 	Conn pgxconn.PgxConn
 }
 
-// DeleteSeries deletes the series that matches the provided label_matchers.
-func (pgDel *PgDelete) DeleteSeries(matchers []*labels.Matcher, _, _ time.Time) ([]string, []model.SeriesID, int, error) {
+// DeleteSeries deletes the samples between start and end of the series that
+// match the provided label_matchers. The series are deleted along with all
+// their samples when the time range is unbounded, from model.MinTime to
+// model.MaxTime. The IDs returned are those of the series deleted or, with a
+// time range, of the series marked for deletion because no sample is left.
+func (pgDel *PgDelete) DeleteSeries(matchers []*labels.Matcher, start, end time.Time) ([]string, []model.SeriesID, int, error) {
 	var (
 		deletedSeriesIDs []model.SeriesID
 		totalRowsDeleted int
 		err              error
 		metricsTouched   = make(map[string]struct{})
+		inRange          = !start.Equal(model.MinTime) || !end.Equal(model.MaxTime)
 	)
 	metricNames, seriesIDMatrix, err := querier.GetMetricNameSeriesIDFromMatchers(pgDel.Conn, matchers)
 	if err != nil {
 		return nil, nil, -1, fmt.Errorf("delete-series: %w", err)
 	}
+	// Some metrics may have been deleted from even if a later one fails.
+	defer notifyDeleted(timestamp.FromTime(start), timestamp.FromTime(end))
 	for metricIndex, metricName := range metricNames {
 		seriesIDs := seriesIDMatrix[metricIndex]
-		var rowsDeleted int
-		if err = pgDel.Conn.QueryRow(
-			context.Background(),
-			queryDeleteSeries,
-			metricName,
-			convertSeriesIDsToInt64s(seriesIDs),
-		).Scan(&rowsDeleted); err != nil {
+		var (
+			rowsDeleted int
+			deleted     = seriesIDs
+		)
+		if inRange {
+			deleted, rowsDeleted, err = pgDel.deleteInRange(metricName, seriesIDs, start, end)
+		} else {
+			err = pgDel.Conn.QueryRow(context.Background(), queryDeleteSeries, metricName, convertSeriesIDsToInt64s(seriesIDs)).Scan(&rowsDeleted)
+		}
+		if err != nil {
 			return getKeys(metricsTouched), deletedSeriesIDs, totalRowsDeleted, fmt.Errorf("deleting series with metric_name=%s and series_ids=%v : %w", metricName, seriesIDs, err)
 		}
 		if _, ok := metricsTouched[metricName]; !ok {
 			metricsTouched[metricName] = struct{}{}
 		}
-		deletedSeriesIDs = append(deletedSeriesIDs, seriesIDs...)
+		deletedSeriesIDs = append(deletedSeriesIDs, deleted...)
 		totalRowsDeleted += rowsDeleted
 	}
 	return getKeys(metricsTouched), deletedSeriesIDs, totalRowsDeleted, nil
 }
 
+// deleteInRange deletes the samples of the series between start and end,
+// returning the series it marked for deletion.
+func (pgDel *PgDelete) deleteInRange(metricName string, seriesIDs []model.SeriesID, start, end time.Time) (marked []model.SeriesID, rowsDeleted int, err error) {
+	ctx := context.Background()
+	err = pgDel.Conn.WithConn(ctx, func(conn pgxconn.PgxConn) (err error) {
+		if _, err = conn.Exec(ctx, "BEGIN;"); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_, _ = conn.Exec(ctx, "ROLLBACK;")
+			}
+		}()
+		var unmarked, markedIDs []int64
+		if err = conn.QueryRow(ctx, queryUnmarkedSeries, convertSeriesIDsToInt64s(seriesIDs)).Scan(&unmarked); err != nil {
+			return err
+		}
+		err = conn.QueryRow(ctx, queryDeleteSeriesInRange, metricName, convertSeriesIDsToInt64s(seriesIDs),
+			timeBound(start, model.MinTime, pgtype.NegativeInfinity), timeBound(end, model.MaxTime, pgtype.Infinity)).Scan(&rowsDeleted)
+		if err != nil {
+			return err
+		}
+		if err = conn.QueryRow(ctx, queryMarkedSeries, unmarked).Scan(&markedIDs); err != nil {
+			return err
+		}
+		if _, err = conn.Exec(ctx, "COMMIT;"); err != nil {
+			return err
+		}
+		marked = make([]model.SeriesID, len(markedIDs))
+		for i, id := range markedIDs {
+			marked[i] = model.SeriesID(id)
+		}
+		return nil
+	})
+	return marked, rowsDeleted, err
+}
+
+// timeBound returns t as a timestamptz, which is infinite if t is the
+// unbounded value of the time range.
+func timeBound(t, unbounded time.Time, infinity pgtype.InfinityModifier) pgtype.Timestamptz {
+	if t.Equal(unbounded) {
+		return pgtype.Timestamptz{Status: pgtype.Present, InfinityModifier: infinity}
+	}
+	return pgtype.Timestamptz{Time: t, Status: pgtype.Present}
+}
+
 func convertSeriesIDsToInt64s(s []model.SeriesID) []int64 {
 	temp := make([]int64, len(s))
 	for i := range s {
@@ -0,0 +1,276 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package delete
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	purgeColumns    = "id, selectors, reason, requested_by, status, requested_at, started_at, finished_at, series_deleted, rows_deleted, COALESCE(error, '')"
+	requestPurgeSQL = "INSERT INTO " + schema.Catalog + ".label_purge (selectors, reason, requested_by) VALUES ($1, $2, $3) RETURNING " + purgeColumns
+	getPurgeSQL     = "SELECT " + purgeColumns + " FROM " + schema.Catalog + ".label_purge WHERE id = $1"
+	listPurgesSQL   = "SELECT " + purgeColumns + " FROM " + schema.Catalog + ".label_purge ORDER BY id DESC"
+	getPurgedSQL    = "SELECT metric_name, series_deleted, rows_deleted, purged_at FROM " + schema.Catalog + ".label_purge_metric " +
+		"WHERE purge_id = $1 ORDER BY metric_name"
+	// A running purge whose connector stopped updating its heartbeat is
+	// claimed again, and run from the start, which deletes nothing more from
+	// the metrics that were already purged.
+	claimPurgeSQL = "UPDATE " + schema.Catalog + ".label_purge SET status = 'running', started_at = COALESCE(started_at, now()), heartbeat_at = now() " +
+		"WHERE id = (SELECT id FROM " + schema.Catalog + ".label_purge " +
+		"WHERE status = 'pending' OR (status = 'running' AND heartbeat_at < now() - $1::float8 * INTERVAL '1 second') " +
+		"ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED) " +
+		"RETURNING id, selectors"
+	recordPurgedSQL = "INSERT INTO " + schema.Catalog + ".label_purge_metric (purge_id, metric_name, series_deleted, rows_deleted) " +
+		"VALUES ($1, $2, $3, $4) ON CONFLICT (purge_id, metric_name) DO UPDATE SET " +
+		"series_deleted = GREATEST(label_purge_metric.series_deleted, EXCLUDED.series_deleted), " +
+		"rows_deleted = label_purge_metric.rows_deleted + EXCLUDED.rows_deleted, purged_at = now()"
+	updatePurgeProgressSQL = "UPDATE " + schema.Catalog + ".label_purge p SET heartbeat_at = now(), " +
+		"series_deleted = m.series_deleted, rows_deleted = m.rows_deleted " +
+		"FROM (SELECT COALESCE(sum(series_deleted), 0)::bigint AS series_deleted, COALESCE(sum(rows_deleted), 0)::bigint AS rows_deleted " +
+		"FROM " + schema.Catalog + ".label_purge_metric WHERE purge_id = $1) m WHERE p.id = $1"
+	finishPurgeSQL = "UPDATE " + schema.Catalog + ".label_purge SET status = $2, finished_at = now(), error = NULLIF($3, '') WHERE id = $1"
+
+	// purgeCheckInterval is how often the connector looks for purges to run,
+	// such as the ones requested through other connectors.
+	purgeCheckInterval = time.Minute
+	// purgeStaleAfter is how long after its last progress a running purge is
+	// considered abandoned.
+	purgeStaleAfter = 10 * time.Minute
+)
+
+// ErrPurgeNotFound is returned when there is no purge with the requested id.
+var ErrPurgeNotFound = fmt.Errorf("purge not found")
+
+// Purge is a job deleting all the series matching label selectors, across
+// all the metrics.
+type Purge struct {
+	ID            int64
+	Selectors     []string
+	Reason        string
+	RequestedBy   string
+	Status        string
+	RequestedAt   time.Time
+	StartedAt     *time.Time
+	FinishedAt    *time.Time
+	SeriesDeleted int64
+	RowsDeleted   int64
+	Error         string
+	// Metrics are the metrics the series were deleted from. They are only
+	// set when getting a single purge.
+	Metrics []PurgedMetric
+}
+
+// PurgedMetric is what a purge deleted from a metric.
+type PurgedMetric struct {
+	Name          string
+	SeriesDeleted int64
+	RowsDeleted   int64
+	PurgedAt      time.Time
+}
+
+// Purger runs the purges in the background, one at a time. The purges are
+// stored in the database, so that any connector can run them.
+type Purger struct {
+	conn    pgxconn.PgxConn
+	trigger chan struct{}
+}
+
+// NewPurger returns a purger using the given connection.
+func NewPurger(conn pgxconn.PgxConn) *Purger {
+	return &Purger{
+		conn:    conn,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Start runs the requested purges in the background.
+func (p *Purger) Start() {
+	go func() {
+		ticker := time.NewTicker(purgeCheckInterval)
+		defer ticker.Stop()
+		for {
+			p.runPending()
+			select {
+			case <-ticker.C:
+			case <-p.trigger:
+			}
+		}
+	}()
+}
+
+// Request records a purge of the series matching any of the selectors and
+// wakes the purger up.
+func (p *Purger) Request(selectors []string, reason, requestedBy string) (Purge, error) {
+	if len(selectors) == 0 {
+		return Purge{}, fmt.Errorf("requesting purge: no selector provided")
+	}
+	for _, s := range selectors {
+		if _, err := parser.ParseMetricSelector(s); err != nil {
+			return Purge{}, fmt.Errorf("requesting purge: invalid selector %q: %w", s, err)
+		}
+	}
+	purge, err := scanPurge(p.conn.QueryRow(context.Background(), requestPurgeSQL, selectors, reason, requestedBy))
+	if err != nil {
+		return Purge{}, fmt.Errorf("requesting purge: %w", err)
+	}
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+	return purge, nil
+}
+
+// Get returns a purge along with the metrics it purged.
+func (p *Purger) Get(id int64) (Purge, error) {
+	purge, err := scanPurge(p.conn.QueryRow(context.Background(), getPurgeSQL, id))
+	if err == pgx.ErrNoRows {
+		return Purge{}, fmt.Errorf("purge %d: %w", id, ErrPurgeNotFound)
+	}
+	if err != nil {
+		return Purge{}, fmt.Errorf("getting purge %d: %w", id, err)
+	}
+
+	rows, err := p.conn.Query(context.Background(), getPurgedSQL, id)
+	if err != nil {
+		return Purge{}, fmt.Errorf("getting metrics of purge %d: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m PurgedMetric
+		if err = rows.Scan(&m.Name, &m.SeriesDeleted, &m.RowsDeleted, &m.PurgedAt); err != nil {
+			return Purge{}, fmt.Errorf("getting metrics of purge %d: %w", id, err)
+		}
+		purge.Metrics = append(purge.Metrics, m)
+	}
+	return purge, rows.Err()
+}
+
+// List returns all the purges, most recent first.
+func (p *Purger) List() ([]Purge, error) {
+	rows, err := p.conn.Query(context.Background(), listPurgesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("listing purges: %w", err)
+	}
+	defer rows.Close()
+	purges := make([]Purge, 0)
+	for rows.Next() {
+		purge, err := scanPurge(rows)
+		if err != nil {
+			return nil, fmt.Errorf("listing purges: %w", err)
+		}
+		purges = append(purges, purge)
+	}
+	return purges, rows.Err()
+}
+
+func scanPurge(row pgx.Row) (Purge, error) {
+	var purge Purge
+	err := row.Scan(&purge.ID, &purge.Selectors, &purge.Reason, &purge.RequestedBy, &purge.Status, &purge.RequestedAt,
+		&purge.StartedAt, &purge.FinishedAt, &purge.SeriesDeleted, &purge.RowsDeleted, &purge.Error)
+	return purge, err
+}
+
+// runPending runs the purges that are pending or abandoned, one at a time.
+func (p *Purger) runPending() {
+	for {
+		var (
+			id        int64
+			selectors []string
+		)
+		err := p.conn.QueryRow(context.Background(), claimPurgeSQL, purgeStaleAfter.Seconds()).Scan(&id, &selectors)
+		if err == pgx.ErrNoRows {
+			return
+		}
+		if err != nil {
+			log.Error("msg", "error claiming purge", "err", err)
+			return
+		}
+
+		log.Info("msg", "purging series", "purge-id", id, "selectors", fmt.Sprintf("%v", selectors))
+		status, errMsg := "completed", ""
+		err = p.run(id, selectors)
+		// The purged series may be of any time, and a failed purge may have
+		// deleted some of them.
+		notifyDeleted(math.MinInt64, math.MaxInt64)
+		if err != nil {
+			log.Error("msg", "error purging series", "purge-id", id, "err", err)
+			status, errMsg = "failed", err.Error()
+		}
+		if _, err = p.conn.Exec(context.Background(), finishPurgeSQL, id, status, errMsg); err != nil {
+			log.Error("msg", "error recording the end of purge", "purge-id", id, "err", err)
+		}
+	}
+}
+
+// run deletes the series matching the selectors metric by metric, recording
+// what was deleted from each metric.
+func (p *Purger) run(id int64, selectors []string) error {
+	series, err := p.matchingSeries(selectors)
+	if err != nil {
+		return err
+	}
+	metricNames := make([]string, 0, len(series))
+	for name := range series {
+		metricNames = append(metricNames, name)
+	}
+	sort.Strings(metricNames)
+
+	for _, name := range metricNames {
+		seriesIDs := make([]int64, 0, len(series[name]))
+		for seriesID := range series[name] {
+			seriesIDs = append(seriesIDs, int64(seriesID))
+		}
+		var rowsDeleted int64
+		if err = p.conn.QueryRow(context.Background(), queryDeleteSeries, name, seriesIDs).Scan(&rowsDeleted); err != nil {
+			return fmt.Errorf("deleting series of metric %s: %w", name, err)
+		}
+		if _, err = p.conn.Exec(context.Background(), recordPurgedSQL, id, name, len(seriesIDs), rowsDeleted); err != nil {
+			return fmt.Errorf("recording purge of metric %s: %w", name, err)
+		}
+		if _, err = p.conn.Exec(context.Background(), updatePurgeProgressSQL, id); err != nil {
+			return fmt.Errorf("recording progress: %w", err)
+		}
+	}
+	log.Info("msg", "series purged", "purge-id", id, "metrics", len(metricNames))
+	return nil
+}
+
+// matchingSeries returns the ids of the series matching any of the selectors,
+// by metric name.
+func (p *Purger) matchingSeries(selectors []string) (map[string]map[model.SeriesID]struct{}, error) {
+	series := make(map[string]map[model.SeriesID]struct{})
+	for _, s := range selectors {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		metricNames, seriesIDs, err := querier.GetMetricNameSeriesIDFromMatchers(p.conn, matchers)
+		if err != nil {
+			return nil, fmt.Errorf("matching series of %q: %w", s, err)
+		}
+		for i, name := range metricNames {
+			if series[name] == nil {
+				series[name] = make(map[model.SeriesID]struct{})
+			}
+			for _, seriesID := range seriesIDs[i] {
+				series[name][seriesID] = struct{}{}
+			}
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,158 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package demo provisions a small synthetic dataset in an empty database, so
+// that the query APIs can be tried without a Prometheus sending samples.
+package demo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+const (
+	metricCountSQL = "SELECT count(*) FROM " + schema.Catalog + ".metric"
+
+	// Job is the job label of the series of the dataset.
+	Job = "demo"
+	// History is how far back the samples of the dataset go.
+	History = 6 * time.Hour
+	// Interval is the interval between the samples of a series.
+	Interval = time.Minute
+
+	instances = 3
+)
+
+// ExampleQueries are PromQL queries over the dataset, like those of the
+// panels of a dashboard.
+var ExampleQueries = []string{
+	`up{job="demo"}`,
+	`sum by (instance) (rate(demo_cpu_seconds_total{mode!="idle"}[5m]))`,
+	`avg_over_time(demo_memory_usage_bytes[15m])`,
+	`sum by (code) (rate(demo_http_requests_total[5m]))`,
+	`histogram_quantile(0.9, sum by (le) (rate(demo_http_request_duration_seconds_bucket[5m])))`,
+}
+
+var (
+	cpuModes     = []string{"user", "system", "idle"}
+	httpCodes    = []string{"200", "500"}
+	bucketBounds = []float64{0.05, 0.1, 0.25, 0.5, 1, math.Inf(1)}
+	// cpuShares are the shares of the user and system modes at full load,
+	// the rest being idle.
+	cpuShares     = []float64{0.3, 0.1}
+	requestShares = []float64{0.98, 0.02}
+)
+
+// Provision ingests the dataset with the inserter, its samples ending at
+// now, if the database has no metric yet. It returns whether the dataset
+// was provisioned.
+func Provision(conn pgxconn.PgxConn, inserter ingestor.DBInserter, now time.Time) (bool, error) {
+	var metrics int64
+	if err := conn.QueryRow(context.Background(), metricCountSQL).Scan(&metrics); err != nil {
+		return false, fmt.Errorf("count metrics: %w", err)
+	}
+	if metrics > 0 {
+		return false, nil
+	}
+
+	req := ingestor.NewWriteRequest()
+	req.Timeseries = Generate(now, rand.New(rand.NewSource(1)))
+	if _, _, err := inserter.Ingest(req); err != nil {
+		return false, fmt.Errorf("ingest demo dataset: %w", err)
+	}
+	return true, nil
+}
+
+// Generate returns the series of the dataset, with a sample every Interval
+// over the History before now. The noise of the samples is drawn from rnd.
+func Generate(now time.Time, rnd *rand.Rand) []prompb.TimeSeries {
+	end := now.Truncate(Interval)
+	start := end.Add(-History)
+	var ts []prompb.TimeSeries
+	for i := 0; i < instances; i++ {
+		instance := "demo-" + strconv.Itoa(i) + ":9100"
+		series := func(name string, extra ...string) {
+			lset := labels.FromStrings(append([]string{labels.MetricName, name, "job", Job, "instance", instance}, extra...)...)
+			s := prompb.TimeSeries{Labels: make([]prompb.Label, 0, len(lset))}
+			for _, l := range lset {
+				s.Labels = append(s.Labels, prompb.Label{Name: l.Name, Value: l.Value})
+			}
+			ts = append(ts, s)
+		}
+
+		up := len(ts)
+		series("up")
+		cpu := len(ts)
+		for _, mode := range cpuModes {
+			series("demo_cpu_seconds_total", "mode", mode)
+		}
+		memory := len(ts)
+		series("demo_memory_usage_bytes")
+		requests := len(ts)
+		for _, code := range httpCodes {
+			series("demo_http_requests_total", "code", code)
+		}
+		buckets := len(ts)
+		for _, le := range bucketBounds {
+			series("demo_http_request_duration_seconds_bucket", "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		sum := len(ts)
+		series("demo_http_request_duration_seconds_sum")
+		count := len(ts)
+		series("demo_http_request_duration_seconds_count")
+
+		var (
+			cpuTotals     = make([]float64, len(cpuModes))
+			requestTotals = make([]float64, len(httpCodes))
+			bucketTotals  = make([]float64, len(bucketBounds))
+			durationSum   float64
+		)
+		for t := start; !t.After(end); t = t.Add(Interval) {
+			ms := timestamp.FromTime(t)
+			// The load follows a daily cycle, with noise.
+			load := 0.5 + 0.4*math.Sin(2*math.Pi*float64(t.Unix()%86400)/86400+float64(i)) + 0.1*rnd.Float64()
+			sample := func(idx int, v float64) {
+				ts[idx].Samples = append(ts[idx].Samples, prompb.Sample{Timestamp: ms, Value: v})
+			}
+
+			sample(up, 1)
+			for m := range cpuModes {
+				share := 1 - load*(cpuShares[0]+cpuShares[1])
+				if m < len(cpuShares) {
+					share = cpuShares[m] * load
+				}
+				cpuTotals[m] += share * Interval.Seconds()
+				sample(cpu+m, cpuTotals[m])
+			}
+			sample(memory, (1+load)*512*1024*1024)
+
+			n := math.Round(load * 100 * Interval.Seconds())
+			for c := range httpCodes {
+				requestTotals[c] += math.Round(n * requestShares[c])
+				sample(requests+c, requestTotals[c])
+			}
+			// The durations are exponentially distributed, slower under load.
+			mean := 0.05 + 0.2*load
+			for b, le := range bucketBounds {
+				bucketTotals[b] += math.Round(n * (1 - math.Exp(-le/mean)))
+				sample(buckets+b, bucketTotals[b])
+			}
+			durationSum += n * mean
+			sample(sum, durationSum)
+			sample(count, bucketTotals[len(bucketTotals)-1])
+		}
+	}
+	return ts
+}
@@ -0,0 +1,77 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package demo
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+type fakeInserter struct {
+	reqs []prompb.WriteRequest
+}
+
+func (f *fakeInserter) Ingest(r *prompb.WriteRequest) (uint64, uint64, error) {
+	f.reqs = append(f.reqs, *r)
+	return uint64(len(r.Timeseries)), 0, nil
+}
+
+func TestProvision(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: metricCountSQL, Results: model.RowResults{{int64(0)}}},
+		{Sql: metricCountSQL, Results: model.RowResults{{int64(5)}}},
+	}, t)
+	inserter := &fakeInserter{}
+
+	provisioned, err := Provision(mock, inserter, time.Unix(100000, 0))
+	require.NoError(t, err)
+	require.True(t, provisioned)
+	require.Len(t, inserter.reqs, 1)
+	require.Len(t, inserter.reqs[0].Timeseries, instances*15)
+
+	// The dataset is only provisioned in an empty database.
+	provisioned, err = Provision(mock, inserter, time.Unix(100000, 0))
+	require.NoError(t, err)
+	require.False(t, provisioned)
+	require.Len(t, inserter.reqs, 1)
+}
+
+func TestGenerate(t *testing.T) {
+	now := time.Unix(100030, 0)
+	ts := Generate(now, rand.New(rand.NewSource(1)))
+
+	samples := int(History/Interval) + 1
+	var buckets []prompb.TimeSeries
+	for _, s := range ts {
+		require.Len(t, s.Samples, samples)
+		require.Equal(t, int64(100020000), s.Samples[samples-1].Timestamp, "samples must end at now truncated to the interval")
+		name := s.Labels[0].Value
+		if name == "demo_memory_usage_bytes" || name == "up" {
+			continue
+		}
+		for i := 1; i < samples; i++ {
+			require.GreaterOrEqual(t, s.Samples[i].Value, s.Samples[i-1].Value, "counters must not decrease: %v", s.Labels)
+		}
+		if name == "demo_http_request_duration_seconds_bucket" {
+			buckets = append(buckets, s)
+		}
+	}
+
+	// The buckets of each instance are cumulative.
+	require.Len(t, buckets, instances*len(bucketBounds))
+	for b := 1; b < len(buckets); b++ {
+		if b%len(bucketBounds) == 0 {
+			continue
+		}
+		for i := range buckets[b].Samples {
+			require.GreaterOrEqual(t, buckets[b].Samples[i].Value, buckets[b-1].Samples[i].Value)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package exemplar stores the exemplars of the ingested series, and queries
+// them by label matchers and time range.
+package exemplar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/exemplar"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+const (
+	// insertSQL is queued in the batch inserting the samples of the series,
+	// so that the exemplars are committed along with them.
+	insertSQL = `INSERT INTO ` + schema.Catalog + `.exemplar (metric_name, series_id, time, value, labels)
+SELECT * FROM unnest($1::TEXT[], $2::BIGINT[], $3::TIMESTAMPTZ[], $4::DOUBLE PRECISION[], $5::JSONB[])
+ON CONFLICT DO NOTHING`
+
+	selectSQL = `SELECT e.series_id, kv.keys, kv.vals, e.time, e.value, e.labels::TEXT
+FROM ` + schema.Catalog + `.exemplar e
+INNER JOIN ` + schema.Catalog + `.series s ON (s.id = e.series_id)
+CROSS JOIN LATERAL ` + schema.Prom + `.key_value_array(s.labels) kv
+WHERE e.series_id = ANY($1) AND e.time >= $2 AND e.time <= $3
+ORDER BY e.series_id, e.time`
+)
+
+// Rows holds the exemplars of the series of an insert batch.
+type Rows struct {
+	metrics   []string
+	seriesIDs []int64
+	times     []time.Time
+	values    []float64
+	labels    []string
+}
+
+// Append adds the exemplars of the series, whose id must be set.
+func (r *Rows) Append(series *model.Series, exemplars []prompb.Exemplar) error {
+	id, _, err := series.GetSeriesID()
+	if err != nil {
+		return fmt.Errorf("insert exemplars: %w", err)
+	}
+	for _, e := range exemplars {
+		exemplarJSON, err := labelsJSON(e.Labels)
+		if err != nil {
+			return fmt.Errorf("insert exemplars: %w", err)
+		}
+		r.metrics = append(r.metrics, series.MetricName())
+		r.seriesIDs = append(r.seriesIDs, int64(id))
+		r.times = append(r.times, timestamp.Time(e.Timestamp))
+		r.values = append(r.values, e.Value)
+		r.labels = append(r.labels, exemplarJSON)
+	}
+	return nil
+}
+
+// Len returns the number of exemplars.
+func (r *Rows) Len() int {
+	return len(r.metrics)
+}
+
+// Queue queues the insert of the exemplars in the batch. Exemplars already
+// stored for a series at the same time are ignored.
+func (r *Rows) Queue(batch pgxconn.PgxBatch) {
+	batch.Queue(insertSQL, r.metrics, r.seriesIDs, r.times, r.values, r.labels)
+}
+
+func labelsJSON(lbls []prompb.Label) (string, error) {
+	m := make(map[string]string, len(lbls))
+	for _, l := range lbls {
+		m[l.Name] = l.Value
+	}
+	bs, err := json.Marshal(m)
+	return string(bs), err
+}
+
+// Queryable returns the queriers of the stored exemplars, implementing the
+// Prometheus storage.ExemplarQueryable interface.
+type Queryable struct {
+	conn pgxconn.PgxConn
+}
+
+var _ storage.ExemplarQueryable = (*Queryable)(nil)
+
+// NewQueryable returns a queryable of the exemplars stored in the database.
+func NewQueryable(conn pgxconn.PgxConn) *Queryable {
+	return &Queryable{conn: conn}
+}
+
+func (q *Queryable) ExemplarQuerier(ctx context.Context) (storage.ExemplarQuerier, error) {
+	return NewQuerier(ctx, q.conn), nil
+}
+
+// Querier queries the stored exemplars, implementing the Prometheus
+// storage.ExemplarQuerier interface.
+type Querier struct {
+	conn pgxconn.PgxConn
+	ctx  context.Context
+}
+
+var _ storage.ExemplarQuerier = (*Querier)(nil)
+
+// NewQuerier returns a querier of the exemplars stored in the database.
+func NewQuerier(ctx context.Context, conn pgxconn.PgxConn) *Querier {
+	return &Querier{conn: conn, ctx: ctx}
+}
+
+// Select returns the exemplars between start and end, in milliseconds, of
+// the series matching any of the matcher sets, sorted by series labels.
+func (q *Querier) Select(start, end int64, matcherSets ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	seen := make(map[int64]struct{})
+	var seriesIDs []int64
+	for _, matchers := range matcherSets {
+		_, idsPerMetric, err := querier.GetMetricNameSeriesIDFromMatchers(q.conn, matchers)
+		if err != nil {
+			return nil, err
+		}
+		for _, ids := range idsPerMetric {
+			for _, id := range ids {
+				if _, ok := seen[int64(id)]; !ok {
+					seen[int64(id)] = struct{}{}
+					seriesIDs = append(seriesIDs, int64(id))
+				}
+			}
+		}
+	}
+	if len(seriesIDs) == 0 {
+		return []exemplar.QueryResult{}, nil
+	}
+
+	rows, err := q.conn.Query(q.ctx, selectSQL, seriesIDs, timestamp.Time(start), timestamp.Time(end))
+	if err != nil {
+		return nil, fmt.Errorf("select exemplars: %w", err)
+	}
+	defer rows.Close()
+
+	results := []exemplar.QueryResult{}
+	lastID := int64(-1)
+	for rows.Next() {
+		var (
+			id          int64
+			keys, vals  []string
+			t           time.Time
+			value       float64
+			exemplarLbl string
+		)
+		if err = rows.Scan(&id, &keys, &vals, &t, &value, &exemplarLbl); err != nil {
+			return nil, fmt.Errorf("select exemplars: %w", err)
+		}
+		var lbls map[string]string
+		if err = json.Unmarshal([]byte(exemplarLbl), &lbls); err != nil {
+			return nil, fmt.Errorf("select exemplars: %w", err)
+		}
+		if id != lastID {
+			results = append(results, exemplar.QueryResult{SeriesLabels: labels.New(toLabels(keys, vals)...)})
+			lastID = id
+		}
+		res := &results[len(results)-1]
+		res.Exemplars = append(res.Exemplars, exemplar.Exemplar{
+			Labels: labels.FromMap(lbls),
+			Value:  value,
+			Ts:     timestamp.FromTime(t),
+			HasTs:  true,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("select exemplars: %w", err)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return labels.Compare(results[i].SeriesLabels, results[j].SeriesLabels) < 0
+	})
+	return results, nil
+}
+
+func toLabels(keys, vals []string) []labels.Label {
+	lbls := make([]labels.Label, len(keys))
+	for i := range keys {
+		lbls[i] = labels.Label{Name: keys[i], Value: vals[i]}
+	}
+	return lbls
+}
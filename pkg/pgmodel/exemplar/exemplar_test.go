@@ -0,0 +1,104 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package exemplar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/exemplar"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestRows(t *testing.T) {
+	cpu := model.NewSeries("cpu", []prompb.Label{{Name: "__name__", Value: "cpu"}, {Name: "job", Value: "api"}})
+	cpu.SetSeriesID(4, 1)
+	mem := model.NewSeries("mem", []prompb.Label{{Name: "__name__", Value: "mem"}, {Name: "job", Value: "api"}})
+	mem.SetSeriesID(5, 1)
+	withoutID := model.NewSeries("disk", []prompb.Label{{Name: "__name__", Value: "disk"}})
+
+	var rows Rows
+	require.NoError(t, rows.Append(cpu, []prompb.Exemplar{
+		{Labels: []prompb.Label{{Name: "trace_id", Value: "a"}}, Value: 0.5, Timestamp: 1},
+		{Value: 0.7, Timestamp: 2},
+	}))
+	require.NoError(t, rows.Append(mem, nil))
+	require.NoError(t, rows.Append(mem, []prompb.Exemplar{
+		{Labels: []prompb.Label{{Name: "trace_id", Value: "c"}}, Value: 10, Timestamp: 3},
+	}))
+	require.Error(t, rows.Append(withoutID, []prompb.Exemplar{{Value: 1, Timestamp: 4}}))
+	require.Equal(t, 3, rows.Len())
+
+	batch := &model.MockBatch{}
+	rows.Queue(batch)
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql: insertSQL,
+			Args: []interface{}{
+				[]string{"cpu", "cpu", "mem"},
+				[]int64{4, 4, 5},
+				[]time.Time{timestamp.Time(1), timestamp.Time(2), timestamp.Time(3)},
+				[]float64{0.5, 0.7, 10},
+				[]string{`{"trace_id":"a"}`, `{}`, `{"trace_id":"c"}`},
+			},
+		},
+	}, t)
+	results, err := mock.SendBatch(context.Background(), batch)
+	require.NoError(t, err)
+	_, err = results.Exec()
+	require.NoError(t, err)
+}
+
+func TestSelect(t *testing.T) {
+	seriesSQL := func(matchers ...*labels.Matcher) (string, []interface{}) {
+		cb, err := querier.BuildSubQueries(matchers)
+		require.NoError(t, err)
+		clauses, values, err := cb.Build(true)
+		require.NoError(t, err)
+		return querier.BuildMetricNameSeriesIDQuery(clauses), values
+	}
+	cpu := labels.MustNewMatcher(labels.MatchEqual, "__name__", "cpu")
+	mem := labels.MustNewMatcher(labels.MatchEqual, "__name__", "mem")
+	cpuSQL, cpuArgs := seriesSQL(cpu)
+	memSQL, memArgs := seriesSQL(mem)
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: cpuSQL, Args: cpuArgs, Results: model.RowResults{{"prom_data", "cpu", []int64{5, 4}}}},
+		{Sql: memSQL, Args: memArgs, Results: model.RowResults{{"prom_data", "mem", []int64{4}}}},
+		{
+			Sql:  selectSQL,
+			Args: []interface{}{[]int64{5, 4}, timestamp.Time(0), timestamp.Time(10)},
+			Results: model.RowResults{
+				{int64(4), []string{"__name__", "job"}, []string{"cpu", "db"}, timestamp.Time(1), 0.5, `{"trace_id":"a"}`},
+				{int64(4), []string{"__name__", "job"}, []string{"cpu", "db"}, timestamp.Time(2), 0.7, `{}`},
+				{int64(5), []string{"__name__", "job"}, []string{"cpu", "api"}, timestamp.Time(3), 10.0, `{"trace_id":"c"}`},
+			},
+		},
+	}, t)
+
+	res, err := NewQueryable(mock).ExemplarQuerier(context.Background())
+	require.NoError(t, err)
+	results, err := res.Select(0, 10, []*labels.Matcher{cpu}, []*labels.Matcher{mem})
+	require.NoError(t, err)
+	require.Equal(t, []exemplar.QueryResult{
+		{
+			SeriesLabels: labels.FromStrings("__name__", "cpu", "job", "api"),
+			Exemplars:    []exemplar.Exemplar{{Labels: labels.FromStrings("trace_id", "c"), Value: 10, Ts: 3, HasTs: true}},
+		},
+		{
+			SeriesLabels: labels.FromStrings("__name__", "cpu", "job", "db"),
+			Exemplars: []exemplar.Exemplar{
+				{Labels: labels.FromStrings("trace_id", "a"), Value: 0.5, Ts: 1, HasTs: true},
+				{Labels: labels.Labels{}, Value: 0.7, Ts: 2, HasTs: true},
+			},
+		},
+	}, results)
+}
@@ -0,0 +1,240 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package forecast extrapolates the series of a selector past the end of
+// their stored samples, with a linear regression or Holt's double
+// exponential smoothing computed in SQL, for capacity planning.
+package forecast
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// Method is the model the series are forecast with.
+type Method string
+
+const (
+	// Linear fits a line to the samples by least squares.
+	Linear Method = "linear"
+	// HoltWinters smooths the level and the trend of the samples averaged
+	// by step, as the holt_winters PromQL function does.
+	HoltWinters Method = "holt_winters"
+)
+
+const (
+	metricTableSQL = "SELECT " + schema.Catalog + ".get_metric_read_schema(table_schema, table_name), table_name, series_table FROM " + schema.Catalog + ".get_metric_table_name_if_exists($1, $2)"
+
+	// forecastSQL returns the forecast of each series matching the clauses
+	// whose fit has a value a at the end of the history, a slope b per
+	// second, and a spread of the residuals. The points are at every step
+	// after the end up to the horizon.
+	forecastSQL = `SELECT l.keys, l.vals, f.times, f.means, f.deltas
+FROM %[1]s s
+INNER JOIN LATERAL (%[2]s) fit ON (fit.sigma IS NOT NULL)
+INNER JOIN LATERAL (
+	SELECT
+		array_agg(t ORDER BY t) AS times,
+		array_agg(fit.a + fit.b * extract(epoch FROM t - %[4]s) ORDER BY t) AS means,
+		array_agg(%[3]s ORDER BY t) AS deltas
+	FROM generate_series(%[4]s + %[5]s, %[4]s + %[6]s, %[5]s) t
+) f ON (true)
+CROSS JOIN LATERAL ` + schema.Prom + `.key_value_array(s.labels) l
+WHERE %[7]s`
+
+	// validValue excludes the staleness markers, NaNs and infinities from
+	// the fits.
+	validValue = "value <> 'NaN' AND abs(value) <> 'Infinity'"
+
+	// linearFitSQL regresses the samples on their time in seconds from the
+	// end of the history.
+	linearFitSQL = `SELECT
+	regr_intercept(value, x) AS a,
+	regr_slope(value, x) AS b,
+	regr_count(value, x) AS n,
+	regr_avgx(value, x) AS avgx,
+	regr_sxx(value, x) AS sxx,
+	sqrt(greatest(regr_syy(value, x) - regr_sxy(value, x) ^ 2 / nullif(regr_sxx(value, x), 0), 0) / nullif(regr_count(value, x) - 2, 0)) AS sigma
+FROM (
+	SELECT extract(epoch FROM time - %[2]s)::DOUBLE PRECISION AS x, %[4]s AS value
+	FROM %[1]s
+	WHERE series_id = s.id AND time >= %[3]s AND time <= %[2]s AND ` + validValue + `
+) samples`
+	// linearDeltaSQL is the half width of the prediction interval of a
+	// linear regression at t, for the z-score of the confidence.
+	linearDeltaSQL = "%[1]g * fit.sigma * sqrt(1 + 1.0 / fit.n + (extract(epoch FROM t - %[2]s) - fit.avgx) ^ 2 / nullif(fit.sxx, 0))"
+
+	// holtWintersFitSQL smooths the averages of the samples of each step,
+	// starting from the second one with the difference of the first two as
+	// the trend, and sums the squares of the errors of the one step ahead
+	// forecasts.
+	holtWintersFitSQL = `WITH RECURSIVE buckets AS (
+	SELECT array_agg(value ORDER BY bucket) AS v
+	FROM (
+		SELECT floor(extract(epoch FROM time - %[3]s) / %[5]g) AS bucket, avg(%[4]s) AS value
+		FROM %[1]s
+		WHERE series_id = s.id AND time >= %[3]s AND time <= %[2]s AND ` + validValue + `
+		GROUP BY bucket
+	) b
+), smoothed(i, level, trend, sse) AS (
+	SELECT 2, v[2], v[2] - v[1], 0::DOUBLE PRECISION FROM buckets WHERE cardinality(v) >= 3
+	UNION ALL
+	SELECT i + 1,
+		%[6]g * v[i + 1] + (1 - %[6]g) * (level + trend),
+		%[7]g * (%[6]g * v[i + 1] + (1 - %[6]g) * (level + trend) - level) + (1 - %[7]g) * trend,
+		sse + (v[i + 1] - level - trend) ^ 2
+	FROM smoothed, buckets
+	WHERE i < cardinality(v)
+)
+SELECT level AS a, trend / %[5]g AS b, sqrt(sse / (i - 2)) AS sigma
+FROM smoothed, buckets
+WHERE i = cardinality(v)`
+	// holtWintersDeltaSQL widens the band with the square root of the
+	// number of steps ahead, as for a random walk of the errors.
+	holtWintersDeltaSQL = "%[1]g * fit.sigma * sqrt(extract(epoch FROM t - %[2]s) / %[3]g)"
+)
+
+// ErrNoMetricName is returned when the selector of a forecast does not match
+// a single metric name.
+var ErrNoMetricName = fmt.Errorf("the selector must match a single metric name")
+
+// Request is a forecast of the series matching the matchers from their
+// samples between Start and End, at every Step after End up to Horizon.
+type Request struct {
+	Matchers   []*labels.Matcher
+	Start, End time.Time
+	Step       time.Duration
+	Horizon    time.Duration
+	Method     Method
+	// Confidence is the probability of the samples to be within the band
+	// of the forecast, e.g. 0.95.
+	Confidence float64
+	// SmoothingFactor and TrendFactor are the factors of HoltWinters,
+	// between 0 and 1.
+	SmoothingFactor, TrendFactor float64
+}
+
+// Series is the forecast of a series.
+type Series struct {
+	Labels labels.Labels
+	// Times are the timestamps of the points of the forecast in
+	// milliseconds, and Means, Lowers and Uppers their expected values and
+	// the bounds of their band.
+	Times                 []int64
+	Means, Lowers, Uppers []float64
+}
+
+// ParseMethod parses the name of a forecast method.
+func ParseMethod(s string) (Method, error) {
+	switch m := Method(s); m {
+	case Linear, HoltWinters:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown forecast method %q, must be %q or %q", s, Linear, HoltWinters)
+}
+
+// Query returns the forecasts of the series of the request. The series
+// must be of a single metric.
+func Query(conn pgxconn.PgxConn, req Request) ([]Series, error) {
+	builder, err := querier.BuildSubQueries(req.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	metric := builder.GetMetricName()
+	if metric == "" {
+		return nil, ErrNoMetricName
+	}
+	clauses, values, err := builder.Build(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tableSchema, table, seriesTable string
+	err = conn.QueryRow(context.Background(), metricTableSQL, builder.GetSchemaName(), metric).Scan(&tableSchema, &table, &seriesTable)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrMissingTableName
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get metric table: %w", err)
+	}
+
+	rows, err := conn.Query(context.Background(), buildQuery(req, pgx.Identifier{tableSchema, table}.Sanitize(),
+		pgx.Identifier{schema.DataSeries, seriesTable}.Sanitize(), builder.GetColumnName(), clauses), values...)
+	if err != nil {
+		return nil, fmt.Errorf("forecast: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]Series, 0)
+	for rows.Next() {
+		var (
+			keys, vals    []string
+			times         []time.Time
+			means, deltas []float64
+		)
+		if err = rows.Scan(&keys, &vals, &times, &means, &deltas); err != nil {
+			return nil, fmt.Errorf("forecast result: %w", err)
+		}
+		s := Series{
+			Labels: make(labels.Labels, 0, len(keys)),
+			Times:  make([]int64, len(times)),
+			Means:  means,
+			Lowers: make([]float64, len(means)),
+			Uppers: make([]float64, len(means)),
+		}
+		for i := range keys {
+			s.Labels = append(s.Labels, labels.Label{Name: keys[i], Value: vals[i]})
+		}
+		for i := range times {
+			s.Times[i] = timestamp.FromTime(times[i])
+			s.Lowers[i], s.Uppers[i] = means[i]-deltas[i], means[i]+deltas[i]
+		}
+		result = append(result, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("forecast result: %w", err)
+	}
+	return result, nil
+}
+
+func buildQuery(req Request, table, seriesTable, column string, clauses []string) string {
+	var (
+		start = timeLiteral(req.Start)
+		end   = timeLiteral(req.End)
+		z     = math.Sqrt2 * math.Erfinv(req.Confidence)
+		step  = req.Step.Seconds()
+		col   = pgx.Identifier{column}.Sanitize()
+		fit   string
+		delta string
+	)
+	switch req.Method {
+	case HoltWinters:
+		fit = fmt.Sprintf(holtWintersFitSQL, table, end, start, col, step, req.SmoothingFactor, req.TrendFactor)
+		delta = fmt.Sprintf(holtWintersDeltaSQL, z, end, step)
+	default:
+		fit = fmt.Sprintf(linearFitSQL, table, end, start, col)
+		delta = fmt.Sprintf(linearDeltaSQL, z, end)
+	}
+	return fmt.Sprintf(forecastSQL, seriesTable, fit, delta, end,
+		intervalLiteral(req.Step), intervalLiteral(req.Horizon), strings.Join(clauses, " AND "))
+}
+
+func timeLiteral(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339Nano) + "'::TIMESTAMPTZ"
+}
+
+func intervalLiteral(d time.Duration) string {
+	return fmt.Sprintf("'%d milliseconds'::INTERVAL", d.Milliseconds())
+}
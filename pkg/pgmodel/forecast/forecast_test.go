@@ -0,0 +1,81 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+)
+
+func TestParseMethod(t *testing.T) {
+	m, err := ParseMethod("holt_winters")
+	require.NoError(t, err)
+	require.Equal(t, HoltWinters, m)
+
+	_, err = ParseMethod("arima")
+	require.Error(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	req := Request{
+		Matchers: []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "cpu"),
+			labels.MustNewMatcher(labels.MatchEqual, "job", "node"),
+		},
+		Start:      time.Unix(0, 0),
+		End:        time.Unix(3600, 0),
+		Step:       time.Minute,
+		Horizon:    2 * time.Minute,
+		Method:     Linear,
+		Confidence: 0.95,
+	}
+	builder, err := querier.BuildSubQueries(req.Matchers)
+	require.NoError(t, err)
+	clauses, values, err := builder.Build(false)
+	require.NoError(t, err)
+
+	query := buildQuery(req, `"prom_data"."cpu"`, `"prom_data_series"."cpu"`, "value", clauses)
+	require.Contains(t, query, "regr_slope(value, x)")
+	require.Contains(t, query, "1.959963984540")
+	require.Contains(t, query, "generate_series('1970-01-01T01:00:00Z'::TIMESTAMPTZ + '60000 milliseconds'::INTERVAL")
+	require.NotContains(t, query, "%!")
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: metricTableSQL, Args: []interface{}{"", "cpu"}, Results: model.RowResults{{"prom_data", "cpu", "cpu"}}},
+		{
+			Sql:  query,
+			Args: values,
+			Results: model.RowResults{{
+				[]string{"__name__", "job"}, []string{"cpu", "node"},
+				[]time.Time{time.Unix(3660, 0), time.Unix(3720, 0)},
+				[]float64{1, 2}, []float64{0.5, 1},
+			}},
+		},
+	}, t)
+
+	res, err := Query(mock, req)
+	require.NoError(t, err)
+	require.Equal(t, []Series{{
+		Labels: labels.FromStrings("__name__", "cpu", "job", "node"),
+		Times:  []int64{3660000, 3720000},
+		Means:  []float64{1, 2},
+		Lowers: []float64{0.5, 1},
+		Uppers: []float64{1.5, 3},
+	}}, res)
+
+	req.Method = HoltWinters
+	req.SmoothingFactor, req.TrendFactor = 0.5, 0.1
+	query = buildQuery(req, `"prom_data"."cpu"`, `"prom_data_series"."cpu"`, "value", clauses)
+	require.Contains(t, query, "WITH RECURSIVE")
+	require.NotContains(t, query, "%!")
+
+	_, err = Query(mock, Request{Matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "node")}})
+	require.Equal(t, ErrNoMetricName, err)
+}
@@ -37,6 +37,9 @@ func (idt *insertDataTask) reportResult(err error) {
 type pendingBuffer struct {
 	needsResponse []insertDataTask
 	batch         model.SamplesBatch
+	// syncCommits is the number of requests of the batch whose samples must
+	// be committed synchronously.
+	syncCommits int
 }
 
 var pendingBuffers = sync.Pool{
@@ -75,15 +78,20 @@ func (p *pendingBuffer) release() {
 	}
 	p.needsResponse = p.needsResponse[:0]
 	p.batch.Reset()
+	p.syncCommits = 0
 	pendingBuffers.Put(p)
 }
 
 func (p *pendingBuffer) addReq(req *insertDataRequest) {
 	p.needsResponse = append(p.needsResponse, insertDataTask{finished: req.finished, errChan: req.errChan})
 	p.batch.AppendSlice(req.data)
+	if !req.asyncCommit {
+		p.syncCommits++
+	}
 }
 
 func (p *pendingBuffer) absorb(other *pendingBuffer) {
 	p.needsResponse = append(p.needsResponse, other.needsResponse...)
 	p.batch.Absorb(other.batch)
+	p.syncCommits += other.syncCommits
 }
@@ -0,0 +1,106 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/timescale/promscale/pkg/pgmodel/catalog"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+// writeSeriesWithCatalog sets the ids of the series from the catalog service.
+func (h *seriesWriter) writeSeriesWithCatalog(infos map[string]*perMetricInfo) error {
+	var (
+		series   []*model.Series
+		requests []catalog.SeriesLabels
+	)
+	for metricName, info := range infos {
+		for _, s := range info.series {
+			names, values, ok := s.NameValues()
+			if !ok {
+				continue
+			}
+			series = append(series, s)
+			requests = append(requests, catalog.SeriesLabels{Metric: metricName, Names: names, Values: values})
+		}
+	}
+	if len(series) == 0 {
+		return nil
+	}
+	epoch, ids, err := h.catalog.GetSeriesIDs(requests)
+	if err != nil {
+		return err
+	}
+	for i, s := range series {
+		s.SetSeriesID(model.SeriesID(ids[i]), model.SeriesEpoch(epoch))
+	}
+	return nil
+}
+
+// catalogResolver creates the series requested from the catalog service.
+type catalogResolver struct {
+	sw *seriesWriter
+}
+
+// NewCatalogResolver returns the resolver creating the series requested
+// from the catalog service of the connector.
+func NewCatalogResolver(conn pgxconn.PgxConn) (catalog.Resolver, error) {
+	var labelArrayOID uint32
+	err := conn.QueryRow(context.Background(), `SELECT '`+schema.Prom+`.label_array'::regtype::oid`).Scan(&labelArrayOID)
+	if err != nil {
+		return nil, err
+	}
+	return &catalogResolver{sw: NewSeriesWriter(conn, labelArrayOID)}, nil
+}
+
+type seriesList []*model.Series
+
+func (l seriesList) VisitSeries(cb func(s *model.Series) error) error {
+	for _, s := range l {
+		if err := cb(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l seriesList) NumSeries() int {
+	return len(l)
+}
+
+func (r *catalogResolver) GetSeriesIDs(requests []catalog.SeriesLabels) (int64, []int64, error) {
+	series := make(seriesList, len(requests))
+	for i, req := range requests {
+		labels := make([]prompb.Label, len(req.Names))
+		for j := range req.Names {
+			labels[j] = prompb.Label{Name: req.Names[j], Value: req.Values[j]}
+		}
+		series[i] = model.NewSeries("", labels)
+		if series[i].MetricName() != req.Metric {
+			return 0, nil, fmt.Errorf("series of metric %s without a matching metric name label", req.Metric)
+		}
+	}
+	if err := r.sw.WriteSeries(series); err != nil {
+		return 0, nil, err
+	}
+
+	var epoch model.SeriesEpoch
+	ids := make([]int64, len(series))
+	for i, s := range series {
+		id, e, err := s.GetSeriesID()
+		if err != nil {
+			return 0, nil, err
+		}
+		// The epoch of the ids is the same for all the series.
+		epoch = e
+		ids[i] = int64(id)
+	}
+	return int64(epoch), ids, nil
+}
@@ -15,14 +15,22 @@ import (
 
 	"github.com/jackc/pgconn"
 	"github.com/prometheus/common/model"
+	"github.com/timescale/promscale/pkg/chaos"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/exemplar"
 	"github.com/timescale/promscale/pkg/pgmodel/metrics"
 	pgmodel "github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgxconn"
 )
 
-const maxCopyRequestsPerTxn = 100
+const (
+	maxCopyRequestsPerTxn = 100
+
+	// setAsyncCommitSQL turns synchronous_commit off until the end of the
+	// transaction of the batch, which runs in a single implicit transaction.
+	setAsyncCommitSQL = "SELECT set_config('synchronous_commit', 'off', true)"
+)
 
 type copyRequest struct {
 	data  *pendingBuffer
@@ -145,6 +153,17 @@ hot_gather:
 }
 
 func doInsertOrFallback(conn pgxconn.PgxConn, reqs ...copyRequest) {
+	if err := chaos.Inject(chaos.Ingest); err != nil {
+		if err == chaos.ErrDropped {
+			err = nil
+		}
+		for i := range reqs {
+			reqs[i].data.reportResults(err)
+			reqs[i].data.release()
+		}
+		return
+	}
+
 	err := insertSeries(conn, reqs...)
 	if err != nil {
 		insertBatchErrorFallback(conn, reqs...)
@@ -259,9 +278,30 @@ func insertSeries(conn pgxconn.PgxConn, reqs ...copyRequest) (err error) {
 	numRowsPerInsert := make([]int, 0, len(reqs))
 	numRowsTotal := 0
 	lowestEpoch := pgmodel.SeriesEpoch(math.MaxInt64)
+	// The batch is only committed asynchronously if all its requests can be.
+	asyncCommit := true
+	for r := range reqs {
+		if reqs[r].data.syncCommits > 0 {
+			asyncCommit = false
+			break
+		}
+	}
+	if asyncCommit {
+		batch.Queue(setAsyncCommitSQL)
+	}
+	var exemplars exemplar.Rows
 	for r := range reqs {
 		req := &reqs[r]
+		for _, samples := range req.data.batch.GetSeriesSamples() {
+			if err = exemplars.Append(samples.GetSeries(), samples.GetExemplars()); err != nil {
+				return err
+			}
+		}
 		numRows := req.data.batch.CountSamples()
+		if numRows == 0 {
+			// The series of the request were only sent with exemplars.
+			continue
+		}
 		NumRowsPerInsert.Observe(float64(numRows))
 
 		// flatten the various series into arrays.
@@ -299,6 +339,12 @@ func insertSeries(conn pgxconn.PgxConn, reqs ...copyRequest) (err error) {
 		batch.Queue("SELECT "+schema.Catalog+".insert_metric_row($1, $2::TIMESTAMPTZ[], $3::DOUBLE PRECISION[], $4::BIGINT[])", req.table, times, vals, series)
 	}
 
+	// The exemplars are inserted in the transaction of the samples, which
+	// the batch runs in.
+	if exemplars.Len() > 0 {
+		exemplars.Queue(batch)
+	}
+
 	//note the epoch increment takes an access exclusive on the table before incrementing.
 	//thus we don't need row locking here. Note by doing this check at the end we can
 	//have some wasted work for the inserts before this fails but this is rare.
@@ -315,6 +361,12 @@ func insertSeries(conn pgxconn.PgxConn, reqs ...copyRequest) (err error) {
 	}
 	defer results.Close()
 
+	if asyncCommit {
+		var setting string
+		if err = results.QueryRow().Scan(&setting); err != nil {
+			return err
+		}
+	}
 	var affectedMetrics uint64
 	for _, numRows := range numRowsPerInsert {
 		var insertedRows int64
@@ -328,6 +380,11 @@ func insertSeries(conn pgxconn.PgxConn, reqs ...copyRequest) (err error) {
 			registerDuplicates(numRowsExpected - insertedRows)
 		}
 	}
+	if exemplars.Len() > 0 {
+		if _, err = results.Exec(); err != nil {
+			return err
+		}
+	}
 
 	var val []byte
 	row := results.QueryRow()
@@ -337,6 +394,9 @@ func insertSeries(conn pgxconn.PgxConn, reqs ...copyRequest) (err error) {
 	}
 	reportDuplicates(affectedMetrics)
 	DbBatchInsertDuration.Observe(time.Since(start).Seconds())
+	if asyncCommit {
+		AsyncCommitSamples.Add(float64(numRowsTotal))
+	}
 	return nil
 }
 
@@ -7,6 +7,7 @@ package ingestor
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -69,6 +70,8 @@ func newPgxDispatcher(conn pgxconn.PgxConn, cache cache.MetricCache, scache cach
 	}
 
 	sw := NewSeriesWriter(conn, labelArrayOID)
+	sw.catalog = cfg.Catalog
+	sw.poolerMode = cfg.PoolerMode
 
 	for i := 0; i < numCopiers; i++ {
 		go runCopier(conn, toCopiers, sw)
@@ -86,6 +89,15 @@ func newPgxDispatcher(conn pgxconn.PgxConn, cache cache.MetricCache, scache cach
 	}
 	runBatchWatcher(inserter.doneChannel)
 
+	if cfg.SeriesBloomRefresh > 0 {
+		sw.blooms = newSeriesBlooms(conn)
+		inserter.doneWG.Add(1)
+		go func() {
+			defer inserter.doneWG.Done()
+			sw.blooms.run(cfg.SeriesBloomRefresh, inserter.doneChannel)
+		}()
+	}
+
 	//on startup run a completeMetricCreation to recover any potentially
 	//incomplete metric
 	err = inserter.CompleteMetricCreation()
@@ -187,6 +199,7 @@ func (p *pgxDispatcher) Close() {
 func (p *pgxDispatcher) InsertTs(dataTS model.Data) (uint64, error) {
 	var (
 		numRows      uint64
+		mint         int64 = math.MaxInt64
 		maxt         int64
 		rows         = dataTS.Rows
 		workFinished = new(sync.WaitGroup)
@@ -198,6 +211,10 @@ func (p *pgxDispatcher) InsertTs(dataTS model.Data) (uint64, error) {
 	errChan := make(chan error, 1)
 	for metricName, data := range rows {
 		for _, si := range data {
+			if si.CountSamples() == 0 {
+				// The series was only sent with exemplars.
+				continue
+			}
 			numRows += uint64(si.CountSamples())
 			ls := si.LastSample()
 			if maxt < ls.Timestamp {
@@ -205,9 +222,12 @@ func (p *pgxDispatcher) InsertTs(dataTS model.Data) (uint64, error) {
 				// the last sample should be the maxt of that series. This assumption helps avoid costly inner loops.
 				maxt = ls.Timestamp
 			}
+			if fs := si.FirstSample(); mint > fs.Timestamp {
+				mint = fs.Timestamp
+			}
 		}
 		// the following is usually non-blocking, just a channel insert
-		p.getMetricBatcher(metricName) <- &insertDataRequest{metric: metricName, data: data, finished: workFinished, errChan: errChan}
+		p.getMetricBatcher(metricName) <- &insertDataRequest{metric: metricName, data: data, finished: workFinished, errChan: errChan, asyncCommit: dataTS.AsyncCommit}
 	}
 	reportIncomingBatch(numRows)
 	reportOutgoing := func() {
@@ -223,7 +243,7 @@ func (p *pgxDispatcher) InsertTs(dataTS model.Data) (uint64, error) {
 		case err = <-errChan:
 		default:
 		}
-		postIngestTasks(maxt, numRows, 0)
+		postIngestTasks(mint, maxt, numRows, 0)
 		close(errChan)
 	} else {
 		go func() {
@@ -237,7 +257,7 @@ func (p *pgxDispatcher) InsertTs(dataTS model.Data) (uint64, error) {
 			if err != nil {
 				log.Error("msg", fmt.Sprintf("error on async send, dropping %d datapoints", numRows), "err", err)
 			}
-			postIngestTasks(maxt, numRows, 0)
+			postIngestTasks(mint, maxt, numRows, 0)
 		}()
 	}
 
@@ -250,17 +270,39 @@ func (p *pgxDispatcher) InsertMetadata(metadata []model.Metadata) (uint64, error
 	if err != nil {
 		return insertedRows, err
 	}
-	postIngestTasks(0, 0, insertedRows)
+	postIngestTasks(0, 0, 0, insertedRows)
 	if totalRows != insertedRows {
 		return insertedRows, fmt.Errorf("failed to insert all metadata: inserted %d rows out of %d rows in total", insertedRows, totalRows)
 	}
 	return insertedRows, nil
 }
 
+var ingestedListeners struct {
+	sync.RWMutex
+	fs []func(mint, maxt int64)
+}
+
+// OnIngested registers f to be called with the range of the timestamps of
+// the samples of each batch once it was written, e.g. to invalidate cached
+// query results. The samples are assumed to be sorted by time.
+func OnIngested(f func(mint, maxt int64)) {
+	ingestedListeners.Lock()
+	defer ingestedListeners.Unlock()
+	ingestedListeners.fs = append(ingestedListeners.fs, f)
+}
+
 // postIngestTasks performs a set of tasks that are due after ingesting series data.
-func postIngestTasks(maxTs int64, numSamples, numMetadata uint64) {
+func postIngestTasks(minTs, maxTs int64, numSamples, numMetadata uint64) {
 	tput.ReportDataProcessed(maxTs, numSamples, numMetadata)
 
+	if numSamples > 0 {
+		ingestedListeners.RLock()
+		for _, f := range ingestedListeners.fs {
+			f(minTs, maxTs)
+		}
+		ingestedListeners.RUnlock()
+	}
+
 	// Max_sent_timestamp stats.
 	if maxTs < atomic.LoadInt64(&MaxSentTimestamp) {
 		return
@@ -291,10 +333,11 @@ func (p *pgxDispatcher) getMetricBatcher(metric string) chan<- *insertDataReques
 }
 
 type insertDataRequest struct {
-	metric   string
-	data     []model.Samples
-	finished *sync.WaitGroup
-	errChan  chan error
+	metric      string
+	data        []model.Samples
+	finished    *sync.WaitGroup
+	errChan     chan error
+	asyncCommit bool
 }
 
 func (idr *insertDataRequest) reportResult(err error) {
@@ -9,11 +9,16 @@ import (
 	"time"
 
 	"github.com/timescale/promscale/pkg/clockcache"
+	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgmodel/catalog"
+	"github.com/timescale/promscale/pkg/pgmodel/checksum"
 	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tail"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 type Cfg struct {
@@ -22,12 +27,37 @@ type Cfg struct {
 	NumCopiers             int
 	DisableEpochSync       bool
 	IgnoreCompressedChunks bool
+	// SortedLabels is set if all the senders guarantee that the labels of
+	// each series are sorted by name and free of duplicate names.
+	SortedLabels bool
+	// Catalog, if set, creates the series through the catalog service.
+	Catalog *catalog.Client
+	// AsyncCommit commits the samples of all the requests with
+	// synchronous_commit off, and AsyncCommitTenants those of the requests
+	// of the listed tenants.
+	AsyncCommit        bool
+	AsyncCommitTenants []string
+	// VerifyChecksums records a checksum of the samples of each ingested
+	// series, for the checksum verifier to compare with the stored samples.
+	VerifyChecksums bool
+	// SeriesBloomRefresh, if set, is the interval at which the bloom filters
+	// telling the new series apart are loaded.
+	SeriesBloomRefresh time.Duration
+	// PoolerMode is set if the connections go through a transaction pooler.
+	PoolerMode bool
 }
 
 // DBIngestor ingest the TimeSeries data into Timescale database.
 type DBIngestor struct {
-	sCache     cache.SeriesCache
-	dispatcher model.Dispatcher
+	sCache             cache.SeriesCache
+	dispatcher         model.Dispatcher
+	tail               *tail.Broker
+	sortedLabels       bool
+	asyncAcks          bool
+	asyncCommit        bool
+	asyncCommitTenants map[string]struct{}
+	// checksumConn records the checksums of the samples if they are verified.
+	checksumConn pgxconn.PgxConn
 }
 
 // NewPgxIngestor returns a new Ingestor that uses connection pool and a metrics cache
@@ -37,9 +67,23 @@ func NewPgxIngestor(conn pgxconn.PgxConn, cache cache.MetricCache, sCache cache.
 	if err != nil {
 		return nil, err
 	}
+	var checksumConn pgxconn.PgxConn
+	if cfg.VerifyChecksums {
+		checksumConn = conn
+	}
+	asyncCommitTenants := make(map[string]struct{}, len(cfg.AsyncCommitTenants))
+	for _, tenant := range cfg.AsyncCommitTenants {
+		asyncCommitTenants[tenant] = struct{}{}
+	}
 	return &DBIngestor{
-		sCache:     sCache,
-		dispatcher: dispatcher,
+		sCache:             sCache,
+		dispatcher:         dispatcher,
+		tail:               tail.NewBroker(),
+		sortedLabels:       cfg.SortedLabels,
+		asyncAcks:          cfg.AsyncAcks,
+		asyncCommit:        cfg.AsyncCommit,
+		asyncCommitTenants: asyncCommitTenants,
+		checksumConn:       checksumConn,
 	}, nil
 }
 
@@ -72,6 +116,17 @@ type result struct {
 //     req the WriteRequest backing tts. It will be added to our WriteRequest
 //         pool when it is no longer needed.
 func (ingestor *DBIngestor) Ingest(r *prompb.WriteRequest) (numSamples uint64, numMetadata uint64, err error) {
+	return ingestor.ingest(r, ingestor.sortedLabels)
+}
+
+// IngestSorted is Ingest for a request whose sender guarantees that the labels
+// of each series are sorted by name and free of duplicate names, so that they
+// are not checked.
+func (ingestor *DBIngestor) IngestSorted(r *prompb.WriteRequest) (numSamples uint64, numMetadata uint64, err error) {
+	return ingestor.ingest(r, true)
+}
+
+func (ingestor *DBIngestor) ingest(r *prompb.WriteRequest, sortedLabels bool) (numSamples uint64, numMetadata uint64, err error) {
 	activeWriteRequests.Inc()
 	defer activeWriteRequests.Dec() // Dec() is defered otherwise it will lead to loosing a decrement if some error occurs.
 	var (
@@ -82,7 +137,7 @@ func (ingestor *DBIngestor) Ingest(r *prompb.WriteRequest) (numSamples uint64, n
 	switch numTs, numMeta := len(timeseries), len(metadata); {
 	case numTs > 0 && numMeta == 0:
 		// Write request contains only time-series.
-		n, err := ingestor.ingestTimeseries(timeseries, release)
+		n, err := ingestor.ingestTimeseries(timeseries, sortedLabels, release)
 		return n, 0, err
 	case numTs == 0 && numMeta == 0:
 		release()
@@ -103,7 +158,7 @@ func (ingestor *DBIngestor) Ingest(r *prompb.WriteRequest) (numSamples uint64, n
 	defer close(res)
 
 	go func() {
-		n, err := ingestor.ingestTimeseries(timeseries, release)
+		n, err := ingestor.ingestTimeseries(timeseries, sortedLabels, release)
 		res <- result{series, n, err}
 	}()
 	go func() {
@@ -144,42 +199,111 @@ func (ingestor *DBIngestor) Ingest(r *prompb.WriteRequest) (numSamples uint64, n
 	return samplesRowsInserted, metadataRowsInserted, err
 }
 
-func (ingestor *DBIngestor) ingestTimeseries(timeseries []prompb.TimeSeries, releaseMem func()) (uint64, error) {
+func (ingestor *DBIngestor) ingestTimeseries(timeseries []prompb.TimeSeries, sortedLabels bool, releaseMem func()) (uint64, error) {
 	var (
 		totalSamplesRows uint64
 		dataSamples      = make(map[string][]model.Samples)
+		getSeries        = ingestor.sCache.GetSeriesFromProtos
+		asyncCommit      = ingestor.isAsyncCommit(timeseries)
+		checksums        []checksum.Entry
+		checksumSeries   []*model.Series
 	)
+	if sortedLabels {
+		getSeries = ingestor.sCache.GetSeriesFromSortedProtos
+	}
 	for i := range timeseries {
 		ts := &timeseries[i]
-		if len(ts.Samples) == 0 {
+		if len(ts.Samples) == 0 && len(ts.Exemplars) == 0 {
 			continue
 		}
+		// Live tail subscribers see the samples before they are batched for insertion.
+		if len(ts.Samples) > 0 {
+			ingestor.tail.Publish(ts.Labels, ts.Samples)
+		}
 		// Normalize and canonicalize t.Labels.
 		// After this point t.Labels should never be used again.
-		seriesLabels, metricName, err := ingestor.sCache.GetSeriesFromProtos(ts.Labels)
+		seriesLabels, metricName, err := getSeries(ts.Labels)
 		if err != nil {
 			return 0, err
 		}
 		if metricName == "" {
 			return 0, errors.ErrNoMetricName
 		}
-		sample := model.NewPromSample(seriesLabels, ts.Samples)
+		if ingestor.checksumConn != nil && len(ts.Samples) > 0 {
+			checksums = append(checksums, checksum.NewEntry(metricName, ts.Samples))
+			checksumSeries = append(checksumSeries, seriesLabels)
+		}
+		// The exemplars are inserted in the transaction of the samples.
+		sample := model.NewPromSampleWithExemplars(seriesLabels, ts.Samples, ts.Exemplars)
 		totalSamplesRows += uint64(len(ts.Samples))
 
 		dataSamples[metricName] = append(dataSamples[metricName], sample)
-		// we're going to free req after this, but we still need the samples,
-		// so nil the field
+		// we're going to free req after this, but we still need the samples
+		// and exemplars, so nil the fields
 		ts.Samples = nil
+		ts.Exemplars = nil
 	}
 	releaseMem()
 
-	samplesRowsInserted, errSamples := ingestor.dispatcher.InsertTs(model.Data{Rows: dataSamples, ReceivedTime: time.Now()})
+	samplesRowsInserted, errSamples := ingestor.dispatcher.InsertTs(model.Data{Rows: dataSamples, ReceivedTime: time.Now(), AsyncCommit: asyncCommit})
 	if errSamples == nil && samplesRowsInserted != totalSamplesRows {
 		return samplesRowsInserted, fmt.Errorf("failed to insert all the data! Expected: %d, Got: %d", totalSamplesRows, samplesRowsInserted)
 	}
+	if errSamples == nil && len(checksums) > 0 {
+		ingestor.recordChecksums(checksums, checksumSeries)
+	}
 	return samplesRowsInserted, errSamples
 }
 
+// recordChecksums records the checksums of the series whose ids are set,
+// which are all of them unless the inserts are acknowledged asynchronously.
+func (ingestor *DBIngestor) recordChecksums(checksums []checksum.Entry, series []*model.Series) {
+	entries := checksums[:0]
+	for i := range checksums {
+		id, _, err := series[i].GetSeriesID()
+		if err != nil {
+			continue
+		}
+		checksums[i].SeriesID = int64(id)
+		entries = append(entries, checksums[i])
+	}
+	if err := checksum.Record(ingestor.checksumConn, entries); err != nil {
+		log.WarnRateLimited("msg", "error recording the checksums of ingested samples", "err", err)
+	}
+}
+
+// CommitsDurably returns whether the samples of the request are durably
+// committed by the time they are ingested, which is not the case if the
+// inserts are acknowledged or committed asynchronously.
+func (ingestor *DBIngestor) CommitsDurably(r *prompb.WriteRequest) bool {
+	return !ingestor.asyncAcks && !ingestor.isAsyncCommit(r.Timeseries)
+}
+
+// isAsyncCommit returns whether the samples of the series can be committed
+// asynchronously, which is the case if all the series belong to tenants
+// whose samples are.
+func (ingestor *DBIngestor) isAsyncCommit(timeseries []prompb.TimeSeries) bool {
+	if ingestor.asyncCommit {
+		return true
+	}
+	if len(ingestor.asyncCommitTenants) == 0 {
+		return false
+	}
+	for i := range timeseries {
+		tenant := ""
+		for _, l := range timeseries[i].Labels {
+			if l.Name == tenancy.TenantLabelKey {
+				tenant = l.Value
+				break
+			}
+		}
+		if _, ok := ingestor.asyncCommitTenants[tenant]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // ingestMetadata ingests metric metadata received from Prometheus. It runs as a secondary routine, independent from
 // the main dataflow (i.e., samples ingestion) since metadata ingestion is not as frequent as that of samples.
 func (ingestor *DBIngestor) ingestMetadata(metadata []prompb.MetricMetadata, releaseMem func()) (uint64, error) {
@@ -202,6 +326,11 @@ func (ingestor *DBIngestor) ingestMetadata(metadata []prompb.MetricMetadata, rel
 	return rowsInserted, nil
 }
 
+// Tail returns the broker used to stream ingested samples to live subscribers.
+func (ingestor *DBIngestor) Tail() *tail.Broker {
+	return ingestor.tail
+}
+
 // Parts of metric creation not needed to insert data
 func (ingestor *DBIngestor) CompleteMetricCreation() error {
 	return ingestor.dispatcher.CompleteMetricCreation()
@@ -4,7 +4,11 @@
 
 package ingestor
 
-import "github.com/timescale/promscale/pkg/prompb"
+import (
+	"fmt"
+
+	"github.com/timescale/promscale/pkg/prompb"
+)
 
 // DBInserter is responsible for ingesting the TimeSeries protobuf structs and
 // storing them in the database.
@@ -13,3 +17,30 @@ type DBInserter interface {
 	// Returns the number of metrics ingested and any error encountered before finishing.
 	Ingest(*prompb.WriteRequest) (uint64, uint64, error)
 }
+
+// SortedLabelsInserter is a DBInserter that can skip sorting and validating
+// the labels of requests whose sender guarantees that the labels of each
+// series are sorted by name and free of duplicate names.
+type SortedLabelsInserter interface {
+	IngestSorted(*prompb.WriteRequest) (uint64, uint64, error)
+}
+
+// CheckpointCommitter is a DBInserter that records the offsets of replayable
+// sources whose samples were committed, so that their consumers can resume
+// from there after a restart. A checkpoint can only be recorded for requests
+// whose samples are durably committed once ingested.
+type CheckpointCommitter interface {
+	CommitsDurably(*prompb.WriteRequest) bool
+	CommitCheckpoint(source string, offset int64) error
+}
+
+// ErrTwoPhaseCommitDisabled is returned by a TransactionPreparer that is not
+// allowed to prepare transactions.
+var ErrTwoPhaseCommitDisabled = fmt.Errorf("two-phase commit is disabled, enable it with -ingest-two-phase-commit")
+
+// TransactionPreparer is a DBInserter that can ingest requests in prepared
+// transactions, which an external transaction manager commits or rolls back
+// later. It takes ownership of the request.
+type TransactionPreparer interface {
+	PrepareTransaction(id string, r *prompb.WriteRequest) (uint64, error)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/jackc/pgtype"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
 	pgmodelErrs "github.com/timescale/promscale/pkg/pgmodel/common/errors"
@@ -51,13 +52,109 @@ func (c sVisitor) NumSeries() int {
 
 func TestPGXInserterInsertSeries(t *testing.T) {
 	testCases := []struct {
-		name       string
-		series     []labels.Labels
-		sqlQueries []model.SqlQuery
+		name            string
+		series          []labels.Labels
+		labelMergeBatch int
+		poolerMode      bool
+		sqlQueries      []model.SqlQuery
 	}{
 		{
 			name: "Zero series",
 		},
+		{
+			name: "One series with merged labels",
+			series: []labels.Labels{
+				{
+					{Name: "name_1", Value: "value_1"},
+					{Name: "__name__", Value: "metric_1"},
+				},
+			},
+			labelMergeBatch: 2,
+			sqlQueries: []model.SqlQuery{
+				{Sql: "BEGIN;"},
+				{Sql: createLabelStagingSQL},
+				{
+					Sql:  `COPY "pg_temp"."promscale_label_staging" (key, value)`,
+					Args: []interface{}{[]interface{}{"__name__", "metric_1"}, []interface{}{"name_1", "value_1"}},
+				},
+				{Sql: mergeStagedLabelsSQL},
+				{Sql: "COMMIT;"},
+				{Sql: "BEGIN;"},
+				{
+					Sql:     "SELECT current_epoch FROM _prom_catalog.ids_epoch LIMIT 1",
+					Args:    []interface{}(nil),
+					Results: model.RowResults{{int64(1)}},
+					Err:     error(nil),
+				},
+				{Sql: "COMMIT;"},
+				{Sql: "BEGIN;"},
+				{
+					Sql: "SELECT * FROM _prom_catalog.get_or_create_label_ids($1, $2, $3)",
+					Args: []interface{}{
+						"metric_1",
+						[]string{"__name__", "name_1"},
+						[]string{"metric_1", "value_1"},
+					},
+					Results: model.RowResults{
+						{[]int32{1, 2}, []int32{1, 2}, []string{"__name__", "name_1"}, []string{"metric_1", "value_1"}},
+					},
+					Err: error(nil),
+				},
+				{Sql: "COMMIT;"},
+				{Sql: "BEGIN;"},
+				{
+					Sql: seriesInsertSQL,
+					Args: []interface{}{
+						"metric_1",
+						getTestLabelArray(t, [][]int32{{1, 2}}),
+					},
+					Results: model.RowResults{{int64(1), int64(1)}},
+					Err:     error(nil),
+				},
+				{Sql: "COMMIT;"},
+			},
+		},
+		{
+			name: "Merge labels in pooler mode",
+			series: []labels.Labels{
+				{
+					{Name: "name_1", Value: "value_1"},
+					{Name: "__name__", Value: "metric_1"},
+				},
+			},
+			labelMergeBatch: 1,
+			poolerMode:      true,
+			sqlQueries: []model.SqlQuery{
+				{Sql: "BEGIN;"},
+				{Sql: createDroppedLabelStagingSQL},
+				{
+					Sql:  `COPY "pg_temp"."promscale_label_staging" (key, value)`,
+					Args: []interface{}{[]interface{}{"__name__", "metric_1"}, []interface{}{"name_1", "value_1"}},
+				},
+				{Sql: mergeStagedLabelsSQL, Err: fmt.Errorf("some merge error")},
+				{Sql: "ROLLBACK;"},
+			},
+		},
+		{
+			name: "Merge labels err",
+			series: []labels.Labels{
+				{
+					{Name: "name_1", Value: "value_1"},
+					{Name: "__name__", Value: "metric_1"},
+				},
+			},
+			labelMergeBatch: 1,
+			sqlQueries: []model.SqlQuery{
+				{Sql: "BEGIN;"},
+				{Sql: createLabelStagingSQL},
+				{
+					Sql:  `COPY "pg_temp"."promscale_label_staging" (key, value)`,
+					Args: []interface{}{[]interface{}{"__name__", "metric_1"}, []interface{}{"name_1", "value_1"}},
+				},
+				{Sql: mergeStagedLabelsSQL, Err: fmt.Errorf("some merge error")},
+				{Sql: "ROLLBACK;"},
+			},
+		},
 		{
 			name: "One series",
 			series: []labels.Labels{
@@ -259,6 +356,10 @@ func TestPGXInserterInsertSeries(t *testing.T) {
 			scache.Reset()
 
 			sw := NewSeriesWriter(mock, 0)
+			if c.labelMergeBatch > 0 {
+				sw.labelMergeBatch = c.labelMergeBatch
+			}
+			sw.poolerMode = c.poolerMode
 
 			lsi := make([]model.Samples, 0)
 			for _, ser := range c.series {
@@ -511,6 +612,7 @@ func TestPGXInserterInsertData(t *testing.T) {
 	testCases := []struct {
 		name          string
 		rows          map[string][]model.Samples
+		asyncCommit   bool
 		sqlQueries    []model.SqlQuery
 		metricsGetErr error
 	}{
@@ -554,6 +656,44 @@ func TestPGXInserterInsertData(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "One data committed asynchronously",
+			rows: map[string][]model.Samples{
+				"metric_0": {model.NewPromSample(makeLabel(), make([]prompb.Sample, 1))},
+			},
+			asyncCommit: true,
+			sqlQueries: []model.SqlQuery{
+				{Sql: "SELECT 'prom_api.label_array'::regtype::oid", Results: model.RowResults{{uint32(434)}}},
+				{Sql: "CALL _prom_catalog.finalize_metric_creation()"},
+				{
+					Sql:     "SELECT table_name, possibly_new FROM _prom_catalog.get_or_create_metric_table_name($1)",
+					Args:    []interface{}{"metric_0"},
+					Results: model.RowResults{{"metric_0", false}},
+					Err:     error(nil),
+				},
+				{
+					Sql:     setAsyncCommitSQL,
+					Results: model.RowResults{{"off"}},
+				},
+				{
+					Sql: "SELECT _prom_catalog.insert_metric_row($1, $2::TIMESTAMPTZ[], $3::DOUBLE PRECISION[], $4::BIGINT[])",
+					Args: []interface{}{
+						"metric_0",
+						[]time.Time{time.Unix(0, 0)},
+						[]float64{0},
+						[]int64{1},
+					},
+					Results: model.RowResults{{int64(1)}},
+					Err:     error(nil),
+				},
+				{
+					Sql:     "SELECT CASE current_epoch > $1::BIGINT + 1 WHEN true THEN _prom_catalog.epoch_abort($1) END FROM _prom_catalog.ids_epoch LIMIT 1",
+					Args:    []interface{}{int64(1)},
+					Results: model.RowResults{{[]byte{}}},
+					Err:     error(nil),
+				},
+			},
+		},
 		{
 			name: "Two data",
 			rows: map[string][]model.Samples{
@@ -591,6 +731,57 @@ func TestPGXInserterInsertData(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Data with exemplars",
+			rows: map[string][]model.Samples{
+				"metric_0": {
+					model.NewPromSampleWithExemplars(makeLabel(), make([]prompb.Sample, 1), []prompb.Exemplar{
+						{Labels: []prompb.Label{{Name: "trace_id", Value: "a"}}, Value: 2, Timestamp: 1000},
+					}),
+					// A series only sent with exemplars.
+					model.NewPromSampleWithExemplars(makeLabel(), nil, []prompb.Exemplar{{Value: 3, Timestamp: 2000}}),
+				},
+			},
+			sqlQueries: []model.SqlQuery{
+				{Sql: "SELECT 'prom_api.label_array'::regtype::oid", Results: model.RowResults{{uint32(434)}}},
+				{Sql: "CALL _prom_catalog.finalize_metric_creation()"},
+				{
+					Sql:     "SELECT table_name, possibly_new FROM _prom_catalog.get_or_create_metric_table_name($1)",
+					Args:    []interface{}{"metric_0"},
+					Results: model.RowResults{{"metric_0", false}},
+					Err:     error(nil),
+				},
+				{
+					Sql: "SELECT _prom_catalog.insert_metric_row($1, $2::TIMESTAMPTZ[], $3::DOUBLE PRECISION[], $4::BIGINT[])",
+					Args: []interface{}{
+						"metric_0",
+						[]time.Time{time.Unix(0, 0)},
+						[]float64{0},
+						[]int64{1},
+					},
+					Results: model.RowResults{{int64(1)}},
+					Err:     error(nil),
+				},
+				{
+					Sql: `INSERT INTO _prom_catalog.exemplar (metric_name, series_id, time, value, labels)
+SELECT * FROM unnest($1::TEXT[], $2::BIGINT[], $3::TIMESTAMPTZ[], $4::DOUBLE PRECISION[], $5::JSONB[])
+ON CONFLICT DO NOTHING`,
+					Args: []interface{}{
+						[]string{"", ""},
+						[]int64{1, 1},
+						[]time.Time{timestamp.Time(1000), timestamp.Time(2000)},
+						[]float64{2, 3},
+						[]string{`{"trace_id":"a"}`, `{}`},
+					},
+				},
+				{
+					Sql:     "SELECT CASE current_epoch > $1::BIGINT + 1 WHEN true THEN _prom_catalog.epoch_abort($1) END FROM _prom_catalog.ids_epoch LIMIT 1",
+					Args:    []interface{}{int64(1)},
+					Results: model.RowResults{{[]byte{}}},
+					Err:     error(nil),
+				},
+			},
+		},
 		{
 			name: "Create table error",
 			rows: map[string][]model.Samples{
@@ -820,7 +1011,7 @@ func TestPGXInserterInsertData(t *testing.T) {
 			}
 			defer inserter.Close()
 
-			_, err = inserter.InsertTs(model.Data{Rows: c.rows})
+			_, err = inserter.InsertTs(model.Data{Rows: c.rows, AsyncCommit: c.asyncCommit})
 
 			var expErr error
 			switch {
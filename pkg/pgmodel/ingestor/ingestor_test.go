@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
 	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 func TestDBIngestorIngest(t *testing.T) {
@@ -310,3 +312,61 @@ func TestDBIngestorIngest(t *testing.T) {
 		})
 	}
 }
+
+func TestDBIngestorIsAsyncCommit(t *testing.T) {
+	series := func(tenant string) prompb.TimeSeries {
+		ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: model.MetricNameLabelName, Value: "test"}}}
+		if tenant != "" {
+			ts.Labels = append(ts.Labels, prompb.Label{Name: tenancy.TenantLabelKey, Value: tenant})
+		}
+		return ts
+	}
+	tenants := map[string]struct{}{"a": {}, "b": {}}
+
+	testCases := []struct {
+		name     string
+		ingestor DBIngestor
+		series   []prompb.TimeSeries
+		expected bool
+	}{
+		{
+			name:   "Disabled",
+			series: []prompb.TimeSeries{series("a")},
+		},
+		{
+			name:     "All requests",
+			ingestor: DBIngestor{asyncCommit: true},
+			series:   []prompb.TimeSeries{series(""), series("c")},
+			expected: true,
+		},
+		{
+			name:     "Listed tenants",
+			ingestor: DBIngestor{asyncCommitTenants: tenants},
+			series:   []prompb.TimeSeries{series("a"), series("b")},
+			expected: true,
+		},
+		{
+			name:     "Unlisted tenant",
+			ingestor: DBIngestor{asyncCommitTenants: tenants},
+			series:   []prompb.TimeSeries{series("a"), series("c")},
+		},
+		{
+			name:     "No tenant",
+			ingestor: DBIngestor{asyncCommitTenants: tenants},
+			series:   []prompb.TimeSeries{series("a"), series("")},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, c.ingestor.isAsyncCommit(c.series))
+		})
+	}
+}
+
+func TestDBIngestorCommitsDurably(t *testing.T) {
+	r := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{Labels: []prompb.Label{{Name: model.MetricNameLabelName, Value: "test"}}}}}
+
+	require.True(t, (&DBIngestor{}).CommitsDurably(r))
+	require.False(t, (&DBIngestor{asyncAcks: true}).CommitsDurably(r))
+	require.False(t, (&DBIngestor{asyncCommit: true}).CommitsDurably(r))
+}
@@ -99,6 +99,13 @@ var (
 		},
 		func() float64 { return float64(len(SamplesCopierChannelToMonitor)) },
 	)
+	AsyncCommitSamples = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Name:      "ingest_async_commit_samples_total",
+			Help:      "Total number of samples committed with synchronous_commit off, which may be lost if the database crashes before flushing their commit to disk.",
+		},
+	)
 	activeWriteRequests = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: util.PromNamespace,
@@ -128,6 +135,7 @@ func init() {
 		MetadataBatchInsertDuration,
 		SamplesCopierChCap,
 		SamplesCopierChLen,
+		AsyncCommitSamples,
 		activeWriteRequests,
 	)
 
@@ -0,0 +1,248 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	seriesBloomLoadSQL = "SELECT s.id, s.labels::int[] FROM " + schema.Catalog + ".series s " +
+		"WHERE s.metric_id = (SELECT m.id FROM " + schema.Catalog + ".metric m WHERE m.metric_name = $1 AND m.table_schema = '" + schema.Data + "') " +
+		"AND s.id > $2"
+
+	// With 10 bits per series and 7 hashes, about 1% of the new series
+	// are reported as maybe existing.
+	seriesBloomBitsPerSeries = 10
+	seriesBloomHashes        = 7
+	seriesBloomMinCapacity   = 1024
+)
+
+var seriesBloomLookups = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "ingest_series_bloom_lookups_total",
+		Help:      "Total number of series missing from the series cache looked up in the bloom filters of their metric, by result: new, maybe_existing or not_loaded.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(seriesBloomLookups)
+}
+
+// bloomFilter is a bloom filter of 64-bit hashes.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+}
+
+func newBloomFilter(capacity int) *bloomFilter {
+	m := uint64(capacity) * seriesBloomBitsPerSeries
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m}
+}
+
+func (b *bloomFilter) add(h uint64) {
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < seriesBloomHashes; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(h uint64) bool {
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < seriesBloomHashes; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesFingerprint is the hash of the label array of a series, as stored in
+// the series table.
+func seriesFingerprint(labelArray []int32) uint64 {
+	buf := make([]byte, 4*len(labelArray))
+	for i, id := range labelArray {
+		binary.LittleEndian.PutUint32(buf[4*i:], uint32(id))
+	}
+	return xxhash.Sum64(buf)
+}
+
+// metricBloom is the bloom filter of the series of a metric, loaded up to
+// the series id lastID.
+type metricBloom struct {
+	filter   *bloomFilter
+	capacity int
+	count    int
+	lastID   int64
+}
+
+/* seriesBlooms keeps a bloom filter of the series of each metric ingested, so that the series missing from the series
+* cache that are definitely new, e.g. during churn, are inserted without being looked up in the series table first.
+* The filters are loaded from the series table in the background, incrementally from the last series id loaded, and
+* also hold the series resolved by the connector since. A series created by another connector after the last load
+* can be reported as new, in which case the database falls back to looking it up. */
+type seriesBlooms struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	metrics map[string]*metricBloom
+}
+
+func newSeriesBlooms(conn pgxconn.PgxConn) *seriesBlooms {
+	return &seriesBlooms{conn: conn, metrics: make(map[string]*metricBloom)}
+}
+
+// isNew returns true if the series of the metric with the label array
+// definitely does not exist. The filter of a metric seen for the first time
+// is loaded at the next refresh, until which its series may all exist.
+func (b *seriesBlooms) isNew(metric string, labelArray []int32) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	mb, ok := b.metrics[metric]
+	if !ok {
+		b.metrics[metric] = nil
+	}
+	if mb == nil {
+		seriesBloomLookups.WithLabelValues("not_loaded").Inc()
+		return false
+	}
+	if mb.filter.mayContain(seriesFingerprint(labelArray)) {
+		seriesBloomLookups.WithLabelValues("maybe_existing").Inc()
+		return false
+	}
+	seriesBloomLookups.WithLabelValues("new").Inc()
+	return true
+}
+
+// added records that the series of the metric with the label array exists.
+func (b *seriesBlooms) added(metric string, labelArray []int32) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if mb := b.metrics[metric]; mb != nil {
+		mb.filter.add(seriesFingerprint(labelArray))
+		mb.count++
+	}
+}
+
+func (b *seriesBlooms) run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.refresh()
+		case <-done:
+			return
+		}
+	}
+}
+
+// refresh loads the series created since the last refresh into the filters,
+// and rebuilds the filters that are over capacity with twice as many series.
+func (b *seriesBlooms) refresh() {
+	b.mux.Lock()
+	metrics := make(map[string]*metricBloom, len(b.metrics))
+	for metric, mb := range b.metrics {
+		metrics[metric] = mb
+	}
+	b.mux.Unlock()
+
+	for metric, mb := range metrics {
+		if err := b.refreshMetric(metric, mb); err != nil {
+			log.Warn("msg", "error loading the series bloom filter of a metric", "metric", metric, "err", err)
+		}
+	}
+}
+
+func (b *seriesBlooms) refreshMetric(metric string, mb *metricBloom) error {
+	var lastID int64
+	if mb != nil {
+		b.mux.Lock()
+		lastID = mb.lastID
+		b.mux.Unlock()
+	}
+	ids, fingerprints, err := b.load(metric, lastID)
+	if err != nil {
+		return err
+	}
+
+	b.mux.Lock()
+	if mb != nil && mb.count+len(fingerprints) <= mb.capacity {
+		for i := range fingerprints {
+			mb.filter.add(fingerprints[i])
+			if ids[i] > mb.lastID {
+				mb.lastID = ids[i]
+			}
+		}
+		mb.count += len(fingerprints)
+		b.mux.Unlock()
+		return nil
+	}
+	b.mux.Unlock()
+
+	if mb != nil {
+		if ids, fingerprints, err = b.load(metric, 0); err != nil {
+			return err
+		}
+	}
+	capacity := 2 * len(fingerprints)
+	if capacity < seriesBloomMinCapacity {
+		capacity = seriesBloomMinCapacity
+	}
+	rebuilt := &metricBloom{filter: newBloomFilter(capacity), capacity: capacity, count: len(fingerprints)}
+	for i := range fingerprints {
+		rebuilt.filter.add(fingerprints[i])
+		if ids[i] > rebuilt.lastID {
+			rebuilt.lastID = ids[i]
+		}
+	}
+	b.mux.Lock()
+	b.metrics[metric] = rebuilt
+	b.mux.Unlock()
+	return nil
+}
+
+// load returns the ids and fingerprints of the series of the metric with an
+// id larger than lastID.
+func (b *seriesBlooms) load(metric string, lastID int64) ([]int64, []uint64, error) {
+	rows, err := b.conn.Query(context.Background(), seriesBloomLoadSQL, metric, lastID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading series: %w", err)
+	}
+	defer rows.Close()
+	var (
+		ids          []int64
+		fingerprints []uint64
+	)
+	for rows.Next() {
+		var (
+			id         int64
+			labelArray []int32
+		)
+		if err = rows.Scan(&id, &labelArray); err != nil {
+			return nil, nil, fmt.Errorf("loading series: %w", err)
+		}
+		ids = append(ids, id)
+		fingerprints = append(fingerprints, seriesFingerprint(labelArray))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("loading series: %w", err)
+	}
+	return ids, fingerprints, nil
+}
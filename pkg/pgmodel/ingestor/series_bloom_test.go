@@ -0,0 +1,60 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const n = 10000
+	b := newBloomFilter(n)
+	for i := int32(0); i < n; i++ {
+		b.add(seriesFingerprint([]int32{1, i}))
+	}
+	falsePositives := 0
+	for i := int32(0); i < n; i++ {
+		require.True(t, b.mayContain(seriesFingerprint([]int32{1, i})))
+		if b.mayContain(seriesFingerprint([]int32{2, i})) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, n/50)
+}
+
+func TestSeriesBlooms(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql:     seriesBloomLoadSQL,
+			Args:    []interface{}{"cpu", int64(0)},
+			Results: model.RowResults{{int64(1), []int32{1, 2}}, {int64(3), []int32{1, 3}}},
+		},
+		{
+			Sql:     seriesBloomLoadSQL,
+			Args:    []interface{}{"cpu", int64(3)},
+			Results: model.RowResults{{int64(7), []int32{1, 4}}},
+		},
+	}, t)
+	b := newSeriesBlooms(mock)
+
+	// The series of a metric may all exist until its filter is loaded.
+	require.False(t, b.isNew("cpu", []int32{1, 5}))
+	b.refresh()
+	require.False(t, b.isNew("cpu", []int32{1, 2}))
+	require.False(t, b.isNew("cpu", []int32{1, 3}))
+	require.True(t, b.isNew("cpu", []int32{1, 5}))
+	b.added("cpu", []int32{1, 5})
+	require.False(t, b.isNew("cpu", []int32{1, 5}))
+
+	// The series created since are loaded incrementally.
+	require.True(t, b.isNew("cpu", []int32{1, 4}))
+	b.refresh()
+	require.False(t, b.isNew("cpu", []int32{1, 4}))
+	require.Equal(t, int64(7), b.metrics["cpu"].lastID)
+	require.Equal(t, 4, b.metrics["cpu"].count)
+}
@@ -7,8 +7,12 @@ package ingestor
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/catalog"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgmodel/model/pgutf8str"
@@ -17,11 +21,38 @@ import (
 
 const (
 	seriesInsertSQL = "SELECT (_prom_catalog.get_or_create_series_id_for_label_array($1, l.elem)).series_id, l.nr FROM unnest($2::prom_api.label_array[]) WITH ORDINALITY l(elem, nr) ORDER BY l.elem"
+	// seriesInsertNewSQL inserts the series known to be new without looking
+	// them up first.
+	seriesInsertNewSQL = "SELECT CASE WHEN l.new THEN (_prom_catalog.create_series_id_for_label_array($1, l.elem)).series_id " +
+		"ELSE (_prom_catalog.get_or_create_series_id_for_label_array($1, l.elem)).series_id END, l.nr " +
+		"FROM unnest($2::prom_api.label_array[], $3::boolean[]) WITH ORDINALITY l(elem, new, nr) ORDER BY l.elem"
+
+	// The labels of large batches are created in a single statement merging
+	// them from a temporary table they are copied to, rather than one by one
+	// by get_or_create_label_ids. The table lives as long as the session,
+	// and is emptied at the end of each transaction. Behind a pooler, the
+	// sessions are shared with other clients, so the table is dropped at the
+	// end of the transaction instead.
+	labelStagingTable            = "promscale_label_staging"
+	createLabelStagingSQL        = "CREATE TEMPORARY TABLE IF NOT EXISTS " + labelStagingTable + " (key TEXT, value TEXT) ON COMMIT DELETE ROWS"
+	createDroppedLabelStagingSQL = "CREATE TEMPORARY TABLE " + labelStagingTable + " (key TEXT, value TEXT) ON COMMIT DROP"
+	mergeStagedLabelsSQL         = "INSERT INTO " + schema.Catalog + ".label(key, value) SELECT s.key, s.value FROM pg_temp." + labelStagingTable + " s WHERE NOT EXISTS (SELECT 1 FROM " + schema.Catalog + ".label l WHERE l.key = s.key AND l.value = s.value) ORDER BY s.key, s.value ON CONFLICT DO NOTHING"
+	defaultLabelMergeBatch       = 100
 )
 
 type seriesWriter struct {
 	conn          pgxconn.PgxConn
 	labelArrayOID uint32
+	// catalog, if set, creates the series on the elected catalog connector.
+	catalog *catalog.Client
+	// labelMergeBatch is the number of distinct labels from which the labels
+	// are merged from a temporary table before their ids are fetched.
+	labelMergeBatch int
+	// blooms, if set, tells the series that are definitely new.
+	blooms *seriesBlooms
+	// poolerMode is set if the connections go through a transaction
+	// pooler, which must not be left with session state.
+	poolerMode bool
 }
 
 type labelInfo struct {
@@ -41,7 +72,7 @@ type SeriesVisitor interface {
 func labelArrayTranscoder() pgtype.ValueTranscoder { return &pgtype.Int4Array{} }
 
 func NewSeriesWriter(conn pgxconn.PgxConn, labelArrayOID uint32) *seriesWriter {
-	return &seriesWriter{conn, labelArrayOID}
+	return &seriesWriter{conn: conn, labelArrayOID: labelArrayOID, labelMergeBatch: defaultLabelMergeBatch}
 }
 
 type perMetricInfo struct {
@@ -51,6 +82,7 @@ type perMetricInfo struct {
 	maxPos                 int
 	labelArraySet          *pgtype.ArrayType
 	labelArraySetNumLabels int
+	labelArrays            [][]int32
 }
 
 // Set all seriesIds for a samples, fetching any missing ones from the DB,
@@ -77,6 +109,13 @@ func (h *seriesWriter) WriteSeries(sv SeriesVisitor) error {
 	if len(infos) == 0 {
 		return nil
 	}
+	if h.catalog != nil {
+		err = h.writeSeriesWithCatalog(infos)
+		if err == nil {
+			return nil
+		}
+		log.WarnRateLimited("msg", "catalog service unavailable, creating the series locally", "err", err)
+	}
 
 	labelMap := make(map[labelKey]labelInfo, seriesCount)
 	//logically should be a separate function but we want
@@ -106,6 +145,10 @@ func (h *seriesWriter) WriteSeries(sv SeriesVisitor) error {
 		return nil
 	}
 
+	if err = h.mergeLabels(labelMap); err != nil {
+		return fmt.Errorf("error setting series ids: %w", err)
+	}
+
 	//labels have to be created before series are since we need a canonical
 	//ordering for label creation to avoid deadlocks. Otherwise, if we create
 	//the labels for multiple series in same txn as we are creating the series,
@@ -131,7 +174,11 @@ func (h *seriesWriter) WriteSeries(sv SeriesVisitor) error {
 
 		//transaction per metric to avoid cross-metric locks
 		batch.Queue("BEGIN;")
-		batch.Queue(seriesInsertSQL, metricName, info.labelArraySet)
+		if isNew, ok := h.newSeries(info); ok {
+			batch.Queue(seriesInsertNewSQL, metricName, info.labelArraySet, isNew)
+		} else {
+			batch.Queue(seriesInsertSQL, metricName, info.labelArraySet)
+		}
 		batch.Queue("COMMIT;")
 		batchInfos = append(batchInfos, info)
 	}
@@ -164,6 +211,9 @@ func (h *seriesWriter) WriteSeries(sv SeriesVisitor) error {
 				return fmt.Errorf("error setting series_id: cannot scan series_id: %w", err)
 			}
 			info.series[int(ordinality)-1].SetSeriesID(id, dbEpoch)
+			if h.blooms != nil {
+				h.blooms.added(info.metricName, info.labelArrays[int(ordinality)-1])
+			}
 			count++
 		}
 		if err := res.Err(); err != nil {
@@ -183,6 +233,66 @@ func (h *seriesWriter) WriteSeries(sv SeriesVisitor) error {
 	return nil
 }
 
+// mergeLabels creates the missing labels of large batches, e.g. when the
+// pods of a deploy all come up with new labels, with a COPY and an INSERT
+// rather than a call to get_or_create_label_id for every label. The labels
+// are inserted in order in a single statement, so that concurrent merges do
+// not deadlock. The ids are fetched by fillLabelIDs afterwards.
+func (h *seriesWriter) mergeLabels(labelMap map[labelKey]labelInfo) error {
+	type label struct{ name, value string }
+	seen := make(map[label]struct{}, len(labelMap))
+	rows := make([][]interface{}, 0, len(labelMap))
+	for key := range labelMap {
+		l := label{key.Name, key.Value}
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		rows = append(rows, []interface{}{key.Name, key.Value})
+	}
+	if len(rows) < h.labelMergeBatch {
+		return nil
+	}
+	// The rows are copied in order, for the batches to be reproducible.
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][0].(string) != rows[j][0].(string) {
+			return rows[i][0].(string) < rows[j][0].(string)
+		}
+		return rows[i][1].(string) < rows[j][1].(string)
+	})
+
+	ctx := context.Background()
+	return h.conn.WithConn(ctx, func(conn pgxconn.PgxConn) (err error) {
+		if _, err = conn.Exec(ctx, "BEGIN;"); err != nil {
+			return fmt.Errorf("error merging labels on begin: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				_, _ = conn.Exec(ctx, "ROLLBACK;")
+			}
+		}()
+		// The table is created in the transaction, as the session may
+		// be a different one for each transaction behind a pooler.
+		createSQL := createLabelStagingSQL
+		if h.poolerMode {
+			createSQL = createDroppedLabelStagingSQL
+		}
+		if _, err = conn.Exec(ctx, createSQL); err != nil {
+			return fmt.Errorf("error merging labels: creating staging table: %w", err)
+		}
+		if _, err = conn.CopyFrom(ctx, pgx.Identifier{"pg_temp", labelStagingTable}, []string{"key", "value"}, conn.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("error merging labels: copying labels: %w", err)
+		}
+		if _, err = conn.Exec(ctx, mergeStagedLabelsSQL); err != nil {
+			return fmt.Errorf("error merging labels: %w", err)
+		}
+		if _, err = conn.Exec(ctx, "COMMIT;"); err != nil {
+			return fmt.Errorf("error merging labels on commit: %w", err)
+		}
+		return nil
+	})
+}
+
 func (h *seriesWriter) fillLabelIDs(infos map[string]*perMetricInfo, labelMap map[labelKey]labelInfo) (model.SeriesEpoch, error) {
 	//we cannot use the label cache here because that maps label ids => name, value.
 	//what we need here is name, value => id.
@@ -304,12 +414,27 @@ func (h *seriesWriter) buildLabelArrays(infos map[string]*perMetricInfo, labelMa
 			return fmt.Errorf("error setting series id: cannot set label_array: %w", err)
 		}
 		info.labelArraySetNumLabels = len(labelArraySet)
+		info.labelArrays = labelArraySet
 
 	}
 
 	return nil
 }
 
+// newSeries returns which series of the metric are definitely new, if any.
+func (h *seriesWriter) newSeries(info *perMetricInfo) ([]bool, bool) {
+	if h.blooms == nil {
+		return nil, false
+	}
+	isNew := make([]bool, len(info.labelArrays))
+	anyNew := false
+	for i, labelArray := range info.labelArrays {
+		isNew[i] = h.blooms.isNew(info.metricName, labelArray)
+		anyNew = anyNew || isNew[i]
+	}
+	return isNew, anyNew
+}
+
 func createLabelArrays(series []*model.Series, labelMap map[labelKey]labelInfo, maxPos int) ([][]int32, []*model.Series, error) {
 	labelArraySet := make([][]int32, 0, len(series))
 	dest := 0
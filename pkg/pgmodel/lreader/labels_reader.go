@@ -8,11 +8,13 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync"
 	"unsafe"
 
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
 	"github.com/timescale/promscale/pkg/pgmodel/model/pgutf8str"
 	"github.com/timescale/promscale/pkg/pgxconn"
@@ -22,6 +24,14 @@ const (
 	getLabelNamesSQL  = "SELECT distinct key from " + schema.Catalog + ".label"
 	getLabelValuesSQL = "SELECT value from " + schema.Catalog + ".label WHERE key = $1"
 	getLabelsSQL      = "SELECT (" + schema.Prom + ".labels_info($1::int[])).*"
+
+	// labelFetchBatchSize bounds the number of label ids looked up by a single
+	// statement, so that the labels of large query results are fetched by
+	// several smaller statements running in parallel.
+	labelFetchBatchSize = 5000
+	// maxLabelFetchConcurrency bounds the number of batches of a query result
+	// fetched at once, so that a single query does not take all the connections.
+	maxLabelFetchConcurrency = 4
 )
 
 // LabelsReader defines the methods for accessing labels data
@@ -35,12 +45,13 @@ type LabelsReader interface {
 }
 
 func NewLabelsReader(conn pgxconn.PgxConn, labels cache.LabelsCache) LabelsReader {
-	return &labelsReader{conn: conn, labels: labels}
+	return &labelsReader{conn: conn, labels: labels, batchSize: labelFetchBatchSize}
 }
 
 type labelsReader struct {
-	conn   pgxconn.PgxConn
-	labels cache.LabelsCache
+	conn      pgxconn.PgxConn
+	labels    cache.LabelsCache
+	batchSize int
 }
 
 // LabelValues implements the LabelsReader interface. It returns all distinct values
@@ -94,6 +105,8 @@ func (lr *labelsReader) LabelNames() ([]string, error) {
 }
 
 // LabelsForIdMap fills in the label.Label values in a map of label id => labels.Label.
+// If some ids are not found, the labels of the others are filled in and an
+// error wrapping errors.ErrMissingLabels is returned.
 func (lr *labelsReader) LabelsForIdMap(idMap map[int64]labels.Label) error {
 	numIds := len(idMap)
 	ids := make([]interface{}, numIds) //type int64
@@ -112,30 +125,88 @@ func (lr *labelsReader) LabelsForIdMap(idMap map[int64]labels.Label) error {
 		i++
 	}
 	numHits := lr.labels.GetValues(ids, lbs)
+	labelResolveCached.Add(float64(numHits))
 
+	var missing error
 	if numHits < numIds {
-		var (
-			numFetches int
-			err        error
-		)
-
-		missingIds := make([]int64, numIds-numHits)
-		numFetches, err = lr.fetchMissingLabels(ids[numHits:], missingIds, lbs[numHits:])
+		numFetches, err := lr.fetchMissingLabelsInBatches(ids[numHits:], lbs[numHits:])
 		if err != nil {
 			return err
 		}
 		if numFetches+numHits != numIds {
-			return fmt.Errorf("missing labels: total %v, fetches %v hits %v", numIds, numFetches, numHits)
+			missing = fmt.Errorf("%w: total %v, fetches %v hits %v", errors.ErrMissingLabels, numIds, numFetches, numHits)
 		}
 	}
 
+	// The labels of the ids that were not found, e.g. because they were
+	// deleted, are left empty.
 	for i := range ids {
-		label := lbs[i].(labels.Label)
+		label, ok := lbs[i].(labels.Label)
+		if !ok {
+			continue
+		}
 		id := ids[i].(int64)
 		idMap[id] = label
 	}
 
-	return nil
+	return missing
+}
+
+// fetchMissingLabelsInBatches fetches the missing label IDs in batches of at
+// most batchSize ids, running up to maxLabelFetchConcurrency batches at once.
+// Each batch fills its own range of misses and newLabels.
+func (lr *labelsReader) fetchMissingLabelsInBatches(misses []interface{}, newLabels []interface{}) (numNewLabels int, err error) {
+	batches := splitBatches(len(misses), lr.batchSize)
+	labelResolveBatches.Observe(float64(len(batches)))
+	labelResolveFetched.Add(float64(len(misses)))
+	missedIds := make([]int64, len(misses))
+	if len(batches) == 1 {
+		return lr.fetchMissingLabels(misses, missedIds, newLabels)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxLabelFetchConcurrency)
+		fetched = make([]int, len(batches))
+		errs    = make([]error, len(batches))
+	)
+	for i, b := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, start, end int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fetched[i], errs[i] = lr.fetchMissingLabels(misses[start:end], missedIds[start:end], newLabels[start:end])
+		}(i, b[0], b[1])
+	}
+	wg.Wait()
+
+	for i := range batches {
+		if errs[i] != nil {
+			return 0, errs[i]
+		}
+		numNewLabels += fetched[i]
+	}
+	return numNewLabels, nil
+}
+
+// splitBatches returns the [start, end) ranges splitting n items in batches of
+// at most size items.
+func splitBatches(n, size int) [][2]int {
+	if size <= 0 {
+		size = n
+	}
+	batches := make([][2]int, 0, (n+size-1)/size)
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		batches = append(batches, [2]int{start, end})
+	}
+	return batches
 }
 
 // fetchMissingLabels imports the missing label IDs from the database into the
@@ -186,3 +186,21 @@ func TestLabelsReaderLabelsValues(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitBatches(t *testing.T) {
+	testCases := []struct {
+		n, size  int
+		expected [][2]int
+	}{
+		{n: 0, size: 3, expected: [][2]int{}},
+		{n: 2, size: 3, expected: [][2]int{{0, 2}}},
+		{n: 6, size: 3, expected: [][2]int{{0, 3}, {3, 6}}},
+		{n: 7, size: 3, expected: [][2]int{{0, 3}, {3, 6}, {6, 7}}},
+		{n: 7, size: 0, expected: [][2]int{{0, 7}}},
+	}
+	for _, c := range testCases {
+		if got := splitBatches(c.n, c.size); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("splitBatches(%d, %d) = %v, expected %v", c.n, c.size, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package lreader
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+var (
+	labelResolveCached = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Name:      "query_label_resolve_cached_total",
+			Help:      "Total number of label ids of query results resolved from the labels cache.",
+		},
+	)
+	labelResolveFetched = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Name:      "query_label_resolve_fetched_total",
+			Help:      "Total number of label ids of query results fetched from the database.",
+		},
+	)
+	labelResolveBatches = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: util.PromNamespace,
+			Name:      "query_label_resolve_batches",
+			Help:      "Number of batches the label ids missing from the labels cache are fetched in, per query result.",
+			Buckets:   []float64{1, 2, 4, 8, 16, 32, 64},
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(labelResolveCached, labelResolveFetched, labelResolveBatches)
+}
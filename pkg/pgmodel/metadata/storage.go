@@ -0,0 +1,123 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// metricStorageSQL fetches the storage layout of every metric. The type is
+// taken from the most recently seen metadata of the metric family, which for
+// histograms and summaries is named without the suffix of the series.
+const metricStorageSQL = `SELECT
+	m.metric_name,
+	m.table_name,
+	m.retention_period::text,
+	m.chunk_interval::text,
+	` + schema.Catalog + `.get_metric_compression_setting(m.metric_name),
+	c.sparse,
+	COALESCE(m.total_chunks, 0),
+	COALESCE(m.compressed_chunks, 0),
+	COALESCE(s.num_series_approx, 0),
+	COALESCE(md.type, '')
+FROM ` + schema.Info + `.metric m
+INNER JOIN ` + schema.Catalog + `.metric c ON (c.id = m.id)
+LEFT JOIN ` + schema.Info + `.metric_stats s ON (s.metric_name = m.metric_name)
+LEFT JOIN LATERAL (
+	SELECT type
+	FROM ` + schema.Catalog + `.metadata
+	WHERE metric_family IN (m.metric_name, regexp_replace(m.metric_name, '_(bucket|sum|count|total)$', ''))
+	ORDER BY last_seen DESC
+	LIMIT 1
+) md ON (true)
+ORDER BY m.metric_name`
+
+// MetricStorage describes how a metric is stored in the database.
+type MetricStorage struct {
+	Metric           string   `json:"metric"`
+	Table            string   `json:"table"`
+	Type             string   `json:"type,omitempty"`
+	Retention        string   `json:"retention"`
+	ChunkInterval    string   `json:"chunkInterval,omitempty"`
+	Compressed       bool     `json:"compressed"`
+	Sparse           bool     `json:"sparse"`
+	TotalChunks      int64    `json:"totalChunks"`
+	CompressedChunks int64    `json:"compressedChunks"`
+	SeriesCount      int64    `json:"seriesCount"`
+	AggregationHints []string `json:"aggregationHints"`
+}
+
+// MetricStorageQuery returns the storage layout of all the metrics, ordered
+// by metric name.
+func MetricStorageQuery(conn pgxconn.PgxConn) ([]MetricStorage, error) {
+	rows, err := conn.Query(context.Background(), metricStorageSQL)
+	if err != nil {
+		return nil, fmt.Errorf("query metric storage: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]MetricStorage, 0)
+	for rows.Next() {
+		var (
+			m             MetricStorage
+			retention     *string
+			chunkInterval *string
+		)
+		if err := rows.Scan(&m.Metric, &m.Table, &retention, &chunkInterval, &m.Compressed, &m.Sparse, &m.TotalChunks, &m.CompressedChunks, &m.SeriesCount, &m.Type); err != nil {
+			return nil, fmt.Errorf("query result: %w", err)
+		}
+		if retention != nil {
+			m.Retention = *retention
+		}
+		if chunkInterval != nil {
+			m.ChunkInterval = *chunkInterval
+		}
+		m.AggregationHints = aggregationHints(m.Metric, m.Type)
+		result = append(result, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query result: %w", err)
+	}
+	return result, nil
+}
+
+// aggregationHints returns the PromQL functions that are usually meaningful
+// for a metric, based on its type. Without metadata the type is guessed from
+// the naming conventions of Prometheus.
+func aggregationHints(metric, typ string) []string {
+	switch {
+	case typ == "":
+		switch {
+		case strings.HasSuffix(metric, "_total"):
+			typ = "counter"
+		case strings.HasSuffix(metric, "_bucket"):
+			typ = "histogram"
+		}
+	case typ == "histogram" || typ == "summary":
+		// The _sum and _count series of histograms and summaries are counters.
+		if strings.HasSuffix(metric, "_sum") || strings.HasSuffix(metric, "_count") {
+			typ = "counter"
+		}
+	}
+
+	switch typ {
+	case "counter":
+		return []string{"rate", "increase"}
+	case "histogram":
+		if strings.HasSuffix(metric, "_bucket") {
+			return []string{"histogram_quantile", "rate"}
+		}
+		return []string{"rate"}
+	case "summary":
+		return []string{"avg_over_time"}
+	default:
+		return []string{"avg_over_time", "max_over_time", "min_over_time"}
+	}
+}
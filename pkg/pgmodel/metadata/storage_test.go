@@ -0,0 +1,32 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregationHints(t *testing.T) {
+	testCases := []struct {
+		metric string
+		typ    string
+		hints  []string
+	}{
+		{"http_requests_total", "counter", []string{"rate", "increase"}},
+		{"http_requests_total", "", []string{"rate", "increase"}},
+		{"memory_bytes", "gauge", []string{"avg_over_time", "max_over_time", "min_over_time"}},
+		{"memory_bytes", "", []string{"avg_over_time", "max_over_time", "min_over_time"}},
+		{"latency_seconds_bucket", "histogram", []string{"histogram_quantile", "rate"}},
+		{"latency_seconds_bucket", "", []string{"histogram_quantile", "rate"}},
+		{"latency_seconds_sum", "histogram", []string{"rate", "increase"}},
+		{"rpc_seconds_count", "summary", []string{"rate", "increase"}},
+		{"rpc_seconds", "summary", []string{"avg_over_time"}},
+	}
+	for _, c := range testCases {
+		require.Equal(t, c.hints, aggregationHints(c.metric, c.typ), "%s of type %q", c.metric, c.typ)
+	}
+}
@@ -0,0 +1,120 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// The cardinality statistics are counted exactly from the catalog tables,
+// leaving out the series marked for deletion. The label table also holds the
+// labels of these series until they are deleted.
+const (
+	tsdbHeadStatsSQL = `SELECT
+	(SELECT count(*) FROM ` + schema.Catalog + `.series WHERE delete_epoch IS NULL),
+	(SELECT count(*) FROM ` + schema.Catalog + `.label),
+	(SELECT COALESCE(sum(total_chunks), 0)::BIGINT FROM ` + schema.Info + `.metric)`
+
+	seriesCountByMetricNameSQL = `SELECT m.metric_name, count(*)
+FROM ` + schema.Catalog + `.series s
+INNER JOIN ` + schema.Catalog + `.metric m ON (m.id = s.metric_id)
+WHERE s.delete_epoch IS NULL
+GROUP BY m.metric_name
+ORDER BY count(*) DESC, m.metric_name
+LIMIT $1`
+
+	labelValueCountByLabelNameSQL = `SELECT key, count(*)
+FROM ` + schema.Catalog + `.label
+GROUP BY key
+ORDER BY count(*) DESC, key
+LIMIT $1`
+
+	memoryInBytesByLabelNameSQL = `SELECT key, sum(octet_length(value))::BIGINT
+FROM ` + schema.Catalog + `.label
+GROUP BY key
+ORDER BY 2 DESC, key
+LIMIT $1`
+
+	seriesCountByLabelValuePairSQL = `SELECT l.key || '=' || l.value, count(*)
+FROM ` + schema.Catalog + `.series s
+CROSS JOIN LATERAL unnest(s.labels) AS lbl(id)
+INNER JOIN ` + schema.Catalog + `.label l ON (l.id = lbl.id)
+WHERE s.delete_epoch IS NULL
+GROUP BY l.key, l.value
+ORDER BY count(*) DESC, l.key, l.value
+LIMIT $1`
+)
+
+// TSDBStat is a name with its count, in the format of the TSDB status of
+// Prometheus.
+type TSDBStat struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// HeadStats holds the totals of the TSDB status. The time range of the
+// samples is not reported, since it cannot be known without reading them.
+type HeadStats struct {
+	NumSeries     int64 `json:"numSeries"`
+	NumLabelPairs int64 `json:"numLabelPairs"`
+	ChunkCount    int64 `json:"chunkCount"`
+}
+
+// TSDBStatus holds the cardinality statistics of the database, in the format
+// of the TSDB status of Prometheus.
+type TSDBStatus struct {
+	HeadStats                   HeadStats  `json:"headStats"`
+	SeriesCountByMetricName     []TSDBStat `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []TSDBStat `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []TSDBStat `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []TSDBStat `json:"seriesCountByLabelValuePair"`
+}
+
+// TSDBStatusQuery returns the total number of series, label pairs and chunks
+// and the limit metrics, label names and label pairs with the most series or
+// values.
+func TSDBStatusQuery(ctx context.Context, conn pgxconn.PgxConn, limit int) (*TSDBStatus, error) {
+	status := &TSDBStatus{}
+	h := &status.HeadStats
+	if err := conn.QueryRow(ctx, tsdbHeadStatsSQL).Scan(&h.NumSeries, &h.NumLabelPairs, &h.ChunkCount); err != nil {
+		return nil, fmt.Errorf("query head stats: %w", err)
+	}
+	var err error
+	if status.SeriesCountByMetricName, err = tsdbStats(ctx, conn, seriesCountByMetricNameSQL, limit); err != nil {
+		return nil, fmt.Errorf("query series count by metric name: %w", err)
+	}
+	if status.LabelValueCountByLabelName, err = tsdbStats(ctx, conn, labelValueCountByLabelNameSQL, limit); err != nil {
+		return nil, fmt.Errorf("query label value count by label name: %w", err)
+	}
+	if status.MemoryInBytesByLabelName, err = tsdbStats(ctx, conn, memoryInBytesByLabelNameSQL, limit); err != nil {
+		return nil, fmt.Errorf("query memory in bytes by label name: %w", err)
+	}
+	if status.SeriesCountByLabelValuePair, err = tsdbStats(ctx, conn, seriesCountByLabelValuePairSQL, limit); err != nil {
+		return nil, fmt.Errorf("query series count by label value pair: %w", err)
+	}
+	return status, nil
+}
+
+func tsdbStats(ctx context.Context, conn pgxconn.PgxConn, sql string, limit int) ([]TSDBStat, error) {
+	rows, err := conn.Query(ctx, sql, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]TSDBStat, 0, limit)
+	for rows.Next() {
+		var s TSDBStat
+		if err := rows.Scan(&s.Name, &s.Value); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,33 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestTSDBStatusQuery(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: tsdbHeadStatsSQL, Results: model.RowResults{{int64(120), int64(45), int64(8)}}},
+		{Sql: seriesCountByMetricNameSQL, Args: []interface{}{2}, Results: model.RowResults{{"http_requests_total", int64(100)}, {"up", int64(20)}}},
+		{Sql: labelValueCountByLabelNameSQL, Args: []interface{}{2}, Results: model.RowResults{{"pod", int64(30)}, {"__name__", int64(2)}}},
+		{Sql: memoryInBytesByLabelNameSQL, Args: []interface{}{2}, Results: model.RowResults{{"pod", int64(600)}, {"__name__", int64(21)}}},
+		{Sql: seriesCountByLabelValuePairSQL, Args: []interface{}{2}, Results: model.RowResults{}},
+	}, t)
+
+	status, err := TSDBStatusQuery(context.Background(), mock, 2)
+	require.NoError(t, err)
+	require.Equal(t, &TSDBStatus{
+		HeadStats:                   HeadStats{NumSeries: 120, NumLabelPairs: 45, ChunkCount: 8},
+		SeriesCountByMetricName:     []TSDBStat{{"http_requests_total", 100}, {"up", 20}},
+		LabelValueCountByLabelName:  []TSDBStat{{"pod", 30}, {"__name__", 2}},
+		MemoryInBytesByLabelName:    []TSDBStat{{"pod", 600}, {"__name__", 21}},
+		SeriesCountByLabelValuePair: []TSDBStat{},
+	}, status)
+}
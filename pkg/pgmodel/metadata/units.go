@@ -0,0 +1,41 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// unitSQL selects the most recent unit of the family of a metric, which is
+// the metric itself or, for the sums of histograms and summaries and for
+// counters, the metric without its suffix.
+const unitSQL = `SELECT unit FROM ` + schema.Catalog + `.metadata
+WHERE metric_family IN ($1, regexp_replace($1, '_(sum|total)$', '')) AND unit <> ''
+ORDER BY last_seen DESC
+LIMIT 1`
+
+// Unit returns the unit of the values of the metric from the stored metadata,
+// or "" if the metadata has none. The buckets and counts of histograms and
+// summaries have no unit, as they are numbers of observations.
+func Unit(ctx context.Context, conn pgxconn.PgxConn, metric string) (string, error) {
+	if strings.HasSuffix(metric, "_bucket") || strings.HasSuffix(metric, "_count") {
+		return "", nil
+	}
+	var unit string
+	err := conn.QueryRow(ctx, unitSQL, metric).Scan(&unit)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query unit of metric %s: %w", metric, err)
+	}
+	return unit, nil
+}
@@ -0,0 +1,32 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestUnit(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: unitSQL, Args: []interface{}{"request_duration_sum"}, Results: model.RowResults{{"seconds"}}},
+		{Sql: unitSQL, Args: []interface{}{"up"}, Err: pgx.ErrNoRows},
+	}, t)
+	for _, c := range []struct{ metric, unit string }{
+		{"request_duration_sum", "seconds"},
+		{"up", ""},
+		// The buckets and counts are not looked up.
+		{"request_duration_bucket", ""},
+		{"request_duration_count", ""},
+	} {
+		unit, err := Unit(context.Background(), mock, c.metric)
+		require.NoError(t, err)
+		require.Equal(t, c.unit, unit, c.metric)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/common/extension"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/version"
 )
 
 const (
@@ -36,6 +37,7 @@ const (
 
 	preinstallScripts = "preinstall"
 	versionScripts    = "versions/dev"
+	downgradeScripts  = "down/dev"
 	idempotentScripts = "idempotent"
 )
 
@@ -107,6 +109,27 @@ func Migrate(db *pgx.Conn, versionInfo VersionInfo, extOptions extension.Extensi
 	return nil
 }
 
+// Downgrade reverts the database schema to an earlier version by applying the
+// down-migrations of all the versions above it.
+func Downgrade(db *pgx.Conn, toVersion string) error {
+	migrateMutex.Lock()
+	defer migrateMutex.Unlock()
+
+	to, err := semver.Make(toVersion)
+	if err != nil {
+		return errors.ErrInvalidSemverFormat
+	}
+
+	mig := NewMigrator(db, migrations.MigrationFiles, tableOfContets)
+
+	err = mig.Downgrade(to)
+	if err != nil {
+		return fmt.Errorf("Error encountered during downgrade: %w", err)
+	}
+
+	return nil
+}
+
 // CheckDependencies makes sure all project dependencies, including the DB schema
 // the extension, are set up correctly. This will set the ExtensionIsInstalled
 // flag and thus should only be called once, at initialization.
@@ -117,7 +140,10 @@ func CheckDependencies(db *pgx.Conn, versionInfo VersionInfo, migrationFailedDue
 	return extension.CheckVersions(db, migrationFailedDueToLockError, extOptions)
 }
 
-// CheckSchemaVersion checks the DB schema version without checking the extension
+// CheckSchemaVersion checks the DB schema version without checking the extension.
+// Schemas older than the expected version are accepted down to
+// version.EarliestCompatibleSchema, so that connectors can be upgraded while
+// the database is still on the previous version.
 func CheckSchemaVersion(ctx context.Context, conn *pgx.Conn, versionInfo VersionInfo, migrationFailedDueToLockError bool) error {
 	expectedVersion := semver.MustParse(versionInfo.Version)
 	dbVersion, err := getSchemaVersionOnConnection(ctx, conn)
@@ -125,6 +151,9 @@ func CheckSchemaVersion(ctx context.Context, conn *pgx.Conn, versionInfo Version
 		return fmt.Errorf("failed to check schema version: %w", err)
 	}
 	if versionCompare := dbVersion.Compare(expectedVersion); versionCompare != 0 {
+		if versionCompare < 0 && isCompatibleSchema(dbVersion) {
+			return nil
+		}
 		if versionCompare < 0 && migrationFailedDueToLockError {
 			return fmt.Errorf("Failed to acquire the migration lock to upgrade the schema version and unable to run with the old version. Please ensure that no other Promscale connectors with the old schema version are running. Received schema version %v but expected %v", dbVersion, expectedVersion)
 		}
@@ -133,6 +162,12 @@ func CheckSchemaVersion(ctx context.Context, conn *pgx.Conn, versionInfo Version
 	return nil
 }
 
+// isCompatibleSchema returns whether the connector can run against the schema
+// of an older version.
+func isCompatibleSchema(dbVersion semver.Version) bool {
+	return dbVersion.GTE(semver.MustParse(version.EarliestCompatibleSchema))
+}
+
 type Migrator struct {
 	db       *pgx.Conn
 	sqlFiles http.FileSystem
@@ -217,6 +252,46 @@ func (t *Migrator) Migrate(appVersion semver.Version) error {
 	return nil
 }
 
+// Downgrade reverts the schema to the version `to` in a single transaction.
+// The idempotent scripts are not applied: the down-migrations drop the
+// functions that only exist in the newer versions, and the functions changed
+// by them are replaced when a connector of the older, development version
+// reapplies its idempotent scripts at startup.
+func (t *Migrator) Downgrade(to semver.Version) error {
+	dbVersion, err := getSchemaVersion(t.db)
+	if err != nil {
+		return fmt.Errorf("failed to get the version from database: %w", err)
+	}
+
+	switch dbVersion.Compare(to) {
+	case 0:
+		return nil
+	case -1:
+		return fmt.Errorf("schema version (%v) is below the downgrade version (%v), cannot downgrade", dbVersion, to)
+	}
+
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	if err = t.downgradeVersion(tx, dbVersion, to); err != nil {
+		return err
+	}
+	if err = setDBVersion(tx, &to); err != nil {
+		return fmt.Errorf("error setting downgraded version to DB: %w", err)
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("unable to commit downgrade transaction: %w", err)
+	}
+
+	return nil
+}
+
 func ensureVersionTable(db *pgx.Conn) error {
 	_, err := db.Exec(context.Background(), createMigrationsTable)
 	if err != nil {
@@ -384,8 +459,10 @@ func replaceSchemaNames(r io.ReadCloser) (string, error) {
 	s = strings.ReplaceAll(s, "SCHEMA_PROM", schema.Prom)
 	s = strings.ReplaceAll(s, "SCHEMA_TIMESCALE", schema.Timescale)
 	s = strings.ReplaceAll(s, "SCHEMA_SERIES", schema.SeriesView)
+	s = strings.ReplaceAll(s, "SCHEMA_METRIC_LABELED", schema.MetricLabeledView)
 	s = strings.ReplaceAll(s, "SCHEMA_METRIC", schema.MetricView)
 	s = strings.ReplaceAll(s, "SCHEMA_DATA_SERIES", schema.DataSeries)
+	s = strings.ReplaceAll(s, "SCHEMA_DATA_SHARDED", schema.DataSharded)
 	s = strings.ReplaceAll(s, "SCHEMA_DATA", schema.Data)
 	s = strings.ReplaceAll(s, "SCHEMA_INFO", schema.Info)
 	s = strings.ReplaceAll(s, "ADVISORY_LOCK_PREFIX_JOB", "12377")
@@ -425,14 +502,70 @@ func (t *Migrator) getMigrationFileVersion(dirName string, fileName string) (*se
 // upgradeVersion finds all the versions between `from` and `to`, sorts them
 // using semantic version ordering and applies them sequentially in the supplied transaction.
 func (t *Migrator) upgradeVersion(tx pgx.Tx, from, to semver.Version) error {
-	devDirFile, err := t.sqlFiles.Open(versionScripts)
+	versions, versionMap, err := t.getMigrationFiles(versionScripts)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		//When comparing to the latest version use >= (INCLUSIVE). A migration file
+		//that's marked as version X is part of that version
+		if from.Compare(v) < 0 && to.Compare(v) >= 0 {
+			filename := versionMap[v.String()]
+			if err = t.execMigrationFile(tx, filename); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// downgradeVersion reverts the migrations of all the versions above `to` up
+// to and including `from`, in reverse semantic version order, by applying the
+// down-migration of each of them in the supplied transaction. It fails before
+// applying anything if one of them has no down-migration.
+func (t *Migrator) downgradeVersion(tx pgx.Tx, from, to semver.Version) error {
+	versions, _, err := t.getMigrationFiles(versionScripts)
+	if err != nil {
+		return err
+	}
+	_, downMap, err := t.getMigrationFiles(downgradeScripts)
+	if err != nil {
+		return err
+	}
+
+	filenames := make([]string, 0)
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if to.Compare(v) < 0 && from.Compare(v) >= 0 {
+			filename, ok := downMap[v.String()]
+			if !ok {
+				return fmt.Errorf("no down-migration for schema version %v, cannot downgrade below it", v)
+			}
+			filenames = append(filenames, filename)
+		}
+	}
+
+	for _, filename := range filenames {
+		if err = t.execMigrationFile(tx, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getMigrationFiles returns the versions of the migration files found in the
+// version subdirectories of dirName, sorted using semantic version ordering,
+// and the path of the file of each version.
+func (t *Migrator) getMigrationFiles(dirName string) (semver.Versions, map[string]string, error) {
+	devDirFile, err := t.sqlFiles.Open(dirName)
 	if err != nil {
-		return fmt.Errorf("unable to open %v directory: %w", versionScripts, err)
+		return nil, nil, fmt.Errorf("unable to open %v directory: %w", dirName, err)
 	}
 
 	versionDirInfoEntries, err := devDirFile.Readdir(-1)
 	if err != nil {
-		return fmt.Errorf("unable to get %v directory entries: %w", versionScripts, err)
+		return nil, nil, fmt.Errorf("unable to get %v directory entries: %w", dirName, err)
 	}
 
 	versions := make(semver.Versions, 0)
@@ -443,30 +576,30 @@ func (t *Migrator) upgradeVersion(tx pgx.Tx, from, to semver.Version) error {
 			if versionDirInfo.Name() == ".gitignore" {
 				continue
 			}
-			return fmt.Errorf("Not a directory inside %v: %v", versionScripts, versionDirInfo.Name())
+			return nil, nil, fmt.Errorf("Not a directory inside %v: %v", dirName, versionDirInfo.Name())
 		}
 
-		versionDirPath := versionScripts + "/" + versionDirInfo.Name()
+		versionDirPath := dirName + "/" + versionDirInfo.Name()
 		versionDirFile, err := t.sqlFiles.Open(versionDirPath)
 		if err != nil {
-			return fmt.Errorf("unable to open migration scripts inside %v: %w", versionDirPath, err)
+			return nil, nil, fmt.Errorf("unable to open migration scripts inside %v: %w", versionDirPath, err)
 		}
 
 		migrationFileInfoEntries, err := versionDirFile.Readdir(-1)
 		if err != nil {
-			return fmt.Errorf("unable to get %v directory entries: %w", versionDirPath, err)
+			return nil, nil, fmt.Errorf("unable to get %v directory entries: %w", versionDirPath, err)
 		}
 
 		for _, migrationFileInfo := range migrationFileInfoEntries {
 			migrationFileVersion, err := t.getMigrationFileVersion(versionDirInfo.Name(), migrationFileInfo.Name())
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 			migrationFilePath := versionDirPath + "/" + migrationFileInfo.Name()
 
 			_, existing := versionMap[migrationFileVersion.String()]
 			if existing {
-				return fmt.Errorf("Found two migration files with the same version: %v", migrationFileVersion.String())
+				return nil, nil, fmt.Errorf("Found two migration files with the same version: %v", migrationFileVersion.String())
 			}
 			versionMap[migrationFileVersion.String()] = migrationFilePath
 			versions = append(versions, *migrationFileVersion)
@@ -474,18 +607,7 @@ func (t *Migrator) upgradeVersion(tx pgx.Tx, from, to semver.Version) error {
 	}
 
 	sort.Sort(versions)
-
-	for _, v := range versions {
-		//When comparing to the latest version use >= (INCLUSIVE). A migration file
-		//that's marked as version X is part of that version
-		if from.Compare(v) < 0 && to.Compare(v) >= 0 {
-			filename := versionMap[v.String()]
-			if err = t.execMigrationFile(tx, filename); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	return versions, versionMap, nil
 }
 
 func setDBVersion(tx pgx.Tx, version *semver.Version) error {
@@ -0,0 +1,47 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgmodel
+
+import (
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/migrations"
+	"github.com/timescale/promscale/pkg/version"
+)
+
+func TestDownMigrations(t *testing.T) {
+	mig := NewMigrator(nil, migrations.MigrationFiles, tableOfContets)
+	versions, _, err := mig.getMigrationFiles(versionScripts)
+	require.NoError(t, err)
+	downVersions, _, err := mig.getMigrationFiles(downgradeScripts)
+	require.NoError(t, err)
+
+	up := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		up[v.String()] = true
+	}
+	down := make(map[string]bool, len(downVersions))
+	for _, v := range downVersions {
+		require.True(t, up[v.String()], "down-migration %v has no matching migration", v)
+		down[v.String()] = true
+	}
+
+	// The connector is only compatible with the schema before the last
+	// migration, which must be bumped with each migration.
+	require.True(t, len(versions) >= 2)
+	require.Equal(t, versions[len(versions)-2].String(), version.EarliestCompatibleSchema,
+		"EarliestCompatibleSchema must be the version before the last migration")
+
+	// The schema must be downgradable to every version the connector is
+	// compatible with.
+	earliest := semver.MustParse(version.EarliestCompatibleSchema)
+	for _, v := range versions {
+		if v.GT(earliest) {
+			require.True(t, down[v.String()], "migration %v has no down-migration", v)
+		}
+	}
+}
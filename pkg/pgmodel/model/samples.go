@@ -21,7 +21,9 @@ type Metadata struct {
 
 type Samples interface {
 	GetSeries() *Series
+	GetExemplars() []prompb.Exemplar
 	CountSamples() int
+	FirstSample() prompb.Sample
 	LastSample() prompb.Sample
 	getSample(int) *prompb.Sample
 }
@@ -31,25 +33,44 @@ type Samples interface {
 type Data struct {
 	Rows         map[string][]Samples
 	ReceivedTime time.Time
+	// AsyncCommit is set if the samples can be committed without waiting
+	// for the commit to be flushed to disk.
+	AsyncCommit bool
 }
 
 type promSample struct {
-	series  *Series
-	samples []prompb.Sample
+	series    *Series
+	samples   []prompb.Sample
+	exemplars []prompb.Exemplar
 }
 
 func NewPromSample(series *Series, samples []prompb.Sample) *promSample {
-	return &promSample{series, samples}
+	return &promSample{series: series, samples: samples}
+}
+
+// NewPromSampleWithExemplars returns the samples of the series along with its
+// exemplars, which are inserted in the same transaction. A series can have
+// exemplars without samples.
+func NewPromSampleWithExemplars(series *Series, samples []prompb.Sample, exemplars []prompb.Exemplar) *promSample {
+	return &promSample{series: series, samples: samples, exemplars: exemplars}
 }
 
 func (t *promSample) GetSeries() *Series {
 	return t.series
 }
 
+func (t *promSample) GetExemplars() []prompb.Exemplar {
+	return t.exemplars
+}
+
 func (t *promSample) CountSamples() int {
 	return len(t.samples)
 }
 
+func (t *promSample) FirstSample() prompb.Sample {
+	return t.samples[0]
+}
+
 func (t *promSample) LastSample() prompb.Sample {
 	return t.samples[len(t.samples)-1]
 }
@@ -121,7 +142,8 @@ func (t *SamplesBatch) ResetPosition() {
 // has occurred it returns false.
 func (t *SamplesBatch) Next() bool {
 	t.sampleIndex++
-	if t.seriesIndex < len(t.seriesSamples) && t.sampleIndex >= t.seriesSamples[t.seriesIndex].CountSamples() {
+	// The series only sent with exemplars have no samples to skip to.
+	for t.seriesIndex < len(t.seriesSamples) && t.sampleIndex >= t.seriesSamples[t.seriesIndex].CountSamples() {
 		t.seriesIndex++
 		t.sampleIndex = 0
 	}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -86,12 +87,32 @@ func (r *SqlRecorder) QueryRow(ctx context.Context, sql string, args ...interfac
 	return &MockRows{results: rows, err: err}
 }
 
+// CopyFrom is recorded as a "COPY <table> (<columns>)" query whose
+// arguments are the copied rows.
 func (r *SqlRecorder) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
-	panic("should never be called")
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var rows []interface{}
+	for rowSrc.Next() {
+		values, err := rowSrc.Values()
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, values)
+	}
+	_, err := r.checkQuery(fmt.Sprintf("COPY %s (%s)", tableName.Sanitize(), strings.Join(columnNames, ", ")), rows...)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
 }
 
 func (r *SqlRecorder) CopyFromRows(rows [][]interface{}) pgx.CopyFromSource {
-	panic("should never be called")
+	return pgx.CopyFromRows(rows)
+}
+
+func (r *SqlRecorder) WithConn(ctx context.Context, fn func(conn pgxconn.PgxConn) error) error {
+	return fn(r)
 }
 
 func (r *SqlRecorder) NewBatch() pgxconn.PgxBatch {
@@ -309,6 +330,12 @@ func (m *MockRows) Scan(dest ...interface{}) error {
 				}
 				continue
 			}
+			if d, ok := dest[i].(interface{ Set(src interface{}) error }); ok {
+				if err := d.Set(s); err != nil {
+					return err
+				}
+				continue
+			}
 			return fmt.Errorf("wrong value type []int64")
 		case []int32:
 			if d, ok := dest[i].(*[]int32); ok {
@@ -350,7 +377,7 @@ func (m *MockRows) Scan(dest ...interface{}) error {
 				*d = s
 			}
 		case float64:
-			if _, ok := dest[i].(float64); !ok {
+			if _, ok := dest[i].(*float64); !ok {
 				return fmt.Errorf("wrong value type float64")
 			}
 			dv := reflect.ValueOf(dest[i])
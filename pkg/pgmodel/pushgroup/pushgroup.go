@@ -0,0 +1,175 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package pushgroup stores the latest values of the groups of metrics pushed
+// by batch jobs, which stay current until the group is pushed again or
+// deleted, like the metrics of a Pushgateway.
+package pushgroup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	replaceSQL = "SELECT " + schema.Catalog + ".replace_push_group($1::jsonb, $2, $3::text[], $4::text[]::jsonb[], $5::timestamptz[], $6::float8[])"
+	deleteSQL  = "SELECT " + schema.Catalog + ".delete_push_group($1::jsonb)"
+	querySQL   = `SELECT g.group_labels::text, g.last_push, m.metric_name, m.labels::text, m.time, m.value
+FROM ` + schema.Catalog + `.push_group g
+INNER JOIN ` + schema.Catalog + `.push_group_metric m ON (m.group_labels = g.group_labels)
+ORDER BY g.group_labels, m.metric_name, m.labels`
+)
+
+// Group is a group of pushed metrics, identified by its grouping labels.
+type Group struct {
+	Labels   map[string]string `json:"labels"`
+	LastPush time.Time         `json:"lastPush"`
+	Metrics  []Metric          `json:"metrics"`
+}
+
+// Metric is the latest value of a pushed series.
+type Metric struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+}
+
+// MarshalJSON encodes the value as a string, like the Prometheus API does,
+// since JSON numbers cannot represent NaN and infinities.
+func (m Metric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Labels    map[string]string `json:"labels"`
+		Timestamp int64             `json:"timestamp"`
+		Value     string            `json:"value"`
+	}{m.Labels, m.Timestamp, strconv.FormatFloat(m.Value, 'f', -1, 64)})
+}
+
+// Replace records the latest values of the series pushed to the group. All
+// the values of the group are replaced if replaceAll is set, otherwise only
+// those of the metrics that are pushed again. The labels of the series hold
+// their metric name.
+func Replace(conn pgxconn.PgxConn, group map[string]string, replaceAll bool, series []Metric) error {
+	groupLabels, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	var (
+		names  = make([]string, 0, len(series))
+		labels = make([]string, 0, len(series))
+		times  = make([]time.Time, 0, len(series))
+		values = make([]float64, 0, len(series))
+	)
+	for _, s := range series {
+		seriesLabels := make(map[string]string, len(s.Labels))
+		for name, v := range s.Labels {
+			if name != model.MetricNameLabelName {
+				seriesLabels[name] = v
+			}
+		}
+		encoded, err := json.Marshal(seriesLabels)
+		if err != nil {
+			return err
+		}
+		names = append(names, s.Labels[model.MetricNameLabelName])
+		labels = append(labels, string(encoded))
+		times = append(times, timestamp.Time(s.Timestamp))
+		values = append(values, s.Value)
+	}
+	if _, err = conn.Exec(context.Background(), replaceSQL, string(groupLabels), replaceAll, names, labels, times, values); err != nil {
+		return fmt.Errorf("replace push group %s: %w", groupLabels, err)
+	}
+	return nil
+}
+
+// Delete deletes the group and the latest values of its series. It returns
+// false if the group did not exist.
+func Delete(conn pgxconn.PgxConn, group map[string]string) (bool, error) {
+	groupLabels, err := json.Marshal(group)
+	if err != nil {
+		return false, err
+	}
+	var found bool
+	if err = conn.QueryRow(context.Background(), deleteSQL, string(groupLabels)).Scan(&found); err != nil {
+		return false, fmt.Errorf("delete push group %s: %w", groupLabels, err)
+	}
+	return found, nil
+}
+
+// Query returns all the groups with the latest values of their series.
+func Query(conn pgxconn.PgxConn) ([]Group, error) {
+	rows, err := conn.Query(context.Background(), querySQL)
+	if err != nil {
+		return nil, fmt.Errorf("query push groups: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		result       = make([]Group, 0)
+		currentGroup string
+	)
+	for rows.Next() {
+		var (
+			groupLabels, metricName, labels string
+			lastPush, sampleTime            time.Time
+			sampleValue                     float64
+		)
+		if err := rows.Scan(&groupLabels, &lastPush, &metricName, &labels, &sampleTime, &sampleValue); err != nil {
+			return nil, fmt.Errorf("query result: %w", err)
+		}
+		if len(result) == 0 || groupLabels != currentGroup {
+			g := Group{LastPush: lastPush}
+			if err := json.Unmarshal([]byte(groupLabels), &g.Labels); err != nil {
+				return nil, fmt.Errorf("query result: %w", err)
+			}
+			result = append(result, g)
+			currentGroup = groupLabels
+		}
+		m := Metric{Timestamp: timestamp.FromTime(sampleTime), Value: sampleValue}
+		if err := json.Unmarshal([]byte(labels), &m.Labels); err != nil {
+			return nil, fmt.Errorf("query result: %w", err)
+		}
+		m.Labels[model.MetricNameLabelName] = metricName
+		g := &result[len(result)-1]
+		g.Metrics = append(g.Metrics, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query result: %w", err)
+	}
+	return result, nil
+}
+
+// Latest returns the latest sample of each of the series, dropping the
+// stale markers, which are not values.
+func Latest(series []Metric) []Metric {
+	latest := make(map[string]int, len(series))
+	result := make([]Metric, 0, len(series))
+	for _, s := range series {
+		if value.IsStaleNaN(s.Value) {
+			continue
+		}
+		key, err := json.Marshal(s.Labels)
+		if err != nil {
+			continue
+		}
+		i, ok := latest[string(key)]
+		if !ok {
+			latest[string(key)] = len(result)
+			result = append(result, s)
+			continue
+		}
+		if s.Timestamp >= result[i].Timestamp {
+			result[i] = s
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pushgroup
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestLatest(t *testing.T) {
+	up := map[string]string{"__name__": "up", "job": "backup"}
+	size := map[string]string{"__name__": "size", "job": "backup"}
+	latest := Latest([]Metric{
+		{Labels: up, Timestamp: 2, Value: 1},
+		{Labels: size, Timestamp: 1, Value: 10},
+		{Labels: up, Timestamp: 1, Value: 0},
+		{Labels: size, Timestamp: 3, Value: math.Float64frombits(value.StaleNaN)},
+		{Labels: size, Timestamp: 2, Value: 20},
+	})
+	require.Equal(t, []Metric{
+		{Labels: up, Timestamp: 2, Value: 1},
+		{Labels: size, Timestamp: 2, Value: 20},
+	}, latest)
+}
+
+func TestMetricMarshalJSON(t *testing.T) {
+	encoded, err := json.Marshal(Metric{Labels: map[string]string{"__name__": "up"}, Timestamp: 1000, Value: math.Inf(1)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"labels":{"__name__":"up"},"timestamp":1000,"value":"+Inf"}`, string(encoded))
+}
+
+func TestQuery(t *testing.T) {
+	lastPush := time.Unix(100, 0)
+	mock := model.NewSqlRecorder([]model.SqlQuery{{
+		Sql: querySQL,
+		Results: model.RowResults{
+			{`{"job": "a"}`, lastPush, "push_time_seconds", `{"job": "a"}`, lastPush, 100.0},
+			{`{"job": "a"}`, lastPush, "up", `{"job": "a", "instance": "x"}`, time.Unix(90, 0), 1.0},
+			{`{"job": "b"}`, lastPush, "push_time_seconds", `{"job": "b"}`, lastPush, 100.0},
+		},
+	}}, t)
+
+	groups, err := Query(mock)
+	require.NoError(t, err)
+	require.Equal(t, []Group{
+		{
+			Labels:   map[string]string{"job": "a"},
+			LastPush: lastPush,
+			Metrics: []Metric{
+				{Labels: map[string]string{"__name__": "push_time_seconds", "job": "a"}, Timestamp: 100000, Value: 100},
+				{Labels: map[string]string{"__name__": "up", "job": "a", "instance": "x"}, Timestamp: 90000, Value: 1},
+			},
+		},
+		{
+			Labels:   map[string]string{"job": "b"},
+			LastPush: lastPush,
+			Metrics: []Metric{
+				{Labels: map[string]string{"__name__": "push_time_seconds", "job": "b"}, Timestamp: 100000, Value: 100},
+			},
+		},
+	}, groups)
+}
@@ -0,0 +1,191 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+)
+
+const (
+	/* groupedAggregateSQLFormat aggregates, at each evaluation time, the last sample within the lookback of each
+	* series, grouped by the ids of the labels of the series with the grouping keys. The rows are the groups, with
+	* the label ids of the group as labels, like the series returned by the other queries. */
+	groupedAggregateSQLFormat = `SELECT grouped.labels, array_agg(grouped.time ORDER BY grouped.time), array_agg(grouped.value ORDER BY grouped.time)
+	FROM (
+		SELECT series.grouping AS labels, result.eval_time AS time, %[6]s AS value
+		FROM (
+			SELECT s.id, (
+				SELECT COALESCE(array_agg(l.id ORDER BY l.id), array[]::int[])
+				FROM ` + schema.Catalog + `.label l
+				WHERE l.id = ANY(s.labels) AND l.key = ANY(%[7]s)
+			) AS grouping
+			FROM %[2]s s
+			WHERE %[3]s
+		) AS series
+		INNER JOIN LATERAL (
+			SELECT eval_time, value
+			FROM (
+				SELECT DISTINCT ON (eval_time) eval_time, time, value
+				FROM (
+					SELECT %[8]s AS eval_time, time, %[9]s AS value
+					FROM %[1]s metric
+					WHERE metric.series_id = series.id
+					AND time >= '%[4]s'
+					AND time <= '%[5]s'
+				) AS samples
+				ORDER BY eval_time, time DESC
+			) AS last_samples
+			WHERE %[10]s
+		) AS result ON (true)
+		GROUP BY series.grouping, result.eval_time
+	) AS grouped
+	GROUP BY grouped.labels`
+)
+
+// groupedAggregates are the SQL aggregates of the aggregation operators
+// evaluating to the same value as the operators. Like in the max operator,
+// NaNs are only kept if all the values are.
+var groupedAggregates = map[parser.ItemType]string{
+	parser.SUM: "sum(result.value)",
+	parser.AVG: "avg(result.value)",
+	parser.MIN: "min(result.value)",
+	parser.MAX: "coalesce(max(result.value) FILTER (WHERE result.value <> 'NaN'), 'NaN')",
+}
+
+// groupedAggregate is an aggregation by labels of a selector pushed down to
+// the database.
+type groupedAggregate struct {
+	node      *parser.AggregateExpr
+	aggregate string
+	grouping  []string
+	// evalTime is the evaluation time the samples are evaluated at.
+	evalTime       string
+	evalTimeParams []interface{}
+	lookback       time.Duration
+	end            time.Time
+}
+
+/* getGroupedAggregate checks if the vector selector is the argument of a sum, avg, min or max aggregation by labels.
+* If so, it returns the aggregation evaluated in the database, grouping the series by the ids of their labels with the
+* grouping keys, so that a single series is returned per group instead of every series. */
+func getGroupedAggregate(hints *storage.SelectHints, qh *QueryHints, path []parser.Node) *groupedAggregate {
+	agg := getSelectorAggregation(hints, qh, path)
+	if agg == nil || agg.Param != nil {
+		return nil
+	}
+	aggregate, ok := groupedAggregates[agg.Op]
+	if !ok {
+		return nil
+	}
+	evalTime, evalTimeParams, ok := getPushdownEvalTime(hints, qh)
+	if !ok {
+		return nil
+	}
+
+	ga := &groupedAggregate{
+		node:           agg,
+		aggregate:      aggregate,
+		grouping:       agg.Grouping,
+		evalTime:       evalTime,
+		evalTimeParams: evalTimeParams,
+		lookback:       qh.Lookback,
+		end:            qh.EndTime,
+	}
+	if ga.grouping == nil {
+		ga.grouping = []string{}
+	}
+	return ga
+}
+
+// getSelectorAggregation returns the aggregation by labels directly over
+// the vector selector being selected, if any.
+func getSelectorAggregation(hints *storage.SelectHints, qh *QueryHints, path []parser.Node) *parser.AggregateExpr {
+	if qh == nil || hints == nil || hasSubquery(path) {
+		return nil
+	}
+	vs, isVectorSelector := qh.CurrentNode.(*parser.VectorSelector)
+	if !isVectorSelector ||
+		hints.Range != 0 ||
+		vs.OriginalOffset != time.Duration(0) ||
+		vs.Offset != time.Duration(0) ||
+		vs.Timestamp != nil {
+		return nil
+	}
+
+	parentIdx := len(path) - 1
+	for parentIdx >= 0 {
+		if _, isParen := path[parentIdx].(*parser.ParenExpr); !isParen {
+			break
+		}
+		parentIdx--
+	}
+	if parentIdx < 0 {
+		return nil
+	}
+	agg, isAggregate := path[parentIdx].(*parser.AggregateExpr)
+	if !isAggregate || agg.Without || unwrapExpr(agg.Expr) != parser.Expr(vs) {
+		return nil
+	}
+	return agg
+}
+
+/* getPushdownEvalTime returns the SQL expression of the evaluation time of the samples, and its parameters. The value
+* of a selector at an evaluation time is its last sample within the lookback, so the aggregations are only pushed down
+* for instant queries and range queries with a step larger than the lookback, where the last sample of the step is the
+* one evaluated. */
+func getPushdownEvalTime(hints *storage.SelectHints, qh *QueryHints) (string, []interface{}, bool) {
+	switch {
+	case hints.Step == 0:
+		return "$%d::TIMESTAMPTZ", []interface{}{qh.StartTime}, true
+	case hints.Step > qh.Lookback.Milliseconds():
+		/* the steps (T-step, T] are the buckets [T-step+1ms, T+1ms) of time_bucket, see getStepReduction */
+		step := time.Duration(hints.Step) * time.Millisecond
+		offset := qh.StartTime.Add(time.Millisecond).Sub(timeBucketOrigin) % step
+		if offset < 0 {
+			offset += step
+		}
+		return "time_bucket($%d::INTERVAL, time, $%d::INTERVAL) + $%d::INTERVAL - INTERVAL '1 millisecond'", []interface{}{step, offset, step}, true
+	default:
+		return "", nil, false
+	}
+}
+
+func buildGroupedAggregateQuery(filter metricTimeRangeFilter, cases []string, values []interface{}, ga *groupedAggregate) (string, []interface{}, error) {
+	grouping, values, err := setParameterNumbers("$%d::TEXT[]", values, ga.grouping)
+	if err != nil {
+		return "", nil, err
+	}
+	evalTime, values, err := setParameterNumbers(ga.evalTime, values, ga.evalTimeParams...)
+	if err != nil {
+		return "", nil, err
+	}
+	/* the last sample must be within the lookback and not a staleness marker for the series to have a value */
+	filterClause, values, err := setParameterNumbers("time >= eval_time - $%d::INTERVAL AND eval_time <= $%d::TIMESTAMPTZ AND "+notStaleSQL,
+		values, ga.lookback, ga.end)
+	if err != nil {
+		return "", nil, err
+	}
+
+	finalSQL := fmt.Sprintf(groupedAggregateSQLFormat,
+		pgx.Identifier{filter.schema, filter.metric}.Sanitize(),
+		pgx.Identifier{schema.DataSeries, filter.seriesTable}.Sanitize(),
+		strings.Join(cases, " AND "),
+		filter.startTime,
+		filter.endTime,
+		ga.aggregate,
+		grouping,
+		evalTime,
+		pgx.Identifier{filter.column}.Sanitize(),
+		filterClause,
+	)
+	return finalSQL, values, nil
+}
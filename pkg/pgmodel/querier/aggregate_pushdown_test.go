@@ -0,0 +1,146 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupedAggregate(t *testing.T) {
+	parse := func(query string) (*parser.VectorSelector, []parser.Node) {
+		expr, err := parser.ParseExpr(query)
+		require.NoError(t, err)
+		var (
+			vs   *parser.VectorSelector
+			path []parser.Node
+		)
+		parser.Inspect(expr, func(node parser.Node, p []parser.Node) error {
+			if n, ok := node.(*parser.VectorSelector); ok {
+				vs, path = n, append([]parser.Node{}, p...)
+			}
+			return nil
+		})
+		return vs, path
+	}
+	start := timeBucketOrigin.Add(10*time.Minute + 30*time.Second)
+	filter := metricTimeRangeFilter{
+		metric:            "cpu_usage",
+		schema:            "prom_data",
+		column:            defaultColumnName,
+		seriesTable:       "cpu_usage",
+		startTime:         "start",
+		endTime:           "end",
+		aggregatePushdown: true,
+	}
+	rangeHints := &storage.SelectHints{Step: int64(10 * time.Minute / time.Millisecond)}
+
+	vs, path := parse(`sum by (job) (cpu_usage)`)
+	qh := &QueryHints{StartTime: start, EndTime: start.Add(time.Hour), CurrentNode: vs, Lookback: 5 * time.Minute}
+	sql, values, node, tsSeries, err := buildTimeseriesByLabelClausesQuery(filter, []string{"labels && $1"}, []interface{}{"x"}, rangeHints, qh, path)
+	require.NoError(t, err)
+	require.Equal(t, path[len(path)-1], node)
+	require.Nil(t, tsSeries)
+	require.Contains(t, sql, "sum(result.value) AS value")
+	require.Contains(t, sql, "l.key = ANY($2::TEXT[])")
+	require.Contains(t, sql, "SELECT time_bucket($3::INTERVAL, time, $4::INTERVAL) + $5::INTERVAL - INTERVAL '1 millisecond' AS eval_time")
+	require.Contains(t, sql, "WHERE time >= eval_time - $6::INTERVAL AND eval_time <= $7::TIMESTAMPTZ AND "+notStaleSQL)
+	require.NotContains(t, sql, "%!")
+	require.Equal(t, []interface{}{"x", []string{"job"}, 10 * time.Minute, 30*time.Second + time.Millisecond, 10 * time.Minute,
+		5 * time.Minute, start.Add(time.Hour)}, values)
+
+	// Instant queries evaluate the last sample at the time of the query.
+	sql, values, _, _, err = buildTimeseriesByLabelClausesQuery(filter, []string{"TRUE"}, nil, &storage.SelectHints{}, qh, path)
+	require.NoError(t, err)
+	require.Contains(t, sql, "SELECT $2::TIMESTAMPTZ AS eval_time")
+	require.Equal(t, start, values[1])
+
+	for _, c := range []struct {
+		query string
+		hints *storage.SelectHints
+	}{
+		{query: `sum by (job) (cpu_usage)`, hints: &storage.SelectHints{Step: int64(time.Minute / time.Millisecond)}},
+		{query: `sum without (job) (cpu_usage)`, hints: rangeHints},
+		{query: `count by (job) (cpu_usage)`, hints: rangeHints},
+		{query: `topk(2, cpu_usage)`, hints: rangeHints},
+		{query: `sum by (job) (cpu_usage offset 1h)`, hints: rangeHints},
+		{query: `sum by (job) (abs(cpu_usage))`, hints: rangeHints},
+	} {
+		vs, path := parse(c.query)
+		qh.CurrentNode = vs
+		require.Nil(t, getGroupedAggregate(c.hints, qh, path), c.query)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	parse := func(query string) (*parser.VectorSelector, []parser.Node) {
+		expr, err := parser.ParseExpr(query)
+		require.NoError(t, err)
+		var (
+			vs   *parser.VectorSelector
+			path []parser.Node
+		)
+		parser.Inspect(expr, func(node parser.Node, p []parser.Node) error {
+			if n, ok := node.(*parser.VectorSelector); ok {
+				vs, path = n, append([]parser.Node{}, p...)
+			}
+			return nil
+		})
+		return vs, path
+	}
+	start := timeBucketOrigin.Add(10*time.Minute + 30*time.Second)
+	filter := metricTimeRangeFilter{
+		metric:            "cpu_usage",
+		schema:            "prom_data",
+		column:            defaultColumnName,
+		seriesTable:       "cpu_usage",
+		startTime:         "start",
+		endTime:           "end",
+		aggregatePushdown: true,
+	}
+	rangeHints := &storage.SelectHints{Step: int64(10 * time.Minute / time.Millisecond)}
+
+	vs, path := parse(`topk by (job) (3, cpu_usage)`)
+	qh := &QueryHints{StartTime: start, EndTime: start.Add(time.Hour), CurrentNode: vs, Lookback: 5 * time.Minute}
+	sql, values, node, tsSeries, err := buildTimeseriesByLabelClausesQuery(filter, []string{"labels && $1"}, []interface{}{"x"}, rangeHints, qh, path)
+	require.NoError(t, err)
+	// The engine still evaluates the topk, over the ranked series.
+	require.Nil(t, node)
+	require.Nil(t, tsSeries)
+	require.Contains(t, sql, "rank() OVER (PARTITION BY series.grouping, result.eval_time ORDER BY result.value = 'NaN' ASC, result.value DESC)")
+	require.Contains(t, sql, "l.key = ANY($2::TEXT[])")
+	require.Contains(t, sql, "WHERE ranked.rank <= $8::BIGINT")
+	require.NotContains(t, sql, "%!")
+	require.Equal(t, []interface{}{"x", []string{"job"}, 10 * time.Minute, 30*time.Second + time.Millisecond, 10 * time.Minute,
+		5 * time.Minute, start.Add(time.Hour), int64(3)}, values)
+
+	vs, path = parse(`bottomk(2.5, (cpu_usage))`)
+	qh.CurrentNode = vs
+	sql, values, _, _, err = buildTimeseriesByLabelClausesQuery(filter, []string{"TRUE"}, nil, &storage.SelectHints{}, qh, path)
+	require.NoError(t, err)
+	require.Contains(t, sql, "ORDER BY result.value ASC")
+	require.Equal(t, []interface{}{[]string{}, start, 5 * time.Minute, start.Add(time.Hour), int64(2)}, values)
+
+	for _, c := range []struct {
+		query string
+		hints *storage.SelectHints
+	}{
+		{query: `topk(2, cpu_usage)`, hints: &storage.SelectHints{Step: int64(time.Minute / time.Millisecond)}},
+		{query: `topk without (job) (2, cpu_usage)`, hints: rangeHints},
+		{query: `topk(scalar(k), cpu_usage)`, hints: rangeHints},
+		{query: `topk(0, cpu_usage)`, hints: rangeHints},
+		{query: `topk(2, cpu_usage offset 1h)`, hints: rangeHints},
+		{query: `topk(2, rate(cpu_usage[5m]))`, hints: rangeHints},
+		{query: `sum by (job) (cpu_usage)`, hints: rangeHints},
+	} {
+		vs, path := parse(c.query)
+		qh.CurrentNode = vs
+		require.Nil(t, getTopK(c.hints, qh, path), c.query)
+	}
+}
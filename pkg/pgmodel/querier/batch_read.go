@@ -0,0 +1,149 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+// BatchQuerier is implemented by the queriers that can run the queries of a
+// remote-read request together.
+type BatchQuerier interface {
+	// QueryBatch returns the resulting timeseries of each query, in the
+	// order of the queries. It fails if any of the queries fails.
+	QueryBatch(queries []*prompb.Query) ([][]*prompb.TimeSeries, error)
+}
+
+// QueryBatch implements the BatchQuerier interface. Up to
+// RemoteReadConcurrency queries run at once, and the labels of their series
+// are looked up once for all of them, since the queries of a request, e.g.
+// of the selectors of a PromQL query, often return the same series.
+func (q *pgxQuerier) QueryBatch(queries []*prompb.Query) ([][]*prompb.TimeSeries, error) {
+	concurrency := q.cfg.RemoteReadConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, concurrency)
+		shared  = newSharedLabels(q.labelsReader)
+		results = make([][]*prompb.TimeSeries, len(queries))
+		errs    = make([]error, len(queries))
+	)
+	for i := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = q.query(queries[i], shared)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// sharedLabels looks up the labels of the ids of the label resolvers of
+// concurrent queries, each id once: the ids being looked up for a resolver
+// are waited for by the others instead of being looked up again.
+type sharedLabels struct {
+	querier labelQuerier
+
+	mux      sync.Mutex
+	resolved map[int64]labels.Label
+	inflight map[int64]chan struct{}
+}
+
+func newSharedLabels(querier labelQuerier) *sharedLabels {
+	return &sharedLabels{
+		querier:  querier,
+		resolved: make(map[int64]labels.Label),
+		inflight: make(map[int64]chan struct{}),
+	}
+}
+
+// LabelsForIdMap implements the labelQuerier interface.
+func (s *sharedLabels) LabelsForIdMap(idMap map[int64]labels.Label) error {
+	var (
+		missing = make(map[int64]labels.Label)
+		waiting []chan struct{}
+		done    = make(chan struct{})
+	)
+	s.mux.Lock()
+	for id := range idMap {
+		if _, ok := s.resolved[id]; ok {
+			continue
+		}
+		if ch, ok := s.inflight[id]; ok {
+			waiting = append(waiting, ch)
+			continue
+		}
+		s.inflight[id] = done
+		missing[id] = labels.Label{}
+	}
+	s.mux.Unlock()
+
+	var err error
+	if len(missing) > 0 {
+		// The ids that are missing are resolved to empty labels.
+		if err = s.querier.LabelsForIdMap(missing); isMissingLabels(err) {
+			err = nil
+		}
+		s.mux.Lock()
+		for id := range missing {
+			if err == nil {
+				s.resolved[id] = missing[id]
+			}
+			delete(s.inflight, id)
+		}
+		s.mux.Unlock()
+		close(done)
+		if err != nil {
+			return err
+		}
+	}
+	for _, ch := range waiting {
+		<-ch
+	}
+
+	// The ids whose lookup failed for another resolver are looked up again.
+	s.mux.Lock()
+	retry := make(map[int64]labels.Label)
+	for id := range idMap {
+		if l, ok := s.resolved[id]; ok {
+			idMap[id] = l
+		} else {
+			retry[id] = labels.Label{}
+		}
+	}
+	s.mux.Unlock()
+	if len(retry) > 0 {
+		if err = s.querier.LabelsForIdMap(retry); err != nil && !isMissingLabels(err) {
+			return err
+		}
+		for id, l := range retry {
+			idMap[id] = l
+		}
+	}
+	for id, l := range idMap {
+		if l == (labels.Label{}) {
+			return fmt.Errorf("%w: no label for id %v", errors.ErrMissingLabels, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+// lockedQuerier serializes the lookups of a countingQuerier, for the
+// resolvers of concurrent queries.
+type lockedQuerier struct {
+	sync.Mutex
+	*countingQuerier
+}
+
+func (l *lockedQuerier) LabelsForIdMap(idMap map[int64]labels.Label) error {
+	l.Lock()
+	defer l.Unlock()
+	return l.countingQuerier.LabelsForIdMap(idMap)
+}
+
+func TestSharedLabels(t *testing.T) {
+	querier := &lockedQuerier{countingQuerier: &countingQuerier{}}
+	shared := newSharedLabels(querier)
+
+	// The resolvers of concurrent queries returning the same series.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resolver := newLabelResolver(shared)
+			for id := int64(1); id <= 3*labelResolveBatchSize; id++ {
+				resolver.add([]int64{id})
+			}
+			resolved, err := resolver.wait()
+			require.NoError(t, err)
+			require.Len(t, resolved, 3*labelResolveBatchSize)
+			require.Equal(t, labels.Label{Name: "k", Value: "42"}, resolved[42])
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 3*labelResolveBatchSize, querier.ids, "ids must only be looked up once")
+}
+
+func TestSharedLabelsError(t *testing.T) {
+	querier := &countingQuerier{err: fmt.Errorf("lookup failed")}
+	shared := newSharedLabels(querier)
+	require.Equal(t, querier.err, shared.LabelsForIdMap(map[int64]labels.Label{1: {}, 2: {}}))
+
+	// The failed ids are looked up again.
+	querier.err = nil
+	idMap := map[int64]labels.Label{1: {}, 3: {}}
+	require.NoError(t, shared.LabelsForIdMap(idMap))
+	require.Equal(t, labels.Label{Name: "k", Value: "1"}, idMap[1])
+	require.Equal(t, 4, querier.ids)
+}
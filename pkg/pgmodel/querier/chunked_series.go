@@ -0,0 +1,172 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgtype"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+// samplesPerChunk is the number of samples in the XOR chunks of streamed
+// remote read responses, the same as in the chunks of Prometheus.
+const samplesPerChunk = 120
+
+// ChunkQuerier is implemented by the queriers that can return the results
+// of remote-storage queries as XOR chunks, for streamed remote read.
+type ChunkQuerier interface {
+	// QueryChunks calls fn with each resulting series of a query, with its
+	// samples encoded in XOR chunks, as soon as the series is encoded. It
+	// stops at the first error returned by fn.
+	QueryChunks(query *prompb.Query, fn func(*prompb.ChunkedSeries) error) error
+}
+
+// QueryChunks implements the ChunkQuerier interface. The series of a single
+// metric are streamed from a cursor if series sets are streamed, so that
+// they are encoded and passed to fn as they are fetched.
+func (q *pgxQuerier) QueryChunks(query *prompb.Query, fn func(*prompb.ChunkedSeries) error) error {
+	if query == nil {
+		return nil
+	}
+
+	matchers, err := fromLabelMatchers(query.Matchers)
+	if err != nil {
+		return err
+	}
+
+	resolver := newLabelResolver(q.labelsReader)
+	stream := q.cfg.StreamFetchSize > 0
+	ctx := WithQueryBudget(context.Background())
+	rows, metricQuery, _, _, err := q.getResults(ctx, query.StartTimestampMs, query.EndTimestampMs, nil, nil, nil, matchers, resolver, stream)
+	if err != nil {
+		resolver.discard()
+		return err
+	}
+	if err = queryBudgetFrom(ctx).charge(&q.cfg, rows); err != nil {
+		releaseRows(rows)
+		resolver.discard()
+		return err
+	}
+
+	if metricQuery != nil {
+		resolver.discard()
+		ss := newStreamingSeriesSet(ctx, metricQuery, q.labelsReader, q.cfg)
+		defer ss.Close()
+		return streamChunkedSeries(ss, fn)
+	}
+
+	// The samples are encoded into the chunks.
+	defer releaseRows(rows)
+	series, err := buildChunkedSeries(rows, resolver)
+	if err != nil {
+		return err
+	}
+	for _, s := range series {
+		if err = fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamChunkedSeries encodes the samples of the series of the set into XOR
+// chunks, passing each series to fn once encoded.
+func streamChunkedSeries(ss SeriesSet, fn func(*prompb.ChunkedSeries) error) error {
+	for ss.Next() {
+		s, ok := ss.At().(*pgxSeries)
+		if !ok {
+			break
+		}
+		chunks, err := encodeXORChunks(s.times, s.values)
+		if err != nil {
+			return err
+		}
+		promLabels := make([]prompb.Label, len(s.labels))
+		for i, l := range s.labels {
+			promLabels[i] = prompb.Label{Name: l.Name, Value: l.Value}
+		}
+		if err = fn(&prompb.ChunkedSeries{Labels: promLabels, Chunks: chunks}); err != nil {
+			return err
+		}
+	}
+	return ss.Err()
+}
+
+// buildChunkedSeries encodes the samples of the rows into XOR chunks
+// straight from the arrays fetched from the database, without building the
+// samples of each series first.
+func buildChunkedSeries(rows []timescaleRow, resolver *labelResolver) ([]*prompb.ChunkedSeries, error) {
+	results := make([]*prompb.ChunkedSeries, 0, len(rows))
+	labelIDMap, err := resolver.wait()
+	if err != nil {
+		return nil, fmt.Errorf("fetching labels to build chunked series: %w", err)
+	}
+
+	for idx := range rows {
+		row := &rows[idx]
+		if row.err != nil {
+			return nil, row.err
+		}
+
+		if row.times.Len() != len(row.values.Elements) {
+			return nil, errors.ErrQueryMismatchTimestampValue
+		}
+
+		promLabels, err := buildPromLabels(row, labelIDMap)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks, err := encodeXORChunks(row.times, row.values)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &prompb.ChunkedSeries{
+			Labels: promLabels,
+			Chunks: chunks,
+		})
+	}
+
+	return results, nil
+}
+
+// encodeXORChunks encodes the samples into chunks of samplesPerChunk
+// samples.
+func encodeXORChunks(times TimestampSeries, values *pgtype.Float8Array) ([]prompb.Chunk, error) {
+	chunks := make([]prompb.Chunk, 0, (times.Len()+samplesPerChunk-1)/samplesPerChunk)
+	var (
+		chunk    *chunkenc.XORChunk
+		appender chunkenc.Appender
+		err      error
+	)
+	for i := 0; i < times.Len(); i++ {
+		ts, ok := times.At(i)
+		if !ok {
+			return nil, fmt.Errorf("invalid timestamp found")
+		}
+
+		if i%samplesPerChunk == 0 {
+			if chunk != nil {
+				chunks[len(chunks)-1].Data = chunk.Bytes()
+			}
+			chunk = chunkenc.NewXORChunk()
+			if appender, err = chunk.Appender(); err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, prompb.Chunk{MinTimeMs: ts, Type: prompb.Chunk_XOR})
+		}
+		appender.Append(ts, values.Elements[i].Float)
+		chunks[len(chunks)-1].MaxTimeMs = ts
+	}
+	if chunk != nil {
+		chunks[len(chunks)-1].Data = chunk.Bytes()
+	}
+	return chunks, nil
+}
@@ -0,0 +1,145 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/jackc/pgtype"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func chunkTestRows(series, samples int) []timescaleRow {
+	rows := make([]timescaleRow, series)
+	for i := range rows {
+		values := &pgtype.Float8Array{Elements: make([]pgtype.Float8, samples)}
+		for j := range values.Elements {
+			values.Elements[j] = pgtype.Float8{Float: math.Sin(float64(i+j)) * 100, Status: pgtype.Present}
+		}
+		rows[i] = timescaleRow{
+			labels: labels.Labels{{Name: labels.MetricName, Value: "cpu"}, {Name: "instance", Value: string(rune('a' + i%26))}},
+			times:  newRegularTimestampSeries(time.Unix(0, 0), time.Unix(int64(samples-1)*15, 0), 15*time.Second),
+			values: values,
+		}
+	}
+	return rows
+}
+
+func TestBuildChunkedSeries(t *testing.T) {
+	rows := chunkTestRows(2, 2*samplesPerChunk+10)
+	series, err := buildChunkedSeries(rows, newLabelResolver(nil))
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+
+	for i, s := range series {
+		require.Equal(t, []prompb.Label{{Name: labels.MetricName, Value: "cpu"}, {Name: "instance", Value: string(rune('a' + i))}}, s.Labels)
+		require.Len(t, s.Chunks, 3)
+
+		j := 0
+		for _, c := range s.Chunks {
+			require.Equal(t, prompb.Chunk_XOR, c.Type)
+			chunk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+			require.NoError(t, err)
+			it := chunk.Iterator(nil)
+			first := true
+			for it.Next() {
+				ts, v := it.At()
+				expectedTs, _ := rows[i].times.At(j)
+				require.Equal(t, expectedTs, ts)
+				require.Equal(t, rows[i].values.Elements[j].Float, v)
+				if first {
+					require.Equal(t, ts, c.MinTimeMs)
+					first = false
+				}
+				require.LessOrEqual(t, ts, c.MaxTimeMs)
+				j++
+			}
+			require.NoError(t, it.Err())
+		}
+		require.Equal(t, len(rows[i].values.Elements), j)
+	}
+
+	empty, err := encodeXORChunks(newRowTimestampSeries(&pgtype.TimestamptzArray{}), &pgtype.Float8Array{})
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
+
+// BenchmarkRemoteReadEncoding compares encoding the rows of a remote read
+// response into the bytes sent: the samples marshalled and compressed with
+// snappy, or the series encoded into XOR chunks and marshalled frame by frame.
+func BenchmarkRemoteReadEncoding(b *testing.B) {
+	const series, samples = 20, 10000
+	rows := chunkTestRows(series, samples)
+	respBytes := 0
+
+	b.Run("samples", func(b *testing.B) {
+		b.SetBytes(series * samples * 16)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			ts, err := buildTimeSeries(rows, newLabelResolver(nil))
+			if err != nil {
+				b.Fatal(err)
+			}
+			data, err := proto.Marshal(&prompb.ReadResponse{Results: []*prompb.QueryResult{{Timeseries: ts}}})
+			if err != nil {
+				b.Fatal(err)
+			}
+			respBytes = len(snappy.Encode(nil, data))
+		}
+		b.ReportMetric(float64(respBytes), "resp-bytes/op")
+	})
+
+	b.Run("chunks", func(b *testing.B) {
+		b.SetBytes(series * samples * 16)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cs, err := buildChunkedSeries(rows, newLabelResolver(nil))
+			if err != nil {
+				b.Fatal(err)
+			}
+			respBytes = 0
+			for _, s := range cs {
+				data, err := proto.Marshal(&prompb.ChunkedReadResponse{ChunkedSeries: []*prompb.ChunkedSeries{s}})
+				if err != nil {
+					b.Fatal(err)
+				}
+				respBytes += len(data)
+			}
+		}
+		b.ReportMetric(float64(respBytes), "resp-bytes/op")
+	})
+}
+
+func TestStreamChunkedSeries(t *testing.T) {
+	rows := chunkTestRows(3, samplesPerChunk+1)
+	ss := buildSeriesSet(rows, newLabelResolver(nil))
+
+	var series []*prompb.ChunkedSeries
+	err := streamChunkedSeries(ss, func(s *prompb.ChunkedSeries) error {
+		series = append(series, s)
+		return nil
+	})
+	require.NoError(t, err)
+	expected, err := buildChunkedSeries(rows, newLabelResolver(nil))
+	require.NoError(t, err)
+	require.Equal(t, expected, series)
+
+	// An error of the callback stops the stream.
+	calls := 0
+	err = streamChunkedSeries(buildSeriesSet(rows, newLabelResolver(nil)), func(s *prompb.ChunkedSeries) error {
+		calls++
+		return fmt.Errorf("client gone")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,62 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"math"
+)
+
+// DuplicatePolicy defines which sample series iterators return when a series
+// has several samples with the same timestamp, e.g. when the data of HA
+// replicas was merged or backfilled data overlaps existing data.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesFirst returns the first of the samples.
+	DuplicatesFirst DuplicatePolicy = iota
+	// DuplicatesLast returns the last of the samples.
+	DuplicatesLast
+	// DuplicatesMax returns the sample with the largest value.
+	DuplicatesMax
+	// DuplicatesError fails the query.
+	DuplicatesError
+)
+
+var ErrDuplicateTimestamp = fmt.Errorf("series has several samples with the same timestamp")
+
+var duplicatePolicyNames = map[DuplicatePolicy]string{
+	DuplicatesFirst: "first",
+	DuplicatesLast:  "last",
+	DuplicatesMax:   "max",
+	DuplicatesError: "error",
+}
+
+func (d DuplicatePolicy) String() string {
+	return duplicatePolicyNames[d]
+}
+
+// ParseDuplicatePolicy returns the policy with the given name.
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	for policy, policyName := range duplicatePolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid duplicate timestamp policy %q, must be one of first, last, max or error", name)
+}
+
+// prefers returns true if the policy picks the candidate value over the
+// current one, for samples with the same timestamp.
+func (d DuplicatePolicy) prefers(current, candidate float64) bool {
+	switch d {
+	case DuplicatesLast:
+		return true
+	case DuplicatesMax:
+		return candidate > current || math.IsNaN(current)
+	default:
+		return false
+	}
+}
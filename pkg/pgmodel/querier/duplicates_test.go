@@ -0,0 +1,116 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	for _, policy := range []DuplicatePolicy{DuplicatesFirst, DuplicatesLast, DuplicatesMax, DuplicatesError} {
+		parsed, err := ParseDuplicatePolicy(policy.String())
+		require.NoError(t, err)
+		require.Equal(t, policy, parsed)
+	}
+	_, err := ParseDuplicatePolicy("min")
+	require.Error(t, err)
+}
+
+func TestIteratorDuplicatePolicy(t *testing.T) {
+	type sample struct {
+		t int64
+		v float64
+	}
+	input := []sample{{1, 1}, {2, 5}, {2, 7}, {2, 6}, {3, math.NaN()}, {3, 1}, {4, 4}}
+
+	testCases := []struct {
+		policy   DuplicatePolicy
+		expected []sample
+		err      error
+	}{
+		{
+			policy:   DuplicatesFirst,
+			expected: []sample{{1000, 1}, {2000, 5}, {3000, math.NaN()}, {4000, 4}},
+		},
+		{
+			policy:   DuplicatesLast,
+			expected: []sample{{1000, 1}, {2000, 6}, {3000, 1}, {4000, 4}},
+		},
+		{
+			policy:   DuplicatesMax,
+			expected: []sample{{1000, 1}, {2000, 7}, {3000, 1}, {4000, 4}},
+		},
+		{
+			policy:   DuplicatesError,
+			expected: []sample{{1000, 1}},
+			err:      ErrDuplicateTimestamp,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			times := make([]pgtype.Timestamptz, len(input))
+			values := make([]pgtype.Float8, len(input))
+			for i, s := range input {
+				times[i] = pgtype.Timestamptz{Time: time.Unix(s.t, 0), Status: pgtype.Present}
+				values[i] = pgtype.Float8{Float: s.v, Status: pgtype.Present}
+			}
+			it := newIterator(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values), Cfg{Duplicates: c.policy})
+
+			var res []sample
+			for it.Next() {
+				ts, v := it.At()
+				res = append(res, sample{ts, v})
+			}
+			require.Len(t, res, len(c.expected))
+			for i := range res {
+				require.Equal(t, c.expected[i].t, res[i].t)
+				if math.IsNaN(c.expected[i].v) {
+					require.True(t, math.IsNaN(res[i].v))
+					continue
+				}
+				require.Equal(t, c.expected[i].v, res[i].v)
+			}
+			if c.err == nil {
+				require.NoError(t, it.Err())
+				return
+			}
+			require.True(t, errors.Is(it.Err(), c.err))
+		})
+	}
+}
+
+func TestIteratorSeekWithDuplicates(t *testing.T) {
+	times := []pgtype.Timestamptz{
+		{Time: time.Unix(1, 0), Status: pgtype.Present},
+		{Time: time.Unix(1, 0), Status: pgtype.Present},
+		{Time: time.Unix(2, 0), Status: pgtype.Present},
+	}
+	values := []pgtype.Float8{{Float: 1, Status: pgtype.Present}, {Float: 2, Status: pgtype.Present}, {Float: 3, Status: pgtype.Present}}
+	it := newIterator(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values), Cfg{Duplicates: DuplicatesLast})
+
+	require.True(t, it.Seek(2000))
+	ts, v := it.At()
+	require.Equal(t, int64(2000), ts)
+	require.Equal(t, 3.0, v)
+
+	// Seeking behind the current sample keeps it.
+	require.True(t, it.Seek(0))
+	ts, v = it.At()
+	require.Equal(t, int64(2000), ts)
+	require.Equal(t, 3.0, v)
+
+	it = newIterator(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values), Cfg{Duplicates: DuplicatesLast})
+	require.True(t, it.Seek(0))
+	ts, v = it.At()
+	require.Equal(t, int64(1000), ts)
+	require.Equal(t, 2.0, v)
+}
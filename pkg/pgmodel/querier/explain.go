@@ -0,0 +1,69 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// Pushdown is a node of a PromQL query evaluated in the database by the
+// query of one of its selectors.
+type Pushdown struct {
+	Selector string
+	Node     string
+}
+
+// ExplainingQuerier records the nodes pushed down into the database by the
+// selects of a querier, for a query to be explained.
+type ExplainingQuerier struct {
+	Querier
+
+	mux       sync.Mutex
+	pushdowns []Pushdown
+}
+
+// NewExplainingQuerier returns a querier recording the pushdowns of q. The
+// queries of a pgxQuerier are run on its connections wrapped by recorder,
+// sharing its caches, and its selects neither prewarm chunks nor record
+// the usage of metrics.
+func NewExplainingQuerier(q Querier, recorder *pgxconn.QueryRecorder) *ExplainingQuerier {
+	if pq, ok := q.(*pgxQuerier); ok {
+		explained := *pq
+		explained.conn = recorder.Wrap(pq.conn)
+		explained.cfg.ReadEndpoints = make(map[string]pgxconn.PgxConn, len(pq.cfg.ReadEndpoints))
+		for name, conn := range pq.cfg.ReadEndpoints {
+			explained.cfg.ReadEndpoints[name] = recorder.Wrap(conn)
+		}
+		explained.cfg.Prewarmer = nil
+		explained.cfg.Usage = nil
+		q = &explained
+	}
+	return &ExplainingQuerier{Querier: q}
+}
+
+// Select implements the Querier interface.
+func (e *ExplainingQuerier) Select(ctx context.Context, mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, ms ...*labels.Matcher) (SeriesSet, parser.Node) {
+	ss, topNode := e.Querier.Select(ctx, mint, maxt, sortSeries, hints, qh, path, ms...)
+	if topNode != nil {
+		selector := &parser.VectorSelector{LabelMatchers: ms}
+		e.mux.Lock()
+		e.pushdowns = append(e.pushdowns, Pushdown{Selector: selector.String(), Node: topNode.String()})
+		e.mux.Unlock()
+	}
+	return ss, topNode
+}
+
+// Pushdowns returns the pushdowns recorded so far.
+func (e *ExplainingQuerier) Pushdowns() []Pushdown {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return append([]Pushdown(nil), e.pushdowns...)
+}
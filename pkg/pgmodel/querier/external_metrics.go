@@ -0,0 +1,268 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	getExternalMetricSQL = "SELECT table_schema, table_name, time_column, value_column, tag_columns FROM " + schema.Catalog + ".external_metric WHERE metric_name = $1"
+
+	// externalMetricRefreshInterval is how long the mapping of a metric to an
+	// external table is cached before it is fetched again, so that tables
+	// which are registered or unregistered are picked up without a restart.
+	externalMetricRefreshInterval = time.Minute
+)
+
+// externalMetric is a table that was not created by Promscale, registered by
+// the user to be queried as a metric. Every distinct combination of the tag
+// columns is a series.
+type externalMetric struct {
+	schema      string
+	table       string
+	timeColumn  string
+	valueColumn string
+	tagColumns  []string
+}
+
+type externalMetricEntry struct {
+	// metric is nil if the metric is not mapped to an external table, so
+	// that the misses are cached too.
+	metric  *externalMetric
+	fetched time.Time
+}
+
+// externalMetricCache caches the external table each metric is mapped to.
+type externalMetricCache struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	entries map[string]externalMetricEntry
+	now     func() time.Time
+}
+
+func newExternalMetricCache(conn pgxconn.PgxConn) *externalMetricCache {
+	return &externalMetricCache{
+		conn:    conn,
+		entries: make(map[string]externalMetricEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *externalMetricCache) get(metric string) (*externalMetric, error) {
+	c.mux.Lock()
+	entry, ok := c.entries[metric]
+	c.mux.Unlock()
+	if ok && c.now().Sub(entry.fetched) < externalMetricRefreshInterval {
+		return entry.metric, nil
+	}
+
+	m, err := c.fetch(metric)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mux.Lock()
+	c.entries[metric] = externalMetricEntry{metric: m, fetched: c.now()}
+	c.mux.Unlock()
+	return m, nil
+}
+
+func (c *externalMetricCache) fetch(metric string) (*externalMetric, error) {
+	var (
+		m    externalMetric
+		tags pgtype.TextArray
+	)
+	err := c.conn.QueryRow(context.Background(), getExternalMetricSQL, metric).Scan(&m.schema, &m.table, &m.timeColumn, &m.valueColumn, &tags)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = tags.AssignTo(&m.tagColumns); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// externalMetricName returns the metric queried if the matchers select a
+// single metric of the default schema and column, the only ones that can be
+// mapped to an external table.
+func externalMetricName(matchers []*labels.Matcher) string {
+	metric := ""
+	for _, m := range matchers {
+		switch m.Name {
+		case model.MetricNameLabelName:
+			if m.Type != labels.MatchEqual {
+				return ""
+			}
+			metric = m.Value
+		case model.SchemaNameLabelName, model.ColumnNameLabelName:
+			return ""
+		}
+	}
+	return metric
+}
+
+// buildExternalMetricQuery returns the query fetching the series of an
+// external metric matching the matchers. The tag columns are compared as
+// text, a NULL tag being the same as a missing label. It returns false if
+// the matchers cannot match any series, which is the case when a label that
+// is not a tag column, for example the tenant, is required to be set.
+func buildExternalMetricQuery(m *externalMetric, matchers []*labels.Matcher, startTime, endTime string) (string, []interface{}, bool) {
+	tags := make(map[string]string, len(m.tagColumns))
+	tagExprs := make([]string, len(m.tagColumns))
+	for i, tag := range m.tagColumns {
+		tagExprs[i] = fmt.Sprintf("COALESCE(%s::text, '')", pgx.Identifier{tag}.Sanitize())
+		tags[tag] = tagExprs[i]
+	}
+	timeColumn := pgx.Identifier{m.timeColumn}.Sanitize()
+
+	values := []interface{}{startTime, endTime}
+	clauses := []string{
+		fmt.Sprintf("%s >= $1::timestamptz", timeColumn),
+		fmt.Sprintf("%s <= $2::timestamptz", timeColumn),
+	}
+	for _, matcher := range matchers {
+		if matcher.Name == model.MetricNameLabelName {
+			continue
+		}
+		expr, ok := tags[matcher.Name]
+		if !ok {
+			// The label is missing from all the series.
+			if !matcher.Matches("") {
+				return "", nil, false
+			}
+			continue
+		}
+		value := matcher.Value
+		var op string
+		switch matcher.Type {
+		case labels.MatchEqual:
+			op = "="
+		case labels.MatchNotEqual:
+			op = "<>"
+		case labels.MatchRegexp:
+			op = "~"
+			value = anchorValue(value)
+		case labels.MatchNotRegexp:
+			op = "!~"
+			value = anchorValue(value)
+		}
+		values = append(values, value)
+		clauses = append(clauses, fmt.Sprintf("%s %s $%d", expr, op, len(values)))
+	}
+
+	tagArray := "ARRAY[]::text[]"
+	groupBy := ""
+	if len(tagExprs) > 0 {
+		tagArray = "ARRAY[" + strings.Join(tagExprs, ", ") + "]::text[]"
+		groupBy = " GROUP BY " + strings.Join(tagExprs, ", ")
+	}
+	sql := fmt.Sprintf("SELECT %[1]s, array_agg(%[2]s::timestamptz ORDER BY %[2]s), array_agg(%[3]s::float8 ORDER BY %[2]s) FROM %[4]s WHERE %[5]s%[6]s",
+		tagArray,
+		timeColumn,
+		pgx.Identifier{m.valueColumn}.Sanitize(),
+		pgx.Identifier{m.schema, m.table}.Sanitize(),
+		strings.Join(clauses, " AND "),
+		groupBy,
+	)
+	if groupBy == "" {
+		// Without tags there is a single series, which is empty rather than
+		// missing if no row is in the time range.
+		sql += " HAVING count(*) > 0"
+	}
+	return sql, values, true
+}
+
+// queryExternalMetric returns the result rows of a metric mapped to an
+// external table. It returns false if the matchers do not select such a
+// metric.
+func (q *pgxQuerier) queryExternalMetric(ctx context.Context, startTimestamp, endTimestamp int64, matchers []*labels.Matcher) ([]timescaleRow, bool, error) {
+	if q.externalMetrics == nil {
+		return nil, false, nil
+	}
+	metric := externalMetricName(matchers)
+	if metric == "" {
+		return nil, false, nil
+	}
+	m, err := q.externalMetrics.get(metric)
+	if err != nil {
+		return nil, false, fmt.Errorf("get external table of metric %s: %w", metric, err)
+	}
+	if m == nil {
+		return nil, false, nil
+	}
+
+	sqlQuery, values, ok := buildExternalMetricQuery(m, matchers, toRFC3339Nano(startTimestamp), toRFC3339Nano(endTimestamp))
+	if !ok {
+		return nil, true, nil
+	}
+	route, err := q.getQueryRoute(metric)
+	if err != nil {
+		return nil, true, err
+	}
+	rows, err := q.connFor(route).Query(ctx, sqlQuery, values...)
+	if err != nil {
+		return nil, true, fmt.Errorf("querying external table of metric %s: %w", metric, err)
+	}
+	defer rows.Close()
+
+	tsRows, err := appendExternalRows(getRows(), rows, metric, m.tagColumns)
+	return tsRows, true, err
+}
+
+// appendExternalRows adds the series of an external metric to the result
+// rows. Their labels are built from the tag values instead of being resolved
+// from label ids.
+func appendExternalRows(out []timescaleRow, in pgxconn.PgxRows, metric string, tagColumns []string) ([]timescaleRow, error) {
+	if in.Err() != nil {
+		return out, in.Err()
+	}
+	for in.Next() {
+		var (
+			row     timescaleRow
+			tagVals []string
+		)
+		values := fPool.Get().(*pgtype.Float8Array)
+		values.Elements = values.Elements[:0]
+		times := tPool.Get().(*pgtype.TimestamptzArray)
+		times.Elements = times.Elements[:0]
+		row.err = in.Scan(&tagVals, &timestamptzArrayWrapper{times}, &float8ArrayWrapper{values})
+		row.values = values
+		row.timeArrayOwnership = times
+		row.times = newRowTimestampSeries(times)
+
+		row.labels = make(labels.Labels, 0, len(tagVals)+1)
+		row.labels = append(row.labels, labels.Label{Name: model.MetricNameLabelName, Value: metric})
+		for i, v := range tagVals {
+			if v != "" && i < len(tagColumns) {
+				row.labels = append(row.labels, labels.Label{Name: tagColumns[i], Value: v})
+			}
+		}
+		sort.Sort(row.labels)
+
+		out = append(out, row)
+		if row.err != nil {
+			log.Error("err", row.err)
+			return out, row.err
+		}
+	}
+	return out, in.Err()
+}
@@ -0,0 +1,87 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalMetricName(t *testing.T) {
+	name := labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "temperature")
+	require.Equal(t, "temperature", externalMetricName([]*labels.Matcher{name}))
+	require.Equal(t, "", externalMetricName([]*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "temp.*")}))
+	require.Equal(t, "", externalMetricName([]*labels.Matcher{name, labels.MustNewMatcher(labels.MatchEqual, "__schema__", "iot")}))
+	require.Equal(t, "", externalMetricName([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "device", "a")}))
+}
+
+func TestBuildExternalMetricQuery(t *testing.T) {
+	m := &externalMetric{
+		schema:      "iot",
+		table:       "readings",
+		timeColumn:  "ts",
+		valueColumn: "temperature",
+		tagColumns:  []string{"device", "site"},
+	}
+
+	testCases := []struct {
+		name     string
+		matchers []*labels.Matcher
+		sql      string
+		values   []interface{}
+		noMatch  bool
+	}{
+		{
+			name:     "metric name only",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "temperature")},
+			sql: `SELECT ARRAY[COALESCE("device"::text, ''), COALESCE("site"::text, '')]::text[], array_agg("ts"::timestamptz ORDER BY "ts"), array_agg("temperature"::float8 ORDER BY "ts") ` +
+				`FROM "iot"."readings" WHERE "ts" >= $1::timestamptz AND "ts" <= $2::timestamptz GROUP BY COALESCE("device"::text, ''), COALESCE("site"::text, '')`,
+			values: []interface{}{"start", "end"},
+		},
+		{
+			name: "tag matchers",
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "device", "a"),
+				labels.MustNewMatcher(labels.MatchNotRegexp, "site", "lab.*"),
+			},
+			sql: `SELECT ARRAY[COALESCE("device"::text, ''), COALESCE("site"::text, '')]::text[], array_agg("ts"::timestamptz ORDER BY "ts"), array_agg("temperature"::float8 ORDER BY "ts") ` +
+				`FROM "iot"."readings" WHERE "ts" >= $1::timestamptz AND "ts" <= $2::timestamptz AND COALESCE("device"::text, '') = $3 AND COALESCE("site"::text, '') !~ $4 ` +
+				`GROUP BY COALESCE("device"::text, ''), COALESCE("site"::text, '')`,
+			values: []interface{}{"start", "end", "a", "^(?:lab.*)$"},
+		},
+		{
+			name:     "label missing from the table can match",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "job", "x")},
+			sql: `SELECT ARRAY[COALESCE("device"::text, ''), COALESCE("site"::text, '')]::text[], array_agg("ts"::timestamptz ORDER BY "ts"), array_agg("temperature"::float8 ORDER BY "ts") ` +
+				`FROM "iot"."readings" WHERE "ts" >= $1::timestamptz AND "ts" <= $2::timestamptz GROUP BY COALESCE("device"::text, ''), COALESCE("site"::text, '')`,
+			values: []interface{}{"start", "end"},
+		},
+		{
+			name:     "label missing from the table cannot match",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__tenant__", "a")},
+			noMatch:  true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			sql, values, ok := buildExternalMetricQuery(m, c.matchers, "start", "end")
+			if c.noMatch {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, c.sql, sql)
+			require.Equal(t, c.values, values)
+		})
+	}
+
+	sql, _, ok := buildExternalMetricQuery(&externalMetric{schema: "public", table: "power", timeColumn: "time", valueColumn: "watts"}, nil, "start", "end")
+	require.True(t, ok)
+	require.Equal(t, `SELECT ARRAY[]::text[], array_agg("time"::timestamptz ORDER BY "time"), array_agg("watts"::float8 ORDER BY "time") `+
+		`FROM "public"."power" WHERE "time" >= $1::timestamptz AND "time" <= $2::timestamptz HAVING count(*) > 0`, sql)
+}
@@ -0,0 +1,76 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+)
+
+// labelsInRangeSQLFormat selects the distinct labels of the series that have
+// a sample in the time range, the label names when $4 is NULL and the values
+// of the label named $4 otherwise.
+const labelsInRangeSQLFormat = `SELECT DISTINCT CASE WHEN $4::TEXT IS NULL THEN l.key ELSE l.value END
+FROM ` + schema.Catalog + `.series s
+CROSS JOIN LATERAL unnest(s.labels) AS lid
+INNER JOIN ` + schema.Catalog + `.label l ON l.id = lid
+WHERE s.id = ANY($1) AND ($4::TEXT IS NULL OR l.key = $4::TEXT)
+AND EXISTS (SELECT 1 FROM %s d WHERE d.series_id = s.id AND d.time >= $2 AND d.time <= $3)`
+
+// LabelQuerier is implemented by the queriers that can return the label
+// names and values of the series matching selectors.
+type LabelQuerier interface {
+	// LabelNames returns the sorted names of the labels of the series
+	// matching any of the matcher sets that have samples between mint and
+	// maxt.
+	LabelNames(ctx context.Context, mint, maxt int64, matcherSets ...[]*labels.Matcher) ([]string, error)
+	// LabelValues returns the sorted values of the label name of the
+	// series matching any of the matcher sets that have samples between
+	// mint and maxt.
+	LabelValues(ctx context.Context, mint, maxt int64, name string, matcherSets ...[]*labels.Matcher) ([]string, error)
+}
+
+var _ LabelQuerier = (*pgxQuerier)(nil)
+
+// LabelNames implements the LabelQuerier interface.
+func (q *pgxQuerier) LabelNames(ctx context.Context, mint, maxt int64, matcherSets ...[]*labels.Matcher) ([]string, error) {
+	return q.selectLabels(ctx, mint, maxt, nil, matcherSets)
+}
+
+// LabelValues implements the LabelQuerier interface.
+func (q *pgxQuerier) LabelValues(ctx context.Context, mint, maxt int64, name string, matcherSets ...[]*labels.Matcher) ([]string, error) {
+	return q.selectLabels(ctx, mint, maxt, &name, matcherSets)
+}
+
+// selectLabels returns the label names if name is nil, and the values of the
+// label otherwise. The matchers are resolved against the series table, and
+// the samples of the series are only probed for their existence in the time
+// range.
+func (q *pgxQuerier) selectLabels(ctx context.Context, mint, maxt int64, name *string, matcherSets [][]*labels.Matcher) ([]string, error) {
+	distinct := make(map[string]struct{})
+	for _, matchers := range matcherSets {
+		err := q.queryMatchingSeries(ctx, mint, maxt, matchers, labelsInRangeSQLFormat, []interface{}{name}, func(rows pgx.Rows) error {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				return err
+			}
+			distinct[s] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := make([]string, 0, len(distinct))
+	for s := range distinct {
+		res = append(res, s)
+	}
+	sort.Strings(res)
+	return res, nil
+}
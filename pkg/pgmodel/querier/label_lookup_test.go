@@ -0,0 +1,59 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestSelectLabels(t *testing.T) {
+	cb, err := BuildSubQueries([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "api")})
+	require.NoError(t, err)
+	clauses, values, err := cb.Build(true)
+	require.NoError(t, err)
+	jobSQL := BuildMetricNameSeriesIDQuery(clauses)
+	start, end := timestamp.Time(1000), timestamp.Time(2000)
+	name := "instance"
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: jobSQL, Args: values, Results: model.RowResults{{"prom_data", "up", []int64{1, 2}}, {"prom_data", "cpu", []int64{3}}}},
+		{
+			Sql:     fmt.Sprintf(labelsInRangeSQLFormat, `"prom_data"."up"`),
+			Args:    []interface{}{[]int64{1, 2}, start, end, (*string)(nil)},
+			Results: model.RowResults{{"__name__"}, {"job"}, {"instance"}},
+		},
+		{
+			Sql:     fmt.Sprintf(labelsInRangeSQLFormat, `"prom_data"."cpu"`),
+			Args:    []interface{}{[]int64{3}, start, end, (*string)(nil)},
+			Results: model.RowResults{{"__name__"}, {"job"}, {"mode"}},
+		},
+		{Sql: jobSQL, Args: values, Results: model.RowResults{{"prom_data", "up", []int64{1, 2}}}},
+		{
+			Sql:     fmt.Sprintf(labelsInRangeSQLFormat, `"prom_data"."up"`),
+			Args:    []interface{}{[]int64{1, 2}, start, end, &name},
+			Results: model.RowResults{{"b:9090"}, {"a:9090"}},
+		},
+	}, t)
+	metrics := &model.MockMetricCache{MetricCache: map[string]model.MetricInfo{}}
+	require.NoError(t, metrics.Set("prom_data", "up", model.MetricInfo{TableSchema: "prom_data", TableName: "up", SeriesTable: "up"}))
+	require.NoError(t, metrics.Set("prom_data", "cpu", model.MetricInfo{TableSchema: "prom_data", TableName: "cpu", SeriesTable: "cpu"}))
+	q := &pgxQuerier{conn: mock, metricTableNames: metrics}
+	job := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "api")}
+
+	names, err := q.LabelNames(context.Background(), 1000, 2000, job)
+	require.NoError(t, err)
+	require.Equal(t, []string{"__name__", "instance", "job", "mode"}, names)
+
+	vals, err := q.LabelValues(context.Background(), 1000, 2000, "instance", job)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:9090", "b:9090"}, vals)
+}
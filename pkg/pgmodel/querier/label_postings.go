@@ -0,0 +1,103 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	labelPostingsEnabledSQL = "SELECT " + schema.Catalog + ".label_postings_enabled()"
+	labelKeyValuesSQL       = "SELECT key, count(*) FROM " + schema.Catalog + ".label GROUP BY key"
+
+	/* The posting list clauses select the series in the posting lists of the label ids matching the matcher, which
+	* the planner can join with the series instead of testing the labels of every series against a large array of
+	* label ids. They are only used for the matchers not matching the empty value, which require the label. */
+	subQueryPostingsNEQ = "id IN (SELECT p.series_id FROM " + schema.Catalog + ".label_posting p WHERE p.label_id IN (SELECT l.id FROM " + schema.Catalog + ".label l WHERE l.key = $%d and l.value != $%d))"
+	subQueryPostingsRE  = "id IN (SELECT p.series_id FROM " + schema.Catalog + ".label_posting p WHERE p.label_id IN (SELECT l.id FROM " + schema.Catalog + ".label l WHERE l.key = $%d and l.value ~ $%d))"
+	subQueryPostingsNRE = "id IN (SELECT p.series_id FROM " + schema.Catalog + ".label_posting p WHERE p.label_id IN (SELECT l.id FROM " + schema.Catalog + ".label l WHERE l.key = $%d and l.value !~ $%d))"
+
+	// labelPostingsRefreshInterval is how long the number of values of the
+	// label keys and whether the posting lists are maintained are cached.
+	labelPostingsRefreshInterval = 10 * time.Minute
+)
+
+// labelPostings estimates the selectivity of the label matchers from the
+// number of values of their label keys, to pick the matchers that the
+// posting lists of the labels are used for. A matcher of a key with many
+// values, other than an equality, matches many label ids, which the default
+// plan tests the labels of every series against.
+type labelPostings struct {
+	conn pgxconn.PgxConn
+	// minValues is the number of values of a label key from which the
+	// posting lists are used for its matchers.
+	minValues int64
+	mux       sync.Mutex
+	enabled   bool
+	keyValues map[string]int64
+	fetched   time.Time
+	now       func() time.Time
+}
+
+func newLabelPostings(conn pgxconn.PgxConn, minValues int64) *labelPostings {
+	return &labelPostings{
+		conn:      conn,
+		minValues: minValues,
+		now:       time.Now,
+	}
+}
+
+// use returns whether the posting lists are used for the matcher.
+func (p *labelPostings) use(m *labels.Matcher) bool {
+	if m.Type == labels.MatchEqual || m.Matches("") {
+		return false
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.keyValues == nil || p.now().Sub(p.fetched) >= labelPostingsRefreshInterval {
+		if err := p.fetch(); err != nil {
+			log.Warn("msg", "error fetching the number of values of the label keys, the label posting lists are not used", "err", err)
+			p.enabled, p.keyValues = false, map[string]int64{}
+		}
+		p.fetched = p.now()
+	}
+	return p.enabled && p.keyValues[m.Name] >= p.minValues
+}
+
+func (p *labelPostings) fetch() error {
+	if err := p.conn.QueryRow(context.Background(), labelPostingsEnabledSQL).Scan(&p.enabled); err != nil {
+		return err
+	}
+	keyValues := make(map[string]int64)
+	if p.enabled {
+		rows, err := p.conn.Query(context.Background(), labelKeyValuesSQL)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				key    string
+				values int64
+			)
+			if err = rows.Scan(&key, &values); err != nil {
+				return err
+			}
+			keyValues[key] = values
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+	p.keyValues = keyValues
+	return nil
+}
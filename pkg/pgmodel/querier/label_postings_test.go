@@ -0,0 +1,60 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestLabelPostings(t *testing.T) {
+	now := time.Unix(100000, 0)
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql:     labelPostingsEnabledSQL,
+			Results: model.RowResults{{true}},
+		},
+		{
+			Sql:     labelKeyValuesSQL,
+			Results: model.RowResults{{"path", int64(5000)}, {"job", int64(3)}},
+		},
+		{
+			Sql:     labelPostingsEnabledSQL,
+			Results: model.RowResults{{false}},
+		},
+	}, t)
+	p := newLabelPostings(mock, 1000)
+	p.now = func() time.Time { return now }
+
+	matchers := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, "__name__", "http_requests_total"),
+		labels.MustNewMatcher(labels.MatchRegexp, "path", "/api/.*"),
+		labels.MustNewMatcher(labels.MatchRegexp, "job", "api.+"),
+		labels.MustNewMatcher(labels.MatchNotRegexp, "path", "/api/.+"),
+		labels.MustNewMatcher(labels.MatchRegexp, "path", "|/api/.+"),
+		labels.MustNewMatcher(labels.MatchEqual, "path", "/"),
+	}
+	cb, err := buildSubQueries(matchers, p.use)
+	require.NoError(t, err)
+	clauses, values, err := cb.Build(false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		fmt.Sprintf(subQueryPostingsRE, 1, 2),
+		fmt.Sprintf(subQueryRE, 3, 4),
+		fmt.Sprintf(subQueryNREMatchEmpty, 5, 6),
+		fmt.Sprintf(subQueryREMatchEmpty, 7, 8),
+		fmt.Sprintf(subQueryEQ, 9, 10),
+	}, clauses)
+	require.Equal(t, []interface{}{"path", "^(?:/api/.*)$", "job", "^(?:api.+)$", "path", "^(?:/api/.+)$", "path", "^(?:|/api/.+)$", "path", "/"}, values)
+
+	// The posting lists are no longer used once they are disabled.
+	now = now.Add(labelPostingsRefreshInterval)
+	require.False(t, p.use(matchers[1]))
+}
@@ -0,0 +1,111 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// labelResolveBatchSize is the number of new label ids that are gathered
+// from the fetched rows before they are sent to be resolved.
+const labelResolveBatchSize = 1000
+
+// labelResolver resolves label ids into labels concurrently with the
+// fetching of the rows that reference them, so that the label lookups
+// overlap with the decoding of the remaining rows instead of all being
+// done once every row was fetched.
+type labelResolver struct {
+	querier labelQuerier
+	batches chan map[int64]labels.Label
+	done    chan struct{}
+
+	// owned by the resolving goroutine until done is closed.
+	resolved map[int64]labels.Label
+	err      error
+
+	// owned by the fetching goroutine.
+	seen    map[int64]struct{}
+	pending map[int64]labels.Label
+}
+
+func newLabelResolver(querier labelQuerier) *labelResolver {
+	r := &labelResolver{
+		querier:  querier,
+		batches:  make(chan map[int64]labels.Label, 1),
+		done:     make(chan struct{}),
+		resolved: make(map[int64]labels.Label),
+		seen:     make(map[int64]struct{}),
+		pending:  make(map[int64]labels.Label),
+	}
+	go r.run()
+	return r
+}
+
+func (r *labelResolver) run() {
+	defer close(r.done)
+	for batch := range r.batches {
+		if r.err != nil {
+			continue
+		}
+		// The series whose labels are missing are left out of the results
+		// by the series sets.
+		if err := r.querier.LabelsForIdMap(batch); err != nil && !isMissingLabels(err) {
+			r.err = err
+			continue
+		}
+		for id, label := range batch {
+			r.resolved[id] = label
+		}
+	}
+}
+
+// add queues the label ids of a fetched row to be resolved. A nil resolver
+// does nothing, for the rows whose labels are resolved lazily.
+func (r *labelResolver) add(ids []int64) {
+	if r == nil {
+		return
+	}
+	for _, id := range ids {
+		//id==0 means there is no label for the key, so nothing to look up
+		if id == 0 {
+			continue
+		}
+		if _, ok := r.seen[id]; ok {
+			continue
+		}
+		r.seen[id] = struct{}{}
+		r.pending[id] = labels.Label{}
+	}
+	if len(r.pending) >= labelResolveBatchSize {
+		r.flush()
+	}
+}
+
+func (r *labelResolver) flush() {
+	if len(r.pending) == 0 {
+		return
+	}
+	r.batches <- r.pending
+	r.pending = make(map[int64]labels.Label)
+}
+
+// wait resolves the remaining label ids and returns the labels of all the
+// ids that were added. The resolver cannot be used afterwards.
+func (r *labelResolver) wait() (map[int64]labels.Label, error) {
+	r.flush()
+	close(r.batches)
+	<-r.done
+	return r.resolved, r.err
+}
+
+// discard stops the resolver without resolving the label ids that were
+// not sent yet, when the fetched rows are not going to be used.
+func (r *labelResolver) discard() {
+	if r == nil {
+		return
+	}
+	close(r.batches)
+	<-r.done
+}
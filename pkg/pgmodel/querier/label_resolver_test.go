@@ -0,0 +1,66 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+type countingQuerier struct {
+	lookups int
+	ids     int
+	err     error
+}
+
+func (c *countingQuerier) LabelsForIdMap(idMap map[int64]labels.Label) error {
+	c.lookups++
+	c.ids += len(idMap)
+	if c.err != nil {
+		return c.err
+	}
+	for id := range idMap {
+		idMap[id] = labels.Label{Name: "k", Value: fmt.Sprint(id)}
+	}
+	return nil
+}
+
+func TestLabelResolver(t *testing.T) {
+	querier := &countingQuerier{}
+	resolver := newLabelResolver(querier)
+
+	// Every id appears in two rows and id 0 is never looked up.
+	for i := int64(0); i < 2*labelResolveBatchSize; i++ {
+		resolver.add([]int64{0, i + 1, i/2 + 1})
+	}
+
+	resolved, err := resolver.wait()
+	require.NoError(t, err)
+	require.Len(t, resolved, 2*labelResolveBatchSize)
+	require.Equal(t, labels.Label{Name: "k", Value: "42"}, resolved[42])
+	require.Equal(t, 2*labelResolveBatchSize, querier.ids, "ids must only be looked up once")
+	require.Equal(t, 2, querier.lookups, "ids must be looked up in batches while rows are added")
+}
+
+func TestLabelResolverError(t *testing.T) {
+	querier := &countingQuerier{err: fmt.Errorf("lookup failed")}
+	resolver := newLabelResolver(querier)
+	resolver.add([]int64{1, 2})
+
+	_, err := resolver.wait()
+	require.Equal(t, querier.err, err)
+}
+
+func TestLabelResolverDiscard(t *testing.T) {
+	querier := &countingQuerier{}
+	resolver := newLabelResolver(querier)
+	resolver.add([]int64{1, 2})
+	resolver.discard()
+
+	require.Equal(t, 0, querier.lookups)
+}
@@ -0,0 +1,163 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// labelRewriter returns the rewritten labels of a series.
+type labelRewriter func(labels.Labels) labels.Labels
+
+/* getLabelRewriter checks if the node processed by the pushdown is the argument of a label_replace
+* or label_join call. If so, it returns the rewrite that call applies to the labels of each series,
+* along with the call node. The rewrite is then applied on the resolved labels of the series set,
+* instead of the engine materializing every series and rewriting its labels at each step. */
+func getLabelRewriter(node parser.Node, qh *QueryHints, path []parser.Node) (labelRewriter, parser.Node) {
+	if node == nil || qh == nil {
+		return nil, nil
+	}
+
+	parentIdx := -1
+	if node == qh.CurrentNode {
+		parentIdx = len(path) - 1
+	} else {
+		for i := range path {
+			if path[i] == node {
+				parentIdx = i - 1
+				break
+			}
+		}
+	}
+	if parentIdx < 0 {
+		return nil, nil
+	}
+
+	call, isCall := path[parentIdx].(*parser.Call)
+	if !isCall || len(call.Args) == 0 || unwrapExpr(call.Args[0]) != node {
+		return nil, nil
+	}
+
+	var rewrite labelRewriter
+	switch call.Func.Name {
+	case "label_replace":
+		rewrite = labelReplace(call.Args)
+	case "label_join":
+		rewrite = labelJoin(call.Args)
+	}
+	if rewrite == nil {
+		return nil, nil
+	}
+
+	//all range-vector function calls have their metric name dropped before
+	//their result gets to the label rewrite, see eval() in engine.go
+	if _, isRangeCall := node.(*parser.Call); isRangeCall {
+		rewriteLabels := rewrite
+		rewrite = func(lls labels.Labels) labels.Labels {
+			return rewriteLabels(labels.NewBuilder(lls).Del(labels.MetricName).Labels())
+		}
+	}
+	return rewrite, call
+}
+
+// labelReplace returns the rewrite done by label_replace, or nil if the
+// arguments are invalid, leaving the error to be reported by the engine.
+func labelReplace(args parser.Expressions) labelRewriter {
+	if len(args) != 5 {
+		return nil
+	}
+	var (
+		dst, okDst      = stringArg(args[1])
+		repl, okRepl    = stringArg(args[2])
+		src, okSrc      = stringArg(args[3])
+		regexStr, okReg = stringArg(args[4])
+	)
+	if !okDst || !okRepl || !okSrc || !okReg || !model.LabelNameRE.MatchString(dst) {
+		return nil
+	}
+	regex, err := regexp.Compile("^(?:" + regexStr + ")$")
+	if err != nil {
+		return nil
+	}
+
+	return func(lls labels.Labels) labels.Labels {
+		srcVal := lls.Get(src)
+		indexes := regex.FindStringSubmatchIndex(srcVal)
+		if indexes == nil {
+			// If there is no match, no replacement should take place.
+			return lls
+		}
+		res := regex.ExpandString([]byte{}, repl, srcVal, indexes)
+
+		lb := labels.NewBuilder(lls).Del(dst)
+		if len(res) > 0 {
+			lb.Set(dst, string(res))
+		}
+		return lb.Labels()
+	}
+}
+
+// labelJoin returns the rewrite done by label_join, or nil if the
+// arguments are invalid, leaving the error to be reported by the engine.
+func labelJoin(args parser.Expressions) labelRewriter {
+	if len(args) < 3 {
+		return nil
+	}
+	dst, okDst := stringArg(args[1])
+	sep, okSep := stringArg(args[2])
+	if !okDst || !okSep || !model.LabelName(dst).IsValid() {
+		return nil
+	}
+	srcLabels := make([]string, len(args)-3)
+	for i := 3; i < len(args); i++ {
+		src, ok := stringArg(args[i])
+		if !ok || !model.LabelName(src).IsValid() {
+			return nil
+		}
+		srcLabels[i-3] = src
+	}
+
+	return func(lls labels.Labels) labels.Labels {
+		srcVals := make([]string, len(srcLabels))
+		for i, src := range srcLabels {
+			srcVals[i] = lls.Get(src)
+		}
+
+		lb := labels.NewBuilder(lls)
+		strval := strings.Join(srcVals, sep)
+		if strval == "" {
+			lb.Del(dst)
+		} else {
+			lb.Set(dst, strval)
+		}
+		return lb.Labels()
+	}
+}
+
+func stringArg(e parser.Expr) (string, bool) {
+	s, ok := unwrapExpr(e).(*parser.StringLiteral)
+	if !ok {
+		return "", false
+	}
+	return s.Val, true
+}
+
+func unwrapExpr(e parser.Expr) parser.Expr {
+	for {
+		switch n := e.(type) {
+		case *parser.ParenExpr:
+			e = n.Expr
+		case *parser.StepInvariantExpr:
+			e = n.Expr
+		default:
+			return e
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLabelRewriter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		query      string
+		rangeCall  bool
+		input      labels.Labels
+		expected   labels.Labels
+		noPushdown bool
+	}{
+		{
+			name:     "label_replace",
+			query:    `label_replace(up, "host", "$1", "instance", "(.*):.*")`,
+			input:    labels.FromStrings("__name__", "up", "instance", "foo:9090"),
+			expected: labels.FromStrings("__name__", "up", "host", "foo", "instance", "foo:9090"),
+		},
+		{
+			name:     "label_replace without a match",
+			query:    `label_replace(up, "host", "$1", "instance", "(.*):.*")`,
+			input:    labels.FromStrings("__name__", "up", "instance", "foo"),
+			expected: labels.FromStrings("__name__", "up", "instance", "foo"),
+		},
+		{
+			name:     "label_replace deleting a label",
+			query:    `label_replace(up, "instance", "", "", "")`,
+			input:    labels.FromStrings("__name__", "up", "instance", "foo"),
+			expected: labels.FromStrings("__name__", "up"),
+		},
+		{
+			name:     "label_join",
+			query:    `label_join(up, "dst", "-", "job", "instance")`,
+			input:    labels.FromStrings("__name__", "up", "instance", "foo", "job", "bar"),
+			expected: labels.FromStrings("__name__", "up", "dst", "bar-foo", "instance", "foo", "job", "bar"),
+		},
+		{
+			name:      "label_replace over a range function drops the metric name first",
+			query:     `label_replace(rate(up[5m]), "name", "$1", "__name__", "(.*)")`,
+			rangeCall: true,
+			input:     labels.FromStrings("__name__", "up", "job", "bar"),
+			expected:  labels.FromStrings("job", "bar"),
+		},
+		{
+			name:       "invalid regex",
+			query:      `label_replace(up, "host", "$1", "instance", "(.*")`,
+			noPushdown: true,
+		},
+		{
+			name:       "invalid destination label",
+			query:      `label_join(up, "0dst", "-", "job")`,
+			noPushdown: true,
+		},
+		{
+			name:       "not an argument of a label rewrite",
+			query:      `abs(up)`,
+			noPushdown: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(c.query)
+			require.NoError(t, err)
+
+			var (
+				qh   *QueryHints
+				path []parser.Node
+				call *parser.Call
+			)
+			parser.Inspect(expr, func(node parser.Node, p []parser.Node) error {
+				switch n := node.(type) {
+				case *parser.VectorSelector:
+					qh = &QueryHints{CurrentNode: n}
+					path = append([]parser.Node{}, p...)
+				case *parser.Call:
+					if call == nil {
+						call = n
+					}
+				}
+				return nil
+			})
+
+			// The pushed down node is the vector selector itself or the range
+			// function call wrapping its matrix selector.
+			var node parser.Node = qh.CurrentNode
+			if c.rangeCall {
+				node = path[len(path)-2]
+			}
+
+			rewrite, topNode := getLabelRewriter(node, qh, path)
+			if c.noPushdown {
+				require.Nil(t, rewrite)
+				require.Nil(t, topNode)
+				return
+			}
+			require.NotNil(t, rewrite)
+			require.Equal(t, parser.Node(call), topNode)
+			require.Equal(t, c.expected, rewrite(c.input))
+		})
+	}
+}
+
+func TestGetLabelRewriterNoTopNode(t *testing.T) {
+	rewrite, node := getLabelRewriter(nil, &QueryHints{}, nil)
+	require.Nil(t, rewrite)
+	require.Nil(t, node)
+}
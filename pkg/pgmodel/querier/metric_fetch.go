@@ -0,0 +1,80 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/prometheus/storage"
+)
+
+// fetchMetricsConcurrently runs the queries of the rows of several metrics
+// at once, up to MetricFetchConcurrency of them, each on its own connection,
+// and returns their rows in the order of the queries. The label ids of the
+// rows are only added to the resolver once every query returned, since the
+// resolver is not safe for concurrent use.
+//
+// With PartialResponse, the rows of the metrics whose query fails are left
+// out with a warning, unless the queries of all the metrics fail.
+func (q *pgxQuerier) fetchMetricsConcurrently(ctx context.Context, queries, metrics []string, resolver *labelResolver) ([]timescaleRow, storage.Warnings, error) {
+	concurrency := q.cfg.MetricFetchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, concurrency)
+		parts = make([][]timescaleRow, len(queries))
+		errs  = make([]error, len(queries))
+	)
+	for i := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rows, err := q.conn.Query(ctx, queries[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer rows.Close()
+			// Metric name and additional labels are ignored for
+			// multi-metric queries.
+			parts[i], errs[i] = appendTsRows(nil, rows, nil, "", "", "", nil)
+		}(i)
+	}
+	wg.Wait()
+
+	results := getRows()
+	var (
+		err      error
+		warnings storage.Warnings
+	)
+	for i := range parts {
+		if errs[i] != nil {
+			if err == nil {
+				err = errs[i]
+			}
+			if q.cfg.PartialResponse {
+				warnings = append(warnings, fmt.Errorf("metric %s was left out of the results: %w", metrics[i], errs[i]))
+			}
+			continue
+		}
+		results = append(results, parts[i]...)
+	}
+	if err != nil && (!q.cfg.PartialResponse || len(warnings) == len(queries)) {
+		releaseRows(results)
+		return nil, nil, err
+	}
+	for i := range results {
+		resolver.add(results[i].labelIds)
+	}
+	return results, warnings, nil
+}
@@ -0,0 +1,94 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+// querySQLConn answers each query from its own recorder, by SQL, for the
+// queries that run concurrently in no particular order.
+type querySQLConn struct {
+	*model.SqlRecorder
+	bySQL map[string]*model.SqlRecorder
+}
+
+func (c *querySQLConn) Query(ctx context.Context, sql string, args ...interface{}) (pgxconn.PgxRows, error) {
+	return c.bySQL[sql].Query(ctx, sql, args...)
+}
+
+func TestFetchMetricsConcurrently(t *testing.T) {
+	conn := &querySQLConn{SqlRecorder: model.NewSqlRecorder(nil, t), bySQL: make(map[string]*model.SqlRecorder)}
+	var queries, metrics []string
+	for i := int64(1); i <= 3; i++ {
+		sql := fmt.Sprintf("SELECT metric_%d", i)
+		conn.bySQL[sql] = model.NewSqlRecorder([]model.SqlQuery{{
+			Sql:     sql,
+			Results: model.RowResults{{[]int64{i, 10}, []time.Time{time.Unix(i, 0)}, []float64{float64(i)}}},
+		}}, t)
+		queries = append(queries, sql)
+		metrics = append(metrics, fmt.Sprintf("metric_%d", i))
+	}
+	q := &pgxQuerier{conn: conn, cfg: Cfg{MetricFetchConcurrency: 2}}
+	labelsQuerier := &countingQuerier{}
+	resolver := newLabelResolver(labelsQuerier)
+
+	rows, warnings, err := q.fetchMetricsConcurrently(context.Background(), queries, metrics, resolver)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	defer releaseRows(rows)
+	require.Len(t, rows, 3)
+	for i, row := range rows {
+		require.Equal(t, []int64{int64(i + 1), 10}, row.labelIds, "rows must be in the order of the queries")
+	}
+
+	resolved, err := resolver.wait()
+	require.NoError(t, err)
+	require.Len(t, resolved, 4)
+	require.Equal(t, labels.Label{Name: "k", Value: "10"}, resolved[10])
+
+	// The rows are not returned if any query fails.
+	conn.bySQL[queries[1]] = model.NewSqlRecorder([]model.SqlQuery{{Sql: queries[1], Err: fmt.Errorf("query failed")}}, t)
+	for _, sql := range []string{queries[0], queries[2]} {
+		conn.bySQL[sql] = model.NewSqlRecorder([]model.SqlQuery{{Sql: sql, Results: model.RowResults{}}}, t)
+	}
+	resolver = newLabelResolver(labelsQuerier)
+	defer resolver.discard()
+	_, _, err = q.fetchMetricsConcurrently(context.Background(), queries, metrics, resolver)
+	require.EqualError(t, err, "query failed")
+
+	// The other metrics are returned with a warning in partial responses.
+	q.cfg.PartialResponse = true
+	conn.bySQL[queries[1]] = model.NewSqlRecorder([]model.SqlQuery{{Sql: queries[1], Err: fmt.Errorf("query failed")}}, t)
+	for i, sql := range []string{queries[0], queries[2]} {
+		conn.bySQL[sql] = model.NewSqlRecorder([]model.SqlQuery{{
+			Sql:     sql,
+			Results: model.RowResults{{[]int64{int64(i), 10}, []time.Time{time.Unix(1, 0)}, []float64{1}}},
+		}}, t)
+	}
+	resolver = newLabelResolver(labelsQuerier)
+	defer resolver.discard()
+	rows, warnings, err = q.fetchMetricsConcurrently(context.Background(), queries, metrics, resolver)
+	require.NoError(t, err)
+	defer releaseRows(rows)
+	require.Len(t, rows, 2)
+	require.Len(t, warnings, 1)
+	require.EqualError(t, warnings[0], "metric metric_2 was left out of the results: query failed")
+
+	// The query fails if the queries of all the metrics fail.
+	for _, sql := range queries {
+		conn.bySQL[sql] = model.NewSqlRecorder([]model.SqlQuery{{Sql: sql, Err: fmt.Errorf("query failed")}}, t)
+	}
+	_, _, err = q.fetchMetricsConcurrently(context.Background(), queries, metrics, resolver)
+	require.EqualError(t, err, "query failed")
+}
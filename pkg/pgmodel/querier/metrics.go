@@ -0,0 +1,29 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+var (
+	ErrUnexpectedNull = fmt.Errorf("unexpected NULL in query results")
+
+	unexpectedNulls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Name:      "query_unexpected_nulls_total",
+			Help:      "Total number of samples with a NULL timestamp or value read from the database by queries.",
+		},
+		[]string{"field"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(unexpectedNulls)
+}
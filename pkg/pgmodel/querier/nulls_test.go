@@ -0,0 +1,65 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIteratorUnexpectedNulls(t *testing.T) {
+	times := []pgtype.Timestamptz{
+		{Time: time.Unix(1, 0), Status: pgtype.Present},
+		{Status: pgtype.Null},
+		{Time: time.Unix(3, 0), Status: pgtype.Present},
+		{Time: time.Unix(4, 0), Status: pgtype.Present},
+	}
+	values := []pgtype.Float8{
+		{Float: 1, Status: pgtype.Present},
+		{Float: 2, Status: pgtype.Present},
+		{Status: pgtype.Null},
+		{Float: 4, Status: pgtype.Present},
+	}
+	lls := labels.FromStrings("__name__", "foo")
+
+	timeNulls := testutil.ToFloat64(unexpectedNulls.WithLabelValues("time"))
+	valueNulls := testutil.ToFloat64(unexpectedNulls.WithLabelValues("value"))
+
+	// By default the NULLs are skipped and counted once, even when
+	// the iterator is seeked once exhausted.
+	it := newIterator(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values), Cfg{})
+	var ts []int64
+	for it.Next() {
+		t, _ := it.At()
+		ts = append(ts, t)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int64{1000, 4000}, ts)
+	require.False(t, it.Seek(0))
+	require.False(t, it.Next())
+	require.Equal(t, timeNulls+1, testutil.ToFloat64(unexpectedNulls.WithLabelValues("time")))
+	require.Equal(t, valueNulls+1, testutil.ToFloat64(unexpectedNulls.WithLabelValues("value")))
+
+	// In strict mode they fail the iteration.
+	it = newIterator(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values), Cfg{StrictNulls: true})
+	it.labels = lls
+	require.True(t, it.Next())
+	require.False(t, it.Next())
+	require.True(t, errors.Is(it.Err(), ErrUnexpectedNull))
+	require.Contains(t, it.Err().Error(), lls.String())
+
+	// NULL values of pushed down aggregates are expected.
+	regular := newRegularTimestampSeries(time.Unix(1, 0), time.Unix(4, 0), time.Second)
+	it = newIterator(regular, toFloat8Array(values), Cfg{StrictNulls: true})
+	for it.Next() {
+	}
+	require.NoError(t, it.Err())
+}
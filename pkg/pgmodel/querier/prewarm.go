@@ -0,0 +1,201 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	prewarmSQL = "SELECT blocks IS NOT NULL, coalesce(blocks, 0) FROM " + schema.Catalog + ".prewarm_metric_chunks($1, $2, $3, $4) blocks"
+
+	// Queries ending more than relativeQueryDelay before they run read
+	// historical data, which is not refreshed.
+	relativeQueryDelay = time.Minute
+	// The queries of a metric within minRefreshInterval of each other, e.g.
+	// by the panels of a dashboard, are part of the same refresh. Refreshes
+	// further apart than maxRefreshInterval are not predicted, since the
+	// chunks would be evicted before the refresh.
+	minRefreshInterval = 10 * time.Second
+	maxRefreshInterval = time.Hour
+	// refreshJitter is the fraction of the refresh interval that refreshes
+	// may deviate by and still be regular.
+	refreshJitter = 0.1
+	// regularRefreshes is the number of refreshes at a regular interval
+	// after which the next one is predicted.
+	regularRefreshes  = 3
+	prewarmCheckEvery = time.Second
+)
+
+var prewarms = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "query_prewarm_total",
+		Help:      "Total number of times the chunks read by a predicted dashboard refresh were loaded in memory ahead of it, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(prewarms)
+}
+
+// prewarmKey identifies the queries repeatedly reading the last window of
+// a metric table, e.g. a dashboard panel showing the last 6 hours.
+type prewarmKey struct {
+	schema, table string
+	window        time.Duration
+}
+
+type refreshPattern struct {
+	last      time.Time
+	interval  time.Duration
+	regular   int
+	prewarmed time.Time
+}
+
+// Prewarmer learns the refresh interval of the queries reading the last
+// window of a metric table, as dashboards do, and loads the chunks that the
+// next refresh reads in memory with pg_prewarm shortly before it, so that
+// the refresh does not wait on the disk after the chunks were evicted.
+type Prewarmer struct {
+	conn     pgxconn.PgxConn
+	lead     time.Duration
+	mux      sync.Mutex
+	patterns map[prewarmKey]*refreshPattern
+	disabled bool
+	now      func() time.Time
+}
+
+// NewPrewarmer returns a prewarmer loading the chunks lead before the
+// predicted refreshes, until sigClose is closed.
+func NewPrewarmer(conn pgxconn.PgxConn, lead time.Duration, sigClose <-chan struct{}) *Prewarmer {
+	p := newPrewarmer(conn, lead)
+	go p.run(sigClose)
+	return p
+}
+
+func newPrewarmer(conn pgxconn.PgxConn, lead time.Duration) *Prewarmer {
+	return &Prewarmer{
+		conn:     conn,
+		lead:     lead,
+		patterns: make(map[prewarmKey]*refreshPattern),
+		now:      time.Now,
+	}
+}
+
+// record tracks a query reading the metric table from start to end, in
+// milliseconds.
+func (p *Prewarmer) record(schemaName, table string, start, end int64) {
+	if start == minTime || end == maxTime {
+		return
+	}
+	now := p.now()
+	if now.Sub(timestamp.Time(end)) > relativeQueryDelay {
+		return
+	}
+	key := prewarmKey{schema: schemaName, table: table, window: (time.Duration(end-start) * time.Millisecond).Round(time.Minute)}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.disabled {
+		return
+	}
+	pattern, ok := p.patterns[key]
+	if !ok {
+		p.patterns[key] = &refreshPattern{last: now}
+		return
+	}
+	interval := now.Sub(pattern.last)
+	if interval < minRefreshInterval {
+		return
+	}
+	deviation := interval - pattern.interval
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	if pattern.interval > 0 && float64(deviation) <= refreshJitter*float64(pattern.interval) {
+		pattern.regular++
+	} else {
+		pattern.regular = 1
+	}
+	pattern.last, pattern.interval = now, interval
+}
+
+func (p *Prewarmer) run(sigClose <-chan struct{}) {
+	ticker := time.NewTicker(prewarmCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.prewarmDue()
+		case <-sigClose:
+			return
+		}
+	}
+}
+
+// prewarmDue loads the chunks of the refreshes due within the lead time, and
+// forgets the patterns that stopped.
+func (p *Prewarmer) prewarmDue() {
+	now := p.now()
+	type prewarm struct {
+		key        prewarmKey
+		start, end time.Time
+	}
+	var due []prewarm
+
+	p.mux.Lock()
+	for key, pattern := range p.patterns {
+		// Patterns are kept for a few missed refreshes, as dashboards are
+		// not refreshed while they are in a background tab.
+		if since := now.Sub(pattern.last); since > 3*pattern.interval && since > 3*minRefreshInterval {
+			delete(p.patterns, key)
+			continue
+		}
+		if pattern.regular < regularRefreshes || pattern.interval > maxRefreshInterval {
+			continue
+		}
+		next := pattern.last.Add(pattern.interval)
+		if now.Before(next.Add(-p.lead)) || !now.Before(next) || pattern.prewarmed.Equal(next) {
+			continue
+		}
+		pattern.prewarmed = next
+		due = append(due, prewarm{key: key, start: next.Add(-key.window), end: next})
+	}
+	p.mux.Unlock()
+
+	for _, d := range due {
+		var (
+			installed bool
+			blocks    int64
+		)
+		err := p.conn.QueryRow(context.Background(), prewarmSQL, d.key.schema, d.key.table, d.start, d.end).Scan(&installed, &blocks)
+		switch {
+		case err != nil:
+			prewarms.WithLabelValues("failed").Inc()
+			log.Warn("msg", "error prewarming the chunks of a metric", "table", d.key.table, "err", err)
+		case !installed:
+			log.Warn("msg", "the pg_prewarm extension is not installed in the database, chunks are not prewarmed")
+			p.mux.Lock()
+			p.disabled = true
+			p.patterns = make(map[prewarmKey]*refreshPattern)
+			p.mux.Unlock()
+			return
+		default:
+			prewarms.WithLabelValues("success").Inc()
+			log.Debug("msg", "prewarmed the chunks of a metric", "table", d.key.table, "window", d.key.window, "blocks", blocks)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestPrewarmer(t *testing.T) {
+	now := time.Unix(100000, 0)
+	window := 6 * time.Hour
+	refresh := func(p *Prewarmer) {
+		p.record("prom_data", "cpu", timestamp.FromTime(now.Add(-window)), timestamp.FromTime(now))
+	}
+	nextRefresh := now.Add(4 * time.Minute)
+	mock := model.NewSqlRecorder([]model.SqlQuery{{
+		Sql:     prewarmSQL,
+		Args:    []interface{}{"prom_data", "cpu", nextRefresh.Add(-window), nextRefresh},
+		Results: model.RowResults{{true, int64(1024)}},
+	}}, t)
+	p := newPrewarmer(mock, 10*time.Second)
+	p.now = func() time.Time { return now }
+
+	// The panels of a dashboard refreshed every minute, the first three
+	// times only establishing the interval.
+	for i := 0; i < 4; i++ {
+		refresh(p)
+		now = now.Add(time.Second)
+		refresh(p)
+		now = now.Add(59 * time.Second)
+	}
+	// Historical queries are not refreshed.
+	p.record("prom_data", "cpu", timestamp.FromTime(now.Add(-2*window)), timestamp.FromTime(now.Add(-window)))
+	require.Len(t, p.patterns, 1)
+	pattern := p.patterns[prewarmKey{schema: "prom_data", table: "cpu", window: window}]
+	require.Equal(t, regularRefreshes, pattern.regular)
+	require.Equal(t, time.Minute, pattern.interval)
+
+	// The chunks are only prewarmed once, within the lead time.
+	now = nextRefresh.Add(-20 * time.Second)
+	p.prewarmDue()
+	now = nextRefresh.Add(-5 * time.Second)
+	p.prewarmDue()
+	p.prewarmDue()
+	require.Equal(t, nextRefresh, pattern.prewarmed)
+
+	// The dashboard was closed.
+	now = now.Add(time.Hour)
+	p.prewarmDue()
+	require.Empty(t, p.patterns)
+}
+
+func TestPrewarmerWithoutExtension(t *testing.T) {
+	now := time.Unix(100000, 0)
+	mock := model.NewSqlRecorder([]model.SqlQuery{{
+		Sql:     prewarmSQL,
+		Args:    []interface{}{"prom_data", "cpu", now.Add(-time.Hour), now},
+		Results: model.RowResults{{false, int64(0)}},
+	}}, t)
+	p := newPrewarmer(mock, time.Minute)
+	key := prewarmKey{schema: "prom_data", table: "cpu", window: time.Hour}
+	p.patterns[key] = &refreshPattern{last: now.Add(-time.Minute), interval: time.Minute, regular: regularRefreshes}
+	p.now = func() time.Time { return now.Add(-time.Second) }
+
+	p.prewarmDue()
+	require.True(t, p.disabled)
+	require.Empty(t, p.patterns)
+	p.record("prom_data", "cpu", timestamp.FromTime(now.Add(-time.Hour)), timestamp.FromTime(now))
+	require.Empty(t, p.patterns)
+}
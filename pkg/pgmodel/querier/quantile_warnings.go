@@ -0,0 +1,48 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// quantileWarning returns the warning of a select of the buckets of
+// histogram_quantile that reads the rolled-up buckets of a query view instead
+// of the raw samples, nil if the select does not.
+//
+// The samples of the view are a resolution apart, so the first and last
+// samples of a range may be up to a resolution away from its bounds, and
+// the change of a bucket over the range, from which its rate is
+// extrapolated, may be off by up to the resolution over the range. Without
+// a range, the buckets may lag their raw samples by up to the resolution.
+func quantileWarning(metric string, view *queryView, hints *storage.SelectHints, path []parser.Node) error {
+	if view == nil || hints == nil || !calledByHistogramQuantile(path) {
+		return nil
+	}
+	if hints.Range > 0 {
+		window := time.Duration(hints.Range) * time.Millisecond
+		return fmt.Errorf("histogram_quantile over %s is computed from buckets rolled up to a resolution of %v by the query view %s.%s: "+
+			"the change of each bucket over each %v range may be off by up to %.0f%%",
+			metric, view.resolution, view.schema, view.name, window, 100*float64(view.resolution)/float64(window))
+	}
+	return fmt.Errorf("histogram_quantile over %s is computed from buckets rolled up to a resolution of %v by the query view %s.%s: "+
+		"each bucket may lag its raw samples by up to %v",
+		metric, view.resolution, view.schema, view.name, view.resolution)
+}
+
+// calledByHistogramQuantile returns whether the selector of the path is
+// within the arguments of histogram_quantile.
+func calledByHistogramQuantile(path []parser.Node) bool {
+	for _, node := range path {
+		if call, ok := node.(*parser.Call); ok && call.Func.Name == "histogram_quantile" {
+			return true
+		}
+	}
+	return false
+}
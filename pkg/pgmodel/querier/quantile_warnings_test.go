@@ -0,0 +1,66 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantileWarning(t *testing.T) {
+	view := &queryView{schema: "views", name: "latency_1m", column: "value", resolution: time.Minute}
+	testCases := []struct {
+		query   string
+		view    *queryView
+		hints   *storage.SelectHints
+		warning string
+	}{
+		{
+			query:   "histogram_quantile(0.9, sum by (le) (rate(latency_bucket[5m])))",
+			view:    view,
+			hints:   &storage.SelectHints{Step: 60000, Range: 300000, Func: "rate"},
+			warning: "histogram_quantile over latency_bucket is computed from buckets rolled up to a resolution of 1m0s by the query view views.latency_1m: the change of each bucket over each 5m0s range may be off by up to 20%",
+		},
+		{
+			query:   "histogram_quantile(0.9, latency_bucket)",
+			view:    view,
+			hints:   &storage.SelectHints{Step: 60000},
+			warning: "histogram_quantile over latency_bucket is computed from buckets rolled up to a resolution of 1m0s by the query view views.latency_1m: each bucket may lag its raw samples by up to 1m0s",
+		},
+		{
+			query: "histogram_quantile(0.9, sum by (le) (rate(latency_bucket[5m])))",
+			hints: &storage.SelectHints{Step: 60000, Range: 300000, Func: "rate"},
+		},
+		{
+			query: "sum by (le) (rate(latency_bucket[5m]))",
+			view:  view,
+			hints: &storage.SelectHints{Step: 60000, Range: 300000, Func: "rate"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.query)
+			require.NoError(t, err)
+			var selectorPath []parser.Node
+			parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+				if _, ok := node.(*parser.VectorSelector); ok {
+					selectorPath = append([]parser.Node{}, path...)
+				}
+				return nil
+			})
+
+			warning := quantileWarning("latency_bucket", tc.view, tc.hints, selectorPath)
+			if tc.warning == "" {
+				require.NoError(t, warning)
+				return
+			}
+			require.EqualError(t, warning, tc.warning)
+		})
+	}
+}
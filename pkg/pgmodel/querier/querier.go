@@ -9,17 +9,21 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v4"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/chaos"
+	"github.com/timescale/promscale/pkg/encryption"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
 	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
 	"github.com/timescale/promscale/pkg/pgmodel/lreader"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/usage"
 	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/prompb"
 	"github.com/timescale/promscale/pkg/tenancy"
@@ -30,6 +34,77 @@ type Reader interface {
 	Read(*prompb.ReadRequest) (*prompb.ReadResponse, error)
 }
 
+// Cfg configures how the querier matches the series and returns their samples.
+type Cfg struct {
+	// Duplicates picks the sample returned for samples with the same timestamp.
+	Duplicates DuplicatePolicy
+	// StrictNulls fails queries that read samples with a NULL timestamp
+	// or value from the database, instead of skipping those samples.
+	StrictNulls bool
+	// LabelEncryptor encrypts the values matched against encrypted labels,
+	// nil if no label is encrypted.
+	LabelEncryptor *encryption.LabelEncryptor
+	// ReadEndpoints are the connections to the read endpoints, by name,
+	// that the queries of a metric can be pinned to with a query route.
+	ReadEndpoints map[string]pgxconn.PgxConn
+	// Prewarmer loads the chunks read by the predicted refreshes of
+	// dashboards in memory ahead of them, nil if disabled.
+	Prewarmer *Prewarmer
+	// LabelPostingsMinValues is the number of values of a label key from
+	// which its matchers, other than equalities, select the series from the
+	// posting lists of the labels once they are enabled in the database, 0
+	// to never use them.
+	LabelPostingsMinValues int64
+	// Usage records how far back the queries of each metric read, nil if
+	// disabled.
+	Usage *usage.Recorder
+	// StreamFetchSize is the number of series that the series sets of
+	// unsorted single-metric selects fetch at a time from a cursor, as they
+	// are iterated, 0 to fetch all the series up front.
+	StreamFetchSize int
+	// LazyLabels resolves the labels of the series returned by selects as
+	// the series are accessed, instead of all before the series are
+	// returned.
+	LazyLabels bool
+	// StepReductionMinStep is the minimum step of the range queries whose
+	// vector selectors fetch only the last sample of each step, bucketed
+	// with time_bucket in the database, 0 to fetch every sample.
+	StepReductionMinStep time.Duration
+	// RatePushdown evaluates rate, increase and delta in the database with
+	// a function of the catalog when the Promscale extension does not.
+	RatePushdown bool
+	// AggregatePushdown evaluates the sum, avg, min and max aggregations by
+	// labels of selectors in the database, grouping the series by the ids
+	// of their labels, and ranks the series of topk and bottomk to only
+	// return the k first of each group.
+	AggregatePushdown bool
+	// RemoteReadConcurrency is the number of queries of a remote-read
+	// request that run at once.
+	RemoteReadConcurrency int
+	// MetricFetchConcurrency is the number of metrics whose rows are
+	// fetched at once by the selectors matching several metrics, each on
+	// its own connection. With 1, the rows of all the metrics are fetched
+	// in a single batch.
+	MetricFetchConcurrency int
+	// QuantileWarnings warns about the selects of the buckets of
+	// histogram_quantile that read rolled-up buckets from a query view,
+	// bounding the error of their quantiles.
+	QuantileWarnings bool
+	// PartialResponse leaves the metrics whose query fails out of the
+	// results of the selectors matching several metrics, with a warning,
+	// instead of failing the select. The rows of each metric are then
+	// fetched with a query of their own rather than in a single batch.
+	PartialResponse bool
+	// MaxSamples is the maximum number of samples the selects of a query
+	// fetch from the database, 0 for no limit. Queries going over it fail
+	// with an ErrQueryLimit while their series sets are built, see
+	// WithQueryBudget.
+	MaxSamples int64
+	// MaxBytes is the maximum estimated size in memory of the samples and
+	// series the selects of a query fetch, 0 for no limit.
+	MaxBytes int64
+}
+
 type QueryHints struct {
 	StartTime   time.Time
 	EndTime     time.Time
@@ -49,7 +124,9 @@ type Querier interface {
 	// Query returns resulting timeseries for a query.
 	Query(*prompb.Query) ([]*prompb.TimeSeries, error)
 	// Select returns a series set that matches the supplied query parameters.
-	Select(mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, queryHints *QueryHints, path []parser.Node, ms ...*labels.Matcher) (SeriesSet, parser.Node)
+	// The SQL queries of the series set are cancelled in the database when
+	// ctx is done.
+	Select(ctx context.Context, mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, queryHints *QueryHints, path []parser.Node, ms ...*labels.Matcher) (SeriesSet, parser.Node)
 }
 
 const (
@@ -58,12 +135,24 @@ const (
 
 // NewQuerier returns a new pgxQuerier that reads from PostgreSQL using PGX
 // and caches metric table names and label sets using the supplied caches.
-func NewQuerier(conn pgxconn.PgxConn, metricCache cache.MetricCache, labelsReader lreader.LabelsReader, rAuth tenancy.ReadAuthorizer) Querier {
+func NewQuerier(conn pgxconn.PgxConn, metricCache cache.MetricCache, labelsReader lreader.LabelsReader, rAuth tenancy.ReadAuthorizer, cfg *Cfg) Querier {
+	var postings *labelPostings
+	if cfg.LabelPostingsMinValues > 0 {
+		postings = newLabelPostings(conn, cfg.LabelPostingsMinValues)
+	}
 	return &pgxQuerier{
 		conn:             conn,
 		labelsReader:     labelsReader,
 		metricTableNames: metricCache,
 		rAuth:            rAuth,
+		cfg:              *cfg,
+		queryViews:       newQueryViewCache(conn),
+		queryRoutes:      newQueryRouteCache(conn),
+		externalMetrics:  newExternalMetricCache(conn),
+		seriesPartitions: newSeriesPartitionCache(conn),
+		writeShards:      newWriteShardCache(conn),
+		schemaFeatures:   newSchemaFeatures(conn),
+		labelPostings:    postings,
 	}
 }
 
@@ -74,6 +163,23 @@ type metricTimeRangeFilter struct {
 	seriesTable string
 	startTime   string
 	endTime     string
+	// start and end are the time range in milliseconds.
+	start, end int64
+	// seriesPartitioned is set if the metric table is partitioned by the
+	// hash of series_id, which the query can prune on.
+	seriesPartitioned bool
+	// reductionStep is the minimum step of the range queries whose vector
+	// selectors only fetch the last sample of each step, 0 to fetch every
+	// sample.
+	reductionStep time.Duration
+	// ratePushdown evaluates rate, increase and delta in the database.
+	ratePushdown bool
+	// aggregatePushdown evaluates the aggregations by labels of selectors
+	// in the database.
+	aggregatePushdown bool
+	// seriesLimit is the maximum number of series fetched from the metric,
+	// 0 if unlimited, see WithSeriesLimit.
+	seriesLimit int
 }
 
 type pgxQuerier struct {
@@ -81,25 +187,91 @@ type pgxQuerier struct {
 	metricTableNames cache.MetricCache
 	labelsReader     lreader.LabelsReader
 	rAuth            tenancy.ReadAuthorizer
+	cfg              Cfg
+	queryViews       *queryViewCache
+	queryRoutes      *queryRouteCache
+	externalMetrics  *externalMetricCache
+	seriesPartitions *seriesPartitionCache
+	writeShards      *writeShardCache
+	schemaFeatures   *schemaFeatures
+	labelPostings    *labelPostings
+}
+
+// supports returns whether the database schema has the SQL objects added in
+// version v, which is assumed without schema tracking.
+func (q *pgxQuerier) supports(v semver.Version) bool {
+	return q.schemaFeatures == nil || q.schemaFeatures.supports(v)
+}
+
+// readSchema returns the schema of the relation holding all the samples of
+// the metric table: the view of its write shards for the sharded metrics,
+// tableSchema otherwise.
+func (q *pgxQuerier) readSchema(tableSchema, table string) (string, error) {
+	if q.writeShards == nil || tableSchema != schema.Data {
+		return tableSchema, nil
+	}
+	return q.writeShards.readSchema(table)
 }
 
 var _ Querier = (*pgxQuerier)(nil)
 
 // Select implements the Querier interface. It is the entry point for our
 // own version of the Prometheus engine.
-func (q *pgxQuerier) Select(mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, ms ...*labels.Matcher) (SeriesSet, parser.Node) {
-	rows, topNode, err := q.getResultRows(mint, maxt, hints, qh, path, ms)
+func (q *pgxQuerier) Select(ctx context.Context, mint int64, maxt int64, sortSeries bool, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, ms ...*labels.Matcher) (SeriesSet, parser.Node) {
+	var resolver *labelResolver
+	if !q.cfg.LazyLabels {
+		resolver = newLabelResolver(q.labelsReader)
+	}
+	// Sorting or rewriting the labels of the series requires all of them,
+	// so only unsorted series sets are streamed, without label rewrites.
+	stream := q.cfg.StreamFetchSize > 0 && !sortSeries
+	mint, maxt = hintedTimeRange(mint, maxt, hints)
+	ctx = WithQueryBudget(ctx)
+	rows, query, topNode, warnings, err := q.getResults(ctx, mint, maxt, hints, qh, path, ms, resolver, stream)
 	if err != nil {
+		resolver.discard()
+		return errorSeriesSet{err: err}, nil
+	}
+	if err = queryBudgetFrom(ctx).charge(&q.cfg, rows); err != nil {
+		releaseRows(rows)
+		resolver.discard()
 		return errorSeriesSet{err: err}, nil
 	}
 
-	ss := buildSeriesSet(rows, q.labelsReader)
+	var ss SeriesSet
+	if query != nil {
+		resolver.discard()
+		ss = newStreamingSeriesSet(ctx, query, q.labelsReader, q.cfg)
+	} else if resolver == nil {
+		ss = buildLazySeriesSet(rows, q.labelsReader)
+	} else {
+		ss = buildSeriesSet(rows, resolver)
+	}
+	if pss, ok := ss.(*pgxSeriesSet); ok {
+		pss.cfg = q.cfg
+		pss.warnings = warnings
+		if rewrite, node := getLabelRewriter(topNode, qh, path); rewrite != nil && pss.applyRewrite(rewrite) {
+			topNode = node
+		}
+		if sortSeries {
+			pss.sortByLabels()
+		}
+	}
+	if VerifySeriesSets {
+		ss = newVerifyingSeriesSet(ss, sortSeries)
+	}
 	return ss, topNode
 }
 
 // Query implements the Querier interface. It is the entry point for
 // remote-storage queries.
 func (q *pgxQuerier) Query(query *prompb.Query) ([]*prompb.TimeSeries, error) {
+	return q.query(query, q.labelsReader)
+}
+
+// query returns the resulting timeseries of a query, whose labels are
+// looked up by labelsQuerier.
+func (q *pgxQuerier) query(query *prompb.Query, labelsQuerier labelQuerier) ([]*prompb.TimeSeries, error) {
 	if query == nil {
 		return []*prompb.TimeSeries{}, nil
 	}
@@ -109,12 +281,21 @@ func (q *pgxQuerier) Query(query *prompb.Query) ([]*prompb.TimeSeries, error) {
 		return nil, err
 	}
 
-	rows, _, err := q.getResultRows(query.StartTimestampMs, query.EndTimestampMs, nil, nil, nil, matchers)
+	resolver := newLabelResolver(labelsQuerier)
+	rows, _, err := q.getResultRows(context.Background(), query.StartTimestampMs, query.EndTimestampMs, nil, nil, nil, matchers, resolver)
 	if err != nil {
+		resolver.discard()
+		return nil, err
+	}
+	if err = (&queryBudget{}).charge(&q.cfg, rows); err != nil {
+		releaseRows(rows)
+		resolver.discard()
 		return nil, err
 	}
 
-	results, err := buildTimeSeries(rows, q.labelsReader)
+	// The samples are copied into the results.
+	defer releaseRows(rows)
+	results, err := buildTimeSeries(rows, resolver)
 	return results, err
 }
 
@@ -144,26 +325,78 @@ func fromLabelMatchers(matchers []*prompb.LabelMatcher) ([]*labels.Matcher, erro
 	return result, nil
 }
 
+// hintedTimeRange narrows the time range of the querier, which covers all
+// the selectors of a query, to the range of the selector in the hints.
+func hintedTimeRange(mint, maxt int64, hints *storage.SelectHints) (int64, int64) {
+	if hints == nil {
+		return mint, maxt
+	}
+	if hints.Start > mint {
+		mint = hints.Start
+	}
+	if hints.End < maxt {
+		maxt = hints.End
+	}
+	return mint, maxt
+}
+
 // getResultRows fetches the result row datasets from the database using the
-// supplied query parameters.
-func (q *pgxQuerier) getResultRows(startTimestamp int64, endTimestamp int64, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, matchers []*labels.Matcher) ([]timescaleRow, parser.Node, error) {
+// supplied query parameters. The labels of the rows are resolved by the
+// resolver while the rows are fetched.
+func (q *pgxQuerier) getResultRows(ctx context.Context, startTimestamp int64, endTimestamp int64, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, matchers []*labels.Matcher, resolver *labelResolver) ([]timescaleRow, parser.Node, error) {
+	rows, _, topNode, _, err := q.getResults(ctx, startTimestamp, endTimestamp, hints, qh, path, matchers, resolver, false)
+	return rows, topNode, err
+}
+
+// getResults is getResultRows, except that if stream is set, the query of
+// the rows of a single metric is returned instead of being run, for the
+// rows to be streamed from it, and that the warnings of the rows are
+// returned. The warnings of a streamed query are those of the query.
+func (q *pgxQuerier) getResults(ctx context.Context, startTimestamp int64, endTimestamp int64, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, matchers []*labels.Matcher, resolver *labelResolver, stream bool) ([]timescaleRow, *singleMetricQuery, parser.Node, storage.Warnings, error) {
+	if err := chaos.Inject(chaos.Query); err != nil {
+		if err == chaos.ErrDropped {
+			return nil, nil, nil, nil, nil
+		}
+		return nil, nil, nil, nil, err
+	}
 	if q.rAuth != nil {
 		matchers = q.rAuth.AppendTenantMatcher(matchers)
 	}
+	// External tables are queried with the plain text matchers, since the
+	// values of their tags are not stored encrypted.
+	if rows, ok, err := q.queryExternalMetric(ctx, startTimestamp, endTimestamp, matchers); ok || err != nil {
+		return rows, nil, nil, nil, err
+	}
+	if q.cfg.LabelEncryptor != nil {
+		var err error
+		if matchers, err = q.cfg.LabelEncryptor.EncryptMatchers(matchers); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
 	// Build a subquery per metric matcher.
 	builder, err := BuildSubQueries(matchers)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	metric := builder.GetMetricName()
+	// The posting lists are only used in the queries of a single metric,
+	// whose series table is the only table with an id column.
+	if metric != "" && q.labelPostings != nil {
+		if builder, err = buildSubQueries(matchers, q.labelPostings.use); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
 
 	filter := metricTimeRangeFilter{
-		metric:    metric,
-		schema:    builder.GetSchemaName(),
-		column:    builder.GetColumnName(),
-		startTime: toRFC3339Nano(startTimestamp),
-		endTime:   toRFC3339Nano(endTimestamp),
+		metric:      metric,
+		schema:      builder.GetSchemaName(),
+		column:      builder.GetColumnName(),
+		startTime:   toRFC3339Nano(startTimestamp),
+		endTime:     toRFC3339Nano(endTimestamp),
+		start:       startTimestamp,
+		end:         endTimestamp,
+		seriesLimit: seriesLimitFrom(ctx),
 	}
 
 	// If all metric matchers match on a single metric (common case),
@@ -171,22 +404,82 @@ func (q *pgxQuerier) getResultRows(startTimestamp int64, endTimestamp int64, hin
 	if metric != "" {
 		clauses, values, err := builder.Build(false)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, nil, err
 		}
-		return q.querySingleMetric(metric, filter, clauses, values, hints, qh, path)
+		if stream {
+			query, topNode, err := q.buildSingleMetricQuery(metric, filter, clauses, values, hints, qh, path)
+			return nil, query, topNode, nil, err
+		}
+		rows, topNode, warnings, err := q.querySingleMetric(ctx, metric, filter, clauses, values, hints, qh, path, resolver)
+		return rows, nil, topNode, warnings, err
 	}
 
 	clauses, values, err := builder.Build(true)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	return q.queryMultipleMetrics(filter, clauses, values)
+	rows, warnings, err := q.queryMultipleMetrics(ctx, filter, clauses, values, resolver)
+	return rows, nil, nil, warnings, err
 }
 
 // querySingleMetric returns all the result rows for a single metric using the
 // supplied query parameters. It uses the hints and node path to try to push
 // down query functions where possible.
-func (q *pgxQuerier) querySingleMetric(metric string, filter metricTimeRangeFilter, cases []string, values []interface{}, hints *storage.SelectHints, qh *QueryHints, path []parser.Node) ([]timescaleRow, parser.Node, error) {
+func (q *pgxQuerier) querySingleMetric(ctx context.Context, metric string, filter metricTimeRangeFilter, cases []string, values []interface{}, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, resolver *labelResolver) ([]timescaleRow, parser.Node, storage.Warnings, error) {
+	query, topNode, err := q.buildSingleMetricQuery(metric, filter, cases, values, hints, qh, path)
+	if err != nil || query == nil {
+		return nil, nil, nil, err
+	}
+
+	rows, err := query.conn.Query(ctx, query.sql, query.values...)
+	if err != nil {
+		return nil, nil, nil, query.mapError(err)
+	}
+
+	defer rows.Close()
+
+	tsRows, err := appendTsRows(getRows(), rows, query.tsSeries, query.metricOverride, query.labelSchema, query.labelColumn, resolver)
+	return tsRows, topNode, query.warnings, err
+}
+
+// singleMetricQuery is the query of the result rows of a single metric.
+type singleMetricQuery struct {
+	conn     pgxconn.PgxConn
+	sql      string
+	values   []interface{}
+	tsSeries TimestampSeries
+	// metricOverride, labelSchema and labelColumn are the labels of the
+	// rows that are not read from the database, see appendTsRows.
+	metricOverride           string
+	labelSchema, labelColumn string
+	// schema and table are the relation the query reads from.
+	schema, table string
+	// warnings are the warnings of the results of the query.
+	warnings storage.Warnings
+}
+
+// mapError maps the error of the query, returning nil if the query has
+// no results.
+func (m *singleMetricQuery) mapError(err error) error {
+	if e, ok := err.(*pgconn.PgError); ok {
+		switch e.Code {
+		case pgerrcode.UndefinedTable:
+			// If we are getting undefined table error, it means the metric we are trying to query
+			// existed at some point but the underlying relation was removed from outside of the system.
+			return fmt.Errorf(errors.ErrTmplMissingUnderlyingRelation, m.schema, m.table)
+		case pgerrcode.UndefinedColumn:
+			// If we are getting undefined column error, it means the column we are trying to query
+			// does not exist in the metric table so we return empty results.
+			// Empty result is more consistent and in-line with PromQL assumption of a missing series based on matchers.
+			return nil
+		}
+	}
+	return err
+}
+
+// buildSingleMetricQuery returns the query of the result rows of a single
+// metric, nil if the metric has no results.
+func (q *pgxQuerier) buildSingleMetricQuery(metric string, filter metricTimeRangeFilter, cases []string, values []interface{}, hints *storage.SelectHints, qh *QueryHints, path []parser.Node) (*singleMetricQuery, parser.Node, error) {
 	mInfo, err := q.getMetricTableName(filter.schema, metric)
 	if err != nil {
 		// If the metric table is missing, there are no results for this query.
@@ -197,54 +490,96 @@ func (q *pgxQuerier) querySingleMetric(metric string, filter metricTimeRangeFilt
 		return nil, nil, err
 	}
 
-	filter.metric = mInfo.TableName
-	filter.schema = mInfo.TableSchema
-	filter.seriesTable = mInfo.SeriesTable
+	if q.cfg.Usage != nil && filter.start != minTime {
+		q.cfg.Usage.Record(metric, filter.start)
+	}
 
-	sqlQuery, values, topNode, tsSeries, err := buildTimeseriesByLabelClausesQuery(filter, cases, values, hints, qh, path)
+	route, err := q.getQueryRoute(metric)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	rows, err := q.conn.Query(context.Background(), sqlQuery, values...)
-	if err != nil {
-		if e, ok := err.(*pgconn.PgError); ok {
-			switch e.Code {
-			case pgerrcode.UndefinedTable:
-				// If we are getting undefined table error, it means the metric we are trying to query
-				// existed at some point but the underlying relation was removed from outside of the system.
-				return nil, nil, fmt.Errorf(errors.ErrTmplMissingUnderlyingRelation, mInfo.TableSchema, mInfo.TableName)
-			case pgerrcode.UndefinedColumn:
-				// If we are getting undefined column error, it means the column we are trying to query
-				// does not exist in the metric table so we return empty results.
-				// Empty result is more consistent and in-line with PromQL assumption of a missing series based on matchers.
-				return nil, nil, nil
+	var view *queryView
+	if !route.rawOnly {
+		if view, err = q.getQueryView(metric, filter, hints); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The labels of the rows only depend on what was requested, so that
+	// queries return the same series whether they are routed to a query view
+	// or not.
+	labelSchema, labelColumn := filter.schema, filter.column
+
+	filter.metric = mInfo.TableName
+	filter.schema = mInfo.TableSchema
+	filter.seriesTable = mInfo.SeriesTable
+	filter.reductionStep = q.cfg.StepReductionMinStep
+	filter.ratePushdown = q.cfg.RatePushdown
+	filter.aggregatePushdown = q.cfg.AggregatePushdown
+	if view != nil {
+		filter.metric = view.name
+		filter.schema = view.schema
+		filter.column = view.column
+	} else {
+		labelSchema = filter.schema
+		// The chunks are prewarmed on the primary.
+		if q.cfg.Prewarmer != nil && route.endpoint != ReplicaEndpoint {
+			q.cfg.Prewarmer.record(filter.schema, filter.metric, filter.start, filter.end)
+		}
+		if q.seriesPartitions != nil && filter.schema == schema.Data {
+			if filter.seriesPartitioned, err = q.seriesPartitions.partitioned(filter.metric); err != nil {
+				return nil, nil, fmt.Errorf("get series partitions of metric %s: %w", metric, err)
 			}
 		}
+		if filter.schema, err = q.readSchema(filter.schema, filter.metric); err != nil {
+			return nil, nil, fmt.Errorf("get write shards of metric %s: %w", metric, err)
+		}
+	}
 
+	sqlQuery, values, topNode, tsSeries, err := buildTimeseriesByLabelClausesQuery(filter, cases, values, hints, qh, path)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	defer rows.Close()
+	var warnings storage.Warnings
+	if q.cfg.QuantileWarnings {
+		if warning := quantileWarning(metric, view, hints, path); warning != nil {
+			warnings = append(warnings, warning)
+		}
+	}
 
 	updatedMetricName := ""
 	// If the table name and series table name don't match, this is a custom metric view which
 	// shares the series table with the raw metric, hence we have to update the metric name label.
-	if mInfo.TableName != mInfo.SeriesTable {
+	if filter.metric != mInfo.SeriesTable {
 		updatedMetricName = metric
 	}
+	// The rows of aggregations only have the labels they are grouped by.
+	if _, grouped := topNode.(*parser.AggregateExpr); grouped {
+		updatedMetricName, labelSchema, labelColumn = "", "", ""
+	}
 
-	// TODO this allocation assumes we usually have 1 row, if not, refactor
-	tsRows, err := appendTsRows(make([]timescaleRow, 0, 1), rows, tsSeries, updatedMetricName, filter.schema, filter.column)
-	return tsRows, topNode, err
+	return &singleMetricQuery{
+		conn:           q.connFor(route),
+		sql:            sqlQuery,
+		values:         values,
+		tsSeries:       tsSeries,
+		metricOverride: updatedMetricName,
+		labelSchema:    labelSchema,
+		labelColumn:    labelColumn,
+		schema:         filter.schema,
+		table:          filter.metric,
+		warnings:       warnings,
+	}, topNode, nil
 }
 
 // queryMultipleMetrics returns all the result rows for across multiple metrics
-// using the supplied query parameters.
-func (q *pgxQuerier) queryMultipleMetrics(filter metricTimeRangeFilter, cases []string, values []interface{}) ([]timescaleRow, parser.Node, error) {
+// using the supplied query parameters, and their warnings.
+func (q *pgxQuerier) queryMultipleMetrics(ctx context.Context, filter metricTimeRangeFilter, cases []string, values []interface{}, resolver *labelResolver) ([]timescaleRow, storage.Warnings, error) {
 	// First fetch series IDs per metric.
 	sqlQuery := BuildMetricNameSeriesIDQuery(cases)
-	rows, err := q.conn.Query(context.Background(), sqlQuery, values...)
+	rows, err := q.conn.Query(ctx, sqlQuery, values...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -255,13 +590,8 @@ func (q *pgxQuerier) queryMultipleMetrics(filter metricTimeRangeFilter, cases []
 		return nil, nil, err
 	}
 
-	// TODO this assume on average on row per-metric. Is this right?
-	results := make([]timescaleRow, 0, len(metrics))
-
-	numQueries := 0
-	batch := q.conn.NewBatch()
-
-	// Generate queries for each metric and send them in a single batch.
+	// Generate queries for each metric.
+	var queries, queryMetrics []string
 	for i, metric := range metrics {
 		//TODO batch getMetricTableName
 		mInfo, err := q.getMetricTableName(schemas[i], metric)
@@ -281,21 +611,34 @@ func (q *pgxQuerier) queryMultipleMetrics(filter metricTimeRangeFilter, cases []
 		}
 
 		filter.metric = mInfo.TableName
-		filter.schema = mInfo.TableSchema
 		filter.seriesTable = mInfo.SeriesTable
+		if filter.schema, err = q.readSchema(mInfo.TableSchema, mInfo.TableName); err != nil {
+			return nil, nil, fmt.Errorf("get write shards of metric %s: %w", metric, err)
+		}
 
-		sqlQuery = buildTimeseriesBySeriesIDQuery(filter, series[i])
-		batch.Queue(sqlQuery)
-		numQueries += 1
+		queries = append(queries, buildTimeseriesBySeriesIDQuery(filter, series[i]))
+		queryMetrics = append(queryMetrics, metric)
 	}
 
-	batchResults, err := q.conn.SendBatch(context.Background(), batch)
+	// A failed query of a batch aborts the queries after it, so the queries
+	// of partial responses are not batched.
+	if (q.cfg.MetricFetchConcurrency > 1 || q.cfg.PartialResponse) && len(queries) > 1 {
+		return q.fetchMetricsConcurrently(ctx, queries, queryMetrics, resolver)
+	}
+
+	// Send the queries in a single batch.
+	results := getRows()
+	batch := q.conn.NewBatch()
+	for _, sqlQuery := range queries {
+		batch.Queue(sqlQuery)
+	}
+	batchResults, err := q.conn.SendBatch(ctx, batch)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer batchResults.Close()
 
-	for i := 0; i < numQueries; i++ {
+	for range queries {
 		rows, err = batchResults.Query()
 		if err != nil {
 			rows.Close()
@@ -303,7 +646,7 @@ func (q *pgxQuerier) queryMultipleMetrics(filter metricTimeRangeFilter, cases []
 		}
 		// Append all rows into results. Metric name and additional labels are
 		// ignored for multi-metric queries
-		results, err = appendTsRows(results, rows, nil, "", "", "")
+		results, err = appendTsRows(results, rows, nil, "", "", "", resolver)
 		// Can't defer because we need to Close before the next loop iteration.
 		rows.Close()
 		if err != nil {
@@ -315,6 +658,33 @@ func (q *pgxQuerier) queryMultipleMetrics(filter metricTimeRangeFilter, cases []
 	return results, nil, nil
 }
 
+// getQueryView returns the query view registered for the metric that should
+// answer the query instead of the raw metric table, if any. Only queries of
+// the default schema and column are routed to query views.
+func (q *pgxQuerier) getQueryView(metric string, filter metricTimeRangeFilter, hints *storage.SelectHints) (*queryView, error) {
+	if q.queryViews == nil || filter.schema != "" || filter.column != defaultColumnName {
+		return nil, nil
+	}
+	views, err := q.queryViews.get(metric)
+	if err != nil {
+		return nil, fmt.Errorf("get query views of metric %s: %w", metric, err)
+	}
+	return selectQueryView(views, hints), nil
+}
+
+// getQueryRoute returns the overrides of how the queries of the metric are
+// routed, the zero route if there are none.
+func (q *pgxQuerier) getQueryRoute(metric string) (queryRoute, error) {
+	if q.queryRoutes == nil {
+		return queryRoute{}, nil
+	}
+	route, err := q.queryRoutes.get(metric)
+	if err != nil {
+		return queryRoute{}, fmt.Errorf("get query route of metric %s: %w", metric, err)
+	}
+	return route, nil
+}
+
 // getMetricTableName gets the table name for a specific metric from internal
 // cache. If not found, fetches it from the database and updates the cache.
 func (q *pgxQuerier) getMetricTableName(schema, metric string) (model.MetricInfo, error) {
@@ -17,12 +17,12 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
 	"github.com/timescale/promscale/pkg/pgmodel/common/extension"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
-	"github.com/timescale/promscale/pkg/pgmodel/lreader"
 	pgmodel "github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/prompb"
@@ -107,9 +107,9 @@ const (
 		SELECT %[6]s
 		FROM
 		(
-			SELECT time, %[9]s as value
+			SELECT %[11]stime, %[9]s as value
 			FROM %[1]s metric
-			WHERE metric.series_id = series.id
+			WHERE metric.series_id = series.id%[10]s
 			AND time >= '%[4]s'
 			AND time <= '%[5]s'
 			%[8]s
@@ -127,7 +127,7 @@ const (
 		SELECT series_id, %[6]s
 		FROM
 		(
-			SELECT series_id, time, %[9]s as value
+			SELECT %[11]sseries_id, time, %[9]s as value
 			FROM %[1]s metric
 			WHERE
 			time >= '%[4]s'
@@ -169,6 +169,12 @@ func GetMetricNameSeriesIDFromMatchers(conn pgxconn.PgxConn, matchers []*labels.
 }
 
 func BuildSubQueries(matchers []*labels.Matcher) (*clauseBuilder, error) {
+	return buildSubQueries(matchers, nil)
+}
+
+// buildSubQueries builds the clauses of the matchers, using the posting lists
+// of the labels for the matchers usePostings returns true for.
+func buildSubQueries(matchers []*labels.Matcher, usePostings func(*labels.Matcher) bool) (*clauseBuilder, error) {
 	var err error
 	cb := &clauseBuilder{}
 
@@ -202,18 +208,37 @@ func BuildSubQueries(matchers []*labels.Matcher) (*clauseBuilder, error) {
 			if matchesEmpty {
 				sq = subQueryNEQMatchEmpty
 			}
+			if usePostings != nil && usePostings(m) {
+				sq = subQueryPostingsNEQ
+			}
 			err = cb.addClause(sq, m.Name, m.Value)
 		case labels.MatchRegexp:
 			sq := subQueryRE
 			if matchesEmpty {
 				sq = subQueryREMatchEmpty
 			}
+			if usePostings != nil && usePostings(m) {
+				err = cb.addClause(subQueryPostingsRE, m.Name, anchorValue(m.Value))
+				break
+			}
+			if clause, args, ok := regexClause(m, matchesEmpty); ok {
+				err = cb.addClause(clause, args...)
+				break
+			}
 			err = cb.addClause(sq, m.Name, anchorValue(m.Value))
 		case labels.MatchNotRegexp:
 			sq := subQueryNRE
 			if matchesEmpty {
 				sq = subQueryNREMatchEmpty
 			}
+			if usePostings != nil && usePostings(m) {
+				err = cb.addClause(subQueryPostingsNRE, m.Name, anchorValue(m.Value))
+				break
+			}
+			if clause, args, ok := regexClause(m, matchesEmpty); ok {
+				err = cb.addClause(clause, args...)
+				break
+			}
 			err = cb.addClause(sq, m.Name, anchorValue(m.Value))
 		}
 
@@ -350,29 +375,15 @@ func (c *clauseBuilder) Build(includeMetricName bool) ([]string, []interface{},
 	return c.clauses, c.args, nil
 }
 
-func initializeLabeIDMap(labelIDMap map[int64]labels.Label, rows []timescaleRow) {
-	for i := range rows {
-		for _, id := range rows[i].labelIds {
-			//id==0 means there is no label for the key, so nothing to look up
-			if id == 0 {
-				continue
-			}
-			labelIDMap[id] = labels.Label{}
-		}
-	}
-}
-
-func buildTimeSeries(rows []timescaleRow, lr lreader.LabelsReader) ([]*prompb.TimeSeries, error) {
+func buildTimeSeries(rows []timescaleRow, resolver *labelResolver) ([]*prompb.TimeSeries, error) {
 	results := make([]*prompb.TimeSeries, 0, len(rows))
-	labelIDMap := make(map[int64]labels.Label)
-	initializeLabeIDMap(labelIDMap, rows)
-
-	err := lr.LabelsForIdMap(labelIDMap)
+	labelIDMap, err := resolver.wait()
 	if err != nil {
 		return nil, fmt.Errorf("fetching labels to build timeseries: %w", err)
 	}
 
-	for _, row := range rows {
+	for idx := range rows {
+		row := &rows[idx]
 		if row.err != nil {
 			return nil, row.err
 		}
@@ -381,37 +392,11 @@ func buildTimeSeries(rows []timescaleRow, lr lreader.LabelsReader) ([]*prompb.Ti
 			return nil, errors.ErrQueryMismatchTimestampValue
 		}
 
-		promLabels := make([]prompb.Label, 0, len(row.labelIds))
-		for _, id := range row.labelIds {
-			if id == 0 {
-				continue
-			}
-			label, ok := labelIDMap[id]
-			if !ok {
-				return nil, fmt.Errorf("missing label for id %v", id)
-			}
-			if label == (labels.Label{}) {
-				return nil, fmt.Errorf("label not found for id %v", id)
-			}
-			promLabels = append(promLabels, prompb.Label{Name: label.Name, Value: label.Value})
-
-		}
-		if row.metricOverride != "" {
-			for i := range promLabels {
-				if promLabels[i].Name == pgmodel.MetricNameLabelName {
-					promLabels[i].Value = row.metricOverride
-					break
-				}
-			}
-		}
-		for _, v := range row.GetAdditionalLabels() {
-			promLabels = append(promLabels, prompb.Label{Name: v.Name, Value: v.Value})
+		promLabels, err := buildPromLabels(row, labelIDMap)
+		if err != nil {
+			return nil, err
 		}
 
-		sort.Slice(promLabels, func(i, j int) bool {
-			return promLabels[i].Name < promLabels[j].Name
-		})
-
 		result := &prompb.TimeSeries{
 			Labels:  promLabels,
 			Samples: make([]prompb.Sample, 0, row.times.Len()),
@@ -434,6 +419,46 @@ func buildTimeSeries(rows []timescaleRow, lr lreader.LabelsReader) ([]*prompb.Ti
 	return results, nil
 }
 
+// buildPromLabels returns the sorted labels of a row, resolving its label ids
+// with labelIDMap.
+func buildPromLabels(row *timescaleRow, labelIDMap map[int64]labels.Label) ([]prompb.Label, error) {
+	additional := row.GetAdditionalLabels()
+	promLabels := make([]prompb.Label, 0, len(row.labelIds)+len(additional)+len(row.labels))
+	for _, l := range row.labels {
+		promLabels = append(promLabels, prompb.Label{Name: l.Name, Value: l.Value})
+	}
+	for _, id := range row.labelIds {
+		if id == 0 {
+			continue
+		}
+		label, ok := labelIDMap[id]
+		if !ok {
+			return nil, fmt.Errorf("missing label for id %v", id)
+		}
+		if label == (labels.Label{}) {
+			return nil, fmt.Errorf("label not found for id %v", id)
+		}
+		promLabels = append(promLabels, prompb.Label{Name: label.Name, Value: label.Value})
+
+	}
+	if row.metricOverride != "" {
+		for i := range promLabels {
+			if promLabels[i].Name == pgmodel.MetricNameLabelName {
+				promLabels[i].Value = row.metricOverride
+				break
+			}
+		}
+	}
+	for _, v := range additional {
+		promLabels = append(promLabels, prompb.Label{Name: v.Name, Value: v.Value})
+	}
+
+	sort.Slice(promLabels, func(i, j int) bool {
+		return promLabels[i].Name < promLabels[j].Name
+	})
+	return promLabels, nil
+}
+
 func BuildMetricNameSeriesIDQuery(cases []string) string {
 	return fmt.Sprintf(metricNameSeriesIDSQLFormat, strings.Join(cases, " AND "))
 }
@@ -450,12 +475,30 @@ func buildTimeseriesBySeriesIDQuery(filter metricTimeRangeFilter, series []pgmod
 		strings.Join(s, ","),
 		filter.startTime,
 		filter.endTime,
-	)
+	) + limitClause(filter)
 }
 
 func buildTimeseriesByLabelClausesQuery(filter metricTimeRangeFilter, cases []string, values []interface{},
 	hints *storage.SelectHints, qh *QueryHints, path []parser.Node) (string, []interface{}, parser.Node, TimestampSeries, error) {
-	qf, node, err := getAggregators(hints, qh, path)
+	if filter.aggregatePushdown {
+		if ga := getGroupedAggregate(hints, qh, path); ga != nil {
+			sql, values, err := buildGroupedAggregateQuery(filter, cases, values, ga)
+			if err != nil {
+				return "", nil, nil, nil, err
+			}
+			return sql, values, ga.node, nil, nil
+		}
+		/* the engine evaluates the topk or bottomk over the series ranked within the k first */
+		if tk := getTopK(hints, qh, path); tk != nil {
+			sql, values, err := buildTopKQuery(filter, cases, values, tk)
+			if err != nil {
+				return "", nil, nil, nil, err
+			}
+			return sql, values, nil, nil, nil
+		}
+	}
+
+	qf, node, err := getAggregators(hints, qh, path, filter.reductionStep, filter.ratePushdown)
 	if err != nil {
 		return "", nil, nil, nil, err
 	}
@@ -485,13 +528,34 @@ func buildTimeseriesByLabelClausesQuery(filter metricTimeRangeFilter, cases []st
 	}
 
 	template := timeseriesByMetricSQLFormat
-	if len(cases) == 1 && cases[0] == "TRUE" {
+	noClauses := len(cases) == 1 && cases[0] == "TRUE"
+	if noClauses {
 		template = timeseriesByMetricSQLFormatNoClauses
 		if !qf.unOrdered {
 			orderByClause = "ORDER BY series_id, time"
 		}
 	}
 
+	distinctClause := ""
+	if qf.bucketClause != "" {
+		var bucket string
+		bucket, values, err = setParameterNumbers(qf.bucketClause, values, qf.bucketParams...)
+		if err != nil {
+			return "", nil, nil, nil, err
+		}
+		if noClauses {
+			bucket = "series_id, " + bucket
+		}
+		/* the last sample of each bucket, the buckets still being in time order */
+		distinctClause = "DISTINCT ON (" + bucket + ") "
+		orderByClause = "ORDER BY " + bucket + ", time DESC"
+	}
+
+	partitionClause := ""
+	if filter.seriesPartitioned {
+		partitionClause = seriesPartitionClause
+	}
+
 	finalSQL := fmt.Sprintf(template,
 		pgx.Identifier{filter.schema, filter.metric}.Sanitize(),
 		pgx.Identifier{schema.DataSeries, filter.seriesTable}.Sanitize(),
@@ -502,7 +566,9 @@ func buildTimeseriesByLabelClausesQuery(filter metricTimeRangeFilter, cases []st
 		strings.Join(selectors, ", "),
 		orderByClause,
 		pgx.Identifier{filter.column}.Sanitize(),
-	)
+		partitionClause,
+		distinctClause,
+	) + limitClause(filter)
 
 	return finalSQL, values, node, qf.tsSeries, nil
 }
@@ -524,6 +590,9 @@ type aggregators struct {
 	valueParams []interface{}
 	unOrdered   bool
 	tsSeries    TimestampSeries //can be NULL and only present if timeClause == ""
+	/* bucketClause keeps only the last sample of each bucket it computes from the time of the samples */
+	bucketClause string
+	bucketParams []interface{}
 }
 
 /* vectorSelectors called by the timestamp function have special handling see engine.go */
@@ -572,11 +641,35 @@ func getDefaultAggregators() *aggregators {
 }
 
 /* The path is the list of ancestors (direct parent last) returned node is the most-ancestral node processed by the pushdown */
-func getAggregators(hints *storage.SelectHints, qh *QueryHints, path []parser.Node) (*aggregators, parser.Node, error) {
-	if !extension.ExtensionIsInstalled || qh == nil || hasSubquery(path) || hints == nil {
+func getAggregators(hints *storage.SelectHints, qh *QueryHints, path []parser.Node, reductionStep time.Duration, ratePushdown bool) (*aggregators, parser.Node, error) {
+	if qh == nil || hasSubquery(path) || hints == nil {
 		return getDefaultAggregators(), nil, nil
 	}
 
+	if extension.ExtensionIsInstalled {
+		qf, node, err := getExtensionAggregators(hints, qh, path)
+		if qf != nil || err != nil {
+			return qf, node, err
+		}
+	}
+
+	if ratePushdown {
+		qf, node, err := getRateAggregators(hints, qh, path)
+		if qf != nil || err != nil {
+			return qf, node, err
+		}
+	}
+	if qf := getInstantAggregators(hints); qf != nil {
+		return qf, nil, nil
+	}
+	if qf := getStepReduction(hints, qh, reductionStep); qf != nil {
+		return qf, nil, nil
+	}
+	return getDefaultAggregators(), nil, nil
+}
+
+/* getExtensionAggregators returns the pushdowns using the functions of the Promscale extension, or nil if none applies */
+func getExtensionAggregators(hints *storage.SelectHints, qh *QueryHints, path []parser.Node) (*aggregators, parser.Node, error) {
 	//switch on the current node being processed
 	vs, isVectorSelector := qh.CurrentNode.(*parser.VectorSelector)
 	if isVectorSelector {
@@ -620,7 +713,119 @@ func getAggregators(hints *storage.SelectHints, qh *QueryHints, path []parser.No
 		}
 	}
 
-	return getDefaultAggregators(), nil, nil
+	return nil, nil, nil
+}
+
+// rateFunctions are the range functions extrapolating the change of the
+// samples of a range, with whether they handle counter resets and divide by
+// the range.
+var rateFunctions = map[string]struct{ isCounter, isRate bool }{
+	"rate":     {isCounter: true, isRate: true},
+	"increase": {isCounter: true, isRate: false},
+	"delta":    {isCounter: false, isRate: false},
+}
+
+/* getRateAggregators evaluates rate, increase and delta in the database with the extrapolated_delta function of the
+* catalog when the extension does not, returning a value per step like the extension pushdown. The function reads the
+* samples of the range without the staleness markers, as the engine does. Offsets and @ modifiers shift the times of
+* the results, so those are evaluated by the engine. */
+func getRateAggregators(hints *storage.SelectHints, qh *QueryHints, path []parser.Node) (*aggregators, parser.Node, error) {
+	vs, isVectorSelector := qh.CurrentNode.(*parser.VectorSelector)
+	if !isVectorSelector ||
+		len(path) < 2 ||
+		hints.Range == 0 ||
+		vs.OriginalOffset != time.Duration(0) ||
+		vs.Offset != time.Duration(0) ||
+		vs.Timestamp != nil {
+		return nil, nil, nil
+	}
+	node := path[len(path)-2]
+	callNode, isCall := node.(*parser.Call)
+	if !isCall {
+		return nil, nil, nil
+	}
+	fn, ok := rateFunctions[callNode.Func.Name]
+	if !ok {
+		return nil, nil, nil
+	}
+	qf, err := callAggregator(hints, callNode.Func.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	qf.valueClause = fmt.Sprintf("%s.extrapolated_delta($%%d, $%%d, $%%d, $%%d, array_agg(time) FILTER (WHERE %[2]s), array_agg(value) FILTER (WHERE %[2]s), %[3]t, %[4]t)",
+		schema.Catalog, notStaleSQL, fn.isCounter, fn.isRate)
+	return qf, node, nil
+}
+
+// notStaleSQL is true for the samples which are not staleness markers. The
+// markers are NaNs told apart from the other NaNs by their bits only.
+var notStaleSQL = fmt.Sprintf("float8send(value) <> decode('%016x', 'hex')", value.StaleNaN)
+
+// instantRangeAggregates are the aggregates over the samples of a range
+// evaluating to the value of the function of the range, for the functions
+// only needing a single sample of the range. Like in the functions, the
+// staleness markers are ignored and NaNs are only kept if all values are.
+var instantRangeAggregates = map[string]string{
+	"max_over_time":  "coalesce(max(value) FILTER (WHERE " + notStaleSQL + " AND value <> 'NaN'), 'NaN')",
+	"min_over_time":  "min(value) FILTER (WHERE " + notStaleSQL + ")",
+	"last_over_time": "(array_agg(value) FILTER (WHERE " + notStaleSQL + "))[count(*) FILTER (WHERE " + notStaleSQL + ")]",
+}
+
+/* getInstantAggregators trims the samples of instant queries, which evaluate the selector at a single time,
+* to the single sample the evaluation uses: the last sample for a vector selector, and a sample with the
+* value of the function for the range functions only needing one sample. Unlike the extension pushdowns the
+* engine still evaluates the node, so the node is not returned. */
+func getInstantAggregators(hints *storage.SelectHints) *aggregators {
+	if hints.Step != 0 {
+		return nil
+	}
+	if hints.Range == 0 {
+		return &aggregators{
+			timeClause:  "(array_agg(time))[count(*):]",
+			valueClause: "(array_agg(value))[count(*):]",
+			unOrdered:   false,
+		}
+	}
+	aggregate, ok := instantRangeAggregates[hints.Func]
+	if !ok {
+		return nil
+	}
+	return &aggregators{
+		timeClause:  "ARRAY[max(time)]",
+		valueClause: "CASE WHEN count(*) FILTER (WHERE " + notStaleSQL + ") > 0 THEN ARRAY[" + aggregate + "] END",
+		unOrdered:   false,
+	}
+}
+
+// timeBucketOrigin is the time the buckets of time_bucket are aligned on by
+// default, for intervals shorter than a month.
+var timeBucketOrigin = time.Date(2000, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+/* getStepReduction fetches only the last sample of each step of the vector selectors of range queries with a step
+* of at least reductionStep, as the vector selector evaluated at a step only reads the last sample before it, if it
+* is within the lookback. The buckets of the samples are the steps (T-step, T] ending at the evaluation times T, which
+* are the buckets [T-step+1ms, T+1ms) of time_bucket for the millisecond timestamps of the samples. Unlike the
+* vector_selector pushdown of the extension the engine still evaluates the selector, so the node is not returned. */
+func getStepReduction(hints *storage.SelectHints, qh *QueryHints, reductionStep time.Duration) *aggregators {
+	vs, isVectorSelector := qh.CurrentNode.(*parser.VectorSelector)
+	if !isVectorSelector ||
+		reductionStep <= 0 ||
+		hints.Step < reductionStep.Milliseconds() ||
+		hints.Range != 0 ||
+		vs.OriginalOffset != time.Duration(0) ||
+		vs.Offset != time.Duration(0) ||
+		vs.Timestamp != nil {
+		return nil
+	}
+	step := time.Duration(hints.Step) * time.Millisecond
+	offset := qh.StartTime.Add(time.Millisecond).Sub(timeBucketOrigin) % step
+	if offset < 0 {
+		offset += step
+	}
+	qf := getDefaultAggregators()
+	qf.bucketClause = "time_bucket($%d::INTERVAL, time, $%d::INTERVAL)"
+	qf.bucketParams = []interface{}{step, offset}
+	return qf
 }
 
 func GetSeriesPerMetric(rows pgxconn.PgxRows) ([]string, []string, [][]pgmodel.SeriesID, error) {
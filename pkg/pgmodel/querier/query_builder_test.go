@@ -0,0 +1,136 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInstantAggregators(t *testing.T) {
+	ms := func(d time.Duration) int64 { return int64(d / time.Millisecond) }
+	qh := &QueryHints{CurrentNode: &parser.VectorSelector{}}
+
+	testCases := []struct {
+		name     string
+		hints    *storage.SelectHints
+		path     []parser.Node
+		expected string
+	}{
+		{name: "no hints"},
+		{name: "vector selector", hints: &storage.SelectHints{}, expected: "(array_agg(value))[count(*):]"},
+		{name: "range query", hints: &storage.SelectHints{Step: ms(time.Minute)}},
+		{name: "subquery", hints: &storage.SelectHints{}, path: []parser.Node{&parser.SubqueryExpr{}}},
+		{name: "max over time", hints: &storage.SelectHints{Range: ms(time.Minute), Func: "max_over_time"}, expected: "max(value)"},
+		{name: "min over time", hints: &storage.SelectHints{Range: ms(time.Minute), Func: "min_over_time"}, expected: "min(value)"},
+		{name: "last over time", hints: &storage.SelectHints{Range: ms(time.Minute), Func: "last_over_time"}, expected: "(array_agg(value) FILTER"},
+		{name: "function needing every sample", hints: &storage.SelectHints{Range: ms(time.Minute), Func: "count_over_time"}},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			qf, node, err := getAggregators(c.hints, qh, c.path, 0, false)
+			require.NoError(t, err)
+			require.Nil(t, node)
+			if c.expected == "" {
+				require.Equal(t, getDefaultAggregators(), qf)
+				return
+			}
+			require.Contains(t, qf.valueClause, c.expected)
+			require.NotEmpty(t, qf.timeClause)
+			require.Nil(t, qf.tsSeries)
+		})
+	}
+
+	require.Equal(t, "float8send(value) <> decode('7ff0000000000002', 'hex')", notStaleSQL)
+}
+
+func TestHintedTimeRange(t *testing.T) {
+	mint, maxt := hintedTimeRange(1000, 5000, nil)
+	require.Equal(t, []int64{1000, 5000}, []int64{mint, maxt})
+
+	mint, maxt = hintedTimeRange(1000, 5000, &storage.SelectHints{Start: 2000, End: 3000})
+	require.Equal(t, []int64{2000, 3000}, []int64{mint, maxt})
+
+	mint, maxt = hintedTimeRange(1000, 5000, &storage.SelectHints{Start: 0, End: 6000})
+	require.Equal(t, []int64{1000, 5000}, []int64{mint, maxt})
+}
+
+func TestStepReduction(t *testing.T) {
+	filter := metricTimeRangeFilter{
+		metric:        "cpu_usage",
+		schema:        "prom_data",
+		column:        defaultColumnName,
+		seriesTable:   "cpu_usage",
+		startTime:     "start",
+		endTime:       "end",
+		reductionStep: time.Minute,
+	}
+	start := timeBucketOrigin.Add(10*time.Minute + 30*time.Second)
+	qh := &QueryHints{StartTime: start, EndTime: start.Add(time.Hour), CurrentNode: &parser.VectorSelector{}}
+	hints := &storage.SelectHints{Step: int64(5 * time.Minute / time.Millisecond)}
+
+	sql, values, node, _, err := buildTimeseriesByLabelClausesQuery(filter, []string{"labels && $1"}, []interface{}{"x"}, hints, qh, nil)
+	require.NoError(t, err)
+	require.Nil(t, node)
+	require.Contains(t, sql, "SELECT DISTINCT ON (time_bucket($2::INTERVAL, time, $3::INTERVAL)) time")
+	require.Contains(t, sql, "ORDER BY time_bucket($2::INTERVAL, time, $3::INTERVAL), time DESC")
+	// The buckets end right after the evaluation times, 10m30s after the
+	// origin modulo the step.
+	require.Equal(t, []interface{}{"x", 5 * time.Minute, 30*time.Second + time.Millisecond}, values)
+
+	sql, _, _, _, err = buildTimeseriesByLabelClausesQuery(filter, []string{"TRUE"}, nil, hints, qh, nil)
+	require.NoError(t, err)
+	require.Contains(t, sql, "SELECT DISTINCT ON (series_id, time_bucket($1::INTERVAL, time, $2::INTERVAL)) series_id")
+	require.NotContains(t, sql, "%!")
+
+	// Steps smaller than the reduction step, ranges and offsets fetch every sample.
+	for _, c := range []struct {
+		hints *storage.SelectHints
+		node  *parser.VectorSelector
+	}{
+		{hints: &storage.SelectHints{Step: int64(30 * time.Second / time.Millisecond)}, node: &parser.VectorSelector{}},
+		{hints: &storage.SelectHints{Step: hints.Step, Range: hints.Step}, node: &parser.VectorSelector{}},
+		{hints: hints, node: &parser.VectorSelector{OriginalOffset: time.Hour}},
+	} {
+		qh.CurrentNode = c.node
+		qf, _, err := getAggregators(c.hints, qh, nil, time.Minute, false)
+		require.NoError(t, err)
+		require.Empty(t, qf.bucketClause)
+	}
+}
+
+func TestRateAggregators(t *testing.T) {
+	ms := func(d time.Duration) int64 { return int64(d / time.Millisecond) }
+	vs := &parser.VectorSelector{}
+	rate := &parser.Call{Func: parser.Functions["rate"]}
+	path := []parser.Node{rate, &parser.MatrixSelector{VectorSelector: vs, Range: 5 * time.Minute}}
+	qh := &QueryHints{CurrentNode: vs}
+	hints := &storage.SelectHints{Start: 0, End: ms(time.Hour), Step: ms(time.Minute), Range: ms(5 * time.Minute), Func: "rate"}
+
+	qf, node, err := getAggregators(hints, qh, path, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, rate, node)
+	require.Equal(t, "_prom_catalog.extrapolated_delta($%d, $%d, $%d, $%d, array_agg(time) FILTER (WHERE "+notStaleSQL+
+		"), array_agg(value) FILTER (WHERE "+notStaleSQL+"), true, true)", qf.valueClause)
+	require.Equal(t, []interface{}{time.Unix(0, 0), time.Unix(3600, 0), int64(60000), int64(300000)}, qf.valueParams)
+	require.Equal(t, 56, qf.tsSeries.Len())
+
+	// Disabled, or with an offset, the samples are fetched.
+	qf, node, err = getAggregators(hints, qh, path, 0, false)
+	require.NoError(t, err)
+	require.Nil(t, node)
+	require.Equal(t, getDefaultAggregators(), qf)
+
+	qh.CurrentNode = &parser.VectorSelector{OriginalOffset: time.Minute}
+	qf, node, err = getAggregators(hints, qh, path, 0, true)
+	require.NoError(t, err)
+	require.Nil(t, node)
+	require.Equal(t, getDefaultAggregators(), qf)
+}
@@ -0,0 +1,78 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// sampleBytes is the estimated size in memory of a fetched sample, its
+	// timestamp and value.
+	sampleBytes = 16
+	// labelIDBytes is the estimated size in memory of a label id of a
+	// fetched series.
+	labelIDBytes = 8
+)
+
+// ErrQueryLimit is the error of the queries whose selects fetch more
+// samples or bytes than the limits of the querier.
+type ErrQueryLimit struct {
+	limit, unit string
+	max         int64
+}
+
+func (e ErrQueryLimit) Error() string {
+	return fmt.Sprintf("query fetched more than the %s limit of %d %s, narrow down its selectors or time range", e.limit, e.max, e.unit)
+}
+
+// queryBudget accounts the samples, and their estimated size in memory,
+// fetched by all the selects of a query.
+type queryBudget struct {
+	samples int64
+	bytes   int64
+}
+
+type queryBudgetKey struct{}
+
+// WithQueryBudget returns a context whose selects are accounted together
+// against the per-query limits of the querier, see Cfg.MaxSamples. The
+// selects made with a context without a budget are accounted on their own.
+func WithQueryBudget(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(queryBudgetKey{}).(*queryBudget); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, queryBudgetKey{}, &queryBudget{})
+}
+
+// queryBudgetFrom returns the budget of the context, nil if it has none.
+func queryBudgetFrom(ctx context.Context) *queryBudget {
+	b, _ := ctx.Value(queryBudgetKey{}).(*queryBudget)
+	return b
+}
+
+// charge adds the samples of the rows to the budget, returning an
+// ErrQueryLimit once the budget exceeds the limits of cfg. It is safe to
+// call from the concurrent selects of a query.
+func (b *queryBudget) charge(cfg *Cfg, rows []timescaleRow) error {
+	if b == nil || (cfg.MaxSamples <= 0 && cfg.MaxBytes <= 0) {
+		return nil
+	}
+	var samples, bytes int64
+	for i := range rows {
+		n := int64(len(rows[i].values.Elements))
+		samples += n
+		bytes += n*sampleBytes + int64(len(rows[i].labelIds))*labelIDBytes
+	}
+	if total := atomic.AddInt64(&b.samples, samples); cfg.MaxSamples > 0 && total > cfg.MaxSamples {
+		return ErrQueryLimit{limit: "sample", max: cfg.MaxSamples, unit: "samples"}
+	}
+	if total := atomic.AddInt64(&b.bytes, bytes); cfg.MaxBytes > 0 && total > cfg.MaxBytes {
+		return ErrQueryLimit{limit: "memory", max: cfg.MaxBytes, unit: "bytes"}
+	}
+	return nil
+}
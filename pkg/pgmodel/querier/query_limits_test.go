@@ -0,0 +1,45 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+func rowWithSamples(labels, samples int) timescaleRow {
+	return timescaleRow{
+		labelIds: make([]int64, labels),
+		values:   &pgtype.Float8Array{Elements: make([]pgtype.Float8, samples)},
+	}
+}
+
+func TestQueryBudget(t *testing.T) {
+	ctx := WithQueryBudget(context.Background())
+	require.Same(t, queryBudgetFrom(ctx), queryBudgetFrom(WithQueryBudget(ctx)), "the selects of a query share its budget")
+	require.Nil(t, queryBudgetFrom(context.Background()))
+	require.NoError(t, queryBudgetFrom(context.Background()).charge(&Cfg{MaxSamples: 1}, []timescaleRow{rowWithSamples(1, 2)}))
+
+	rows := []timescaleRow{rowWithSamples(2, 10), rowWithSamples(3, 5)}
+	require.NoError(t, queryBudgetFrom(ctx).charge(&Cfg{}, rows), "no limit by default")
+
+	cfg := &Cfg{MaxSamples: 40}
+	ctx = WithQueryBudget(context.Background())
+	require.NoError(t, queryBudgetFrom(ctx).charge(cfg, rows))
+	require.NoError(t, queryBudgetFrom(ctx).charge(cfg, rows))
+	err := queryBudgetFrom(ctx).charge(cfg, rows)
+	require.Equal(t, ErrQueryLimit{limit: "sample", max: 40, unit: "samples"}, err, "the samples of all the selects are accounted")
+	require.Contains(t, err.Error(), "40 samples")
+
+	// 15 samples of 16 bytes and 5 label ids of 8 bytes.
+	cfg = &Cfg{MaxBytes: 15*sampleBytes + 5*labelIDBytes}
+	ctx = WithQueryBudget(context.Background())
+	require.NoError(t, queryBudgetFrom(ctx).charge(cfg, rows))
+	err = queryBudgetFrom(ctx).charge(cfg, []timescaleRow{rowWithSamples(0, 1)})
+	require.Equal(t, ErrQueryLimit{limit: "memory", max: cfg.MaxBytes, unit: "bytes"}, err)
+}
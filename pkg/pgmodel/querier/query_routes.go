@@ -0,0 +1,102 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	getQueryRoutesSQL = "SELECT metric_name, COALESCE(endpoint, ''), raw_only FROM " + schema.Catalog + ".query_route"
+
+	// queryRouteRefreshInterval is how long the query routes are cached
+	// before they are fetched again, so that the overrides which are set or
+	// reset are picked up without a restart.
+	queryRouteRefreshInterval = time.Minute
+)
+
+// The names of the read endpoints a metric can be pinned to.
+const (
+	PrimaryEndpoint = "primary"
+	ReplicaEndpoint = "replica"
+)
+
+// queryRoute is the manual override of how the queries of a metric are
+// routed, set by the admin where the automatic routing picks wrong.
+type queryRoute struct {
+	// endpoint is the read endpoint the queries are pinned to, empty for
+	// the automatic choice.
+	endpoint string
+	// rawOnly makes the queries read the raw data instead of the query
+	// views of the metric.
+	rawOnly bool
+}
+
+// queryRouteCache caches the query routes of all the metrics, which are few
+// since they only hold the exceptions.
+type queryRouteCache struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	routes  map[string]queryRoute
+	fetched time.Time
+	now     func() time.Time
+}
+
+func newQueryRouteCache(conn pgxconn.PgxConn) *queryRouteCache {
+	return &queryRouteCache{
+		conn: conn,
+		now:  time.Now,
+	}
+}
+
+func (c *queryRouteCache) get(metric string) (queryRoute, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.routes == nil || c.now().Sub(c.fetched) >= queryRouteRefreshInterval {
+		routes, err := c.fetch()
+		if err != nil {
+			return queryRoute{}, err
+		}
+		c.routes = routes
+		c.fetched = c.now()
+	}
+	return c.routes[metric], nil
+}
+
+func (c *queryRouteCache) fetch() (map[string]queryRoute, error) {
+	rows, err := c.conn.Query(context.Background(), getQueryRoutesSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := make(map[string]queryRoute)
+	for rows.Next() {
+		var (
+			metric string
+			route  queryRoute
+		)
+		if err = rows.Scan(&metric, &route.endpoint, &route.rawOnly); err != nil {
+			return nil, err
+		}
+		routes[metric] = route
+	}
+	return routes, rows.Err()
+}
+
+// connFor returns the connection the queries following the route are sent
+// to. Metrics pinned to an endpoint the connector is not configured with
+// use the automatic choice.
+func (q *pgxQuerier) connFor(route queryRoute) pgxconn.PgxConn {
+	if conn, ok := q.cfg.ReadEndpoints[route.endpoint]; ok && conn != nil {
+		return conn
+	}
+	return q.conn
+}
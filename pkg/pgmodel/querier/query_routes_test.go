@@ -0,0 +1,61 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+func TestQueryRouteCache(t *testing.T) {
+	routesQuery := model.SqlQuery{
+		Sql: getQueryRoutesSQL,
+		Results: model.RowResults{
+			{"pinned", "replica", false},
+			{"raw", "", true},
+		},
+	}
+	mock := model.NewSqlRecorder([]model.SqlQuery{routesQuery, routesQuery}, t)
+	now := time.Now()
+	c := newQueryRouteCache(mock)
+	c.now = func() time.Time { return now }
+
+	route, err := c.get("pinned")
+	require.NoError(t, err)
+	require.Equal(t, queryRoute{endpoint: ReplicaEndpoint}, route)
+	route, err = c.get("raw")
+	require.NoError(t, err)
+	require.Equal(t, queryRoute{rawOnly: true}, route)
+	route, err = c.get("other")
+	require.NoError(t, err)
+	require.Equal(t, queryRoute{}, route, "metrics without a route use the automatic routing")
+
+	now = now.Add(queryRouteRefreshInterval)
+	_, err = c.get("other")
+	require.NoError(t, err)
+	require.Equal(t, now, c.fetched, "routes are fetched again after the refresh interval")
+}
+
+func TestConnFor(t *testing.T) {
+	var (
+		hedged  = model.NewSqlRecorder(nil, t)
+		primary = model.NewSqlRecorder(nil, t)
+		replica = model.NewSqlRecorder(nil, t)
+	)
+	q := &pgxQuerier{conn: hedged, cfg: Cfg{ReadEndpoints: map[string]pgxconn.PgxConn{
+		PrimaryEndpoint: primary,
+		ReplicaEndpoint: replica,
+	}}}
+	require.Same(t, hedged, q.connFor(queryRoute{}))
+	require.Same(t, primary, q.connFor(queryRoute{endpoint: PrimaryEndpoint}))
+	require.Same(t, replica, q.connFor(queryRoute{endpoint: ReplicaEndpoint, rawOnly: true}))
+
+	q.cfg.ReadEndpoints = map[string]pgxconn.PgxConn{PrimaryEndpoint: primary}
+	require.Same(t, hedged, q.connFor(queryRoute{endpoint: ReplicaEndpoint}), "unknown endpoints use the automatic routing")
+}
@@ -0,0 +1,118 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	getQueryViewsSQL = "SELECT view_schema, view_name, value_column, EXTRACT(epoch FROM resolution)::float8 FROM " + schema.Catalog + ".query_view WHERE metric_name = $1 ORDER BY resolution DESC"
+
+	// queryViewRefreshInterval is how long the registered query views of a
+	// metric are cached before they are fetched again, so that views which are
+	// registered or unregistered are picked up without a restart.
+	queryViewRefreshInterval = time.Minute
+)
+
+// queryView is a view registered by the user as a coarser resolution version
+// of a metric, usually a continuous aggregate.
+type queryView struct {
+	schema     string
+	name       string
+	column     string
+	resolution time.Duration
+}
+
+type queryViewEntry struct {
+	views   []queryView
+	fetched time.Time
+}
+
+// queryViewCache caches the query views of each metric, ordered from the
+// coarsest to the finest resolution.
+type queryViewCache struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	entries map[string]queryViewEntry
+	now     func() time.Time
+}
+
+func newQueryViewCache(conn pgxconn.PgxConn) *queryViewCache {
+	return &queryViewCache{
+		conn:    conn,
+		entries: make(map[string]queryViewEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *queryViewCache) get(metric string) ([]queryView, error) {
+	c.mux.Lock()
+	entry, ok := c.entries[metric]
+	c.mux.Unlock()
+	if ok && c.now().Sub(entry.fetched) < queryViewRefreshInterval {
+		return entry.views, nil
+	}
+
+	views, err := c.fetch(metric)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mux.Lock()
+	c.entries[metric] = queryViewEntry{views: views, fetched: c.now()}
+	c.mux.Unlock()
+	return views, nil
+}
+
+func (c *queryViewCache) fetch(metric string) ([]queryView, error) {
+	rows, err := c.conn.Query(context.Background(), getQueryViewsSQL, metric)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []queryView
+	for rows.Next() {
+		var (
+			view       queryView
+			resolution float64
+		)
+		if err = rows.Scan(&view.schema, &view.name, &view.column, &resolution); err != nil {
+			return nil, err
+		}
+		view.resolution = time.Duration(resolution * float64(time.Second))
+		views = append(views, view)
+	}
+	return views, rows.Err()
+}
+
+// selectQueryView returns the coarsest view whose resolution is fine enough
+// for both the step and the range of the query, or nil if the raw metric
+// table has to be used. Queries without a step, like remote read, always use
+// the raw data.
+func selectQueryView(views []queryView, hints *storage.SelectHints) *queryView {
+	if hints == nil || hints.Step <= 0 {
+		return nil
+	}
+	step := time.Duration(hints.Step) * time.Millisecond
+	window := time.Duration(hints.Range) * time.Millisecond
+	for i := range views {
+		if views[i].resolution > step {
+			continue
+		}
+		if window > 0 && views[i].resolution > window {
+			continue
+		}
+		return &views[i]
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectQueryView(t *testing.T) {
+	views := []queryView{
+		{name: "daily", resolution: 24 * time.Hour},
+		{name: "hourly", resolution: time.Hour},
+		{name: "minutely", resolution: time.Minute},
+	}
+	ms := func(d time.Duration) int64 { return int64(d / time.Millisecond) }
+
+	testCases := []struct {
+		name     string
+		hints    *storage.SelectHints
+		expected string
+	}{
+		{name: "no hints"},
+		{name: "no step", hints: &storage.SelectHints{Range: ms(48 * time.Hour)}},
+		{name: "step finer than every view", hints: &storage.SelectHints{Step: ms(30 * time.Second)}},
+		{name: "step equal to resolution", hints: &storage.SelectHints{Step: ms(time.Hour)}, expected: "hourly"},
+		{name: "coarsest eligible view", hints: &storage.SelectHints{Step: ms(48 * time.Hour)}, expected: "daily"},
+		{name: "range limits resolution", hints: &storage.SelectHints{Step: ms(48 * time.Hour), Range: ms(5 * time.Minute)}, expected: "minutely"},
+		{name: "range finer than every view", hints: &storage.SelectHints{Step: ms(48 * time.Hour), Range: ms(30 * time.Second)}},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			view := selectQueryView(views, c.hints)
+			if c.expected == "" {
+				require.Nil(t, view)
+				return
+			}
+			require.NotNil(t, view)
+			require.Equal(t, c.expected, view.name)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+const (
+	/* The label id clauses of the regex matchers translated to SQL predicates on the values of the labels, which the
+	* planner can use the indexes of the label table for instead of scanning all the values of the key. */
+	subQueryLabelIDsFormat           = "labels && (SELECT COALESCE(array_agg(l.id), array[]::int[]) FROM _prom_catalog.label l WHERE l.key = $%%d and %s)"
+	subQueryLabelIDsMatchEmptyFormat = "NOT labels && (SELECT COALESCE(array_agg(l.id), array[]::int[]) FROM _prom_catalog.label l WHERE l.key = $%%d and %s)"
+
+	regexValuesPredicate = "l.value = ANY($%d::text[])"
+	regexPrefixPredicate = "l.value LIKE $%d"
+	// regexPrefixNoNewlinePredicate is the predicate of a prefix followed by
+	// a .* that does not match newlines.
+	regexPrefixNoNewlinePredicate = "l.value LIKE $%d AND strpos(l.value, chr(10)) = 0"
+
+	// maxRegexValues is the largest set of values a regex is translated to
+	// an IN list of.
+	maxRegexValues = 256
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+/* regexClause returns the clause of a regex matcher with its regex translated to an IN list, if it only matches a
+* finite set of values, e.g. "a|b|c", or to a LIKE predicate, if it matches the values with a prefix, e.g. "api/.*".
+* Regexes that cannot be translated exactly are left to the regex operator. */
+func regexClause(m *labels.Matcher, matchesEmpty bool) (string, []interface{}, bool) {
+	predicate, arg, ok := regexPredicate(m.Value)
+	if !ok {
+		return "", nil, false
+	}
+	// A regex matcher selects the series with a label matching the regex,
+	// unless it matches the empty value, in which case it excludes the
+	// series with a label not matching it, and conversely for a negated one.
+	negate := m.Type == labels.MatchNotRegexp
+	format := subQueryLabelIDsFormat
+	if matchesEmpty {
+		negate = !negate
+		format = subQueryLabelIDsMatchEmptyFormat
+	}
+	if negate {
+		predicate = "NOT (" + predicate + ")"
+	}
+	return fmt.Sprintf(format, predicate), []interface{}{m.Name, arg}, true
+}
+
+// regexPredicate returns the predicate on the values of the labels matching
+// the regex, fully anchored as in Prometheus, along with its argument.
+func regexPredicate(regex string) (string, interface{}, bool) {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return "", nil, false
+	}
+	re = re.Simplify()
+
+	if values, ok := regexValues(re, maxRegexValues); ok {
+		return regexValuesPredicate, values, true
+	}
+
+	// A prefix followed by .*
+	var prefixRe, star *syntax.Regexp
+	switch {
+	case re.Op == syntax.OpStar:
+		star = re
+	case re.Op == syntax.OpConcat && len(re.Sub) > 1 && re.Sub[len(re.Sub)-1].Op == syntax.OpStar:
+		prefixRe = &syntax.Regexp{Op: syntax.OpConcat, Sub: re.Sub[:len(re.Sub)-1]}
+		star = re.Sub[len(re.Sub)-1]
+	default:
+		return "", nil, false
+	}
+	if star.Sub[0].Op != syntax.OpAnyChar && star.Sub[0].Op != syntax.OpAnyCharNotNL {
+		return "", nil, false
+	}
+	prefix := ""
+	if prefixRe != nil {
+		prefixes, ok := regexValues(prefixRe, 1)
+		if !ok {
+			return "", nil, false
+		}
+		prefix = prefixes[0]
+	}
+	if star.Sub[0].Op == syntax.OpAnyChar {
+		return regexPrefixPredicate, likeEscaper.Replace(prefix) + "%", true
+	}
+	if strings.ContainsRune(prefix, '\n') {
+		return "", nil, false
+	}
+	return regexPrefixNoNewlinePredicate, likeEscaper.Replace(prefix) + "%", true
+}
+
+// regexValues returns the values the regex matches, if there are at most max
+// of them.
+func regexValues(re *syntax.Regexp, max int) ([]string, bool) {
+	if max < 1 {
+		return nil, false
+	}
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, false
+		}
+		return []string{string(re.Rune)}, true
+	case syntax.OpCharClass:
+		var values []string
+		for i := 0; i < len(re.Rune); i += 2 {
+			if int(re.Rune[i+1]-re.Rune[i])+1+len(values) > max {
+				return nil, false
+			}
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				values = append(values, string(r))
+			}
+		}
+		return values, len(values) > 0
+	case syntax.OpCapture:
+		return regexValues(re.Sub[0], max)
+	case syntax.OpQuest:
+		values, ok := regexValues(re.Sub[0], max-1)
+		if !ok {
+			return nil, false
+		}
+		return append([]string{""}, values...), true
+	case syntax.OpAlternate:
+		var values []string
+		for _, sub := range re.Sub {
+			subValues, ok := regexValues(sub, max-len(values))
+			if !ok {
+				return nil, false
+			}
+			values = append(values, subValues...)
+		}
+		return values, true
+	case syntax.OpConcat:
+		values := []string{""}
+		for _, sub := range re.Sub {
+			subValues, ok := regexValues(sub, max)
+			if !ok || len(values)*len(subValues) > max {
+				return nil, false
+			}
+			concat := make([]string, 0, len(values)*len(subValues))
+			for _, v := range values {
+				for _, s := range subValues {
+					concat = append(concat, v+s)
+				}
+			}
+			values = concat
+		}
+		return values, true
+	}
+	return nil, false
+}
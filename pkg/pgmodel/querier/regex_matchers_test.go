@@ -0,0 +1,84 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexPredicate(t *testing.T) {
+	testCases := []struct {
+		regex     string
+		predicate string
+		arg       interface{}
+		notOk     bool
+	}{
+		{regex: "a|b|c", predicate: regexValuesPredicate, arg: []string{"a", "b", "c"}},
+		{regex: "get|post|put", predicate: regexValuesPredicate, arg: []string{"get", "post", "put"}},
+		{regex: "foo|foobar", predicate: regexValuesPredicate, arg: []string{"foo", "foobar"}},
+		{regex: "api-(east|west)-[12]", predicate: regexValuesPredicate, arg: []string{"api-east-1", "api-east-2", "api-west-1", "api-west-2"}},
+		{regex: "5xx?", predicate: regexValuesPredicate, arg: []string{"5x", "5xx"}},
+		{regex: "", predicate: regexValuesPredicate, arg: []string{""}},
+		{regex: "/api/.*", predicate: regexPrefixNoNewlinePredicate, arg: "/api/%"},
+		{regex: "(?s)/api/.*", predicate: regexPrefixPredicate, arg: "/api/%"},
+		{regex: "100%_.*", predicate: regexPrefixNoNewlinePredicate, arg: `100\%\_%`},
+		{regex: ".*", predicate: regexPrefixNoNewlinePredicate, arg: "%"},
+		{regex: "(?i)get", notOk: true},
+		{regex: "api.+", notOk: true},
+		{regex: ".*api", notOk: true},
+		{regex: "(a|b)/.*", notOk: true},
+		{regex: "^api$", notOk: true},
+		{regex: "[a-z]{3}", notOk: true},
+		{regex: "(", notOk: true},
+	}
+	for _, c := range testCases {
+		t.Run(c.regex, func(t *testing.T) {
+			predicate, arg, ok := regexPredicate(c.regex)
+			if c.notOk {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, c.predicate, predicate)
+			require.Equal(t, c.arg, arg)
+		})
+	}
+}
+
+func TestRegexClause(t *testing.T) {
+	testCases := []struct {
+		matcher *labels.Matcher
+		clause  string
+	}{
+		{
+			matcher: labels.MustNewMatcher(labels.MatchRegexp, "job", "a|b"),
+			clause:  fmt.Sprintf(subQueryLabelIDsFormat, regexValuesPredicate),
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchRegexp, "job", "|a|b"),
+			clause:  fmt.Sprintf(subQueryLabelIDsMatchEmptyFormat, "NOT ("+regexValuesPredicate+")"),
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "job", "a|b"),
+			clause:  fmt.Sprintf(subQueryLabelIDsMatchEmptyFormat, regexValuesPredicate),
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "job", "|a|b"),
+			clause:  fmt.Sprintf(subQueryLabelIDsFormat, "NOT ("+regexValuesPredicate+")"),
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.matcher.String(), func(t *testing.T) {
+			clause, args, ok := regexClause(c.matcher, c.matcher.Matches(""))
+			require.True(t, ok)
+			require.Equal(t, c.clause, clause)
+			require.Equal(t, "job", args[0])
+		})
+	}
+}
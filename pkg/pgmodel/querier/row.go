@@ -1,7 +1,9 @@
 package querier
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"sync"
 
 	"github.com/jackc/pgtype"
@@ -24,6 +26,156 @@ var tPool = sync.Pool{
 	},
 }
 
+var idsPool = sync.Pool{
+	New: func() interface{} {
+		return new([]int64)
+	},
+}
+
+var rowsPool = sync.Pool{
+	New: func() interface{} {
+		return new([]timescaleRow)
+	},
+}
+
+// getRows returns an empty slice of rows from the pool.
+func getRows() []timescaleRow {
+	return (*rowsPool.Get().(*[]timescaleRow))[:0]
+}
+
+// releaseRows closes the rows and returns them to the pool. Neither the
+// rows nor their arrays can be used afterwards.
+func releaseRows(rows []timescaleRow) {
+	for i := range rows {
+		rows[i].Close()
+		rows[i] = timescaleRow{}
+	}
+	rows = rows[:0]
+	rowsPool.Put(&rows)
+}
+
+//wrapper to allow decoding to reuse the existing slice of label ids so that a pool is effective
+type labelIDsWrapper struct {
+	ids *[]int64
+}
+
+func (w *labelIDsWrapper) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	ids := (*w.ids)[:0]
+	if src == nil {
+		*w.ids = ids
+		return nil
+	}
+
+	var arrayHeader pgtype.ArrayHeader
+	rp, err := arrayHeader.DecodeBinary(ci, src)
+	if err != nil {
+		return err
+	}
+
+	if len(arrayHeader.Dimensions) == 0 {
+		*w.ids = ids
+		return nil
+	}
+
+	elementCount := int(arrayHeader.Dimensions[0].Length)
+	for _, d := range arrayHeader.Dimensions[1:] {
+		elementCount *= int(d.Length)
+	}
+
+	//reuse logic
+	if cap(ids) < elementCount {
+		ids = make([]int64, elementCount)
+	} else {
+		ids = ids[:elementCount]
+	}
+
+	for i := range ids {
+		elemLen := int(int32(binary.BigEndian.Uint32(src[rp:])))
+		rp += 4
+		switch elemLen {
+		case -1:
+			ids[i] = 0
+		case 4:
+			ids[i] = int64(int32(binary.BigEndian.Uint32(src[rp:])))
+		case 8:
+			ids[i] = int64(binary.BigEndian.Uint64(src[rp:]))
+		default:
+			return fmt.Errorf("invalid length for label id: %v", elemLen)
+		}
+		if elemLen > 0 {
+			rp += elemLen
+		}
+	}
+
+	*w.ids = ids
+	return nil
+}
+
+func (w *labelIDsWrapper) DecodeText(_ *pgtype.ConnInfo, src []byte) error {
+	ids := (*w.ids)[:0]
+	if src == nil {
+		*w.ids = ids
+		return nil
+	}
+	if len(src) < 2 || src[0] != '{' || src[len(src)-1] != '}' {
+		return fmt.Errorf("invalid label id array: %q", src)
+	}
+
+	body := src[1 : len(src)-1]
+	for len(body) > 0 {
+		elem := body
+		if i := bytes.IndexByte(body, ','); i >= 0 {
+			elem, body = body[:i], body[i+1:]
+		} else {
+			body = nil
+		}
+		id, err := parseLabelID(elem)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	*w.ids = ids
+	return nil
+}
+
+// parseLabelID parses an element of the text form of a label id array
+// without allocating.
+func parseLabelID(elem []byte) (int64, error) {
+	if string(elem) == "NULL" {
+		return 0, nil
+	}
+	digits := elem
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 {
+		return 0, fmt.Errorf("invalid label id: %q", elem)
+	}
+	var id int64
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid label id: %q", elem)
+		}
+		id = id*10 + int64(c-'0')
+	}
+	if len(digits) != len(elem) {
+		id = -id
+	}
+	return id, nil
+}
+
+// Set assigns the label ids directly, as pgtype values do.
+func (w *labelIDsWrapper) Set(src interface{}) error {
+	ids, ok := src.([]int64)
+	if !ok {
+		return fmt.Errorf("cannot assign %T to label ids", src)
+	}
+	*w.ids = append((*w.ids)[:0], ids...)
+	return nil
+}
+
 //wrapper to allow DecodeBinary to reuse the existing array so that a pool is effective
 type timestamptzArrayWrapper struct {
 	*pgtype.TimestamptzArray
@@ -140,50 +292,80 @@ type timescaleRow struct {
 	metricOverride string
 	schema         string
 	column         string
+	// additionalLabels are shared by all the rows of a query result
+	// with the same schema and column, see GetAdditionalLabels.
+	additionalLabels labels.Labels
+	// labels are the labels of rows that are not resolved from label ids,
+	// like the rows of external metrics.
+	labels labels.Labels
 
 	//only used to hold ownership for releasing to pool
 	timeArrayOwnership *pgtype.TimestamptzArray
+	labelIdsOwnership  *[]int64
 }
 
 func (r *timescaleRow) Close() {
 	if r.timeArrayOwnership != nil {
 		tPool.Put(r.timeArrayOwnership)
 	}
-	fPool.Put(r.values)
+	if r.labelIdsOwnership != nil {
+		*r.labelIdsOwnership = r.labelIds[:0]
+		idsPool.Put(r.labelIdsOwnership)
+	}
+	if r.values != nil {
+		fPool.Put(r.values)
+	}
+}
+
+// GetAdditionalLabels returns the labels that identify the schema and column
+// the row was read from, when those are not the defaults. The returned labels
+// may be shared with other rows and must not be modified.
+func (r *timescaleRow) GetAdditionalLabels() labels.Labels {
+	if r.additionalLabels == nil {
+		r.additionalLabels = additionalLabels(r.schema, r.column)
+	}
+	return r.additionalLabels
 }
 
-func (r *timescaleRow) GetAdditionalLabels() (ll labels.Labels) {
-	if r.schema != "" && r.schema != schema.Data {
-		ll = append(ll, labels.Label{Name: model.SchemaNameLabelName, Value: r.schema})
+func additionalLabels(schemaName, column string) (ll labels.Labels) {
+	if schemaName != "" && schemaName != schema.Data {
+		ll = append(ll, labels.Label{Name: model.SchemaNameLabelName, Value: schemaName})
 	}
-	if r.column != "" && r.column != defaultColumnName {
-		ll = append(ll, labels.Label{Name: model.ColumnNameLabelName, Value: r.column})
+	if column != "" && column != defaultColumnName {
+		ll = append(ll, labels.Label{Name: model.ColumnNameLabelName, Value: column})
 	}
 	return ll
 }
 
 // appendTsRows adds new results rows to already existing result rows and
-// returns the as a result.
-func appendTsRows(out []timescaleRow, in pgxconn.PgxRows, tsSeries TimestampSeries, metric, schema, column string) ([]timescaleRow, error) {
+// returns the as a result. The label ids of the rows are handed to the resolver
+// as they are fetched.
+func appendTsRows(out []timescaleRow, in pgxconn.PgxRows, tsSeries TimestampSeries, metric, schema, column string, resolver *labelResolver) ([]timescaleRow, error) {
 	if in.Err() != nil {
 		return out, in.Err()
 	}
+	// All the rows have the same additional labels, so they are built once
+	// instead of once per series.
+	additional := additionalLabels(schema, column)
 	for in.Next() {
 		var row timescaleRow
 		values := fPool.Get().(*pgtype.Float8Array)
 		values.Elements = values.Elements[:0]
 		valuesWrapper := float8ArrayWrapper{values}
+		row.labelIdsOwnership = idsPool.Get().(*[]int64)
+		row.labelIds = (*row.labelIdsOwnership)[:0]
+		idsWrapper := labelIDsWrapper{&row.labelIds}
 
 		//if a timeseries isn't provided it will be fetched from the database
 		if tsSeries == nil {
 			times := tPool.Get().(*pgtype.TimestamptzArray)
 			times.Elements = times.Elements[:0]
 			timesWrapper := timestamptzArrayWrapper{times}
-			row.err = in.Scan(&row.labelIds, &timesWrapper, &valuesWrapper)
+			row.err = in.Scan(&idsWrapper, &timesWrapper, &valuesWrapper)
 			row.timeArrayOwnership = times
 			row.times = newRowTimestampSeries(times)
 		} else {
-			row.err = in.Scan(&row.labelIds, &valuesWrapper)
+			row.err = in.Scan(&idsWrapper, &valuesWrapper)
 			row.times = tsSeries
 		}
 
@@ -191,12 +373,14 @@ func appendTsRows(out []timescaleRow, in pgxconn.PgxRows, tsSeries TimestampSeri
 		row.metricOverride = metric
 		row.schema = schema
 		row.column = column
+		row.additionalLabels = additional
 
 		out = append(out, row)
 		if row.err != nil {
 			log.Error("err", row.err)
 			return out, row.err
 		}
+		resolver.add(row.labelIds)
 	}
 	return out, in.Err()
 }
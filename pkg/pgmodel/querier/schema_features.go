@@ -0,0 +1,76 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/version"
+)
+
+const (
+	getSchemaVersionSQL = "SELECT version FROM public.prom_schema_migrations LIMIT 1"
+
+	// schemaVersionRefreshInterval is how long the schema version is cached,
+	// so that the features are enabled within a minute of the migration.
+	schemaVersionRefreshInterval = time.Minute
+)
+
+// schemaFeatures tracks the version of the database schema, so that the
+// querier only uses the SQL objects the schema has. This lets connectors be
+// upgraded before the database is migrated in rolling upgrades, running
+// against the previous schema version with the newer features disabled until
+// the migration.
+//
+// The connector only runs against the schema before the last migration,
+// version.EarliestCompatibleSchema, so only the parts of the querier relying
+// on the SQL objects added by the last migration check for its version. No
+// part does at the moment.
+type schemaFeatures struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	version *semver.Version
+	fetched time.Time
+	now     func() time.Time
+}
+
+func newSchemaFeatures(conn pgxconn.PgxConn) *schemaFeatures {
+	return &schemaFeatures{
+		conn: conn,
+		now:  time.Now,
+	}
+}
+
+// supports returns whether the database schema is at least at version v. If
+// the schema version cannot be fetched, the last known version is used, and
+// the features are assumed to be supported if there is none.
+func (s *schemaFeatures) supports(v semver.Version) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.version == nil || s.now().Sub(s.fetched) >= schemaVersionRefreshInterval {
+		s.refresh()
+	}
+	return s.version == nil || s.version.GTE(v)
+}
+
+func (s *schemaFeatures) refresh() {
+	var dbVersion semver.Version
+	if err := s.conn.QueryRow(context.Background(), getSchemaVersionSQL).Scan(&dbVersion); err != nil {
+		log.Warn("msg", "error fetching the schema version, keeping the known query features", "err", err)
+		s.fetched = s.now()
+		return
+	}
+	if (s.version == nil || !s.version.EQ(dbVersion)) && dbVersion.LT(semver.MustParse(version.Promscale)) {
+		log.Warn("msg", "the database schema is older than the connector, the query features that need a newer schema are disabled until it is migrated",
+			"schema_version", dbVersion.String(), "connector_version", version.Promscale)
+	}
+	s.version = &dbVersion
+	s.fetched = s.now()
+}
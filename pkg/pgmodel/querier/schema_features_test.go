@@ -0,0 +1,29 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaFeatures(t *testing.T) {
+	now := time.Now()
+	dbVersion := semver.MustParse("0.5.2-dev.19")
+	s := &schemaFeatures{version: &dbVersion, fetched: now, now: func() time.Time { return now }}
+
+	previous := semver.MustParse("0.5.2-dev.19")
+	latest := semver.MustParse("0.5.2-dev.20")
+	require.True(t, s.supports(previous))
+	require.False(t, s.supports(latest), "the schema is not migrated yet")
+
+	q := &pgxQuerier{}
+	require.True(t, q.supports(latest), "all the features are used without schema tracking")
+	q.schemaFeatures = s
+	require.False(t, q.supports(latest))
+}
@@ -0,0 +1,35 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+)
+
+type seriesLimitKey struct{}
+
+// WithSeriesLimit returns a context whose selects fetch at most limit series
+// of each metric, which is only correct for the queries whose result series
+// are the series they select. The callers truncate the result to the limit
+// across metrics.
+func WithSeriesLimit(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, seriesLimitKey{}, limit)
+}
+
+// seriesLimitFrom returns the series limit of the context, 0 if it has none.
+func seriesLimitFrom(ctx context.Context) int {
+	limit, _ := ctx.Value(seriesLimitKey{}).(int)
+	return limit
+}
+
+// limitClause returns the clause limiting the number of rows of a query to
+// the series limit of filter, if any.
+func limitClause(filter metricTimeRangeFilter) string {
+	if filter.seriesLimit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\tLIMIT %d", filter.seriesLimit)
+}
@@ -0,0 +1,40 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	pgmodel "github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestSeriesLimit(t *testing.T) {
+	require.Equal(t, 0, seriesLimitFrom(context.Background()))
+	require.Equal(t, 3, seriesLimitFrom(WithSeriesLimit(context.Background(), 3)))
+
+	filter := metricTimeRangeFilter{
+		metric:      "cpu_usage",
+		schema:      "prom_data",
+		column:      defaultColumnName,
+		seriesTable: "cpu_usage",
+		startTime:   "start",
+		endTime:     "end",
+	}
+	sql, _, _, _, err := buildTimeseriesByLabelClausesQuery(filter, []string{"labels && $1"}, []interface{}{"x"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.NotContains(t, sql, "LIMIT")
+	require.NotContains(t, buildTimeseriesBySeriesIDQuery(filter, []pgmodel.SeriesID{1, 2}), "LIMIT")
+
+	filter.seriesLimit = 3
+	for _, cases := range [][]string{{"labels && $1"}, {"TRUE"}} {
+		sql, _, _, _, err = buildTimeseriesByLabelClausesQuery(filter, cases, []interface{}{"x"}, nil, nil, nil)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(sql, "\n\tLIMIT 3"), sql)
+	}
+	require.True(t, strings.HasSuffix(buildTimeseriesBySeriesIDQuery(filter, []pgmodel.SeriesID{1, 2}), "GROUP BY s.id\n\tLIMIT 3"))
+}
@@ -0,0 +1,165 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+)
+
+// seriesInRangeSQLFormat selects the labels of the series that have a sample
+// in the time range, which is checked with a lookup of the (series_id, time)
+// index of the metric table rather than by reading the samples.
+const seriesInRangeSQLFormat = `SELECT kv.keys, kv.vals
+FROM ` + schema.Catalog + `.series s
+CROSS JOIN LATERAL ` + schema.Prom + `.key_value_array(s.labels) kv
+WHERE s.id = ANY($1)
+AND EXISTS (SELECT 1 FROM %s d WHERE d.series_id = s.id AND d.time >= $2 AND d.time <= $3)`
+
+// SeriesQuerier is implemented by the queriers that can return the label sets
+// of the series matching selectors without fetching their samples.
+type SeriesQuerier interface {
+	// SelectSeries returns the sorted, distinct label sets of the series
+	// matching any of the matcher sets that have samples between mint and
+	// maxt.
+	SelectSeries(ctx context.Context, mint, maxt int64, matcherSets ...[]*labels.Matcher) ([]labels.Labels, error)
+}
+
+var _ SeriesQuerier = (*pgxQuerier)(nil)
+
+// SelectSeries implements the SeriesQuerier interface. The matchers are
+// resolved against the series table, and the samples of the series are only
+// probed for their existence in the time range.
+func (q *pgxQuerier) SelectSeries(ctx context.Context, mint, maxt int64, matcherSets ...[]*labels.Matcher) ([]labels.Labels, error) {
+	var res []labels.Labels
+	for _, matchers := range matcherSets {
+		series, err := q.selectSeries(ctx, mint, maxt, matchers)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, series...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return labels.Compare(res[i], res[j]) < 0
+	})
+	// The series matched by several matcher sets are returned once.
+	distinct := res[:0]
+	for i := range res {
+		if i == 0 || !labels.Equal(res[i], res[i-1]) {
+			distinct = append(distinct, res[i])
+		}
+	}
+	return distinct, nil
+}
+
+func (q *pgxQuerier) selectSeries(ctx context.Context, mint, maxt int64, matchers []*labels.Matcher) ([]labels.Labels, error) {
+	var res []labels.Labels
+	err := q.queryMatchingSeries(ctx, mint, maxt, matchers, seriesInRangeSQLFormat, nil, func(rows pgx.Rows) error {
+		var keys, vals []string
+		if err := rows.Scan(&keys, &vals); err != nil {
+			return err
+		}
+		lbls := make(labels.Labels, len(keys))
+		for j := range keys {
+			lbls[j] = labels.Label{Name: keys[j], Value: vals[j]}
+		}
+		sort.Sort(lbls)
+		res = append(res, lbls)
+		return nil
+	})
+	return res, err
+}
+
+// queryMatchingSeries runs, for each metric with series matching the
+// matchers, the statement of sqlFormat, formatted with the table of the
+// metric, with the IDs of these series, the time range and args as
+// arguments, and calls scan for each of the rows it returns.
+func (q *pgxQuerier) queryMatchingSeries(ctx context.Context, mint, maxt int64, matchers []*labels.Matcher, sqlFormat string, args []interface{}, scan func(pgx.Rows) error) error {
+	if q.rAuth != nil {
+		matchers = q.rAuth.AppendTenantMatcher(matchers)
+	}
+	if q.cfg.LabelEncryptor != nil {
+		var err error
+		if matchers, err = q.cfg.LabelEncryptor.EncryptMatchers(matchers); err != nil {
+			return err
+		}
+	}
+	builder, err := BuildSubQueries(matchers)
+	if err != nil {
+		return err
+	}
+	clauses, values, err := builder.Build(true)
+	if err != nil {
+		return err
+	}
+	rows, err := q.conn.Query(ctx, BuildMetricNameSeriesIDQuery(clauses), values...)
+	if err != nil {
+		return err
+	}
+	metrics, schemas, seriesIDs, err := GetSeriesPerMetric(rows)
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	start, end := timestamp.Time(mint), timestamp.Time(maxt)
+	batch := q.conn.NewBatch()
+	queued := 0
+	for i, metric := range metrics {
+		mInfo, err := q.getMetricTableName(schemas[i], metric)
+		if err != nil {
+			// The series of metrics without a table have no samples.
+			if err == errors.ErrMissingTableName {
+				continue
+			}
+			return err
+		}
+		readSchema, err := q.readSchema(mInfo.TableSchema, mInfo.TableName)
+		if err != nil {
+			return fmt.Errorf("get write shards of metric %s: %w", metric, err)
+		}
+		ids := make([]int64, len(seriesIDs[i]))
+		for j, id := range seriesIDs[i] {
+			ids[j] = int64(id)
+		}
+		table := pgx.Identifier{readSchema, mInfo.TableName}.Sanitize()
+		batch.Queue(fmt.Sprintf(sqlFormat, table), append([]interface{}{ids, start, end}, args...)...)
+		queued++
+	}
+	if queued == 0 {
+		return nil
+	}
+
+	results, err := q.conn.SendBatch(ctx, batch)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	for i := 0; i < queued; i++ {
+		rows, err := results.Query()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err = scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
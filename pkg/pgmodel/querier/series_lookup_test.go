@@ -0,0 +1,63 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestSelectSeries(t *testing.T) {
+	seriesSQL := func(matchers ...*labels.Matcher) (string, []interface{}) {
+		cb, err := BuildSubQueries(matchers)
+		require.NoError(t, err)
+		clauses, values, err := cb.Build(true)
+		require.NoError(t, err)
+		return BuildMetricNameSeriesIDQuery(clauses), values
+	}
+	up := labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")
+	job := labels.MustNewMatcher(labels.MatchEqual, "job", "api")
+	upSQL, upArgs := seriesSQL(up)
+	jobSQL, jobArgs := seriesSQL(job)
+	start, end := timestamp.Time(1000), timestamp.Time(2000)
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: upSQL, Args: upArgs, Results: model.RowResults{{"prom_data", "up", []int64{1, 2}}}},
+		{
+			Sql:  fmt.Sprintf(seriesInRangeSQLFormat, `"prom_data"."up"`),
+			Args: []interface{}{[]int64{1, 2}, start, end},
+			Results: model.RowResults{
+				{[]string{"job", "__name__"}, []string{"db", "up"}},
+				{[]string{"__name__", "job"}, []string{"up", "api"}},
+			},
+		},
+		{Sql: jobSQL, Args: jobArgs, Results: model.RowResults{{"prom_data", "up", []int64{2}}, {"prom_data", "missing", []int64{7}}}},
+		{Sql: getMetricsTableSQL, Args: []interface{}{"prom_data", "missing"}, Err: pgx.ErrNoRows},
+		{
+			Sql:     fmt.Sprintf(seriesInRangeSQLFormat, `"prom_data"."up"`),
+			Args:    []interface{}{[]int64{2}, start, end},
+			Results: model.RowResults{{[]string{"__name__", "job"}, []string{"up", "api"}}},
+		},
+	}, t)
+	metrics := &model.MockMetricCache{MetricCache: map[string]model.MetricInfo{}}
+	require.NoError(t, metrics.Set("prom_data", "up", model.MetricInfo{TableSchema: "prom_data", TableName: "up", SeriesTable: "up"}))
+	q := &pgxQuerier{conn: mock, metricTableNames: metrics}
+
+	res, err := q.SelectSeries(context.Background(), 1000, 2000, []*labels.Matcher{up}, []*labels.Matcher{job})
+	require.NoError(t, err)
+	// The series matched by both matcher sets are returned once, and the
+	// series of metrics without a table are not returned.
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "api"),
+		labels.FromStrings("__name__", "up", "job", "db"),
+	}, res)
+}
@@ -0,0 +1,70 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	getSeriesPartitionsSQL = "SELECT " + schema.Catalog + ".get_metric_series_partitions($1)"
+
+	// seriesPartitionRefreshInterval is how long it is cached whether a metric
+	// table is partitioned by series, so that tables converted while the
+	// connector runs are picked up without a restart.
+	seriesPartitionRefreshInterval = time.Minute
+
+	// seriesPartitionClause lets TimescaleDB exclude the chunks of the other
+	// series partitions at execution time, once the series of the outer row
+	// is known. The hash is the one TimescaleDB partitions with.
+	seriesPartitionClause = " AND _timescaledb_internal.get_partition_hash(metric.series_id) = _timescaledb_internal.get_partition_hash(series.id)"
+)
+
+type seriesPartitionEntry struct {
+	partitioned bool
+	fetched     time.Time
+}
+
+// seriesPartitionCache caches whether each metric table is partitioned by
+// the hash of series_id in addition to time.
+type seriesPartitionCache struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	entries map[string]seriesPartitionEntry
+	now     func() time.Time
+}
+
+func newSeriesPartitionCache(conn pgxconn.PgxConn) *seriesPartitionCache {
+	return &seriesPartitionCache{
+		conn:    conn,
+		entries: make(map[string]seriesPartitionEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *seriesPartitionCache) partitioned(table string) (bool, error) {
+	c.mux.Lock()
+	entry, ok := c.entries[table]
+	c.mux.Unlock()
+	// A table cannot go back to being only partitioned by time.
+	if ok && (entry.partitioned || c.now().Sub(entry.fetched) < seriesPartitionRefreshInterval) {
+		return entry.partitioned, nil
+	}
+
+	var partitions int
+	if err := c.conn.QueryRow(context.Background(), getSeriesPartitionsSQL, table).Scan(&partitions); err != nil {
+		return false, err
+	}
+
+	c.mux.Lock()
+	c.entries[table] = seriesPartitionEntry{partitioned: partitions > 0, fetched: c.now()}
+	c.mux.Unlock()
+	return partitions > 0, nil
+}
@@ -0,0 +1,39 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesPartitionClause(t *testing.T) {
+	filter := metricTimeRangeFilter{
+		metric:      "cpu_usage",
+		schema:      "prom_data",
+		column:      defaultColumnName,
+		seriesTable: "cpu_usage",
+		startTime:   "start",
+		endTime:     "end",
+	}
+	cases := []string{"labels && $1"}
+
+	sql, _, _, _, err := buildTimeseriesByLabelClausesQuery(filter, cases, []interface{}{"x"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.NotContains(t, sql, "get_partition_hash")
+
+	filter.seriesPartitioned = true
+	sql, _, _, _, err = buildTimeseriesByLabelClausesQuery(filter, cases, []interface{}{"x"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(sql, "WHERE metric.series_id = series.id"+seriesPartitionClause), sql)
+
+	// Without matchers all the partitions are read, there is nothing to prune.
+	sql, _, _, _, err = buildTimeseriesByLabelClausesQuery(filter, []string{"TRUE"}, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NotContains(t, sql, "get_partition_hash")
+	require.NotContains(t, sql, "%!")
+}
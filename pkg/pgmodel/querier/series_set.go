@@ -5,8 +5,11 @@
 package querier
 
 import (
+	stderrors "errors"
 	"fmt"
+	"math"
 	"sort"
+	"sync"
 
 	"github.com/jackc/pgtype"
 	"github.com/prometheus/prometheus/pkg/labels"
@@ -20,6 +23,10 @@ const (
 	// Postgres time zero is Sat Jan 01 00:00:00 2000 UTC.
 	// This is the offset of the Unix epoch in milliseconds from the Postgres zero.
 	PostgresUnixEpoch = -946684800000
+
+	// lazyLabelRows is the number of rows whose labels are resolved at
+	// once by the series sets resolving them lazily.
+	lazyLabelRows = 500
 )
 
 // pgxSeriesSet implements storage.SeriesSet.
@@ -29,41 +36,147 @@ type pgxSeriesSet struct {
 	labelIDMap map[int64]labels.Label
 	err        error
 	querier    labelQuerier
+	// resolvedLabels holds the labels of each row when they were resolved
+	// up front, to rewrite them or to sort the rows by them.
+	resolvedLabels []labels.Labels
+	// lazy is set if the labels of the rows are resolved as the series
+	// are accessed, see resolveRows.
+	lazy bool
+	// resolvedRows is the number of rows, from the first, whose labels
+	// are resolved in labelIDMap when lazy is set.
+	resolvedRows int
+	// dropped is the number of rows left out of the set because some of
+	// their labels are missing.
+	dropped int
+	// warnings are the warnings of the rows of the set.
+	warnings storage.Warnings
+	buffers  sampleBuffers
+	cfg      Cfg
 }
 
 // pgxSeriesSet must implement storage.SeriesSet
 var _ storage.SeriesSet = (*pgxSeriesSet)(nil)
 
-func buildSeriesSet(rows []timescaleRow, querier labelQuerier) SeriesSet {
-	labelIDMap := make(map[int64]labels.Label)
-	initializeLabeIDMap(labelIDMap, rows)
-
-	err := querier.LabelsForIdMap(labelIDMap)
+// buildSeriesSet returns the series set of the rows once the resolver
+// resolved the labels they reference.
+func buildSeriesSet(rows []timescaleRow, resolver *labelResolver) SeriesSet {
+	labelIDMap, err := resolver.wait()
 	if err != nil {
 		return &errorSeriesSet{err}
 	}
 
 	return &pgxSeriesSet{
 		rows:       rows,
-		querier:    querier,
+		querier:    resolver.querier,
 		rowIdx:     -1,
 		labelIDMap: labelIDMap,
 	}
 }
 
-// Next forwards the internal cursor to next storage.Series
+// buildLazySeriesSet returns the series set of the rows, whose labels are
+// resolved with querier as the series are accessed, a batch of rows at a
+// time, rather than all before the set is returned. The labels of the
+// series that are never accessed are not resolved.
+func buildLazySeriesSet(rows []timescaleRow, querier labelQuerier) SeriesSet {
+	return &pgxSeriesSet{
+		rows:       rows,
+		querier:    querier,
+		rowIdx:     -1,
+		labelIDMap: make(map[int64]labels.Label),
+		lazy:       true,
+	}
+}
+
+// resolveRows resolves the labels of the rows before row end that are not
+// resolved yet, if the labels are resolved lazily.
+func (p *pgxSeriesSet) resolveRows(end int) error {
+	if !p.lazy || end <= p.resolvedRows {
+		return nil
+	}
+	batch := make(map[int64]labels.Label)
+	for i := p.resolvedRows; i < end; i++ {
+		for _, id := range p.rows[i].labelIds {
+			//id==0 means there is no label for the key, so nothing to look up
+			if id == 0 {
+				continue
+			}
+			if _, ok := p.labelIDMap[id]; !ok {
+				batch[id] = labels.Label{}
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := p.querier.LabelsForIdMap(batch); err != nil && !isMissingLabels(err) {
+			return err
+		}
+		for id, label := range batch {
+			p.labelIDMap[id] = label
+		}
+	}
+	p.resolvedRows = end
+	return nil
+}
+
+// Next forwards the internal cursor to next storage.Series, skipping the
+// rows whose labels are missing.
 func (p *pgxSeriesSet) Next() bool {
-	if p.rowIdx >= len(p.rows) {
+	for {
+		if p.rowIdx >= len(p.rows) {
+			return false
+		}
+		p.rowIdx += 1
+		if p.rowIdx >= len(p.rows) {
+			return false
+		}
+		if p.err == nil {
+			p.err = p.rows[p.rowIdx].err
+		}
+		if !p.missingLabels(p.rowIdx) {
+			return true
+		}
+		p.dropped++
+	}
+}
+
+// missingLabels returns whether some labels of row i are missing, e.g.
+// because they were deleted while the query ran. An error resolving the
+// labels is returned by At instead.
+func (p *pgxSeriesSet) missingLabels(i int) bool {
+	row := &p.rows[i]
+	if p.resolvedLabels != nil || row.labels != nil || row.err != nil {
 		return false
 	}
-	p.rowIdx += 1
-	if p.rowIdx >= len(p.rows) {
+	end := i + lazyLabelRows
+	if end > len(p.rows) {
+		end = len(p.rows)
+	}
+	if err := p.resolveRows(end); err != nil {
 		return false
 	}
-	if p.err == nil {
-		p.err = p.rows[p.rowIdx].err
+	return hasMissingLabels(row, p.labelIDMap)
+}
+
+// hasMissingLabels returns whether some label ids of the row are missing
+// from labelIDMap.
+func hasMissingLabels(row *timescaleRow, labelIDMap map[int64]labels.Label) bool {
+	for _, id := range row.labelIds {
+		if id != 0 && labelIDMap[id] == (labels.Label{}) {
+			return true
+		}
 	}
-	return true
+	return false
+}
+
+// isMissingLabels returns whether the error is about labels that are
+// missing, rather than failing to be looked up.
+func isMissingLabels(err error) bool {
+	return stderrors.Is(err, errors.ErrMissingLabels)
+}
+
+// droppedSeriesWarning is the warning of the series sets that left rows out
+// because some of their labels are missing.
+func droppedSeriesWarning(dropped int) error {
+	return fmt.Errorf("%d series were left out of the results because some of their labels are missing, e.g. after they were deleted while the query ran", dropped)
 }
 
 // At returns the current storage.Series.
@@ -83,30 +196,62 @@ func (p *pgxSeriesSet) At() storage.Series {
 	}
 
 	ps := &pgxSeries{
-		times:  row.times,
-		values: row.values,
+		times:   row.times,
+		values:  row.values,
+		buffers: &p.buffers,
+		cfg:     p.cfg,
+	}
+
+	if p.resolvedLabels != nil {
+		ps.labels = p.resolvedLabels[p.rowIdx]
+		return ps
 	}
 
 	// this should pretty much always be non-empty due to __name__, but it
 	// costs little to check here
-	if len(row.labelIds) == 0 {
+	if len(row.labelIds) == 0 && row.labels == nil {
 		return ps
 	}
 
+	end := p.rowIdx + lazyLabelRows
+	if end > len(p.rows) {
+		end = len(p.rows)
+	}
+	if err := p.resolveRows(end); err != nil {
+		p.err = err
+		return nil
+	}
+	lls, err := p.rowLabels(row)
+	if err != nil {
+		p.err = err
+		return nil
+	}
+	ps.labels = lls
+
+	return ps
+}
+
+// rowLabels resolves the label ids of a row into its sorted labels.
+func (p *pgxSeriesSet) rowLabels(row *timescaleRow) (labels.Labels, error) {
+	return rowLabels(row, p.labelIDMap)
+}
+
+// rowLabels resolves the label ids of a row into its sorted labels with the
+// labels of the ids.
+func rowLabels(row *timescaleRow, labelIDMap map[int64]labels.Label) (labels.Labels, error) {
+	if row.labels != nil {
+		return row.labels, nil
+	}
+	additional := row.GetAdditionalLabels()
 	var lls labels.Labels
-	lls = make([]labels.Label, 0, len(row.labelIds))
+	lls = make([]labels.Label, 0, len(row.labelIds)+len(additional))
 	for _, id := range row.labelIds {
 		if id == 0 {
 			continue
 		}
-		label, ok := p.labelIDMap[id]
-		if !ok {
-			p.err = fmt.Errorf("Missing label for id %v", id)
-			return nil
-		}
+		label := labelIDMap[id]
 		if label == (labels.Label{}) {
-			p.err = fmt.Errorf("Missing label for id %v", id)
-			return nil
+			return nil, fmt.Errorf("%w: no label for id %v", errors.ErrMissingLabels, id)
 		}
 		lls = append(lls, label)
 	}
@@ -119,12 +264,101 @@ func (p *pgxSeriesSet) At() storage.Series {
 			}
 		}
 	}
-	lls = append(lls, row.GetAdditionalLabels()...)
+	lls = append(lls, additional...)
 
 	sort.Sort(lls)
-	ps.labels = lls
+	return lls, nil
+}
 
-	return ps
+// resolveAllLabels returns the labels of every row.
+func (p *pgxSeriesSet) resolveAllLabels() ([]labels.Labels, error) {
+	if p.resolvedLabels != nil {
+		return p.resolvedLabels, nil
+	}
+	if err := p.resolveRows(len(p.rows)); err != nil {
+		return nil, err
+	}
+	p.dropMissingLabels()
+	resolved := make([]labels.Labels, len(p.rows))
+	for i := range p.rows {
+		row := &p.rows[i]
+		if row.err != nil {
+			return nil, row.err
+		}
+		lls, err := p.rowLabels(row)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = lls
+	}
+	return resolved, nil
+}
+
+// dropMissingLabels removes the rows whose labels are missing from the set.
+func (p *pgxSeriesSet) dropMissingLabels() {
+	kept := p.rows[:0]
+	for i := range p.rows {
+		if p.missingLabels(i) {
+			p.rows[i].Close()
+			p.dropped++
+			continue
+		}
+		kept = append(kept, p.rows[i])
+	}
+	p.rows = kept
+}
+
+// applyRewrite rewrites the labels of all the series in the set, so the
+// rewrite does not have to be evaluated by the engine. It returns false,
+// leaving the set untouched, if the rewrite cannot be applied to every
+// series or if it would make two series have the same labels, since the
+// engine has to merge or reject those.
+func (p *pgxSeriesSet) applyRewrite(rewrite labelRewriter) bool {
+	resolved, err := p.resolveAllLabels()
+	if err != nil {
+		return false
+	}
+	rewritten := make([]labels.Labels, len(resolved))
+	seen := make(map[uint64]struct{}, len(resolved))
+	for i := range resolved {
+		rewritten[i] = rewrite(resolved[i])
+		hash := rewritten[i].Hash()
+		if _, ok := seen[hash]; ok {
+			return false
+		}
+		seen[hash] = struct{}{}
+	}
+	p.resolvedLabels = rewritten
+	return true
+}
+
+// sortByLabels sorts the series in the set by their labels, as required
+// by consumers merging series sets. If the labels of a row cannot be
+// resolved the set is left unsorted, the error is returned by At.
+func (p *pgxSeriesSet) sortByLabels() {
+	resolved, err := p.resolveAllLabels()
+	if err != nil {
+		return
+	}
+	p.resolvedLabels = resolved
+	sort.Sort(rowsByLabels{p})
+}
+
+// rowsByLabels sorts the rows of a series set together with their
+// resolved labels.
+type rowsByLabels struct {
+	*pgxSeriesSet
+}
+
+func (r rowsByLabels) Len() int { return len(r.rows) }
+
+func (r rowsByLabels) Less(i, j int) bool {
+	return labels.Compare(r.resolvedLabels[i], r.resolvedLabels[j]) < 0
+}
+
+func (r rowsByLabels) Swap(i, j int) {
+	r.rows[i], r.rows[j] = r.rows[j], r.rows[i]
+	r.resolvedLabels[i], r.resolvedLabels[j] = r.resolvedLabels[j], r.resolvedLabels[i]
 }
 
 // Err implements storage.SeriesSet.
@@ -135,12 +369,23 @@ func (p *pgxSeriesSet) Err() error {
 	return nil
 }
 
-func (p *pgxSeriesSet) Warnings() storage.Warnings { return nil }
+// Warnings implements storage.SeriesSet. The set warns about the rows it
+// left out because some of their labels are missing, which are only all
+// known once the set was iterated.
+func (p *pgxSeriesSet) Warnings() storage.Warnings {
+	if p.dropped > 0 {
+		return append(p.warnings[:len(p.warnings):len(p.warnings)], droppedSeriesWarning(p.dropped))
+	}
+	return p.warnings
+}
 
+// Close returns the rows, their arrays and the buffers of the iterators of
+// the series to their pools. The labels of the series are not pooled, since
+// they may be referenced by query results after the set is closed.
 func (p *pgxSeriesSet) Close() {
-	for _, row := range p.rows {
-		row.Close()
-	}
+	releaseRows(p.rows)
+	p.rows = nil
+	p.buffers.release()
 }
 
 // pgxSeries implements storage.Series.
@@ -148,6 +393,10 @@ type pgxSeries struct {
 	labels labels.Labels
 	times  TimestampSeries
 	values *pgtype.Float8Array
+	// buffers hands out the buffers the samples are decoded into, nil to
+	// allocate them.
+	buffers *sampleBuffers
+	cfg     Cfg
 }
 
 // Labels returns the label names and values for the series.
@@ -157,7 +406,13 @@ func (p *pgxSeries) Labels() labels.Labels {
 
 // Iterator returns a chunkenc.Iterator for iterating over series data.
 func (p *pgxSeries) Iterator() chunkenc.Iterator {
-	return newIterator(p.times, p.values)
+	samples := new(decodedSamples)
+	if p.buffers != nil {
+		samples = p.buffers.get()
+	}
+	it := newBufferedIterator(p.times, p.values, p.cfg, samples)
+	it.labels = p.labels
+	return it
 }
 
 // pgxSeriesIterator implements storage.SeriesIterator.
@@ -165,40 +420,174 @@ type pgxSeriesIterator struct {
 	cur          int
 	totalSamples int
 	times        TimestampSeries
-	values       *pgtype.Float8Array
+	samples      *decodedSamples
+	// runEnd is the index of the last sample with the same timestamp
+	// as the current one, those samples are merged by the policy.
+	runEnd int
+	// checked is the index of the last sample checked for NULLs, so
+	// NULLs are only counted once when the samples after a run of
+	// samples with the same timestamp are visited again.
+	checked int
+	// rawTimes is set when the samples were read from the database as
+	// they are, rather than computed by a pushed down aggregate.
+	rawTimes bool
+	cfg      Cfg
+	// labels of the series, used in errors.
+	labels labels.Labels
+	err    error
 }
 
 // newIterator returns an iterator over the samples. It expects times and values to be the same length.
-func newIterator(times TimestampSeries, values *pgtype.Float8Array) *pgxSeriesIterator {
+func newIterator(times TimestampSeries, values *pgtype.Float8Array, cfg Cfg) *pgxSeriesIterator {
+	return newBufferedIterator(times, values, cfg, new(decodedSamples))
+}
+
+// newBufferedIterator returns an iterator over the samples, which are decoded
+// into samples.
+func newBufferedIterator(times TimestampSeries, values *pgtype.Float8Array, cfg Cfg, samples *decodedSamples) *pgxSeriesIterator {
+	_, rawTimes := times.(*rowTimestampSeries)
+	samples.decode(times, values)
 	return &pgxSeriesIterator{
 		cur:          -1,
+		runEnd:       -1,
+		checked:      -1,
+		rawTimes:     rawTimes,
 		totalSamples: times.Len(),
 		times:        times,
-		values:       values,
+		samples:      samples,
+		cfg:          cfg,
 	}
 }
 
-// Seek implements storage.SeriesIterator.
-func (p *pgxSeriesIterator) Seek(t int64) bool {
-	p.cur = -1
+// decodedSamples are the samples of a series decoded up front, so that
+// iterating them is plain slice indexing instead of a conversion and
+// status checks per sample.
+type decodedSamples struct {
+	times  []int64
+	values []float64
+	// present has the bit of each sample with both a timestamp and a
+	// value set.
+	present []uint64
+}
 
-	for p.Next() {
-		if p.getTs() >= t {
-			return true
+// decode decodes the samples, reusing the slices of d.
+func (d *decodedSamples) decode(times TimestampSeries, values *pgtype.Float8Array) {
+	n := times.Len()
+	d.times = resizeInt64s(d.times, n)
+	d.values = resizeFloat64s(d.values, n)
+	d.present = resizeUint64s(d.present, (n+63)/64)
+	for i := range d.present {
+		d.present[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		ts, tsPresent := times.At(i)
+		d.times[i] = ts
+		d.values[i] = values.Elements[i].Float
+		if tsPresent && values.Elements[i].Status == pgtype.Present {
+			d.present[i/64] |= 1 << (uint(i) % 64)
 		}
 	}
+}
 
-	return false
+func resizeInt64s(s []int64, n int) []int64 {
+	if cap(s) < n {
+		return make([]int64, n)
+	}
+	return s[:n]
+}
+
+func resizeFloat64s(s []float64, n int) []float64 {
+	if cap(s) < n {
+		return make([]float64, n)
+	}
+	return s[:n]
+}
+
+func resizeUint64s(s []uint64, n int) []uint64 {
+	if cap(s) < n {
+		return make([]uint64, n)
+	}
+	return s[:n]
+}
+
+var samplesPool = sync.Pool{
+	New: func() interface{} {
+		return new(decodedSamples)
+	},
+}
+
+// sampleBuffers hands out the buffers the iterators of the series of a set
+// decode their samples into, and returns them to the pool once the set is
+// closed, since iterators are not closed.
+type sampleBuffers struct {
+	mux  sync.Mutex
+	bufs []*decodedSamples
+}
+
+func (b *sampleBuffers) get() *decodedSamples {
+	d := samplesPool.Get().(*decodedSamples)
+	b.mux.Lock()
+	b.bufs = append(b.bufs, d)
+	b.mux.Unlock()
+	return d
+}
+
+func (b *sampleBuffers) release() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, d := range b.bufs {
+		samplesPool.Put(d)
+	}
+	b.bufs = nil
+}
+
+// isPresent returns whether sample i has both a timestamp and a value.
+func (d *decodedSamples) isPresent(i int) bool {
+	return d.present[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+// Seek implements storage.SeriesIterator. It moves the iterator forward to
+// the first sample at or after t, found by binary search since the samples
+// are sorted by time, and keeps its position if the current sample is
+// already at or after t. The samples skipped by a seek are not read, so
+// their NULLs are not counted.
+func (p *pgxSeriesIterator) Seek(t int64) bool {
+	if p.err != nil || p.cur >= p.totalSamples {
+		return false
+	}
+	if p.cur >= 0 && p.getTs() >= t {
+		return true
+	}
+
+	from := p.runEnd + 1
+	idx := from + sort.Search(p.totalSamples-from, func(i int) bool {
+		return p.presentTsFrom(from+i) >= t
+	})
+	// Next moves to the first sample with a value from idx, merging the
+	// samples with the same timestamp.
+	p.runEnd = idx - 1
+	return p.Next()
+}
+
+// presentTsFrom returns the timestamp of the first sample with a timestamp
+// and a value from idx, so that NULL timestamps do not break the order of
+// the search, or math.MaxInt64 if there is none.
+func (p *pgxSeriesIterator) presentTsFrom(idx int) int64 {
+	for ; idx < p.totalSamples; idx++ {
+		if p.samples.isPresent(idx) {
+			return p.samples.times[idx]
+		}
+	}
+	return math.MaxInt64
 }
 
 // getTs returns a Unix timestamp in milliseconds.
 func (p *pgxSeriesIterator) getTs() int64 {
-	ts, _ := p.times.At(p.cur)
-	return ts
+	return p.samples.times[p.cur]
 }
 
 func (p *pgxSeriesIterator) getVal() float64 {
-	return p.values.Elements[p.cur].Float
+	return p.samples.values[p.cur]
 }
 
 // At returns a Unix timestamp in milliseconds and value of the sample.
@@ -209,21 +598,80 @@ func (p *pgxSeriesIterator) At() (t int64, v float64) {
 	return p.getTs(), p.getVal()
 }
 
-// Next implements storage.SeriesIterator.
+// nextPresent returns the index of the first sample after idx that has
+// both a timestamp and a value.
+func (p *pgxSeriesIterator) nextPresent(idx int) int {
+	for {
+		idx++
+		if idx >= p.totalSamples {
+			return idx
+		}
+		if p.samples.isPresent(idx) {
+			return idx
+		}
+		if idx > p.checked {
+			p.checked = idx
+			_, tsPresent := p.times.At(idx)
+			p.unexpectedNull(idx, tsPresent)
+			if p.err != nil {
+				return p.totalSamples
+			}
+		}
+	}
+}
+
+// unexpectedNull handles a sample with a NULL timestamp or value. Pushed
+// down aggregates return NULL values for the steps without samples, but
+// samples read from the database as they are should never contain NULLs,
+// so those are counted and, in strict mode, fail the iteration.
+func (p *pgxSeriesIterator) unexpectedNull(idx int, tsPresent bool) {
+	if !p.rawTimes {
+		return
+	}
+	field := "value"
+	if !tsPresent {
+		field = "time"
+	}
+	unexpectedNulls.WithLabelValues(field).Inc()
+	if p.cfg.StrictNulls {
+		p.err = fmt.Errorf("%w: series %s has a NULL %s at sample %d", ErrUnexpectedNull, p.labels, field, idx)
+	}
+}
+
+// Next implements storage.SeriesIterator. Samples with the same timestamp
+// are returned as a single sample, picked by the duplicate policy.
 func (p *pgxSeriesIterator) Next() bool {
+	if p.err != nil {
+		return false
+	}
+	p.cur = p.nextPresent(p.runEnd)
+	p.runEnd = p.cur
+	if p.cur >= p.totalSamples || p.err != nil {
+		return false
+	}
+
+	ts := p.getTs()
 	for {
-		p.cur++
-		if p.cur >= p.totalSamples {
+		next := p.nextPresent(p.runEnd)
+		if next >= p.totalSamples {
+			break
+		}
+		if p.samples.times[next] != ts {
+			break
+		}
+		if p.cfg.Duplicates == DuplicatesError {
+			p.err = fmt.Errorf("%w: series %s at %d", ErrDuplicateTimestamp, p.labels, ts)
 			return false
 		}
-		_, ok := p.times.At(p.cur)
-		if ok && p.values.Elements[p.cur].Status == pgtype.Present {
-			return true
+		p.runEnd = next
+		if p.cfg.Duplicates.prefers(p.getVal(), p.samples.values[next]) {
+			p.cur = next
 		}
 	}
+	return true
 }
 
 // Err implements storage.SeriesIterator.
 func (p *pgxSeriesIterator) Err() error {
-	return nil
+	return p.err
 }
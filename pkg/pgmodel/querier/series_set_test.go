@@ -309,7 +309,8 @@ func TestPgxSeriesSet(t *testing.T) {
 				c.input = [][]seriesSetRow{{
 					genSeries(labels, c.ts, c.vs, c.metricSchema, c.columnName)}}
 			}
-			p := buildSeriesSet(genPgxRows(c.input, c.rowErr), mapQuerier{labelMapping})
+			rows := genPgxRows(c.input, c.rowErr)
+			p := buildSeriesSet(rows, newTestResolver(rows, mapQuerier{labelMapping}))
 			if p.Err() != nil {
 				t.Fatal(p.Err())
 			}
@@ -392,7 +393,7 @@ func TestPgxSeriesSet(t *testing.T) {
 					lastVs = gotVs
 				}
 
-				// At this point, iterator should be exhausted but if we seek to the last time, it will reset.
+				// At this point, iterator is at the last sample and seeking to its time keeps it there.
 				// Unless there are no items to iterate on.
 				if lastTs < 0 {
 					continue
@@ -444,6 +445,128 @@ func TestPgxSeriesSet(t *testing.T) {
 	}
 }
 
+func TestIteratorSeek(t *testing.T) {
+	var (
+		times  []pgtype.Timestamptz
+		values []pgtype.Float8
+	)
+	for i := 1; i <= 100; i++ {
+		times = append(times, pgtype.Timestamptz{Time: time.Unix(int64(i), 0), Status: pgtype.Present})
+		values = append(values, pgtype.Float8{Float: float64(i), Status: pgtype.Present})
+	}
+	// NULL timestamps do not break the search.
+	times[50] = pgtype.Timestamptz{Status: pgtype.Null}
+	it := newIterator(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values), Cfg{})
+
+	for _, c := range []struct {
+		seek, want int64
+	}{
+		{seek: 0, want: 1000},
+		{seek: 10500, want: 11000},
+		// Seeking behind the current sample keeps it.
+		{seek: 5000, want: 11000},
+		{seek: 11000, want: 11000},
+		{seek: 50500, want: 52000},
+		{seek: 100000, want: 100000},
+	} {
+		if !it.Seek(c.seek) {
+			t.Fatalf("unexpected end of iterator seeking %d", c.seek)
+		}
+		if ts, v := it.At(); ts != c.want || v != float64(c.want/1000) {
+			t.Fatalf("unexpected sample seeking %d: got %d %f, wanted %d", c.seek, ts, v, c.want)
+		}
+	}
+	if it.Seek(100001) || it.Seek(0) {
+		t.Fatal("unexpected sample after the end")
+	}
+}
+
+func TestDecodeSamples(t *testing.T) {
+	times := make([]pgtype.Timestamptz, 130)
+	values := make([]pgtype.Float8, 130)
+	for i := range times {
+		times[i] = pgtype.Timestamptz{Time: time.Unix(int64(i), 0), Status: pgtype.Present}
+		values[i] = pgtype.Float8{Float: float64(i), Status: pgtype.Present}
+	}
+	times[3].Status = pgtype.Null
+	values[64].Status = pgtype.Null
+	values[129].Status = pgtype.Null
+
+	// The buffers of a longer series are reused.
+	d := new(decodedSamples)
+	d.decode(newRowTimestampSeries(toTimestampTzArray(make([]pgtype.Timestamptz, 200))), toFloat8Array(make([]pgtype.Float8, 200)))
+	d.decode(newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values))
+	if len(d.times) != len(times) || len(d.present) != 3 {
+		t.Fatalf("unexpected decoded lengths: got %d %d", len(d.times), len(d.present))
+	}
+	for i := range times {
+		wantPresent := i != 3 && i != 64 && i != 129
+		if d.isPresent(i) != wantPresent {
+			t.Fatalf("unexpected presence of sample %d: got %v", i, d.isPresent(i))
+		}
+		if wantPresent && (d.times[i] != int64(i)*1000 || d.values[i] != float64(i)) {
+			t.Fatalf("unexpected sample %d: got %d %f", i, d.times[i], d.values[i])
+		}
+	}
+}
+
+func BenchmarkIterator(b *testing.B) {
+	times := make([]pgtype.Timestamptz, 10000)
+	values := make([]pgtype.Float8, 10000)
+	for i := range times {
+		times[i] = pgtype.Timestamptz{Time: time.Unix(int64(i), 0), Status: pgtype.Present}
+		values[i] = pgtype.Float8{Float: float64(i), Status: pgtype.Present}
+	}
+	ts, vs := newRowTimestampSeries(toTimestampTzArray(times)), toFloat8Array(values)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it := newIterator(ts, vs, Cfg{})
+		for it.Next() {
+			it.At()
+		}
+	}
+}
+
+func TestLabelIDsWrapper(t *testing.T) {
+	ids := make([]int64, 0, 8)
+	w := labelIDsWrapper{&ids}
+
+	if err := w.DecodeText(nil, []byte("{1,0,-3,NULL,42}")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 0, -3, 0, 42}) {
+		t.Fatalf("unexpected label ids: got %v", ids)
+	}
+	if err := w.DecodeText(nil, []byte("{}")); err != nil || len(ids) != 0 {
+		t.Fatalf("unexpected label ids: got %v, %v", ids, err)
+	}
+	for _, invalid := range []string{"", "1,2", "{1,a}", "{1,,2}", "{-}"} {
+		if err := w.DecodeText(nil, []byte(invalid)); err == nil {
+			t.Fatalf("expected an error decoding %q", invalid)
+		}
+	}
+
+	// The binary form of '{7,NULL,9}'::int[].
+	src := []byte{
+		0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 23, // dimensions, has NULLs, int4
+		0, 0, 0, 3, 0, 0, 0, 1, // length, lower bound
+		0, 0, 0, 4, 0, 0, 0, 7,
+		255, 255, 255, 255,
+		0, 0, 0, 4, 0, 0, 0, 9,
+	}
+	if err := w.DecodeBinary(nil, src); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{7, 0, 9}) {
+		t.Fatalf("unexpected label ids: got %v", ids)
+	}
+	// The slice was reused.
+	if cap(ids) != 8 {
+		t.Fatalf("unexpected reallocation of label ids: cap %d", cap(ids))
+	}
+}
+
 type mapQuerier struct {
 	mapping map[int64]struct {
 		k string
@@ -462,6 +585,131 @@ func (m mapQuerier) LabelsForIdMap(idMap map[int64]labels.Label) (err error) {
 	return nil
 }
 
+func TestLazySeriesSet(t *testing.T) {
+	rows := make([]timescaleRow, lazyLabelRows+1)
+	for i := range rows {
+		rows[i] = timescaleRow{
+			labelIds: []int64{int64(i + 1), 0},
+			times:    newRowTimestampSeries(toTimestampTzArray(nil)),
+			values:   toFloat8Array(nil),
+		}
+	}
+	querier := &countingQuerier{}
+	p := buildLazySeriesSet(rows, querier)
+	if querier.ids != 0 {
+		t.Fatalf("labels resolved before access: %d", querier.ids)
+	}
+
+	if !p.Next() {
+		t.Fatal("unexpected end of series set")
+	}
+	if got := p.At().Labels(); !labels.Equal(got, labels.FromStrings("k", "1")) {
+		t.Fatalf("unexpected labels: got %v", got)
+	}
+	if querier.ids != lazyLabelRows {
+		t.Fatalf("unexpected number of resolved labels: got %d, wanted %d", querier.ids, lazyLabelRows)
+	}
+
+	// The last row is past the first batch.
+	for i := 1; i < len(rows); i++ {
+		if !p.Next() {
+			t.Fatal("unexpected end of series set")
+		}
+	}
+	if got := p.At().Labels(); !labels.Equal(got, labels.FromStrings("k", fmt.Sprint(len(rows)))) {
+		t.Fatalf("unexpected labels: got %v", got)
+	}
+	if querier.ids != len(rows) {
+		t.Fatalf("unexpected number of resolved labels: got %d, wanted %d", querier.ids, len(rows))
+	}
+	if p.Next() || p.Err() != nil {
+		t.Fatalf("unexpected end of series set: %v", p.Err())
+	}
+
+	// Sorting resolves the labels of all the rows at once.
+	querier.ids = 0
+	p = buildLazySeriesSet(rows, querier)
+	p.(*pgxSeriesSet).sortByLabels()
+	if querier.ids != len(rows) {
+		t.Fatalf("unexpected number of resolved labels: got %d, wanted %d", querier.ids, len(rows))
+	}
+}
+
+// missingLabelsQuerier resolves the labels of the ids other than missing,
+// like a labels reader when the label of missing was deleted.
+type missingLabelsQuerier struct {
+	missing int64
+}
+
+func (m missingLabelsQuerier) LabelsForIdMap(idMap map[int64]labels.Label) error {
+	for id := range idMap {
+		if id != m.missing {
+			idMap[id] = labels.Label{Name: "k", Value: fmt.Sprint(id)}
+		}
+	}
+	if _, ok := idMap[m.missing]; ok {
+		return fmt.Errorf("%w: id %d", pgmodelErrs.ErrMissingLabels, m.missing)
+	}
+	return nil
+}
+
+func TestSeriesSetMissingLabels(t *testing.T) {
+	testCases := []struct {
+		name  string
+		build func([]timescaleRow, labelQuerier) SeriesSet
+		sort  bool
+	}{
+		{
+			name: "resolved",
+			build: func(rows []timescaleRow, querier labelQuerier) SeriesSet {
+				return buildSeriesSet(rows, newTestResolver(rows, querier))
+			},
+		},
+		{
+			name: "resolved and sorted",
+			build: func(rows []timescaleRow, querier labelQuerier) SeriesSet {
+				return buildSeriesSet(rows, newTestResolver(rows, querier))
+			},
+			sort: true,
+		},
+		{name: "lazy", build: buildLazySeriesSet},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			var rows []timescaleRow
+			for _, id := range []int64{4, 2, 3, 1} {
+				rows = append(rows, timescaleRow{
+					labelIds: []int64{id},
+					times:    newRowTimestampSeries(toTimestampTzArray(nil)),
+					values:   toFloat8Array(nil),
+				})
+			}
+			ss := c.build(rows, missingLabelsQuerier{missing: 3})
+			if c.sort {
+				ss.(*pgxSeriesSet).sortByLabels()
+			}
+
+			var got []labels.Labels
+			for ss.Next() {
+				got = append(got, ss.At().Labels())
+			}
+			if ss.Err() != nil {
+				t.Fatalf("unexpected error: %v", ss.Err())
+			}
+			expected := []labels.Labels{labels.FromStrings("k", "4"), labels.FromStrings("k", "2"), labels.FromStrings("k", "1")}
+			if c.sort {
+				expected = []labels.Labels{labels.FromStrings("k", "1"), labels.FromStrings("k", "2"), labels.FromStrings("k", "4")}
+			}
+			if !reflect.DeepEqual(expected, got) {
+				t.Fatalf("unexpected series: got %v, wanted %v", got, expected)
+			}
+			if ws := ss.Warnings(); len(ws) != 1 || ws[0].Error() != droppedSeriesWarning(1).Error() {
+				t.Fatalf("unexpected warnings: %v", ws)
+			}
+		})
+	}
+}
+
 //nolint
 func genRows(count int) [][][]byte {
 	result := make([][][]byte, count)
@@ -477,6 +725,15 @@ func genRows(count int) [][][]byte {
 	return result
 }
 
+// newTestResolver returns a resolver with the label ids of all the rows added.
+func newTestResolver(rows []timescaleRow, querier labelQuerier) *labelResolver {
+	resolver := newLabelResolver(querier)
+	for i := range rows {
+		resolver.add(rows[i].labelIds)
+	}
+	return resolver
+}
+
 func genPgxRows(m [][]seriesSetRow, err error) []timescaleRow {
 	var result []timescaleRow
 
@@ -534,3 +791,24 @@ func genSeries(labels []int64, ts []pgtype.Timestamptz, vs []pgtype.Float8, sche
 		column:     column,
 	}
 }
+
+func TestAdditionalLabelsShared(t *testing.T) {
+	row := timescaleRow{schema: "custom_schema", column: "max"}
+
+	expected := labels.Labels{
+		{Name: model.SchemaNameLabelName, Value: "custom_schema"},
+		{Name: model.ColumnNameLabelName, Value: "max"},
+	}
+	first, second := row.GetAdditionalLabels(), row.GetAdditionalLabels()
+	if !reflect.DeepEqual(first, expected) {
+		t.Fatalf("unexpected additional labels: got %v, wanted %v", first, expected)
+	}
+	if &first[0] != &second[0] {
+		t.Errorf("additional labels are built again for the same row")
+	}
+
+	defaults := timescaleRow{schema: schema.Data, column: defaultColumnName}
+	if ll := defaults.GetAdditionalLabels(); len(ll) != 0 {
+		t.Errorf("unexpected additional labels for the default schema and column: %v", ll)
+	}
+}
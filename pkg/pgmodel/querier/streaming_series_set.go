@@ -0,0 +1,228 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	streamCursorName = "promscale_series"
+	// The transaction of the cursor only reads, so it is always rolled back.
+	beginStreamSQL    = "BEGIN READ ONLY"
+	endStreamSQL      = "ROLLBACK"
+	declareCursorSQL  = "DECLARE " + streamCursorName + " NO SCROLL CURSOR FOR %s"
+	fetchCursorSQLFmt = "FETCH FORWARD %d FROM " + streamCursorName
+)
+
+// streamingSeriesSet implements storage.SeriesSet over the rows of a single
+// metric query that are fetched from a cursor, a batch at a time, as the set
+// is iterated, rather than all at once before the iteration. It only holds
+// the current batch and the next one, so large results are not buffered in
+// memory unless the consumer keeps the series.
+//
+// The rows are fetched and their labels resolved by a goroutine, on a
+// connection that is held until the set is exhausted or closed.
+type streamingSeriesSet struct {
+	batches chan streamBatch
+	// closing is closed when the set is closed, to stop the fetching.
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	batch []streamedRow
+	idx   int
+	err   error
+	// dropped is the number of rows of the batches iterated so far that
+	// were left out because some of their labels are missing.
+	dropped int
+	// warnings are the warnings of the query of the rows.
+	warnings storage.Warnings
+	cfg      Cfg
+}
+
+// streamBatch is a batch of rows fetched from the cursor, or the error
+// that ended the fetching.
+type streamBatch struct {
+	rows    []streamedRow
+	dropped int
+	err     error
+}
+
+type streamedRow struct {
+	row    timescaleRow
+	labels labels.Labels
+}
+
+var _ storage.SeriesSet = (*streamingSeriesSet)(nil)
+
+// newStreamingSeriesSet returns a series set streaming the rows of the
+// query, whose labels are resolved with querier. The fetching fails once
+// ctx is done.
+func newStreamingSeriesSet(ctx context.Context, query *singleMetricQuery, querier labelQuerier, cfg Cfg) *streamingSeriesSet {
+	s := &streamingSeriesSet{
+		// The next batch is fetched while the current one is iterated.
+		batches:  make(chan streamBatch, 1),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+		warnings: query.warnings,
+		cfg:      cfg,
+	}
+	go s.run(ctx, query, querier)
+	return s
+}
+
+func (s *streamingSeriesSet) run(ctx context.Context, query *singleMetricQuery, querier labelQuerier) {
+	defer close(s.done)
+	defer close(s.batches)
+	err := query.conn.WithConn(ctx, func(conn pgxconn.PgxConn) error {
+		if _, err := conn.Exec(ctx, beginStreamSQL); err != nil {
+			return err
+		}
+		err := s.fetch(ctx, conn, query, querier)
+		// The transaction is ended even if ctx is done.
+		if _, rollbackErr := conn.Exec(context.Background(), endStreamSQL); err == nil {
+			err = rollbackErr
+		}
+		return err
+	})
+	if err != nil {
+		s.send(streamBatch{err: err})
+	}
+}
+
+// fetch fetches the rows of the query from a cursor, sending them in
+// batches until they are all fetched or the set is closed.
+func (s *streamingSeriesSet) fetch(ctx context.Context, conn pgxconn.PgxConn, query *singleMetricQuery, querier labelQuerier) error {
+	if _, err := conn.Exec(ctx, fmt.Sprintf(declareCursorSQL, query.sql), query.values...); err != nil {
+		return query.mapError(err)
+	}
+	fetchSQL := fmt.Sprintf(fetchCursorSQLFmt, s.cfg.StreamFetchSize)
+	for {
+		rows, err := conn.Query(ctx, fetchSQL)
+		if err != nil {
+			return err
+		}
+		resolver := newLabelResolver(querier)
+		tsRows, err := appendTsRows(nil, rows, query.tsSeries, query.metricOverride, query.labelSchema, query.labelColumn, resolver)
+		rows.Close()
+		if err == nil {
+			err = queryBudgetFrom(ctx).charge(&s.cfg, tsRows)
+		}
+		if err != nil {
+			resolver.discard()
+			return err
+		}
+		labelIDMap, err := resolver.wait()
+		if err != nil {
+			return err
+		}
+		if len(tsRows) == 0 {
+			return nil
+		}
+
+		batch := streamBatch{rows: make([]streamedRow, 0, len(tsRows))}
+		for i := range tsRows {
+			lls, err := rowLabels(&tsRows[i], labelIDMap)
+			if isMissingLabels(err) {
+				batch.dropped++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			batch.rows = append(batch.rows, streamedRow{row: tsRows[i], labels: lls})
+		}
+		if !s.send(batch) {
+			return nil
+		}
+		if len(tsRows) < s.cfg.StreamFetchSize {
+			return nil
+		}
+	}
+}
+
+// send sends the batch to the iteration, returning false if the set was
+// closed.
+func (s *streamingSeriesSet) send(batch streamBatch) bool {
+	select {
+	case s.batches <- batch:
+		return true
+	case <-s.closing:
+		return false
+	}
+}
+
+// Next forwards the set to the next series, waiting for the next batch of
+// rows if the current one is exhausted.
+func (s *streamingSeriesSet) Next() bool {
+	s.idx++
+	for s.idx >= len(s.batch) {
+		if s.err != nil {
+			return false
+		}
+		batch, ok := <-s.batches
+		if !ok {
+			s.batch, s.idx = nil, 0
+			return false
+		}
+		if batch.err != nil {
+			s.err = batch.err
+			return false
+		}
+		s.batch, s.idx = batch.rows, 0
+		s.dropped += batch.dropped
+	}
+	return true
+}
+
+// At returns the current storage.Series.
+func (s *streamingSeriesSet) At() storage.Series {
+	if s.idx >= len(s.batch) {
+		return nil
+	}
+	cur := &s.batch[s.idx]
+	if cur.row.times.Len() != len(cur.row.values.Elements) {
+		s.err = errors.ErrInvalidRowData
+		return nil
+	}
+	return &pgxSeries{
+		labels: cur.labels,
+		times:  cur.row.times,
+		values: cur.row.values,
+		cfg:    s.cfg,
+	}
+}
+
+// Err implements storage.SeriesSet.
+func (s *streamingSeriesSet) Err() error {
+	if s.err != nil {
+		return fmt.Errorf("Error retrieving series set: %w", s.err)
+	}
+	return nil
+}
+
+// Warnings implements storage.SeriesSet.
+func (s *streamingSeriesSet) Warnings() storage.Warnings {
+	if s.dropped > 0 {
+		return append(s.warnings[:len(s.warnings):len(s.warnings)], droppedSeriesWarning(s.dropped))
+	}
+	return s.warnings
+}
+
+// Close stops the fetching and waits for the connection to be released.
+// The rows are not returned to the pools, unlike those of pgxSeriesSet,
+// since the consumer may still hold the series of past batches.
+func (s *streamingSeriesSet) Close() {
+	s.closeOnce.Do(func() { close(s.closing) })
+	<-s.done
+}
@@ -0,0 +1,91 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestStreamingSeriesSet(t *testing.T) {
+	querier := mapQuerier{map[int64]struct {
+		k string
+		v string
+	}{
+		1: {model.MetricNameLabelName, "cpu"},
+		2: {"job", "a"},
+		3: {"job", "b"},
+		4: {"job", "c"},
+	}}
+	const query = "SELECT series.labels, result.time_array, result.value_array FROM cpu WHERE x = $1"
+	declareSQL := fmt.Sprintf(declareCursorSQL, query)
+	fetchSQL := fmt.Sprintf(fetchCursorSQLFmt, 2)
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: beginStreamSQL},
+		{Sql: declareSQL, Args: []interface{}{"y"}},
+		{Sql: fetchSQL, Results: model.RowResults{
+			{[]int64{1, 2}, []time.Time{time.Unix(1, 0)}, []float64{1}},
+			{[]int64{1, 3}, []time.Time{time.Unix(2, 0)}, []float64{2}},
+		}},
+		{Sql: fetchSQL, Results: model.RowResults{
+			{[]int64{1, 4}, []time.Time{time.Unix(3, 0)}, []float64{3}},
+		}},
+		{Sql: endStreamSQL},
+	}, t)
+	ss := newStreamingSeriesSet(context.Background(), &singleMetricQuery{conn: mock, sql: query, values: []interface{}{"y"}}, querier, Cfg{StreamFetchSize: 2})
+	defer ss.Close()
+
+	for i, job := range []string{"a", "b", "c"} {
+		require.True(t, ss.Next())
+		series := ss.At()
+		require.Equal(t, labels.FromStrings(model.MetricNameLabelName, "cpu", "job", job), series.Labels())
+		it := series.Iterator()
+		require.True(t, it.Next())
+		ts, v := it.At()
+		require.Equal(t, int64(i+1)*1000, ts)
+		require.Equal(t, float64(i+1), v)
+		require.False(t, it.Next())
+	}
+	require.False(t, ss.Next())
+	require.False(t, ss.Next())
+	require.NoError(t, ss.Err())
+}
+
+func TestStreamingSeriesSetErrors(t *testing.T) {
+	const query = "SELECT series.labels, result.time_array, result.value_array FROM cpu"
+	declareSQL := fmt.Sprintf(declareCursorSQL, query)
+
+	// A missing column is an empty result.
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: beginStreamSQL},
+		{Sql: declareSQL, Err: &pgconn.PgError{Code: pgerrcode.UndefinedColumn}},
+		{Sql: endStreamSQL},
+	}, t)
+	ss := newStreamingSeriesSet(context.Background(), &singleMetricQuery{conn: mock, sql: query}, mapQuerier{}, Cfg{StreamFetchSize: 2})
+	require.False(t, ss.Next())
+	require.NoError(t, ss.Err())
+	ss.Close()
+
+	mock = model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: beginStreamSQL},
+		{Sql: declareSQL},
+		{Sql: fmt.Sprintf(fetchCursorSQLFmt, 2), Err: fmt.Errorf("connection reset")},
+		{Sql: endStreamSQL},
+	}, t)
+	ss = newStreamingSeriesSet(context.Background(), &singleMetricQuery{conn: mock, sql: query}, mapQuerier{}, Cfg{StreamFetchSize: 2})
+	require.False(t, ss.Next())
+	require.Error(t, ss.Err())
+	require.Contains(t, ss.Err().Error(), "connection reset")
+	ss.Close()
+}
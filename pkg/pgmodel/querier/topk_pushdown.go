@@ -0,0 +1,149 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+)
+
+const (
+	/* topKSQLFormat ranks, at each evaluation time, the last sample within the lookback of each series among the
+	* series of the same group, and returns the samples ranked within the k first, as the samples of their series at
+	* the evaluation times. The ties at the k-th rank are all kept. */
+	topKSQLFormat = `SELECT ranked.labels, array_agg(ranked.eval_time ORDER BY ranked.eval_time), array_agg(ranked.value ORDER BY ranked.eval_time)
+	FROM (
+		SELECT series.id, series.labels, result.eval_time, result.value,
+			rank() OVER (PARTITION BY series.grouping, result.eval_time ORDER BY %[6]s) AS rank
+		FROM (
+			SELECT s.id, s.labels, (
+				SELECT COALESCE(array_agg(l.id ORDER BY l.id), array[]::int[])
+				FROM ` + schema.Catalog + `.label l
+				WHERE l.id = ANY(s.labels) AND l.key = ANY(%[7]s)
+			) AS grouping
+			FROM %[2]s s
+			WHERE %[3]s
+		) AS series
+		INNER JOIN LATERAL (
+			SELECT eval_time, value
+			FROM (
+				SELECT DISTINCT ON (eval_time) eval_time, time, value
+				FROM (
+					SELECT %[8]s AS eval_time, time, %[9]s AS value
+					FROM %[1]s metric
+					WHERE metric.series_id = series.id
+					AND time >= '%[4]s'
+					AND time <= '%[5]s'
+				) AS samples
+				ORDER BY eval_time, time DESC
+			) AS last_samples
+			WHERE %[10]s
+		) AS result ON (true)
+	) AS ranked
+	WHERE ranked.rank <= %[11]s
+	GROUP BY ranked.id, ranked.labels`
+
+	// maxTopK is the largest k pushed down, above which ranking in the
+	// database saves little over returning all the series.
+	maxTopK = 10000
+)
+
+// topKOrders are the orders the samples are ranked in by topk and bottomk.
+// Like in the operators, NaNs are ranked last.
+var topKOrders = map[parser.ItemType]string{
+	parser.TOPK:    "result.value = 'NaN' ASC, result.value DESC",
+	parser.BOTTOMK: "result.value ASC",
+}
+
+// topK is a topk or bottomk of a selector pushed down to the database.
+type topK struct {
+	order    string
+	k        int64
+	grouping []string
+	// evalTime is the evaluation time the samples are evaluated at.
+	evalTime       string
+	evalTimeParams []interface{}
+	lookback       time.Duration
+	end            time.Time
+}
+
+/* getTopK checks if the vector selector is the argument of a topk or bottomk by labels with a constant k. If so, it
+* returns the ranking evaluated in the database, so that only the series ranked within the k first of their group at
+* an evaluation time are returned, with only the samples of those evaluation times. The engine then evaluates the
+* topk or bottomk over those series to the same result as over all the series. */
+func getTopK(hints *storage.SelectHints, qh *QueryHints, path []parser.Node) *topK {
+	agg := getSelectorAggregation(hints, qh, path)
+	if agg == nil {
+		return nil
+	}
+	order, ok := topKOrders[agg.Op]
+	if !ok {
+		return nil
+	}
+	param, isNumber := unwrapExpr(agg.Param).(*parser.NumberLiteral)
+	if !isNumber || param.Val < 1 || param.Val > float64(maxTopK) {
+		return nil
+	}
+	evalTime, evalTimeParams, ok := getPushdownEvalTime(hints, qh)
+	if !ok {
+		return nil
+	}
+
+	tk := &topK{
+		order:          order,
+		k:              int64(param.Val),
+		grouping:       agg.Grouping,
+		evalTime:       evalTime,
+		evalTimeParams: evalTimeParams,
+		lookback:       qh.Lookback,
+		end:            qh.EndTime,
+	}
+	if tk.grouping == nil {
+		tk.grouping = []string{}
+	}
+	return tk
+}
+
+func buildTopKQuery(filter metricTimeRangeFilter, cases []string, values []interface{}, tk *topK) (string, []interface{}, error) {
+	grouping, values, err := setParameterNumbers("$%d::TEXT[]", values, tk.grouping)
+	if err != nil {
+		return "", nil, err
+	}
+	evalTime, values, err := setParameterNumbers(tk.evalTime, values, tk.evalTimeParams...)
+	if err != nil {
+		return "", nil, err
+	}
+	/* the last sample must be within the lookback and not a staleness marker for the series to have a value */
+	filterClause, values, err := setParameterNumbers("time >= eval_time - $%d::INTERVAL AND eval_time <= $%d::TIMESTAMPTZ AND "+notStaleSQL,
+		values, tk.lookback, tk.end)
+	if err != nil {
+		return "", nil, err
+	}
+	k, values, err := setParameterNumbers("$%d::BIGINT", values, tk.k)
+	if err != nil {
+		return "", nil, err
+	}
+
+	finalSQL := fmt.Sprintf(topKSQLFormat,
+		pgx.Identifier{filter.schema, filter.metric}.Sanitize(),
+		pgx.Identifier{schema.DataSeries, filter.seriesTable}.Sanitize(),
+		strings.Join(cases, " AND "),
+		filter.startTime,
+		filter.endTime,
+		tk.order,
+		grouping,
+		evalTime,
+		pgx.Identifier{filter.column}.Sanitize(),
+		filterClause,
+		k,
+	)
+	return finalSQL, values, nil
+}
@@ -0,0 +1,114 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// VerifySeriesSets makes the series sets returned by Select verify that their
+// series are sorted by labels, when sorting was requested, and that the samples
+// of each series have strictly increasing timestamps. Out-of-order results cause
+// subtle errors in the consumers of series sets, but the checks have a cost, so
+// they are meant to be enabled in tests and for debugging.
+var VerifySeriesSets = false
+
+var (
+	errSeriesOutOfOrder  = fmt.Errorf("series set is not sorted by labels")
+	errSamplesOutOfOrder = fmt.Errorf("series samples are not sorted by timestamp")
+)
+
+// verifyingSeriesSet wraps a series set to verify the ordering of its series and samples.
+type verifyingSeriesSet struct {
+	SeriesSet
+	sorted bool
+	prev   labels.Labels
+	err    error
+}
+
+func newVerifyingSeriesSet(ss SeriesSet, sorted bool) SeriesSet {
+	return &verifyingSeriesSet{SeriesSet: ss, sorted: sorted}
+}
+
+// Next implements storage.SeriesSet.
+func (v *verifyingSeriesSet) Next() bool {
+	if v.err != nil {
+		return false
+	}
+	return v.SeriesSet.Next()
+}
+
+// At implements storage.SeriesSet.
+func (v *verifyingSeriesSet) At() storage.Series {
+	s := v.SeriesSet.At()
+	if s == nil {
+		return nil
+	}
+	lls := s.Labels()
+	if v.sorted && v.prev != nil && labels.Compare(v.prev, lls) >= 0 {
+		v.err = fmt.Errorf("%w: %s emitted after %s", errSeriesOutOfOrder, lls, v.prev)
+	}
+	v.prev = lls
+	return &verifyingSeries{Series: s}
+}
+
+// Err implements storage.SeriesSet.
+func (v *verifyingSeriesSet) Err() error {
+	if v.err != nil {
+		return v.err
+	}
+	return v.SeriesSet.Err()
+}
+
+type verifyingSeries struct {
+	storage.Series
+}
+
+// Iterator implements storage.Series.
+func (v *verifyingSeries) Iterator() chunkenc.Iterator {
+	return &verifyingIterator{Iterator: v.Series.Iterator(), labels: v.Labels()}
+}
+
+// verifyingIterator fails the iteration once a sample does not have a
+// timestamp greater than the previous one. Seek is left to the wrapped
+// iterator: it only moves forward, so the samples read after it are still
+// compared with the last one checked.
+type verifyingIterator struct {
+	chunkenc.Iterator
+	labels  labels.Labels
+	started bool
+	prevTs  int64
+	err     error
+}
+
+// Next implements chunkenc.Iterator.
+func (v *verifyingIterator) Next() bool {
+	if v.err != nil || !v.Iterator.Next() {
+		return false
+	}
+	v.check()
+	return v.err == nil
+}
+
+func (v *verifyingIterator) check() {
+	ts, _ := v.Iterator.At()
+	if v.started && ts <= v.prevTs {
+		v.err = fmt.Errorf("%w: %s has sample at %d after %d", errSamplesOutOfOrder, v.labels, ts, v.prevTs)
+	}
+	v.started = true
+	v.prevTs = ts
+}
+
+// Err implements chunkenc.Iterator.
+func (v *verifyingIterator) Err() error {
+	if v.err != nil {
+		return v.err
+	}
+	return v.Iterator.Err()
+}
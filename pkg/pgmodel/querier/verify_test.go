@@ -0,0 +1,143 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func verifyTestSeriesSet(t *testing.T, labelIDs []int64, times ...[]int64) *pgxSeriesSet {
+	mapping := make(map[int64]struct {
+		k string
+		v string
+	})
+	rows := make([]seriesSetRow, 0, len(labelIDs))
+	for i, id := range labelIDs {
+		mapping[id] = struct {
+			k string
+			v string
+		}{k: "k", v: fmt.Sprintf("v%d", id)}
+
+		ts := []int64{1, 2}
+		if i < len(times) {
+			ts = times[i]
+		}
+		tts := make([]pgtype.Timestamptz, len(ts))
+		vs := make([]pgtype.Float8, len(ts))
+		for j := range ts {
+			tts[j] = pgtype.Timestamptz{Time: time.Unix(ts[j], 0)}
+			vs[j] = pgtype.Float8{Float: float64(j)}
+		}
+		rows = append(rows, genSeries([]int64{id}, tts, vs, "", defaultColumnName))
+	}
+
+	tsRows := genPgxRows([][]seriesSetRow{rows}, nil)
+	ss := buildSeriesSet(tsRows, newTestResolver(tsRows, mapQuerier{mapping}))
+	pss, ok := ss.(*pgxSeriesSet)
+	require.True(t, ok)
+	return pss
+}
+
+// drain reads all the series and samples of a series set and returns the
+// labels of the series along with the first error encountered.
+func drain(ss SeriesSet) ([]labels.Labels, error) {
+	var res []labels.Labels
+	for ss.Next() {
+		s := ss.At()
+		if s == nil {
+			break
+		}
+		res = append(res, s.Labels())
+		it := s.Iterator()
+		for it.Next() {
+		}
+		if err := it.Err(); err != nil {
+			return res, err
+		}
+	}
+	return res, ss.Err()
+}
+
+func TestSortByLabels(t *testing.T) {
+	pss := verifyTestSeriesSet(t, []int64{3, 1, 2}, []int64{10}, []int64{30}, []int64{20})
+	pss.sortByLabels()
+
+	res, err := drain(newVerifyingSeriesSet(pss, true))
+	require.NoError(t, err)
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings("k", "v1"),
+		labels.FromStrings("k", "v2"),
+		labels.FromStrings("k", "v3"),
+	}, res)
+
+	// The samples must move together with their labels.
+	pss.rowIdx = -1
+	var firstTimestamps []int64
+	for pss.Next() {
+		it := pss.At().Iterator()
+		require.True(t, it.Next())
+		ts, _ := it.At()
+		firstTimestamps = append(firstTimestamps, ts)
+	}
+	require.Equal(t, []int64{30000, 20000, 10000}, firstTimestamps)
+}
+
+func TestVerifyingSeriesSet(t *testing.T) {
+	testCases := []struct {
+		name     string
+		labelIDs []int64
+		times    [][]int64
+		sorted   bool
+		err      error
+	}{
+		{
+			name:     "sorted",
+			labelIDs: []int64{1, 2},
+			sorted:   true,
+		},
+		{
+			name:     "unsorted series",
+			labelIDs: []int64{2, 1},
+			sorted:   true,
+			err:      errSeriesOutOfOrder,
+		},
+		{
+			name:     "unsorted series when sorting is not required",
+			labelIDs: []int64{2, 1},
+		},
+		{
+			name:     "unsorted samples",
+			labelIDs: []int64{1},
+			times:    [][]int64{{2, 1}},
+			err:      errSamplesOutOfOrder,
+		},
+		{
+			// The duplicates are merged by the iterator according to the
+			// duplicate policy before they reach the verification.
+			name:     "duplicate samples",
+			labelIDs: []int64{1},
+			times:    [][]int64{{1, 1}},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			pss := verifyTestSeriesSet(t, c.labelIDs, c.times...)
+			_, err := drain(newVerifyingSeriesSet(pss, c.sorted))
+			if c.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.True(t, errors.Is(err, c.err), "unexpected error: %v", err)
+		})
+	}
+}
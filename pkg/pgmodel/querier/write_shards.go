@@ -0,0 +1,72 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	getReadSchemaSQL = "SELECT " + schema.Catalog + ".get_metric_read_schema($1, $2)"
+
+	// writeShardRefreshInterval is how long it is cached whether a metric
+	// table has write shards, so that metrics sharded while the connector
+	// runs are picked up without a restart.
+	writeShardRefreshInterval = time.Minute
+)
+
+type writeShardEntry struct {
+	sharded bool
+	fetched time.Time
+}
+
+// writeShardCache caches whether the inserts into each metric table are
+// spread across write shards, whose samples are read from the view of the
+// metric in the sharded data schema, the union of the metric table and its
+// shards.
+type writeShardCache struct {
+	conn    pgxconn.PgxConn
+	mux     sync.Mutex
+	entries map[string]writeShardEntry
+	now     func() time.Time
+}
+
+func newWriteShardCache(conn pgxconn.PgxConn) *writeShardCache {
+	return &writeShardCache{
+		conn:    conn,
+		entries: make(map[string]writeShardEntry),
+		now:     time.Now,
+	}
+}
+
+// readSchema returns the schema to read the samples of the metric table in
+// the data schema from.
+func (c *writeShardCache) readSchema(table string) (string, error) {
+	c.mux.Lock()
+	entry, ok := c.entries[table]
+	c.mux.Unlock()
+	// The shards of a metric are only dropped with the metric.
+	if !ok || (!entry.sharded && c.now().Sub(entry.fetched) >= writeShardRefreshInterval) {
+		var readSchema string
+		if err := c.conn.QueryRow(context.Background(), getReadSchemaSQL, schema.Data, table).Scan(&readSchema); err != nil {
+			return "", err
+		}
+		entry = writeShardEntry{sharded: readSchema == schema.DataSharded, fetched: c.now()}
+
+		c.mux.Lock()
+		c.entries[table] = entry
+		c.mux.Unlock()
+	}
+
+	if entry.sharded {
+		return schema.DataSharded, nil
+	}
+	return schema.Data, nil
+}
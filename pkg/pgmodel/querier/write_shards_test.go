@@ -0,0 +1,72 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestWriteShardCache(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: getReadSchemaSQL, Args: []interface{}{schema.Data, "hot"}, Results: model.RowResults{{schema.DataSharded}}},
+		{Sql: getReadSchemaSQL, Args: []interface{}{schema.Data, "cold"}, Results: model.RowResults{{schema.Data}}},
+		{Sql: getReadSchemaSQL, Args: []interface{}{schema.Data, "cold"}, Results: model.RowResults{{schema.DataSharded}}},
+	}, t)
+	now := time.Now()
+	c := newWriteShardCache(mock)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		readSchema, err := c.readSchema("hot")
+		require.NoError(t, err)
+		require.Equal(t, schema.DataSharded, readSchema)
+		readSchema, err = c.readSchema("cold")
+		require.NoError(t, err)
+		require.Equal(t, schema.Data, readSchema)
+	}
+
+	// Metrics sharded while the connector runs are picked up after the
+	// refresh interval, sharded metrics stay sharded.
+	now = now.Add(writeShardRefreshInterval)
+	readSchema, err := c.readSchema("cold")
+	require.NoError(t, err)
+	require.Equal(t, schema.DataSharded, readSchema)
+	readSchema, err = c.readSchema("hot")
+	require.NoError(t, err)
+	require.Equal(t, schema.DataSharded, readSchema)
+}
+
+func TestWriteShardQuery(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: getReadSchemaSQL, Args: []interface{}{schema.Data, "hot"}, Results: model.RowResults{{schema.DataSharded}}},
+	}, t)
+	q := &pgxQuerier{writeShards: newWriteShardCache(mock)}
+
+	readSchema, err := q.readSchema("custom", "hot")
+	require.NoError(t, err)
+	require.Equal(t, "custom", readSchema, "only the metrics of the data schema are sharded")
+	readSchema, err = q.readSchema(schema.Data, "hot")
+	require.NoError(t, err)
+	require.Equal(t, schema.DataSharded, readSchema)
+
+	filter := metricTimeRangeFilter{
+		metric:      "hot",
+		schema:      readSchema,
+		column:      defaultColumnName,
+		seriesTable: "hot",
+		startTime:   "start",
+		endTime:     "end",
+	}
+	sql, _, _, _, err := buildTimeseriesByLabelClausesQuery(filter, []string{"labels && $1"}, []interface{}{"x"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(sql, `"prom_data_sharded"."hot"`), sql)
+	require.True(t, strings.Contains(sql, `"prom_data_series"."hot"`), sql)
+}
@@ -0,0 +1,171 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package slo manages the service level objectives stored in the catalog,
+// and maintains their burn rates and error budgets as computed series, so
+// that the multiwindow burn rate alerts do not have to be written by hand.
+package slo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+const (
+	sloColumns = "name, objective, extract(epoch FROM slo_window)::float8, good_selector, total_selector, created_at, updated_at"
+	listSQL    = "SELECT " + sloColumns + " FROM " + schema.Catalog + ".slo ORDER BY name"
+	getSQL     = "SELECT " + sloColumns + " FROM " + schema.Catalog + ".slo WHERE name = $1"
+	putSQL     = "INSERT INTO " + schema.Catalog + ".slo (name, objective, slo_window, good_selector, total_selector) " +
+		"VALUES ($1, $2, $3::float8 * INTERVAL '1 second', $4, $5) ON CONFLICT (name) DO UPDATE SET " +
+		"objective = EXCLUDED.objective, slo_window = EXCLUDED.slo_window, good_selector = EXCLUDED.good_selector, " +
+		"total_selector = EXCLUDED.total_selector, updated_at = now() " +
+		"RETURNING " + sloColumns
+	deleteSQL = "DELETE FROM " + schema.Catalog + ".slo WHERE name = $1"
+)
+
+// ErrSLONotFound is returned when there is no SLO with the requested name.
+var ErrSLONotFound = fmt.Errorf("SLO not found")
+
+// SLO is a service level objective: the ratio of good events to all the
+// events over a rolling window must be at least the objective.
+type SLO struct {
+	Name      string
+	Objective float64
+	Window    time.Duration
+	// Good and Total are the selectors of the counters of the good events
+	// and of all the events.
+	Good, Total string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Validate returns an error if the SLO cannot be evaluated.
+func Validate(s SLO) error {
+	if s.Name == "" {
+		return fmt.Errorf("the SLO has no name")
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		return fmt.Errorf("invalid objective %v, must be between 0 and 1, exclusive", s.Objective)
+	}
+	if s.Window <= 0 {
+		return fmt.Errorf("invalid window %v, must be positive", s.Window)
+	}
+	if _, err := parser.ParseMetricSelector(s.Good); err != nil {
+		return fmt.Errorf("invalid good selector: %w", err)
+	}
+	if _, err := parser.ParseMetricSelector(s.Total); err != nil {
+		return fmt.Errorf("invalid total selector: %w", err)
+	}
+	return nil
+}
+
+// evaluator returns the value of a PromQL expression evaluating to a
+// single sample at the time t, and false if it has no value.
+type evaluator func(query string, t time.Time) (float64, bool, error)
+
+// Manager stores the SLOs in the catalog, so that they are evaluated by
+// every connector, and computes their status.
+type Manager struct {
+	conn pgxconn.PgxConn
+	eval evaluator
+}
+
+// NewManager returns a manager evaluating the SLOs with the engine.
+func NewManager(conn pgxconn.PgxConn, engine *promql.Engine, queryable promql.Queryable) *Manager {
+	return &Manager{
+		conn: conn,
+		eval: func(query string, t time.Time) (float64, bool, error) {
+			q, err := engine.NewInstantQuery(queryable, query, t)
+			if err != nil {
+				return 0, false, err
+			}
+			defer q.Close()
+			// The SLOs are evaluated like rules, without starving the
+			// interactive queries.
+			res := q.Exec(pgxconn.WithQueryClass(context.Background(), pgxconn.ClassRule))
+			if res.Err != nil {
+				return 0, false, res.Err
+			}
+			v, err := res.Vector()
+			if err != nil || len(v) == 0 {
+				return 0, false, err
+			}
+			return v[0].V, true, nil
+		},
+	}
+}
+
+// List returns the SLOs sorted by name.
+func (m *Manager) List() ([]SLO, error) {
+	rows, err := m.conn.Query(context.Background(), listSQL)
+	if err != nil {
+		return nil, fmt.Errorf("listing SLOs: %w", err)
+	}
+	defer rows.Close()
+	slos := make([]SLO, 0)
+	for rows.Next() {
+		s, err := scanSLO(rows)
+		if err != nil {
+			return nil, fmt.Errorf("listing SLOs: %w", err)
+		}
+		slos = append(slos, s)
+	}
+	return slos, rows.Err()
+}
+
+// Get returns the SLO with the name.
+func (m *Manager) Get(name string) (SLO, error) {
+	s, err := scanSLO(m.conn.QueryRow(context.Background(), getSQL, name))
+	if err == pgx.ErrNoRows {
+		return SLO{}, ErrSLONotFound
+	}
+	if err != nil {
+		return SLO{}, fmt.Errorf("getting SLO %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Put creates the SLO, or replaces the SLO with the same name.
+func (m *Manager) Put(s SLO) (SLO, error) {
+	if err := Validate(s); err != nil {
+		return SLO{}, err
+	}
+	s, err := scanSLO(m.conn.QueryRow(context.Background(), putSQL, s.Name, s.Objective, s.Window.Seconds(), s.Good, s.Total))
+	if err != nil {
+		return SLO{}, fmt.Errorf("storing SLO: %w", err)
+	}
+	return s, nil
+}
+
+// Delete deletes the SLO with the name. The series computed for it are
+// kept.
+func (m *Manager) Delete(name string) error {
+	tag, err := m.conn.Exec(context.Background(), deleteSQL, name)
+	if err != nil {
+		return fmt.Errorf("deleting SLO %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSLONotFound
+	}
+	return nil
+}
+
+func scanSLO(row pgx.Row) (SLO, error) {
+	var (
+		s      SLO
+		window float64
+	)
+	if err := row.Scan(&s.Name, &s.Objective, &window, &s.Good, &s.Total, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return SLO{}, err
+	}
+	s.Window = time.Duration(window * float64(time.Second))
+	return s, nil
+}
@@ -0,0 +1,77 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package slo
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	s := SLO{Name: "availability", Objective: 0.999, Window: 30 * 24 * time.Hour, Good: `http_requests_total{code!~"5.."}`, Total: "http_requests_total"}
+	require.NoError(t, Validate(s))
+
+	for _, invalid := range []func(s SLO) SLO{
+		func(s SLO) SLO { s.Name = ""; return s },
+		func(s SLO) SLO { s.Objective = 1; return s },
+		func(s SLO) SLO { s.Objective = 0; return s },
+		func(s SLO) SLO { s.Window = 0; return s },
+		func(s SLO) SLO { s.Good = "{code=}"; return s },
+		func(s SLO) SLO { s.Total = "rate(http_requests_total[5m])"; return s },
+	} {
+		require.Error(t, Validate(invalid(s)))
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := SLO{Name: "availability", Objective: 0.99, Window: 30 * 24 * time.Hour, Good: "good_total", Total: "all_total"}
+	ratios := map[string]float64{
+		"30d": 0.005,
+		"5m":  0.2,
+		"1h":  0.15,
+		"30m": 0.05,
+		"6h":  0.02,
+		"2h":  0.04,
+		"1d":  0.01,
+		"3d":  math.NaN(),
+	}
+	var queries []string
+	m := &Manager{eval: func(query string, _ time.Time) (float64, bool, error) {
+		queries = append(queries, query)
+		for w, ratio := range ratios {
+			if query == fmt.Sprintf(errorRatioQuery, s.Good, s.Total, w) {
+				return ratio, true, nil
+			}
+		}
+		return 0, false, nil
+	}}
+
+	st, err := m.Status(s, time.Unix(0, 0))
+	require.NoError(t, err)
+	require.Equal(t, "1 - sum(increase(good_total[30d])) / sum(increase(all_total[30d]))", queries[0])
+	require.InDelta(t, 0.005, *st.ErrorRatio, 1e-9)
+	require.InDelta(t, 0.5, *st.ErrorBudgetRemaining, 1e-9)
+	require.InDelta(t, 20, st.BurnRates[5*time.Minute], 1e-9)
+	require.InDelta(t, 15, st.BurnRates[time.Hour], 1e-9)
+	_, ok := st.BurnRates[72*time.Hour]
+	require.False(t, ok)
+	// The 1h/5m page fires, the 6h/30m page does not, and the 24h/2h ticket
+	// does not as the 24h burn rate is 1.
+	require.Equal(t, []string{"page"}, st.Firing)
+
+	ts := appendStatusSeries(nil, st)
+	require.Len(t, ts, 1+1+6+2)
+	require.Equal(t, labels.MetricName, ts[0].Labels[0].Name)
+	require.Equal(t, ObjectiveMetric, ts[0].Labels[0].Value)
+	last := ts[len(ts)-1]
+	require.Equal(t, "ticket", last.Labels[1].Value)
+	require.Equal(t, 0.0, last.Samples[0].Value)
+	require.Equal(t, 1.0, ts[len(ts)-2].Samples[0].Value)
+}
@@ -0,0 +1,218 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package slo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	// errorRatioQuery is the ratio of the bad events to all the events
+	// over a window.
+	errorRatioQuery = "1 - sum(increase(%[1]s[%[3]s])) / sum(increase(%[2]s[%[3]s]))"
+
+	// The names of the computed series, with the SLO label set to the name
+	// of the SLO.
+	BurnRateMetric             = "slo:burn_rate"
+	ErrorBudgetRemainingMetric = "slo:error_budget_remaining"
+	ObjectiveMetric            = "slo:objective"
+	AlertMetric                = "slo:alert"
+	SLOLabel                   = "slo"
+	WindowLabel                = "window"
+	SeverityLabel              = "severity"
+)
+
+// BurnRateWindows are the windows the burn rates are computed over, those
+// of the multiwindow burn rate alerts.
+var BurnRateWindows = []time.Duration{
+	5 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour, 24 * time.Hour, 72 * time.Hour,
+}
+
+// Alert fires when the burn rates over both its long and its short window
+// are above its threshold, i.e. the error budget is being spent fast and
+// still is.
+type Alert struct {
+	Severity    string
+	LongWindow  time.Duration
+	ShortWindow time.Duration
+	Threshold   float64
+}
+
+// Alerts are the multiwindow burn rate alerts of the SLOs: a page when 2%
+// of a 30 days error budget is spent in an hour or 5% in 6 hours, and a
+// ticket when 10% is spent in 3 days or 10% in a day.
+var Alerts = []Alert{
+	{Severity: "page", LongWindow: time.Hour, ShortWindow: 5 * time.Minute, Threshold: 14.4},
+	{Severity: "page", LongWindow: 6 * time.Hour, ShortWindow: 30 * time.Minute, Threshold: 6},
+	{Severity: "ticket", LongWindow: 24 * time.Hour, ShortWindow: 2 * time.Hour, Threshold: 3},
+	{Severity: "ticket", LongWindow: 72 * time.Hour, ShortWindow: 6 * time.Hour, Threshold: 1},
+}
+
+var evaluations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "slo_evaluations_total",
+		Help:      "Total number of evaluations of the SLOs, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(evaluations)
+}
+
+// Status is the state of an SLO at a time. The ratios and burn rates are
+// not set if there were no events over their window.
+type Status struct {
+	SLO  SLO
+	Time time.Time
+	// ErrorRatio is the ratio of the bad events over the window of the SLO.
+	ErrorRatio *float64
+	// ErrorBudgetRemaining is the share of the error budget of the window
+	// of the SLO that is not spent, negative once it is exhausted.
+	ErrorBudgetRemaining *float64
+	// BurnRates are the ratios of the error ratios over BurnRateWindows to
+	// the error ratio of the objective. A burn rate of 1 spends the error
+	// budget in exactly the window of the SLO.
+	BurnRates map[time.Duration]float64
+	// Firing are the severities of the firing alerts.
+	Firing []string
+}
+
+// Status evaluates the SLO at the time t.
+func (m *Manager) Status(s SLO, t time.Time) (Status, error) {
+	st := Status{SLO: s, Time: t, BurnRates: make(map[time.Duration]float64, len(BurnRateWindows))}
+	budget := 1 - s.Objective
+
+	ratio, ok, err := m.errorRatio(s, s.Window, t)
+	if err != nil {
+		return st, err
+	}
+	if ok {
+		remaining := 1 - ratio/budget
+		st.ErrorRatio, st.ErrorBudgetRemaining = &ratio, &remaining
+	}
+	for _, w := range BurnRateWindows {
+		ratio, ok, err := m.errorRatio(s, w, t)
+		if err != nil {
+			return st, err
+		}
+		if ok {
+			st.BurnRates[w] = ratio / budget
+		}
+	}
+
+	for _, a := range Alerts {
+		long, longOK := st.BurnRates[a.LongWindow]
+		short, shortOK := st.BurnRates[a.ShortWindow]
+		if longOK && shortOK && long > a.Threshold && short > a.Threshold && !contains(st.Firing, a.Severity) {
+			st.Firing = append(st.Firing, a.Severity)
+		}
+	}
+	return st, nil
+}
+
+func (m *Manager) errorRatio(s SLO, window time.Duration, t time.Time) (float64, bool, error) {
+	query := fmt.Sprintf(errorRatioQuery, s.Good, s.Total, model.Duration(window))
+	v, ok, err := m.eval(query, t)
+	if err != nil {
+		return 0, false, fmt.Errorf("error ratio of SLO %s over %v: %w", s.Name, model.Duration(window), err)
+	}
+	// There were no events over the window.
+	if !ok || v != v {
+		return 0, false, nil
+	}
+	return v, true, nil
+}
+
+// Start computes the status of the SLOs every interval in the background,
+// and ingests them as series.
+func (m *Manager) Start(inserter ingestor.DBInserter, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			m.evaluate(inserter, now.Truncate(interval))
+		}
+	}()
+	log.Info("msg", "Evaluating the SLOs", "interval", interval)
+}
+
+// evaluate ingests the status of the SLOs at the time t, truncated to the
+// interval so that the connectors evaluating the same SLOs ingest the same
+// samples and those are deduplicated.
+func (m *Manager) evaluate(inserter ingestor.DBInserter, t time.Time) {
+	slos, err := m.List()
+	if err != nil {
+		log.Warn("msg", "error evaluating the SLOs", "err", err)
+		evaluations.WithLabelValues("error").Inc()
+		return
+	}
+	if len(slos) == 0 {
+		return
+	}
+	req := ingestor.NewWriteRequest()
+	for _, s := range slos {
+		st, err := m.Status(s, t)
+		if err != nil {
+			log.Warn("msg", "error evaluating SLO", "slo", s.Name, "err", err)
+			evaluations.WithLabelValues("error").Inc()
+			continue
+		}
+		req.Timeseries = appendStatusSeries(req.Timeseries, st)
+		evaluations.WithLabelValues("success").Inc()
+	}
+	if _, _, err = inserter.Ingest(req); err != nil {
+		log.Warn("msg", "error ingesting the SLO series", "err", err)
+	}
+}
+
+// appendStatusSeries appends the series of the status to ts.
+func appendStatusSeries(ts []prompb.TimeSeries, st Status) []prompb.TimeSeries {
+	t := timestamp.FromTime(st.Time)
+	series := func(name string, value float64, extra ...prompb.Label) prompb.TimeSeries {
+		lbls := append([]prompb.Label{{Name: labels.MetricName, Value: name}, {Name: SLOLabel, Value: st.SLO.Name}}, extra...)
+		sort.Slice(lbls, func(i, j int) bool { return lbls[i].Name < lbls[j].Name })
+		return prompb.TimeSeries{Labels: lbls, Samples: []prompb.Sample{{Timestamp: t, Value: value}}}
+	}
+
+	ts = append(ts, series(ObjectiveMetric, st.SLO.Objective))
+	if st.ErrorBudgetRemaining != nil {
+		ts = append(ts, series(ErrorBudgetRemainingMetric, *st.ErrorBudgetRemaining))
+	}
+	for _, w := range BurnRateWindows {
+		if rate, ok := st.BurnRates[w]; ok {
+			ts = append(ts, series(BurnRateMetric, rate, prompb.Label{Name: WindowLabel, Value: model.Duration(w).String()}))
+		}
+	}
+	for _, severity := range []string{"page", "ticket"} {
+		firing := 0.0
+		if contains(st.Firing, severity) {
+			firing = 1
+		}
+		ts = append(ts, series(AlertMetric, firing, prompb.Label{Name: SeverityLabel, Value: severity}))
+	}
+	return ts
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package twophase ingests write requests as prepared transactions, which
+// an external transaction manager commits or rolls back along with the
+// other participants of a distributed transaction, for exactly-once
+// pipelines bridging transactional systems.
+package twophase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	pgmodelErrs "github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	// gidPrefix prefixes the global identifiers of the transactions prepared
+	// by the connector, to tell them apart from the other prepared
+	// transactions of the database. It is followed by the scope of the
+	// tenant of the transaction and the id.
+	gidPrefix = "promscale:"
+
+	getEpochSQL    = "SELECT current_epoch FROM " + schema.Catalog + ".ids_epoch LIMIT 1"
+	getSeriesIDSQL = "SELECT table_name, series_id FROM " + schema.Catalog + ".get_or_create_series_id_for_kv_array($1, $2, $3)"
+	insertSQL      = "SELECT " + schema.Catalog + ".insert_metric_row($1, $2::TIMESTAMPTZ[], $3::DOUBLE PRECISION[], $4::BIGINT[])"
+	epochCheckSQL  = "SELECT CASE current_epoch > $1::BIGINT + 1 WHEN true THEN " + schema.Catalog + ".epoch_abort($1) END FROM " + schema.Catalog + ".ids_epoch LIMIT 1"
+	listSQL        = "SELECT substr(gid, length($1) + 1), prepared FROM pg_prepared_xacts WHERE database = current_database() AND left(gid, length($1)) = $1 ORDER BY prepared"
+
+	// The error codes of the prepared transaction statements.
+	duplicateObject  = "42710"
+	undefinedObject  = "42704"
+	notInPrereqState = "55000"
+)
+
+var (
+	// validID restricts the transaction ids to characters that need no
+	// quoting, since the statements of prepared transactions do not take
+	// parameters. Postgres limits the global identifiers to 200 bytes.
+	validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+	ErrInvalidID    = errors.New("invalid transaction id, must be 1 to 128 letters, digits, '.', '_', ':' or '-'")
+	ErrExists       = errors.New("transaction already prepared")
+	ErrNotFound     = errors.New("prepared transaction not found")
+	ErrMixedTenants = errors.New("the samples of a prepared transaction must belong to a single tenant")
+)
+
+// Transaction is a transaction prepared by the connector, waiting to be
+// committed or rolled back.
+type Transaction struct {
+	ID         string    `json:"id"`
+	PreparedAt time.Time `json:"preparedAt"`
+}
+
+type seriesSamples struct {
+	metric  string
+	tenant  string
+	keys    []string
+	values  []string
+	samples []prompb.Sample
+}
+
+// Prepare inserts the samples of the write request in a transaction that it
+// prepares for a two-phase commit under id, and returns the number of
+// samples inserted. The samples are only visible once the transaction is
+// committed. The series are created beforehand in their own transactions,
+// so that the prepared transaction does not hold the locks of the series
+// that other requests ingest. Metadata is not part of the transaction, and
+// is ignored.
+//
+// The transaction belongs to the tenant of its series, which must all have
+// the same, and is only listed, committed and rolled back for that tenant.
+func Prepare(conn pgxconn.PgxConn, id string, r *prompb.WriteRequest) (uint64, error) {
+	if !validID.MatchString(id) {
+		return 0, ErrInvalidID
+	}
+	var (
+		series = make([]seriesSamples, 0, len(r.Timeseries))
+		tenant string
+	)
+	for i := range r.Timeseries {
+		ts := &r.Timeseries[i]
+		if len(ts.Samples) == 0 {
+			continue
+		}
+		s, err := canonicalSeries(ts)
+		if err != nil {
+			return 0, err
+		}
+		if len(series) == 0 {
+			tenant = s.tenant
+		} else if s.tenant != tenant {
+			return 0, ErrMixedTenants
+		}
+		series = append(series, s)
+	}
+
+	epoch, tables, err := createSeries(conn, series)
+	if err != nil {
+		return 0, fmt.Errorf("prepare transaction %s: %w", id, err)
+	}
+	inserted, err := prepareInserts(conn, gid(tenant, id), epoch, tables)
+	if err != nil {
+		return 0, fmt.Errorf("prepare transaction %s: %w", id, mapError(err))
+	}
+	return inserted, nil
+}
+
+// tableRows are the rows inserted in a metric table.
+type tableRows struct {
+	times  []time.Time
+	values []float64
+	series []int64
+}
+
+// createSeries returns the rows of the series to insert by metric table,
+// along with the epoch of the ids of the series.
+func createSeries(conn pgxconn.PgxConn, series []seriesSamples) (int64, map[string]*tableRows, error) {
+	batch := conn.NewBatch()
+	batch.Queue(getEpochSQL)
+	for _, s := range series {
+		// A transaction per series, as the ingestor does per metric, so
+		// that the labels created for a series are not locked until the
+		// other series are created.
+		batch.Queue("BEGIN;")
+		batch.Queue(getSeriesIDSQL, s.metric, s.keys, s.values)
+		batch.Queue("COMMIT;")
+	}
+	results, err := conn.SendBatch(context.Background(), batch)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer results.Close()
+
+	var epoch int64
+	if err = results.QueryRow().Scan(&epoch); err != nil {
+		return 0, nil, err
+	}
+	tables := make(map[string]*tableRows)
+	for _, s := range series {
+		var (
+			table    string
+			seriesID int64
+		)
+		if _, err = results.Exec(); err != nil {
+			return 0, nil, err
+		}
+		if err = results.QueryRow().Scan(&table, &seriesID); err != nil {
+			return 0, nil, err
+		}
+		if _, err = results.Exec(); err != nil {
+			return 0, nil, err
+		}
+		rows, ok := tables[table]
+		if !ok {
+			rows = &tableRows{}
+			tables[table] = rows
+		}
+		for _, sample := range s.samples {
+			rows.times = append(rows.times, timestamp.Time(sample.Timestamp))
+			rows.values = append(rows.values, sample.Value)
+			rows.series = append(rows.series, seriesID)
+		}
+	}
+	return epoch, tables, nil
+}
+
+// prepareInserts inserts the rows in a transaction it prepares under the
+// global identifier gid. The transaction aborts if the series were garbage
+// collected in the meantime, as the inserts of the ingestor do.
+func prepareInserts(conn pgxconn.PgxConn, gid string, epoch int64, tables map[string]*tableRows) (uint64, error) {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	batch := conn.NewBatch()
+	batch.Queue("BEGIN;")
+	for _, name := range names {
+		rows := tables[name]
+		batch.Queue(insertSQL, name, rows.times, rows.values, rows.series)
+	}
+	batch.Queue(epochCheckSQL, epoch)
+	batch.Queue("PREPARE TRANSACTION '" + gid + "'")
+	// If a statement fails, the connection is left in the aborted
+	// transaction, and is closed rather than returned to the pool.
+	results, err := conn.SendBatch(context.Background(), batch)
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	if _, err = results.Exec(); err != nil {
+		return 0, err
+	}
+	var inserted uint64
+	for range names {
+		var n int64
+		if err = results.QueryRow().Scan(&n); err != nil {
+			return 0, err
+		}
+		inserted += uint64(n)
+	}
+	var val []byte
+	if err = results.QueryRow().Scan(&val); err != nil {
+		return 0, err
+	}
+	if _, err = results.Exec(); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// Commit commits the transaction of tenant prepared under id.
+func Commit(conn pgxconn.PgxConn, tenant, id string) error {
+	return finish(conn, tenant, id, "COMMIT PREPARED")
+}
+
+// Rollback rolls back the transaction of tenant prepared under id.
+func Rollback(conn pgxconn.PgxConn, tenant, id string) error {
+	return finish(conn, tenant, id, "ROLLBACK PREPARED")
+}
+
+func finish(conn pgxconn.PgxConn, tenant, id, statement string) error {
+	if !validID.MatchString(id) {
+		return ErrInvalidID
+	}
+	if _, err := conn.Exec(context.Background(), statement+" '"+gid(tenant, id)+"'"); err != nil {
+		return fmt.Errorf("%s %s: %w", statement, id, mapError(err))
+	}
+	return nil
+}
+
+// List returns the transactions of tenant prepared by the connectors which
+// are not committed nor rolled back yet, oldest first.
+func List(conn pgxconn.PgxConn, tenant string) ([]Transaction, error) {
+	rows, err := conn.Query(context.Background(), listSQL, gidPrefix+tenantScope(tenant)+":")
+	if err != nil {
+		return nil, fmt.Errorf("list prepared transactions: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]Transaction, 0)
+	for rows.Next() {
+		var t Transaction
+		if err := rows.Scan(&t.ID, &t.PreparedAt); err != nil {
+			return nil, fmt.Errorf("query result: %w", err)
+		}
+		result = append(result, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query result: %w", err)
+	}
+	return result, nil
+}
+
+// gid returns the global identifier of the transaction of tenant prepared
+// under id.
+func gid(tenant, id string) string {
+	return gidPrefix + tenantScope(tenant) + ":" + id
+}
+
+// tenantScope identifies the tenant in the global identifiers. Tenant names
+// may contain any character and be of any length, while the identifiers are
+// quoted in the statements and limited to 200 bytes, so the names are hashed.
+func tenantScope(tenant string) string {
+	h := sha256.Sum256([]byte(tenant))
+	return hex.EncodeToString(h[:16])
+}
+
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case duplicateObject:
+		return ErrExists
+	case undefinedObject:
+		return ErrNotFound
+	case notInPrereqState:
+		return fmt.Errorf("%w (prepared transactions require max_prepared_transactions to be set in the database)", err)
+	}
+	return err
+}
+
+// canonicalSeries returns the series with its labels sorted by name and
+// without empty values, which are the same as missing labels.
+func canonicalSeries(ts *prompb.TimeSeries) (seriesSamples, error) {
+	lbls := make([]prompb.Label, 0, len(ts.Labels))
+	for _, l := range ts.Labels {
+		if l.Value != "" {
+			lbls = append(lbls, l)
+		}
+	}
+	sort.Slice(lbls, func(i, j int) bool { return lbls[i].Name < lbls[j].Name })
+
+	s := seriesSamples{
+		keys:    make([]string, len(lbls)),
+		values:  make([]string, len(lbls)),
+		samples: ts.Samples,
+	}
+	for i, l := range lbls {
+		if i > 0 && l.Name == lbls[i-1].Name {
+			return seriesSamples{}, fmt.Errorf("duplicate label name %s", l.Name)
+		}
+		switch l.Name {
+		case model.MetricNameLabel:
+			s.metric = l.Value
+		case tenancy.TenantLabelKey:
+			s.tenant = l.Value
+		}
+		s.keys[i], s.values[i] = l.Name, l.Value
+	}
+	if s.metric == "" {
+		return seriesSamples{}, pgmodelErrs.ErrNoMetricName
+	}
+	return s, nil
+}
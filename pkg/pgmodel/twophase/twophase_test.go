@@ -0,0 +1,150 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package twophase
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	pgmodelErrs "github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+func TestPrepare(t *testing.T) {
+	r := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "job", Value: "api"}, {Name: "__name__", Value: "up"}, {Name: "env", Value: ""}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}},
+		},
+		{
+			Labels: []prompb.Label{{Name: "__name__", Value: "empty"}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "errors_total"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 3}},
+		},
+	}}
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: getEpochSQL, Results: model.RowResults{{int64(7)}}},
+		{Sql: "BEGIN;"},
+		{Sql: getSeriesIDSQL, Args: []interface{}{"up", []string{"__name__", "job"}, []string{"up", "api"}}, Results: model.RowResults{{"up", int64(1)}}},
+		{Sql: "COMMIT;"},
+		{Sql: "BEGIN;"},
+		{Sql: getSeriesIDSQL, Args: []interface{}{"errors_total", []string{"__name__"}, []string{"errors_total"}}, Results: model.RowResults{{"errors_total", int64(2)}}},
+		{Sql: "COMMIT;"},
+
+		{Sql: "BEGIN;"},
+		{
+			Sql:     insertSQL,
+			Args:    []interface{}{"errors_total", []time.Time{timestamp.Time(1000)}, []float64{3}, []int64{2}},
+			Results: model.RowResults{{int64(1)}},
+		},
+		{
+			Sql:     insertSQL,
+			Args:    []interface{}{"up", []time.Time{timestamp.Time(1000), timestamp.Time(2000)}, []float64{1, 0}, []int64{1, 1}},
+			Results: model.RowResults{{int64(2)}},
+		},
+		{Sql: epochCheckSQL, Args: []interface{}{int64(7)}, Results: model.RowResults{{[]byte{}}}},
+		{Sql: "PREPARE TRANSACTION 'promscale:" + tenantScope("") + ":kafka-0:42'"},
+	}, t)
+
+	inserted, err := Prepare(mock, "kafka-0:42", r)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), inserted)
+}
+
+func TestPrepareErrors(t *testing.T) {
+	r := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}}
+
+	_, err := Prepare(model.NewSqlRecorder(nil, t), "it's", r)
+	require.Equal(t, ErrInvalidID, err)
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: getEpochSQL, Results: model.RowResults{{int64(7)}}},
+		{Sql: "BEGIN;"},
+		{Sql: getSeriesIDSQL, Args: []interface{}{"up", []string{"__name__"}, []string{"up"}}, Results: model.RowResults{{"up", int64(1)}}},
+		{Sql: "COMMIT;"},
+		{Sql: "BEGIN;"},
+		{Sql: insertSQL, Args: []interface{}{"up", []time.Time{timestamp.Time(1000)}, []float64{1}, []int64{1}}, Results: model.RowResults{{int64(1)}}},
+		{Sql: epochCheckSQL, Args: []interface{}{int64(7)}, Results: model.RowResults{{[]byte{}}}},
+		{Sql: "PREPARE TRANSACTION 'promscale:" + tenantScope("") + ":tx'", Err: &pgconn.PgError{Code: duplicateObject}},
+	}, t)
+	_, err = Prepare(mock, "tx", r)
+	require.ErrorIs(t, err, ErrExists)
+
+	r.Timeseries = append(r.Timeseries, prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: tenancy.TenantLabelKey, Value: "team-a"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	})
+	_, err = Prepare(model.NewSqlRecorder(nil, t), "tx", r)
+	require.Equal(t, ErrMixedTenants, err)
+}
+
+func TestPrepareTenant(t *testing.T) {
+	r := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: tenancy.TenantLabelKey, Value: "team-a"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}}
+	keys, values := []string{"__name__", tenancy.TenantLabelKey}, []string{"up", "team-a"}
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: getEpochSQL, Results: model.RowResults{{int64(7)}}},
+		{Sql: "BEGIN;"},
+		{Sql: getSeriesIDSQL, Args: []interface{}{"up", keys, values}, Results: model.RowResults{{"up", int64(1)}}},
+		{Sql: "COMMIT;"},
+		{Sql: "BEGIN;"},
+		{Sql: insertSQL, Args: []interface{}{"up", []time.Time{timestamp.Time(1000)}, []float64{1}, []int64{1}}, Results: model.RowResults{{int64(1)}}},
+		{Sql: epochCheckSQL, Args: []interface{}{int64(7)}, Results: model.RowResults{{[]byte{}}}},
+		{Sql: "PREPARE TRANSACTION 'promscale:" + tenantScope("team-a") + ":tx'"},
+		{Sql: listSQL, Args: []interface{}{"promscale:" + tenantScope("team-a") + ":"}, Results: model.RowResults{{"tx", time.Unix(1, 0)}}},
+	}, t)
+	_, err := Prepare(mock, "tx", r)
+	require.NoError(t, err)
+
+	txs, err := List(mock, "team-a")
+	require.NoError(t, err)
+	require.Equal(t, []Transaction{{ID: "tx", PreparedAt: time.Unix(1, 0)}}, txs)
+	require.NotEqual(t, tenantScope("team-a"), tenantScope(""))
+}
+
+func TestFinish(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: "COMMIT PREPARED 'promscale:" + tenantScope("team-a") + ":tx'"},
+		{Sql: "ROLLBACK PREPARED 'promscale:" + tenantScope("") + ":tx'", Err: &pgconn.PgError{Code: undefinedObject}},
+	}, t)
+	require.NoError(t, Commit(mock, "team-a", "tx"))
+	require.ErrorIs(t, Rollback(mock, "", "tx"), ErrNotFound)
+	require.Equal(t, ErrInvalidID, Commit(mock, "team-a", "tx'; DROP TABLE x; --"))
+}
+
+func TestCanonicalSeries(t *testing.T) {
+	s, err := canonicalSeries(&prompb.TimeSeries{Labels: []prompb.Label{
+		{Name: "job", Value: "api"},
+		{Name: "env", Value: ""},
+		{Name: "__name__", Value: "up"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "up", s.metric)
+	require.Equal(t, []string{"__name__", "job"}, s.keys)
+	require.Equal(t, []string{"up", "api"}, s.values)
+
+	_, err = canonicalSeries(&prompb.TimeSeries{Labels: []prompb.Label{{Name: "job", Value: "api"}}})
+	require.Equal(t, pgmodelErrs.ErrNoMetricName, err)
+
+	_, err = canonicalSeries(&prompb.TimeSeries{Labels: []prompb.Label{
+		{Name: "__name__", Value: "up"},
+		{Name: "job", Value: "a"},
+		{Name: "job", Value: "b"},
+	}})
+	require.Equal(t, fmt.Errorf("duplicate label name job"), err)
+}
@@ -0,0 +1,182 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package usage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/prometheus/common/model"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	observedSinceSQL = "SELECT min(first_queried_at) FROM " + schema.Catalog + ".metric_query_usage"
+	metricUsageSQL   = "SELECT m.metric_name, " +
+		"extract(epoch FROM COALESCE(m.retention_period, " + schema.Catalog + ".get_default_retention_period()))::float8, " +
+		"extract(epoch FROM u.max_lookback)::float8, COALESCE(u.queries, 0), u.last_queried_at " +
+		"FROM " + schema.Catalog + ".metric m LEFT JOIN " + schema.Catalog + ".metric_query_usage u USING (metric_name) " +
+		"WHERE m.table_schema = '" + schema.Data + "' AND NOT m.is_view ORDER BY m.metric_name"
+	applySQL = "SELECT " + schema.Prom + ".set_metric_retention_period('" + schema.Data + "', $1, $2::float8 * INTERVAL '1 second')"
+
+	day = 24 * time.Hour
+)
+
+// Options are the parameters of the recommendations.
+type Options struct {
+	// SafetyMargin multiplies the furthest lookback of the queries of a
+	// metric to get the recommended retention.
+	SafetyMargin float64
+	// MinRetention is the shortest retention recommended, e.g. for the
+	// metrics that are not queried.
+	MinRetention time.Duration
+	// MinObservation is how long the usage must have been recorded for
+	// before retentions are recommended.
+	MinObservation time.Duration
+}
+
+// Validate returns an error if the options are not valid.
+func (o Options) Validate() error {
+	if o.SafetyMargin < 1 {
+		return fmt.Errorf("invalid safety margin %v, must be at least 1", o.SafetyMargin)
+	}
+	if o.MinRetention < day {
+		return fmt.Errorf("invalid minimum retention %v, must be at least a day", o.MinRetention)
+	}
+	if o.MinObservation < 0 {
+		return fmt.Errorf("invalid minimum observation %v, must not be negative", o.MinObservation)
+	}
+	return nil
+}
+
+// Recommendation is a shorter retention for a metric than the current one,
+// based on how far back it is queried.
+type Recommendation struct {
+	Metric      string
+	Retention   time.Duration
+	Recommended time.Duration
+	// MaxLookback is how far back the queries of the metric read, nil if
+	// it was not queried.
+	MaxLookback   *time.Duration
+	Queries       int64
+	LastQueriedAt *time.Time
+	Reason        string
+}
+
+// Report is the recommendations along with when the usage started to be
+// recorded, nil if it never was.
+type Report struct {
+	ObservedSince   *time.Time
+	Recommendations []Recommendation
+}
+
+// metricRetention is the retention and usage of a metric.
+type metricRetention struct {
+	metric        string
+	retention     time.Duration
+	maxLookback   *time.Duration
+	queries       int64
+	lastQueriedAt *time.Time
+}
+
+// Recommend returns the metrics that are retained for longer than they are
+// queried, with the retention matching their usage. No retention is
+// recommended until the usage was recorded for the minimum observation.
+func Recommend(conn pgxconn.PgxConn, opts Options, now time.Time) (Report, error) {
+	var (
+		report   Report
+		observed pgtype.Timestamptz
+	)
+	if err := conn.QueryRow(context.Background(), observedSinceSQL).Scan(&observed); err != nil {
+		return report, fmt.Errorf("fetching the start of the query usage: %w", err)
+	}
+	if observed.Status != pgtype.Present {
+		return report, nil
+	}
+	report.ObservedSince = &observed.Time
+	if now.Sub(observed.Time) < opts.MinObservation {
+		return report, nil
+	}
+
+	rows, err := conn.Query(context.Background(), metricUsageSQL)
+	if err != nil {
+		return report, fmt.Errorf("fetching the query usage of the metrics: %w", err)
+	}
+	defer rows.Close()
+	var metrics []metricRetention
+	for rows.Next() {
+		var (
+			m           metricRetention
+			retention   float64
+			lookback    pgtype.Float8
+			lastQueried pgtype.Timestamptz
+		)
+		if err = rows.Scan(&m.metric, &retention, &lookback, &m.queries, &lastQueried); err != nil {
+			return report, fmt.Errorf("fetching the query usage of the metrics: %w", err)
+		}
+		m.retention = time.Duration(retention * float64(time.Second))
+		if lookback.Status == pgtype.Present {
+			d := time.Duration(lookback.Float * float64(time.Second))
+			m.maxLookback = &d
+		}
+		if lastQueried.Status == pgtype.Present {
+			m.lastQueriedAt = &lastQueried.Time
+		}
+		metrics = append(metrics, m)
+	}
+	if err = rows.Err(); err != nil {
+		return report, fmt.Errorf("fetching the query usage of the metrics: %w", err)
+	}
+	report.Recommendations = recommend(metrics, opts, now.Sub(observed.Time))
+	return report, nil
+}
+
+// recommend returns the recommendations for the metrics whose retention is
+// longer than their furthest lookback times the safety margin, rounded up
+// to days.
+func recommend(metrics []metricRetention, opts Options, observed time.Duration) []Recommendation {
+	recs := make([]Recommendation, 0)
+	for _, m := range metrics {
+		recommended := opts.MinRetention
+		if m.maxLookback != nil {
+			if withMargin := time.Duration(float64(*m.maxLookback) * opts.SafetyMargin); withMargin > recommended {
+				recommended = withMargin
+			}
+		}
+		recommended = time.Duration(math.Ceil(float64(recommended)/float64(day))) * day
+		if recommended >= m.retention {
+			continue
+		}
+		reason := fmt.Sprintf("not queried in the last %v but retained %v", model.Duration(observed.Round(time.Hour)), model.Duration(m.retention))
+		if m.maxLookback != nil {
+			reason = fmt.Sprintf("never queried beyond %v but retained %v", model.Duration(m.maxLookback.Round(time.Hour)), model.Duration(m.retention))
+		}
+		recs = append(recs, Recommendation{
+			Metric:        m.metric,
+			Retention:     m.retention,
+			Recommended:   recommended,
+			MaxLookback:   m.maxLookback,
+			Queries:       m.queries,
+			LastQueriedAt: m.lastQueriedAt,
+			Reason:        reason,
+		})
+	}
+	return recs
+}
+
+// Apply sets the recommended retentions, and returns the number of metrics
+// whose retention was set before an error.
+func Apply(conn pgxconn.PgxConn, recs []Recommendation) (int, error) {
+	for i, r := range recs {
+		if _, err := conn.Exec(context.Background(), applySQL, r.Metric, r.Recommended.Seconds()); err != nil {
+			return i, fmt.Errorf("setting the retention of metric %s: %w", r.Metric, err)
+		}
+	}
+	return len(recs), nil
+}
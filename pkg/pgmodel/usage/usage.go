@@ -0,0 +1,120 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package usage records how far back the queries of each metric read, and
+// recommends retention periods matching that usage.
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const flushSQL = "INSERT INTO " + schema.Catalog + ".metric_query_usage AS u (metric_name, max_lookback, queries, first_queried_at, last_queried_at) " +
+	"SELECT n.metric_name, n.lookback * INTERVAL '1 second', n.queries, n.first_queried_at, n.last_queried_at " +
+	"FROM unnest($1::text[], $2::float8[], $3::bigint[], $4::timestamptz[], $5::timestamptz[]) AS n(metric_name, lookback, queries, first_queried_at, last_queried_at) " +
+	"ON CONFLICT (metric_name) DO UPDATE SET max_lookback = GREATEST(u.max_lookback, EXCLUDED.max_lookback), " +
+	"queries = u.queries + EXCLUDED.queries, last_queried_at = GREATEST(u.last_queried_at, EXCLUDED.last_queried_at)"
+
+type metricUsage struct {
+	maxLookback        time.Duration
+	queries            int64
+	first, lastQueried time.Time
+}
+
+// Recorder records the furthest lookback of the queries of each metric,
+// relative to when they run, and flushes it to the catalog periodically so
+// that the usage of all the connectors is aggregated.
+type Recorder struct {
+	conn  pgxconn.PgxConn
+	mux   sync.Mutex
+	usage map[string]*metricUsage
+	now   func() time.Time
+}
+
+// NewRecorder returns a recorder flushing the usage every interval, until
+// sigClose is closed.
+func NewRecorder(conn pgxconn.PgxConn, interval time.Duration, sigClose <-chan struct{}) *Recorder {
+	r := newRecorder(conn)
+	go r.run(interval, sigClose)
+	return r
+}
+
+func newRecorder(conn pgxconn.PgxConn) *Recorder {
+	return &Recorder{
+		conn:  conn,
+		usage: make(map[string]*metricUsage),
+		now:   time.Now,
+	}
+}
+
+// Record tracks a query of the metric reading from start, in milliseconds.
+func (r *Recorder) Record(metric string, start int64) {
+	now := r.now()
+	lookback := now.Sub(timestamp.Time(start))
+	if lookback < 0 {
+		lookback = 0
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	u, ok := r.usage[metric]
+	if !ok {
+		u = &metricUsage{first: now}
+		r.usage[metric] = u
+	}
+	if lookback > u.maxLookback {
+		u.maxLookback = lookback
+	}
+	u.queries++
+	u.lastQueried = now
+}
+
+func (r *Recorder) run(interval time.Duration, sigClose <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-sigClose:
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush adds the usage recorded since the last flush to the catalog.
+func (r *Recorder) flush() {
+	r.mux.Lock()
+	usage := r.usage
+	r.usage = make(map[string]*metricUsage, len(usage))
+	r.mux.Unlock()
+	if len(usage) == 0 {
+		return
+	}
+
+	var (
+		metrics             = make([]string, 0, len(usage))
+		lookbacks           = make([]float64, 0, len(usage))
+		queries             = make([]int64, 0, len(usage))
+		firsts, lastQueried = make([]time.Time, 0, len(usage)), make([]time.Time, 0, len(usage))
+	)
+	for metric, u := range usage {
+		metrics = append(metrics, metric)
+		lookbacks = append(lookbacks, u.maxLookback.Seconds())
+		queries = append(queries, u.queries)
+		firsts = append(firsts, u.first)
+		lastQueried = append(lastQueried, u.lastQueried)
+	}
+	if _, err := r.conn.Exec(context.Background(), flushSQL, metrics, lookbacks, queries, firsts, lastQueried); err != nil {
+		log.Warn("msg", "error recording the query usage of the metrics", "err", err)
+	}
+}
@@ -0,0 +1,54 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	now := time.Unix(100000, 0)
+	r := newRecorder(nil)
+	r.now = func() time.Time { return now }
+
+	r.Record("cpu", timestamp.FromTime(now.Add(-time.Hour)))
+	r.Record("cpu", timestamp.FromTime(now.Add(-7*24*time.Hour)))
+	r.Record("cpu", timestamp.FromTime(now.Add(-time.Minute)))
+	r.Record("mem", timestamp.FromTime(now.Add(time.Minute)))
+
+	require.Equal(t, &metricUsage{maxLookback: 7 * 24 * time.Hour, queries: 3, first: now, lastQueried: now}, r.usage["cpu"])
+	require.Equal(t, time.Duration(0), r.usage["mem"].maxLookback)
+}
+
+func TestRecommend(t *testing.T) {
+	lookback := func(d time.Duration) *time.Duration { return &d }
+	opts := Options{SafetyMargin: 1.5, MinRetention: 7 * day, MinObservation: 7 * day}
+	require.NoError(t, opts.Validate())
+
+	recs := recommend([]metricRetention{
+		{metric: "cpu", retention: 90 * day, maxLookback: lookback(7 * day), queries: 10},
+		{metric: "mem", retention: 90 * day, maxLookback: lookback(80 * day), queries: 10},
+		{metric: "disk", retention: 90 * day},
+		{metric: "net", retention: 5 * day, maxLookback: lookback(time.Hour)},
+		{metric: "load", retention: 30 * day, maxLookback: lookback(time.Hour)},
+	}, opts, 30*day)
+
+	require.Len(t, recs, 3)
+	require.Equal(t, "cpu", recs[0].Metric)
+	require.Equal(t, 11*day, recs[0].Recommended)
+	require.Equal(t, "never queried beyond 1w but retained 90d", recs[0].Reason)
+	require.Equal(t, "disk", recs[1].Metric)
+	require.Equal(t, 7*day, recs[1].Recommended)
+	require.Equal(t, "not queried in the last 30d but retained 90d", recs[1].Reason)
+	require.Equal(t, "load", recs[2].Metric)
+	require.Equal(t, 7*day, recs[2].Recommended)
+
+	require.Error(t, Options{SafetyMargin: 0.5, MinRetention: day}.Validate())
+	require.Error(t, Options{SafetyMargin: 1, MinRetention: time.Hour}.Validate())
+}
@@ -0,0 +1,155 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// explainTimeout bounds the time spent capturing the plan of a slow query,
+// which runs the query again.
+const explainTimeout = time.Minute
+
+var slowQueries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "query_slow_total",
+		Help:      "Total number of read queries slower than the audit threshold, by whether their plan was captured, skipped or failed.",
+	},
+	[]string{"plan"},
+)
+
+func init() {
+	prometheus.MustRegister(slowQueries)
+}
+
+// auditConn logs the read queries that take longer than the threshold and,
+// for a sampled fraction of them, their EXPLAIN (ANALYZE, BUFFERS) output,
+// so that plan regressions, e.g. after a Postgres upgrade, can be diagnosed
+// after the fact. The plan is captured by running the query again, in the
+// background and one query at a time, so that it does not slow down the
+// queries nor overload a database that is already slow.
+type auditConn struct {
+	PgxConn
+	threshold  time.Duration
+	sampleRate float64
+	explaining chan struct{}
+	sample     func() float64
+}
+
+// NewAuditingPgxConn returns a PgxConn auditing the read queries of conn
+// slower than threshold, and capturing the plan of sampleRate of them.
+func NewAuditingPgxConn(conn PgxConn, threshold time.Duration, sampleRate float64) PgxConn {
+	return &auditConn{
+		PgxConn:    conn,
+		threshold:  threshold,
+		sampleRate: sampleRate,
+		explaining: make(chan struct{}, 1),
+		sample:     rand.Float64,
+	}
+}
+
+func (c *auditConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	startTime := time.Now()
+	rows, err := c.PgxConn.Query(ctx, sql, args...)
+	if err != nil {
+		return rows, err
+	}
+	return &auditRows{PgxRows: rows, conn: c, sql: sql, args: args, startTime: startTime}, nil
+}
+
+func (c *auditConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	startTime := time.Now()
+	return &auditRow{Row: c.PgxConn.QueryRow(ctx, sql, args...), conn: c, sql: sql, args: args, startTime: startTime}
+}
+
+// audit logs the query if it was slow, with its plan if it is sampled.
+func (c *auditConn) audit(sql string, args []interface{}, elapsed time.Duration) {
+	if elapsed < c.threshold {
+		return
+	}
+	if c.sample() < c.sampleRate {
+		select {
+		case c.explaining <- struct{}{}:
+			go c.auditWithPlan(sql, args, elapsed)
+			return
+		default:
+			// The plan of another query is being captured.
+		}
+	}
+	slowQueries.WithLabelValues("skipped").Inc()
+	logSlowQuery(sql, args, elapsed)
+}
+
+func (c *auditConn) auditWithPlan(sql string, args []interface{}, elapsed time.Duration) {
+	defer func() { <-c.explaining }()
+	plan, err := c.explain(sql, args)
+	if err != nil {
+		slowQueries.WithLabelValues("failed").Inc()
+		logSlowQuery(sql, args, elapsed, "err", fmt.Sprintf("capturing plan: %v", err))
+		return
+	}
+	slowQueries.WithLabelValues("captured").Inc()
+	logSlowQuery(sql, args, elapsed, "plan", plan)
+}
+
+func logSlowQuery(sql string, args []interface{}, elapsed time.Duration, keyvals ...interface{}) {
+	keyvals = append([]interface{}{"msg", "Slow SQL query", "query", filterIndentChars(sql), "args", fmt.Sprintf("%v", args), "time", elapsed}, keyvals...)
+	log.Info(keyvals...)
+}
+
+func (c *auditConn) explain(sql string, args []interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+	return explain(ctx, c.PgxConn, sql, args)
+}
+
+// auditRows times the query until its rows are closed, since the rows are
+// fetched as they are read.
+type auditRows struct {
+	PgxRows
+	conn      *auditConn
+	sql       string
+	args      []interface{}
+	startTime time.Time
+	closed    bool
+}
+
+func (r *auditRows) Close() {
+	r.PgxRows.Close()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	// Failed and cancelled queries, e.g. those losing a hedge, are not
+	// audited since their time is not the time of the query.
+	if r.PgxRows.Err() == nil {
+		r.conn.audit(r.sql, r.args, time.Since(r.startTime))
+	}
+}
+
+type auditRow struct {
+	pgx.Row
+	conn      *auditConn
+	sql       string
+	args      []interface{}
+	startTime time.Time
+}
+
+func (r *auditRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if err == nil || err == pgx.ErrNoRows {
+		r.conn.audit(r.sql, r.args, time.Since(r.startTime))
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditConn(t *testing.T) {
+	testCases := []struct {
+		name            string
+		conn            fakeConn
+		sample          float64
+		expectedQueries int32
+	}{
+		{
+			name:            "fast query",
+			conn:            fakeConn{name: "fast"},
+			sample:          0,
+			expectedQueries: 1,
+		},
+		{
+			name:            "slow query sampled",
+			conn:            fakeConn{name: "slow", delay: 20 * time.Millisecond},
+			sample:          0.05,
+			expectedQueries: 2,
+		},
+		{
+			name:            "slow query not sampled",
+			conn:            fakeConn{name: "slow", delay: 20 * time.Millisecond},
+			sample:          0.5,
+			expectedQueries: 1,
+		},
+		{
+			name:            "failed query",
+			conn:            fakeConn{name: "failed", delay: 20 * time.Millisecond, err: fmt.Errorf("failure")},
+			sample:          0,
+			expectedQueries: 1,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			conn := NewAuditingPgxConn(&c.conn, 10*time.Millisecond, 0.1).(*auditConn)
+			conn.sample = func() float64 { return c.sample }
+
+			rows, err := conn.Query(context.Background(), "SELECT 1")
+			require.NoError(t, err)
+			for rows.Next() {
+			}
+			require.Equal(t, c.conn.err, rows.Err())
+			rows.Close()
+
+			// The plans are captured in the background.
+			require.Eventually(t, func() bool { return len(conn.explaining) == 0 }, time.Second, time.Millisecond)
+			require.Equal(t, c.expectedQueries, atomic.LoadInt32(&c.conn.queries))
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	conn := NewAuditingPgxConn(&fakeConn{name: "Seq Scan on t"}, time.Second, 1).(*auditConn)
+	plan, err := conn.explain("SELECT 1", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Seq Scan on t", plan)
+
+	conn = NewAuditingPgxConn(&fakeConn{err: fmt.Errorf("failure")}, time.Second, 1).(*auditConn)
+	_, err = conn.explain("SELECT 1", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,125 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// QueryClass is the priority class of a read query. The statements of the
+// classes with a connection pool of their own run on it, so that they
+// neither starve nor are starved by the queries of the other classes.
+type QueryClass string
+
+const (
+	// ClassInteractive is the class of the queries of dashboards and users,
+	// and the default one.
+	ClassInteractive QueryClass = "interactive"
+	// ClassRule is the class of the evaluations of recording and alerting
+	// rules and of SLOs.
+	ClassRule QueryClass = "rule"
+	// ClassAdhoc is the class of exploratory and batch queries.
+	ClassAdhoc QueryClass = "adhoc"
+	// ClassCold is the class of the PromQL queries reading samples older
+	// than promql-cold-query-age, whatever the class of their request.
+	ClassCold QueryClass = "cold"
+)
+
+var classQueries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "query_class_statements_total",
+		Help:      "Total number of read statements run on the connection pool of a query class, by class.",
+	},
+	[]string{"class"},
+)
+
+func init() {
+	prometheus.MustRegister(classQueries)
+}
+
+// ParseQueryClass returns the class of the name.
+func ParseQueryClass(name string) (QueryClass, error) {
+	switch class := QueryClass(name); class {
+	case ClassInteractive, ClassRule, ClassAdhoc, ClassCold:
+		return class, nil
+	}
+	return "", fmt.Errorf("unknown query class %q, expected %s, %s, %s or %s", name, ClassInteractive, ClassRule, ClassAdhoc, ClassCold)
+}
+
+type queryClassKey struct{}
+
+// WithQueryClass returns a context whose statements run with the priority
+// of the class.
+func WithQueryClass(ctx context.Context, class QueryClass) context.Context {
+	return context.WithValue(ctx, queryClassKey{}, class)
+}
+
+// QueryClassFrom returns the class of the context, ClassInteractive if it
+// has none.
+func QueryClassFrom(ctx context.Context) QueryClass {
+	if class, ok := ctx.Value(queryClassKey{}).(QueryClass); ok {
+		return class
+	}
+	return ClassInteractive
+}
+
+// classedConn runs the statements of the query classes with a connection of
+// their own on it, and all the other statements on the default connection.
+type classedConn struct {
+	PgxConn
+	classes map[QueryClass]PgxConn
+}
+
+// NewClassedPgxConn returns a PgxConn running the statements of the classes
+// of classes on their connection, and the others on conn.
+func NewClassedPgxConn(conn PgxConn, classes map[QueryClass]PgxConn) PgxConn {
+	if len(classes) == 0 {
+		return conn
+	}
+	return &classedConn{PgxConn: conn, classes: classes}
+}
+
+func (c *classedConn) connFor(ctx context.Context) PgxConn {
+	class := QueryClassFrom(ctx)
+	if conn, ok := c.classes[class]; ok {
+		classQueries.WithLabelValues(string(class)).Inc()
+		return conn
+	}
+	return c.PgxConn
+}
+
+func (c *classedConn) Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+	return c.connFor(ctx).Exec(ctx, sql, arguments...)
+}
+
+func (c *classedConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	return c.connFor(ctx).Query(ctx, sql, args...)
+}
+
+func (c *classedConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return c.connFor(ctx).QueryRow(ctx, sql, args...)
+}
+
+func (c *classedConn) SendBatch(ctx context.Context, b PgxBatch) (pgx.BatchResults, error) {
+	return c.connFor(ctx).SendBatch(ctx, b)
+}
+
+func (c *classedConn) WithConn(ctx context.Context, fn func(conn PgxConn) error) error {
+	return c.connFor(ctx).WithConn(ctx, fn)
+}
+
+func (c *classedConn) Close() {
+	c.PgxConn.Close()
+	for _, conn := range c.classes {
+		conn.Close()
+	}
+}
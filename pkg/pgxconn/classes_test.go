@@ -0,0 +1,46 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryClass(t *testing.T) {
+	for _, name := range []string{"interactive", "rule", "adhoc", "cold"} {
+		class, err := ParseQueryClass(name)
+		require.NoError(t, err)
+		require.Equal(t, QueryClass(name), class)
+	}
+	_, err := ParseQueryClass("urgent")
+	require.Error(t, err)
+
+	require.Equal(t, ClassInteractive, QueryClassFrom(context.Background()))
+	require.Equal(t, ClassRule, QueryClassFrom(WithQueryClass(context.Background(), ClassRule)))
+}
+
+func TestClassedConn(t *testing.T) {
+	main, rule := &fakeConn{name: "main"}, &fakeConn{name: "rule"}
+	require.Same(t, main, NewClassedPgxConn(main, nil), "without classes the connection is used as it is")
+
+	conn := NewClassedPgxConn(main, map[QueryClass]PgxConn{ClassRule: rule})
+	queryName := func(ctx context.Context) string {
+		rows, err := conn.Query(ctx, "SELECT 1")
+		require.NoError(t, err)
+		defer rows.Close()
+		require.True(t, rows.Next())
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		return name
+	}
+	require.Equal(t, "main", queryName(context.Background()))
+	require.Equal(t, "main", queryName(WithQueryClass(context.Background(), ClassAdhoc)), "the classes without a pool share the main one")
+	require.Equal(t, "rule", queryName(WithQueryClass(context.Background(), ClassRule)))
+	require.Equal(t, int32(2), main.queries)
+	require.Equal(t, int32(1), rule.queries)
+}
@@ -0,0 +1,183 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+var hedgedQueries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "query_hedged_total",
+		Help:      "Total number of read queries also sent to the replica because they were slow, by the database that answered first.",
+	},
+	[]string{"winner"},
+)
+
+func init() {
+	prometheus.MustRegister(hedgedQueries)
+}
+
+// hedgedConn sends the read queries to the primary database and, when they
+// have not returned their first row after the hedge delay, to a replica
+// too. The result of whichever answers first is used and the other query is
+// cancelled, so that an occasionally slow database does not slow down the
+// queries. All the other statements only go to the primary database.
+type hedgedConn struct {
+	PgxConn
+	replica PgxConn
+	delay   time.Duration
+}
+
+// NewHedgedPgxConn returns a PgxConn hedging the read queries of primary
+// with replica after delay.
+func NewHedgedPgxConn(primary, replica PgxConn, delay time.Duration) PgxConn {
+	return &hedgedConn{PgxConn: primary, replica: replica, delay: delay}
+}
+
+// hedgeResult is the outcome of one of the attempts of a query, once it
+// returned its first row or failed.
+type hedgeResult struct {
+	rows    PgxRows
+	hasRow  bool
+	err     error
+	replica bool
+}
+
+func (c *hedgedConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[bool]context.CancelFunc, 2)
+	start := func(conn PgxConn, replica bool) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[replica] = cancel
+		go func() {
+			res := hedgeResult{replica: replica}
+			res.rows, res.err = conn.Query(attemptCtx, sql, args...)
+			if res.err == nil {
+				// The rows are only fetched on the first call to Next,
+				// so this is when the query has answered.
+				res.hasRow = res.rows.Next()
+				if !res.hasRow {
+					res.err = res.rows.Err()
+				}
+			}
+			results <- res
+		}()
+	}
+
+	start(c.PgxConn, false)
+	timer := time.NewTimer(c.delay)
+	defer timer.Stop()
+
+	pending := 1
+	hedged := false
+	for {
+		select {
+		case <-timer.C:
+			start(c.replica, true)
+			pending++
+			hedged = true
+			continue
+		case res := <-results:
+			pending--
+			if res.err != nil && hedged && pending > 0 {
+				// The other attempt may still succeed.
+				closeAttempt(res, cancels[res.replica])
+				continue
+			}
+			if pending > 0 {
+				cancels[!res.replica]()
+				go drainAttempts(results, pending, cancels[!res.replica])
+			}
+			if hedged {
+				hedgedQueries.WithLabelValues(winnerName(res.replica)).Inc()
+			}
+			if res.err != nil {
+				closeAttempt(res, cancels[res.replica])
+				return nil, res.err
+			}
+			return &hedgedRows{PgxRows: res.rows, replay: true, hasRow: res.hasRow, cancel: cancels[res.replica]}, nil
+		}
+	}
+}
+
+func (c *hedgedConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	rows, err := c.Query(ctx, sql, args...)
+	return &hedgedRow{rows: rows, err: err}
+}
+
+func (c *hedgedConn) Close() {
+	c.PgxConn.Close()
+	c.replica.Close()
+}
+
+func winnerName(replica bool) string {
+	if replica {
+		return "replica"
+	}
+	return "primary"
+}
+
+func closeAttempt(res hedgeResult, cancel context.CancelFunc) {
+	if res.rows != nil {
+		res.rows.Close()
+	}
+	cancel()
+}
+
+// drainAttempts releases the attempts that lost the race once they return.
+func drainAttempts(results <-chan hedgeResult, pending int, cancel context.CancelFunc) {
+	for i := 0; i < pending; i++ {
+		closeAttempt(<-results, cancel)
+	}
+}
+
+// hedgedRows are the rows of the attempt that answered first, which replay
+// the result of the call to Next that fetched them.
+type hedgedRows struct {
+	PgxRows
+	replay bool
+	hasRow bool
+	cancel context.CancelFunc
+}
+
+func (r *hedgedRows) Next() bool {
+	if r.replay {
+		r.replay = false
+		return r.hasRow
+	}
+	return r.PgxRows.Next()
+}
+
+func (r *hedgedRows) Close() {
+	r.PgxRows.Close()
+	r.cancel()
+}
+
+// hedgedRow implements pgx.Row over the rows of a hedged query.
+type hedgedRow struct {
+	rows PgxRows
+	err  error
+}
+
+func (r *hedgedRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
@@ -0,0 +1,187 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn answers the queries with a single row holding its name after its
+// delay, unless it fails or the query is cancelled first.
+type fakeConn struct {
+	PgxConn
+	name      string
+	delay     time.Duration
+	err       error
+	queries   int32
+	cancelled int32
+	closed    int32
+}
+
+func (c *fakeConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	atomic.AddInt32(&c.queries, 1)
+	return &fakeRows{ctx: ctx, conn: c}, nil
+}
+
+func (c *fakeConn) Close() {}
+
+type fakeRows struct {
+	ctx     context.Context
+	conn    *fakeConn
+	fetched bool
+	err     error
+}
+
+func (r *fakeRows) Next() bool {
+	if r.fetched {
+		return false
+	}
+	r.fetched = true
+	select {
+	case <-time.After(r.conn.delay):
+	case <-r.ctx.Done():
+		atomic.AddInt32(&r.conn.cancelled, 1)
+		r.err = r.ctx.Err()
+		return false
+	}
+	r.err = r.conn.err
+	return r.err == nil
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	*dest[0].(*string) = r.conn.name
+	return nil
+}
+
+func (r *fakeRows) Err() error { return r.err }
+
+func (r *fakeRows) Close() { atomic.AddInt32(&r.conn.closed, 1) }
+
+func queryName(conn PgxConn) (string, error) {
+	var name string
+	err := conn.QueryRow(context.Background(), "SELECT 1").Scan(&name)
+	return name, err
+}
+
+func TestHedgedConn(t *testing.T) {
+	failure := fmt.Errorf("failure")
+	testCases := []struct {
+		name            string
+		primary         fakeConn
+		replica         fakeConn
+		expected        string
+		err             error
+		replicaQueried  bool
+		expectNoHedging bool
+	}{
+		{
+			name:            "fast primary",
+			primary:         fakeConn{name: "primary"},
+			replica:         fakeConn{name: "replica"},
+			expected:        "primary",
+			expectNoHedging: true,
+		},
+		{
+			name:           "slow primary",
+			primary:        fakeConn{name: "primary", delay: time.Minute},
+			replica:        fakeConn{name: "replica"},
+			expected:       "replica",
+			replicaQueried: true,
+		},
+		{
+			name:           "slow primary and slower replica",
+			primary:        fakeConn{name: "primary", delay: 100 * time.Millisecond},
+			replica:        fakeConn{name: "replica", delay: time.Minute},
+			expected:       "primary",
+			replicaQueried: true,
+		},
+		{
+			name:            "primary failing fast",
+			primary:         fakeConn{name: "primary", err: failure},
+			replica:         fakeConn{name: "replica"},
+			err:             failure,
+			expectNoHedging: true,
+		},
+		{
+			name:           "slow primary failing",
+			primary:        fakeConn{name: "primary", delay: 50 * time.Millisecond, err: failure},
+			replica:        fakeConn{name: "replica", delay: 100 * time.Millisecond},
+			expected:       "replica",
+			replicaQueried: true,
+		},
+		{
+			name:           "both failing",
+			primary:        fakeConn{name: "primary", delay: 50 * time.Millisecond, err: failure},
+			replica:        fakeConn{name: "replica", delay: 100 * time.Millisecond, err: failure},
+			err:            failure,
+			replicaQueried: true,
+		},
+	}
+
+	for _, c := range testCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			conn := NewHedgedPgxConn(&c.primary, &c.replica, 10*time.Millisecond)
+			name, err := queryName(conn)
+			if c.err != nil {
+				require.Equal(t, c.err, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, c.expected, name)
+			}
+
+			replicaQueries := atomic.LoadInt32(&c.replica.queries)
+			if c.expectNoHedging {
+				require.Equal(t, int32(0), replicaQueries)
+				return
+			}
+			require.Equal(t, c.replicaQueried, replicaQueries == 1)
+
+			// The query that lost the race is cancelled and its rows
+			// are closed.
+			loser := &c.replica
+			if c.expected == "replica" {
+				loser = &c.primary
+			}
+			if c.err == nil && atomic.LoadInt32(&loser.queries) > 0 && loser.err == nil {
+				require.Eventually(t, func() bool {
+					return atomic.LoadInt32(&loser.cancelled) == 1 && atomic.LoadInt32(&loser.closed) == 1
+				}, time.Second, time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestHedgedRows(t *testing.T) {
+	primary := &fakeConn{name: "primary"}
+	conn := NewHedgedPgxConn(primary, &fakeConn{name: "replica"}, time.Minute)
+	rows, err := conn.Query(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.False(t, rows.Next())
+	rows.Close()
+	require.Equal(t, int32(1), atomic.LoadInt32(&primary.closed))
+
+	empty := &emptyConn{}
+	conn = NewHedgedPgxConn(empty, empty, time.Minute)
+	var name string
+	require.Equal(t, pgx.ErrNoRows, conn.QueryRow(context.Background(), "SELECT 1").Scan(&name))
+}
+
+// emptyConn answers the queries with no rows.
+type emptyConn struct {
+	PgxConn
+}
+
+func (c *emptyConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	return &fakeRows{ctx: ctx, conn: &fakeConn{}, fetched: true}, nil
+}
@@ -29,6 +29,9 @@ type PgxConn interface {
 	CopyFromRows(rows [][]interface{}) pgx.CopyFromSource
 	NewBatch() PgxBatch
 	SendBatch(ctx context.Context, b PgxBatch) (pgx.BatchResults, error)
+	// WithConn runs fn on a single connection, for statements relying on
+	// the state of the session, such as temporary tables.
+	WithConn(ctx context.Context, fn func(conn PgxConn) error) error
 }
 
 type PgxRows interface {
@@ -135,6 +138,57 @@ func (p *connImpl) SendBatch(ctx context.Context, b PgxBatch) (pgx.BatchResults,
 	return p.Conn.SendBatch(ctx, b.(*pgx.Batch)), nil
 }
 
+func (p *connImpl) WithConn(ctx context.Context, fn func(conn PgxConn) error) error {
+	conn, err := p.Conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// A connection left in a transaction is closed rather than returned to
+	// the pool.
+	defer conn.Release()
+	return fn(&sessionConn{conn: conn})
+}
+
+// sessionConn is a single connection acquired from the pool.
+type sessionConn struct {
+	conn *pgxpool.Conn
+}
+
+// Close does nothing, the connection is released by WithConn.
+func (p *sessionConn) Close() {}
+
+func (p *sessionConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return p.conn.Exec(ctx, sql, args...)
+}
+
+func (p *sessionConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	return p.conn.Query(ctx, sql, args...)
+}
+
+func (p *sessionConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return p.conn.QueryRow(ctx, sql, args...)
+}
+
+func (p *sessionConn) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return p.conn.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func (p *sessionConn) CopyFromRows(rows [][]interface{}) pgx.CopyFromSource {
+	return pgx.CopyFromRows(rows)
+}
+
+func (p *sessionConn) NewBatch() PgxBatch {
+	return &pgx.Batch{}
+}
+
+func (p *sessionConn) SendBatch(ctx context.Context, b PgxBatch) (pgx.BatchResults, error) {
+	return p.conn.SendBatch(ctx, b.(*pgx.Batch)), nil
+}
+
+func (p *sessionConn) WithConn(_ context.Context, fn func(conn PgxConn) error) error {
+	return fn(p)
+}
+
 // filters out indentation characters from the
 // SQL query for better query logging
 func filterIndentChars(query string) string {
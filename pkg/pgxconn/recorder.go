@@ -0,0 +1,138 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// RecordedQuery is a query run on a connection wrapped by a QueryRecorder.
+type RecordedQuery struct {
+	SQL  string
+	Args []interface{}
+	// Plan is the EXPLAIN (ANALYZE, BUFFERS) output of the query, once
+	// explained.
+	Plan string
+
+	conn PgxConn
+}
+
+// QueryRecorder records the queries run on the connections it wraps, in
+// the order they are run, so that the SQL generated for a PromQL query can
+// be shown and explained. It is safe for concurrent use.
+type QueryRecorder struct {
+	mux     sync.Mutex
+	queries []RecordedQuery
+}
+
+// NewQueryRecorder returns a recorder without queries.
+func NewQueryRecorder() *QueryRecorder {
+	return &QueryRecorder{}
+}
+
+// Wrap returns conn recording its queries.
+func (r *QueryRecorder) Wrap(conn PgxConn) PgxConn {
+	return &recordingConn{PgxConn: conn, recorder: r}
+}
+
+// Queries returns the queries recorded so far.
+func (r *QueryRecorder) Queries() []RecordedQuery {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]RecordedQuery(nil), r.queries...)
+}
+
+// Explain returns the queries recorded so far along with their plan, which
+// is captured by running them again on the connection that ran them.
+func (r *QueryRecorder) Explain(ctx context.Context) ([]RecordedQuery, error) {
+	queries := r.Queries()
+	for i := range queries {
+		plan, err := explain(ctx, queries[i].conn, queries[i].SQL, queries[i].Args)
+		if err != nil {
+			return nil, fmt.Errorf("explain query %q: %w", queries[i].SQL, err)
+		}
+		queries[i].Plan = plan
+	}
+	return queries, nil
+}
+
+func (r *QueryRecorder) record(conn PgxConn, sql string, args []interface{}) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.queries = append(r.queries, RecordedQuery{SQL: sql, Args: args, conn: conn})
+}
+
+func explain(ctx context.Context, conn PgxConn, sql string, args []interface{}) (string, error) {
+	rows, err := conn.Query(ctx, "EXPLAIN (ANALYZE, BUFFERS) "+sql, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err = rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type recordingConn struct {
+	PgxConn
+	recorder *QueryRecorder
+}
+
+func (c *recordingConn) Query(ctx context.Context, sql string, args ...interface{}) (PgxRows, error) {
+	c.recorder.record(c.PgxConn, sql, args)
+	return c.PgxConn.Query(ctx, sql, args...)
+}
+
+func (c *recordingConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	c.recorder.record(c.PgxConn, sql, args)
+	return c.PgxConn.QueryRow(ctx, sql, args...)
+}
+
+func (c *recordingConn) NewBatch() PgxBatch {
+	return &recordingBatch{PgxBatch: c.PgxConn.NewBatch()}
+}
+
+// SendBatch records the queries of the batch, which are queued on the batch
+// of the wrapped connection.
+func (c *recordingConn) SendBatch(ctx context.Context, b PgxBatch) (pgx.BatchResults, error) {
+	if rb, ok := b.(*recordingBatch); ok {
+		for _, q := range rb.queued {
+			c.recorder.record(c.PgxConn, q.SQL, q.Args)
+		}
+		b = rb.PgxBatch
+	}
+	return c.PgxConn.SendBatch(ctx, b)
+}
+
+func (c *recordingConn) WithConn(ctx context.Context, fn func(conn PgxConn) error) error {
+	return c.PgxConn.WithConn(ctx, func(conn PgxConn) error {
+		return fn(c.recorder.Wrap(conn))
+	})
+}
+
+type recordingBatch struct {
+	PgxBatch
+	queued []RecordedQuery
+}
+
+func (b *recordingBatch) Queue(query string, arguments ...interface{}) {
+	b.queued = append(b.queued, RecordedQuery{SQL: query, Args: arguments})
+	b.PgxBatch.Queue(query, arguments...)
+}
@@ -0,0 +1,67 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package pgxconn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// batchConn is a fakeConn sending batches of the type of the pgx
+// connections.
+type batchConn struct {
+	fakeConn
+	sent int
+}
+
+func (c *batchConn) NewBatch() PgxBatch {
+	return &pgx.Batch{}
+}
+
+func (c *batchConn) SendBatch(_ context.Context, b PgxBatch) (pgx.BatchResults, error) {
+	c.sent += b.(*pgx.Batch).Len()
+	return nil, nil
+}
+
+func TestQueryRecorder(t *testing.T) {
+	recorder := NewQueryRecorder()
+	primary := &batchConn{fakeConn: fakeConn{name: "Seq Scan on primary"}}
+	replica := &fakeConn{name: "Seq Scan on replica"}
+
+	rows, err := recorder.Wrap(primary).Query(context.Background(), "SELECT $1", 1)
+	require.NoError(t, err)
+	rows.Close()
+	rows, err = recorder.Wrap(replica).Query(context.Background(), "SELECT $1", 2)
+	require.NoError(t, err)
+	rows.Close()
+
+	conn := recorder.Wrap(primary)
+	batch := conn.NewBatch()
+	batch.Queue("SELECT 3")
+	batch.Queue("SELECT 4")
+	_, err = conn.SendBatch(context.Background(), batch)
+	require.NoError(t, err)
+	require.Equal(t, 2, primary.sent)
+
+	queries, err := recorder.Explain(context.Background())
+	require.NoError(t, err)
+	require.Len(t, queries, 4)
+	require.Equal(t, "SELECT $1", queries[0].SQL)
+	require.Equal(t, []interface{}{1}, queries[0].Args)
+	require.Equal(t, "Seq Scan on primary", queries[0].Plan)
+	require.Equal(t, "Seq Scan on replica", queries[1].Plan, "queries must be explained on the connection that ran them")
+	require.Equal(t, "SELECT 4", queries[3].SQL)
+
+	// The recorded queries are not explained in place.
+	require.Empty(t, recorder.Queries()[0].Plan)
+
+	replica.err = fmt.Errorf("failure")
+	_, err = recorder.Explain(context.Background())
+	require.Error(t, err)
+}
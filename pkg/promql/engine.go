@@ -878,6 +878,14 @@ func expandSeriesSet(ctx context.Context, it storage.SeriesSet) (res []storage.S
 		}
 		res = append(res, it.At())
 	}
+	if err := it.Err(); err != nil {
+		// The SQL queries of the series sets are cancelled once ctx is
+		// done, failing them with an error reported as the timeout or
+		// cancellation of the query.
+		if ctxErr := contextDone(ctx, "series fetching"); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+	}
 	return res, it.Warnings(), it.Err()
 }
 
@@ -1219,6 +1227,9 @@ func (ev *evaluator) getPushdownResult(vs *parser.VectorSelector, numSteps int,
 			t, v := it.At()
 			ss.Points = append(ss.Points, Point{V: v, T: t})
 		}
+		if it.Err() != nil {
+			ev.error(it.Err())
+		}
 		if len(ss.Points) > 0 {
 			mat = append(mat, ss)
 		} else {
@@ -1263,9 +1274,11 @@ func (ev *evaluator) eval(expr parser.Expr) (parser.Value, storage.Warnings) {
 					return err
 				}
 				//all range-vector function calls have their metric name dropped
-				//see eval() function
-				_, isCall := expr.(*parser.Call)
-				mat = ev.getPushdownResult(n, numSteps, isCall)
+				//see eval() function. Label rewrites pushed down to the storage
+				//layer return the final labels of the series.
+				call, isCall := expr.(*parser.Call)
+				dropName := isCall && call.Func.Name != "label_replace" && call.Func.Name != "label_join"
+				mat = ev.getPushdownResult(n, numSteps, dropName)
 			}
 			return nil
 		})
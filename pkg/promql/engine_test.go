@@ -136,6 +136,21 @@ func TestQueryTimeout(t *testing.T) {
 	require.True(t, strings.HasPrefix(res.Err.Error(), e.Error()), "expected timeout error but got: %s", res.Err)
 }
 
+func TestExpandSeriesSetTimeout(t *testing.T) {
+	errCancelled := errors.New("canceling statement due to user request")
+
+	_, _, err := expandSeriesSet(context.Background(), storage.ErrSeriesSet(errCancelled))
+	require.Equal(t, errCancelled, err)
+
+	// The series sets failing once their context is done fail the query
+	// with a timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, _, err = expandSeriesSet(ctx, storage.ErrSeriesSet(errCancelled))
+	require.Equal(t, ErrQueryTimeout("series fetching"), err)
+}
+
 const errQueryCanceled = ErrQueryCanceled("test statement execution")
 
 func TestQueryCancel(t *testing.T) {
@@ -0,0 +1,92 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	mq "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+type includeArchivedKey struct{}
+
+// WithArchived returns a context in which the queries also read the
+// archived data.
+func WithArchived(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeArchivedKey{}, true)
+}
+
+func includesArchived(ctx context.Context) bool {
+	include, _ := ctx.Value(includeArchivedKey{}).(bool)
+	return include
+}
+
+// NewArchiveQueryable returns a queryable that does not read the samples
+// older than age, which are considered archived, e.g. moved to slower
+// tiered storage, unless the context of the query opts in with
+// WithArchived. The queries that would have read archived samples have a
+// warning saying that their results are partial.
+func NewArchiveQueryable(q promql.Queryable, age time.Duration) promql.Queryable {
+	return &archiveQueryable{Queryable: q, age: age, now: time.Now}
+}
+
+type archiveQueryable struct {
+	promql.Queryable
+	age time.Duration
+	now func() time.Time
+}
+
+func (q *archiveQueryable) Querier(ctx context.Context, mint, maxt int64) (promql.Querier, error) {
+	cutoff := timestamp.FromTime(q.now().Add(-q.age))
+	if includesArchived(ctx) || mint >= cutoff {
+		return q.Queryable.Querier(ctx, mint, maxt)
+	}
+	querier, err := q.Queryable.Querier(ctx, cutoff, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveQuerier{
+		Querier: querier,
+		maxt:    maxt,
+		cutoff:  cutoff,
+		warning: fmt.Errorf("results exclude the archived samples older than %s, set include_archived=true to query them", model.Duration(q.age)),
+	}, nil
+}
+
+// archiveQuerier selects the samples of its time range that are more recent
+// than the cutoff.
+type archiveQuerier struct {
+	promql.Querier
+	maxt, cutoff int64
+	warning      error
+}
+
+func (q *archiveQuerier) Select(sortSeries bool, hints *storage.SelectHints, qh *mq.QueryHints, nodes []parser.Node, matchers ...*labels.Matcher) (storage.SeriesSet, parser.Node) {
+	if hints != nil && hints.Start >= q.cutoff {
+		return q.Querier.Select(sortSeries, hints, qh, nodes, matchers...)
+	}
+	if q.maxt < q.cutoff || hints != nil && hints.End < q.cutoff {
+		return &warningSeriesSet{SeriesSet: storage.EmptySeriesSet(), warning: q.warning}, nil
+	}
+	ss, node := q.Querier.Select(sortSeries, hints, qh, nodes, matchers...)
+	return &warningSeriesSet{SeriesSet: ss, warning: q.warning}, node
+}
+
+type warningSeriesSet struct {
+	storage.SeriesSet
+	warning error
+}
+
+func (s *warningSeriesSet) Warnings() storage.Warnings {
+	return append(s.SeriesSet.Warnings(), s.warning)
+}
@@ -0,0 +1,129 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+	mq "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+// rangeQueryable records the time range of its queriers.
+type rangeQueryable struct {
+	mint, maxt int64
+	selects    int
+}
+
+func (q *rangeQueryable) Querier(_ context.Context, mint, maxt int64) (promql.Querier, error) {
+	q.mint, q.maxt = mint, maxt
+	return &rangeQuerier{q}, nil
+}
+
+type rangeQuerier struct {
+	*rangeQueryable
+}
+
+func (q *rangeQuerier) LabelValues(string) ([]string, storage.Warnings, error) { return nil, nil, nil }
+func (q *rangeQuerier) LabelNames() ([]string, storage.Warnings, error)        { return nil, nil, nil }
+func (q *rangeQuerier) Close() error                                           { return nil }
+
+func (q *rangeQuerier) Select(bool, *storage.SelectHints, *mq.QueryHints, []parser.Node, ...*labels.Matcher) (storage.SeriesSet, parser.Node) {
+	q.selects++
+	return storage.EmptySeriesSet(), nil
+}
+
+func TestArchiveQueryable(t *testing.T) {
+	now := time.Unix(10000, 0)
+	cutoff := timestamp.FromTime(now.Add(-time.Hour))
+	recent := timestamp.FromTime(now.Add(-time.Minute))
+	old := timestamp.FromTime(now.Add(-2 * time.Hour))
+
+	testCases := []struct {
+		name           string
+		ctx            context.Context
+		mint, maxt     int64
+		hints          *storage.SelectHints
+		expectedMint   int64
+		expectedSelect bool
+		warning        bool
+	}{
+		{
+			name:           "recent samples",
+			ctx:            context.Background(),
+			mint:           recent,
+			maxt:           recent,
+			expectedMint:   recent,
+			expectedSelect: true,
+		},
+		{
+			name:           "archived and recent samples",
+			ctx:            context.Background(),
+			mint:           old,
+			maxt:           recent,
+			expectedMint:   cutoff,
+			expectedSelect: true,
+			warning:        true,
+		},
+		{
+			name:         "archived samples",
+			ctx:          context.Background(),
+			mint:         old,
+			maxt:         old,
+			expectedMint: cutoff,
+			warning:      true,
+		},
+		{
+			name:         "selector on archived samples",
+			ctx:          context.Background(),
+			mint:         old,
+			maxt:         recent,
+			hints:        &storage.SelectHints{Start: old, End: old},
+			expectedMint: cutoff,
+			warning:      true,
+		},
+		{
+			name:           "selector on recent samples",
+			ctx:            context.Background(),
+			mint:           old,
+			maxt:           recent,
+			hints:          &storage.SelectHints{Start: recent, End: recent},
+			expectedMint:   cutoff,
+			expectedSelect: true,
+		},
+		{
+			name:           "include archived samples",
+			ctx:            WithArchived(context.Background()),
+			mint:           old,
+			maxt:           recent,
+			expectedMint:   old,
+			expectedSelect: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			inner := &rangeQueryable{}
+			q := NewArchiveQueryable(inner, time.Hour).(*archiveQueryable)
+			q.now = func() time.Time { return now }
+
+			querier, err := q.Querier(c.ctx, c.mint, c.maxt)
+			require.NoError(t, err)
+			ss, _ := querier.Select(false, c.hints, nil, nil)
+			require.False(t, ss.Next())
+			require.Equal(t, c.expectedMint, inner.mint)
+			require.Equal(t, c.maxt, inner.maxt)
+			require.Equal(t, c.expectedSelect, inner.selects == 1)
+			require.Equal(t, c.warning, len(ss.Warnings()) == 1)
+		})
+	}
+}
@@ -26,8 +26,10 @@ type queryable struct {
 }
 
 func (q queryable) Querier(ctx context.Context, mint, maxt int64) (promql.Querier, error) {
+	// The selects of a query are accounted together against the limits of
+	// the querier.
 	return &querier{
-		ctx: ctx, mint: mint, maxt: maxt,
+		ctx: pgQuerier.WithQueryBudget(ctx), mint: mint, maxt: maxt,
 		metricsReader: q.querier,
 		labelsReader:  q.labelsReader,
 	}, nil
@@ -59,7 +61,7 @@ func (q *querier) Close() error {
 }
 
 func (q *querier) Select(sortSeries bool, hints *storage.SelectHints, qh *mq.QueryHints, path []parser.Node, matchers ...*labels.Matcher) (storage.SeriesSet, parser.Node) {
-	ss, n := q.metricsReader.Select(q.mint, q.maxt, sortSeries, hints, qh, path, matchers...)
+	ss, n := q.metricsReader.Select(q.ctx, q.mint, q.maxt, sortSeries, hints, qh, path, matchers...)
 	q.seriesSets = append(q.seriesSets, ss)
 	return ss, n
 }
@@ -0,0 +1,349 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+var resultsCacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "query_results_cache_requests_total",
+		Help:      "Total number of range query splits looked up in the results cache, by result: hit or miss.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(resultsCacheRequests)
+}
+
+// ResultsCacheConfig configures the results cache of the range queries.
+type ResultsCacheConfig struct {
+	// MaxBytes is the estimated size of the cached results above which the
+	// least recently used are evicted.
+	MaxBytes int64
+	// SplitInterval is the interval the ranges of the queries are split on,
+	// each split being cached separately.
+	SplitInterval time.Duration
+	// Freshness is how far behind the latest sample ingested, or the current
+	// time, the splits must end to be cached, for late samples to be
+	// ingested first.
+	Freshness time.Duration
+	// MaxAge is how long the splits are cached, so that the changes the
+	// connector is not told about, e.g. the samples dropped by the retention
+	// jobs or written through other connectors, are eventually returned.
+	MaxAge time.Duration
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c ResultsCacheConfig) Validate() error {
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("invalid results cache size %d, must not be negative", c.MaxBytes)
+	}
+	if c.SplitInterval < time.Minute {
+		return fmt.Errorf("invalid results cache split interval %v, must be at least a minute", c.SplitInterval)
+	}
+	if c.Freshness < 0 {
+		return fmt.Errorf("invalid results cache freshness %v, must not be negative", c.Freshness)
+	}
+	if c.MaxAge <= 0 {
+		return fmt.Errorf("invalid results cache max age %v, must be positive", c.MaxAge)
+	}
+	return nil
+}
+
+// resultsKey identifies a split of the range queries with the same
+// expression and evaluation times.
+type resultsKey struct {
+	query string
+	step  int64
+	// offset is the offset of the evaluation times from the multiples of
+	// the step.
+	offset int64
+	split  int64
+}
+
+type resultsEntry struct {
+	key      resultsKey
+	start    int64
+	end      int64
+	matrix   promql.Matrix
+	size     int64
+	cachedAt time.Time
+}
+
+/* ResultsCache caches the results of range queries, split at fixed intervals aligned on their step so that the
+* repeated refreshes of a dashboard, moving their range forward, reuse the splits they have in common. Only the splits
+* ending before the latest sample ingested by the connector, and before the current time, by the freshness are cached.
+* The splits are invalidated when samples older than their end are ingested by the connector, e.g. backfills, and when
+* the connector deletes samples in their range. Backfills and deletions through other connectors, and the retention
+* jobs, are not seen, so the splits are also invalidated once they are older than the maximum age. */
+type ResultsCache struct {
+	cfg ResultsCacheConfig
+
+	mux       sync.Mutex
+	entries   map[resultsKey]*list.Element
+	lru       *list.List
+	sizeBytes int64
+	// watermark is the latest sample timestamp ingested by the connector,
+	// 0 if it does not ingest.
+	watermark int64
+	// cachedUntil is the latest end of the cached splits.
+	cachedUntil int64
+	now         func() time.Time
+}
+
+// NewResultsCache returns a results cache with the configuration.
+func NewResultsCache(cfg ResultsCacheConfig) *ResultsCache {
+	return &ResultsCache{
+		cfg:     cfg,
+		entries: make(map[resultsKey]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Ingested records that the samples between mint and maxt, in milliseconds,
+// were ingested, invalidating the cached splits they fall into.
+func (c *ResultsCache) Ingested(mint, maxt int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if maxt > c.watermark {
+		c.watermark = maxt
+	}
+	if mint >= c.cachedUntil {
+		return
+	}
+	for key, elem := range c.entries {
+		if elem.Value.(*resultsEntry).end > mint {
+			c.remove(key, elem)
+		}
+	}
+}
+
+// Deleted records that samples between mint and maxt, in milliseconds, were
+// deleted, invalidating the cached splits overlapping them.
+func (c *ResultsCache) Deleted(mint, maxt int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for key, elem := range c.entries {
+		if e := elem.Value.(*resultsEntry); e.end > mint && e.start <= maxt {
+			c.remove(key, elem)
+		}
+	}
+}
+
+// Exec evaluates the range query, from the cached results of the splits of
+// its range where they are. It returns an error if the query is not valid.
+func (c *ResultsCache) Exec(ctx context.Context, engine *promql.Engine, queryable promql.Queryable, qs string, start, end time.Time, step time.Duration) (*promql.Result, error) {
+	expr, err := parser.ParseExpr(qs)
+	if err != nil || !c.cacheable(expr, step) {
+		return execRange(ctx, engine, queryable, qs, start, end, step)
+	}
+
+	var (
+		startMs, endMs = timestamp.FromTime(start), timestamp.FromTime(end)
+		stepMs         = step.Milliseconds()
+		splitMs        = c.cfg.SplitInterval.Milliseconds()
+		offset         = ((startMs % stepMs) + stepMs) % stepMs
+		horizon        = c.horizon()
+		parts          []promql.Matrix
+		warnings       storage.Warnings
+	)
+	// gridCeil returns the first evaluation time from t.
+	gridCeil := func(t int64) int64 {
+		return t + (((offset-t)%stepMs)+stepMs)%stepMs
+	}
+	split := floorDiv(startMs, splitMs)
+	for ; split*splitMs <= endMs; split++ {
+		splitStart, splitEnd := split*splitMs, (split+1)*splitMs
+		if splitEnd > horizon {
+			break
+		}
+		first, last := gridCeil(splitStart), gridCeil(splitEnd)-stepMs
+		if first > last {
+			continue
+		}
+		key := resultsKey{query: qs, step: stepMs, offset: offset, split: split}
+		matrix, ok := c.get(key)
+		if !ok {
+			resultsCacheRequests.WithLabelValues("miss").Inc()
+			res, err := execRange(ctx, engine, queryable, qs, timestamp.Time(first), timestamp.Time(last), step)
+			if err != nil || res.Err != nil {
+				return res, err
+			}
+			if matrix, ok = res.Value.(promql.Matrix); !ok {
+				return &promql.Result{Err: fmt.Errorf("unexpected range query result of type %s", res.Value.Type())}, nil
+			}
+			if len(res.Warnings) == 0 {
+				c.put(key, splitStart, splitEnd, matrix)
+			}
+			warnings = append(warnings, res.Warnings...)
+		} else {
+			resultsCacheRequests.WithLabelValues("hit").Inc()
+		}
+		parts = append(parts, matrix)
+	}
+
+	// The splits that cannot be cached yet are evaluated at once.
+	if first := gridCeil(split * splitMs); split*splitMs <= endMs && first <= endMs {
+		if first < startMs {
+			first = startMs
+		}
+		res, err := execRange(ctx, engine, queryable, qs, timestamp.Time(first), end, step)
+		if err != nil || res.Err != nil {
+			return res, err
+		}
+		matrix, ok := res.Value.(promql.Matrix)
+		if !ok {
+			return &promql.Result{Err: fmt.Errorf("unexpected range query result of type %s", res.Value.Type())}, nil
+		}
+		parts = append(parts, matrix)
+		warnings = append(warnings, res.Warnings...)
+	}
+	return &promql.Result{Value: mergeMatrices(parts, startMs, endMs), Warnings: warnings}, nil
+}
+
+// cacheable returns whether the results of the query can be split, which is
+// not the case if they depend on the start or end of its range.
+func (c *ResultsCache) cacheable(expr parser.Expr, step time.Duration) bool {
+	if step > c.cfg.SplitInterval || step < time.Millisecond {
+		return false
+	}
+	cacheable := true
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			cacheable = cacheable && n.StartOrEnd == 0
+		case *parser.SubqueryExpr:
+			cacheable = cacheable && n.StartOrEnd == 0
+		}
+		return nil
+	})
+	return cacheable
+}
+
+// horizon returns the time before which the splits are cached.
+func (c *ResultsCache) horizon() int64 {
+	horizon := timestamp.FromTime(c.now())
+	c.mux.Lock()
+	if c.watermark > 0 && c.watermark < horizon {
+		horizon = c.watermark
+	}
+	c.mux.Unlock()
+	return horizon - c.cfg.Freshness.Milliseconds()
+}
+
+func (c *ResultsCache) get(key resultsKey) (promql.Matrix, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(elem.Value.(*resultsEntry).cachedAt) >= c.cfg.MaxAge {
+		c.remove(key, elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*resultsEntry).matrix, true
+}
+
+func (c *ResultsCache) put(key resultsKey, start, end int64, matrix promql.Matrix) {
+	size := int64(len(key.query)) + 64
+	for _, s := range matrix {
+		size += int64(len(s.Points))*16 + 24
+		for _, l := range s.Metric {
+			size += int64(len(l.Name)+len(l.Value)) + 32
+		}
+	}
+	if size > c.cfg.MaxBytes {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(key, elem)
+	}
+	for c.sizeBytes+size > c.cfg.MaxBytes {
+		oldest := c.lru.Back()
+		c.remove(oldest.Value.(*resultsEntry).key, oldest)
+	}
+	c.entries[key] = c.lru.PushFront(&resultsEntry{key: key, start: start, end: end, matrix: matrix, size: size, cachedAt: c.now()})
+	c.sizeBytes += size
+	if end > c.cachedUntil {
+		c.cachedUntil = end
+	}
+}
+
+func (c *ResultsCache) remove(key resultsKey, elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, key)
+	c.sizeBytes -= elem.Value.(*resultsEntry).size
+}
+
+func execRange(ctx context.Context, engine *promql.Engine, queryable promql.Queryable, qs string, start, end time.Time, step time.Duration) (*promql.Result, error) {
+	qry, err := engine.NewRangeQuery(queryable, qs, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	return qry.Exec(ctx), nil
+}
+
+// mergeMatrices merges the series of the matrices of consecutive ranges into
+// new series, keeping the points between start and end.
+func mergeMatrices(parts []promql.Matrix, start, end int64) promql.Matrix {
+	var (
+		merged = promql.Matrix{}
+		index  = make(map[string]int)
+	)
+	for _, part := range parts {
+		for _, s := range part {
+			key := s.Metric.String()
+			i, ok := index[key]
+			if !ok {
+				i = len(merged)
+				index[key] = i
+				merged = append(merged, promql.Series{Metric: s.Metric})
+			}
+			for _, p := range s.Points {
+				if p.T >= start && p.T <= end {
+					merged[i].Points = append(merged[i].Points, p)
+				}
+			}
+		}
+	}
+	result := merged[:0]
+	for _, s := range merged {
+		if len(s.Points) > 0 {
+			result = append(result, s)
+		}
+	}
+	sort.Sort(result)
+	return result
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,114 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+func TestResultsCacheExec(t *testing.T) {
+	engine, err := NewEngine(log.NewNopLogger(), time.Minute, 5*time.Minute, time.Minute, 50000000, nil)
+	require.NoError(t, err)
+	now := time.Unix(100000, 0)
+	c := NewResultsCache(ResultsCacheConfig{MaxBytes: 1 << 20, SplitInterval: time.Hour, Freshness: 10 * time.Minute, MaxAge: time.Hour})
+	c.now = func() time.Time { return now }
+
+	exec := func(start, end time.Time) {
+		qs := "time()"
+		expected, err := execRange(context.Background(), engine, &rangeQueryable{}, qs, start, end, 30*time.Second)
+		require.NoError(t, err)
+		res, err := c.Exec(context.Background(), engine, &rangeQueryable{}, qs, start, end, 30*time.Second)
+		require.NoError(t, err)
+		require.NoError(t, res.Err)
+		require.Equal(t, expected.Value, res.Value)
+	}
+
+	// The splits ending before the freshness are cached.
+	exec(now.Add(-3*time.Hour), now)
+	require.Len(t, c.entries, 3)
+	exec(now.Add(-2*time.Hour), now.Add(time.Minute))
+	require.Len(t, c.entries, 3)
+
+	// Samples ingested invalidate the splits ending after them.
+	c.Ingested(now.Add(-90*time.Minute).UnixNano()/1e6, now.UnixNano()/1e6)
+	require.Len(t, c.entries, 2)
+	exec(now.Add(-3*time.Hour), now)
+	require.Len(t, c.entries, 3)
+
+	// The splits evaluated with a different offset from the step are cached
+	// separately.
+	exec(now.Add(-3*time.Hour+15*time.Second), now)
+	require.Len(t, c.entries, 6)
+
+	// Samples deleted invalidate the splits overlapping them.
+	c.Deleted(now.Add(-150*time.Minute).UnixNano()/1e6, now.Add(-140*time.Minute).UnixNano()/1e6)
+	require.Len(t, c.entries, 4)
+
+	// The splits older than the maximum age are evaluated again.
+	key := resultsKey{query: "time()", step: 30000, offset: 10000, split: now.Add(-3*time.Hour).Unix() / 3600}
+	require.Equal(t, now, c.entries[key].Value.(*resultsEntry).cachedAt)
+	now = now.Add(time.Hour)
+	exec(now.Add(-4*time.Hour), now.Add(-time.Hour))
+	require.Equal(t, now, c.entries[key].Value.(*resultsEntry).cachedAt)
+
+	// Invalid queries are reported as errors.
+	_, err = c.Exec(context.Background(), engine, &rangeQueryable{}, "time(", now.Add(-time.Hour), now, time.Minute)
+	require.Error(t, err)
+}
+
+func TestResultsCacheCacheable(t *testing.T) {
+	c := NewResultsCache(ResultsCacheConfig{MaxBytes: 1 << 20, SplitInterval: time.Hour})
+	testCases := []struct {
+		query     string
+		step      time.Duration
+		cacheable bool
+	}{
+		{query: "rate(up[5m])", step: time.Minute, cacheable: true},
+		{query: "up @ 1000", step: time.Minute, cacheable: true},
+		{query: "up", step: 2 * time.Hour},
+		{query: "up @ end()", step: time.Minute},
+		{query: "max_over_time(up[1h:] @ start())", step: time.Minute},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.query)
+			require.NoError(t, err)
+			require.Equal(t, tc.cacheable, c.cacheable(expr, tc.step))
+		})
+	}
+}
+
+func TestResultsCacheEviction(t *testing.T) {
+	matrix := promql.Matrix{{Metric: labels.FromStrings("job", "a"), Points: []promql.Point{{T: 1, V: 1}}}}
+	c := NewResultsCache(ResultsCacheConfig{MaxBytes: 300, SplitInterval: time.Hour, MaxAge: time.Hour})
+	for split := int64(0); split < 3; split++ {
+		c.put(resultsKey{query: "up", step: 1, split: split}, split-1, split, matrix)
+	}
+	_, ok := c.get(resultsKey{query: "up", step: 1, split: 0})
+	require.False(t, ok)
+	_, ok = c.get(resultsKey{query: "up", step: 1, split: 2})
+	require.True(t, ok)
+	require.LessOrEqual(t, c.sizeBytes, int64(300))
+}
+
+func TestMergeMatrices(t *testing.T) {
+	a, b := labels.FromStrings("job", "a"), labels.FromStrings("job", "b")
+	merged := mergeMatrices([]promql.Matrix{
+		{{Metric: b, Points: []promql.Point{{T: 0, V: 1}, {T: 10, V: 2}}}},
+		{{Metric: a, Points: []promql.Point{{T: 20, V: 3}}}, {Metric: b, Points: []promql.Point{{T: 20, V: 4}, {T: 30, V: 5}}}},
+	}, 10, 20)
+	require.Equal(t, promql.Matrix{
+		{Metric: a, Points: []promql.Point{{T: 20, V: 3}}},
+		{Metric: b, Points: []promql.Point{{T: 10, V: 2}, {T: 20, V: 4}}},
+	}, merged)
+}
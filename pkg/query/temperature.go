@@ -0,0 +1,122 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+var (
+	temperatureQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Name:      "query_temperature_total",
+			Help:      "Total number of PromQL queries by temperature: hot for the queries of recent samples, cold for those reading older samples.",
+		},
+		[]string{"temperature"},
+	)
+	coldQueriesWaiting = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: util.PromNamespace,
+			Name:      "query_cold_waiting",
+			Help:      "Number of cold PromQL queries waiting for one of the running cold queries to finish.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(temperatureQueries, coldQueriesWaiting)
+}
+
+// ColdQueryConfig configures how the queries reading old samples, which are
+// likely in compressed chunks rather than in the cache of the database, are
+// run.
+type ColdQueryConfig struct {
+	// Age is the age of the samples above which a query reading them is
+	// cold.
+	Age time.Duration
+	// Timeout is the time after which the SQL statements of a cold query are
+	// cancelled, 0 for the timeout of all the queries.
+	Timeout time.Duration
+	// MaxConcurrent is the number of cold queries run at once, 0 for no
+	// limit.
+	MaxConcurrent int
+}
+
+// NewTemperatureQueryable returns a queryable running the queries reading
+// samples older than the age of cfg, which are cold, with the limits of cfg
+// and in the pgxconn.ClassCold query class, so that a flood of historical
+// queries does not slow down the hot queries of real-time dashboards.
+func NewTemperatureQueryable(q promql.Queryable, cfg ColdQueryConfig) promql.Queryable {
+	tq := &temperatureQueryable{Queryable: q, cfg: cfg, now: time.Now}
+	if cfg.MaxConcurrent > 0 {
+		tq.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return tq
+}
+
+type temperatureQueryable struct {
+	promql.Queryable
+	cfg   ColdQueryConfig
+	now   func() time.Time
+	slots chan struct{}
+}
+
+func (q *temperatureQueryable) Querier(ctx context.Context, mint, maxt int64) (promql.Querier, error) {
+	if mint >= timestamp.FromTime(q.now().Add(-q.cfg.Age)) {
+		temperatureQueries.WithLabelValues("hot").Inc()
+		return q.Queryable.Querier(ctx, mint, maxt)
+	}
+	temperatureQueries.WithLabelValues("cold").Inc()
+	if q.slots != nil {
+		coldQueriesWaiting.Inc()
+		select {
+		case q.slots <- struct{}{}:
+			coldQueriesWaiting.Dec()
+		case <-ctx.Done():
+			coldQueriesWaiting.Dec()
+			return nil, fmt.Errorf("waiting for a cold query to finish: %w", ctx.Err())
+		}
+	}
+	cancel := context.CancelFunc(func() {})
+	if q.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, q.cfg.Timeout)
+	}
+	querier, err := q.Queryable.Querier(pgxconn.WithQueryClass(ctx, pgxconn.ClassCold), mint, maxt)
+	if err != nil {
+		cancel()
+		q.release()
+		return nil, err
+	}
+	return &coldQuerier{Querier: querier, cancel: cancel, release: q.release}, nil
+}
+
+func (q *temperatureQueryable) release() {
+	if q.slots != nil {
+		<-q.slots
+	}
+}
+
+// coldQuerier frees the slot of its query when it is closed.
+type coldQuerier struct {
+	promql.Querier
+	cancel  context.CancelFunc
+	release func()
+}
+
+func (q *coldQuerier) Close() error {
+	err := q.Querier.Close()
+	q.cancel()
+	q.release()
+	return err
+}
@@ -0,0 +1,63 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+// classQueryable records the query class and deadline of its queriers.
+type classQueryable struct {
+	rangeQueryable
+	class       pgxconn.QueryClass
+	hasDeadline bool
+}
+
+func (q *classQueryable) Querier(ctx context.Context, mint, maxt int64) (promql.Querier, error) {
+	q.class = pgxconn.QueryClassFrom(ctx)
+	_, q.hasDeadline = ctx.Deadline()
+	return q.rangeQueryable.Querier(ctx, mint, maxt)
+}
+
+func TestTemperatureQueryable(t *testing.T) {
+	now := time.Unix(10000, 0)
+	recent := timestamp.FromTime(now.Add(-time.Minute))
+	old := timestamp.FromTime(now.Add(-2 * time.Hour))
+	inner := &classQueryable{}
+	queryable := NewTemperatureQueryable(inner, ColdQueryConfig{Age: time.Hour, Timeout: time.Minute, MaxConcurrent: 1}).(*temperatureQueryable)
+	queryable.now = func() time.Time { return now }
+
+	hot, err := queryable.Querier(context.Background(), recent, recent)
+	require.NoError(t, err)
+	require.Equal(t, pgxconn.ClassInteractive, inner.class)
+	require.False(t, inner.hasDeadline)
+
+	cold, err := queryable.Querier(context.Background(), old, recent)
+	require.NoError(t, err)
+	require.Equal(t, pgxconn.ClassCold, inner.class)
+	require.True(t, inner.hasDeadline)
+	require.Equal(t, old, inner.mint)
+
+	// The hot queries do not wait for the cold ones, unlike the cold ones.
+	_, err = queryable.Querier(context.Background(), recent, recent)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = queryable.Querier(ctx, old, recent)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, cold.Close())
+	cold, err = queryable.Querier(context.Background(), old, recent)
+	require.NoError(t, err)
+	require.NoError(t, cold.Close())
+	require.NoError(t, hot.Close())
+}
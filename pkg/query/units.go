@@ -0,0 +1,161 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	mq "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/units"
+)
+
+type unitKey struct{}
+
+// WithUnit returns a context in which the queries convert the values of the
+// selected metrics to the unit.
+func WithUnit(ctx context.Context, unit string) context.Context {
+	return context.WithValue(ctx, unitKey{}, unit)
+}
+
+func unitOf(ctx context.Context) string {
+	unit, _ := ctx.Value(unitKey{}).(string)
+	return unit
+}
+
+// UnitLookup returns the unit of the values of a metric, or "" if it is
+// unknown.
+type UnitLookup func(ctx context.Context, metric string) (string, error)
+
+// NewUnitQueryable returns a queryable that, when the context of the query
+// sets a unit with WithUnit, multiplies the values of the selected metrics
+// by the factor converting them from their unit, given by lookup or else by
+// the suffix of their name, to that unit. Each selected metric adds a warning
+// saying whether its values were converted.
+func NewUnitQueryable(q promql.Queryable, lookup UnitLookup) promql.Queryable {
+	return &unitQueryable{Queryable: q, lookup: lookup}
+}
+
+type unitQueryable struct {
+	promql.Queryable
+	lookup UnitLookup
+}
+
+func (q *unitQueryable) Querier(ctx context.Context, mint, maxt int64) (promql.Querier, error) {
+	querier, err := q.Queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	unit := unitOf(ctx)
+	if unit == "" {
+		return querier, nil
+	}
+	return &unitQuerier{Querier: querier, ctx: ctx, lookup: q.lookup, unit: unit, conversions: make(map[string]conversion)}, nil
+}
+
+// unitQuerier converts the values of the selected series to its unit.
+type unitQuerier struct {
+	promql.Querier
+	ctx    context.Context
+	lookup UnitLookup
+	unit   string
+	// conversions are the conversions of the metrics already selected, as a
+	// metric can be selected several times by a query but is looked up and
+	// warned about once.
+	conversions map[string]conversion
+}
+
+type conversion struct {
+	factor  float64
+	warning error
+}
+
+func (q *unitQuerier) Select(sortSeries bool, hints *storage.SelectHints, qh *mq.QueryHints, nodes []parser.Node, matchers ...*labels.Matcher) (storage.SeriesSet, parser.Node) {
+	ss, node := q.Querier.Select(sortSeries, hints, qh, nodes, matchers...)
+	metric := ""
+	for _, m := range matchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+			metric = m.Value
+		}
+	}
+	c, seen := q.conversions[metric]
+	if !seen {
+		c = q.convert(metric)
+		q.conversions[metric] = c
+	} else {
+		c.warning = nil
+	}
+	if c.factor == 1 && c.warning == nil {
+		return ss, node
+	}
+	return &unitSeriesSet{SeriesSet: ss, factor: c.factor, warning: c.warning}, node
+}
+
+// convert returns the factor converting the values of the metric, and the
+// warning saying whether they are converted.
+func (q *unitQuerier) convert(metric string) conversion {
+	if metric == "" {
+		return conversion{1, fmt.Errorf("values not converted to %s: the selector has no metric name", q.unit)}
+	}
+	unit, err := q.lookup(q.ctx, metric)
+	if err != nil {
+		return conversion{1, fmt.Errorf("values of %s not converted to %s: %w", metric, q.unit, err)}
+	}
+	if unit == "" {
+		unit = units.FromMetricName(metric)
+	}
+	if unit == "" {
+		return conversion{1, fmt.Errorf("values of %s not converted to %s: the metric has no unit", metric, q.unit)}
+	}
+	factor, err := units.Factor(unit, q.unit)
+	if err != nil {
+		return conversion{1, fmt.Errorf("values of %s not converted to %s: %w", metric, q.unit, err)}
+	}
+	return conversion{factor, fmt.Errorf("values of %s converted from %s to %s", metric, unit, q.unit)}
+}
+
+type unitSeriesSet struct {
+	storage.SeriesSet
+	factor  float64
+	warning error
+}
+
+func (s *unitSeriesSet) At() storage.Series {
+	if s.factor == 1 {
+		return s.SeriesSet.At()
+	}
+	return &unitSeries{Series: s.SeriesSet.At(), factor: s.factor}
+}
+
+func (s *unitSeriesSet) Warnings() storage.Warnings {
+	if s.warning == nil {
+		return s.SeriesSet.Warnings()
+	}
+	return append(s.SeriesSet.Warnings(), s.warning)
+}
+
+type unitSeries struct {
+	storage.Series
+	factor float64
+}
+
+func (s *unitSeries) Iterator() chunkenc.Iterator {
+	return &unitIterator{Iterator: s.Series.Iterator(), factor: s.factor}
+}
+
+type unitIterator struct {
+	chunkenc.Iterator
+	factor float64
+}
+
+func (it *unitIterator) At() (int64, float64) {
+	t, v := it.Iterator.At()
+	return t, v * it.factor
+}
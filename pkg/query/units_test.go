@@ -0,0 +1,151 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/require"
+	mq "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+type sample struct {
+	t int64
+	v float64
+}
+
+func (s sample) T() int64   { return s.t }
+func (s sample) V() float64 { return s.v }
+
+// metricQueryable returns one series with a sample of value 2 at 0 for each
+// selected metric.
+type metricQueryable struct{}
+
+func (q metricQueryable) Querier(context.Context, int64, int64) (promql.Querier, error) {
+	return q, nil
+}
+
+func (q metricQueryable) LabelValues(string) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+func (q metricQueryable) LabelNames() ([]string, storage.Warnings, error) { return nil, nil, nil }
+func (q metricQueryable) Close() error                                    { return nil }
+
+func (q metricQueryable) Select(_ bool, _ *storage.SelectHints, _ *mq.QueryHints, _ []parser.Node, matchers ...*labels.Matcher) (storage.SeriesSet, parser.Node) {
+	metric := ""
+	for _, m := range matchers {
+		if m.Name == labels.MetricName {
+			metric = m.Value
+		}
+	}
+	series := storage.NewListSeries(labels.FromStrings(labels.MetricName, metric), []tsdbutil.Sample{sample{0, 2}})
+	return &listSeriesSet{series: []storage.Series{series}, i: -1}, nil
+}
+
+type listSeriesSet struct {
+	series []storage.Series
+	i      int
+}
+
+func (s *listSeriesSet) Next() bool                 { s.i++; return s.i < len(s.series) }
+func (s *listSeriesSet) At() storage.Series         { return s.series[s.i] }
+func (s *listSeriesSet) Err() error                 { return nil }
+func (s *listSeriesSet) Warnings() storage.Warnings { return nil }
+
+func TestUnitQueryable(t *testing.T) {
+	lookups := 0
+	queryable := NewUnitQueryable(metricQueryable{}, func(_ context.Context, metric string) (string, error) {
+		lookups++
+		switch metric {
+		case "memory_usage":
+			return "bytes", nil
+		case "broken":
+			return "", fmt.Errorf("connection refused")
+		}
+		return "", nil
+	})
+	engine, err := NewEngine(log.NewNopLogger(), time.Minute, 5*time.Minute, time.Minute, 1000, nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		unit     string
+		query    string
+		value    float64
+		warnings []string
+	}{
+		{
+			name:  "no unit",
+			query: "memory_usage",
+			value: 2,
+		},
+		{
+			name:     "unit from the metadata",
+			unit:     "KiB",
+			query:    "memory_usage",
+			value:    2.0 / 1024,
+			warnings: []string{"values of memory_usage converted from bytes to KiB"},
+		},
+		{
+			name:     "unit from the name",
+			unit:     "ms",
+			query:    "request_duration_seconds_sum * 2 + request_duration_seconds_sum",
+			value:    6000,
+			warnings: []string{"values of request_duration_seconds_sum converted from seconds to ms"},
+		},
+		{
+			name:     "incompatible unit",
+			unit:     "ms",
+			query:    "memory_usage",
+			value:    2,
+			warnings: []string{"values of memory_usage not converted to ms: cannot convert bytes to ms"},
+		},
+		{
+			name:     "no unit known",
+			unit:     "ms",
+			query:    "up",
+			value:    2,
+			warnings: []string{"values of up not converted to ms: the metric has no unit"},
+		},
+		{
+			name:     "failed lookup",
+			unit:     "ms",
+			query:    "broken",
+			value:    2,
+			warnings: []string{"values of broken not converted to ms: connection refused"},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			if c.unit != "" {
+				ctx = WithUnit(ctx, c.unit)
+			}
+			qry, err := engine.NewInstantQuery(queryable, c.query, time.Unix(0, 0))
+			require.NoError(t, err)
+			res := qry.Exec(ctx)
+			require.NoError(t, res.Err)
+			vector, err := res.Vector()
+			require.NoError(t, err)
+			require.Len(t, vector, 1)
+			require.InDelta(t, c.value, vector[0].V, 1e-9)
+			var warnings []string
+			for _, w := range res.Warnings {
+				warnings = append(warnings, w.Error())
+			}
+			require.Equal(t, c.warnings, warnings)
+		})
+	}
+	require.Equal(t, 5, lookups, "the metrics are looked up once per query")
+}
@@ -6,6 +6,7 @@ package runner
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"sync/atomic"
@@ -14,10 +15,16 @@ import (
 	"github.com/jackc/pgx/v4"
 	"github.com/timescale/promscale/pkg/api"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pause"
 	"github.com/timescale/promscale/pkg/pgclient"
 	"github.com/timescale/promscale/pkg/pgmodel"
 	"github.com/timescale/promscale/pkg/pgmodel/common/extension"
 	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	deletePkg "github.com/timescale/promscale/pkg/pgmodel/delete"
+	"github.com/timescale/promscale/pkg/pgmodel/demo"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgmodel/slo"
+	"github.com/timescale/promscale/pkg/query"
 	"github.com/timescale/promscale/pkg/tenancy"
 	"github.com/timescale/promscale/pkg/util"
 	"github.com/timescale/promscale/pkg/version"
@@ -74,7 +81,11 @@ func CreateClient(cfg *Config, promMetrics *api.Metrics) (*pgclient.Client, erro
 		if !cfg.UseVersionLease {
 			lease = nil
 		}
-		err = SetupDBState(conn, appVersion, lease, extOptions)
+		if cfg.MigrateDownTo != "" {
+			err = DowngradeDBState(conn, cfg.MigrateDownTo, lease)
+		} else {
+			err = SetupDBState(conn, appVersion, lease, extOptions)
+		}
 		migrationFailedDueToLockError = err == migrationLockError
 		if err != nil && err != migrationLockError {
 			return nil, fmt.Errorf("migration error: %w", err)
@@ -163,12 +174,19 @@ func CreateClient(cfg *Config, promMetrics *api.Metrics) (*pgclient.Client, erro
 	}
 
 	multiTenancy := tenancy.NewNoopAuthorizer()
+	var tenantStore *tenancy.Store
 	if cfg.TenancyCfg.EnableMultiTenancy {
-		multiTenancyConfig := tenancy.NewAllowAllTenantsConfig(cfg.TenancyCfg.AllowNonMTWrites)
-		if !cfg.TenancyCfg.SkipTenantValidation {
-			multiTenancyConfig = tenancy.NewSelectiveTenancyConfig(cfg.TenancyCfg.ValidTenantsList, cfg.TenancyCfg.AllowNonMTWrites)
+		if cfg.TenancyCfg.UseCatalogTenants {
+			// The tenants are loaded once the client is created.
+			tenantStore = tenancy.NewStore()
+			multiTenancy, err = tenancy.NewCatalogAuthorizer(tenantStore, cfg.TenancyCfg.AllowNonMTWrites)
+		} else {
+			multiTenancyConfig := tenancy.NewAllowAllTenantsConfig(cfg.TenancyCfg.AllowNonMTWrites)
+			if !cfg.TenancyCfg.SkipTenantValidation {
+				multiTenancyConfig = tenancy.NewSelectiveTenancyConfig(cfg.TenancyCfg.ValidTenantsList, cfg.TenancyCfg.AllowNonMTWrites)
+			}
+			multiTenancy, err = tenancy.NewAuthorizer(multiTenancyConfig)
 		}
-		multiTenancy, err = tenancy.NewAuthorizer(multiTenancyConfig)
 		if err != nil {
 			return nil, fmt.Errorf("new tenancy: %w", err)
 		}
@@ -182,9 +200,77 @@ func CreateClient(cfg *Config, promMetrics *api.Metrics) (*pgclient.Client, erro
 		return nil, fmt.Errorf("client creation error: %w", err)
 	}
 
+	if tenantStore != nil {
+		if err = tenantStore.Start(client.Connection); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("tenant store: %w", err)
+		}
+		if !cfg.APICfg.ReadOnly {
+			tenantStore.StartPurges()
+		}
+		cfg.APICfg.Tenants = tenantStore
+	}
+
+	cfg.APICfg.LabelEncryptor = client.LabelEncryptor()
+	cfg.APICfg.NamingPolicy = client.NamingPolicy()
+	if !cfg.APICfg.ReadOnly {
+		cfg.APICfg.IngestPauses = pause.New(pause.Mode(cfg.APICfg.IngestPauseMode))
+	}
+
+	// Read-only connectors can report the purges, but not run them.
+	cfg.APICfg.Purger = deletePkg.NewPurger(client.Connection)
+	if !cfg.APICfg.ReadOnly {
+		cfg.APICfg.Purger.Start()
+	}
+
+	engine, err := query.NewEngine(log.GetLogger(), cfg.APICfg.MaxQueryTimeout, cfg.APICfg.LookBackDelta, cfg.APICfg.SubQueryStepInterval, cfg.APICfg.MaxSamples, cfg.APICfg.EnabledFeaturesList)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("creating the SLO query engine: %w", err)
+	}
+	cfg.APICfg.SLOs = slo.NewManager(client.Connection, engine, client.Queryable())
+	if !cfg.APICfg.ReadOnly && cfg.APICfg.SLOEvaluationInterval > 0 {
+		cfg.APICfg.SLOs.Start(client.Ingestor(), cfg.APICfg.SLOEvaluationInterval)
+	}
+
+	if cfg.APICfg.ResultsCacheCfg.MaxBytes > 0 {
+		resultsCache := query.NewResultsCache(cfg.APICfg.ResultsCacheCfg)
+		cfg.APICfg.ResultsCache = resultsCache
+		// The cached splits are only invalidated by the samples ingested and
+		// deleted by this connector, the others expire.
+		if !cfg.APICfg.ReadOnly {
+			ingestor.OnIngested(resultsCache.Ingested)
+		}
+		deletePkg.OnDeleted(resultsCache.Deleted)
+		tenancy.OnPurged(func(string) { resultsCache.Deleted(math.MinInt64, math.MaxInt64) })
+	}
+
+	if cfg.Demo {
+		provisionDemo(client)
+	}
+
 	return client, nil
 }
 
+// provisionDemo provisions the demo dataset if the database is empty, and
+// logs example queries over it. Failing to provision it does not prevent
+// the connector from starting.
+func provisionDemo(client *pgclient.Client) {
+	provisioned, err := demo.Provision(client.Connection, client.Ingestor(), time.Now())
+	if err != nil {
+		log.Error("msg", "error provisioning the demo dataset", "err", err)
+		return
+	}
+	if !provisioned {
+		log.Info("msg", "Skipping the demo dataset, the database already has metrics")
+		return
+	}
+	log.Info("msg", "Provisioned the demo dataset", "job", demo.Job, "history", demo.History)
+	for _, q := range demo.ExampleQueries {
+		log.Info("msg", "Example query over the demo dataset", "query", q)
+	}
+}
+
 func isTimescaleDBOSS(conn *pgx.Conn) (bool, error) {
 	var (
 		isTimescaleDB bool
@@ -264,25 +350,13 @@ func SetupDBState(conn *pgx.Conn, appVersion pgmodel.VersionInfo, leaseLock *uti
 	// then start the connector as normal. If we are on the wrong version, the
 	// normal version-check code will prevent us from running.
 
-	if leaseLock != nil {
-		locked, err := leaseLock.GetAdvisoryLock()
-		if err != nil {
-			return fmt.Errorf("error while acquiring migration lock %w", err)
-		}
-		if !locked {
-			return migrationLockError
-		}
-		defer func() {
-			_, err := leaseLock.Unlock()
-			if err != nil {
-				log.Error("msg", "error while releasing migration lock", "err", err)
-			}
-		}()
-	} else {
-		log.Warn("msg", "skipping migration lock")
+	unlock, err := acquireMigrationLock(leaseLock)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	err := pgmodel.Migrate(conn, appVersion, extOptions)
+	err = pgmodel.Migrate(conn, appVersion, extOptions)
 	if err != nil {
 		return fmt.Errorf("Error while trying to migrate DB: %w", err)
 	}
@@ -296,6 +370,45 @@ func SetupDBState(conn *pgx.Conn, appVersion pgmodel.VersionInfo, leaseLock *uti
 	return nil
 }
 
+// DowngradeDBState reverts the schema to an earlier version. Like upgrades, it
+// requires the migration lock so that no other connector is running.
+func DowngradeDBState(conn *pgx.Conn, toVersion string, leaseLock *util.PgAdvisoryLock) error {
+	unlock, err := acquireMigrationLock(leaseLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err = pgmodel.Downgrade(conn, toVersion); err != nil {
+		return fmt.Errorf("Error while trying to downgrade DB: %w", err)
+	}
+	log.Info("msg", "Schema downgraded, start the connector of the older version with migration enabled to reinstall its functions", "version", toVersion)
+	return nil
+}
+
+// acquireMigrationLock takes the exclusive schema-version lock, returning
+// migrationLockError if another connector holds it, and the function
+// releasing it.
+func acquireMigrationLock(leaseLock *util.PgAdvisoryLock) (func(), error) {
+	if leaseLock == nil {
+		log.Warn("msg", "skipping migration lock")
+		return func() {}, nil
+	}
+	locked, err := leaseLock.GetAdvisoryLock()
+	if err != nil {
+		return nil, fmt.Errorf("error while acquiring migration lock %w", err)
+	}
+	if !locked {
+		return nil, migrationLockError
+	}
+	return func() {
+		_, err := leaseLock.Unlock()
+		if err != nil {
+			log.Error("msg", "error while releasing migration lock", "err", err)
+		}
+	}, nil
+}
+
 func compileAnchoredRegexString(s string) (*regexp.Regexp, error) {
 	r, err := regexp.Compile("^(?:" + s + ")$")
 	if err != nil {
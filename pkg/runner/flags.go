@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/peterbourgon/ff/v3"
 	"github.com/peterbourgon/ff/v3/ffyaml"
 	"github.com/timescale/promscale/pkg/api"
@@ -21,9 +22,14 @@ import (
 	"github.com/timescale/promscale/pkg/util"
 )
 
+// downToMigrateOption prefixes the version the schema is migrated down to.
+const downToMigrateOption = "down-to="
+
 type Config struct {
 	ListenAddr                  string
+	InternalListenAddr          string
 	ThanosStoreAPIListenAddr    string
+	CatalogListenAddr           string
 	PgmodelCfg                  pgclient.Config
 	LogCfg                      log.Config
 	APICfg                      api.Config
@@ -32,6 +38,8 @@ type Config struct {
 	ConfigFile                  string
 	TLSCertFile                 string
 	TLSKeyFile                  string
+	InternalTLSCertFile         string
+	InternalTLSKeyFile          string
 	HaGroupLockID               int64
 	ThroughputInterval          time.Duration
 	PrometheusTimeout           time.Duration
@@ -39,10 +47,13 @@ type Config struct {
 	AsyncAcks                   bool
 	Migrate                     bool
 	StopAfterMigrate            bool
+	MigrateDownTo               string
 	UseVersionLease             bool
 	InstallExtensions           bool
 	UpgradeExtensions           bool
 	UpgradePrereleaseExtensions bool
+	Demo                        bool
+	PreflightMaxDbSize          int64
 }
 
 func ParseFlags(cfg *Config, args []string) (*Config, error) {
@@ -60,21 +71,35 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 	tenancy.ParseFlags(fs, &cfg.TenancyCfg)
 
 	fs.StringVar(&cfg.ConfigFile, "config", "config.yml", "YAML configuration file path for Promscale.")
-	fs.StringVar(&cfg.ListenAddr, "web-listen-address", ":9201", "Address to listen on for web endpoints.")
-	fs.StringVar(&cfg.ThanosStoreAPIListenAddr, "thanos-store-api-listen-address", "", "Address to listen on for Thanos Store API endpoints.")
+	fs.StringVar(&cfg.ListenAddr, "web-listen-address", ":9201", "Address to listen on for web endpoints. "+
+		"Use 'unix:<path>' to listen on a unix domain socket, or 'systemd' ('systemd:<index>' for the n-th socket) to use a socket passed by systemd socket activation.")
+	fs.StringVar(&cfg.InternalListenAddr, "web-internal-listen-address", "", "Address to listen on for the admin, status, telemetry and debug endpoints. Supports the same formats as web-listen-address. "+
+		"If set, these endpoints are no longer served on web-listen-address, which only serves the write, read and query endpoints along with the build and runtime information. Disabled by default.")
+	fs.StringVar(&cfg.ThanosStoreAPIListenAddr, "thanos-store-api-listen-address", "", "Address to listen on for Thanos Store API endpoints. Supports the same formats as web-listen-address.")
+	fs.StringVar(&cfg.CatalogListenAddr, "catalog-service-listen-address", "", "Address to listen on for the catalog service, through which the connectors setting "+
+		"catalog-service-addresses have their series created by a single connector. The connectors listening for it elect the one serving it. "+
+		"Supports the same formats as web-listen-address, but a TCP address without a host only listens on the loopback interface, "+
+		"and listening on another host requires catalog-service-token or catalog-service-tls-cert-file. Disabled by default.")
 	fs.StringVar(&corsOriginFlag, "web-cors-origin", ".*", `Regex for CORS origin. It is fully anchored. Example: 'https?://(domain1|domain2)\.com'`)
 	fs.Int64Var(&cfg.HaGroupLockID, "leader-election-pg-advisory-lock-id", 0, "(DEPRECATED) Leader-election based high-availability. It is based on PostgreSQL advisory lock and requires a unique advisory lock ID per high-availability group. Only a single connector in each high-availability group will write data at one time. A value of 0 disables leader election.")
 	fs.DurationVar(&cfg.ThroughputInterval, "tput-report", time.Second, "Duration interval at which throughput should be reported. Setting duration to `0` will disable reporting throughput, otherwise, an interval with unit must be provided, e.g. `10s` or `3m`.")
 	fs.DurationVar(&cfg.PrometheusTimeout, "leader-election-pg-advisory-lock-prometheus-timeout", -1, "(DEPRECATED) Prometheus timeout duration for leader-election high-availability. The connector will resign if the associated Prometheus instance does not respond within the given timeout. This value should be a low multiple of the Prometheus scrape interval, big enough to prevent random flips.")
 	fs.DurationVar(&cfg.ElectionInterval, "leader-election-scheduled-interval", 5*time.Second, "(DEPRECATED) Interval at which scheduled election runs. This is used to select a leader and confirm that we still holding the advisory lock.")
-	fs.StringVar(&migrateOption, "migrate", "true", "Update the Prometheus SQL schema to the latest version. Valid options are: [true, false, only].")
+	fs.StringVar(&migrateOption, "migrate", "true", "Update the Prometheus SQL schema to the latest version. Valid options are: [true, false, only, down-to=<version>]. "+
+		"'down-to=<version>' reverts the schema to an earlier version with its down-migrations and exits, to roll back an upgrade.")
 	fs.BoolVar(&cfg.UseVersionLease, "use-schema-version-lease", true, "Use schema version lease to prevent race conditions during migration.")
 	fs.BoolVar(&cfg.InstallExtensions, "install-extensions", true, "Install TimescaleDB, Promscale extension.")
 	fs.BoolVar(&cfg.UpgradeExtensions, "upgrade-extensions", true, "Upgrades TimescaleDB, Promscale extensions.")
 	fs.BoolVar(&cfg.AsyncAcks, "async-acks", false, "Acknowledge asynchronous inserts. If this is true, the inserter will not wait after insertion of metric data in the database. This increases throughput at the cost of a small chance of data loss.")
 	fs.BoolVar(&cfg.UpgradePrereleaseExtensions, "upgrade-prerelease-extensions", false, "Upgrades to pre-release TimescaleDB, Promscale extensions.")
+	fs.BoolVar(&cfg.Demo, "demo", false, "Provision a small synthetic dataset of a few metrics over the last 6 hours on startup, if the database has no metric yet, "+
+		"so that the query APIs can be tried without a Prometheus sending samples. Not supported in read-only mode.")
+	fs.Int64Var(&cfg.PreflightMaxDbSize, "preflight-max-db-size", 0, "Size in bytes of the database above which the disk check of the preflight command fails, "+
+		"e.g. the size of the disk of the database less a margin for the growth expected before the next check. The check warns above 80% of it. 0 to skip the check.")
 	fs.StringVar(&cfg.TLSCertFile, "tls-cert-file", "", "TLS Certificate file for web server, leave blank to disable TLS.")
 	fs.StringVar(&cfg.TLSKeyFile, "tls-key-file", "", "TLS Key file for web server, leave blank to disable TLS.")
+	fs.StringVar(&cfg.InternalTLSCertFile, "internal-tls-cert-file", "", "TLS Certificate file for the web server listening on web-internal-listen-address, leave blank to disable TLS.")
+	fs.StringVar(&cfg.InternalTLSKeyFile, "internal-tls-key-file", "", "TLS Key file for the web server listening on web-internal-listen-address, leave blank to disable TLS.")
 
 	if err := util.ParseEnv("PROMSCALE", fs); err != nil {
 		return nil, fmt.Errorf("error parsing env variables: %w", err)
@@ -99,6 +124,14 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 	if (cfg.TLSCertFile != "") != (cfg.TLSKeyFile != "") {
 		return nil, fmt.Errorf("both TLS Ceriticate File and TLS Key File need to be provided for a valid TLS configuration")
 	}
+	if (cfg.InternalTLSCertFile != "") != (cfg.InternalTLSKeyFile != "") {
+		return nil, fmt.Errorf("both internal TLS Certificate File and internal TLS Key File need to be provided for a valid TLS configuration")
+	}
+	if cfg.InternalListenAddr == "" && cfg.InternalTLSCertFile != "" {
+		return nil, fmt.Errorf("internal TLS files require web-internal-listen-address to be set")
+	}
+
+	cfg.APICfg.Flags = flagValues(fs)
 
 	corsOriginRegex, err := compileAnchoredRegexString(corsOriginFlag)
 	if err != nil {
@@ -118,8 +151,15 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 	} else if strings.EqualFold(migrateOption, "only") {
 		cfg.Migrate = true
 		cfg.StopAfterMigrate = true
+	} else if strings.HasPrefix(strings.ToLower(migrateOption), downToMigrateOption) {
+		cfg.MigrateDownTo = migrateOption[len(downToMigrateOption):]
+		if _, err := semver.Make(cfg.MigrateDownTo); err != nil {
+			return nil, fmt.Errorf("Invalid version to migrate down to: %v: %w", cfg.MigrateDownTo, err)
+		}
+		cfg.Migrate = true
+		cfg.StopAfterMigrate = true
 	} else {
-		return nil, fmt.Errorf("Invalid option for migrate: %v. Valid options are [true, false, only]", migrateOption)
+		return nil, fmt.Errorf("Invalid option for migrate: %v. Valid options are [true, false, only, down-to=<version>]", migrateOption)
 	}
 
 	if cfg.APICfg.ReadOnly {
@@ -131,16 +171,46 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 		if flagset["leader-election-pg-advisory-lock-id"] && cfg.HaGroupLockID != 0 {
 			return nil, fmt.Errorf("Invalid option for HA group lock ID, cannot enable HA mode and read-only mode")
 		}
+		if cfg.CatalogListenAddr != "" {
+			return nil, fmt.Errorf("Cannot serve the catalog service in read-only mode")
+		}
+		if cfg.Demo {
+			return nil, fmt.Errorf("Cannot provision the demo dataset in read-only mode")
+		}
 		if flagset["install-extensions"] && cfg.InstallExtensions {
 			return nil, fmt.Errorf("Cannot install or update TimescaleDB extension in read-only mode")
 		}
 		cfg.Migrate = false
 		cfg.StopAfterMigrate = false
+		cfg.MigrateDownTo = ""
 		cfg.UseVersionLease = false
 		cfg.InstallExtensions = false
 		cfg.UpgradeExtensions = false
 	}
 
+	if cfg.PgmodelCfg.PoolerMode {
+		// The connections of a transaction pooler are handed to another
+		// client after each transaction, releasing nothing the session held.
+		flagset := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
+		if flagset["use-schema-version-lease"] && cfg.UseVersionLease {
+			return nil, fmt.Errorf("Cannot use the schema version lease in pooler mode")
+		}
+		if cfg.HaGroupLockID != 0 {
+			return nil, fmt.Errorf("Cannot use leader election based on advisory locks in pooler mode")
+		}
+		if cfg.CatalogListenAddr != "" {
+			return nil, fmt.Errorf("Cannot serve the catalog service in pooler mode")
+		}
+		cfg.UseVersionLease = false
+	}
+
+	if cfg.CatalogListenAddr != "" {
+		if cfg.CatalogListenAddr, err = catalogListenAddress(cfg.CatalogListenAddr, cfg.PgmodelCfg.Catalog.Secured()); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.HaGroupLockID != 0 {
 		log.Warn("msg", "leader-election-pg-advisory-lock-id is set. Scheduled election is DEPRECATED!")
 		cfg.PgmodelCfg.UsesHA = true
@@ -148,6 +218,34 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 	return cfg, nil
 }
 
+// secretFlags are the flags whose values are not reported by the flags
+// status endpoint. The flags holding the paths of secret files are reported.
+var secretFlags = map[string]bool{
+	"auth-password":            true,
+	"bearer-token":             true,
+	"internal-auth-password":   true,
+	"internal-bearer-token":    true,
+	"db-password":              true,
+	"db-uri":                   true,
+	"db-mirror-uri":            true,
+	"forward-remote-write-url": true,
+	"catalog-service-token":    true,
+}
+
+// flagValues returns the values of all the flags, with the set secrets
+// redacted.
+func flagValues(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "<secret>"
+		}
+		values[f.Name] = value
+	})
+	return values
+}
+
 func validate(cfg *Config) error {
 	if err := api.Validate(&cfg.APICfg); err != nil {
 		return fmt.Errorf("error validating API configuration: %w", err)
@@ -71,6 +71,21 @@ func TestParseFlags(t *testing.T) {
 			args:        []string{"-migrate", "invalid"},
 			shouldError: true,
 		},
+		{
+			name: "Migrate down",
+			args: []string{"-migrate", "down-to=0.5.2-dev.1"},
+			result: func(c Config) Config {
+				c.Migrate = true
+				c.StopAfterMigrate = true
+				c.MigrateDownTo = "0.5.2-dev.1"
+				return c
+			},
+		},
+		{
+			name:        "Invalid migrate down version",
+			args:        []string{"-migrate", "down-to=latest"},
+			shouldError: true,
+		},
 		{
 			name: "Read-only mode",
 			args: []string{"-read-only"},
@@ -113,6 +128,31 @@ func TestParseFlags(t *testing.T) {
 			},
 			shouldError: true,
 		},
+		{
+			name: "Pooler mode",
+			args: []string{"-db-pooler-mode"},
+			result: func(c Config) Config {
+				c.PgmodelCfg.PoolerMode = true
+				c.UseVersionLease = false
+				return c
+			},
+		},
+		{
+			name: "Running HA and pooler mode error",
+			args: []string{
+				"-leader-election-pg-advisory-lock-id", "1",
+				"-db-pooler-mode",
+			},
+			shouldError: true,
+		},
+		{
+			name: "Running schema version lease and pooler mode error",
+			args: []string{
+				"-use-schema-version-lease",
+				"-db-pooler-mode",
+			},
+			shouldError: true,
+		},
 		{
 			name: "invalid TLS setup, missing key file",
 			args: []string{
@@ -134,6 +174,30 @@ func TestParseFlags(t *testing.T) {
 			},
 			shouldError: true,
 		},
+		{
+			name: "invalid internal TLS setup, missing internal listen address",
+			args: []string{
+				"-internal-tls-cert-file", "foo",
+				"-internal-tls-key-file", "foo",
+			},
+			shouldError: true,
+		},
+		{
+			name: "invalid internal auth setup",
+			args: []string{
+				"-web-internal-listen-address", ":9202",
+				"-internal-auth-username", "foo",
+			},
+			shouldError: true,
+		},
+		{
+			name: "internal listen address",
+			args: []string{"-web-internal-listen-address", ":9202"},
+			result: func(c Config) Config {
+				c.InternalListenAddr = ":9202"
+				return c
+			},
+		},
 		{
 			name: "invalid env variable type causing parse error, PROMSCALE prefix",
 			env: map[string]string{
@@ -170,6 +234,8 @@ func TestParseFlags(t *testing.T) {
 			}
 
 			expected := c.result(*defaultConfig)
+			// The reported flag values are checked in TestFlagValues.
+			expected.APICfg.Flags, config.APICfg.Flags = nil, nil
 			if !reflect.DeepEqual(*config, expected) {
 				t.Fatalf("Unexpected config returned\nwanted:\n%+v\ngot:\n%+v\n", expected, *config)
 			}
@@ -307,6 +373,7 @@ func TestParseFlagsConfigPrecedence(t *testing.T) {
 			if configFilePath != "" {
 				expected.ConfigFile = configFilePath
 			}
+			expected.APICfg.Flags, config.APICfg.Flags = nil, nil
 
 			if !reflect.DeepEqual(*config, expected) {
 				t.Fatalf("Unexpected config returned\nwanted:\n%+v\ngot:\n%+v\n", expected, *config)
@@ -314,3 +381,29 @@ func TestParseFlagsConfigPrecedence(t *testing.T) {
 		})
 	}
 }
+
+func TestFlagValues(t *testing.T) {
+	os.Clearenv()
+	config, err := ParseFlags(&Config{}, []string{
+		"-db-password", "hunter2",
+		"-tls-cert-file", "/etc/promscale/tls.crt",
+		"-tls-key-file", "/etc/promscale/tls.key",
+		"-web-listen-address", "localhost:9201",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"db-password":        "<secret>",
+		"auth-password":      "",
+		"tls-key-file":       "/etc/promscale/tls.key",
+		"web-listen-address": "localhost:9201",
+		"migrate":            "true",
+	}
+	for name, value := range expected {
+		if got, ok := config.APICfg.Flags[name]; !ok || got != value {
+			t.Errorf("unexpected value for flag %s: wanted %q, got %q", name, value, got)
+		}
+	}
+}
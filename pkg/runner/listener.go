@@ -0,0 +1,105 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+package runner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	unixSocketPrefix = "unix:"
+	systemdPrefix    = "systemd"
+	// systemdListenFdsStart is the first file descriptor passed by systemd
+	// socket activation, see sd_listen_fds(3).
+	systemdListenFdsStart = 3
+)
+
+// listen creates a listener for a web listen address. Besides TCP addresses,
+// it supports `unix:<path>` for unix domain sockets and `systemd` or
+// `systemd:<index>` for sockets passed by systemd socket activation.
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixSocketPrefix):
+		return listenUnix(strings.TrimPrefix(addr, unixSocketPrefix))
+	case addr == systemdPrefix || strings.HasPrefix(addr, systemdPrefix+":"):
+		idx := 0
+		if addr != systemdPrefix {
+			var err error
+			idx, err = strconv.Atoi(strings.TrimPrefix(addr, systemdPrefix+":"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid systemd socket index in %q: %w", addr, err)
+			}
+		}
+		return listenSystemd(idx)
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// catalogListenAddress returns the address to listen on for the catalog
+// service. A TCP address without a host listens on the loopback interface.
+// Any other host requires the service to be secured, since its calls create
+// series.
+func catalogListenAddress(addr string, secured bool) (string, error) {
+	if strings.HasPrefix(addr, unixSocketPrefix) || addr == systemdPrefix || strings.HasPrefix(addr, systemdPrefix+":") {
+		return addr, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid catalog service listen address %q: %w", addr, err)
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) || secured {
+		return addr, nil
+	}
+	return "", fmt.Errorf("listening for the catalog service on %s requires catalog-service-token or catalog-service-tls-cert-file", host)
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	// A socket file left behind by a previous run would make listening fail.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale unix socket %s: %w", path, err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+func listenSystemd(idx int) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets passed by systemd socket activation")
+	}
+	numFds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %w", err)
+	}
+	if idx < 0 || idx >= numFds {
+		return nil, fmt.Errorf("systemd socket %d requested but only %d sockets were passed", idx, numFds)
+	}
+	fd := uintptr(systemdListenFdsStart + idx)
+	f := os.NewFile(fd, "systemd-socket-"+strconv.Itoa(idx))
+	defer f.Close()
+	// net.FileListener duplicates the descriptor, so f can be closed.
+	return net.FileListener(f)
+}
+
+func listenAndServe(addr, certFile, keyFile string, handler http.Handler) error {
+	listener, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler}
+	if certFile != "" {
+		return server.ServeTLS(listener, certFile, keyFile)
+	}
+	return server.Serve(listener)
+}
@@ -0,0 +1,74 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "promscale-listener")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "promscale.sock")
+
+	l, err := listen("unix:" + path)
+	require.NoError(t, err)
+	require.Equal(t, "unix", l.Addr().Network())
+
+	// Listening again must replace the existing socket file.
+	l2, err := listen("unix:" + path)
+	require.NoError(t, err)
+	require.NoError(t, l2.Close())
+	_ = l.Close()
+}
+
+func TestListenSystemd(t *testing.T) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	_, err := listen("systemd")
+	require.Error(t, err, "no sockets were passed")
+
+	require.NoError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())))
+	require.NoError(t, os.Setenv("LISTEN_FDS", "1"))
+	_, err = listen("systemd:1")
+	require.Error(t, err, "socket index out of range")
+	_, err = listen("systemd:foo")
+	require.Error(t, err)
+}
+
+func TestCatalogListenAddress(t *testing.T) {
+	testCases := []struct {
+		addr     string
+		secured  bool
+		expected string
+		err      bool
+	}{
+		{addr: ":9203", expected: "127.0.0.1:9203"},
+		{addr: "localhost:9203", expected: "localhost:9203"},
+		{addr: "[::1]:9203", expected: "[::1]:9203"},
+		{addr: "10.0.0.1:9203", err: true},
+		{addr: "0.0.0.0:9203", err: true},
+		{addr: "0.0.0.0:9203", secured: true, expected: "0.0.0.0:9203"},
+		{addr: "unix:/run/promscale.sock", expected: "unix:/run/promscale.sock"},
+		{addr: "systemd:1", expected: "systemd:1"},
+		{addr: "9203", err: true},
+	}
+	for _, c := range testCases {
+		addr, err := catalogListenAddress(c.addr, c.secured)
+		if c.err {
+			require.Error(t, err, c.addr)
+			continue
+		}
+		require.NoError(t, err, c.addr)
+		require.Equal(t, c.expected, addr)
+	}
+}
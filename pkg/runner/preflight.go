@@ -0,0 +1,321 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/jackc/pgx/v4"
+	"github.com/timescale/promscale/pkg/pgmodel"
+	"github.com/timescale/promscale/pkg/pgmodel/common/extension"
+	"github.com/timescale/promscale/pkg/version"
+)
+
+// PreflightCommand is the first argument that makes promscale run the
+// preflight checks instead of starting the connector.
+const PreflightCommand = "preflight"
+
+type PreflightStatus string
+
+const (
+	PreflightOK   PreflightStatus = "ok"
+	PreflightWarn PreflightStatus = "warn"
+	PreflightFail PreflightStatus = "fail"
+	PreflightSkip PreflightStatus = "skip"
+)
+
+// PreflightCheck is the result of a single preflight check.
+type PreflightCheck struct {
+	Name    string          `json:"name"`
+	Status  PreflightStatus `json:"status"`
+	Message string          `json:"message"`
+}
+
+// PreflightReport contains the results of all preflight checks.
+type PreflightReport struct {
+	Version    string           `json:"version"`
+	CommitHash string           `json:"commit_hash"`
+	Passed     bool             `json:"passed"`
+	Checks     []PreflightCheck `json:"checks"`
+}
+
+func (r *PreflightReport) add(name string, status PreflightStatus, format string, args ...interface{}) {
+	if status == PreflightFail {
+		r.Passed = false
+	}
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// WriteText writes the report in a human-readable form.
+func (r *PreflightReport) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Promscale %s preflight checks\n\n", r.Version); err != nil {
+		return err
+	}
+	for _, c := range r.Checks {
+		if _, err := fmt.Fprintf(w, "[%-4s] %-20s %s\n", strings.ToUpper(string(c.Status)), c.Name, c.Message); err != nil {
+			return err
+		}
+	}
+	result := "PASSED"
+	if !r.Passed {
+		result = "FAILED"
+	}
+	_, err := fmt.Fprintf(w, "\nPreflight %s\n", result)
+	return err
+}
+
+// WriteJSON writes the report as JSON.
+func (r *PreflightReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ParsePreflightArgs checks if the args invoke the preflight command. If so,
+// it returns the remaining args, stripped of the preflight-only -json flag.
+func ParsePreflightArgs(args []string) (isPreflight bool, rest []string, jsonOutput bool) {
+	if len(args) == 0 || args[0] != PreflightCommand {
+		return false, args, false
+	}
+	for _, arg := range args[1:] {
+		if arg == "-json" || arg == "--json" {
+			jsonOutput = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return true, rest, jsonOutput
+}
+
+// Preflight validates the configuration and the database it points to, without
+// changing anything, so that problems can be found before a production rollout.
+func Preflight(cfg *Config) *PreflightReport {
+	report := &PreflightReport{
+		Version:    version.Promscale,
+		CommitHash: version.CommitHash,
+		Passed:     true,
+	}
+	checkFlags(cfg, report)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.PgmodelCfg.DbConnectionTimeout)
+	defer cancel()
+	connStr := cfg.PgmodelCfg.GetConnectionStr()
+	conn, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		report.add("connection", PreflightFail, "could not connect to the database: %v", err)
+		for _, name := range []string{"postgres version", "timescaledb", "promscale extension", "schema version", "privileges", "disk"} {
+			report.add(name, PreflightSkip, "no database connection")
+		}
+		return report
+	}
+	defer func() { _ = conn.Close(context.Background()) }()
+	report.add("connection", PreflightOK, "connected to the database")
+
+	if err := extension.CheckPgVersion(conn); err != nil {
+		report.add("postgres version", PreflightFail, "%v", err)
+	} else {
+		report.add("postgres version", PreflightOK, "supported version %s", version.PgVersionNumRange)
+	}
+	checkTimescaleDB(conn, cfg, report)
+	checkPromscaleExtension(conn, cfg, report)
+	checkSchema(conn, cfg, report)
+	checkPrivileges(conn, cfg, report)
+	checkDisk(conn, cfg, report)
+	return report
+}
+
+func checkFlags(cfg *Config, report *PreflightReport) {
+	// ParseFlags has already validated each flag on its own, we only check
+	// combinations of flags here.
+	consistent := true
+	if cfg.APICfg.HighAvailability && cfg.HaGroupLockID != 0 {
+		report.add("flags", PreflightFail, "-high-availability and -leader-election-pg-advisory-lock-id enable two different HA modes, use only one of them")
+		consistent = false
+	}
+	if cfg.APICfg.ReadOnly && cfg.PgmodelCfg.MirrorDbUri != "" {
+		report.add("flags", PreflightWarn, "-db-mirror-uri is ignored in read-only mode")
+		consistent = false
+	}
+	if cfg.APICfg.ReadOnly && cfg.PgmodelCfg.Forward.URL != "" {
+		report.add("flags", PreflightWarn, "-forward-remote-write-url is ignored in read-only mode")
+		consistent = false
+	}
+	if cfg.PgmodelCfg.MaxConnections > 0 && cfg.PgmodelCfg.MaxConnections <= runtime.GOMAXPROCS(-1) {
+		report.add("flags", PreflightWarn, "-db-connections-max %d is too low for %d procs, the number of write connections will be reduced",
+			cfg.PgmodelCfg.MaxConnections, runtime.GOMAXPROCS(-1))
+		consistent = false
+	}
+	for _, file := range []string{cfg.TLSCertFile, cfg.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			report.add("flags", PreflightFail, "cannot access TLS file: %v", err)
+			consistent = false
+		}
+	}
+	if consistent {
+		report.add("flags", PreflightOK, "configuration is consistent")
+	}
+}
+
+// extensionVersions returns the installed and the default available version
+// of an extension, or nil if it is not installed or not available.
+func extensionVersions(conn *pgx.Conn, name string) (installed, available *string, err error) {
+	err = conn.QueryRow(context.Background(),
+		`SELECT
+			(SELECT extversion FROM pg_catalog.pg_extension WHERE extname = $1),
+			(SELECT default_version FROM pg_catalog.pg_available_extensions WHERE name = $1)`,
+		name).Scan(&installed, &available)
+	return
+}
+
+func checkTimescaleDB(conn *pgx.Conn, cfg *Config, report *PreflightReport) {
+	const name = "timescaledb"
+	installed, available, err := extensionVersions(conn, name)
+	switch {
+	case err != nil:
+		report.add(name, PreflightFail, "could not fetch extension versions: %v", err)
+	case installed != nil:
+		v, err := semver.Parse(*installed)
+		if err != nil {
+			report.add(name, PreflightFail, "could not parse installed version %q: %v", *installed, err)
+			return
+		}
+		switch version.VerifyTimescaleVersion(v) {
+		case version.Safe:
+			report.add(name, PreflightOK, "version %s installed", v)
+		case version.Warn:
+			report.add(name, PreflightWarn, "version %s installed, expected %s", v, version.TimescaleVersionRangeString.Safe)
+		default:
+			report.add(name, PreflightFail, "incompatible version %s installed, expected %s", v, version.TimescaleVersionRangeString.Safe)
+		}
+	case available != nil && cfg.InstallExtensions:
+		report.add(name, PreflightOK, "version %s will be installed at startup", *available)
+	case available != nil:
+		report.add(name, PreflightWarn, "not installed and -install-extensions is disabled, some features will be disabled")
+	default:
+		report.add(name, PreflightWarn, "not available in the database, some features will be disabled")
+	}
+}
+
+func checkPromscaleExtension(conn *pgx.Conn, cfg *Config, report *PreflightReport) {
+	const name = "promscale extension"
+	installed, available, err := extensionVersions(conn, "promscale")
+	switch {
+	case err != nil:
+		report.add(name, PreflightFail, "could not fetch extension versions: %v", err)
+	case installed != nil:
+		v, err := semver.Parse(*installed)
+		if err != nil || !version.ExtVersionRange(v) {
+			report.add(name, PreflightWarn, "installed version %s is not in the supported range %s, it will not be used", *installed, version.ExtVersionRangeString)
+			return
+		}
+		report.add(name, PreflightOK, "version %s installed", v)
+	case available != nil && cfg.InstallExtensions:
+		report.add(name, PreflightOK, "version %s will be installed at startup", *available)
+	default:
+		report.add(name, PreflightWarn, "not installed, queries will not use the extension's optimizations")
+	}
+}
+
+func checkSchema(conn *pgx.Conn, cfg *Config, report *PreflightReport) {
+	const name = "schema version"
+	err := pgmodel.CheckSchemaVersion(context.Background(), conn, appVersion, false)
+	switch {
+	case cfg.MigrateDownTo != "":
+		report.add(name, PreflightOK, "schema will be downgraded to version %s", cfg.MigrateDownTo)
+	case err == nil:
+		report.add(name, PreflightOK, "schema is compatible with version %s", appVersion.Version)
+	case cfg.Migrate:
+		report.add(name, PreflightOK, "schema will be migrated to version %s at startup", appVersion.Version)
+	default:
+		report.add(name, PreflightFail, "%v, and migrations are disabled", err)
+	}
+}
+
+func checkPrivileges(conn *pgx.Conn, cfg *Config, report *PreflightReport) {
+	const name = "privileges"
+	var (
+		user      string
+		superuser bool
+		canCreate bool
+	)
+	err := conn.QueryRow(context.Background(),
+		`SELECT current_user, rolsuper, has_database_privilege(current_user, current_database(), 'CREATE')
+		 FROM pg_catalog.pg_roles WHERE rolname = current_user`).Scan(&user, &superuser, &canCreate)
+	if err != nil {
+		report.add(name, PreflightFail, "could not fetch role privileges: %v", err)
+		return
+	}
+	if superuser {
+		report.add(name, PreflightOK, "%s is a superuser", user)
+		return
+	}
+	if cfg.Migrate || cfg.InstallExtensions {
+		if !canCreate {
+			report.add(name, PreflightFail, "%s cannot create objects in the database, which migrations require", user)
+			return
+		}
+		report.add(name, PreflightWarn, "%s is not a superuser, installing or upgrading extensions may fail", user)
+		return
+	}
+
+	role := "prom_writer"
+	if cfg.APICfg.ReadOnly {
+		role = "prom_reader"
+	}
+	var isMember bool
+	err = conn.QueryRow(context.Background(),
+		`SELECT CASE WHEN EXISTS (SELECT 1 FROM pg_catalog.pg_roles WHERE rolname = $1)
+		 THEN pg_has_role(current_user, $1, 'MEMBER') ELSE false END`, role).Scan(&isMember)
+	switch {
+	case err != nil:
+		report.add(name, PreflightFail, "could not check membership in %s: %v", role, err)
+	case !isMember:
+		report.add(name, PreflightFail, "%s is not a member of %s", user, role)
+	default:
+		report.add(name, PreflightOK, "%s is a member of %s", user, role)
+	}
+}
+
+func checkDisk(conn *pgx.Conn, cfg *Config, report *PreflightReport) {
+	const name = "disk"
+	if cfg.PreflightMaxDbSize <= 0 {
+		report.add(name, PreflightSkip, "no maximum database size set with -preflight-max-db-size")
+		return
+	}
+	var size int64
+	err := conn.QueryRow(context.Background(), "SELECT pg_catalog.pg_database_size(current_database())").Scan(&size)
+	if err != nil {
+		report.add(name, PreflightFail, "could not fetch database size: %v", err)
+		return
+	}
+	status, format := diskStatus(size, cfg.PreflightMaxDbSize)
+	report.add(name, status, format, size, cfg.PreflightMaxDbSize)
+}
+
+// diskWarnRatio is the share of the maximum database size above which the
+// disk check warns.
+const diskWarnRatio = 0.8
+
+// diskStatus returns the status of the disk check for a database of size
+// bytes, and the format of its message taking the size and the maximum.
+func diskStatus(size, maxSize int64) (PreflightStatus, string) {
+	switch {
+	case size > maxSize:
+		return PreflightFail, "database size of %d bytes exceeds the maximum of %d bytes"
+	case float64(size) > diskWarnRatio*float64(maxSize):
+		return PreflightWarn, "database size of %d bytes is close to the maximum of %d bytes"
+	default:
+		return PreflightOK, "database size of %d bytes is within the maximum of %d bytes"
+	}
+}
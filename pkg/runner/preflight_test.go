@@ -0,0 +1,61 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePreflightArgs(t *testing.T) {
+	isPreflight, rest, jsonOutput := ParsePreflightArgs([]string{"-db-name", "foo"})
+	require.False(t, isPreflight)
+	require.False(t, jsonOutput)
+	require.Equal(t, []string{"-db-name", "foo"}, rest)
+
+	isPreflight, rest, jsonOutput = ParsePreflightArgs([]string{"preflight", "-json", "-db-name", "foo"})
+	require.True(t, isPreflight)
+	require.True(t, jsonOutput)
+	require.Equal(t, []string{"-db-name", "foo"}, rest)
+}
+
+func TestPreflightCheckFlags(t *testing.T) {
+	cfg := &Config{}
+	report := &PreflightReport{Passed: true}
+	checkFlags(cfg, report)
+	require.True(t, report.Passed)
+	require.Equal(t, PreflightOK, report.Checks[0].Status)
+
+	cfg.APICfg.HighAvailability = true
+	cfg.HaGroupLockID = 1
+	cfg.TLSCertFile = "/does/not/exist"
+	report = &PreflightReport{Passed: true}
+	checkFlags(cfg, report)
+	require.False(t, report.Passed)
+	require.Len(t, report.Checks, 2)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+	decoded := PreflightReport{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, *report, decoded)
+
+	buf.Reset()
+	require.NoError(t, report.WriteText(&buf))
+	require.Contains(t, buf.String(), "Preflight FAILED")
+}
+
+func TestPreflightDiskStatus(t *testing.T) {
+	status, _ := diskStatus(100, 1000)
+	require.Equal(t, PreflightOK, status)
+	status, _ = diskStatus(900, 1000)
+	require.Equal(t, PreflightWarn, status)
+	status, _ = diskStatus(1000, 1000)
+	require.Equal(t, PreflightWarn, status)
+	status, _ = diskStatus(1001, 1000)
+	require.Equal(t, PreflightFail, status)
+}
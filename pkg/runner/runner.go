@@ -8,7 +8,6 @@ package runner
 
 import (
 	"fmt"
-	"net"
 	"net/http"
 	"time"
 
@@ -16,6 +15,8 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/timescale/promscale/pkg/api"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/catalog"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"github.com/timescale/promscale/pkg/thanos"
 	"github.com/timescale/promscale/pkg/util"
 	tput "github.com/timescale/promscale/pkg/util/throughput"
@@ -36,6 +37,12 @@ func Run(cfg *Config) error {
 	redacted := *cfg
 	redacted.PgmodelCfg.Password = "****"
 	redacted.PgmodelCfg.DbUri = "****"
+	if redacted.PgmodelCfg.MirrorDbUri != "" {
+		redacted.PgmodelCfg.MirrorDbUri = "****"
+	}
+	if redacted.PgmodelCfg.Forward.URL != "" {
+		redacted.PgmodelCfg.Forward.URL = "****"
+	}
 	log.Info("config", fmt.Sprintf("%+v", redacted))
 
 	if cfg.APICfg.ReadOnly {
@@ -44,6 +51,15 @@ func Run(cfg *Config) error {
 		tput.InitWatcher(cfg.ThroughputInterval)
 	}
 
+	if cfg.APICfg.Tracing {
+		closer, err := initTracer()
+		if err != nil {
+			log.Error("msg", "aborting startup due to error", "err", err.Error())
+			return startupError
+		}
+		defer closer.Close()
+	}
+
 	promMetrics := api.InitMetrics()
 	client, err := CreateClient(cfg, promMetrics)
 	if err != nil {
@@ -56,8 +72,16 @@ func Run(cfg *Config) error {
 	}
 
 	defer client.Close()
+	if cfg.APICfg.Tenants != nil {
+		defer cfg.APICfg.Tenants.Close()
+	}
 
-	router, err := api.GenerateRouter(&cfg.APICfg, client, elector)
+	var router, internalRouter http.Handler
+	if cfg.InternalListenAddr != "" {
+		router, internalRouter, err = api.GenerateSplitRouters(&cfg.APICfg, client, elector)
+	} else {
+		router, err = api.GenerateRouter(&cfg.APICfg, client, elector)
+	}
 	if err != nil {
 		log.Error("msg", "aborting startup due to error", "err", fmt.Sprintf("generate router: %s", err.Error()))
 		return fmt.Errorf("generate router: %w", err)
@@ -73,7 +97,7 @@ func Run(cfg *Config) error {
 
 		go func() {
 			log.Info("msg", fmt.Sprintf("Start listening for Thanos StoreAPI on %s", cfg.ThanosStoreAPIListenAddr))
-			listener, err := net.Listen("tcp", cfg.ThanosStoreAPIListenAddr)
+			listener, err := listen(cfg.ThanosStoreAPIListenAddr)
 			if err != nil {
 				log.Error("msg", "Listening for Thanos StoreAPI failed", "err", err)
 				return
@@ -87,15 +111,52 @@ func Run(cfg *Config) error {
 		}()
 	}
 
-	mux := http.NewServeMux()
-	mux.Handle("/", router)
+	if len(cfg.CatalogListenAddr) > 0 {
+		resolver, err := ingestor.NewCatalogResolver(client.Connection)
+		if err != nil {
+			log.Error("msg", "aborting startup due to error", "err", fmt.Sprintf("catalog service: %s", err.Error()))
+			return startupError
+		}
+		opts, err := catalog.ServerOptions(&cfg.PgmodelCfg.Catalog)
+		if err != nil {
+			log.Error("msg", "aborting startup due to error", "err", fmt.Sprintf("catalog service: %s", err.Error()))
+			return startupError
+		}
+		election, err := catalog.NewElection(cfg.PgmodelCfg.GetConnectionStr())
+		if err != nil {
+			log.Error("msg", "aborting startup due to error", "err", fmt.Sprintf("catalog service election: %s", err.Error()))
+			return startupError
+		}
+		defer election.Close()
+		grpcServer := grpc.NewServer(opts...)
+		catalog.NewServer(resolver, election.CheckLeader).Register(grpcServer)
 
-	if cfg.TLSCertFile != "" {
-		err = http.ListenAndServeTLS(cfg.ListenAddr, cfg.TLSCertFile, cfg.TLSKeyFile, mux)
-	} else {
-		err = http.ListenAndServe(cfg.ListenAddr, mux)
+		go func() {
+			log.Info("msg", "Listening for the catalog service", "addr", cfg.CatalogListenAddr)
+			listener, err := listen(cfg.CatalogListenAddr)
+			if err != nil {
+				log.Error("msg", "Listening for the catalog service failed", "err", err)
+				return
+			}
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Error("msg", "Serving the catalog service failed", "err", err)
+			}
+		}()
+	}
+
+	if internalRouter != nil {
+		go func() {
+			log.Info("msg", "Listening for internal endpoints", "addr", cfg.InternalListenAddr)
+			if err := listenAndServe(cfg.InternalListenAddr, cfg.InternalTLSCertFile, cfg.InternalTLSKeyFile, internalRouter); err != nil {
+				log.Error("msg", "Listen failure for internal endpoints", "err", err)
+			}
+		}()
 	}
 
+	mux := http.NewServeMux()
+	mux.Handle("/", router)
+
+	err = listenAndServe(cfg.ListenAddr, cfg.TLSCertFile, cfg.TLSKeyFile, mux)
 	if err != nil {
 		log.Error("msg", "Listen failure", "err", err)
 		return startupError
@@ -0,0 +1,34 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package runner
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go/config"
+)
+
+const tracingServiceName = "promscale"
+
+// initTracer sets the global tracer to a Jaeger tracer configured with the
+// JAEGER_* environment variables. The returned closer flushes the spans
+// that were not reported yet.
+func initTracer() (io.Closer, error) {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("reading the tracing configuration: %w", err)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = tracingServiceName
+	}
+	tracer, closer, err := cfg.NewTracer()
+	if err != nil {
+		return nil, fmt.Errorf("creating the tracer: %w", err)
+	}
+	opentracing.SetGlobalTracer(tracer)
+	return closer, nil
+}
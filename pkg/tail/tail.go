@@ -0,0 +1,144 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package tail fans out samples observed on the ingest path to live
+// subscribers, e.g. the /api/v1/tail server-sent events endpoint.
+package tail
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// DefaultBufferSize is the number of samples a subscription can hold before
+// newly published samples start being dropped.
+const DefaultBufferSize = 1024
+
+var droppedSamples = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Name:      "tail_dropped_samples_total",
+		Help:      "Total number of samples dropped because a tail subscriber was too slow.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(droppedSamples)
+}
+
+// Sample is a single sample observed on the ingest path.
+type Sample struct {
+	Labels    labels.Labels `json:"labels"`
+	Timestamp int64         `json:"timestamp"`
+	Value     float64       `json:"value"`
+}
+
+// Subscription receives the samples matching its matchers.
+type Subscription struct {
+	matchers []*labels.Matcher
+	c        chan Sample
+	dropped  uint64
+}
+
+// C returns the channel on which matching samples are delivered.
+func (s *Subscription) C() <-chan Sample {
+	return s.c
+}
+
+// Dropped returns the number of samples dropped for this subscription.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) matches(ls labels.Labels) bool {
+	for _, m := range s.matchers {
+		if !m.Matches(ls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Broker keeps track of tail subscriptions and publishes ingested samples to them.
+// Publishing never blocks the ingest path: if a subscriber's buffer is full,
+// samples are dropped for that subscriber.
+type Broker struct {
+	// Using the first word in struct to ensure proper alignment in 32-bit systems.
+	numSubs int64
+	mux     sync.RWMutex
+	subs    map[*Subscription]struct{}
+}
+
+// NewBroker returns a broker with no subscriptions.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscription for samples matching all matchers.
+func (b *Broker) Subscribe(matchers []*labels.Matcher, bufSize int) *Subscription {
+	if bufSize < 1 {
+		bufSize = DefaultBufferSize
+	}
+	s := &Subscription{
+		matchers: matchers,
+		c:        make(chan Sample, bufSize),
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.subs[s] = struct{}{}
+	atomic.AddInt64(&b.numSubs, 1)
+	return s
+}
+
+// Unsubscribe removes the subscription and closes its channel.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	atomic.AddInt64(&b.numSubs, -1)
+	close(s.c)
+}
+
+// HasSubscribers is a cheap check that allows callers to skip preparing data
+// for Publish when nobody is listening.
+func (b *Broker) HasSubscribers() bool {
+	return b != nil && atomic.LoadInt64(&b.numSubs) > 0
+}
+
+// Publish sends the samples of a series to every matching subscription.
+func (b *Broker) Publish(lbls []prompb.Label, samples []prompb.Sample) {
+	if !b.HasSubscribers() || len(samples) == 0 {
+		return
+	}
+	ls := make(labels.Labels, 0, len(lbls))
+	for _, l := range lbls {
+		ls = append(ls, labels.Label{Name: l.Name, Value: l.Value})
+	}
+	sort.Sort(ls)
+
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	for s := range b.subs {
+		if !s.matches(ls) {
+			continue
+		}
+		for _, sample := range samples {
+			select {
+			case s.c <- Sample{Labels: ls, Timestamp: sample.Timestamp, Value: sample.Value}:
+			default:
+				atomic.AddUint64(&s.dropped, 1)
+				droppedSamples.Inc()
+			}
+		}
+	}
+}
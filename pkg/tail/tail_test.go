@@ -0,0 +1,53 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tail
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker()
+	require.False(t, b.HasSubscribers())
+
+	matcher, err := labels.NewMatcher(labels.MatchEqual, "job", "api")
+	require.NoError(t, err)
+	sub := b.Subscribe([]*labels.Matcher{matcher}, 2)
+	require.True(t, b.HasSubscribers())
+
+	b.Publish(
+		[]prompb.Label{{Name: "job", Value: "api"}, {Name: "__name__", Value: "up"}},
+		[]prompb.Sample{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}, {Timestamp: 3, Value: 3}},
+	)
+	b.Publish(
+		[]prompb.Label{{Name: "job", Value: "db"}, {Name: "__name__", Value: "up"}},
+		[]prompb.Sample{{Timestamp: 1, Value: 0}},
+	)
+
+	first := <-sub.C()
+	require.Equal(t, labels.FromStrings("__name__", "up", "job", "api"), first.Labels)
+	require.Equal(t, int64(1), first.Timestamp)
+	second := <-sub.C()
+	require.Equal(t, int64(2), second.Timestamp)
+	require.Equal(t, uint64(1), sub.Dropped())
+
+	b.Unsubscribe(sub)
+	require.False(t, b.HasSubscribers())
+	_, ok := <-sub.C()
+	require.False(t, ok)
+
+	// Unsubscribing twice must be a no-op.
+	b.Unsubscribe(sub)
+}
+
+func TestNilBroker(t *testing.T) {
+	var b *Broker
+	require.False(t, b.HasSubscribers())
+	b.Publish([]prompb.Label{{Name: "__name__", Value: "up"}}, []prompb.Sample{{Timestamp: 1}})
+}
@@ -0,0 +1,157 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tenancy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+// tenantTokenHeader is the header carrying the token of the tenant set in
+// the TENANT header, for tenants managed in the catalog.
+const tenantTokenHeader = "TENANT-TOKEN"
+
+// catalogConfig defines the configuration for tenancy where the valid tenants
+// are the enabled tenants of the catalog.
+type catalogConfig struct {
+	store      *Store
+	nonTenants bool
+
+	mux        sync.Mutex
+	matcher    *labels.Matcher
+	generation uint64
+}
+
+// NewCatalogTenancyConfig creates a new config for tenancy where only the
+// enabled tenants of the store are allowed.
+func NewCatalogTenancyConfig(store *Store, allowNonTenants bool) AuthConfig {
+	return &catalogConfig{store: store, nonTenants: allowNonTenants}
+}
+
+func (cfg *catalogConfig) allowNonTenants() bool {
+	return cfg.nonTenants
+}
+
+// IsTenantAllowed returns true if the given tenantName is allowed to be ingested.
+func (cfg *catalogConfig) IsTenantAllowed(tenantName string) bool {
+	if tenantName == "" {
+		return cfg.allowNonTenants()
+	}
+	t, ok := cfg.store.Get(tenantName)
+	return ok && !t.Disabled
+}
+
+// getTenantSafetyMatcher returns the matcher of the currently enabled tenants.
+// It is only rebuilt when the tenants of the store changed.
+func (cfg *catalogConfig) getTenantSafetyMatcher() (*labels.Matcher, error) {
+	tenants, generation := cfg.store.enabled()
+
+	cfg.mux.Lock()
+	defer cfg.mux.Unlock()
+	if cfg.matcher != nil && cfg.generation == generation {
+		return cfg.matcher, nil
+	}
+
+	var (
+		matcher *labels.Matcher
+		err     error
+	)
+	switch {
+	case len(tenants) > 0:
+		// Unlike flags, tenant names created through the API are not
+		// validated, so they are escaped.
+		quoted := make([]string, len(tenants))
+		for i := range tenants {
+			quoted[i] = regexp.QuoteMeta(tenants[i])
+		}
+		if cfg.allowNonTenants() {
+			quoted = append(quoted, "^$")
+		}
+		matcher, err = labels.NewMatcher(labels.MatchRegexp, TenantLabelKey, strings.Join(quoted, regexOR))
+	case cfg.allowNonTenants():
+		matcher, err = labels.NewMatcher(labels.MatchEqual, TenantLabelKey, "")
+	default:
+		// No tenant can be read, which no value of the label matches.
+		matcher, err = labels.NewMatcher(labels.MatchNotRegexp, TenantLabelKey, ".*")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("init safety label-matcher: %w", err)
+	}
+	cfg.matcher, cfg.generation = matcher, generation
+	return matcher, nil
+}
+
+// NewCatalogAuthorizer returns an authorizer of the tenants of the catalog.
+// Since the tenants change over time, the read authorizer rebuilds its safety
+// matcher when they do, and the write authorizer checks the tokens and the
+// quotas of the tenants in addition to their names.
+func NewCatalogAuthorizer(store *Store, allowNonTenants bool) (Authorizer, error) {
+	cfg := NewCatalogTenancyConfig(store, allowNonTenants).(*catalogConfig)
+	if _, err := cfg.getTenantSafetyMatcher(); err != nil {
+		return nil, fmt.Errorf("creating tenancy: %w", err)
+	}
+	return &genericAuthorizer{
+		read:  &catalogReadAuthorizer{cfg},
+		write: &catalogWriteAuthorizer{writeAuthorizer: NewWriteAuthorizer(cfg), store: store},
+	}, nil
+}
+
+type catalogReadAuthorizer struct {
+	cfg *catalogConfig
+}
+
+func (a *catalogReadAuthorizer) AppendTenantMatcher(ms []*labels.Matcher) []*labels.Matcher {
+	matcher, err := a.cfg.getTenantSafetyMatcher()
+	if err != nil {
+		// The matchers are built from escaped names, so this cannot happen.
+		// Still, no tenant must be readable if it does.
+		matcher = &labels.Matcher{Type: labels.MatchNotRegexp, Name: TenantLabelKey, Value: ".*"}
+	}
+	return append(ms, matcher)
+}
+
+type catalogWriteAuthorizer struct {
+	*writeAuthorizer
+	store *Store
+}
+
+var errQuotaExceeded = fmt.Errorf("samples per write quota exceeded")
+
+// Process implements the Preprocessor interface.
+func (a *catalogWriteAuthorizer) Process(r *http.Request, wr *prompb.WriteRequest) error {
+	if err := a.writeAuthorizer.Process(r, wr); err != nil {
+		return err
+	}
+	samples := make(map[string]int64)
+	for i := range wr.Timeseries {
+		tenant := a.getTenantNameFromLabel(wr.Timeseries[i].Labels)
+		samples[tenant] += int64(len(wr.Timeseries[i].Samples))
+	}
+
+	tokenHash := hashToken(r.Header.Get(tenantTokenHeader))
+	for tenant, count := range samples {
+		if tenant == "" {
+			continue
+		}
+		t, ok := a.store.Get(tenant)
+		if !ok {
+			return fmt.Errorf("authorization error for tenant %s: %w", tenant, ErrUnauthorizedTenant)
+		}
+		if subtle.ConstantTimeCompare(t.tokenHash, tokenHash) != 1 {
+			return fmt.Errorf("authorization error for tenant %s: invalid %s header: %w", tenant, tenantTokenHeader, ErrUnauthorizedTenant)
+		}
+		if t.MaxSamplesPerWrite > 0 && count > t.MaxSamplesPerWrite {
+			return fmt.Errorf("tenant %s: %d samples exceed the limit of %d: %w", tenant, count, t.MaxSamplesPerWrite, errQuotaExceeded)
+		}
+	}
+	return nil
+}
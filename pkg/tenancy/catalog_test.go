@@ -0,0 +1,117 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func newTestStore(tenants ...Tenant) *Store {
+	store := NewStore()
+	m := make(map[string]Tenant)
+	for _, t := range tenants {
+		m[t.Name] = t
+	}
+	store.setTenants(m)
+	return store
+}
+
+func TestCatalogSafetyMatcher(t *testing.T) {
+	store := newTestStore(
+		Tenant{Name: "tenant.a"},
+		Tenant{Name: "tenant-b", Disabled: true},
+	)
+
+	cfg := NewCatalogTenancyConfig(store, false)
+	matcher, err := cfg.getTenantSafetyMatcher()
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("tenant.a"))
+	require.False(t, matcher.Matches("tenantxa"), "tenant names must be escaped")
+	require.False(t, matcher.Matches("tenant-b"), "disabled tenants must not be readable")
+	require.False(t, matcher.Matches(""))
+
+	cfg = NewCatalogTenancyConfig(store, true)
+	matcher, err = cfg.getTenantSafetyMatcher()
+	require.NoError(t, err)
+	require.True(t, matcher.Matches(""))
+
+	// The matcher follows the changes of the tenants.
+	store.setTenants(map[string]Tenant{})
+	matcher, err = NewCatalogTenancyConfig(store, false).getTenantSafetyMatcher()
+	require.NoError(t, err)
+	require.False(t, matcher.Matches(""))
+	require.False(t, matcher.Matches("tenant.a"))
+}
+
+func TestCatalogReadAuthorizer(t *testing.T) {
+	store := newTestStore(Tenant{Name: "tenant-a"})
+	authr, err := NewCatalogAuthorizer(store, false)
+	require.NoError(t, err)
+
+	ms := authr.ReadAuthorizer().AppendTenantMatcher(nil)
+	require.Len(t, ms, 1)
+	require.True(t, ms[0].Matches("tenant-a"))
+
+	store.setTenants(map[string]Tenant{"tenant-a": {Name: "tenant-a", Disabled: true}})
+	ms = authr.ReadAuthorizer().AppendTenantMatcher(nil)
+	require.False(t, ms[0].Matches("tenant-a"))
+}
+
+func TestCatalogWriteAuthorizer(t *testing.T) {
+	store := newTestStore(
+		Tenant{Name: "tenant-a", tokenHash: hashToken("token-a"), MaxSamplesPerWrite: 2},
+		Tenant{Name: "tenant-b", tokenHash: hashToken("token-b"), Disabled: true},
+	)
+	authr, err := NewCatalogAuthorizer(store, true)
+	require.NoError(t, err)
+
+	series := func(n int) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: labels.MetricName, Value: "up"}},
+			Samples: make([]prompb.Sample, n),
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		tenant string
+		token  string
+		series []prompb.TimeSeries
+		err    error
+	}{
+		{name: "valid token", tenant: "tenant-a", token: "token-a", series: []prompb.TimeSeries{series(1), series(1)}},
+		{name: "missing token", tenant: "tenant-a", series: []prompb.TimeSeries{series(1)}, err: ErrUnauthorizedTenant},
+		{name: "wrong token", tenant: "tenant-a", token: "token-b", series: []prompb.TimeSeries{series(1)}, err: ErrUnauthorizedTenant},
+		{name: "quota exceeded", tenant: "tenant-a", token: "token-a", series: []prompb.TimeSeries{series(2), series(1)}, err: errQuotaExceeded},
+		{name: "disabled tenant", tenant: "tenant-b", token: "token-b", series: []prompb.TimeSeries{series(1)}, err: ErrUnauthorizedTenant},
+		{name: "unknown tenant", tenant: "tenant-c", series: []prompb.TimeSeries{series(1)}, err: ErrUnauthorizedTenant},
+		{name: "non-tenant", series: []prompb.TimeSeries{series(5)}},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, "/write", nil)
+			require.NoError(t, err)
+			if c.tenant != "" {
+				r.Header.Set("TENANT", c.tenant)
+			}
+			if c.token != "" {
+				r.Header.Set(tenantTokenHeader, c.token)
+			}
+			err = authr.WriteAuthorizer().Process(r, &prompb.WriteRequest{Timeseries: c.series})
+			if c.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.True(t, errors.Is(err, c.err), "unexpected error: %v", err)
+		})
+	}
+}
@@ -6,7 +6,12 @@ import (
 	"strings"
 )
 
-const AllowAllTenants = "allow-all"
+const (
+	AllowAllTenants = "allow-all"
+	// CatalogTenants makes the valid tenants the enabled tenants managed
+	// through the tenant admin API.
+	CatalogTenants = "catalog"
+)
 
 type Config struct {
 	SkipTenantValidation bool
@@ -14,6 +19,7 @@ type Config struct {
 	AllowNonMTWrites     bool
 	ValidTenantsStr      string
 	ValidTenantsList     []string
+	UseCatalogTenants    bool
 }
 
 func ParseFlags(fs *flag.FlagSet, cfg *Config) {
@@ -22,7 +28,8 @@ func ParseFlags(fs *flag.FlagSet, cfg *Config) {
 		"By setting this to true, Promscale will ingest data from non multi-tenant Prometheus instances as well. "+
 		"If this is false, only multi-tenants (tenants listed in 'multi-tenancy-valid-tenants') are allowed for ingesting and querying data.")
 	fs.StringVar(&cfg.ValidTenantsStr, "multi-tenancy-valid-tenants", AllowAllTenants, "Sets valid tenants that are allowed to be ingested/queried from Promscale. "+
-		fmt.Sprintf("This can be set as: '%s' (default) or a comma separated tenant names. '%s' makes Promscale ingest or query any tenant from itself. ", AllowAllTenants, AllowAllTenants)+
+		fmt.Sprintf("This can be set as: '%s' (default), '%s' or a comma separated tenant names. '%s' makes Promscale ingest or query any tenant from itself. ", AllowAllTenants, CatalogTenants, AllowAllTenants)+
+		fmt.Sprintf("'%s' makes Promscale use the enabled tenants managed through the tenant admin API, which are stored in the database. ", CatalogTenants)+
 		"A comma separated list will indicate only those tenants that are authorized for operations from Promscale.")
 }
 
@@ -33,6 +40,9 @@ func Validate(cfg *Config) error {
 	if cfg.ValidTenantsStr == AllowAllTenants {
 		cfg.SkipTenantValidation = true
 		return nil
+	} else if cfg.ValidTenantsStr == CatalogTenants {
+		cfg.UseCatalogTenants = true
+		return nil
 	} else if cfg.ValidTenantsStr == "" {
 		return fmt.Errorf("'multi-tenancy-valid-tenants' cannot be empty")
 	}
@@ -51,8 +61,8 @@ func removeEmptyTenants(t []string) (tenants []string, err error) {
 		if len(t[i]) == 0 {
 			continue
 		}
-		if t[i] == AllowAllTenants {
-			return tenants, fmt.Errorf("'%s' should not be present with valid tenant names", AllowAllTenants)
+		if t[i] == AllowAllTenants || t[i] == CatalogTenants {
+			return tenants, fmt.Errorf("'%s' should not be present with valid tenant names", t[i])
 		}
 		tenants = append(tenants, t[i])
 	}
@@ -18,6 +18,9 @@ func TestParseFlags(t *testing.T) {
 	config = fullyParse(t, []string{"-multi-tenancy", "-multi-tenancy-valid-tenants=tenant-a,tenant-b,tenant-c"})
 	require.Equal(t, Config{EnableMultiTenancy: true, ValidTenantsStr: "tenant-a,tenant-b,tenant-c", ValidTenantsList: []string{"tenant-a", "tenant-b", "tenant-c"}}, config)
 
+	config = fullyParse(t, []string{"-multi-tenancy", fmt.Sprintf("-multi-tenancy-valid-tenants=%s", CatalogTenants)})
+	require.Equal(t, Config{EnableMultiTenancy: true, ValidTenantsStr: CatalogTenants, UseCatalogTenants: true}, config)
+
 	config = fullyParse(t, []string{fmt.Sprintf("-multi-tenancy-valid-tenants=%s", AllowAllTenants)})
 	require.Equal(t, Config{ValidTenantsStr: AllowAllTenants, SkipTenantValidation: false}, config)
 }
@@ -0,0 +1,242 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tenancy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	requestPurgeSQL = "INSERT INTO " + schema.Catalog + ".tenant_purge (tenant_name) VALUES ($1) " +
+		"ON CONFLICT (tenant_name) DO UPDATE SET status = 'pending', requested_at = now(), finished_at = NULL, error = NULL, " +
+		"metrics_total = 0, metrics_done = 0, last_metric_id = 0, series_deleted = 0, rows_deleted = 0, live_series = NULL, remaining_rows = NULL " +
+		"WHERE tenant_purge.status IN ('failed', 'completed')"
+	getPurgeSQL = "SELECT tenant_name, status, requested_at, finished_at, metrics_total, metrics_done, series_deleted, rows_deleted, " +
+		"live_series, remaining_rows, COALESCE(error, '') FROM " + schema.Catalog + ".tenant_purge WHERE tenant_name = $1"
+	// A running purge whose connector stopped updating its heartbeat is
+	// claimed again, and resumed after the last metric it completed.
+	claimPurgeSQL = "UPDATE " + schema.Catalog + ".tenant_purge SET status = 'running', heartbeat_at = now() " +
+		"WHERE tenant_name = (SELECT tenant_name FROM " + schema.Catalog + ".tenant_purge " +
+		"WHERE status = 'pending' OR (status = 'running' AND heartbeat_at < now() - $1::float8 * INTERVAL '1 second') " +
+		"ORDER BY requested_at LIMIT 1 FOR UPDATE SKIP LOCKED) " +
+		"RETURNING tenant_name, last_metric_id, metrics_done"
+	purgeMetricsSQL = "SELECT id, metric_name FROM " + schema.Catalog + ".metric " +
+		"WHERE is_view = false AND table_schema = '" + schema.Data + "' AND id > $1 ORDER BY id"
+	setPurgeMetricsTotalSQL = "UPDATE " + schema.Catalog + ".tenant_purge SET metrics_total = $2 WHERE tenant_name = $1"
+	deleteTenantSeriesSQL   = "SELECT series_deleted, rows_deleted FROM " + schema.Catalog + ".delete_tenant_series_from_metric($1, $2)"
+	updatePurgeProgressSQL  = "UPDATE " + schema.Catalog + ".tenant_purge SET last_metric_id = $2, metrics_done = metrics_done + 1, " +
+		"series_deleted = series_deleted + $3, rows_deleted = rows_deleted + $4, heartbeat_at = now() WHERE tenant_name = $1"
+	verifyTenantPurgeSQL  = "SELECT live_series, remaining_rows FROM " + schema.Catalog + ".verify_tenant_purge($1)"
+	deletePurgedTenantSQL = "DELETE FROM " + schema.Catalog + ".tenant WHERE name = $1"
+	finishPurgeSQL        = "UPDATE " + schema.Catalog + ".tenant_purge SET status = $2, finished_at = now(), " +
+		"live_series = $3, remaining_rows = $4, error = NULLIF($5, '') WHERE tenant_name = $1"
+
+	// purgeCheckInterval is how often the connector looks for purges to run,
+	// such as the ones requested through other connectors.
+	purgeCheckInterval = time.Minute
+	// purgeStaleAfter is how long after its last progress a running purge is
+	// considered abandoned.
+	purgeStaleAfter = 10 * time.Minute
+)
+
+var purgedListeners struct {
+	sync.RWMutex
+	fs []func(tenant string)
+}
+
+// OnPurged registers f to be called with the name of each tenant whose data
+// the connector purged, or tried to, e.g. to invalidate cached query results.
+func OnPurged(f func(tenant string)) {
+	purgedListeners.Lock()
+	defer purgedListeners.Unlock()
+	purgedListeners.fs = append(purgedListeners.fs, f)
+}
+
+func notifyPurged(tenant string) {
+	purgedListeners.RLock()
+	defer purgedListeners.RUnlock()
+	for _, f := range purgedListeners.fs {
+		f(tenant)
+	}
+}
+
+// Purge reports the progress of the deletion of all the data of a tenant.
+type Purge struct {
+	Tenant        string
+	Status        string
+	RequestedAt   time.Time
+	FinishedAt    *time.Time
+	MetricsTotal  int
+	MetricsDone   int
+	SeriesDeleted int64
+	RowsDeleted   int64
+	// LiveSeries and RemainingRows are the result of the verification done
+	// once all the metrics were processed, which must both be 0.
+	LiveSeries    *int64
+	RemainingRows *int64
+	Error         string
+}
+
+// purger runs the purges of tenants in the background.
+type purger struct {
+	conn    pgxconn.PgxConn
+	trigger chan struct{}
+	// refresh is called when a purged tenant was deleted.
+	refresh func() error
+	done    <-chan struct{}
+}
+
+func newPurger(conn pgxconn.PgxConn, refresh func() error, done <-chan struct{}) *purger {
+	return &purger{
+		conn:    conn,
+		trigger: make(chan struct{}, 1),
+		refresh: refresh,
+		done:    done,
+	}
+}
+
+func (p *purger) start() {
+	go func() {
+		ticker := time.NewTicker(purgeCheckInterval)
+		defer ticker.Stop()
+		for {
+			p.runPending()
+			select {
+			case <-ticker.C:
+			case <-p.trigger:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// request records a purge of the tenant, unless one is already pending or
+// running, and wakes the purger up. A failed purge is started over, as is a
+// completed one, which was for a previous tenant of the same name.
+func (p *purger) request(tenant string) (Purge, error) {
+	if _, err := p.conn.Exec(context.Background(), requestPurgeSQL, tenant); err != nil {
+		return Purge{}, fmt.Errorf("requesting purge of tenant %s: %w", tenant, err)
+	}
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+	return p.get(tenant)
+}
+
+func (p *purger) get(tenant string) (Purge, error) {
+	var pu Purge
+	err := p.conn.QueryRow(context.Background(), getPurgeSQL, tenant).Scan(&pu.Tenant, &pu.Status, &pu.RequestedAt, &pu.FinishedAt,
+		&pu.MetricsTotal, &pu.MetricsDone, &pu.SeriesDeleted, &pu.RowsDeleted, &pu.LiveSeries, &pu.RemainingRows, &pu.Error)
+	if err == pgx.ErrNoRows {
+		return pu, fmt.Errorf("no purge of tenant %s: %w", tenant, ErrTenantNotFound)
+	}
+	return pu, err
+}
+
+// runPending runs the purges that are pending or abandoned, one at a time.
+func (p *purger) runPending() {
+	for {
+		var (
+			tenant       string
+			lastMetricID int
+			metricsDone  int
+		)
+		err := p.conn.QueryRow(context.Background(), claimPurgeSQL, purgeStaleAfter.Seconds()).Scan(&tenant, &lastMetricID, &metricsDone)
+		if err == pgx.ErrNoRows {
+			return
+		}
+		if err != nil {
+			log.Error("msg", "error claiming tenant purge", "err", err)
+			return
+		}
+
+		log.Info("msg", "purging tenant", "tenant", tenant, "resume-after-metric-id", lastMetricID)
+		err = p.run(tenant, lastMetricID, metricsDone)
+		notifyPurged(tenant)
+		if err != nil {
+			log.Error("msg", "error purging tenant", "tenant", tenant, "err", err)
+			if _, ferr := p.conn.Exec(context.Background(), finishPurgeSQL, tenant, "failed", nil, nil, err.Error()); ferr != nil {
+				log.Error("msg", "error recording tenant purge failure", "tenant", tenant, "err", ferr)
+			}
+		}
+	}
+}
+
+// run deletes the series of the tenant metric by metric, after the last
+// metric that was completed, then verifies that nothing is left.
+func (p *purger) run(tenant string, lastMetricID, metricsDone int) error {
+	rows, err := p.conn.Query(context.Background(), purgeMetricsSQL, lastMetricID)
+	if err != nil {
+		return fmt.Errorf("listing metrics: %w", err)
+	}
+	var (
+		ids   []int
+		names []string
+	)
+	for rows.Next() {
+		var (
+			id   int
+			name string
+		)
+		if err = rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("listing metrics: %w", err)
+		}
+		ids = append(ids, id)
+		names = append(names, name)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("listing metrics: %w", err)
+	}
+
+	if _, err = p.conn.Exec(context.Background(), setPurgeMetricsTotalSQL, tenant, metricsDone+len(ids)); err != nil {
+		return fmt.Errorf("recording progress: %w", err)
+	}
+
+	for i := range ids {
+		var seriesDeleted, rowsDeleted int64
+		err = p.conn.QueryRow(context.Background(), deleteTenantSeriesSQL, names[i], tenant).Scan(&seriesDeleted, &rowsDeleted)
+		if err != nil {
+			return fmt.Errorf("deleting series of metric %s: %w", names[i], err)
+		}
+		// If the connector fails before recording the progress, the metric
+		// is processed again, which deletes nothing more.
+		if _, err = p.conn.Exec(context.Background(), updatePurgeProgressSQL, tenant, ids[i], seriesDeleted, rowsDeleted); err != nil {
+			return fmt.Errorf("recording progress: %w", err)
+		}
+	}
+
+	var liveSeries, remainingRows int64
+	if err = p.conn.QueryRow(context.Background(), verifyTenantPurgeSQL, tenant).Scan(&liveSeries, &remainingRows); err != nil {
+		return fmt.Errorf("verifying purge: %w", err)
+	}
+	if liveSeries != 0 || remainingRows != 0 {
+		// The tenant is kept, disabled, so that the purge can be requested
+		// again.
+		_, err = p.conn.Exec(context.Background(), finishPurgeSQL, tenant, "failed", liveSeries, remainingRows,
+			fmt.Sprintf("verification failed: %d series and %d samples left", liveSeries, remainingRows))
+		return err
+	}
+
+	if _, err = p.conn.Exec(context.Background(), deletePurgedTenantSQL, tenant); err != nil {
+		return fmt.Errorf("deleting tenant: %w", err)
+	}
+	if _, err = p.conn.Exec(context.Background(), finishPurgeSQL, tenant, "completed", liveSeries, remainingRows, ""); err != nil {
+		return fmt.Errorf("recording completion: %w", err)
+	}
+	log.Info("msg", "tenant purged", "tenant", tenant)
+	return p.refresh()
+}
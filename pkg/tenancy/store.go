@@ -0,0 +1,291 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tenancy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	getTenantsSQL = "SELECT name, disabled, token_hash, COALESCE(max_samples_per_write, 0), " +
+		"COALESCE(EXTRACT(epoch FROM retention_period), 0)::float8, created_at, updated_at FROM " + schema.Catalog + ".tenant"
+	createTenantSQL = "INSERT INTO " + schema.Catalog + ".tenant (name, token_hash, max_samples_per_write, retention_period) " +
+		"VALUES ($1, $2, NULLIF($3::bigint, 0), NULLIF($4::float8, 0) * INTERVAL '1 second') ON CONFLICT DO NOTHING"
+	updateTenantSQL = "UPDATE " + schema.Catalog + ".tenant SET " +
+		"disabled = COALESCE($2, disabled), " +
+		"max_samples_per_write = CASE WHEN $3::bigint IS NULL THEN max_samples_per_write ELSE NULLIF($3::bigint, 0) END, " +
+		"retention_period = CASE WHEN $4::float8 IS NULL THEN retention_period ELSE NULLIF($4::float8, 0) * INTERVAL '1 second' END, " +
+		"updated_at = now() WHERE name = $1"
+	rotateTenantTokenSQL = "UPDATE " + schema.Catalog + ".tenant SET token_hash = $2, updated_at = now() WHERE name = $1"
+
+	// tenantRefreshInterval is how often the tenants are reloaded from the
+	// database, so that the changes made through other connectors apply.
+	tenantRefreshInterval = 30 * time.Second
+	tokenBytes            = 32
+)
+
+var (
+	ErrTenantExists   = fmt.Errorf("tenant already exists")
+	ErrTenantNotFound = fmt.Errorf("tenant not found")
+)
+
+// Tenant is a tenant managed in the catalog.
+type Tenant struct {
+	Name     string
+	Disabled bool
+	// MaxSamplesPerWrite is the maximum number of samples of the tenant in
+	// a single write request, 0 if there is no limit.
+	MaxSamplesPerWrite int64
+	// RetentionPeriod is how long the data of the tenant is kept, 0 if the
+	// retention of the metrics applies.
+	RetentionPeriod time.Duration
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+
+	tokenHash []byte
+}
+
+// TenantSettings are the changes to the settings of a tenant. Nil fields are
+// left unchanged, and setting the quota or the retention to 0 removes it.
+type TenantSettings struct {
+	Disabled           *bool
+	MaxSamplesPerWrite *int64
+	RetentionPeriod    *time.Duration
+}
+
+// Store keeps the tenants of the catalog in memory, refreshing them
+// periodically from the database.
+type Store struct {
+	mux     sync.RWMutex
+	conn    pgxconn.PgxConn
+	tenants map[string]Tenant
+	// generation is incremented on every refresh, for the authorizers to know
+	// when to rebuild what they derive from the tenants.
+	generation uint64
+	purger     *purger
+	// done stops the refreshes and the purges once the store is closed.
+	done chan struct{}
+}
+
+// NewStore returns an empty store. Until it is started, it has no tenants.
+func NewStore() *Store {
+	return &Store{tenants: make(map[string]Tenant), done: make(chan struct{})}
+}
+
+// Start loads the tenants using the connection and keeps them up to date
+// in the background.
+func (s *Store) Start(conn pgxconn.PgxConn) error {
+	s.mux.Lock()
+	s.conn = conn
+	s.purger = newPurger(conn, s.Refresh, s.done)
+	s.mux.Unlock()
+	if err := s.Refresh(); err != nil {
+		return fmt.Errorf("loading tenants: %w", err)
+	}
+	go func() {
+		ticker := time.NewTicker(tenantRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+			if err := s.Refresh(); err != nil {
+				log.Warn("msg", "error refreshing tenants", "err", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops refreshing the tenants and running the purges.
+func (s *Store) Close() {
+	close(s.done)
+}
+
+// Refresh reloads the tenants from the database.
+func (s *Store) Refresh() error {
+	rows, err := s.conn.Query(context.Background(), getTenantsSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tenants := make(map[string]Tenant)
+	for rows.Next() {
+		var (
+			t         Tenant
+			retention float64
+		)
+		if err = rows.Scan(&t.Name, &t.Disabled, &t.tokenHash, &t.MaxSamplesPerWrite, &retention, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return err
+		}
+		t.RetentionPeriod = time.Duration(retention * float64(time.Second))
+		tenants[t.Name] = t
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	s.setTenants(tenants)
+	return nil
+}
+
+func (s *Store) setTenants(tenants map[string]Tenant) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.tenants = tenants
+	s.generation++
+}
+
+// Get returns the tenant with the given name.
+func (s *Store) Get(name string) (Tenant, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	t, ok := s.tenants[name]
+	return t, ok
+}
+
+// List returns all the tenants, sorted by name.
+func (s *Store) List() []Tenant {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	tenants := make([]Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants
+}
+
+// enabled returns the names of the tenants that are not disabled along with
+// the generation of the tenants.
+func (s *Store) enabled() ([]string, uint64) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	names := make([]string, 0, len(s.tenants))
+	for name, t := range s.tenants {
+		if !t.Disabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, s.generation
+}
+
+// Create creates a new tenant with the given settings and returns its token.
+func (s *Store) Create(name string, settings TenantSettings) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("tenant name cannot be empty")
+	}
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	var maxSamples int64
+	if settings.MaxSamplesPerWrite != nil {
+		maxSamples = *settings.MaxSamplesPerWrite
+	}
+	var retention float64
+	if settings.RetentionPeriod != nil {
+		retention = settings.RetentionPeriod.Seconds()
+	}
+	tag, err := s.conn.Exec(context.Background(), createTenantSQL, name, hash, maxSamples, retention)
+	if err != nil {
+		return "", fmt.Errorf("creating tenant %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", fmt.Errorf("creating tenant %s: %w", name, ErrTenantExists)
+	}
+	if settings.Disabled != nil && *settings.Disabled {
+		if err = s.Update(name, TenantSettings{Disabled: settings.Disabled}); err != nil {
+			return "", err
+		}
+	}
+	return token, s.Refresh()
+}
+
+// Update changes the settings of a tenant.
+func (s *Store) Update(name string, settings TenantSettings) error {
+	var retention *float64
+	if settings.RetentionPeriod != nil {
+		seconds := settings.RetentionPeriod.Seconds()
+		retention = &seconds
+	}
+	tag, err := s.conn.Exec(context.Background(), updateTenantSQL, name, settings.Disabled, settings.MaxSamplesPerWrite, retention)
+	if err != nil {
+		return fmt.Errorf("updating tenant %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("updating tenant %s: %w", name, ErrTenantNotFound)
+	}
+	return s.Refresh()
+}
+
+// RotateToken replaces the token of a tenant and returns the new one. The
+// previous token stops being accepted once the connectors refresh their
+// tenants.
+func (s *Store) RotateToken(name string) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	tag, err := s.conn.Exec(context.Background(), rotateTenantTokenSQL, name, hash)
+	if err != nil {
+		return "", fmt.Errorf("rotating token of tenant %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", fmt.Errorf("rotating token of tenant %s: %w", name, ErrTenantNotFound)
+	}
+	return token, s.Refresh()
+}
+
+// StartPurges runs the purges of the deleted tenants in the background. It
+// must be called after Start, by the connectors that can write.
+func (s *Store) StartPurges() {
+	s.purger.start()
+}
+
+// Delete disables a tenant and requests the deletion of all its data, which
+// is done in the background. The tenant is deleted once its data was purged.
+func (s *Store) Delete(name string) (Purge, error) {
+	disabled := true
+	if err := s.Update(name, TenantSettings{Disabled: &disabled}); err != nil {
+		return Purge{}, err
+	}
+	return s.purger.request(name)
+}
+
+// GetPurge returns the progress of the purge of a tenant.
+func (s *Store) GetPurge(name string) (Purge, error) {
+	return s.purger.get(name)
+}
+
+// newToken returns a new random token along with its hash. Only the hash is
+// stored, so the token is shown once when it is created.
+func newToken() (string, []byte, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generating token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -25,6 +25,7 @@ import (
 	ingstr "github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
 )
 
 type deleteStr struct {
@@ -142,6 +143,60 @@ func TestDeleteWithMetricNameEQL(t *testing.T) {
 	})
 }
 
+func TestDeleteInTimeRange(t *testing.T) {
+	if *useMultinode && !*extendedTest {
+		t.Skip("delete tests run in extended mode only for multi-node configuration")
+	}
+	ts := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: model.MetricNameLabelName, Value: "delete_range"}, {Name: "job", Value: "a"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}, {Timestamp: 3000, Value: 3}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: model.MetricNameLabelName, Value: "delete_range"}, {Name: "job", Value: "b"}},
+			Samples: []prompb.Sample{{Timestamp: 2000, Value: 2}},
+		},
+	}
+	withDB(t, *testDatabase, func(dbOwner *pgxpool.Pool, t testing.TB) {
+		db := testhelpers.PgxPoolWithRole(t, *testDatabase, "prom_modifier")
+		defer db.Close()
+
+		ingestor, err := ingstr.NewPgxIngestorForTests(pgxconn.NewPgxConn(db), nil)
+		require.NoError(t, err)
+		defer ingestor.Close()
+		_, _, err = ingestor.Ingest(newWriteRequestWithTs(copyMetrics(ts)))
+		require.NoError(t, err)
+
+		matchers, err := getMatchers(`{__name__="delete_range"}`)
+		require.NoError(t, err)
+		pgDelete := &pgDel.PgDelete{Conn: pgxconn.NewPgxConn(db)}
+		touchedMetrics, deletedSeriesIDs, rowsDeleted, err := pgDelete.DeleteSeries(matchers, time.Unix(1, 500e6), time.Unix(2, 500e6))
+		require.NoError(t, err)
+		require.Equal(t, []string{"delete_range"}, touchedMetrics)
+		require.Equal(t, 2, rowsDeleted)
+		// Only the series left without samples is reported.
+		var emptySeriesID int64
+		err = db.QueryRow(context.Background(), `SELECT series_id FROM prom_series.delete_range WHERE job = 'b'`).Scan(&emptySeriesID)
+		require.NoError(t, err)
+		require.Equal(t, []model.SeriesID{model.SeriesID(emptySeriesID)}, deletedSeriesIDs)
+
+		var samples, markedSeries int
+		err = db.QueryRow(context.Background(), `SELECT count(*) FROM prom_data.delete_range`).Scan(&samples)
+		require.NoError(t, err)
+		require.Equal(t, 2, samples)
+		// Only the series left without samples is marked for deletion.
+		err = db.QueryRow(context.Background(), `SELECT count(*) FROM prom_data_series.delete_range WHERE delete_epoch IS NOT NULL`).Scan(&markedSeries)
+		require.NoError(t, err)
+		require.Equal(t, 1, markedSeries)
+
+		// Deleting the range again deletes nothing and marks no other series.
+		_, deletedSeriesIDs, rowsDeleted, err = pgDelete.DeleteSeries(matchers, time.Unix(1, 500e6), time.Unix(2, 500e6))
+		require.NoError(t, err)
+		require.Empty(t, deletedSeriesIDs)
+		require.Equal(t, 0, rowsDeleted)
+	})
+}
+
 func TestDeleteWithCompressedChunks(t *testing.T) {
 	if *useMultinode && !*extendedTest {
 		t.Skip("delete tests run in extended mode only for multi-node configuration")
@@ -130,7 +130,7 @@ func prepareWriterWithHa(db *pgxpool.Pool, t testing.TB) (*util.ManualTicker, ht
 		t.Fatalf("could not create ingestor: %v", err)
 	}
 	api.InitMetrics()
-	return ticker, api.Write(ing, dataParser, nil), ing, err
+	return ticker, api.Write(ing, dataParser, nil, nil, 0), ing, err
 }
 
 func TestHALeaderChangeDueToInactivity(t *testing.T) {
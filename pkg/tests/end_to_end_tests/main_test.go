@@ -22,6 +22,7 @@ import (
 	"github.com/timescale/promscale/pkg/pgmodel"
 	"github.com/timescale/promscale/pkg/pgmodel/common/extension"
 	ingstr "github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
 	"github.com/timescale/promscale/pkg/prompb"
 	"github.com/timescale/promscale/pkg/runner"
 	tput "github.com/timescale/promscale/pkg/util/throughput"
@@ -41,6 +42,7 @@ var (
 	postgresVersion       = flag.Int("postgres-version-major", 13, "Major version of Postgres")
 	useMultinode          = flag.Bool("use-multinode", false, "use TimescaleDB 2.0 Multinode")
 	useTimescaleDBNightly = flag.Bool("use-timescaledb-nightly", false, "use TimescaleDB nightly images")
+	dbImage               = flag.String("db-image", "", "docker image of the database, instead of the latest image of the versions chosen by the other flags")
 	printLogs             = flag.Bool("print-logs", false, "print TimescaleDB logs")
 	extendedTest          = flag.Bool("extended-test", false, "run extended testing dataset and PromQL queries")
 	logLevel              = flag.String("log-level", "debug", "Logging level")
@@ -100,6 +102,7 @@ func TestMain(m *testing.M) {
 	var code int
 	func() {
 		flag.Parse()
+		querier.VerifySeriesSets = true
 		ctx := context.Background()
 		err := log.Init(log.Config{
 			Level: *logLevel,
@@ -115,12 +118,16 @@ func TestMain(m *testing.M) {
 
 			pgContainerTestDataDir = generatePGTestDirFiles()
 
-			pgContainer, closer, err = testhelpers.StartPGContainer(
-				ctx,
-				extensionState,
-				pgContainerTestDataDir,
-				*printLogs,
-			)
+			if *dbImage != "" {
+				pgContainer, closer, err = testhelpers.StartDatabaseImage(ctx, *dbImage, pgContainerTestDataDir, "", *printLogs, extensionState)
+			} else {
+				pgContainer, closer, err = testhelpers.StartPGContainer(
+					ctx,
+					extensionState,
+					pgContainerTestDataDir,
+					*printLogs,
+				)
+			}
 			if err != nil {
 				fmt.Println("Error setting up container", err)
 				os.Exit(1)
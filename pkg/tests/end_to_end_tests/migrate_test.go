@@ -56,6 +56,50 @@ func TestMigrate(t *testing.T) {
 	})
 }
 
+func TestDowngrade(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	withDB(t, *testDatabase, func(db *pgxpool.Pool, t testing.TB) {
+		conn, err := db.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Release()
+
+		checkpointTableExists := func() bool {
+			var exists bool
+			err := conn.QueryRow(context.Background(), "SELECT to_regclass('_prom_catalog.ingest_checkpoint') IS NOT NULL").Scan(&exists)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return exists
+		}
+
+		if err = pgmodel.Downgrade(conn.Conn(), version.EarliestCompatibleSchema); err != nil {
+			t.Fatal(err)
+		}
+		var dbVersion string
+		if err = conn.QueryRow(context.Background(), "SELECT version FROM prom_schema_migrations").Scan(&dbVersion); err != nil {
+			t.Fatal(err)
+		}
+		if dbVersion != version.EarliestCompatibleSchema {
+			t.Errorf("Version unexpected:\ngot\n%s\nwanted\n%s", dbVersion, version.EarliestCompatibleSchema)
+		}
+		if checkpointTableExists() {
+			t.Errorf("ingest checkpoint table expected to be dropped by the downgrade")
+		}
+
+		extOptions := extension.ExtensionMigrateOptions{Install: true, Upgrade: true, UpgradePreRelease: true}
+		if err = pgmodel.Migrate(conn.Conn(), pgmodel.VersionInfo{Version: version.Promscale}, extOptions); err != nil {
+			t.Fatal(err)
+		}
+		if !checkpointTableExists() {
+			t.Errorf("ingest checkpoint table expected to be created again by the upgrade")
+		}
+	})
+}
+
 func TestMigrateLock(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -368,5 +412,40 @@ func TestMigrationLib(t *testing.T) {
 			"idempotent 2")
 		migrate_to("0.10.2-beta.dev.1")
 		verifyLogs(t, db, expected)
+
+		downgrade_to := func(version string) error {
+			c, err := db.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Release()
+			mig := pgmodel.NewMigrator(c.Conn(), test_migrations.MigrationFiles, testTOC)
+
+			return mig.Downgrade(semver.MustParse(version))
+		}
+
+		//downgrades apply the down-migrations in reverse order, without the idempotent files
+		expected = append(expected,
+			"downgrade 0.10.2-beta=1",
+			"downgrade 0.10.1=2")
+		if err := downgrade_to("0.10.1-dev.1"); err != nil {
+			t.Fatal(err)
+		}
+		verifyLogs(t, db, expected)
+
+		//downgrading below a version without a down-migration applies nothing
+		if err := downgrade_to("0.9.0"); err == nil {
+			t.Errorf("expected an error downgrading past 0.10.0=2")
+		}
+		verifyLogs(t, db, expected)
+
+		//upgrading after a downgrade applies the reverted migrations again
+		expected = append(expected,
+			"migration 0.10.1=2",
+			"migration 0.10.2-beta=1",
+			"idempotent 1",
+			"idempotent 2")
+		migrate_to("0.10.2-beta.dev.1")
+		verifyLogs(t, db, expected)
 	})
 }
@@ -0,0 +1,98 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package end_to_end_tests
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/timescale/promscale/pkg/api"
+	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	remoteReadBenchSeries  = 20
+	remoteReadBenchSamples = 10000
+)
+
+// BenchmarkRemoteRead compares serving remote read with samples and with
+// streamed XOR chunks, from the request to the response body. The bytes per
+// operation are the 16 bytes of each sample served, so that MB/s reads as
+// the throughput of samples served per CPU.
+func BenchmarkRemoteRead(b *testing.B) {
+	withDB(b, "bench_remote_read", func(db *pgxpool.Pool, t testing.TB) {
+		ts := make([]prompb.TimeSeries, remoteReadBenchSeries)
+		for i := range ts {
+			ts[i].Labels = []prompb.Label{
+				{Name: model.MetricNameLabelName, Value: "remote_read_bench"},
+				{Name: "instance", Value: fmt.Sprint(i)},
+			}
+			ts[i].Samples = make([]prompb.Sample, remoteReadBenchSamples)
+			for j := range ts[i].Samples {
+				ts[i].Samples[j] = prompb.Sample{Timestamp: int64(j) * 15000, Value: math.Sin(float64(i+j)) * 100}
+			}
+		}
+		ingestQueryTestDataset(db, t, ts)
+
+		client, err := pgclient.NewClientWithPool(&pgclient.Config{}, 1, db, tenancy.NewNoopAuthorizer(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		handler := api.Read(&api.Config{}, client, api.InitMetrics())
+
+		query := &prompb.Query{
+			StartTimestampMs: 0,
+			EndTimestampMs:   remoteReadBenchSamples * 15000,
+			Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: model.MetricNameLabelName, Value: "remote_read_bench"}},
+		}
+
+		for _, c := range []struct {
+			name         string
+			responseType prompb.ReadRequest_ResponseType
+		}{
+			{"samples", prompb.ReadRequest_SAMPLES},
+			{"chunks", prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+		} {
+			data, err := proto.Marshal(&prompb.ReadRequest{
+				Queries:               []*prompb.Query{query},
+				AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{c.responseType},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := snappy.Encode(nil, data)
+
+			b.Run(c.name, func(b *testing.B) {
+				b.SetBytes(remoteReadBenchSeries * remoteReadBenchSamples * 16)
+				b.ReportAllocs()
+				var respBytes int
+				for n := 0; n < b.N; n++ {
+					req := httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(body))
+					req.Header.Set("Content-Encoding", "snappy")
+					req.Header.Set("Content-Type", "application/x-protobuf")
+					req.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, req)
+					if w.Code != http.StatusOK {
+						b.Fatalf("unexpected status code %d: %s", w.Code, w.Body.String())
+					}
+					respBytes = w.Body.Len()
+				}
+				b.ReportMetric(float64(respBytes), "resp-bytes/op")
+			})
+		}
+	})
+}
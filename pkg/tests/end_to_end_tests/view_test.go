@@ -187,6 +187,7 @@ func TestSQLView(t *testing.T) {
 			}
 			getViewRowCount(t, db, "prom_series.\""+name+"\"", "", seriesCount)
 			getViewRowCount(t, db, "prom_metric.\""+name+"\"", "", pointCount)
+			getViewRowCount(t, db, "prom_metric_labeled.\""+name+"\"", "", pointCount)
 		}
 	})
 }
@@ -0,0 +1,17 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package integration runs the end-to-end tests of the ingestor and the
+// querier against every database version Promscale supports, each started
+// in its own containers. The tests are only built with the integration tag:
+//
+//	go test -tags=integration -timeout 0 ./pkg/tests/integration/
+//
+// Each version is a subtest of TestDatabaseVersions, so that the versions to
+// test can be selected with -run, e.g. -run TestDatabaseVersions/^ts2-pg13$,
+// and the end-to-end tests to run against them with -e2e-run. Each version
+// runs against a pinned database image, passed to the end-to-end tests with
+// their -db-image flag; more flags can be passed to them with -e2e-flags,
+// e.g. -e2e-flags="-extended-test -print-logs".
+package integration
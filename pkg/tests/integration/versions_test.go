@@ -0,0 +1,110 @@
+// +build integration
+
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package integration
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const endToEndTests = "../end_to_end_tests/"
+
+var (
+	e2eRun   = flag.String("e2e-run", "", "run only the end-to-end tests matching the regular expression against each version")
+	e2eFlags = flag.String("e2e-flags", "", "additional flags of the end-to-end tests, e.g. -extended-test")
+)
+
+// dbVersion is a database version the end-to-end tests are run against, the
+// flags of the end-to-end tests that start its containers, and the pinned
+// image of the database they start.
+type dbVersion struct {
+	name  string
+	image string
+	flags []string
+}
+
+// dbVersions are the supported combinations of PostgreSQL, TimescaleDB and
+// the Promscale extension. Their images are pinned, so that a new image does
+// not change the versions tested.
+var dbVersions = []dbVersion{
+	{"pg13", "postgres:13.4", []string{"-use-extension=false", "-use-timescaledb=false", "-use-timescale2=false"}},
+	{"ts1-pg12", "timescale/timescaledb:1.7.4-pg12", []string{"-use-extension=false", "-use-timescale2=false", "-postgres-version-major=12"}},
+	{"ts1-promscale-pg12", "timescaledev/promscale-extension:0.2.0-ts1-pg12", []string{"-use-timescale2=false", "-postgres-version-major=12"}},
+	{"ts2-pg12", "timescale/timescaledb:2.4.2-pg12", []string{"-use-extension=false", "-postgres-version-major=12"}},
+	{"ts2-promscale-pg12", "timescaledev/promscale-extension:0.2.0-ts2-pg12", []string{"-postgres-version-major=12"}},
+	{"ts2-pg13", "timescale/timescaledb:2.4.2-pg13", []string{"-use-extension=false"}},
+	{"ts2-promscale-pg13", "timescaledev/promscale-extension:0.2.0-ts2-pg13", nil},
+	{"ts2-oss-pg13", "timescale/timescaledb:2.4.2-pg13-oss", []string{"-use-extension=false", "-use-timescaledb-oss"}},
+	{"multinode-promscale-pg13", "timescaledev/promscale-extension:0.2.0-ts2-pg13", []string{"-use-multinode"}},
+}
+
+// TestDatabaseVersions runs the end-to-end tests against each database
+// version, one after the other since their containers listen on the same
+// ports.
+func TestDatabaseVersions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the end-to-end tests require docker")
+	}
+	for _, v := range dbVersions {
+		v := v
+		t.Run(v.name, func(t *testing.T) {
+			runEndToEndTests(t, v)
+		})
+	}
+}
+
+// runEndToEndTests runs the end-to-end tests against the version with go
+// test, for their TestMain to start its containers.
+func runEndToEndTests(t *testing.T, v dbVersion) {
+	args := []string{"test", "-count=1", "-timeout", childTimeout(t).String()}
+	if testing.Verbose() {
+		args = append(args, "-v")
+	}
+	if *e2eRun != "" {
+		args = append(args, "-run", *e2eRun)
+	}
+	args = append(args, endToEndTests, "-args", "-db-image="+v.image)
+	args = append(args, v.flags...)
+	args = append(args, strings.Fields(*e2eFlags)...)
+
+	var output bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if testing.Verbose() {
+		cmd.Stdout = io.MultiWriter(&output, os.Stdout)
+		cmd.Stderr = io.MultiWriter(&output, os.Stderr)
+	}
+	t.Logf("go %v", args)
+	if err := cmd.Run(); err != nil {
+		if !testing.Verbose() {
+			t.Log(output.String())
+		}
+		t.Fatalf("end-to-end tests failed against %s: %v", v.name, err)
+	}
+}
+
+// childTimeout returns the timeout of the end-to-end tests, which must end
+// before the deadline of the test running them, 0 to run them without one.
+func childTimeout(t *testing.T) time.Duration {
+	deadline, ok := t.Deadline()
+	if !ok {
+		return 0
+	}
+	// Leave the time to report the failure of the end-to-end tests.
+	timeout := time.Until(deadline) - 10*time.Second
+	if timeout <= 0 {
+		t.Fatal("no time left to run the end-to-end tests, set a longer -timeout")
+	}
+	return timeout
+}
@@ -21,6 +21,37 @@ var MigrationFiles = func() http.FileSystem {
 			name:    "/",
 			modTime: time.Time{},
 		},
+		"/down": &vfsgen۰DirInfo{
+			name:    "down",
+			modTime: time.Time{},
+		},
+		"/down/dev": &vfsgen۰DirInfo{
+			name:    "dev",
+			modTime: time.Time{},
+		},
+		"/down/dev/0.10.1-dev": &vfsgen۰DirInfo{
+			name:    "0.10.1-dev",
+			modTime: time.Time{},
+		},
+		"/down/dev/0.10.1-dev/1-migr_98_at.sql": &vfsgen۰FileInfo{
+			name:    "1-migr_98_at.sql",
+			modTime: time.Time{},
+			content: []byte("\x49\x4e\x53\x45\x52\x54\x20\x49\x4e\x54\x4f\x20\x6c\x6f\x67\x20\x56\x41\x4c\x55\x45\x53\x28\x27\x64\x6f\x77\x6e\x67\x72\x61\x64\x65\x20\x30\x2e\x31\x30\x2e\x31\x3d\x31\x27\x29\x3b\x0a"),
+		},
+		"/down/dev/0.10.1-dev/2-1_mig.sql": &vfsgen۰FileInfo{
+			name:    "2-1_mig.sql",
+			modTime: time.Time{},
+			content: []byte("\x49\x4e\x53\x45\x52\x54\x20\x49\x4e\x54\x4f\x20\x6c\x6f\x67\x20\x56\x41\x4c\x55\x45\x53\x28\x27\x64\x6f\x77\x6e\x67\x72\x61\x64\x65\x20\x30\x2e\x31\x30\x2e\x31\x3d\x32\x27\x29\x3b\x0a"),
+		},
+		"/down/dev/0.10.2-beta.dev": &vfsgen۰DirInfo{
+			name:    "0.10.2-beta.dev",
+			modTime: time.Time{},
+		},
+		"/down/dev/0.10.2-beta.dev/1-migr_98_at.sql": &vfsgen۰FileInfo{
+			name:    "1-migr_98_at.sql",
+			modTime: time.Time{},
+			content: []byte("\x49\x4e\x53\x45\x52\x54\x20\x49\x4e\x54\x4f\x20\x6c\x6f\x67\x20\x56\x41\x4c\x55\x45\x53\x28\x27\x64\x6f\x77\x6e\x67\x72\x61\x64\x65\x20\x30\x2e\x31\x30\x2e\x32\x2d\x62\x65\x74\x61\x3d\x31\x27\x29\x3b\x0a"),
+		},
 		"/idempotent": &vfsgen۰DirInfo{
 			name:    "idempotent",
 			modTime: time.Time{},
@@ -118,10 +149,25 @@ var MigrationFiles = func() http.FileSystem {
 		},
 	}
 	fs["/"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
+		fs["/down"].(os.FileInfo),
 		fs["/idempotent"].(os.FileInfo),
 		fs["/preinstall"].(os.FileInfo),
 		fs["/versions"].(os.FileInfo),
 	}
+	fs["/down"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
+		fs["/down/dev"].(os.FileInfo),
+	}
+	fs["/down/dev"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
+		fs["/down/dev/0.10.1-dev"].(os.FileInfo),
+		fs["/down/dev/0.10.2-beta.dev"].(os.FileInfo),
+	}
+	fs["/down/dev/0.10.1-dev"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
+		fs["/down/dev/0.10.1-dev/1-migr_98_at.sql"].(os.FileInfo),
+		fs["/down/dev/0.10.1-dev/2-1_mig.sql"].(os.FileInfo),
+	}
+	fs["/down/dev/0.10.2-beta.dev"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
+		fs["/down/dev/0.10.2-beta.dev/1-migr_98_at.sql"].(os.FileInfo),
+	}
 	fs["/idempotent"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
 		fs["/idempotent/1-toc-run_second.sql"].(os.FileInfo),
 		fs["/idempotent/2-toc-run_first.sql"].(os.FileInfo),
@@ -0,0 +1 @@
+INSERT INTO log VALUES('downgrade 0.10.1=1');
@@ -0,0 +1 @@
+INSERT INTO log VALUES('downgrade 0.10.2-beta=1');
@@ -45,6 +45,7 @@ var schemas = []string{
 	"prom_data_series",
 	"prom_info",
 	"prom_metric",
+	"prom_metric_labeled",
 	"prom_series",
 	"public",
 	"timescaledb_information",
@@ -63,6 +64,7 @@ var schemasWOTimescaleDB = []string{
 	"prom_data_series",
 	"prom_info",
 	"prom_metric",
+	"prom_metric_labeled",
 	"prom_series",
 	"public",
 }
@@ -76,6 +78,7 @@ var ourSchemas = []string{
 	"prom_data_series",
 	"prom_info",
 	"prom_metric",
+	"prom_metric_labeled",
 	"prom_series",
 }
 
@@ -40,7 +40,8 @@ func (fc *Storage) Series(req *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		return err
 	}
 
-	ss, _ := q.Select(false, nil, nil, nil, matchers...)
+	// The Store API requires the series to be sorted by labels.
+	ss, _ := q.Select(true, nil, nil, nil, matchers...)
 
 	for ss.Next() {
 		series := ss.At()
@@ -0,0 +1,109 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package units converts values between the units of the metrics, such as the
+// base units of the OpenMetrics UNIT metadata and their multiples.
+package units
+
+import (
+	"fmt"
+	"strings"
+)
+
+type unit struct {
+	// dimension is the base unit of the dimension of the unit.
+	dimension string
+	// factor is the number of base units in the unit.
+	factor float64
+}
+
+var units = map[string]unit{
+	"bytes": {"bytes", 1},
+	"b":     {"bytes", 1},
+	"kb":    {"bytes", 1e3},
+	"mb":    {"bytes", 1e6},
+	"gb":    {"bytes", 1e9},
+	"tb":    {"bytes", 1e12},
+	"kib":   {"bytes", 1 << 10},
+	"mib":   {"bytes", 1 << 20},
+	"gib":   {"bytes", 1 << 30},
+	"tib":   {"bytes", 1 << 40},
+
+	"seconds": {"seconds", 1},
+	"s":       {"seconds", 1},
+	"ms":      {"seconds", 1e-3},
+	"us":      {"seconds", 1e-6},
+	"µs":      {"seconds", 1e-6},
+	"ns":      {"seconds", 1e-9},
+	"minutes": {"seconds", 60},
+	"m":       {"seconds", 60},
+	"hours":   {"seconds", 3600},
+	"h":       {"seconds", 3600},
+	"days":    {"seconds", 86400},
+	"d":       {"seconds", 86400},
+
+	"ratio":   {"ratio", 1},
+	"percent": {"ratio", 0.01},
+	"%":       {"ratio", 0.01},
+
+	"meters":    {"meters", 1},
+	"km":        {"meters", 1e3},
+	"grams":     {"grams", 1},
+	"kg":        {"grams", 1e3},
+	"volts":     {"volts", 1},
+	"amperes":   {"amperes", 1},
+	"joules":    {"joules", 1},
+	"kwh":       {"joules", 3.6e6},
+	"celsius":   {"celsius", 1},
+	"hertz":     {"hertz", 1},
+	"watts":     {"watts", 1},
+	"kilowatts": {"watts", 1e3},
+	"megawatts": {"watts", 1e6},
+}
+
+// baseSuffixes are the suffixes of the names of the counters and of the sums
+// of the histograms and summaries, which follow the unit in the name.
+var baseSuffixes = []string{"_total", "_sum"}
+
+// Known returns whether the unit is known, case-insensitively.
+func Known(name string) bool {
+	_, ok := units[strings.ToLower(name)]
+	return ok
+}
+
+// Factor returns the factor the values in the from unit are multiplied by to
+// be in the to unit.
+func Factor(from, to string) (float64, error) {
+	f, ok := units[strings.ToLower(from)]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	t, ok := units[strings.ToLower(to)]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if f.dimension != t.dimension {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	return f.factor / t.factor, nil
+}
+
+// FromMetricName returns the base unit the name of the metric ends with,
+// before the suffix of counters and sums, following the Prometheus naming
+// conventions, e.g. seconds for http_request_duration_seconds_sum, or "" if
+// it ends with none.
+func FromMetricName(metric string) string {
+	for _, suffix := range baseSuffixes {
+		metric = strings.TrimSuffix(metric, suffix)
+	}
+	i := strings.LastIndexByte(metric, '_')
+	if i < 0 {
+		return ""
+	}
+	name := metric[i+1:]
+	if u, ok := units[name]; ok && u.dimension == name {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactor(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		factor   float64
+		err      string
+	}{
+		{from: "bytes", to: "GiB", factor: 1.0 / (1 << 30)},
+		{from: "bytes", to: "kb", factor: 1e-3},
+		{from: "seconds", to: "ms", factor: 1000},
+		{from: "ms", to: "minutes", factor: 1.0 / 60000},
+		{from: "ratio", to: "percent", factor: 100},
+		{from: "seconds", to: "seconds", factor: 1},
+		{from: "seconds", to: "GiB", err: "cannot convert seconds to GiB"},
+		{from: "furlongs", to: "meters", err: `unknown unit "furlongs"`},
+		{from: "meters", to: "furlongs", err: `unknown unit "furlongs"`},
+	}
+	for _, c := range testCases {
+		factor, err := Factor(c.from, c.to)
+		if c.err != "" {
+			require.EqualError(t, err, c.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.InDelta(t, c.factor, factor, c.factor*1e-12, "%s to %s", c.from, c.to)
+	}
+}
+
+func TestFromMetricName(t *testing.T) {
+	for metric, unit := range map[string]string{
+		"http_request_duration_seconds":       "seconds",
+		"http_request_duration_seconds_sum":   "seconds",
+		"process_cpu_seconds_total":           "seconds",
+		"node_memory_MemAvailable_bytes":      "bytes",
+		"http_request_duration_seconds_count": "",
+		"http_requests_total":                 "",
+		"up":                                  "",
+		"cache_hit_ratio":                     "ratio",
+		"latency_ms":                          "",
+	} {
+		require.Equal(t, unit, FromMetricName(metric), metric)
+	}
+}
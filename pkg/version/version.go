@@ -37,10 +37,17 @@ var (
 	// since an app version must uniquely determine the state of the schema.
 	// It is customary to bump the version by incrementing the numeral after
 	// the `dev` tag. The SQL migration script name must correspond to the /new/ version.
-	Promscale                           = "0.5.2-dev.1"
-	PromMigrator                        = "0.0.2-beta.1.dev.0"
-	CommitHash                          = ""
-	EarliestUpgradeTestVersion          = "0.1.0"
+	Promscale                  = "0.5.2-dev.20"
+	PromMigrator               = "0.0.2-beta.1.dev.0"
+	CommitHash                 = ""
+	EarliestUpgradeTestVersion = "0.1.0"
+	// EarliestCompatibleSchema is the oldest schema version the connector runs
+	// against without migrating it, with the features that need a newer
+	// schema disabled, so that connectors can be upgraded before the database.
+	// It is the version before the last migration: bump it along with the
+	// version of each new migration, once the connector either does not use
+	// the objects the migration adds or checks that the schema has them.
+	EarliestCompatibleSchema            = "0.5.2-dev.19"
 	EarliestUpgradeTestVersionMultinode = "0.1.4" //0.1.4 earliest version that supports tsdb 2.0
 
 	PgVersionNumRange       = ">=12.x <14.x" // Corresponds to range within pg 12.0 to pg 13.99
@@ -62,6 +69,11 @@ var (
 	// support 0.1.x and 0.2.x
 	ExtVersionRangeString = ">=0.1.0 <0.2.99"
 	ExtVersionRange       = semver.MustParseRange(ExtVersionRangeString)
+
+	// PrometheusCompatible is the Prometheus release whose HTTP API the connector
+	// implements. It is reported as the version on the status endpoints, so that
+	// Grafana and other tooling enable the features matching that release.
+	PrometheusCompatible = "2.27.1"
 )
 
 // VerifyPgVersion verifies the Postgresql version compatibility.